@@ -20,7 +20,8 @@ import (
 func main() {
 	// Парсим флаги командной строки
 	configPath := flag.String("config", "./config", "Путь к каталогу с конфигурацией")
-	mode := flag.String("mode", "webhook", "Режим работы бота: webhook, worker или llm")
+	mode := flag.String("mode", "webhook", "Режим работы бота: webhook, worker, llm, scheduler или reconcile")
+	repair := flag.Bool("repair", false, "Исправить расхождения, найденные при сверке (режим reconcile)")
 	flag.Parse()
 
 	// Инициализируем логгер
@@ -61,6 +62,14 @@ func main() {
 		// Запускаем LLM-воркер
 		runLLMWorker(cfg, logger)
 
+	case "scheduler":
+		// Запускаем периодические задачи
+		runScheduler(cfg, logger)
+
+	case "reconcile":
+		// Сверяем балансы нейронов с главной книгой
+		runReconciliation(cfg, logger, *repair)
+
 	default:
 		logger.Fatal("Неизвестный режим работы", zap.String("mode", *mode))
 	}
@@ -69,7 +78,11 @@ func main() {
 // runWebhookServer запускает сервер для обработки вебхуков
 func runWebhookServer(cfg *config.Config, logger *zap.Logger) {
 	// Создаем обработчик вебхуков
-	webhookHandler := app.NewWebhookHandler(cfg, logger)
+	webhookHandler, err := app.NewWebhookHandler(cfg, logger)
+	if err != nil {
+		logger.Fatal("Ошибка создания обработчика вебхуков", zap.Error(err))
+	}
+	defer webhookHandler.Close()
 
 	// Запускаем сервер
 	server := &http.Server{
@@ -168,3 +181,42 @@ func runLLMWorker(cfg *config.Config, logger *zap.Logger) {
 
 	logger.Info("LLM-обработчик остановлен")
 }
+
+// runScheduler запускает планировщик периодических задач
+func runScheduler(cfg *config.Config, logger *zap.Logger) {
+	// Создаем планировщик задач
+	jobScheduler, err := app.NewJobScheduler(cfg, logger)
+	if err != nil {
+		logger.Fatal("Ошибка создания планировщика задач", zap.Error(err))
+	}
+
+	// Запускаем задачи по расписанию
+	jobScheduler.Start()
+
+	// Настраиваем канал для обработки сигналов остановки
+	quit := make(chan os.Signal, 1)
+	signal.Notify(quit, syscall.SIGINT, syscall.SIGTERM)
+
+	// Ожидаем сигнал
+	sig := <-quit
+	logger.Info("Получен сигнал остановки", zap.String("signal", sig.String()))
+
+	// Останавливаем планировщик, дожидаясь завершения выполняющихся задач
+	jobScheduler.Stop()
+}
+
+// runReconciliation сверяет балансы нейронов с главной книгой
+func runReconciliation(cfg *config.Config, logger *zap.Logger, repair bool) {
+	report, err := app.RunReconciliation(context.Background(), cfg, logger, repair)
+	if err != nil {
+		logger.Fatal("Ошибка сверки балансов", zap.Error(err))
+	}
+
+	// Расхождения и итоги сверки записываются в лог сервисом валюты. Ненулевой код выхода
+	// позволяет отслеживать неисправленные расхождения в CI и cron; os.Exit не выполняет
+	// отложенные вызовы, поэтому логи сбрасываются явно
+	if len(report.Discrepancies) > report.Repaired {
+		logger.Sync()
+		os.Exit(2)
+	}
+}
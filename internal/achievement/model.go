@@ -0,0 +1,60 @@
+// Модель достижений
+
+package achievement
+
+import (
+	"time"
+)
+
+// Коды достижений из начальных данных
+const (
+	CodeFirstMessage        = "first_message"
+	CodeDailyStreak7        = "daily_streak_7"
+	CodeDailyStreak30       = "daily_streak_30"
+	CodeTryAllModels        = "try_all_models"
+	CodeInviteFriend        = "invite_friend"
+	CodePremiumSubscription = "premium_subscription"
+	CodeProSubscription     = "pro_subscription"
+	CodeHiddenCommand       = "hidden_command"
+)
+
+// HiddenCommand - секретная команда бота для скрытого достижения
+const HiddenCommand = "matrix"
+
+// Achievement представляет достижение
+type Achievement struct {
+	ID           int       `db:"id"`
+	Code         string    `db:"code"`
+	Name         string    `db:"name"`
+	Description  string    `db:"description"`
+	IconURL      string    `db:"icon_url"`
+	XPReward     int       `db:"xp_reward"`
+	NeuronReward int       `db:"neuron_reward"`
+	Difficulty   string    `db:"difficulty"` // easy, medium, hard
+	IsHidden     bool      `db:"is_hidden"`
+	IsActive     bool      `db:"is_active"`
+	CreatedAt    time.Time `db:"created_at"`
+	UpdatedAt    time.Time `db:"updated_at"`
+}
+
+// HasReward проверяет, есть ли у достижения награда
+func (a *Achievement) HasReward() bool {
+	return a.XPReward > 0 || a.NeuronReward > 0
+}
+
+// UserAchievement представляет достижение вместе с прогрессом пользователя
+type UserAchievement struct {
+	Achievement
+	UnlockedAt    *time.Time `db:"unlocked_at"` // nil - достижение еще не получено
+	RewardClaimed bool       `db:"reward_claimed"`
+}
+
+// IsUnlocked проверяет, получено ли достижение
+func (u *UserAchievement) IsUnlocked() bool {
+	return u.UnlockedAt != nil
+}
+
+// CanClaim проверяет, можно ли забрать награду за достижение
+func (u *UserAchievement) CanClaim() bool {
+	return u.IsUnlocked() && !u.RewardClaimed && u.HasReward()
+}
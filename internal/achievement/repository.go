@@ -0,0 +1,244 @@
+// Репозиторий достижений
+
+package achievement
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+)
+
+// Repository представляет репозиторий для работы с достижениями
+type Repository struct {
+	db *sql.DB
+}
+
+// NewRepository создает новый репозиторий достижений
+func NewRepository(db *sql.DB) *Repository {
+	return &Repository{
+		db: db,
+	}
+}
+
+// GetByCode возвращает активное достижение по коду
+func (r *Repository) GetByCode(ctx context.Context, code string) (*Achievement, error) {
+	query := `
+		SELECT id, code, name, description, COALESCE(icon_url, ''), xp_reward, neuron_reward,
+		       difficulty, is_hidden, is_active, created_at, updated_at
+		FROM achievements
+		WHERE code = $1 AND is_active = true
+	`
+
+	a := &Achievement{}
+	err := r.db.QueryRowContext(ctx, query, code).Scan(
+		&a.ID,
+		&a.Code,
+		&a.Name,
+		&a.Description,
+		&a.IconURL,
+		&a.XPReward,
+		&a.NeuronReward,
+		&a.Difficulty,
+		&a.IsHidden,
+		&a.IsActive,
+		&a.CreatedAt,
+		&a.UpdatedAt,
+	)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, nil // Достижение не найдено или отключено
+		}
+		return nil, fmt.Errorf("ошибка получения достижения: %w", err)
+	}
+
+	return a, nil
+}
+
+// GetUserAchievements возвращает все активные достижения с прогрессом пользователя
+func (r *Repository) GetUserAchievements(ctx context.Context, userID int64) ([]*UserAchievement, error) {
+	query := `
+		SELECT a.id, a.code, a.name, a.description, COALESCE(a.icon_url, ''), a.xp_reward, a.neuron_reward,
+		       a.difficulty, a.is_hidden, a.is_active, a.created_at, a.updated_at,
+		       ua.unlocked_at, COALESCE(ua.reward_claimed, false)
+		FROM achievements a
+		LEFT JOIN user_achievements ua ON ua.achievement_id = a.id AND ua.user_id = $1
+		WHERE a.is_active = true
+		ORDER BY a.id ASC
+	`
+
+	rows, err := r.db.QueryContext(ctx, query, userID)
+	if err != nil {
+		return nil, fmt.Errorf("ошибка получения достижений пользователя: %w", err)
+	}
+	defer rows.Close()
+
+	var achievements []*UserAchievement
+	for rows.Next() {
+		ua := &UserAchievement{}
+		err := rows.Scan(
+			&ua.ID,
+			&ua.Code,
+			&ua.Name,
+			&ua.Description,
+			&ua.IconURL,
+			&ua.XPReward,
+			&ua.NeuronReward,
+			&ua.Difficulty,
+			&ua.IsHidden,
+			&ua.IsActive,
+			&ua.CreatedAt,
+			&ua.UpdatedAt,
+			&ua.UnlockedAt,
+			&ua.RewardClaimed,
+		)
+		if err != nil {
+			return nil, fmt.Errorf("ошибка сканирования достижения: %w", err)
+		}
+		achievements = append(achievements, ua)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("ошибка при итерации достижений: %w", err)
+	}
+
+	return achievements, nil
+}
+
+// GetUserAchievement возвращает достижение с прогрессом пользователя
+func (r *Repository) GetUserAchievement(ctx context.Context, userID int64, achievementID int) (*UserAchievement, error) {
+	achievements, err := r.GetUserAchievements(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, ua := range achievements {
+		if ua.ID == achievementID {
+			return ua, nil
+		}
+	}
+
+	return nil, nil
+}
+
+// IsUnlocked проверяет, получено ли пользователем достижение с указанным кодом
+func (r *Repository) IsUnlocked(ctx context.Context, userID int64, code string) (bool, error) {
+	var exists bool
+	err := r.db.QueryRowContext(ctx, `
+		SELECT EXISTS(
+			SELECT 1 FROM user_achievements ua
+			JOIN achievements a ON a.id = ua.achievement_id
+			WHERE ua.user_id = $1 AND a.code = $2
+		)
+	`, userID, code).Scan(&exists)
+	if err != nil {
+		return false, fmt.Errorf("ошибка проверки достижения: %w", err)
+	}
+
+	return exists, nil
+}
+
+// Unlock записывает получение достижения. Возвращает false, если оно уже было получено
+func (r *Repository) Unlock(ctx context.Context, userID int64, achievementID int) (bool, error) {
+	result, err := r.db.ExecContext(ctx, `
+		INSERT INTO user_achievements (user_id, achievement_id)
+		VALUES ($1, $2)
+		ON CONFLICT (user_id, achievement_id) DO NOTHING
+	`, userID, achievementID)
+	if err != nil {
+		return false, fmt.Errorf("ошибка записи достижения: %w", err)
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return false, fmt.Errorf("ошибка получения количества затронутых строк: %w", err)
+	}
+
+	return rowsAffected > 0, nil
+}
+
+// ClaimReward отмечает награду за достижение полученной.
+// Возвращает false, если достижение не получено или награда уже забрана
+func (r *Repository) ClaimReward(ctx context.Context, userID int64, achievementID int) (bool, error) {
+	result, err := r.db.ExecContext(ctx, `
+		UPDATE user_achievements
+		SET reward_claimed = true
+		WHERE user_id = $1 AND achievement_id = $2 AND reward_claimed = false
+	`, userID, achievementID)
+	if err != nil {
+		return false, fmt.Errorf("ошибка отметки награды: %w", err)
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return false, fmt.Errorf("ошибка получения количества затронутых строк: %w", err)
+	}
+
+	return rowsAffected > 0, nil
+}
+
+// ReleaseReward снимает отметку о полученной награде, если ее не удалось начислить
+func (r *Repository) ReleaseReward(ctx context.Context, userID int64, achievementID int) error {
+	_, err := r.db.ExecContext(ctx, `
+		UPDATE user_achievements
+		SET reward_claimed = false
+		WHERE user_id = $1 AND achievement_id = $2
+	`, userID, achievementID)
+	if err != nil {
+		return fmt.Errorf("ошибка снятия отметки награды: %w", err)
+	}
+
+	return nil
+}
+
+// GetUsedModels возвращает текстовые модели, которыми пользовался пользователь
+func (r *Repository) GetUsedModels(ctx context.Context, userID int64) (map[string]bool, error) {
+	rows, err := r.db.QueryContext(ctx, `
+		SELECT DISTINCT model_name
+		FROM llm_usage
+		WHERE user_id = $1 AND COALESCE(metadata->>'kind', '') <> 'image'
+	`, userID)
+	if err != nil {
+		return nil, fmt.Errorf("ошибка получения использованных моделей: %w", err)
+	}
+	defer rows.Close()
+
+	models := make(map[string]bool)
+	for rows.Next() {
+		var name string
+		if err := rows.Scan(&name); err != nil {
+			return nil, fmt.Errorf("ошибка сканирования модели: %w", err)
+		}
+		models[name] = true
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("ошибка при итерации моделей: %w", err)
+	}
+
+	return models, nil
+}
+
+// GetDailyStreak возвращает количество дней подряд, в которые пользователь получал ежедневные нейроны,
+// заканчивая последним днем получения
+func (r *Repository) GetDailyStreak(ctx context.Context, userID int64) (int, error) {
+	var streak int
+	err := r.db.QueryRowContext(ctx, `
+		WITH days AS (
+			SELECT DISTINCT DATE(created_at) AS day
+			FROM neuron_transactions
+			WHERE user_id = $1 AND transaction_type = 'daily'
+		),
+		grouped AS (
+			SELECT day, day - (ROW_NUMBER() OVER (ORDER BY day))::int AS grp
+			FROM days
+		)
+		SELECT COUNT(*)
+		FROM grouped
+		WHERE grp = (SELECT grp FROM grouped ORDER BY day DESC LIMIT 1)
+	`, userID).Scan(&streak)
+	if err != nil {
+		return 0, fmt.Errorf("ошибка подсчета серии ежедневных начислений: %w", err)
+	}
+
+	return streak, nil
+}
@@ -0,0 +1,299 @@
+// Сервис достижений
+
+package achievement
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"go.uber.org/zap"
+
+	"neurobot-prod/internal/currency"
+	"neurobot-prod/internal/events"
+	"neurobot-prod/internal/llm"
+	"neurobot-prod/internal/loyalty"
+)
+
+var (
+	// ErrNotFound возвращается, если достижение не найдено
+	ErrNotFound = errors.New("достижение не найдено")
+	// ErrNotUnlocked возвращается при попытке забрать награду за неполученное достижение
+	ErrNotUnlocked = errors.New("достижение еще не получено")
+	// ErrAlreadyClaimed возвращается, если награда уже получена
+	ErrAlreadyClaimed = errors.New("награда уже получена")
+)
+
+// Rule проверяет, выполнено ли условие достижения для события
+type Rule func(ctx context.Context, event events.Event) (bool, error)
+
+// Notifier отправляет пользователю сообщение о новом достижении
+type Notifier func(userID int64, text string)
+
+// Service оценивает доменные события и выдает достижения
+type Service struct {
+	repo            *Repository
+	currencyService *currency.Service
+	loyaltyService  *loyalty.Service
+	llmService      *llm.Service
+	rules           map[events.Type]map[string]Rule
+	notify          Notifier
+	log             *zap.Logger
+}
+
+// NewService создает новый сервис достижений
+func NewService(repo *Repository, currencyService *currency.Service, loyaltyService *loyalty.Service, llmService *llm.Service, log *zap.Logger) *Service {
+	s := &Service{
+		repo:            repo,
+		currencyService: currencyService,
+		loyaltyService:  loyaltyService,
+		llmService:      llmService,
+		rules:           make(map[events.Type]map[string]Rule),
+		log:             log.Named("achievement_service"),
+	}
+	s.registerRules()
+	return s
+}
+
+// SetNotifier устанавливает функцию уведомления о новых достижениях
+func (s *Service) SetNotifier(notify Notifier) {
+	s.notify = notify
+}
+
+// Register добавляет правило выдачи достижения по событию
+func (s *Service) Register(eventType events.Type, code string, rule Rule) {
+	if s.rules[eventType] == nil {
+		s.rules[eventType] = make(map[string]Rule)
+	}
+	s.rules[eventType][code] = rule
+}
+
+// Subscribe подписывает сервис на события, для которых есть правила
+func (s *Service) Subscribe(bus *events.Bus) {
+	for eventType := range s.rules {
+		bus.Subscribe(eventType, s.HandleEvent)
+	}
+}
+
+// registerRules регистрирует правила для достижений из начальных данных
+func (s *Service) registerRules() {
+	always := func(ctx context.Context, event events.Event) (bool, error) {
+		return true, nil
+	}
+
+	s.Register(events.LLMRequestCompleted, CodeFirstMessage, always)
+	s.Register(events.LLMRequestCompleted, CodeTryAllModels, s.usedAllModels)
+
+	s.Register(events.DailyClaimed, CodeDailyStreak7, s.dailyStreak(7))
+	s.Register(events.DailyClaimed, CodeDailyStreak30, s.dailyStreak(30))
+
+	s.Register(events.SubscriptionCreated, CodePremiumSubscription, paidPlan("premium", "pro"))
+	s.Register(events.SubscriptionCreated, CodeProSubscription, paidPlan("pro"))
+
+	s.Register(events.ReferralActivated, CodeInviteFriend, always)
+
+	s.Register(events.CommandUsed, CodeHiddenCommand, func(ctx context.Context, event events.Event) (bool, error) {
+		return event.GetString("command") == HiddenCommand, nil
+	})
+}
+
+// usedAllModels проверяет, пользовался ли пользователь всеми доступными ему текстовыми моделями
+func (s *Service) usedAllModels(ctx context.Context, event events.Event) (bool, error) {
+	if event.GetString("kind") == "image" {
+		return false, nil
+	}
+
+	available, err := s.llmService.GetAvailableModels(ctx, event.UserID)
+	if err != nil {
+		return false, err
+	}
+	if len(available) < 2 {
+		return false, nil
+	}
+
+	used, err := s.repo.GetUsedModels(ctx, event.UserID)
+	if err != nil {
+		return false, err
+	}
+
+	for _, model := range available {
+		if !used[model.Name] {
+			return false, nil
+		}
+	}
+	return true, nil
+}
+
+// dailyStreak возвращает правило для серии ежедневных начислений указанной длины
+func (s *Service) dailyStreak(days int) Rule {
+	return func(ctx context.Context, event events.Event) (bool, error) {
+		// Длина серии может прийти в событии, иначе считаем ее по истории начислений
+		streak := event.GetInt("streak")
+		if streak == 0 {
+			var err error
+			streak, err = s.repo.GetDailyStreak(ctx, event.UserID)
+			if err != nil {
+				return false, err
+			}
+		}
+		return streak >= days, nil
+	}
+}
+
+// paidPlan возвращает правило для оформления подписки на один из планов. Пробный период не учитывается
+func paidPlan(codes ...string) Rule {
+	return func(ctx context.Context, event events.Event) (bool, error) {
+		if event.GetString("source") == "trial" {
+			return false, nil
+		}
+		planCode := event.GetString("plan_code")
+		for _, code := range codes {
+			if planCode == code {
+				return true, nil
+			}
+		}
+		return false, nil
+	}
+}
+
+// HandleEvent проверяет правила для события и выдает выполненные достижения
+func (s *Service) HandleEvent(ctx context.Context, event events.Event) error {
+	for code, rule := range s.rules[event.Type] {
+		// Полученные достижения не проверяем повторно, чтобы не выполнять лишние запросы
+		unlocked, err := s.repo.IsUnlocked(ctx, event.UserID, code)
+		if err != nil {
+			return err
+		}
+		if unlocked {
+			continue
+		}
+
+		ok, err := rule(ctx, event)
+		if err != nil {
+			s.log.Error("Ошибка проверки условия достижения",
+				zap.String("code", code),
+				zap.Int64("user_id", event.UserID),
+				zap.Error(err))
+			continue
+		}
+		if !ok {
+			continue
+		}
+
+		if err := s.unlock(ctx, event.UserID, code); err != nil {
+			s.log.Error("Ошибка выдачи достижения",
+				zap.String("code", code),
+				zap.Int64("user_id", event.UserID),
+				zap.Error(err))
+		}
+	}
+
+	return nil
+}
+
+// unlock выдает достижение и уведомляет пользователя
+func (s *Service) unlock(ctx context.Context, userID int64, code string) error {
+	a, err := s.repo.GetByCode(ctx, code)
+	if err != nil {
+		return err
+	}
+	if a == nil {
+		return nil // Достижение отключено
+	}
+
+	unlocked, err := s.repo.Unlock(ctx, userID, a.ID)
+	if err != nil || !unlocked {
+		return err
+	}
+
+	s.log.Info("Получено достижение",
+		zap.Int64("user_id", userID),
+		zap.String("code", code))
+
+	text := fmt.Sprintf("🏆 Новое достижение: «%s»!\n%s", a.Name, a.Description)
+	if a.HasReward() {
+		text += "\n\nЗаберите награду: /achievements"
+	}
+	s.sendNotification(userID, text)
+
+	return nil
+}
+
+// GetUserAchievements возвращает достижения пользователя
+func (s *Service) GetUserAchievements(ctx context.Context, userID int64) ([]*UserAchievement, error) {
+	achievements, err := s.repo.GetUserAchievements(ctx, userID)
+	if err != nil {
+		s.log.Error("Ошибка получения достижений",
+			zap.Int64("user_id", userID),
+			zap.Error(err))
+		return nil, err
+	}
+	return achievements, nil
+}
+
+// ClaimReward начисляет награду за полученное достижение ровно один раз
+func (s *Service) ClaimReward(ctx context.Context, userID int64, achievementID int) (*UserAchievement, error) {
+	ua, err := s.repo.GetUserAchievement(ctx, userID, achievementID)
+	if err != nil {
+		return nil, err
+	}
+	if ua == nil {
+		return nil, ErrNotFound
+	}
+	if !ua.IsUnlocked() {
+		return nil, ErrNotUnlocked
+	}
+
+	claimed, err := s.repo.ClaimReward(ctx, userID, achievementID)
+	if err != nil {
+		return nil, err
+	}
+	if !claimed {
+		return nil, ErrAlreadyClaimed
+	}
+
+	if ua.NeuronReward > 0 {
+		_, err := s.currencyService.AddNeurons(ctx, userID, ua.NeuronReward, currency.TypeAchievement,
+			fmt.Sprintf("Достижение «%s»", ua.Name),
+			currency.Metadata{"achievement_id": ua.ID, "code": ua.Code},
+			"achievement:"+ua.Code, fmt.Sprintf("achievement:%d:%s", userID, ua.Code), 0)
+		if err != nil {
+			if releaseErr := s.repo.ReleaseReward(ctx, userID, achievementID); releaseErr != nil {
+				s.log.Error("Ошибка снятия отметки награды",
+					zap.Int64("user_id", userID),
+					zap.Int("achievement_id", achievementID),
+					zap.Error(releaseErr))
+			}
+			return nil, fmt.Errorf("ошибка начисления награды: %w", err)
+		}
+	}
+
+	// Нейроны уже начислены, поэтому ошибка начисления опыта только логируется
+	if ua.XPReward > 0 {
+		_, err := s.loyaltyService.AwardXP(ctx, userID, loyalty.SourceAchievement, ua.XPReward,
+			fmt.Sprintf("Достижение «%s»", ua.Name), ua.Code)
+		if err != nil {
+			s.log.Error("Ошибка начисления опыта за достижение",
+				zap.Int64("user_id", userID),
+				zap.String("code", ua.Code),
+				zap.Error(err))
+		}
+	}
+
+	ua.RewardClaimed = true
+
+	s.log.Info("Получена награда за достижение",
+		zap.Int64("user_id", userID),
+		zap.String("code", ua.Code),
+		zap.Int("neurons", ua.NeuronReward),
+		zap.Int("xp", ua.XPReward))
+
+	return ua, nil
+}
+
+// sendNotification отправляет уведомление пользователю, если задан способ уведомления
+func (s *Service) sendNotification(userID int64, text string) {
+	if s.notify != nil {
+		s.notify(userID, text)
+	}
+}
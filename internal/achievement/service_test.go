@@ -0,0 +1,119 @@
+// Тесты выдачи достижений и наград за них
+
+package achievement
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+
+	"go.uber.org/zap"
+
+	"neurobot-prod/internal/config"
+	"neurobot-prod/internal/currency"
+	"neurobot-prod/internal/events"
+	"neurobot-prod/internal/loyalty"
+	"neurobot-prod/internal/storage/postgres/pgtest"
+	"neurobot-prod/internal/subscription"
+)
+
+func TestAchievementUnlockedOnce(t *testing.T) {
+	db := pgtest.Open(t)
+	pgtest.CreateUser(t, db, 3901)
+	ctx := context.Background()
+
+	log := zap.NewNop()
+	subService := subscription.NewService(subscription.NewRepository(db), log)
+	currencyService := currency.NewService(currency.NewRepository(db), subService, log)
+	loyaltyService := loyalty.NewService(loyalty.NewRepository(db), config.LoyaltyConfig{}, log)
+	service := NewService(NewRepository(db), currencyService, loyaltyService, nil, log)
+
+	var (
+		mu            sync.Mutex
+		notifications []string
+	)
+	service.SetNotifier(func(userID int64, text string) {
+		mu.Lock()
+		defer mu.Unlock()
+		notifications = append(notifications, text)
+	})
+
+	invite, err := service.repo.GetByCode(ctx, CodeInviteFriend)
+	if err != nil || invite == nil {
+		t.Fatalf("достижение %s не найдено: %v", CodeInviteFriend, err)
+	}
+	if _, err := service.ClaimReward(ctx, 3901, invite.ID); !errors.Is(err, ErrNotUnlocked) {
+		t.Errorf("награда до получения достижения: %v, ожидалась %v", err, ErrNotUnlocked)
+	}
+
+	// Одинаковые события, обработанные параллельно, выдают достижение один раз
+	var wg sync.WaitGroup
+	for i := 0; i < 5; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if err := service.HandleEvent(ctx, events.New(events.ReferralActivated, 3901, nil)); err != nil {
+				t.Error(err)
+			}
+		}()
+	}
+	wg.Wait()
+	if len(notifications) != 1 {
+		t.Errorf("уведомлений о достижении %d, ожидалось 1", len(notifications))
+	}
+
+	// Пробная подписка и обычные команды достижений не дают
+	for _, event := range []events.Event{
+		events.New(events.SubscriptionCreated, 3901, map[string]interface{}{"plan_code": "premium", "source": "trial"}),
+		events.New(events.CommandUsed, 3901, map[string]interface{}{"command": "help"}),
+	} {
+		if err := service.HandleEvent(ctx, event); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for _, code := range []string{CodePremiumSubscription, CodeHiddenCommand} {
+		if unlocked, err := service.repo.IsUnlocked(ctx, 3901, code); err != nil || unlocked {
+			t.Errorf("достижение %s получено без выполнения условия (%v)", code, err)
+		}
+	}
+
+	// Награда начисляется один раз, даже если ее забирают параллельно
+	errs := make([]error, 3)
+	for i := range errs {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			_, errs[i] = service.ClaimReward(ctx, 3901, invite.ID)
+		}(i)
+	}
+	wg.Wait()
+
+	claimed := 0
+	for _, err := range errs {
+		switch {
+		case err == nil:
+			claimed++
+		case !errors.Is(err, ErrAlreadyClaimed):
+			t.Errorf("ошибка %v, ожидалась %v", err, ErrAlreadyClaimed)
+		}
+	}
+	if claimed != 1 {
+		t.Errorf("награда получена %d раз, ожидалось 1", claimed)
+	}
+
+	b, err := currencyService.GetBalance(ctx, 3901)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if b.Balance != invite.NeuronReward {
+		t.Errorf("баланс %d, ожидалось %d", b.Balance, invite.NeuronReward)
+	}
+	progress, err := loyaltyService.GetProgress(ctx, 3901)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if progress.XP != invite.XPReward {
+		t.Errorf("опыт %d, ожидалось %d", progress.XP, invite.XPReward)
+	}
+}
@@ -0,0 +1,137 @@
+// Рассылки в консоли администратора
+
+package admin
+
+import (
+	"context"
+	"fmt"
+
+	"go.uber.org/zap"
+
+	"neurobot-prod/internal/broadcast"
+)
+
+// authorizeBroadcast проверяет права администратора и подключение сервиса рассылок
+func (s *Service) authorizeBroadcast(ctx context.Context, actor Actor) error {
+	if err := s.authorize(ctx, actor); err != nil {
+		return err
+	}
+	if s.broadcasts == nil {
+		return ErrBroadcastUnavailable
+	}
+	return nil
+}
+
+// broadcastTarget возвращает объект записи журнала для кампании
+func broadcastTarget(id int64) string {
+	return fmt.Sprintf("broadcast #%d", id)
+}
+
+// ListBroadcasts возвращает последние кампании рассылок
+func (s *Service) ListBroadcasts(ctx context.Context, actor Actor, limit int) ([]*broadcast.Campaign, error) {
+	if err := s.authorizeBroadcast(ctx, actor); err != nil {
+		return nil, err
+	}
+	return s.broadcasts.List(ctx, clampLimit(limit))
+}
+
+// GetBroadcast возвращает кампанию со статистикой доставки
+func (s *Service) GetBroadcast(ctx context.Context, actor Actor, id int64) (*broadcast.Campaign, *broadcast.Stats, error) {
+	if err := s.authorizeBroadcast(ctx, actor); err != nil {
+		return nil, nil, err
+	}
+	return s.broadcasts.Get(ctx, id)
+}
+
+// EstimateBroadcast возвращает размер аудитории сегмента без создания кампании
+func (s *Service) EstimateBroadcast(ctx context.Context, actor Actor, segment broadcast.Segment) (int, error) {
+	if err := s.authorizeBroadcast(ctx, actor); err != nil {
+		return 0, err
+	}
+	return s.broadcasts.Estimate(ctx, segment)
+}
+
+// CreateBroadcast создает черновик кампании
+func (s *Service) CreateBroadcast(ctx context.Context, actor Actor, title, text string, segment broadcast.Segment) (*broadcast.Campaign, error) {
+	if err := s.authorizeBroadcast(ctx, actor); err != nil {
+		return nil, err
+	}
+
+	c, err := s.broadcasts.Create(ctx, actor.AdminID, title, text, segment)
+	if err != nil {
+		return nil, err
+	}
+
+	s.audit(ctx, actor, &AuditEntry{
+		Action:  ActionCreateBroadcast,
+		Target:  broadcastTarget(c.ID),
+		Details: Details{"title": c.Title, "segment": segment.String()},
+	})
+	return c, nil
+}
+
+// PreviewBroadcast отправляет текст кампании самому администратору
+func (s *Service) PreviewBroadcast(ctx context.Context, actor Actor, id int64) error {
+	if err := s.authorizeBroadcast(ctx, actor); err != nil {
+		return err
+	}
+	return s.broadcasts.Preview(ctx, id, actor.AdminID)
+}
+
+// StartBroadcast запускает кампанию
+func (s *Service) StartBroadcast(ctx context.Context, actor Actor, id int64) (*broadcast.Campaign, error) {
+	if err := s.authorizeBroadcast(ctx, actor); err != nil {
+		return nil, err
+	}
+
+	c, err := s.broadcasts.Start(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+
+	s.audit(ctx, actor, &AuditEntry{
+		Action:  ActionStartBroadcast,
+		Target:  broadcastTarget(id),
+		Details: Details{"recipients": c.TotalRecipients},
+	})
+	s.log.Info("Запущена рассылка",
+		zap.Int64("admin_id", actor.AdminID),
+		zap.Int64("campaign_id", id),
+		zap.Int("recipients", c.TotalRecipients))
+	return c, nil
+}
+
+// ResumeBroadcast повторно ставит в очередь неотправленные сообщения кампании
+func (s *Service) ResumeBroadcast(ctx context.Context, actor Actor, id int64) (int, error) {
+	if err := s.authorizeBroadcast(ctx, actor); err != nil {
+		return 0, err
+	}
+
+	queued, err := s.broadcasts.Resume(ctx, id)
+	if err != nil {
+		return 0, err
+	}
+
+	s.audit(ctx, actor, &AuditEntry{
+		Action:  ActionResumeBroadcast,
+		Target:  broadcastTarget(id),
+		Details: Details{"queued": queued},
+	})
+	return queued, nil
+}
+
+// CancelBroadcast останавливает кампанию
+func (s *Service) CancelBroadcast(ctx context.Context, actor Actor, id int64) error {
+	if err := s.authorizeBroadcast(ctx, actor); err != nil {
+		return err
+	}
+	if err := s.broadcasts.Cancel(ctx, id); err != nil {
+		return err
+	}
+
+	s.audit(ctx, actor, &AuditEntry{
+		Action: ActionCancelBroadcast,
+		Target: broadcastTarget(id),
+	})
+	return nil
+}
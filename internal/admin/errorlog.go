@@ -0,0 +1,145 @@
+// Сохранение ошибок из логов сервисов для просмотра в консоли администратора
+
+package admin
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+)
+
+// errorWriteTimeout - время на запись одной ошибки в базу данных
+const errorWriteTimeout = 5 * time.Second
+
+// ErrorLog сохраняет записи логов уровня error и выше в таблицу error_log.
+// Запись идет в фоне через очередь, чтобы логирование не ждало базу данных;
+// при переполнении очереди ошибки отбрасываются
+type ErrorLog struct {
+	repo    *Repository
+	entries chan *ErrorEntry
+	done    chan struct{}
+	mu      sync.RWMutex
+	closed  bool
+}
+
+// NewErrorLog создает журнал ошибок и запускает фоновую запись
+func NewErrorLog(repo *Repository, buffer int) *ErrorLog {
+	if buffer <= 0 {
+		buffer = 1
+	}
+
+	l := &ErrorLog{
+		repo:    repo,
+		entries: make(chan *ErrorEntry, buffer),
+		done:    make(chan struct{}),
+	}
+	go l.run()
+	return l
+}
+
+// Hook возвращает опцию логгера, дублирующую ошибки в журнал
+func (l *ErrorLog) Hook() zap.Option {
+	return zap.WrapCore(func(core zapcore.Core) zapcore.Core {
+		return zapcore.NewTee(core, &errorCore{log: l})
+	})
+}
+
+// Close дожидается записи ошибок из очереди. Ошибки, залогированные после Close, не сохраняются
+func (l *ErrorLog) Close() {
+	l.mu.Lock()
+	if !l.closed {
+		l.closed = true
+		close(l.entries)
+	}
+	l.mu.Unlock()
+	<-l.done
+}
+
+// run записывает ошибки из очереди. Ошибки самой записи не логируются, иначе они снова попадут в очередь
+func (l *ErrorLog) run() {
+	defer close(l.done)
+	for entry := range l.entries {
+		ctx, cancel := context.WithTimeout(context.Background(), errorWriteTimeout)
+		l.repo.AddError(ctx, entry)
+		cancel()
+	}
+}
+
+// push ставит ошибку в очередь без ожидания
+func (l *ErrorLog) push(entry *ErrorEntry) {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+	if l.closed {
+		return
+	}
+
+	select {
+	case l.entries <- entry:
+	default:
+	}
+}
+
+// errorCore передает в журнал записи уровня error и выше
+type errorCore struct {
+	log    *ErrorLog
+	fields []zapcore.Field
+}
+
+// Enabled реализует zapcore.Core
+func (c *errorCore) Enabled(level zapcore.Level) bool {
+	return level >= zapcore.ErrorLevel
+}
+
+// With реализует zapcore.Core
+func (c *errorCore) With(fields []zapcore.Field) zapcore.Core {
+	clone := &errorCore{log: c.log, fields: make([]zapcore.Field, 0, len(c.fields)+len(fields))}
+	clone.fields = append(clone.fields, c.fields...)
+	clone.fields = append(clone.fields, fields...)
+	return clone
+}
+
+// Check реализует zapcore.Core
+func (c *errorCore) Check(entry zapcore.Entry, checked *zapcore.CheckedEntry) *zapcore.CheckedEntry {
+	if c.Enabled(entry.Level) {
+		return checked.AddCore(entry, c)
+	}
+	return checked
+}
+
+// Write реализует zapcore.Core
+func (c *errorCore) Write(entry zapcore.Entry, fields []zapcore.Field) error {
+	encoder := zapcore.NewMapObjectEncoder()
+	for _, field := range c.fields {
+		field.AddTo(encoder)
+	}
+	for _, field := range fields {
+		field.AddTo(encoder)
+	}
+
+	e := &ErrorEntry{
+		Logger:    entry.LoggerName,
+		Message:   entry.Message,
+		CreatedAt: entry.Time,
+	}
+	if entry.Caller.Defined {
+		e.Caller = entry.Caller.TrimmedPath()
+	}
+	if errText, ok := encoder.Fields["error"].(string); ok {
+		e.Error = errText
+		delete(encoder.Fields, "error")
+	}
+	if len(encoder.Fields) > 0 {
+		e.Fields = Details(encoder.Fields)
+	}
+
+	c.log.push(e)
+	return nil
+}
+
+// Sync реализует zapcore.Core
+func (c *errorCore) Sync() error {
+	return nil
+}
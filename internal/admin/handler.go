@@ -0,0 +1,689 @@
+// HTTP API консоли администратора
+
+package admin
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+
+	"neurobot-prod/internal/api"
+	"neurobot-prod/internal/broadcast"
+	"neurobot-prod/internal/config"
+	"neurobot-prod/internal/conversation"
+	"neurobot-prod/internal/currency"
+	"neurobot-prod/internal/subscription"
+)
+
+const (
+	// defaultListLimit - количество записей журнала или ошибок по умолчанию
+	defaultListLimit = 20
+	// adminIDKey - ключ контекста gin с Telegram ID администратора
+	adminIDKey = "admin_id"
+)
+
+// Handler обрабатывает запросы HTTP API консоли администратора
+type Handler struct {
+	service  *Service
+	config   config.APIServiceConfig
+	botToken string
+	log      *zap.Logger
+}
+
+// NewHandler создает новый обработчик HTTP API консоли администратора
+func NewHandler(service *Service, cfg *config.Config, log *zap.Logger) *Handler {
+	return &Handler{
+		service:  service,
+		config:   cfg.Services.API,
+		botToken: cfg.Telegram.Token,
+		log:      log.Named("admin_handler"),
+	}
+}
+
+// RegisterRoutes регистрирует маршруты консоли. Токен консоли выдается по initData
+// Mini App (POST /auth/telegram) только администраторам; токены Mini App не принимаются
+func (h *Handler) RegisterRoutes(group *gin.RouterGroup) {
+	group.POST("/auth/telegram", h.handleAuth)
+
+	authorized := group.Group("")
+	authorized.Use(h.authenticate)
+	authorized.GET("/users/:id", h.handleLookupUser)
+	authorized.POST("/users/:id/balance", h.handleAdjustBalance)
+	authorized.POST("/users/:id/subscription", h.handleGrantSubscription)
+	authorized.POST("/users/:id/subscription/cancel", h.handleCancelSubscription)
+	authorized.GET("/plans", h.handlePlans)
+	authorized.PUT("/plans/:code", h.handleTogglePlan)
+	authorized.GET("/packages", h.handlePackages)
+	authorized.PUT("/packages/:id", h.handleTogglePackage)
+	authorized.GET("/models", h.handleModels)
+	authorized.PUT("/models/:name", h.handleToggleModel)
+	authorized.GET("/errors", h.handleErrors)
+	authorized.GET("/audit", h.handleAudit)
+	authorized.GET("/admins", h.handleAdmins)
+	authorized.POST("/admins", h.handleAddAdmin)
+	authorized.DELETE("/admins/:id", h.handleRemoveAdmin)
+	authorized.GET("/broadcasts", h.handleBroadcasts)
+	authorized.POST("/broadcasts", h.handleCreateBroadcast)
+	authorized.POST("/broadcasts/estimate", h.handleEstimateBroadcast)
+	authorized.GET("/broadcasts/:id", h.handleBroadcast)
+	authorized.POST("/broadcasts/:id/preview", h.handlePreviewBroadcast)
+	authorized.POST("/broadcasts/:id/start", h.handleStartBroadcast)
+	authorized.POST("/broadcasts/:id/resume", h.handleResumeBroadcast)
+	authorized.POST("/broadcasts/:id/cancel", h.handleCancelBroadcast)
+	authorized.GET("/personas", h.handlePersonas)
+	authorized.POST("/personas", h.handleCreatePersona)
+	authorized.PUT("/personas/:code", h.handleUpdatePersona)
+	authorized.DELETE("/personas/:code", h.handleDeletePersona)
+}
+
+// authenticate проверяет токен доступа и права администратора
+func (h *Handler) authenticate(c *gin.Context) {
+	token, ok := strings.CutPrefix(c.GetHeader("Authorization"), "Bearer ")
+	if !ok {
+		c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "требуется авторизация"})
+		return
+	}
+
+	claims, err := api.ParseToken(strings.TrimSpace(token), api.AudienceAdmin, h.config.JWTSecret, time.Now())
+	if err != nil {
+		c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": api.ErrInvalidToken.Error()})
+		return
+	}
+
+	userID, err := claims.UserID()
+	if err != nil {
+		c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": api.ErrInvalidToken.Error()})
+		return
+	}
+
+	if !h.service.IsAdmin(c.Request.Context(), userID) {
+		h.log.Warn("Запрос к консоли без прав администратора", zap.Int64("user_id", userID))
+		c.AbortWithStatusJSON(http.StatusForbidden, gin.H{"error": ErrForbidden.Error()})
+		return
+	}
+
+	c.Set(adminIDKey, userID)
+	c.Next()
+}
+
+// handleAuth проверяет initData Mini App и выдает администратору токен консоли
+func (h *Handler) handleAuth(c *gin.Context) {
+	var req authRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "не переданы данные авторизации"})
+		return
+	}
+
+	maxAge := time.Duration(h.config.InitDataMaxAgeHours) * time.Hour
+	webAppUser, err := api.ValidateInitData(req.InitData, h.botToken, maxAge, time.Now())
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": err.Error()})
+		return
+	}
+
+	if !h.service.IsAdmin(c.Request.Context(), webAppUser.ID) {
+		h.log.Warn("Вход в консоль без прав администратора", zap.Int64("user_id", webAppUser.ID))
+		c.JSON(http.StatusForbidden, gin.H{"error": ErrForbidden.Error()})
+		return
+	}
+
+	ttl := time.Duration(h.config.AdminJWTExpiryHours) * time.Hour
+	token, expiresAt, err := api.IssueToken(webAppUser.ID, api.AudienceAdmin, h.config.JWTSecret, ttl, time.Now())
+	if err != nil {
+		h.log.Error("Ошибка выпуска токена консоли", zap.Error(err))
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "внутренняя ошибка сервера"})
+		return
+	}
+
+	h.log.Info("Вход в консоль администратора", zap.Int64("admin_id", webAppUser.ID))
+	c.JSON(http.StatusOK, authResponse{Token: token, ExpiresAt: expiresAt})
+}
+
+// actor возвращает администратора, выполняющего запрос
+func actor(c *gin.Context) Actor {
+	return Actor{AdminID: c.GetInt64(adminIDKey), Source: SourceAPI}
+}
+
+// userIDParam возвращает Telegram ID пользователя из пути
+func userIDParam(c *gin.Context) (int64, bool) {
+	userID, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil || userID <= 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "некорректный ID пользователя"})
+		return 0, false
+	}
+	return userID, true
+}
+
+// limitQuery возвращает количество записей из параметра limit, не больше maxListLimit
+func limitQuery(c *gin.Context) int {
+	limit, err := strconv.Atoi(c.Query("limit"))
+	if err != nil || limit <= 0 {
+		return defaultListLimit
+	}
+	if limit > maxListLimit {
+		return maxListLimit
+	}
+	return limit
+}
+
+// handleLookupUser возвращает карточку пользователя по Telegram ID или юзернейму
+func (h *Handler) handleLookupUser(c *gin.Context) {
+	info, err := h.service.LookupUser(c.Request.Context(), actor(c), c.Param("id"))
+	if err != nil {
+		h.respondError(c, "Ошибка поиска пользователя", err)
+		return
+	}
+	c.JSON(http.StatusOK, newUserResponse(info))
+}
+
+// handleAdjustBalance корректирует баланс. Заголовок Idempotency-Key защищает от повторного списания или начисления
+func (h *Handler) handleAdjustBalance(c *gin.Context) {
+	userID, ok := userIDParam(c)
+	if !ok {
+		return
+	}
+
+	var req balanceRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "некорректный запрос"})
+		return
+	}
+
+	key := c.GetHeader("Idempotency-Key")
+	if key != "" {
+		key = "admin:api:" + key
+	}
+
+	tx, err := h.service.AdjustBalance(c.Request.Context(), actor(c), userID, req.Amount, req.Reason, key)
+	if err != nil {
+		h.respondError(c, "Ошибка корректировки баланса", err)
+		return
+	}
+	c.JSON(http.StatusOK, newTransactionResponse(tx))
+}
+
+// handleGrantSubscription выдает пользователю подписку
+func (h *Handler) handleGrantSubscription(c *gin.Context) {
+	userID, ok := userIDParam(c)
+	if !ok {
+		return
+	}
+
+	var req grantRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "некорректный запрос"})
+		return
+	}
+
+	sub, err := h.service.GrantSubscription(c.Request.Context(), actor(c), userID, req.PlanCode, req.Days, req.Reason)
+	if err != nil {
+		h.respondError(c, "Ошибка выдачи подписки", err)
+		return
+	}
+	c.JSON(http.StatusOK, newSubscriptionResponse(sub))
+}
+
+// handleCancelSubscription отменяет платную подписку пользователя
+func (h *Handler) handleCancelSubscription(c *gin.Context) {
+	userID, ok := userIDParam(c)
+	if !ok {
+		return
+	}
+
+	var req cancelRequest
+	if c.Request.ContentLength > 0 {
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "некорректный запрос"})
+			return
+		}
+	}
+
+	sub, err := h.service.CancelSubscription(c.Request.Context(), actor(c), userID, req.Reason)
+	if err != nil {
+		h.respondError(c, "Ошибка отмены подписки", err)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"cancelled": sub.ID})
+}
+
+// handlePlans возвращает все планы подписок
+func (h *Handler) handlePlans(c *gin.Context) {
+	plans, err := h.service.ListPlans(c.Request.Context(), actor(c))
+	if err != nil {
+		h.respondError(c, "Ошибка получения планов", err)
+		return
+	}
+
+	items := make([]planResponse, 0, len(plans))
+	for _, p := range plans {
+		items = append(items, planResponse{
+			Code:         p.Code,
+			Name:         p.Name,
+			PriceMonthly: p.PriceMonthly,
+			PriceYearly:  p.PriceYearly,
+			Enabled:      p.IsActive,
+		})
+	}
+	c.JSON(http.StatusOK, gin.H{"items": items})
+}
+
+// handleTogglePlan включает или отключает план подписки
+func (h *Handler) handleTogglePlan(c *gin.Context) {
+	var req toggleRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "некорректный запрос"})
+		return
+	}
+
+	if err := h.service.SetPlanActive(c.Request.Context(), actor(c), c.Param("code"), *req.Enabled); err != nil {
+		h.respondError(c, "Ошибка изменения плана", err)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"code": c.Param("code"), "enabled": *req.Enabled})
+}
+
+// handlePackages возвращает все пакеты нейронов
+func (h *Handler) handlePackages(c *gin.Context) {
+	packages, err := h.service.ListPackages(c.Request.Context(), actor(c))
+	if err != nil {
+		h.respondError(c, "Ошибка получения пакетов", err)
+		return
+	}
+
+	items := make([]packageResponse, 0, len(packages))
+	for _, p := range packages {
+		items = append(items, packageResponse{
+			ID:          p.ID,
+			Name:        p.Name,
+			TotalAmount: p.GetTotalAmount(),
+			Price:       p.Price,
+			Enabled:     p.IsActive,
+		})
+	}
+	c.JSON(http.StatusOK, gin.H{"items": items})
+}
+
+// handleTogglePackage включает или отключает пакет нейронов
+func (h *Handler) handleTogglePackage(c *gin.Context) {
+	packageID, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "некорректный ID пакета"})
+		return
+	}
+
+	var req toggleRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "некорректный запрос"})
+		return
+	}
+
+	if err := h.service.SetPackageActive(c.Request.Context(), actor(c), packageID, *req.Enabled); err != nil {
+		h.respondError(c, "Ошибка изменения пакета", err)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"id": packageID, "enabled": *req.Enabled})
+}
+
+// handleModels возвращает модели нейросетей и их доступность
+func (h *Handler) handleModels(c *gin.Context) {
+	models, err := h.service.ListModels(c.Request.Context(), actor(c))
+	if err != nil {
+		h.respondError(c, "Ошибка получения моделей", err)
+		return
+	}
+
+	items := make([]modelResponse, 0, len(models))
+	for _, m := range models {
+		items = append(items, modelResponse{
+			Name:        m.Name,
+			DisplayName: m.DisplayName,
+			Type:        m.Type,
+			Enabled:     m.Enabled,
+		})
+	}
+	c.JSON(http.StatusOK, gin.H{"items": items})
+}
+
+// handleToggleModel включает или отключает модель
+func (h *Handler) handleToggleModel(c *gin.Context) {
+	var req toggleRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "некорректный запрос"})
+		return
+	}
+
+	if err := h.service.SetModelEnabled(c.Request.Context(), actor(c), c.Param("name"), *req.Enabled); err != nil {
+		h.respondError(c, "Ошибка изменения модели", err)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"name": c.Param("name"), "enabled": *req.Enabled})
+}
+
+// handleErrors возвращает последние ошибки из логов сервисов
+func (h *Handler) handleErrors(c *gin.Context) {
+	entries, err := h.service.RecentErrors(c.Request.Context(), actor(c), limitQuery(c))
+	if err != nil {
+		h.respondError(c, "Ошибка получения журнала ошибок", err)
+		return
+	}
+
+	items := make([]errorResponse, 0, len(entries))
+	for _, e := range entries {
+		items = append(items, errorResponse{
+			ID:        e.ID,
+			Logger:    e.Logger,
+			Message:   e.Message,
+			Error:     e.Error,
+			Caller:    e.Caller,
+			Fields:    e.Fields,
+			CreatedAt: e.CreatedAt,
+		})
+	}
+	c.JSON(http.StatusOK, gin.H{"items": items})
+}
+
+// handleAudit возвращает журнал действий администраторов, параметр user_id отбирает действия по пользователю
+func (h *Handler) handleAudit(c *gin.Context) {
+	var targetUserID *int64
+	if raw := c.Query("user_id"); raw != "" {
+		userID, err := strconv.ParseInt(raw, 10, 64)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "некорректный ID пользователя"})
+			return
+		}
+		targetUserID = &userID
+	}
+
+	entries, err := h.service.AuditLog(c.Request.Context(), actor(c), targetUserID, limitQuery(c))
+	if err != nil {
+		h.respondError(c, "Ошибка получения журнала действий", err)
+		return
+	}
+
+	items := make([]auditResponse, 0, len(entries))
+	for _, e := range entries {
+		items = append(items, auditResponse{
+			ID:           e.ID,
+			AdminID:      e.AdminID,
+			Source:       e.Source,
+			Action:       e.Action,
+			TargetUserID: e.TargetUserID,
+			Target:       e.Target,
+			Reason:       e.Reason,
+			Details:      e.Details,
+			CreatedAt:    e.CreatedAt,
+		})
+	}
+	c.JSON(http.StatusOK, gin.H{"items": items})
+}
+
+// handleAdmins возвращает список администраторов
+func (h *Handler) handleAdmins(c *gin.Context) {
+	admins, err := h.service.ListAdmins(c.Request.Context(), actor(c))
+	if err != nil {
+		h.respondError(c, "Ошибка получения администраторов", err)
+		return
+	}
+
+	items := make([]adminResponse, 0, len(admins))
+	for _, a := range admins {
+		item := adminResponse{TelegramID: a.TelegramID, FromConfig: a.FromConfig, AddedBy: a.AddedBy}
+		if !a.FromConfig {
+			createdAt := a.CreatedAt
+			item.CreatedAt = &createdAt
+		}
+		items = append(items, item)
+	}
+	c.JSON(http.StatusOK, gin.H{"items": items})
+}
+
+// handleAddAdmin выдает пользователю права администратора
+func (h *Handler) handleAddAdmin(c *gin.Context) {
+	var req adminRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "некорректный запрос"})
+		return
+	}
+
+	if err := h.service.AddAdmin(c.Request.Context(), actor(c), req.TelegramID); err != nil {
+		h.respondError(c, "Ошибка добавления администратора", err)
+		return
+	}
+	c.JSON(http.StatusCreated, gin.H{"telegram_id": req.TelegramID})
+}
+
+// handleRemoveAdmin отзывает права администратора
+func (h *Handler) handleRemoveAdmin(c *gin.Context) {
+	userID, ok := userIDParam(c)
+	if !ok {
+		return
+	}
+
+	if err := h.service.RemoveAdmin(c.Request.Context(), actor(c), userID); err != nil {
+		h.respondError(c, "Ошибка удаления администратора", err)
+		return
+	}
+	c.Status(http.StatusNoContent)
+}
+
+// campaignIDParam возвращает ID кампании из пути
+func campaignIDParam(c *gin.Context) (int64, bool) {
+	id, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil || id <= 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "некорректный ID кампании"})
+		return 0, false
+	}
+	return id, true
+}
+
+// handleBroadcasts возвращает последние кампании рассылок
+func (h *Handler) handleBroadcasts(c *gin.Context) {
+	campaigns, err := h.service.ListBroadcasts(c.Request.Context(), actor(c), limitQuery(c))
+	if err != nil {
+		h.respondError(c, "Ошибка получения рассылок", err)
+		return
+	}
+
+	items := make([]campaignResponse, 0, len(campaigns))
+	for _, campaign := range campaigns {
+		items = append(items, newCampaignResponse(campaign, nil))
+	}
+	c.JSON(http.StatusOK, gin.H{"items": items})
+}
+
+// handleBroadcast возвращает кампанию со статистикой доставки
+func (h *Handler) handleBroadcast(c *gin.Context) {
+	id, ok := campaignIDParam(c)
+	if !ok {
+		return
+	}
+
+	campaign, stats, err := h.service.GetBroadcast(c.Request.Context(), actor(c), id)
+	if err != nil {
+		h.respondError(c, "Ошибка получения рассылки", err)
+		return
+	}
+	c.JSON(http.StatusOK, newCampaignResponse(campaign, stats))
+}
+
+// handleCreateBroadcast создает черновик кампании
+func (h *Handler) handleCreateBroadcast(c *gin.Context) {
+	var req broadcastRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "некорректный запрос"})
+		return
+	}
+
+	campaign, err := h.service.CreateBroadcast(c.Request.Context(), actor(c), req.Title, req.Text, req.Segment)
+	if err != nil {
+		h.respondError(c, "Ошибка создания рассылки", err)
+		return
+	}
+	c.JSON(http.StatusCreated, newCampaignResponse(campaign, nil))
+}
+
+// handleEstimateBroadcast возвращает размер аудитории сегмента без отправки
+func (h *Handler) handleEstimateBroadcast(c *gin.Context) {
+	var segment broadcast.Segment
+	if err := c.ShouldBindJSON(&segment); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "некорректный запрос"})
+		return
+	}
+
+	audience, err := h.service.EstimateBroadcast(c.Request.Context(), actor(c), segment)
+	if err != nil {
+		h.respondError(c, "Ошибка оценки аудитории рассылки", err)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"audience": audience})
+}
+
+// handlePreviewBroadcast отправляет текст кампании администратору в Telegram
+func (h *Handler) handlePreviewBroadcast(c *gin.Context) {
+	id, ok := campaignIDParam(c)
+	if !ok {
+		return
+	}
+
+	if err := h.service.PreviewBroadcast(c.Request.Context(), actor(c), id); err != nil {
+		h.respondError(c, "Ошибка отправки пробного сообщения", err)
+		return
+	}
+	c.Status(http.StatusNoContent)
+}
+
+// handleStartBroadcast запускает кампанию
+func (h *Handler) handleStartBroadcast(c *gin.Context) {
+	id, ok := campaignIDParam(c)
+	if !ok {
+		return
+	}
+
+	campaign, err := h.service.StartBroadcast(c.Request.Context(), actor(c), id)
+	if err != nil {
+		h.respondError(c, "Ошибка запуска рассылки", err)
+		return
+	}
+	c.JSON(http.StatusOK, newCampaignResponse(campaign, nil))
+}
+
+// handleResumeBroadcast повторно ставит в очередь неотправленные сообщения кампании
+func (h *Handler) handleResumeBroadcast(c *gin.Context) {
+	id, ok := campaignIDParam(c)
+	if !ok {
+		return
+	}
+
+	queued, err := h.service.ResumeBroadcast(c.Request.Context(), actor(c), id)
+	if err != nil {
+		h.respondError(c, "Ошибка возобновления рассылки", err)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"queued": queued})
+}
+
+// handleCancelBroadcast останавливает кампанию
+func (h *Handler) handleCancelBroadcast(c *gin.Context) {
+	id, ok := campaignIDParam(c)
+	if !ok {
+		return
+	}
+
+	if err := h.service.CancelBroadcast(c.Request.Context(), actor(c), id); err != nil {
+		h.respondError(c, "Ошибка отмены рассылки", err)
+		return
+	}
+	c.Status(http.StatusNoContent)
+}
+
+// handlePersonas возвращает все персоны, включая отключенные
+func (h *Handler) handlePersonas(c *gin.Context) {
+	personas, err := h.service.ListPersonas(c.Request.Context(), actor(c))
+	if err != nil {
+		h.respondError(c, "Ошибка получения персон", err)
+		return
+	}
+
+	items := make([]personaResponse, 0, len(personas))
+	for _, p := range personas {
+		items = append(items, newPersonaResponse(p))
+	}
+	c.JSON(http.StatusOK, gin.H{"items": items})
+}
+
+// handleCreatePersona создает персону
+func (h *Handler) handleCreatePersona(c *gin.Context) {
+	var req personaRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "некорректный запрос"})
+		return
+	}
+
+	persona := req.toPersona(req.Code)
+	if err := h.service.CreatePersona(c.Request.Context(), actor(c), persona); err != nil {
+		h.respondError(c, "Ошибка создания персоны", err)
+		return
+	}
+	c.JSON(http.StatusCreated, newPersonaResponse(persona))
+}
+
+// handleUpdatePersona изменяет персону. Код персоны берется из пути и не меняется
+func (h *Handler) handleUpdatePersona(c *gin.Context) {
+	var req personaRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "некорректный запрос"})
+		return
+	}
+
+	persona := req.toPersona(c.Param("code"))
+	if err := h.service.UpdatePersona(c.Request.Context(), actor(c), persona); err != nil {
+		h.respondError(c, "Ошибка изменения персоны", err)
+		return
+	}
+	c.JSON(http.StatusOK, newPersonaResponse(persona))
+}
+
+// handleDeletePersona удаляет персону
+func (h *Handler) handleDeletePersona(c *gin.Context) {
+	if err := h.service.DeletePersona(c.Request.Context(), actor(c), c.Param("code")); err != nil {
+		h.respondError(c, "Ошибка удаления персоны", err)
+		return
+	}
+	c.Status(http.StatusNoContent)
+}
+
+// respondError отвечает кодом, соответствующим ошибке. Непредвиденные ошибки логируются и возвращаются без подробностей
+func (h *Handler) respondError(c *gin.Context, message string, err error) {
+	switch {
+	case errors.Is(err, ErrForbidden), errors.Is(err, ErrOwnerOnly):
+		c.JSON(http.StatusForbidden, gin.H{"error": err.Error()})
+	case errors.Is(err, ErrUserNotFound), errors.Is(err, ErrNoSubscription), errors.Is(err, ErrModelNotFound),
+		errors.Is(err, ErrNotAdmin), errors.Is(err, subscription.ErrPlanNotFound), errors.Is(err, currency.ErrPackageNotFound),
+		errors.Is(err, broadcast.ErrCampaignNotFound), errors.Is(err, conversation.ErrPersonaNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+	case errors.Is(err, ErrReasonRequired), errors.Is(err, ErrInvalidAmount), errors.Is(err, ErrAdjustmentLimit),
+		errors.Is(err, ErrInsufficientBalance), errors.Is(err, ErrInvalidDays), errors.Is(err, ErrAlreadyAdmin),
+		errors.Is(err, ErrConfigAdmin), errors.Is(err, subscription.ErrFreePlanRequired),
+		errors.Is(err, currency.ErrIdempotencyKeyReused), errors.Is(err, broadcast.ErrNotDraft),
+		errors.Is(err, broadcast.ErrNotRunning), errors.Is(err, broadcast.ErrFinished), errors.Is(err, broadcast.ErrEmptyText),
+		errors.Is(err, broadcast.ErrTextTooLong), errors.Is(err, broadcast.ErrInvalidSegment),
+		errors.Is(err, broadcast.ErrEmptyAudience), errors.Is(err, conversation.ErrPersonaExists),
+		errors.Is(err, conversation.ErrInvalidPersonaCode), errors.Is(err, conversation.ErrInvalidPersona):
+		c.JSON(http.StatusUnprocessableEntity, gin.H{"error": err.Error()})
+	case errors.Is(err, ErrBroadcastUnavailable), errors.Is(err, ErrPersonasUnavailable):
+		c.JSON(http.StatusServiceUnavailable, gin.H{"error": err.Error()})
+	default:
+		if !errors.Is(err, context.Canceled) {
+			h.log.Error(message,
+				zap.Int64("admin_id", actor(c).AdminID),
+				zap.Error(err))
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "внутренняя ошибка сервера"})
+	}
+}
@@ -0,0 +1,129 @@
+// Модель консоли администратора
+
+package admin
+
+import (
+	"database/sql/driver"
+	"encoding/json"
+	"errors"
+	"time"
+
+	"neurobot-prod/internal/currency"
+	"neurobot-prod/internal/llm"
+	"neurobot-prod/internal/subscription"
+	"neurobot-prod/internal/user"
+)
+
+// Source представляет канал, через который администратор выполнил действие
+type Source string
+
+const (
+	SourceTelegram Source = "telegram" // Команда /admin в боте
+	SourceAPI      Source = "api"      // HTTP API консоли
+)
+
+// Action представляет действие администратора в журнале
+type Action string
+
+const (
+	ActionLookupUser         Action = "user_lookup"
+	ActionAdjustBalance      Action = "balance_adjust"
+	ActionGrantSubscription  Action = "subscription_grant"
+	ActionCancelSubscription Action = "subscription_cancel"
+	ActionSetPlanActive      Action = "plan_toggle"
+	ActionSetPackageActive   Action = "package_toggle"
+	ActionSetModelEnabled    Action = "model_toggle"
+	ActionAddAdmin           Action = "admin_add"
+	ActionRemoveAdmin        Action = "admin_remove"
+	ActionCreateBroadcast    Action = "broadcast_create"
+	ActionStartBroadcast     Action = "broadcast_start"
+	ActionResumeBroadcast    Action = "broadcast_resume"
+	ActionCancelBroadcast    Action = "broadcast_cancel"
+	ActionCreatePersona      Action = "persona_create"
+	ActionUpdatePersona      Action = "persona_update"
+	ActionDeletePersona      Action = "persona_delete"
+)
+
+// Actor описывает администратора, выполняющего действие
+type Actor struct {
+	AdminID int64
+	Source  Source
+}
+
+// Details представляет дополнительные данные записи журнала или ошибки
+type Details map[string]interface{}
+
+// Value реализует интерфейс driver.Valuer для конвертации в JSONB
+func (d Details) Value() (driver.Value, error) {
+	if d == nil {
+		return nil, nil
+	}
+	return json.Marshal(d)
+}
+
+// Scan реализует интерфейс sql.Scanner для чтения из JSONB
+func (d *Details) Scan(value interface{}) error {
+	if value == nil {
+		*d = nil
+		return nil
+	}
+
+	var data []byte
+	switch v := value.(type) {
+	case []byte:
+		data = v
+	case string:
+		data = []byte(v)
+	default:
+		return errors.New("тип данных не поддерживается для Details.Scan")
+	}
+
+	return json.Unmarshal(data, d)
+}
+
+// Admin представляет администратора бота
+type Admin struct {
+	TelegramID int64     `db:"telegram_id"`
+	AddedBy    int64     `db:"added_by"`
+	FromConfig bool      `db:"-"` // Указан в app.admin_ids, права нельзя отозвать командой
+	CreatedAt  time.Time `db:"created_at"`
+}
+
+// AuditEntry представляет запись журнала действий администраторов
+type AuditEntry struct {
+	ID           int64     `db:"id"`
+	AdminID      int64     `db:"admin_id"`
+	Source       Source    `db:"source"`
+	Action       Action    `db:"action"`
+	TargetUserID *int64    `db:"target_user_id"`
+	Target       string    `db:"target"` // План, пакет или модель
+	Reason       string    `db:"reason"`
+	Details      Details   `db:"details"`
+	CreatedAt    time.Time `db:"created_at"`
+}
+
+// ErrorEntry представляет ошибку, записанную в лог одним из сервисов
+type ErrorEntry struct {
+	ID        int64     `db:"id"`
+	Logger    string    `db:"logger"`
+	Message   string    `db:"message"`
+	Error     string    `db:"error"`
+	Caller    string    `db:"caller"`
+	Fields    Details   `db:"fields"`
+	CreatedAt time.Time `db:"created_at"`
+}
+
+// UserInfo содержит сведения о пользователе для администратора
+type UserInfo struct {
+	User         *user.UserDTO
+	Balance      *currency.Balance
+	Subscription *subscription.Subscription // Для бесплатного плана ID равен 0
+	Transactions []*currency.Transaction    // Последние операции с нейронами
+	IsAdmin      bool
+}
+
+// ModelState представляет модель нейросети и ее доступность
+type ModelState struct {
+	llm.ModelInfo
+	Enabled bool
+}
@@ -0,0 +1,78 @@
+// Персоны в консоли администратора
+
+package admin
+
+import (
+	"context"
+
+	"neurobot-prod/internal/conversation"
+)
+
+// authorizePersonas проверяет права администратора и подключение сервиса диалогов
+func (s *Service) authorizePersonas(ctx context.Context, actor Actor) error {
+	if err := s.authorize(ctx, actor); err != nil {
+		return err
+	}
+	if s.personas == nil {
+		return ErrPersonasUnavailable
+	}
+	return nil
+}
+
+// ListPersonas возвращает все персоны, включая отключенные
+func (s *Service) ListPersonas(ctx context.Context, actor Actor) ([]*conversation.Persona, error) {
+	if err := s.authorizePersonas(ctx, actor); err != nil {
+		return nil, err
+	}
+	return s.personas.GetAllPersonas(ctx)
+}
+
+// CreatePersona создает персону
+func (s *Service) CreatePersona(ctx context.Context, actor Actor, persona *conversation.Persona) error {
+	if err := s.authorizePersonas(ctx, actor); err != nil {
+		return err
+	}
+	if err := s.personas.CreatePersona(ctx, persona); err != nil {
+		return err
+	}
+
+	s.audit(ctx, actor, &AuditEntry{
+		Action:  ActionCreatePersona,
+		Target:  persona.Code,
+		Details: Details{"name": persona.Name, "active": persona.IsActive},
+	})
+	return nil
+}
+
+// UpdatePersona обновляет персону по коду
+func (s *Service) UpdatePersona(ctx context.Context, actor Actor, persona *conversation.Persona) error {
+	if err := s.authorizePersonas(ctx, actor); err != nil {
+		return err
+	}
+	if err := s.personas.UpdatePersona(ctx, persona); err != nil {
+		return err
+	}
+
+	s.audit(ctx, actor, &AuditEntry{
+		Action:  ActionUpdatePersona,
+		Target:  persona.Code,
+		Details: Details{"name": persona.Name, "active": persona.IsActive},
+	})
+	return nil
+}
+
+// DeletePersona удаляет персону
+func (s *Service) DeletePersona(ctx context.Context, actor Actor, code string) error {
+	if err := s.authorizePersonas(ctx, actor); err != nil {
+		return err
+	}
+	if err := s.personas.DeletePersona(ctx, code); err != nil {
+		return err
+	}
+
+	s.audit(ctx, actor, &AuditEntry{
+		Action: ActionDeletePersona,
+		Target: code,
+	})
+	return nil
+}
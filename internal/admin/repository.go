@@ -0,0 +1,252 @@
+// Репозиторий консоли администратора
+
+package admin
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"time"
+)
+
+// Repository представляет репозиторий администраторов, журнала действий и ошибок
+type Repository struct {
+	db *sql.DB
+}
+
+// NewRepository создает новый репозиторий консоли администратора
+func NewRepository(db *sql.DB) *Repository {
+	return &Repository{
+		db: db,
+	}
+}
+
+// IsAdmin проверяет, выданы ли пользователю права администратора
+func (r *Repository) IsAdmin(ctx context.Context, telegramID int64) (bool, error) {
+	var exists bool
+	err := r.db.QueryRowContext(ctx, `
+		SELECT EXISTS(SELECT 1 FROM admins WHERE telegram_id = $1)
+	`, telegramID).Scan(&exists)
+	if err != nil {
+		return false, fmt.Errorf("ошибка проверки администратора: %w", err)
+	}
+	return exists, nil
+}
+
+// ListAdmins возвращает администраторов, добавленных командой
+func (r *Repository) ListAdmins(ctx context.Context) ([]*Admin, error) {
+	rows, err := r.db.QueryContext(ctx, `
+		SELECT telegram_id, added_by, created_at FROM admins ORDER BY created_at ASC
+	`)
+	if err != nil {
+		return nil, fmt.Errorf("ошибка получения администраторов: %w", err)
+	}
+	defer rows.Close()
+
+	var admins []*Admin
+	for rows.Next() {
+		a := &Admin{}
+		if err := rows.Scan(&a.TelegramID, &a.AddedBy, &a.CreatedAt); err != nil {
+			return nil, fmt.Errorf("ошибка сканирования администратора: %w", err)
+		}
+		admins = append(admins, a)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("ошибка при итерации администраторов: %w", err)
+	}
+
+	return admins, nil
+}
+
+// AddAdmin выдает пользователю права администратора. Возвращает false, если права уже выданы
+func (r *Repository) AddAdmin(ctx context.Context, telegramID, addedBy int64) (bool, error) {
+	result, err := r.db.ExecContext(ctx, `
+		INSERT INTO admins (telegram_id, added_by) VALUES ($1, $2)
+		ON CONFLICT (telegram_id) DO NOTHING
+	`, telegramID, addedBy)
+	if err != nil {
+		return false, fmt.Errorf("ошибка добавления администратора: %w", err)
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return false, fmt.Errorf("ошибка получения количества затронутых строк: %w", err)
+	}
+
+	return rowsAffected > 0, nil
+}
+
+// RemoveAdmin отзывает права администратора. Возвращает false, если прав не было
+func (r *Repository) RemoveAdmin(ctx context.Context, telegramID int64) (bool, error) {
+	result, err := r.db.ExecContext(ctx, `DELETE FROM admins WHERE telegram_id = $1`, telegramID)
+	if err != nil {
+		return false, fmt.Errorf("ошибка удаления администратора: %w", err)
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return false, fmt.Errorf("ошибка получения количества затронутых строк: %w", err)
+	}
+
+	return rowsAffected > 0, nil
+}
+
+// AddAuditEntry добавляет запись в журнал действий администраторов
+func (r *Repository) AddAuditEntry(ctx context.Context, e *AuditEntry) error {
+	err := r.db.QueryRowContext(ctx, `
+		INSERT INTO admin_audit_log (admin_id, source, action, target_user_id, target, reason, details)
+		VALUES ($1, $2, $3, $4, NULLIF($5, ''), NULLIF($6, ''), $7)
+		RETURNING id, created_at
+	`, e.AdminID, e.Source, e.Action, e.TargetUserID, e.Target, e.Reason, e.Details).Scan(&e.ID, &e.CreatedAt)
+	if err != nil {
+		return fmt.Errorf("ошибка записи в журнал действий: %w", err)
+	}
+	return nil
+}
+
+// ListAuditEntries возвращает последние записи журнала, при targetUserID - только по этому пользователю
+func (r *Repository) ListAuditEntries(ctx context.Context, targetUserID *int64, limit int) ([]*AuditEntry, error) {
+	rows, err := r.db.QueryContext(ctx, `
+		SELECT id, admin_id, source, action, target_user_id, COALESCE(target, ''), COALESCE(reason, ''), details, created_at
+		FROM admin_audit_log
+		WHERE $1::BIGINT IS NULL OR target_user_id = $1
+		ORDER BY created_at DESC, id DESC
+		LIMIT $2
+	`, targetUserID, limit)
+	if err != nil {
+		return nil, fmt.Errorf("ошибка получения журнала действий: %w", err)
+	}
+	defer rows.Close()
+
+	var entries []*AuditEntry
+	for rows.Next() {
+		e := &AuditEntry{}
+		err := rows.Scan(
+			&e.ID,
+			&e.AdminID,
+			&e.Source,
+			&e.Action,
+			&e.TargetUserID,
+			&e.Target,
+			&e.Reason,
+			&e.Details,
+			&e.CreatedAt,
+		)
+		if err != nil {
+			return nil, fmt.Errorf("ошибка сканирования записи журнала: %w", err)
+		}
+		entries = append(entries, e)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("ошибка при итерации журнала действий: %w", err)
+	}
+
+	return entries, nil
+}
+
+// DisabledModels возвращает модели, отключенные администратором
+func (r *Repository) DisabledModels(ctx context.Context) (map[string]bool, error) {
+	rows, err := r.db.QueryContext(ctx, `SELECT model_name FROM disabled_models`)
+	if err != nil {
+		return nil, fmt.Errorf("ошибка получения отключенных моделей: %w", err)
+	}
+	defer rows.Close()
+
+	disabled := make(map[string]bool)
+	for rows.Next() {
+		var name string
+		if err := rows.Scan(&name); err != nil {
+			return nil, fmt.Errorf("ошибка сканирования отключенной модели: %w", err)
+		}
+		disabled[name] = true
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("ошибка при итерации отключенных моделей: %w", err)
+	}
+
+	return disabled, nil
+}
+
+// SetModelEnabled включает или отключает модель
+func (r *Repository) SetModelEnabled(ctx context.Context, modelName string, enabled bool, adminID int64) error {
+	var err error
+	if enabled {
+		_, err = r.db.ExecContext(ctx, `DELETE FROM disabled_models WHERE model_name = $1`, modelName)
+	} else {
+		_, err = r.db.ExecContext(ctx, `
+			INSERT INTO disabled_models (model_name, disabled_by) VALUES ($1, $2)
+			ON CONFLICT (model_name) DO NOTHING
+		`, modelName, adminID)
+	}
+	if err != nil {
+		return fmt.Errorf("ошибка изменения доступности модели: %w", err)
+	}
+	return nil
+}
+
+// AddError сохраняет ошибку из лога сервиса
+func (r *Repository) AddError(ctx context.Context, e *ErrorEntry) error {
+	_, err := r.db.ExecContext(ctx, `
+		INSERT INTO error_log (logger, message, error, caller, fields, created_at)
+		VALUES ($1, $2, NULLIF($3, ''), NULLIF($4, ''), $5, $6)
+	`, e.Logger, e.Message, e.Error, e.Caller, e.Fields, e.CreatedAt)
+	if err != nil {
+		return fmt.Errorf("ошибка сохранения ошибки: %w", err)
+	}
+	return nil
+}
+
+// DeleteErrorsBefore удаляет ошибки, сохраненные раньше указанного времени
+func (r *Repository) DeleteErrorsBefore(ctx context.Context, before time.Time) (int, error) {
+	result, err := r.db.ExecContext(ctx, `DELETE FROM error_log WHERE created_at < $1`, before)
+	if err != nil {
+		return 0, fmt.Errorf("ошибка удаления старых ошибок: %w", err)
+	}
+
+	count, err := result.RowsAffected()
+	if err != nil {
+		return 0, fmt.Errorf("ошибка получения количества удаленных ошибок: %w", err)
+	}
+	return int(count), nil
+}
+
+// RecentErrors возвращает последние сохраненные ошибки
+func (r *Repository) RecentErrors(ctx context.Context, limit int) ([]*ErrorEntry, error) {
+	rows, err := r.db.QueryContext(ctx, `
+		SELECT id, logger, message, COALESCE(error, ''), COALESCE(caller, ''), fields, created_at
+		FROM error_log
+		ORDER BY created_at DESC, id DESC
+		LIMIT $1
+	`, limit)
+	if err != nil {
+		return nil, fmt.Errorf("ошибка получения ошибок: %w", err)
+	}
+	defer rows.Close()
+
+	var entries []*ErrorEntry
+	for rows.Next() {
+		e := &ErrorEntry{}
+		err := rows.Scan(
+			&e.ID,
+			&e.Logger,
+			&e.Message,
+			&e.Error,
+			&e.Caller,
+			&e.Fields,
+			&e.CreatedAt,
+		)
+		if err != nil {
+			return nil, fmt.Errorf("ошибка сканирования ошибки: %w", err)
+		}
+		entries = append(entries, e)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("ошибка при итерации ошибок: %w", err)
+	}
+
+	return entries, nil
+}
@@ -0,0 +1,291 @@
+// Модели запросов и ответов HTTP API консоли администратора
+
+package admin
+
+import (
+	"time"
+
+	"neurobot-prod/internal/broadcast"
+	"neurobot-prod/internal/conversation"
+	"neurobot-prod/internal/currency"
+	"neurobot-prod/internal/llm"
+	"neurobot-prod/internal/subscription"
+)
+
+// authRequest представляет вход в консоль по initData Mini App
+type authRequest struct {
+	InitData string `json:"init_data" binding:"required"`
+}
+
+// authResponse представляет выданный токен консоли
+type authResponse struct {
+	Token     string    `json:"token"`
+	ExpiresAt time.Time `json:"expires_at"`
+}
+
+// balanceRequest представляет корректировку баланса. Положительная сумма начисляет нейроны, отрицательная списывает
+type balanceRequest struct {
+	Amount int    `json:"amount" binding:"required"`
+	Reason string `json:"reason" binding:"required"`
+}
+
+// grantRequest представляет выдачу подписки
+type grantRequest struct {
+	PlanCode string `json:"plan_code" binding:"required"`
+	Days     int    `json:"days" binding:"required"`
+	Reason   string `json:"reason"`
+}
+
+// cancelRequest представляет отмену подписки
+type cancelRequest struct {
+	Reason string `json:"reason"`
+}
+
+// toggleRequest представляет включение или отключение плана, пакета или модели
+type toggleRequest struct {
+	Enabled *bool `json:"enabled" binding:"required"`
+}
+
+// adminRequest представляет выдачу прав администратора
+type adminRequest struct {
+	TelegramID int64 `json:"telegram_id" binding:"required"`
+}
+
+// broadcastRequest представляет создание кампании рассылки. Без названия используется первая строка текста
+type broadcastRequest struct {
+	Title   string            `json:"title"`
+	Text    string            `json:"text" binding:"required"`
+	Segment broadcast.Segment `json:"segment"`
+}
+
+// personaRequest представляет создание или изменение персоны. Без is_active персона включена
+type personaRequest struct {
+	Code         string `json:"code"`
+	Name         string `json:"name" binding:"required"`
+	Description  string `json:"description"`
+	SystemPrompt string `json:"system_prompt" binding:"required"`
+	SortOrder    int    `json:"sort_order"`
+	IsActive     *bool  `json:"is_active"`
+}
+
+// toPersona возвращает персону с полями запроса
+func (r *personaRequest) toPersona(code string) *conversation.Persona {
+	return &conversation.Persona{
+		Code:         code,
+		Name:         r.Name,
+		Description:  r.Description,
+		SystemPrompt: r.SystemPrompt,
+		SortOrder:    r.SortOrder,
+		IsActive:     r.IsActive == nil || *r.IsActive,
+	}
+}
+
+// userResponse представляет карточку пользователя
+type userResponse struct {
+	TelegramID   int64                 `json:"telegram_id"`
+	Username     string                `json:"username,omitempty"`
+	FirstName    string                `json:"first_name"`
+	LastName     string                `json:"last_name,omitempty"`
+	CreatedAt    time.Time             `json:"created_at"`
+	IsAdmin      bool                  `json:"is_admin"`
+	Balance      int                   `json:"balance"`
+	Subscription *subscriptionResponse `json:"subscription"` // nil для бесплатного плана
+	Transactions []transactionResponse `json:"transactions"`
+}
+
+func newUserResponse(info *UserInfo) userResponse {
+	resp := userResponse{
+		TelegramID:   info.User.TelegramID,
+		Username:     info.User.Username,
+		FirstName:    info.User.FirstName,
+		LastName:     info.User.LastName,
+		CreatedAt:    info.User.CreatedAt,
+		IsAdmin:      info.IsAdmin,
+		Balance:      info.Balance.Balance,
+		Subscription: newSubscriptionResponse(info.Subscription),
+		Transactions: make([]transactionResponse, 0, len(info.Transactions)),
+	}
+	for _, tx := range info.Transactions {
+		resp.Transactions = append(resp.Transactions, newTransactionResponse(tx))
+	}
+	return resp
+}
+
+// subscriptionResponse представляет подписку пользователя
+type subscriptionResponse struct {
+	ID            int64     `json:"id"`
+	PlanCode      string    `json:"plan_code"`
+	Status        string    `json:"status"`
+	PaymentMethod string    `json:"payment_method,omitempty"`
+	EndDate       time.Time `json:"end_date"`
+	AutoRenew     bool      `json:"auto_renew"`
+}
+
+func newSubscriptionResponse(s *subscription.Subscription) *subscriptionResponse {
+	if s == nil || s.ID == 0 || s.Plan == nil || s.IsFree() {
+		return nil
+	}
+	return &subscriptionResponse{
+		ID:            s.ID,
+		PlanCode:      s.Plan.Code,
+		Status:        string(s.Status),
+		PaymentMethod: s.PaymentMethod,
+		EndDate:       s.EndDate,
+		AutoRenew:     s.AutoRenew,
+	}
+}
+
+// transactionResponse представляет операцию с нейронами
+type transactionResponse struct {
+	ID           int64     `json:"id"`
+	Type         string    `json:"type"`
+	Amount       int       `json:"amount"`
+	BalanceAfter int       `json:"balance_after"`
+	Description  string    `json:"description"`
+	CreatedAt    time.Time `json:"created_at"`
+}
+
+func newTransactionResponse(tx *currency.Transaction) transactionResponse {
+	return transactionResponse{
+		ID:           tx.ID,
+		Type:         string(tx.TransactionType),
+		Amount:       tx.Amount,
+		BalanceAfter: tx.BalanceAfter,
+		Description:  tx.Description,
+		CreatedAt:    tx.CreatedAt,
+	}
+}
+
+// planResponse представляет план подписки. Цены указаны в копейках
+type planResponse struct {
+	Code         string `json:"code"`
+	Name         string `json:"name"`
+	PriceMonthly int    `json:"price_monthly"`
+	PriceYearly  int    `json:"price_yearly"`
+	Enabled      bool   `json:"enabled"`
+}
+
+// packageResponse представляет пакет нейронов. Цена указана в копейках
+type packageResponse struct {
+	ID          int    `json:"id"`
+	Name        string `json:"name"`
+	TotalAmount int    `json:"total_amount"`
+	Price       int    `json:"price"`
+	Enabled     bool   `json:"enabled"`
+}
+
+// modelResponse представляет модель нейросети
+type modelResponse struct {
+	Name        string        `json:"name"`
+	DisplayName string        `json:"display_name"`
+	Type        llm.ModelType `json:"type"`
+	Enabled     bool          `json:"enabled"`
+}
+
+// auditResponse представляет запись журнала действий
+type auditResponse struct {
+	ID           int64     `json:"id"`
+	AdminID      int64     `json:"admin_id"`
+	Source       Source    `json:"source"`
+	Action       Action    `json:"action"`
+	TargetUserID *int64    `json:"target_user_id,omitempty"`
+	Target       string    `json:"target,omitempty"`
+	Reason       string    `json:"reason,omitempty"`
+	Details      Details   `json:"details,omitempty"`
+	CreatedAt    time.Time `json:"created_at"`
+}
+
+// errorResponse представляет ошибку из логов сервисов
+type errorResponse struct {
+	ID        int64     `json:"id"`
+	Logger    string    `json:"logger"`
+	Message   string    `json:"message"`
+	Error     string    `json:"error,omitempty"`
+	Caller    string    `json:"caller,omitempty"`
+	Fields    Details   `json:"fields,omitempty"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// adminResponse представляет администратора
+type adminResponse struct {
+	TelegramID int64      `json:"telegram_id"`
+	FromConfig bool       `json:"from_config"`
+	AddedBy    int64      `json:"added_by,omitempty"`
+	CreatedAt  *time.Time `json:"created_at,omitempty"`
+}
+
+// campaignResponse представляет кампанию рассылки
+type campaignResponse struct {
+	ID              int64             `json:"id"`
+	Title           string            `json:"title"`
+	Text            string            `json:"text"`
+	Segment         broadcast.Segment `json:"segment"`
+	Status          broadcast.Status  `json:"status"`
+	CreatedBy       int64             `json:"created_by"`
+	TotalRecipients int               `json:"total_recipients"`
+	StartedAt       *time.Time        `json:"started_at,omitempty"`
+	FinishedAt      *time.Time        `json:"finished_at,omitempty"`
+	CreatedAt       time.Time         `json:"created_at"`
+	Stats           *statsResponse    `json:"stats,omitempty"`
+}
+
+// statsResponse представляет статистику доставки кампании
+type statsResponse struct {
+	Pending int `json:"pending"`
+	Sent    int `json:"sent"`
+	Failed  int `json:"failed"`
+	Blocked int `json:"blocked"`
+	Skipped int `json:"skipped"`
+}
+
+func newCampaignResponse(c *broadcast.Campaign, stats *broadcast.Stats) campaignResponse {
+	resp := campaignResponse{
+		ID:              c.ID,
+		Title:           c.Title,
+		Text:            c.Text,
+		Segment:         c.Segment,
+		Status:          c.Status,
+		CreatedBy:       c.CreatedBy,
+		TotalRecipients: c.TotalRecipients,
+		StartedAt:       c.StartedAt,
+		FinishedAt:      c.FinishedAt,
+		CreatedAt:       c.CreatedAt,
+	}
+	if stats != nil {
+		resp.Stats = &statsResponse{
+			Pending: stats.Pending,
+			Sent:    stats.Sent,
+			Failed:  stats.Failed,
+			Blocked: stats.Blocked,
+			Skipped: stats.Skipped,
+		}
+	}
+	return resp
+}
+
+// personaResponse представляет персону
+type personaResponse struct {
+	ID           int       `json:"id"`
+	Code         string    `json:"code"`
+	Name         string    `json:"name"`
+	Description  string    `json:"description,omitempty"`
+	SystemPrompt string    `json:"system_prompt"`
+	SortOrder    int       `json:"sort_order"`
+	IsActive     bool      `json:"is_active"`
+	CreatedAt    time.Time `json:"created_at"`
+	UpdatedAt    time.Time `json:"updated_at"`
+}
+
+func newPersonaResponse(p *conversation.Persona) personaResponse {
+	return personaResponse{
+		ID:           p.ID,
+		Code:         p.Code,
+		Name:         p.Name,
+		Description:  p.Description,
+		SystemPrompt: p.SystemPrompt,
+		SortOrder:    p.SortOrder,
+		IsActive:     p.IsActive,
+		CreatedAt:    p.CreatedAt,
+		UpdatedAt:    p.UpdatedAt,
+	}
+}
@@ -0,0 +1,574 @@
+// Сервис консоли администратора
+
+package admin
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"go.uber.org/zap"
+
+	"neurobot-prod/internal/broadcast"
+	"neurobot-prod/internal/config"
+	"neurobot-prod/internal/conversation"
+	"neurobot-prod/internal/currency"
+	"neurobot-prod/internal/llm"
+	"neurobot-prod/internal/subscription"
+	"neurobot-prod/internal/user"
+)
+
+const (
+	// recentTransactions - количество последних операций в карточке пользователя
+	recentTransactions = 5
+	// maxListLimit - максимальное количество записей журнала или ошибок за один запрос
+	maxListLimit = 100
+)
+
+var (
+	// ErrForbidden возвращается, если у пользователя нет прав администратора
+	ErrForbidden = errors.New("нет прав администратора")
+	// ErrOwnerOnly возвращается, если действие доступно только администраторам из конфигурации
+	ErrOwnerOnly = errors.New("действие доступно только администраторам из конфигурации")
+	// ErrUserNotFound возвращается, если пользователь не пользуется ботом
+	ErrUserNotFound = errors.New("пользователь не найден")
+	// ErrReasonRequired возвращается, если не указана причина корректировки
+	ErrReasonRequired = errors.New("не указана причина")
+	// ErrInvalidAmount возвращается при нулевой сумме корректировки
+	ErrInvalidAmount = errors.New("некорректная сумма")
+	// ErrAdjustmentLimit возвращается, если корректировка превышает допустимую за одно действие
+	ErrAdjustmentLimit = errors.New("превышена максимальная корректировка баланса")
+	// ErrInsufficientBalance возвращается, если списание превышает баланс пользователя
+	ErrInsufficientBalance = errors.New("недостаточно нейронов на балансе пользователя")
+	// ErrInvalidDays возвращается при некорректной длительности подписки
+	ErrInvalidDays = errors.New("некорректная длительность подписки")
+	// ErrNoSubscription возвращается, если у пользователя нет платной подписки
+	ErrNoSubscription = errors.New("у пользователя нет платной подписки")
+	// ErrModelNotFound возвращается, если модель не найдена среди подключенных
+	ErrModelNotFound = errors.New("модель не найдена")
+	// ErrAlreadyAdmin возвращается при повторной выдаче прав администратора
+	ErrAlreadyAdmin = errors.New("пользователь уже администратор")
+	// ErrNotAdmin возвращается при отзыве прав у пользователя, который не является администратором
+	ErrNotAdmin = errors.New("пользователь не администратор")
+	// ErrConfigAdmin возвращается при попытке отозвать права администратора из конфигурации
+	ErrConfigAdmin = errors.New("права администратора из конфигурации нельзя отозвать")
+	// ErrBroadcastUnavailable возвращается, если сервис рассылок не подключен
+	ErrBroadcastUnavailable = errors.New("рассылки недоступны")
+	// ErrPersonasUnavailable возвращается, если сервис диалогов не подключен
+	ErrPersonasUnavailable = errors.New("персоны недоступны")
+)
+
+// Notifier отправляет пользователю уведомление о действии администратора
+type Notifier func(userID int64, text string)
+
+// Service выполняет действия администраторов и записывает их в журнал
+type Service struct {
+	repo            *Repository
+	userService     *user.Service
+	currencyService *currency.Service
+	subService      *subscription.Service
+	llmService      *llm.Service
+	broadcasts      *broadcast.Service
+	personas        *conversation.Service
+	appConfig       config.AppConfig
+	config          config.AdminConfig
+	notify          Notifier
+	log             *zap.Logger
+}
+
+// NewService создает новый сервис консоли администратора
+func NewService(
+	repo *Repository,
+	userService *user.Service,
+	currencyService *currency.Service,
+	subService *subscription.Service,
+	llmService *llm.Service,
+	cfg *config.Config,
+	log *zap.Logger,
+) *Service {
+	return &Service{
+		repo:            repo,
+		userService:     userService,
+		currencyService: currencyService,
+		subService:      subService,
+		llmService:      llmService,
+		appConfig:       cfg.App,
+		config:          cfg.Admin,
+		log:             log.Named("admin_service"),
+	}
+}
+
+// SetNotifier устанавливает функцию уведомления пользователей
+func (s *Service) SetNotifier(notify Notifier) {
+	s.notify = notify
+}
+
+// SetBroadcasts подключает сервис рассылок
+func (s *Service) SetBroadcasts(broadcasts *broadcast.Service) {
+	s.broadcasts = broadcasts
+}
+
+// SetPersonas подключает сервис диалогов для управления персонами
+func (s *Service) SetPersonas(personas *conversation.Service) {
+	s.personas = personas
+}
+
+// IsAdmin проверяет, является ли пользователь администратором из конфигурации или базы данных
+func (s *Service) IsAdmin(ctx context.Context, userID int64) bool {
+	if s.appConfig.IsAdmin(userID) {
+		return true
+	}
+
+	isAdmin, err := s.repo.IsAdmin(ctx, userID)
+	if err != nil {
+		s.log.Error("Ошибка проверки администратора",
+			zap.Int64("user_id", userID),
+			zap.Error(err))
+		return false
+	}
+	return isAdmin
+}
+
+// authorize проверяет права администратора перед выполнением действия
+func (s *Service) authorize(ctx context.Context, actor Actor) error {
+	if !s.IsAdmin(ctx, actor.AdminID) {
+		return ErrForbidden
+	}
+	return nil
+}
+
+// audit записывает действие в журнал. Действие уже выполнено, поэтому ошибка записи только логируется
+func (s *Service) audit(ctx context.Context, actor Actor, entry *AuditEntry) {
+	entry.AdminID = actor.AdminID
+	entry.Source = actor.Source
+	if err := s.repo.AddAuditEntry(ctx, entry); err != nil {
+		s.log.Error("Ошибка записи действия администратора в журнал",
+			zap.Int64("admin_id", actor.AdminID),
+			zap.String("action", string(entry.Action)),
+			zap.Error(err))
+	}
+}
+
+// sendNotification отправляет уведомление, если задана функция уведомления
+func (s *Service) sendNotification(userID int64, text string) {
+	if s.notify != nil {
+		s.notify(userID, text)
+	}
+}
+
+// ListAdmins возвращает администраторов из конфигурации и базы данных
+func (s *Service) ListAdmins(ctx context.Context, actor Actor) ([]*Admin, error) {
+	if err := s.authorize(ctx, actor); err != nil {
+		return nil, err
+	}
+
+	admins := make([]*Admin, 0, len(s.appConfig.AdminIDs))
+	for _, id := range s.appConfig.AdminIDs {
+		admins = append(admins, &Admin{TelegramID: id, FromConfig: true})
+	}
+
+	added, err := s.repo.ListAdmins(ctx)
+	if err != nil {
+		return nil, err
+	}
+	for _, a := range added {
+		if !s.appConfig.IsAdmin(a.TelegramID) {
+			admins = append(admins, a)
+		}
+	}
+	return admins, nil
+}
+
+// AddAdmin выдает пользователю права администратора. Доступно только администраторам из конфигурации
+func (s *Service) AddAdmin(ctx context.Context, actor Actor, userID int64) error {
+	if !s.appConfig.IsAdmin(actor.AdminID) {
+		return ErrOwnerOnly
+	}
+	if s.appConfig.IsAdmin(userID) {
+		return ErrAlreadyAdmin
+	}
+	if _, err := s.getUser(ctx, userID); err != nil {
+		return err
+	}
+
+	added, err := s.repo.AddAdmin(ctx, userID, actor.AdminID)
+	if err != nil {
+		return err
+	}
+	if !added {
+		return ErrAlreadyAdmin
+	}
+
+	s.audit(ctx, actor, &AuditEntry{Action: ActionAddAdmin, TargetUserID: &userID})
+	s.log.Info("Выданы права администратора",
+		zap.Int64("admin_id", actor.AdminID),
+		zap.Int64("user_id", userID))
+	return nil
+}
+
+// RemoveAdmin отзывает права администратора. Доступно только администраторам из конфигурации
+func (s *Service) RemoveAdmin(ctx context.Context, actor Actor, userID int64) error {
+	if !s.appConfig.IsAdmin(actor.AdminID) {
+		return ErrOwnerOnly
+	}
+	if s.appConfig.IsAdmin(userID) {
+		return ErrConfigAdmin
+	}
+
+	removed, err := s.repo.RemoveAdmin(ctx, userID)
+	if err != nil {
+		return err
+	}
+	if !removed {
+		return ErrNotAdmin
+	}
+
+	s.audit(ctx, actor, &AuditEntry{Action: ActionRemoveAdmin, TargetUserID: &userID})
+	s.log.Info("Отозваны права администратора",
+		zap.Int64("admin_id", actor.AdminID),
+		zap.Int64("user_id", userID))
+	return nil
+}
+
+// getUser возвращает пользователя по Telegram ID
+func (s *Service) getUser(ctx context.Context, userID int64) (*user.UserDTO, error) {
+	u, err := s.userService.GetUserByTelegramID(ctx, userID)
+	if errors.Is(err, user.ErrNotFound) {
+		return nil, ErrUserNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return u, nil
+}
+
+// ResolveUser находит пользователя по Telegram ID или юзернейму (с @ или без)
+func (s *Service) ResolveUser(ctx context.Context, query string) (*user.UserDTO, error) {
+	query = strings.TrimSpace(query)
+	if id, err := strconv.ParseInt(query, 10, 64); err == nil {
+		return s.getUser(ctx, id)
+	}
+
+	u, err := s.userService.GetUserByUsername(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+	if u == nil {
+		return nil, ErrUserNotFound
+	}
+	return u, nil
+}
+
+// LookupUser возвращает карточку пользователя: баланс, подписку и последние операции
+func (s *Service) LookupUser(ctx context.Context, actor Actor, query string) (*UserInfo, error) {
+	if err := s.authorize(ctx, actor); err != nil {
+		return nil, err
+	}
+
+	u, err := s.ResolveUser(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+
+	balance, err := s.currencyService.GetBalance(ctx, u.TelegramID)
+	if err != nil {
+		return nil, err
+	}
+	sub, err := s.subService.GetActiveSubscription(ctx, u.TelegramID)
+	if err != nil {
+		return nil, err
+	}
+	transactions, err := s.currencyService.GetTransactionHistory(ctx, u.TelegramID, recentTransactions, 0)
+	if err != nil {
+		return nil, err
+	}
+
+	s.audit(ctx, actor, &AuditEntry{Action: ActionLookupUser, TargetUserID: &u.TelegramID})
+
+	return &UserInfo{
+		User:         u,
+		Balance:      balance,
+		Subscription: sub,
+		Transactions: transactions,
+		IsAdmin:      s.IsAdmin(ctx, u.TelegramID),
+	}, nil
+}
+
+// AdjustBalance начисляет (amount > 0) или списывает (amount < 0) нейроны пользователя.
+// Повтор с тем же ключом идемпотентности не изменяет баланс повторно
+func (s *Service) AdjustBalance(ctx context.Context, actor Actor, userID int64, amount int, reason, idempotencyKey string) (*currency.Transaction, error) {
+	if err := s.authorize(ctx, actor); err != nil {
+		return nil, err
+	}
+
+	reason = strings.TrimSpace(reason)
+	if reason == "" {
+		return nil, ErrReasonRequired
+	}
+	if amount == 0 {
+		return nil, ErrInvalidAmount
+	}
+	if s.config.MaxAdjustment > 0 && (amount > s.config.MaxAdjustment || -amount > s.config.MaxAdjustment) {
+		return nil, ErrAdjustmentLimit
+	}
+	if _, err := s.getUser(ctx, userID); err != nil {
+		return nil, err
+	}
+	if amount < 0 {
+		balance, err := s.currencyService.GetBalance(ctx, userID)
+		if err != nil {
+			return nil, err
+		}
+		if balance.Balance < -amount {
+			return nil, ErrInsufficientBalance
+		}
+	}
+
+	metadata := currency.Metadata{
+		"admin_id": actor.AdminID,
+		"reason":   reason,
+	}
+	description := fmt.Sprintf("Корректировка администратором: %s", reason)
+
+	var tx *currency.Transaction
+	var err error
+	if amount > 0 {
+		tx, err = s.currencyService.AddNeurons(ctx, userID, amount, currency.TypeAdmin, description, metadata, "", idempotencyKey, 0)
+	} else {
+		tx, err = s.currencyService.SpendNeurons(ctx, userID, -amount, currency.TypeAdmin, description, metadata, "", idempotencyKey)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	s.audit(ctx, actor, &AuditEntry{
+		Action:       ActionAdjustBalance,
+		TargetUserID: &userID,
+		Reason:       reason,
+		Details: Details{
+			"amount":         amount,
+			"transaction_id": tx.ID,
+			"balance_after":  tx.BalanceAfter,
+		},
+	})
+
+	if amount > 0 {
+		s.sendNotification(userID, fmt.Sprintf("💎 Администратор начислил вам %d нейронов.\nПричина: %s", amount, reason))
+	} else {
+		s.sendNotification(userID, fmt.Sprintf("💎 Администратор списал %d нейронов.\nПричина: %s", -amount, reason))
+	}
+
+	return tx, nil
+}
+
+// GrantSubscription выдает пользователю подписку на план на указанное количество дней
+func (s *Service) GrantSubscription(ctx context.Context, actor Actor, userID int64, planCode string, days int, reason string) (*subscription.Subscription, error) {
+	if err := s.authorize(ctx, actor); err != nil {
+		return nil, err
+	}
+	if days <= 0 {
+		return nil, ErrInvalidDays
+	}
+	if _, err := s.getUser(ctx, userID); err != nil {
+		return nil, err
+	}
+
+	reason = strings.TrimSpace(reason)
+	reference := fmt.Sprintf("admin:%d", actor.AdminID)
+	sub, err := s.subService.Grant(ctx, userID, planCode, days, reference)
+	if err != nil {
+		return nil, err
+	}
+
+	s.audit(ctx, actor, &AuditEntry{
+		Action:       ActionGrantSubscription,
+		TargetUserID: &userID,
+		Target:       planCode,
+		Reason:       reason,
+		Details: Details{
+			"subscription_id": sub.ID,
+			"days":            days,
+			"end_date":        sub.EndDate,
+		},
+	})
+
+	s.sendNotification(userID, fmt.Sprintf("⭐ Администратор оформил вам подписку «%s» до %s.",
+		sub.Plan.Name, sub.EndDate.Format("02.01.2006")))
+
+	return sub, nil
+}
+
+// CancelSubscription отменяет платную подписку пользователя, он переходит на бесплатный план
+func (s *Service) CancelSubscription(ctx context.Context, actor Actor, userID int64, reason string) (*subscription.Subscription, error) {
+	if err := s.authorize(ctx, actor); err != nil {
+		return nil, err
+	}
+	if _, err := s.getUser(ctx, userID); err != nil {
+		return nil, err
+	}
+
+	sub, err := s.subService.GetActiveSubscription(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	if sub == nil || sub.ID == 0 || sub.IsFree() {
+		return nil, ErrNoSubscription
+	}
+
+	if err := s.subService.CancelSubscription(ctx, userID, sub.ID); err != nil {
+		return nil, err
+	}
+
+	reason = strings.TrimSpace(reason)
+	planCode := ""
+	if sub.Plan != nil {
+		planCode = sub.Plan.Code
+	}
+	s.audit(ctx, actor, &AuditEntry{
+		Action:       ActionCancelSubscription,
+		TargetUserID: &userID,
+		Target:       planCode,
+		Reason:       reason,
+		Details: Details{
+			"subscription_id": sub.ID,
+			"end_date":        sub.EndDate,
+		},
+	})
+
+	s.sendNotification(userID, "Ваша подписка отменена администратором. Действует бесплатный план.")
+
+	return sub, nil
+}
+
+// ListPlans возвращает все планы подписок, включая отключенные
+func (s *Service) ListPlans(ctx context.Context, actor Actor) ([]*subscription.Plan, error) {
+	if err := s.authorize(ctx, actor); err != nil {
+		return nil, err
+	}
+	return s.subService.ListPlans(ctx)
+}
+
+// SetPlanActive включает или отключает план подписки
+func (s *Service) SetPlanActive(ctx context.Context, actor Actor, code string, active bool) error {
+	if err := s.authorize(ctx, actor); err != nil {
+		return err
+	}
+	if err := s.subService.SetPlanActive(ctx, code, active); err != nil {
+		return err
+	}
+
+	s.audit(ctx, actor, &AuditEntry{
+		Action:  ActionSetPlanActive,
+		Target:  code,
+		Details: Details{"active": active},
+	})
+	return nil
+}
+
+// ListPackages возвращает все пакеты нейронов, включая отключенные
+func (s *Service) ListPackages(ctx context.Context, actor Actor) ([]*currency.Package, error) {
+	if err := s.authorize(ctx, actor); err != nil {
+		return nil, err
+	}
+	return s.currencyService.ListPackages(ctx)
+}
+
+// SetPackageActive включает или отключает пакет нейронов
+func (s *Service) SetPackageActive(ctx context.Context, actor Actor, packageID int, active bool) error {
+	if err := s.authorize(ctx, actor); err != nil {
+		return err
+	}
+	if err := s.currencyService.SetPackageActive(ctx, packageID, active); err != nil {
+		return err
+	}
+
+	s.audit(ctx, actor, &AuditEntry{
+		Action:  ActionSetPackageActive,
+		Target:  strconv.Itoa(packageID),
+		Details: Details{"active": active},
+	})
+	return nil
+}
+
+// DisabledModels возвращает модели, отключенные администратором. Реализует llm.ModelSwitch
+func (s *Service) DisabledModels(ctx context.Context) (map[string]bool, error) {
+	return s.repo.DisabledModels(ctx)
+}
+
+// ListModels возвращает модели подключенных провайдеров и их доступность
+func (s *Service) ListModels(ctx context.Context, actor Actor) ([]ModelState, error) {
+	if err := s.authorize(ctx, actor); err != nil {
+		return nil, err
+	}
+
+	disabled, err := s.repo.DisabledModels(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	models := s.llmService.ListModels()
+	states := make([]ModelState, 0, len(models))
+	for _, model := range models {
+		states = append(states, ModelState{ModelInfo: model, Enabled: !disabled[model.Name]})
+	}
+	return states, nil
+}
+
+// SetModelEnabled включает или отключает модель для всех пользователей
+func (s *Service) SetModelEnabled(ctx context.Context, actor Actor, modelName string, enabled bool) error {
+	if err := s.authorize(ctx, actor); err != nil {
+		return err
+	}
+
+	found := false
+	for _, model := range s.llmService.ListModels() {
+		if model.Name == modelName {
+			found = true
+			break
+		}
+	}
+	if !found {
+		return ErrModelNotFound
+	}
+
+	if err := s.repo.SetModelEnabled(ctx, modelName, enabled, actor.AdminID); err != nil {
+		return err
+	}
+
+	s.audit(ctx, actor, &AuditEntry{
+		Action:  ActionSetModelEnabled,
+		Target:  modelName,
+		Details: Details{"enabled": enabled},
+	})
+	s.log.Info("Изменена доступность модели",
+		zap.Int64("admin_id", actor.AdminID),
+		zap.String("model", modelName),
+		zap.Bool("enabled", enabled))
+	return nil
+}
+
+// RecentErrors возвращает последние ошибки из логов сервисов
+func (s *Service) RecentErrors(ctx context.Context, actor Actor, limit int) ([]*ErrorEntry, error) {
+	if err := s.authorize(ctx, actor); err != nil {
+		return nil, err
+	}
+	return s.repo.RecentErrors(ctx, clampLimit(limit))
+}
+
+// AuditLog возвращает последние действия администраторов, при targetUserID - только по этому пользователю
+func (s *Service) AuditLog(ctx context.Context, actor Actor, targetUserID *int64, limit int) ([]*AuditEntry, error) {
+	if err := s.authorize(ctx, actor); err != nil {
+		return nil, err
+	}
+	return s.repo.ListAuditEntries(ctx, targetUserID, clampLimit(limit))
+}
+
+// clampLimit ограничивает количество записей за один запрос
+func clampLimit(limit int) int {
+	if limit <= 0 || limit > maxListLimit {
+		return maxListLimit
+	}
+	return limit
+}
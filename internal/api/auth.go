@@ -0,0 +1,162 @@
+// Аутентификация пользователей Mini App: проверка initData и токены доступа
+
+package api
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var (
+	// ErrInvalidInitData возвращается, если подпись initData не совпадает или данные повреждены
+	ErrInvalidInitData = errors.New("некорректные данные авторизации Telegram")
+	// ErrInitDataExpired возвращается, если initData получены слишком давно
+	ErrInitDataExpired = errors.New("данные авторизации Telegram устарели")
+	// ErrInvalidToken возвращается при неверном или просроченном токене доступа
+	ErrInvalidToken = errors.New("недействительный токен доступа")
+)
+
+// WebAppUser представляет пользователя из initData Mini App
+type WebAppUser struct {
+	ID           int64  `json:"id"`
+	IsBot        bool   `json:"is_bot"`
+	FirstName    string `json:"first_name"`
+	LastName     string `json:"last_name"`
+	Username     string `json:"username"`
+	LanguageCode string `json:"language_code"`
+}
+
+// ValidateInitData проверяет подпись initData, переданных Telegram в Mini App, и возвращает пользователя.
+// Ключ подписи - HMAC-SHA256 токена бота с ключом "WebAppData", подписывается отсортированный
+// список полей "ключ=значение" без поля hash. maxAge ограничивает возраст данных по auth_date
+func ValidateInitData(initData, botToken string, maxAge time.Duration, now time.Time) (*WebAppUser, error) {
+	values, err := url.ParseQuery(initData)
+	if err != nil {
+		return nil, ErrInvalidInitData
+	}
+
+	hash := values.Get("hash")
+	if hash == "" {
+		return nil, ErrInvalidInitData
+	}
+
+	pairs := make([]string, 0, len(values))
+	for key := range values {
+		if key == "hash" {
+			continue
+		}
+		pairs = append(pairs, key+"="+values.Get(key))
+	}
+	sort.Strings(pairs)
+
+	secret := hmacSHA256([]byte("WebAppData"), []byte(botToken))
+	expected := hex.EncodeToString(hmacSHA256(secret, []byte(strings.Join(pairs, "\n"))))
+	if !hmac.Equal([]byte(expected), []byte(hash)) {
+		return nil, ErrInvalidInitData
+	}
+
+	authDate, err := strconv.ParseInt(values.Get("auth_date"), 10, 64)
+	if err != nil {
+		return nil, ErrInvalidInitData
+	}
+	if maxAge > 0 && now.Sub(time.Unix(authDate, 0)) > maxAge {
+		return nil, ErrInitDataExpired
+	}
+
+	var user WebAppUser
+	if err := json.Unmarshal([]byte(values.Get("user")), &user); err != nil || user.ID == 0 {
+		return nil, ErrInvalidInitData
+	}
+
+	return &user, nil
+}
+
+// hmacSHA256 вычисляет HMAC-SHA256 сообщения
+func hmacSHA256(key, message []byte) []byte {
+	mac := hmac.New(sha256.New, key)
+	mac.Write(message)
+	return mac.Sum(nil)
+}
+
+// jwtHeader - заголовок токена, все токены подписываются HS256
+var jwtHeader = base64.RawURLEncoding.EncodeToString([]byte(`{"alg":"HS256","typ":"JWT"}`))
+
+// Назначения токенов доступа. Токен принимается только API, для которого выпущен,
+// поэтому токен Mini App не открывает консоль администратора
+const (
+	AudienceWebApp = "webapp" // API Mini App
+	AudienceAdmin  = "admin"  // Консоль администратора
+)
+
+// Claims представляет содержимое токена доступа
+type Claims struct {
+	Subject   string `json:"sub"` // Telegram ID пользователя
+	Audience  string `json:"aud"` // Назначение токена
+	IssuedAt  int64  `json:"iat"`
+	ExpiresAt int64  `json:"exp"`
+}
+
+// UserID возвращает Telegram ID пользователя из токена
+func (c *Claims) UserID() (int64, error) {
+	return strconv.ParseInt(c.Subject, 10, 64)
+}
+
+// IssueToken выпускает JWT (HS256) для пользователя с указанным назначением
+func IssueToken(userID int64, audience, secret string, ttl time.Duration, now time.Time) (string, time.Time, error) {
+	expiresAt := now.Add(ttl)
+	payload, err := json.Marshal(Claims{
+		Subject:   strconv.FormatInt(userID, 10),
+		Audience:  audience,
+		IssuedAt:  now.Unix(),
+		ExpiresAt: expiresAt.Unix(),
+	})
+	if err != nil {
+		return "", time.Time{}, fmt.Errorf("ошибка формирования токена: %w", err)
+	}
+
+	unsigned := jwtHeader + "." + base64.RawURLEncoding.EncodeToString(payload)
+	signature := base64.RawURLEncoding.EncodeToString(hmacSHA256([]byte(secret), []byte(unsigned)))
+
+	return unsigned + "." + signature, expiresAt, nil
+}
+
+// ParseToken проверяет подпись, назначение и срок действия JWT и возвращает его содержимое
+func ParseToken(token, audience, secret string, now time.Time) (*Claims, error) {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 || parts[0] != jwtHeader {
+		return nil, ErrInvalidToken
+	}
+
+	signature, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+		return nil, ErrInvalidToken
+	}
+	if !hmac.Equal(signature, hmacSHA256([]byte(secret), []byte(parts[0]+"."+parts[1]))) {
+		return nil, ErrInvalidToken
+	}
+
+	payload, err := base64.RawURLEncoding.DecodeString(parts[1])
+	if err != nil {
+		return nil, ErrInvalidToken
+	}
+
+	var claims Claims
+	if err := json.Unmarshal(payload, &claims); err != nil {
+		return nil, ErrInvalidToken
+	}
+	if claims.Audience != audience || now.Unix() >= claims.ExpiresAt {
+		return nil, ErrInvalidToken
+	}
+
+	return &claims, nil
+}
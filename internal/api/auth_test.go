@@ -0,0 +1,57 @@
+// Тесты токенов доступа
+
+package api
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestParseTokenAudience(t *testing.T) {
+	now := time.Unix(1_700_000_000, 0)
+	const secret = "secret"
+
+	webAppToken, _, err := IssueToken(42, AudienceWebApp, secret, time.Hour, now)
+	if err != nil {
+		t.Fatal(err)
+	}
+	adminToken, _, err := IssueToken(42, AudienceAdmin, secret, time.Hour, now)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name     string
+		token    string
+		audience string
+		secret   string
+		now      time.Time
+		wantErr  bool
+	}{
+		{name: "токен Mini App", token: webAppToken, audience: AudienceWebApp, secret: secret, now: now},
+		{name: "токен консоли", token: adminToken, audience: AudienceAdmin, secret: secret, now: now},
+		{name: "токен Mini App в консоли", token: webAppToken, audience: AudienceAdmin, secret: secret, now: now, wantErr: true},
+		{name: "токен консоли в Mini App", token: adminToken, audience: AudienceWebApp, secret: secret, now: now, wantErr: true},
+		{name: "другой секрет", token: adminToken, audience: AudienceAdmin, secret: "other", now: now, wantErr: true},
+		{name: "истекший токен", token: adminToken, audience: AudienceAdmin, secret: secret, now: now.Add(time.Hour), wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			claims, err := ParseToken(tt.token, tt.audience, tt.secret, tt.now)
+			if tt.wantErr {
+				if !errors.Is(err, ErrInvalidToken) {
+					t.Fatalf("ошибка %v, ожидалась %v", err, ErrInvalidToken)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if userID, err := claims.UserID(); err != nil || userID != 42 {
+				t.Errorf("пользователь %d (%v), ожидался 42", userID, err)
+			}
+		})
+	}
+}
@@ -0,0 +1,518 @@
+// HTTP-обработчики API Mini App
+
+package api
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+
+	"neurobot-prod/internal/config"
+	"neurobot-prod/internal/conversation"
+	"neurobot-prod/internal/currency"
+	"neurobot-prod/internal/gift"
+	"neurobot-prod/internal/llm"
+	"neurobot-prod/internal/loyalty"
+	"neurobot-prod/internal/payment"
+	"neurobot-prod/internal/subscription"
+	"neurobot-prod/internal/user"
+)
+
+const (
+	// defaultPageSize - размер страницы истории транзакций по умолчанию
+	defaultPageSize = 20
+	// maxPageSize - максимальный размер страницы истории транзакций
+	maxPageSize = 100
+	// userIDKey - ключ контекста gin с Telegram ID авторизованного пользователя
+	userIDKey = "user_id"
+	// maxIdempotencyKeyLength - максимальная длина ключа идемпотентности, переданного Mini App
+	maxIdempotencyKeyLength = 64
+)
+
+// Handler обрабатывает запросы Mini App
+type Handler struct {
+	userService         *user.Service
+	currencyService     *currency.Service
+	subService          *subscription.Service
+	paymentService      *payment.Service
+	loyaltyService      *loyalty.Service
+	llmService          *llm.Service
+	conversationService *conversation.Service
+	giftService         *gift.Service
+	config              config.APIServiceConfig
+	botToken            string
+	log                 *zap.Logger
+}
+
+// NewHandler создает новый обработчик API Mini App
+func NewHandler(
+	userService *user.Service,
+	currencyService *currency.Service,
+	subService *subscription.Service,
+	paymentService *payment.Service,
+	loyaltyService *loyalty.Service,
+	llmService *llm.Service,
+	conversationService *conversation.Service,
+	cfg *config.Config,
+	log *zap.Logger,
+) *Handler {
+	return &Handler{
+		userService:         userService,
+		currencyService:     currencyService,
+		subService:          subService,
+		paymentService:      paymentService,
+		loyaltyService:      loyaltyService,
+		llmService:          llmService,
+		conversationService: conversationService,
+		config:              cfg.Services.API,
+		botToken:            cfg.Telegram.Token,
+		log:                 log.Named("api_handler"),
+	}
+}
+
+// SetGifts устанавливает сервис подарков нейронов
+func (h *Handler) SetGifts(giftService *gift.Service) {
+	h.giftService = giftService
+}
+
+// RegisterRoutes регистрирует маршруты API. Все маршруты, кроме авторизации, требуют токен доступа
+func (h *Handler) RegisterRoutes(group *gin.RouterGroup) {
+	group.Use(h.cors)
+	// Предварительные CORS-запросы браузера завершаются в middleware cors
+	group.OPTIONS("/*path", func(c *gin.Context) {})
+	group.POST("/auth/telegram", h.handleAuth)
+
+	authorized := group.Group("")
+	authorized.Use(h.authenticate)
+	authorized.GET("/profile", h.handleProfile)
+	authorized.GET("/balance", h.handleBalance)
+	authorized.GET("/transactions", h.handleTransactions)
+	authorized.GET("/plans", h.handlePlans)
+	authorized.GET("/packages", h.handlePackages)
+	authorized.POST("/checkout", h.handleCheckout)
+	authorized.POST("/transfer", h.handleTransfer)
+	authorized.GET("/models", h.handleModels)
+	authorized.GET("/settings", h.handleGetSettings)
+	authorized.PUT("/settings", h.handleUpdateSettings)
+}
+
+// cors разрешает запросы Mini App с доверенных доменов
+func (h *Handler) cors(c *gin.Context) {
+	origin := c.GetHeader("Origin")
+	for _, allowed := range h.config.CORSAllowedOrigins {
+		if origin != "" && (allowed == "*" || strings.EqualFold(allowed, origin)) {
+			c.Header("Access-Control-Allow-Origin", origin)
+			c.Header("Access-Control-Allow-Headers", "Authorization, Content-Type")
+			c.Header("Access-Control-Allow-Methods", "GET, POST, PUT, OPTIONS")
+			c.Header("Access-Control-Max-Age", "86400")
+			c.Header("Vary", "Origin")
+			break
+		}
+	}
+
+	if c.Request.Method == http.MethodOptions {
+		c.AbortWithStatus(http.StatusNoContent)
+		return
+	}
+	c.Next()
+}
+
+// authenticate проверяет токен доступа из заголовка Authorization: Bearer <token>
+func (h *Handler) authenticate(c *gin.Context) {
+	token, ok := strings.CutPrefix(c.GetHeader("Authorization"), "Bearer ")
+	if !ok {
+		c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "требуется авторизация"})
+		return
+	}
+
+	claims, err := ParseToken(strings.TrimSpace(token), AudienceWebApp, h.config.JWTSecret, time.Now())
+	if err != nil {
+		c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": ErrInvalidToken.Error()})
+		return
+	}
+
+	userID, err := claims.UserID()
+	if err != nil {
+		c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": ErrInvalidToken.Error()})
+		return
+	}
+
+	c.Set(userIDKey, userID)
+	c.Next()
+}
+
+// currentUserID возвращает Telegram ID авторизованного пользователя
+func currentUserID(c *gin.Context) int64 {
+	return c.GetInt64(userIDKey)
+}
+
+// handleAuth проверяет initData Mini App, регистрирует пользователя и выдает токен доступа
+func (h *Handler) handleAuth(c *gin.Context) {
+	var req authRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "не переданы данные авторизации"})
+		return
+	}
+
+	maxAge := time.Duration(h.config.InitDataMaxAgeHours) * time.Hour
+	webAppUser, err := ValidateInitData(req.InitData, h.botToken, maxAge, time.Now())
+	if err != nil {
+		h.log.Debug("Отклонены данные авторизации Mini App",
+			zap.String("remote_addr", c.ClientIP()),
+			zap.Error(err))
+		c.JSON(http.StatusUnauthorized, gin.H{"error": err.Error()})
+		return
+	}
+
+	u, err := h.userService.EnsureUserExists(c.Request.Context(), webAppUser.ID, webAppUser.Username,
+		webAppUser.FirstName, webAppUser.LastName, webAppUser.LanguageCode, webAppUser.IsBot)
+	if err != nil {
+		h.internalError(c, "Ошибка регистрации пользователя Mini App", err)
+		return
+	}
+
+	ttl := time.Duration(h.config.JWTExpiryHours) * time.Hour
+	token, expiresAt, err := IssueToken(u.TelegramID, AudienceWebApp, h.config.JWTSecret, ttl, time.Now())
+	if err != nil {
+		h.internalError(c, "Ошибка выпуска токена", err)
+		return
+	}
+
+	c.JSON(http.StatusOK, authResponse{
+		Token:     token,
+		ExpiresAt: expiresAt,
+		User:      newUserResponse(u),
+	})
+}
+
+// handleProfile возвращает профиль: пользователя, баланс, подписку и уровень
+func (h *Handler) handleProfile(c *gin.Context) {
+	ctx := c.Request.Context()
+	userID := currentUserID(c)
+
+	u, err := h.userService.GetUserByTelegramID(ctx, userID)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "пользователь не найден"})
+		return
+	}
+
+	balance, err := h.getBalance(ctx, userID)
+	if err != nil {
+		h.internalError(c, "Ошибка получения баланса", err)
+		return
+	}
+
+	sub, err := h.subService.GetActiveSubscription(ctx, userID)
+	if err != nil {
+		h.internalError(c, "Ошибка получения подписки", err)
+		return
+	}
+
+	progress, err := h.loyaltyService.GetProgress(ctx, userID)
+	if err != nil {
+		h.internalError(c, "Ошибка получения уровня", err)
+		return
+	}
+
+	c.JSON(http.StatusOK, profileResponse{
+		User:         newUserResponse(u),
+		Balance:      *balance,
+		Subscription: newSubscriptionResponse(sub),
+		Level:        newLevelResponse(progress),
+	})
+}
+
+// handleBalance возвращает баланс нейронов
+func (h *Handler) handleBalance(c *gin.Context) {
+	balance, err := h.getBalance(c.Request.Context(), currentUserID(c))
+	if err != nil {
+		h.internalError(c, "Ошибка получения баланса", err)
+		return
+	}
+	c.JSON(http.StatusOK, balance)
+}
+
+// getBalance возвращает личный баланс и баланс, из которого оплачиваются запросы
+func (h *Handler) getBalance(ctx context.Context, userID int64) (*balanceResponse, error) {
+	personal, err := h.currencyService.GetBalance(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	spending, err := h.currencyService.GetSpendingBalance(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	balance := newBalanceResponse(personal, spending)
+	return &balance, nil
+}
+
+// handleTransactions возвращает страницу истории транзакций (?page=0&page_size=20)
+func (h *Handler) handleTransactions(c *gin.Context) {
+	page, err := strconv.Atoi(c.DefaultQuery("page", "0"))
+	if err != nil || page < 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "некорректный номер страницы"})
+		return
+	}
+	pageSize, err := strconv.Atoi(c.DefaultQuery("page_size", strconv.Itoa(defaultPageSize)))
+	if err != nil || pageSize <= 0 || pageSize > maxPageSize {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "некорректный размер страницы"})
+		return
+	}
+
+	result, err := h.currencyService.GetTransactionPage(c.Request.Context(), currentUserID(c), page, pageSize)
+	if err != nil {
+		h.internalError(c, "Ошибка получения истории транзакций", err)
+		return
+	}
+
+	c.JSON(http.StatusOK, newTransactionPageResponse(result))
+}
+
+// handlePlans возвращает планы подписок
+func (h *Handler) handlePlans(c *gin.Context) {
+	plans, err := h.subService.GetAllPlans(c.Request.Context())
+	if err != nil {
+		h.internalError(c, "Ошибка получения планов подписок", err)
+		return
+	}
+
+	items := make([]planResponse, 0, len(plans))
+	for _, plan := range plans {
+		if plan.IsActive {
+			items = append(items, newPlanResponse(plan))
+		}
+	}
+	c.JSON(http.StatusOK, gin.H{"items": items})
+}
+
+// handlePackages возвращает пакеты нейронов
+func (h *Handler) handlePackages(c *gin.Context) {
+	packages, err := h.currencyService.GetAvailablePackages(c.Request.Context())
+	if err != nil {
+		h.internalError(c, "Ошибка получения пакетов нейронов", err)
+		return
+	}
+
+	items := make([]packageResponse, 0, len(packages))
+	for _, pkg := range packages {
+		if pkg.IsActive {
+			items = append(items, newPackageResponse(pkg))
+		}
+	}
+	c.JSON(http.StatusOK, gin.H{"items": items})
+}
+
+// handleCheckout создает платеж ЮKassa за подписку или пакет нейронов и возвращает ссылку на оплату
+func (h *Handler) handleCheckout(c *gin.Context) {
+	var req checkoutRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "некорректный запрос"})
+		return
+	}
+
+	ctx := c.Request.Context()
+	userID := currentUserID(c)
+
+	var p *payment.Payment
+	var err error
+	switch req.Type {
+	case checkoutSubscription:
+		if req.PlanCode == "" || (req.Period != "monthly" && req.Period != "yearly") {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "укажите план и период подписки"})
+			return
+		}
+		p, err = h.paymentService.CreateSubscriptionPayment(ctx, userID, req.PlanCode, req.Period)
+	case checkoutPackage:
+		if req.PackageID <= 0 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "укажите пакет нейронов"})
+			return
+		}
+		p, err = h.paymentService.CreatePackagePayment(ctx, userID, req.PackageID)
+	default:
+		c.JSON(http.StatusBadRequest, gin.H{"error": "неизвестный тип покупки"})
+		return
+	}
+	if err != nil {
+		h.log.Warn("Ошибка создания платежа из Mini App",
+			zap.Int64("user_id", userID),
+			zap.String("type", req.Type),
+			zap.Error(err))
+		c.JSON(http.StatusUnprocessableEntity, gin.H{"error": "не удалось создать платеж"})
+		return
+	}
+
+	c.JSON(http.StatusOK, checkoutResponse{
+		PaymentID:  p.ID,
+		PaymentURL: p.PaymentURL,
+		Amount:     p.Amount,
+	})
+}
+
+// handleTransfer дарит нейроны другому пользователю. Повтор запроса с тем же ключом
+// идемпотентности возвращает уже выполненный подарок, а не дарит нейроны еще раз
+func (h *Handler) handleTransfer(c *gin.Context) {
+	var req transferRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "некорректный запрос"})
+		return
+	}
+	if req.Amount <= 0 || len(req.IdempotencyKey) > maxIdempotencyKeyLength {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "некорректный запрос"})
+		return
+	}
+	if h.giftService == nil {
+		c.JSON(http.StatusUnprocessableEntity, gin.H{"error": gift.ErrDisabled.Error()})
+		return
+	}
+
+	ctx := c.Request.Context()
+	userID := currentUserID(c)
+
+	recipient, err := h.userService.GetUserByUsername(ctx, req.Recipient)
+	if err != nil {
+		h.internalError(c, "Ошибка поиска получателя подарка", err)
+		return
+	}
+	if recipient == nil {
+		h.transferError(c, gift.ErrRecipientNotFound)
+		return
+	}
+
+	// Ключ привязан к отправителю, чтобы ключи разных пользователей не пересекались.
+	// Send проверяет ограничения подарка и списывает нейроны с лимитами плана
+	key := fmt.Sprintf("gift:%d:webapp:%s", userID, req.IdempotencyKey)
+	transfer, err := h.giftService.Send(ctx, userID, recipient.TelegramID, req.Amount, req.Comment, gift.SourceWebApp, key)
+	if err != nil {
+		h.transferError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, transferResponse{
+		Recipient: recipient.Username,
+		Amount:    req.Amount,
+		Balance:   transfer.Debit.BalanceAfter,
+	})
+}
+
+// transferError отвечает на ошибку подарка: ограничения подарков возвращаются пользователю, остальные ошибки логируются
+func (h *Handler) transferError(c *gin.Context, err error) {
+	switch {
+	case errors.Is(err, gift.ErrDisabled), errors.Is(err, gift.ErrRecipientNotFound),
+		errors.Is(err, gift.ErrInvalidRecipient), errors.Is(err, gift.ErrAmountTooSmall),
+		errors.Is(err, gift.ErrAccountTooNew), errors.Is(err, gift.ErrNotAvailableOnPlan),
+		errors.Is(err, currency.ErrTransferLimit), errors.Is(err, currency.ErrNotTransferable):
+		c.JSON(http.StatusUnprocessableEntity, gin.H{"error": err.Error()})
+	default:
+		h.internalError(c, "Ошибка подарка нейронов из Mini App", err)
+	}
+}
+
+// handleModels возвращает модели нейросетей, доступные пользователю
+func (h *Handler) handleModels(c *gin.Context) {
+	models, err := h.llmService.GetAvailableModels(c.Request.Context(), currentUserID(c))
+	if err != nil {
+		h.internalError(c, "Ошибка получения доступных моделей", err)
+		return
+	}
+	if models == nil {
+		models = []llm.ModelConfig{}
+	}
+	c.JSON(http.StatusOK, gin.H{"items": models})
+}
+
+// handleGetSettings возвращает настройки общения с нейросетью
+func (h *Handler) handleGetSettings(c *gin.Context) {
+	settings, err := h.getSettings(c.Request.Context(), currentUserID(c))
+	if err != nil {
+		h.internalError(c, "Ошибка получения настроек", err)
+		return
+	}
+	c.JSON(http.StatusOK, settings)
+}
+
+// handleUpdateSettings выбирает персону, задает собственный промпт или сбрасывает настройки
+func (h *Handler) handleUpdateSettings(c *gin.Context) {
+	var req settingsRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "некорректный запрос"})
+		return
+	}
+
+	ctx := c.Request.Context()
+	userID := currentUserID(c)
+
+	var err error
+	switch {
+	case req.Reset:
+		err = h.conversationService.ResetPersona(ctx, userID)
+	case req.CustomPrompt != nil:
+		// Ошибки проверки промпта сформулированы для пользователя
+		if err = h.conversationService.SetCustomPrompt(ctx, userID, *req.CustomPrompt); err != nil {
+			c.JSON(http.StatusUnprocessableEntity, gin.H{"error": err.Error()})
+			return
+		}
+	case req.Persona != "":
+		if _, err = h.conversationService.SelectPersona(ctx, userID, req.Persona); err != nil {
+			c.JSON(http.StatusUnprocessableEntity, gin.H{"error": "персона не найдена"})
+			return
+		}
+	default:
+		c.JSON(http.StatusBadRequest, gin.H{"error": "не указаны изменения настроек"})
+		return
+	}
+	if err != nil {
+		h.internalError(c, "Ошибка изменения настроек", err)
+		return
+	}
+
+	settings, err := h.getSettings(ctx, userID)
+	if err != nil {
+		h.internalError(c, "Ошибка получения настроек", err)
+		return
+	}
+	c.JSON(http.StatusOK, settings)
+}
+
+// getSettings собирает настройки диалога пользователя и список персон
+func (h *Handler) getSettings(ctx context.Context, userID int64) (*settingsResponse, error) {
+	conv, err := h.conversationService.GetActiveConversation(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	personas, err := h.conversationService.GetPersonas(ctx)
+	if err != nil {
+		return nil, err
+	}
+	maxLength, err := h.conversationService.GetCustomPromptMaxLength(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	settings := &settingsResponse{
+		Persona:               newPersonaResponse(conv.Persona),
+		CustomPrompt:          conv.CustomSystemPrompt,
+		CustomPromptMaxLength: maxLength,
+		Personas:              make([]personaResponse, 0, len(personas)),
+	}
+	for _, p := range personas {
+		settings.Personas = append(settings.Personas, *newPersonaResponse(p))
+	}
+	return settings, nil
+}
+
+// internalError логирует ошибку и отвечает кодом 500 без подробностей
+func (h *Handler) internalError(c *gin.Context, message string, err error) {
+	if !errors.Is(err, context.Canceled) {
+		h.log.Error(message,
+			zap.Int64("user_id", currentUserID(c)),
+			zap.Error(err))
+	}
+	c.JSON(http.StatusInternalServerError, gin.H{"error": "внутренняя ошибка сервера"})
+}
@@ -0,0 +1,154 @@
+// Тесты HTTP-обработчиков API Mini App
+
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/redis/go-redis/v9"
+	"go.uber.org/zap"
+
+	"neurobot-prod/internal/config"
+	"neurobot-prod/internal/currency"
+	"neurobot-prod/internal/gift"
+	"neurobot-prod/internal/storage/postgres/pgtest"
+	"neurobot-prod/internal/subscription"
+	"neurobot-prod/internal/user"
+)
+
+const testJWTSecret = "secret"
+
+// newTestRouter регистрирует маршруты обработчика в отдельном маршрутизаторе
+func newTestRouter(h *Handler) *gin.Engine {
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	h.RegisterRoutes(router.Group("/api"))
+	return router
+}
+
+// postTransfer отправляет запрос подарка от имени пользователя
+func postTransfer(t *testing.T, router *gin.Engine, userID int64, body string) *httptest.ResponseRecorder {
+	t.Helper()
+
+	req := httptest.NewRequest(http.MethodPost, "/api/transfer", strings.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	if userID != 0 {
+		token, _, err := IssueToken(userID, AudienceWebApp, testJWTSecret, time.Hour, time.Now())
+		if err != nil {
+			t.Fatal(err)
+		}
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+
+	rec := httptest.NewRecorder()
+	router.ServeHTTP(rec, req)
+	return rec
+}
+
+func TestTransferValidation(t *testing.T) {
+	cfg := &config.Config{}
+	cfg.Services.API.JWTSecret = testJWTSecret
+	router := newTestRouter(NewHandler(nil, nil, nil, nil, nil, nil, nil, cfg, zap.NewNop()))
+
+	tests := []struct {
+		name   string
+		userID int64
+		body   string
+		want   int
+	}{
+		{name: "без токена", body: `{"recipient":"bob","amount":10,"idempotency_key":"k"}`, want: http.StatusUnauthorized},
+		{name: "пустой запрос", userID: 42, body: `{}`, want: http.StatusBadRequest},
+		{name: "без ключа идемпотентности", userID: 42, body: `{"recipient":"bob","amount":10}`, want: http.StatusBadRequest},
+		{name: "отрицательная сумма", userID: 42, body: `{"recipient":"bob","amount":-10,"idempotency_key":"k"}`, want: http.StatusBadRequest},
+		{name: "длинный ключ", userID: 42,
+			body: `{"recipient":"bob","amount":10,"idempotency_key":"` + strings.Repeat("k", maxIdempotencyKeyLength+1) + `"}`,
+			want: http.StatusBadRequest},
+		{name: "подарки не настроены", userID: 42, body: `{"recipient":"bob","amount":10,"idempotency_key":"k"}`, want: http.StatusUnprocessableEntity},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if rec := postTransfer(t, router, tt.userID, tt.body); rec.Code != tt.want {
+				t.Errorf("код ответа %d, ожидался %d: %s", rec.Code, tt.want, rec.Body.String())
+			}
+		})
+	}
+}
+
+func TestTransferGift(t *testing.T) {
+	db := pgtest.Open(t)
+	pgtest.CreateUser(t, db, 4001)
+	pgtest.CreateUser(t, db, 4002)
+	ctx := context.Background()
+
+	if _, err := db.ExecContext(ctx, `UPDATE users SET username = 'recipient' WHERE telegram_id = $1`, 4002); err != nil {
+		t.Fatal(err)
+	}
+
+	log := zap.NewNop()
+	// Redis недоступен, пользователи читаются из базы
+	redisClient := redis.NewClient(&redis.Options{Addr: "127.0.0.1:1", MaxRetries: -1})
+	t.Cleanup(func() { redisClient.Close() })
+	userService := user.NewService(user.NewRepository(db), redisClient, log)
+	subService := subscription.NewService(subscription.NewRepository(db), log)
+	currencyService := currency.NewService(currency.NewRepository(db), subService, log)
+
+	cfg := &config.Config{}
+	cfg.Services.API.JWTSecret = testJWTSecret
+	h := NewHandler(userService, currencyService, subService, nil, nil, nil, nil, cfg, log)
+	h.SetGifts(gift.NewService(currencyService, subService, userService,
+		config.GiftConfig{Enabled: true, MinAmount: 10, MaxPerDay: 5}, log))
+	router := newTestRouter(h)
+
+	if _, err := currencyService.AddNeurons(ctx, 4001, 300, currency.TypePurchase, "Покупка", nil, "", "", 0); err != nil {
+		t.Fatal(err)
+	}
+
+	// Повтор с тем же ключом возвращает тот же подарок и не списывает нейроны еще раз
+	body := `{"recipient":"@recipient","amount":60,"comment":"спасибо","idempotency_key":"gift-1"}`
+	for i := 0; i < 2; i++ {
+		rec := postTransfer(t, router, 4001, body)
+		if rec.Code != http.StatusOK {
+			t.Fatalf("попытка %d: код ответа %d: %s", i+1, rec.Code, rec.Body.String())
+		}
+		var resp transferResponse
+		if err := json.Unmarshal(rec.Body.Bytes(), &resp); err != nil {
+			t.Fatal(err)
+		}
+		if resp.Recipient != "recipient" || resp.Amount != 60 || resp.Balance != 240 {
+			t.Errorf("попытка %d: ответ %+v", i+1, resp)
+		}
+	}
+
+	// Суточный лимит бесплатного плана - 100 нейронов
+	rec := postTransfer(t, router, 4001, `{"recipient":"recipient","amount":50,"idempotency_key":"gift-2"}`)
+	if rec.Code != http.StatusUnprocessableEntity {
+		t.Errorf("подарок сверх лимита: код ответа %d, ожидался %d", rec.Code, http.StatusUnprocessableEntity)
+	}
+
+	// Себе подарить нельзя
+	if _, err := db.ExecContext(ctx, `UPDATE users SET username = 'sender' WHERE telegram_id = $1`, 4001); err != nil {
+		t.Fatal(err)
+	}
+	rec = postTransfer(t, router, 4001, `{"recipient":"sender","amount":10,"idempotency_key":"gift-3"}`)
+	if rec.Code != http.StatusUnprocessableEntity {
+		t.Errorf("подарок себе: код ответа %d, ожидался %d", rec.Code, http.StatusUnprocessableEntity)
+	}
+
+	for userID, want := range map[int64]int{4001: 240, 4002: 60} {
+		b, err := currencyService.GetBalance(ctx, userID)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if b.Balance != want {
+			t.Errorf("баланс пользователя %d: %d, ожидался %d", userID, b.Balance, want)
+		}
+	}
+}
@@ -0,0 +1,278 @@
+// Модели запросов и ответов API Mini App
+
+package api
+
+import (
+	"time"
+
+	"neurobot-prod/internal/conversation"
+	"neurobot-prod/internal/currency"
+	"neurobot-prod/internal/loyalty"
+	"neurobot-prod/internal/subscription"
+	"neurobot-prod/internal/user"
+)
+
+// authRequest представляет запрос авторизации по initData
+type authRequest struct {
+	InitData string `json:"init_data" binding:"required"`
+}
+
+// authResponse представляет выданный токен доступа
+type authResponse struct {
+	Token     string       `json:"token"`
+	ExpiresAt time.Time    `json:"expires_at"`
+	User      userResponse `json:"user"`
+}
+
+// userResponse представляет пользователя
+type userResponse struct {
+	TelegramID   int64     `json:"telegram_id"`
+	Username     string    `json:"username,omitempty"`
+	FirstName    string    `json:"first_name"`
+	LastName     string    `json:"last_name,omitempty"`
+	LanguageCode string    `json:"language_code,omitempty"`
+	CreatedAt    time.Time `json:"created_at"`
+}
+
+func newUserResponse(u *user.UserDTO) userResponse {
+	return userResponse{
+		TelegramID:   u.TelegramID,
+		Username:     u.Username,
+		FirstName:    u.FirstName,
+		LastName:     u.LastName,
+		LanguageCode: u.LanguageCode,
+		CreatedAt:    u.CreatedAt,
+	}
+}
+
+// balanceResponse представляет баланс нейронов пользователя
+type balanceResponse struct {
+	Balance         int    `json:"balance"`
+	LifetimeEarned  int    `json:"lifetime_earned"`
+	LifetimeSpent   int    `json:"lifetime_spent"`
+	SpendingBalance int    `json:"spending_balance"`    // Доступно на запросы с учетом выбранного кошелька
+	WalletID        *int64 `json:"wallet_id,omitempty"` // Общий кошелек, оплачивающий запросы
+}
+
+func newBalanceResponse(personal, spending *currency.Balance) balanceResponse {
+	return balanceResponse{
+		Balance:         personal.Balance,
+		LifetimeEarned:  personal.LifetimeEarned,
+		LifetimeSpent:   personal.LifetimeSpent,
+		SpendingBalance: spending.Balance,
+		WalletID:        spending.WalletID,
+	}
+}
+
+// subscriptionResponse представляет активную подписку
+type subscriptionResponse struct {
+	PlanCode  string    `json:"plan_code"`
+	PlanName  string    `json:"plan_name"`
+	Status    string    `json:"status"`
+	Period    string    `json:"period"`
+	EndDate   time.Time `json:"end_date"`
+	DaysLeft  int       `json:"days_left"`
+	AutoRenew bool      `json:"auto_renew"`
+}
+
+func newSubscriptionResponse(s *subscription.Subscription) *subscriptionResponse {
+	if s == nil || s.Plan == nil {
+		return nil
+	}
+	return &subscriptionResponse{
+		PlanCode:  s.Plan.Code,
+		PlanName:  s.Plan.Name,
+		Status:    string(s.Status),
+		Period:    s.Period,
+		EndDate:   s.EndDate,
+		DaysLeft:  s.DaysLeft(),
+		AutoRenew: s.AutoRenew,
+	}
+}
+
+// levelResponse представляет уровень лояльности
+type levelResponse struct {
+	Level         int    `json:"level"`
+	Name          string `json:"name"`
+	XP            int    `json:"xp"`
+	XPToNextLevel int    `json:"xp_to_next_level"` // 0 на максимальном уровне
+}
+
+func newLevelResponse(p *loyalty.Progress) *levelResponse {
+	if p == nil || p.Level == nil {
+		return nil
+	}
+	return &levelResponse{
+		Level:         p.Level.Level,
+		Name:          p.Level.Name,
+		XP:            p.XP,
+		XPToNextLevel: p.XPToNextLevel(),
+	}
+}
+
+// profileResponse представляет профиль пользователя
+type profileResponse struct {
+	User         userResponse          `json:"user"`
+	Balance      balanceResponse       `json:"balance"`
+	Subscription *subscriptionResponse `json:"subscription"` // nil для бесплатного плана
+	Level        *levelResponse        `json:"level"`
+}
+
+// transactionResponse представляет транзакцию нейронов
+type transactionResponse struct {
+	ID           int64      `json:"id"`
+	Type         string     `json:"type"`
+	Amount       int        `json:"amount"`
+	BalanceAfter int        `json:"balance_after"`
+	Description  string     `json:"description"`
+	ExpiresAt    *time.Time `json:"expires_at,omitempty"`
+	CreatedAt    time.Time  `json:"created_at"`
+}
+
+// transactionPageResponse представляет страницу истории транзакций
+type transactionPageResponse struct {
+	Items     []transactionResponse `json:"items"`
+	Page      int                   `json:"page"`
+	PageSize  int                   `json:"page_size"`
+	PageCount int                   `json:"page_count"`
+	Total     int                   `json:"total"`
+}
+
+func newTransactionPageResponse(p *currency.TransactionPage) transactionPageResponse {
+	items := make([]transactionResponse, 0, len(p.Transactions))
+	for _, tx := range p.Transactions {
+		items = append(items, transactionResponse{
+			ID:           tx.ID,
+			Type:         string(tx.TransactionType),
+			Amount:       tx.Amount,
+			BalanceAfter: tx.BalanceAfter,
+			Description:  tx.Description,
+			ExpiresAt:    tx.ExpiresAt,
+			CreatedAt:    tx.CreatedAt,
+		})
+	}
+	return transactionPageResponse{
+		Items:     items,
+		Page:      p.Page,
+		PageSize:  p.PageSize,
+		PageCount: p.PageCount(),
+		Total:     p.Total,
+	}
+}
+
+// planResponse представляет план подписки. Цены указаны в копейках
+type planResponse struct {
+	Code             string                 `json:"code"`
+	Name             string                 `json:"name"`
+	Description      string                 `json:"description"`
+	PriceMonthly     int                    `json:"price_monthly"`
+	PriceYearly      int                    `json:"price_yearly"`
+	DailyNeurons     int                    `json:"daily_neurons"`
+	MaxRequestLength int                    `json:"max_request_length"`
+	ContextMessages  int                    `json:"context_messages"`
+	Features         map[string]interface{} `json:"features"`
+}
+
+func newPlanResponse(p *subscription.Plan) planResponse {
+	return planResponse{
+		Code:             p.Code,
+		Name:             p.Name,
+		Description:      p.Description,
+		PriceMonthly:     p.PriceMonthly,
+		PriceYearly:      p.PriceYearly,
+		DailyNeurons:     p.DailyNeurons,
+		MaxRequestLength: p.MaxRequestLength,
+		ContextMessages:  p.ContextMessages,
+		Features:         p.Features,
+	}
+}
+
+// packageResponse представляет пакет нейронов. Цена указана в копейках
+type packageResponse struct {
+	ID          int    `json:"id"`
+	Name        string `json:"name"`
+	Amount      int    `json:"amount"`
+	BonusAmount int    `json:"bonus_amount"`
+	TotalAmount int    `json:"total_amount"`
+	Price       int    `json:"price"`
+}
+
+func newPackageResponse(p *currency.Package) packageResponse {
+	return packageResponse{
+		ID:          p.ID,
+		Name:        p.Name,
+		Amount:      p.Amount,
+		BonusAmount: p.BonusAmount,
+		TotalAmount: p.GetTotalAmount(),
+		Price:       p.Price,
+	}
+}
+
+// Типы покупок при оформлении заказа
+const (
+	checkoutSubscription = "subscription"
+	checkoutPackage      = "package"
+)
+
+// checkoutRequest представляет запрос на создание платежа
+type checkoutRequest struct {
+	Type      string `json:"type" binding:"required"` // subscription или package
+	PlanCode  string `json:"plan_code"`
+	Period    string `json:"period"` // monthly или yearly
+	PackageID int    `json:"package_id"`
+}
+
+// checkoutResponse представляет созданный платеж
+type checkoutResponse struct {
+	PaymentID  int64  `json:"payment_id"`
+	PaymentURL string `json:"payment_url"`
+	Amount     int    `json:"amount"` // В копейках, с учетом скидки по промокоду
+}
+
+// transferRequest представляет подарок нейронов пользователю
+type transferRequest struct {
+	Recipient      string `json:"recipient" binding:"required"` // Юзернейм получателя, можно с @
+	Amount         int    `json:"amount" binding:"required"`
+	Comment        string `json:"comment"`
+	IdempotencyKey string `json:"idempotency_key" binding:"required"` // Создается Mini App один раз на каждый подарок
+}
+
+// transferResponse представляет выполненный подарок
+type transferResponse struct {
+	Recipient string `json:"recipient"`
+	Amount    int    `json:"amount"`
+	Balance   int    `json:"balance"` // Баланс отправителя после подарка
+}
+
+// personaResponse представляет персону нейросети
+type personaResponse struct {
+	Code        string `json:"code"`
+	Name        string `json:"name"`
+	Description string `json:"description"`
+}
+
+func newPersonaResponse(p *conversation.Persona) *personaResponse {
+	if p == nil {
+		return nil
+	}
+	return &personaResponse{
+		Code:        p.Code,
+		Name:        p.Name,
+		Description: p.Description,
+	}
+}
+
+// settingsResponse представляет настройки общения с нейросетью
+type settingsResponse struct {
+	Persona               *personaResponse  `json:"persona"`
+	CustomPrompt          string            `json:"custom_prompt,omitempty"`
+	CustomPromptMaxLength int               `json:"custom_prompt_max_length"` // 0, если собственные промпты недоступны
+	Personas              []personaResponse `json:"personas"`
+}
+
+// settingsRequest представляет изменение настроек: выбор персоны, собственный промпт или сброс
+type settingsRequest struct {
+	Persona      string  `json:"persona"`
+	CustomPrompt *string `json:"custom_prompt"`
+	Reset        bool    `json:"reset"`
+}
@@ -0,0 +1,122 @@
+package app
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+	"go.uber.org/zap"
+
+	"neurobot-prod/internal/achievement"
+	"neurobot-prod/internal/events"
+	"neurobot-prod/internal/telegram"
+)
+
+// handleAchievementsCommand обрабатывает команду /achievements
+func (w *MessageWorker) handleAchievementsCommand(message *tgbotapi.Message) {
+	userID := int64(message.From.ID)
+	chatID := message.Chat.ID
+
+	achievements, err := w.achievementService.GetUserAchievements(context.Background(), userID)
+	if err != nil {
+		w.bot.SendMessage(chatID, "Произошла ошибка при получении достижений. Попробуйте позже.")
+		return
+	}
+
+	unlockedCount := 0
+	for _, a := range achievements {
+		if a.IsUnlocked() {
+			unlockedCount++
+		}
+	}
+
+	var parts []string
+	parts = append(parts, fmt.Sprintf("🏆 Достижения: %d из %d\n", unlockedCount, len(achievements)))
+
+	var rows [][]tgbotapi.InlineKeyboardButton
+	for _, a := range achievements {
+		// Скрытые достижения не раскрываем до получения
+		if a.IsHidden && !a.IsUnlocked() {
+			parts = append(parts, "🔒 ??? - секретное достижение")
+			continue
+		}
+
+		mark := "🔒"
+		if a.IsUnlocked() {
+			mark = "✅"
+		}
+		line := fmt.Sprintf("%s %s - %s", mark, a.Name, a.Description)
+		if reward := formatAchievementReward(&a.Achievement); reward != "" {
+			line += fmt.Sprintf(" (%s)", reward)
+		}
+		parts = append(parts, line)
+
+		if a.CanClaim() {
+			rows = append(rows, tgbotapi.NewInlineKeyboardRow(
+				tgbotapi.NewInlineKeyboardButtonData("🎁 Забрать: "+a.Name, "ach:claim:"+strconv.Itoa(a.ID))))
+		}
+	}
+
+	var options []telegram.MessageOption
+	if len(rows) > 0 {
+		options = append(options, telegram.WithReplyMarkup(tgbotapi.NewInlineKeyboardMarkup(rows...)))
+	}
+	w.bot.SendMessage(chatID, strings.Join(parts, "\n"), options...)
+}
+
+// handleAchievementCallback обрабатывает получение награды за достижение
+func (w *MessageWorker) handleAchievementCallback(callback *tgbotapi.CallbackQuery, parts []string) {
+	userID := int64(callback.From.ID)
+	chatID := callback.Message.Chat.ID
+
+	if len(parts) < 3 || parts[1] != "claim" {
+		return
+	}
+	achievementID, err := strconv.Atoi(parts[2])
+	if err != nil {
+		return
+	}
+
+	ua, err := w.achievementService.ClaimReward(context.Background(), userID, achievementID)
+	if err != nil {
+		switch {
+		case errors.Is(err, achievement.ErrAlreadyClaimed):
+			w.bot.SendMessage(chatID, "Награда за это достижение уже получена.")
+		case errors.Is(err, achievement.ErrNotUnlocked), errors.Is(err, achievement.ErrNotFound):
+			w.bot.SendMessage(chatID, "Это достижение еще не получено.")
+		default:
+			w.log.Error("Ошибка получения награды за достижение",
+				zap.Int64("user_id", userID),
+				zap.Int("achievement_id", achievementID),
+				zap.Error(err))
+			w.bot.SendMessage(chatID, "Произошла ошибка при начислении награды. Попробуйте позже.")
+		}
+		return
+	}
+
+	w.bot.SendMessage(chatID, fmt.Sprintf("🎁 Награда за достижение «%s» получена: %s", ua.Name, formatAchievementReward(&ua.Achievement)))
+}
+
+// handleHiddenCommand обрабатывает секретную команду. Она не указана в справке
+func (w *MessageWorker) handleHiddenCommand(message *tgbotapi.Message) {
+	w.bot.SendMessage(message.Chat.ID, "🐇 Следуй за белым кроликом...")
+
+	w.eventBus.Emit(context.Background(), events.New(events.CommandUsed, int64(message.From.ID), map[string]interface{}{
+		"command": message.Command(),
+	}))
+}
+
+// formatAchievementReward форматирует награду за достижение
+func formatAchievementReward(a *achievement.Achievement) string {
+	var rewards []string
+	if a.NeuronReward > 0 {
+		rewards = append(rewards, fmt.Sprintf("+%d нейронов", a.NeuronReward))
+	}
+	if a.XPReward > 0 {
+		rewards = append(rewards, fmt.Sprintf("+%d XP", a.XPReward))
+	}
+	return strings.Join(rewards, ", ")
+}
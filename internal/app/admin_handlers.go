@@ -0,0 +1,492 @@
+// Обработчики консоли администратора
+
+package app
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+	"go.uber.org/zap"
+
+	"neurobot-prod/internal/admin"
+	"neurobot-prod/internal/currency"
+	"neurobot-prod/internal/subscription"
+)
+
+const (
+	// adminUsage - справка по команде /admin
+	adminUsage = "🛠 Консоль администратора\n\n" +
+		"/admin user <id|@username> - карточка пользователя\n" +
+		"/admin balance <id> <+N|-N> <причина> - начислить или списать нейроны\n" +
+		"/admin grant <id> <план> <дней> [причина] - выдать подписку\n" +
+		"/admin cancel <id> [причина] - отменить подписку\n" +
+		"/admin plans | packages | models - список с доступностью\n" +
+		"/admin plan <код> on|off - включить или отключить план\n" +
+		"/admin package <id> on|off - включить или отключить пакет\n" +
+		"/admin model <название> on|off - включить или отключить модель\n" +
+		"/admin errors [N] - последние ошибки сервисов\n" +
+		"/admin audit [id] - журнал действий администраторов\n" +
+		"/admin admins [add|remove <id>] - администраторы\n" +
+		"/broadcast - рассылки по сегментам пользователей\n\n" +
+		"Все действия записываются в журнал."
+	// adminListLimit - количество записей журнала или ошибок в сообщении по умолчанию
+	adminListLimit = 10
+	// adminMaxListLimit - максимальное количество ошибок в одном сообщении
+	adminMaxListLimit = 30
+	// adminErrorTextLimit - максимальная длина текста ошибки в сообщении
+	adminErrorTextLimit = 300
+	// adminMessageLimit - максимальная длина сообщения, Telegram принимает до 4096 символов
+	adminMessageLimit = 4000
+)
+
+// isAdmin проверяет права администратора из конфигурации или базы данных
+func (w *MessageWorker) isAdmin(userID int64) bool {
+	return w.adminService.IsAdmin(context.Background(), userID)
+}
+
+// handleAdminCommand обрабатывает команду /admin и ее подкоманды
+func (w *MessageWorker) handleAdminCommand(message *tgbotapi.Message) {
+	userID := int64(message.From.ID)
+	chatID := message.Chat.ID
+	ctx := context.Background()
+
+	if !w.isAdmin(userID) {
+		w.bot.SendMessage(chatID, "Неизвестная команда. Введите /help для получения списка доступных команд.")
+		return
+	}
+
+	actor := admin.Actor{AdminID: userID, Source: admin.SourceTelegram}
+	args := strings.Fields(message.CommandArguments())
+	if len(args) == 0 {
+		w.bot.SendMessage(chatID, adminUsage)
+		return
+	}
+
+	switch args[0] {
+	case "user":
+		if len(args) < 2 {
+			w.bot.SendMessage(chatID, adminUsage)
+			return
+		}
+		info, err := w.adminService.LookupUser(ctx, actor, args[1])
+		if err != nil {
+			w.sendAdminError(chatID, userID, err)
+			return
+		}
+		w.bot.SendMessage(chatID, formatAdminUser(info))
+
+	case "balance":
+		if len(args) < 4 {
+			w.bot.SendMessage(chatID, adminUsage)
+			return
+		}
+		targetID, err1 := strconv.ParseInt(args[1], 10, 64)
+		amount, err2 := strconv.Atoi(args[2])
+		if err1 != nil || err2 != nil {
+			w.bot.SendMessage(chatID, adminUsage)
+			return
+		}
+		reason := strings.Join(args[3:], " ")
+		// Повторная доставка того же сообщения не изменит баланс дважды
+		key := fmt.Sprintf("admin:%d:%d", chatID, message.MessageID)
+		tx, err := w.adminService.AdjustBalance(ctx, actor, targetID, amount, reason, key)
+		if err != nil {
+			w.sendAdminError(chatID, userID, err)
+			return
+		}
+		w.bot.SendMessage(chatID, fmt.Sprintf("✅ Баланс пользователя %d изменен на %+d. Текущий баланс: %d 💎",
+			targetID, tx.Amount, tx.BalanceAfter))
+
+	case "grant":
+		if len(args) < 4 {
+			w.bot.SendMessage(chatID, adminUsage)
+			return
+		}
+		targetID, err1 := strconv.ParseInt(args[1], 10, 64)
+		days, err2 := strconv.Atoi(args[3])
+		if err1 != nil || err2 != nil {
+			w.bot.SendMessage(chatID, adminUsage)
+			return
+		}
+		sub, err := w.adminService.GrantSubscription(ctx, actor, targetID, args[2], days, strings.Join(args[4:], " "))
+		if err != nil {
+			w.sendAdminError(chatID, userID, err)
+			return
+		}
+		w.bot.SendMessage(chatID, fmt.Sprintf("✅ Пользователю %d выдана подписка «%s» до %s.",
+			targetID, sub.Plan.Name, sub.EndDate.Format("02.01.2006")))
+
+	case "cancel":
+		if len(args) < 2 {
+			w.bot.SendMessage(chatID, adminUsage)
+			return
+		}
+		targetID, err := strconv.ParseInt(args[1], 10, 64)
+		if err != nil {
+			w.bot.SendMessage(chatID, adminUsage)
+			return
+		}
+		sub, err := w.adminService.CancelSubscription(ctx, actor, targetID, strings.Join(args[2:], " "))
+		if err != nil {
+			w.sendAdminError(chatID, userID, err)
+			return
+		}
+		w.bot.SendMessage(chatID, fmt.Sprintf("✅ Подписка #%d пользователя %d отменена.", sub.ID, targetID))
+
+	case "plans":
+		w.sendAdminPlans(chatID, actor)
+
+	case "plan":
+		enabled, ok := parseAdminSwitch(args)
+		if !ok {
+			w.bot.SendMessage(chatID, adminUsage)
+			return
+		}
+		if err := w.adminService.SetPlanActive(ctx, actor, args[1], enabled); err != nil {
+			w.sendAdminError(chatID, userID, err)
+			return
+		}
+		w.bot.SendMessage(chatID, fmt.Sprintf("✅ План %s %s.", args[1], adminSwitchText(enabled)))
+
+	case "packages":
+		w.sendAdminPackages(chatID, actor)
+
+	case "package":
+		enabled, ok := parseAdminSwitch(args)
+		if !ok {
+			w.bot.SendMessage(chatID, adminUsage)
+			return
+		}
+		packageID, err := strconv.Atoi(args[1])
+		if err != nil {
+			w.bot.SendMessage(chatID, adminUsage)
+			return
+		}
+		if err := w.adminService.SetPackageActive(ctx, actor, packageID, enabled); err != nil {
+			w.sendAdminError(chatID, userID, err)
+			return
+		}
+		w.bot.SendMessage(chatID, fmt.Sprintf("✅ Пакет #%d %s.", packageID, adminSwitchText(enabled)))
+
+	case "models":
+		w.sendAdminModels(chatID, actor)
+
+	case "model":
+		enabled, ok := parseAdminSwitch(args)
+		if !ok {
+			w.bot.SendMessage(chatID, adminUsage)
+			return
+		}
+		if err := w.adminService.SetModelEnabled(ctx, actor, args[1], enabled); err != nil {
+			w.sendAdminError(chatID, userID, err)
+			return
+		}
+		w.bot.SendMessage(chatID, fmt.Sprintf("✅ Модель %s %s.", args[1], adminSwitchText(enabled)))
+
+	case "errors":
+		limit := adminListLimit
+		if len(args) > 1 {
+			if n, err := strconv.Atoi(args[1]); err == nil && n > 0 {
+				limit = min(n, adminMaxListLimit)
+			}
+		}
+		w.sendAdminErrors(chatID, actor, limit)
+
+	case "audit":
+		var targetID *int64
+		if len(args) > 1 {
+			id, err := strconv.ParseInt(args[1], 10, 64)
+			if err != nil {
+				w.bot.SendMessage(chatID, adminUsage)
+				return
+			}
+			targetID = &id
+		}
+		w.sendAdminAudit(chatID, actor, targetID)
+
+	case "admins":
+		w.handleAdminAdmins(chatID, actor, args[1:])
+
+	default:
+		w.bot.SendMessage(chatID, adminUsage)
+	}
+}
+
+// handleAdminAdmins показывает администраторов, выдает и отзывает права
+func (w *MessageWorker) handleAdminAdmins(chatID int64, actor admin.Actor, args []string) {
+	ctx := context.Background()
+
+	if len(args) == 0 {
+		admins, err := w.adminService.ListAdmins(ctx, actor)
+		if err != nil {
+			w.sendAdminError(chatID, actor.AdminID, err)
+			return
+		}
+		var sb strings.Builder
+		sb.WriteString("👮 Администраторы:\n\n")
+		for _, a := range admins {
+			if a.FromConfig {
+				sb.WriteString(fmt.Sprintf("• %d (конфигурация)\n", a.TelegramID))
+			} else {
+				sb.WriteString(fmt.Sprintf("• %d (выдал %d, %s)\n", a.TelegramID, a.AddedBy, a.CreatedAt.Format("02.01.2006")))
+			}
+		}
+		w.bot.SendMessage(chatID, sb.String())
+		return
+	}
+
+	if len(args) < 2 {
+		w.bot.SendMessage(chatID, adminUsage)
+		return
+	}
+	targetID, err := strconv.ParseInt(args[1], 10, 64)
+	if err != nil {
+		w.bot.SendMessage(chatID, adminUsage)
+		return
+	}
+
+	switch args[0] {
+	case "add":
+		if err := w.adminService.AddAdmin(ctx, actor, targetID); err != nil {
+			w.sendAdminError(chatID, actor.AdminID, err)
+			return
+		}
+		w.bot.SendMessage(chatID, fmt.Sprintf("✅ Пользователю %d выданы права администратора.", targetID))
+	case "remove":
+		if err := w.adminService.RemoveAdmin(ctx, actor, targetID); err != nil {
+			w.sendAdminError(chatID, actor.AdminID, err)
+			return
+		}
+		w.bot.SendMessage(chatID, fmt.Sprintf("✅ У пользователя %d отозваны права администратора.", targetID))
+	default:
+		w.bot.SendMessage(chatID, adminUsage)
+	}
+}
+
+// sendAdminPlans отправляет список планов подписки
+func (w *MessageWorker) sendAdminPlans(chatID int64, actor admin.Actor) {
+	plans, err := w.adminService.ListPlans(context.Background(), actor)
+	if err != nil {
+		w.sendAdminError(chatID, actor.AdminID, err)
+		return
+	}
+
+	var sb strings.Builder
+	sb.WriteString("⭐ Планы подписки:\n\n")
+	for _, p := range plans {
+		sb.WriteString(fmt.Sprintf("%s %s - %s, %.0f ₽/мес\n", adminStatusIcon(p.IsActive), p.Code, p.Name, p.GetMonthlyPriceRub()))
+	}
+	w.bot.SendMessage(chatID, sb.String())
+}
+
+// sendAdminPackages отправляет список пакетов нейронов
+func (w *MessageWorker) sendAdminPackages(chatID int64, actor admin.Actor) {
+	packages, err := w.adminService.ListPackages(context.Background(), actor)
+	if err != nil {
+		w.sendAdminError(chatID, actor.AdminID, err)
+		return
+	}
+
+	var sb strings.Builder
+	sb.WriteString("💎 Пакеты нейронов:\n\n")
+	for _, p := range packages {
+		sb.WriteString(fmt.Sprintf("%s #%d %s - %d 💎, %.0f ₽\n", adminStatusIcon(p.IsActive), p.ID, p.Name, p.GetTotalAmount(), p.GetPriceRub()))
+	}
+	w.bot.SendMessage(chatID, sb.String())
+}
+
+// sendAdminModels отправляет список моделей нейросетей
+func (w *MessageWorker) sendAdminModels(chatID int64, actor admin.Actor) {
+	models, err := w.adminService.ListModels(context.Background(), actor)
+	if err != nil {
+		w.sendAdminError(chatID, actor.AdminID, err)
+		return
+	}
+
+	var sb strings.Builder
+	sb.WriteString("🤖 Модели:\n\n")
+	for _, m := range models {
+		sb.WriteString(fmt.Sprintf("%s %s (%s)\n", adminStatusIcon(m.Enabled), m.Name, m.Type))
+	}
+	w.bot.SendMessage(chatID, sb.String())
+}
+
+// sendAdminErrors отправляет последние ошибки сервисов
+func (w *MessageWorker) sendAdminErrors(chatID int64, actor admin.Actor, limit int) {
+	entries, err := w.adminService.RecentErrors(context.Background(), actor, limit)
+	if err != nil {
+		w.sendAdminError(chatID, actor.AdminID, err)
+		return
+	}
+	if len(entries) == 0 {
+		w.bot.SendMessage(chatID, "Ошибок не найдено.")
+		return
+	}
+
+	var sb strings.Builder
+	sb.WriteString("🚨 Последние ошибки:\n")
+	for _, e := range entries {
+		sb.WriteString(fmt.Sprintf("\n%s [%s] %s", e.CreatedAt.Format("02.01 15:04:05"), e.Logger, e.Message))
+		if e.Error != "" {
+			sb.WriteString(": " + clipAdminText(e.Error, adminErrorTextLimit))
+		}
+		sb.WriteString("\n")
+	}
+	w.bot.SendMessage(chatID, clipAdminText(sb.String(), adminMessageLimit))
+}
+
+// sendAdminAudit отправляет последние записи журнала действий
+func (w *MessageWorker) sendAdminAudit(chatID int64, actor admin.Actor, targetID *int64) {
+	entries, err := w.adminService.AuditLog(context.Background(), actor, targetID, adminListLimit)
+	if err != nil {
+		w.sendAdminError(chatID, actor.AdminID, err)
+		return
+	}
+	if len(entries) == 0 {
+		w.bot.SendMessage(chatID, "Журнал действий пуст.")
+		return
+	}
+
+	var sb strings.Builder
+	sb.WriteString("📋 Журнал действий:\n\n")
+	for _, e := range entries {
+		sb.WriteString(fmt.Sprintf("%s %d (%s) %s", e.CreatedAt.Format("02.01 15:04"), e.AdminID, e.Source, e.Action))
+		if e.TargetUserID != nil {
+			sb.WriteString(fmt.Sprintf(" → %d", *e.TargetUserID))
+		}
+		if e.Target != "" {
+			sb.WriteString(" " + e.Target)
+		}
+		if e.Reason != "" {
+			sb.WriteString(": " + e.Reason)
+		}
+		sb.WriteString("\n")
+	}
+	w.bot.SendMessage(chatID, clipAdminText(sb.String(), adminMessageLimit))
+}
+
+// formatAdminUser формирует карточку пользователя
+func formatAdminUser(info *admin.UserInfo) string {
+	var sb strings.Builder
+	u := info.User
+	sb.WriteString(fmt.Sprintf("👤 %s %s", u.FirstName, u.LastName))
+	if u.Username != "" {
+		sb.WriteString(" @" + u.Username)
+	}
+	sb.WriteString(fmt.Sprintf("\nID: %d\nРегистрация: %s\n", u.TelegramID, u.CreatedAt.Format("02.01.2006")))
+	if info.IsAdmin {
+		sb.WriteString("👮 Администратор\n")
+	}
+
+	sb.WriteString(fmt.Sprintf("\n💎 Баланс: %d (заработано %d, потрачено %d)\n",
+		info.Balance.Balance, info.Balance.LifetimeEarned, info.Balance.LifetimeSpent))
+
+	sub := info.Subscription
+	if sub != nil && sub.ID != 0 && sub.Plan != nil && !sub.IsFree() {
+		sb.WriteString(fmt.Sprintf("⭐ Подписка #%d: %s до %s (%s", sub.ID, sub.Plan.Name, sub.EndDate.Format("02.01.2006"), sub.Status))
+		if sub.PaymentMethod != "" {
+			sb.WriteString(", " + sub.PaymentMethod)
+		}
+		if sub.AutoRenew {
+			sb.WriteString(", автопродление")
+		}
+		sb.WriteString(")\n")
+	} else {
+		sb.WriteString("⭐ Бесплатный план\n")
+	}
+
+	if len(info.Transactions) > 0 {
+		sb.WriteString("\nПоследние операции:\n")
+		for _, tx := range info.Transactions {
+			sb.WriteString(fmt.Sprintf("%s %+d (%s) %s\n", tx.CreatedAt.Format("02.01 15:04"), tx.Amount, tx.TransactionType, tx.Description))
+		}
+	}
+	return sb.String()
+}
+
+// clipAdminText обрезает текст до указанного количества символов
+func clipAdminText(text string, limit int) string {
+	runes := []rune(text)
+	if len(runes) <= limit {
+		return text
+	}
+	return string(runes[:limit]) + "…"
+}
+
+// parseAdminSwitch разбирает аргументы вида <объект> on|off
+func parseAdminSwitch(args []string) (bool, bool) {
+	if len(args) < 3 {
+		return false, false
+	}
+	switch args[2] {
+	case "on":
+		return true, true
+	case "off":
+		return false, true
+	default:
+		return false, false
+	}
+}
+
+// adminSwitchText возвращает текст нового состояния
+func adminSwitchText(enabled bool) string {
+	if enabled {
+		return "включен(а)"
+	}
+	return "отключен(а)"
+}
+
+// adminStatusIcon возвращает значок доступности
+func adminStatusIcon(enabled bool) string {
+	if enabled {
+		return "🟢"
+	}
+	return "⚪️"
+}
+
+// sendAdminError отправляет администратору текст ошибки действия
+func (w *MessageWorker) sendAdminError(chatID, adminID int64, err error) {
+	switch {
+	case errors.Is(err, admin.ErrForbidden):
+		w.bot.SendMessage(chatID, "❌ Нет прав администратора.")
+	case errors.Is(err, admin.ErrOwnerOnly):
+		w.bot.SendMessage(chatID, "❌ Управлять администраторами могут только администраторы из конфигурации.")
+	case errors.Is(err, admin.ErrUserNotFound):
+		w.bot.SendMessage(chatID, "❌ Пользователь не найден.")
+	case errors.Is(err, admin.ErrReasonRequired):
+		w.bot.SendMessage(chatID, "❌ Укажите причину корректировки.")
+	case errors.Is(err, admin.ErrInvalidAmount):
+		w.bot.SendMessage(chatID, "❌ Сумма должна быть ненулевым числом, например +100 или -50.")
+	case errors.Is(err, admin.ErrAdjustmentLimit):
+		w.bot.SendMessage(chatID, "❌ Сумма превышает максимальную корректировку за одно действие.")
+	case errors.Is(err, admin.ErrInsufficientBalance):
+		w.bot.SendMessage(chatID, "❌ Списание превышает баланс пользователя.")
+	case errors.Is(err, admin.ErrInvalidDays):
+		w.bot.SendMessage(chatID, "❌ Количество дней должно быть положительным.")
+	case errors.Is(err, admin.ErrNoSubscription):
+		w.bot.SendMessage(chatID, "❌ У пользователя нет платной подписки.")
+	case errors.Is(err, admin.ErrModelNotFound):
+		w.bot.SendMessage(chatID, "❌ Модель не найдена. Список моделей: /admin models")
+	case errors.Is(err, admin.ErrAlreadyAdmin):
+		w.bot.SendMessage(chatID, "❌ Пользователь уже администратор.")
+	case errors.Is(err, admin.ErrNotAdmin):
+		w.bot.SendMessage(chatID, "❌ Пользователь не администратор.")
+	case errors.Is(err, admin.ErrConfigAdmin):
+		w.bot.SendMessage(chatID, "❌ Права администратора из конфигурации нельзя отозвать командой.")
+	case errors.Is(err, subscription.ErrPlanNotFound):
+		w.bot.SendMessage(chatID, "❌ План не найден или отключен. Список планов: /admin plans")
+	case errors.Is(err, subscription.ErrFreePlanRequired):
+		w.bot.SendMessage(chatID, "❌ Бесплатный план нельзя отключить.")
+	case errors.Is(err, currency.ErrPackageNotFound):
+		w.bot.SendMessage(chatID, "❌ Пакет не найден. Список пакетов: /admin packages")
+	default:
+		w.log.Error("Ошибка выполнения команды администратора",
+			zap.Int64("admin_id", adminID),
+			zap.Error(err))
+		w.bot.SendMessage(chatID, fmt.Sprintf("❌ Не удалось выполнить действие: %s", err.Error()))
+	}
+}
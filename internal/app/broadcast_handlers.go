@@ -0,0 +1,242 @@
+// Обработчики рассылок для администраторов
+
+package app
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+
+	"neurobot-prod/internal/admin"
+	"neurobot-prod/internal/broadcast"
+)
+
+// broadcastUsage - справка по команде /broadcast
+const broadcastUsage = "📣 Рассылки\n\n" +
+	"/broadcast new [условия]\n<текст со следующей строки> - создать черновик\n" +
+	"/broadcast estimate [условия] - размер аудитории без отправки\n" +
+	"/broadcast list - последние кампании\n" +
+	"/broadcast show <id> - статистика доставки\n" +
+	"/broadcast preview <id> - прислать текст себе\n" +
+	"/broadcast start <id> - запустить\n" +
+	"/broadcast resume <id> - повторно поставить в очередь неотправленные\n" +
+	"/broadcast cancel <id> - остановить\n\n" +
+	"Условия: plan=free,premium lang=ru,en active=<дней> inactive=<дней> " +
+	"min_balance=<N> max_balance=<N> referral=referred|not_referred|referrer.\n" +
+	"Без условий рассылка уйдет всем, кто не заблокировал бота."
+
+// handleBroadcastCommand обрабатывает команду /broadcast и ее подкоманды
+func (w *MessageWorker) handleBroadcastCommand(message *tgbotapi.Message) {
+	userID := int64(message.From.ID)
+	chatID := message.Chat.ID
+	ctx := context.Background()
+
+	if !w.isAdmin(userID) {
+		w.bot.SendMessage(chatID, "Неизвестная команда. Введите /help для получения списка доступных команд.")
+		return
+	}
+
+	// Первая строка - подкоманда и условия, остальные строки - текст рассылки
+	firstLine, text, _ := strings.Cut(message.CommandArguments(), "\n")
+	args := strings.Fields(firstLine)
+	if len(args) == 0 {
+		w.bot.SendMessage(chatID, broadcastUsage)
+		return
+	}
+
+	actor := admin.Actor{AdminID: userID, Source: admin.SourceTelegram}
+
+	switch args[0] {
+	case "new":
+		segment, err := broadcast.ParseSegment(args[1:])
+		if err != nil {
+			w.sendBroadcastError(chatID, userID, err)
+			return
+		}
+		campaign, err := w.adminService.CreateBroadcast(ctx, actor, "", text, segment)
+		if err != nil {
+			w.sendBroadcastError(chatID, userID, err)
+			return
+		}
+		audience, err := w.adminService.EstimateBroadcast(ctx, actor, segment)
+		if err != nil {
+			w.sendBroadcastError(chatID, userID, err)
+			return
+		}
+		w.bot.SendMessage(chatID, fmt.Sprintf("✅ Черновик #%d создан.\nСегмент: %s\nПолучателей сейчас: %d\n\n"+
+			"Проверьте текст: /broadcast preview %d\nЗапуск: /broadcast start %d",
+			campaign.ID, segment.String(), audience, campaign.ID, campaign.ID))
+
+	case "estimate":
+		segment, err := broadcast.ParseSegment(args[1:])
+		if err != nil {
+			w.sendBroadcastError(chatID, userID, err)
+			return
+		}
+		audience, err := w.adminService.EstimateBroadcast(ctx, actor, segment)
+		if err != nil {
+			w.sendBroadcastError(chatID, userID, err)
+			return
+		}
+		w.bot.SendMessage(chatID, fmt.Sprintf("👥 Сегмент: %s\nПолучателей: %d", segment.String(), audience))
+
+	case "list":
+		w.sendBroadcastList(chatID, actor)
+
+	case "show", "preview", "start", "resume", "cancel":
+		if len(args) < 2 {
+			w.bot.SendMessage(chatID, broadcastUsage)
+			return
+		}
+		id, err := strconv.ParseInt(strings.TrimPrefix(args[1], "#"), 10, 64)
+		if err != nil {
+			w.bot.SendMessage(chatID, broadcastUsage)
+			return
+		}
+		w.handleBroadcastAction(chatID, actor, args[0], id)
+
+	default:
+		w.bot.SendMessage(chatID, broadcastUsage)
+	}
+}
+
+// handleBroadcastAction выполняет действие с кампанией
+func (w *MessageWorker) handleBroadcastAction(chatID int64, actor admin.Actor, action string, id int64) {
+	ctx := context.Background()
+
+	switch action {
+	case "show":
+		campaign, stats, err := w.adminService.GetBroadcast(ctx, actor, id)
+		if err != nil {
+			w.sendBroadcastError(chatID, actor.AdminID, err)
+			return
+		}
+		w.bot.SendMessage(chatID, formatBroadcast(campaign, stats))
+
+	case "preview":
+		if err := w.adminService.PreviewBroadcast(ctx, actor, id); err != nil {
+			w.sendBroadcastError(chatID, actor.AdminID, err)
+			return
+		}
+		w.bot.SendMessage(chatID, fmt.Sprintf("👆 Так сообщение увидят получатели. Запуск: /broadcast start %d", id))
+
+	case "start":
+		campaign, err := w.adminService.StartBroadcast(ctx, actor, id)
+		if err != nil {
+			w.sendBroadcastError(chatID, actor.AdminID, err)
+			return
+		}
+		w.bot.SendMessage(chatID, fmt.Sprintf("🚀 Рассылка #%d запущена, получателей: %d.\nСтатистика: /broadcast show %d",
+			campaign.ID, campaign.TotalRecipients, campaign.ID))
+
+	case "resume":
+		queued, err := w.adminService.ResumeBroadcast(ctx, actor, id)
+		if err != nil {
+			w.sendBroadcastError(chatID, actor.AdminID, err)
+			return
+		}
+		w.bot.SendMessage(chatID, fmt.Sprintf("🔁 Рассылка #%d: в очередь поставлено %d сообщений.", id, queued))
+
+	case "cancel":
+		if err := w.adminService.CancelBroadcast(ctx, actor, id); err != nil {
+			w.sendBroadcastError(chatID, actor.AdminID, err)
+			return
+		}
+		w.bot.SendMessage(chatID, fmt.Sprintf("⏹ Рассылка #%d остановлена.", id))
+	}
+}
+
+// sendBroadcastList отправляет список последних кампаний
+func (w *MessageWorker) sendBroadcastList(chatID int64, actor admin.Actor) {
+	campaigns, err := w.adminService.ListBroadcasts(context.Background(), actor, adminListLimit)
+	if err != nil {
+		w.sendBroadcastError(chatID, actor.AdminID, err)
+		return
+	}
+	if len(campaigns) == 0 {
+		w.bot.SendMessage(chatID, "Рассылок пока нет.")
+		return
+	}
+
+	var sb strings.Builder
+	sb.WriteString("📣 Последние рассылки:\n\n")
+	for _, c := range campaigns {
+		sb.WriteString(fmt.Sprintf("#%d %s %s - %s\n", c.ID, c.CreatedAt.Format("02.01 15:04"), broadcastStatusText(c.Status), c.Title))
+	}
+	w.bot.SendMessage(chatID, clipAdminText(sb.String(), adminMessageLimit))
+}
+
+// formatBroadcast формирует карточку кампании со статистикой доставки
+func formatBroadcast(c *broadcast.Campaign, stats *broadcast.Stats) string {
+	var sb strings.Builder
+	sb.WriteString(fmt.Sprintf("📣 Рассылка #%d: %s\n", c.ID, c.Title))
+	sb.WriteString(fmt.Sprintf("Статус: %s\n", broadcastStatusText(c.Status)))
+	sb.WriteString(fmt.Sprintf("Сегмент: %s\n", c.Segment.String()))
+	sb.WriteString(fmt.Sprintf("Создана: %s администратором %d\n", c.CreatedAt.Format("02.01.2006 15:04"), c.CreatedBy))
+	if c.StartedAt != nil {
+		sb.WriteString(fmt.Sprintf("Запущена: %s\n", c.StartedAt.Format("02.01.2006 15:04")))
+	}
+	if c.FinishedAt != nil {
+		sb.WriteString(fmt.Sprintf("Завершена: %s\n", c.FinishedAt.Format("02.01.2006 15:04")))
+	}
+
+	if stats.Total() > 0 {
+		sb.WriteString(fmt.Sprintf("\nПолучателей: %d\n", stats.Total()))
+		sb.WriteString(fmt.Sprintf("✅ Доставлено: %d\n", stats.Sent))
+		sb.WriteString(fmt.Sprintf("⏳ В очереди: %d\n", stats.Pending))
+		sb.WriteString(fmt.Sprintf("🚫 Заблокировали бота: %d\n", stats.Blocked))
+		sb.WriteString(fmt.Sprintf("❌ Ошибки: %d\n", stats.Failed))
+		if stats.Skipped > 0 {
+			sb.WriteString(fmt.Sprintf("⏹ Пропущено: %d\n", stats.Skipped))
+		}
+	}
+
+	sb.WriteString("\n" + clipAdminText(c.Text, adminErrorTextLimit))
+	return sb.String()
+}
+
+// broadcastStatusText возвращает статус кампании для отображения
+func broadcastStatusText(status broadcast.Status) string {
+	switch status {
+	case broadcast.StatusDraft:
+		return "📝 черновик"
+	case broadcast.StatusRunning:
+		return "🚀 идет отправка"
+	case broadcast.StatusCompleted:
+		return "✅ завершена"
+	case broadcast.StatusCancelled:
+		return "⏹ отменена"
+	default:
+		return string(status)
+	}
+}
+
+// sendBroadcastError отправляет администратору текст ошибки действия с рассылкой
+func (w *MessageWorker) sendBroadcastError(chatID, adminID int64, err error) {
+	switch {
+	case errors.Is(err, broadcast.ErrInvalidSegment):
+		w.bot.SendMessage(chatID, fmt.Sprintf("❌ %s\n\n%s", err.Error(), broadcastUsage))
+	case errors.Is(err, broadcast.ErrEmptyText):
+		w.bot.SendMessage(chatID, "❌ Напишите текст рассылки со следующей строки после условий.")
+	case errors.Is(err, broadcast.ErrTextTooLong):
+		w.bot.SendMessage(chatID, "❌ Текст не помещается в одно сообщение Telegram (4096 символов).")
+	case errors.Is(err, broadcast.ErrCampaignNotFound):
+		w.bot.SendMessage(chatID, "❌ Рассылка не найдена. Список: /broadcast list")
+	case errors.Is(err, broadcast.ErrNotDraft):
+		w.bot.SendMessage(chatID, "❌ Рассылка уже запущена или завершена.")
+	case errors.Is(err, broadcast.ErrNotRunning):
+		w.bot.SendMessage(chatID, "❌ Рассылка не идет, возобновлять нечего.")
+	case errors.Is(err, broadcast.ErrFinished):
+		w.bot.SendMessage(chatID, "❌ Рассылка уже завершена.")
+	case errors.Is(err, broadcast.ErrEmptyAudience):
+		w.bot.SendMessage(chatID, "❌ В сегмент не попал ни один пользователь.")
+	case errors.Is(err, admin.ErrBroadcastUnavailable):
+		w.bot.SendMessage(chatID, "❌ Рассылки недоступны.")
+	default:
+		w.sendAdminError(chatID, adminID, err)
+	}
+}
@@ -0,0 +1,317 @@
+package app
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+	"go.uber.org/zap"
+
+	"neurobot-prod/internal/currency"
+	"neurobot-prod/internal/llm"
+	"neurobot-prod/internal/telegram"
+)
+
+// compareConfirmTTL - время, в течение которого можно подтвердить сравнение
+const compareConfirmTTL = 10 * time.Minute
+
+// pendingCompare представляет сравнение, ожидающее подтверждения пользователя
+type pendingCompare struct {
+	Prompt    string   `json:"prompt"`
+	Models    []string `json:"models"`
+	TotalCost int      `json:"total_cost"`
+	CreatedAt int64    `json:"created_at"` // Время создания в наносекундах, входит в ключ идемпотентности
+}
+
+// pendingCompareKey возвращает ключ Redis для ожидающего подтверждения сравнения
+func pendingCompareKey(userID int64) string {
+	return fmt.Sprintf("compare:pending:%d", userID)
+}
+
+// handleCompareCommand обрабатывает команду /compare
+func (w *MessageWorker) handleCompareCommand(message *tgbotapi.Message) {
+	userID := int64(message.From.ID)
+	chatID := message.Chat.ID
+	prompt := strings.TrimSpace(message.CommandArguments())
+	ctx := context.Background()
+
+	plan, err := w.subService.GetSubscriptionPlan(ctx, userID)
+	if err != nil {
+		w.log.Error("Ошибка получения плана подписки",
+			zap.Int64("user_id", userID),
+			zap.Error(err))
+		w.bot.SendMessage(chatID, "Произошла ошибка при проверке подписки. Попробуйте позже.")
+		return
+	}
+
+	maxModels := plan.GetMaxCompareModels()
+	if maxModels < 2 {
+		w.bot.SendMessage(chatID, "Режим сравнения моделей доступен в подписке Pro. Подробнее: /subscribe")
+		return
+	}
+
+	if prompt == "" {
+		w.bot.SendMessage(chatID, "Использование: /compare <запрос>\n\n"+
+			"Запрос будет отправлен одновременно нескольким моделям, и вы сможете сравнить их ответы.")
+		return
+	}
+
+	if plan.MaxRequestLength > 0 && len([]rune(prompt)) > plan.MaxRequestLength {
+		w.bot.SendMessage(chatID, fmt.Sprintf("❌ Слишком длинный запрос! Максимальная длина: %d символов.", plan.MaxRequestLength))
+		return
+	}
+
+	models, err := w.llmService.SelectCompareModels(ctx, userID, maxModels)
+	if err != nil {
+		w.log.Error("Ошибка выбора моделей для сравнения",
+			zap.Int64("user_id", userID),
+			zap.Error(err))
+		w.bot.SendMessage(chatID, "Произошла ошибка при определении доступных моделей. Попробуйте позже.")
+		return
+	}
+	if len(models) < 2 {
+		w.bot.SendMessage(chatID, "Для сравнения нужно минимум две доступные модели.")
+		return
+	}
+
+	totalCost, err := w.llmService.EstimateCompareCost(ctx, userID, models)
+	if err != nil {
+		w.bot.SendMessage(chatID, "Произошла ошибка при расчете стоимости. Попробуйте позже.")
+		return
+	}
+
+	pending := pendingCompare{Prompt: prompt, TotalCost: totalCost, CreatedAt: time.Now().UnixNano()}
+	var names []string
+	for _, model := range models {
+		pending.Models = append(pending.Models, model.Name)
+		names = append(names, "• "+model.DisplayName)
+	}
+
+	data, err := json.Marshal(pending)
+	if err != nil {
+		w.bot.SendMessage(chatID, "Произошла ошибка. Попробуйте позже.")
+		return
+	}
+	if err := w.redis.Set(ctx, pendingCompareKey(userID), data, compareConfirmTTL).Err(); err != nil {
+		w.log.Error("Ошибка сохранения сравнения",
+			zap.Int64("user_id", userID),
+			zap.Error(err))
+		w.bot.SendMessage(chatID, "Произошла ошибка. Попробуйте позже.")
+		return
+	}
+
+	keyboard := tgbotapi.NewInlineKeyboardMarkup(
+		tgbotapi.NewInlineKeyboardRow(
+			tgbotapi.NewInlineKeyboardButtonData(fmt.Sprintf("✅ Сравнить за %d нейронов", totalCost), "compare:confirm"),
+			tgbotapi.NewInlineKeyboardButtonData("❌ Отмена", "compare:cancel"),
+		),
+	)
+
+	w.bot.SendMessage(chatID, fmt.Sprintf(
+		"⚖️ Запрос будет отправлен моделям:\n%s\n\n💰 Итоговая стоимость: %d нейронов (сумма стоимости запросов к каждой модели).\n\nПодтвердите сравнение.",
+		strings.Join(names, "\n"), totalCost),
+		telegram.WithReplyMarkup(keyboard))
+}
+
+// handleCompareCallback обрабатывает подтверждение или отмену сравнения
+func (w *MessageWorker) handleCompareCallback(callback *tgbotapi.CallbackQuery, parts []string) {
+	userID := int64(callback.From.ID)
+	chatID := callback.Message.Chat.ID
+	ctx := context.Background()
+
+	// Получаем и удаляем ожидающее сравнение, чтобы повторное нажатие не запустило его дважды
+	data, err := w.redis.GetDel(ctx, pendingCompareKey(userID)).Bytes()
+	if err != nil {
+		w.bot.SendMessage(chatID, "Сравнение не найдено или устарело. Отправьте /compare еще раз.")
+		return
+	}
+
+	if parts[1] != "confirm" {
+		w.bot.SendMessage(chatID, "Сравнение отменено.")
+		return
+	}
+
+	var pending pendingCompare
+	if err := json.Unmarshal(data, &pending); err != nil || pending.CreatedAt == 0 {
+		w.log.Error("Ошибка разбора сравнения",
+			zap.Int64("user_id", userID),
+			zap.Error(err))
+		w.bot.SendMessage(chatID, "Произошла ошибка. Отправьте /compare еще раз.")
+		return
+	}
+
+	// Повторно проверяем доступ к моделям: подписка могла измениться после показа стоимости
+	available, err := w.llmService.GetAvailableModels(ctx, userID)
+	if err != nil {
+		w.bot.SendMessage(chatID, "Произошла ошибка при определении доступных моделей. Попробуйте позже.")
+		return
+	}
+	var models []llm.ModelConfig
+	for _, name := range pending.Models {
+		for _, model := range available {
+			if model.Name == name {
+				models = append(models, model)
+				break
+			}
+		}
+	}
+	if len(models) == 0 {
+		w.bot.SendMessage(chatID, "Выбранные модели больше недоступны.")
+		return
+	}
+
+	costs, err := w.llmService.CompareModelCosts(ctx, userID, models)
+	if err != nil {
+		w.bot.SendMessage(chatID, "Произошла ошибка при расчете стоимости. Попробуйте позже.")
+		return
+	}
+	totalCost := 0
+	var names []string
+	for i, model := range models {
+		totalCost += costs[i]
+		names = append(names, model.Name)
+	}
+
+	balance, err := w.currencyService.GetSpendingBalance(ctx, userID)
+	if err != nil {
+		w.bot.SendMessage(chatID, "Произошла ошибка при проверке баланса нейронов. Попробуйте позже.")
+		return
+	}
+	if balance.Balance < totalCost {
+		w.bot.SendMessage(chatID, fmt.Sprintf(
+			"❌ Недостаточно нейронов для сравнения!\n\nСтоимость: %d нейронов\nВаш баланс: %d нейронов",
+			totalCost, balance.Balance))
+		return
+	}
+
+	// Списываем стоимость всех моделей одной транзакцией до отправки запросов, чтобы
+	// параллельные запросы не ушли в минус; доли не ответивших моделей возвращаются
+	var reservationID int64
+	if totalCost > 0 {
+		reservation, err := w.currencyService.ReserveUsage(ctx, userID, totalCost,
+			fmt.Sprintf("Сравнение моделей (%d нейронов)", totalCost),
+			currency.Metadata{"kind": "compare", "models": names},
+			fmt.Sprintf("compare:%d:%d", userID, pending.CreatedAt))
+		if err != nil {
+			w.log.Error("Ошибка резервирования нейронов для сравнения",
+				zap.Int64("user_id", userID),
+				zap.Int("cost", totalCost),
+				zap.Error(err))
+			w.bot.SendMessage(chatID, "Не удалось списать нейроны за сравнение. Проверьте баланс и попробуйте еще раз.")
+			return
+		}
+		reservationID = reservation.ID
+	}
+
+	w.bot.SendMessage(chatID, "⏳ Отправляю запрос моделям...")
+
+	request := &llm.Request{
+		UserID:      userID,
+		UserMessage: pending.Prompt,
+		PrepaidBy:   reservationID,
+	}
+
+	// Персона диалога применяется ко всем моделям одинаково
+	if conv, err := w.conversationService.GetActiveConversation(ctx, userID); err == nil {
+		request.SystemPrompt = conv.GetSystemPrompt()
+	}
+
+	results := w.llmService.Compare(ctx, request, models)
+
+	spent := totalCost
+	succeeded := 0
+	for i, result := range results {
+		if result.Err != nil {
+			text := fmt.Sprintf("🤖 %s\n\n❌ Не удалось получить ответ.", result.Model.DisplayName)
+			if w.refundCompareShare(userID, reservationID, result.Model.Name, costs[i], compareRefundReason(result.Err)) {
+				spent -= costs[i]
+				text += " Нейроны за эту модель возвращены."
+			}
+			w.bot.SendMessage(chatID, text)
+			continue
+		}
+
+		// Ответ из кэша бесплатен, как и в обычном режиме: доля модели возвращается из резерва
+		cost := costs[i]
+		if result.Response.Cached &&
+			w.refundCompareShare(userID, reservationID, result.Model.Name, costs[i], currency.RefundCachedResponse) {
+			spent -= costs[i]
+			cost = 0
+		}
+
+		costLine := fmt.Sprintf("💰 Стоимость: %d нейронов", cost)
+		if result.Response.Cached && cost == 0 {
+			costLine = "💰 Ответ из кэша, нейроны не списаны"
+		}
+		text := fmt.Sprintf("🤖 %s\n\n%s\n\n---\n%s",
+			result.Model.DisplayName,
+			truncateText(result.Response.ResponseText, 3800),
+			costLine)
+		if _, err := w.bot.SendMessage(chatID, text); err != nil {
+			w.log.Error("Ошибка доставки ответа модели в режиме сравнения",
+				zap.Int64("user_id", userID),
+				zap.String("model_name", result.Model.Name),
+				zap.Error(err))
+			if cost > 0 && w.refundCompareShare(userID, reservationID, result.Model.Name, cost, currency.RefundDeliveryFailed) {
+				spent -= cost
+				w.bot.SendMessage(chatID, fmt.Sprintf("🤖 %s\n\n❌ Не удалось отправить ответ. Нейроны за эту модель возвращены.", result.Model.DisplayName))
+				continue
+			}
+		}
+
+		succeeded++
+		if !result.Response.Cached {
+			w.awardRequestXP(userID, result.Model.Name)
+		}
+	}
+
+	if spent > 0 {
+		w.trackReferralActivity(userID)
+	}
+
+	w.bot.SendMessage(chatID, fmt.Sprintf("⚖️ Сравнение завершено: ответили %d из %d моделей.\n💰 Списано: %d нейронов",
+		succeeded, len(results), spent))
+}
+
+// compareRefundReason возвращает причину возврата доли модели, не ответившей в режиме сравнения
+func compareRefundReason(err error) currency.RefundReason {
+	switch {
+	case errors.Is(err, llm.ErrEmptyResponse):
+		return currency.RefundEmptyResponse
+	case errors.Is(err, llm.ErrResponseBlocked):
+		return currency.RefundSafetyBlocked
+	default:
+		return currency.RefundRequestFailed
+	}
+}
+
+// refundCompareShare возвращает долю модели из резерва сравнения. Возвращает true, если нейроны возвращены
+func (w *MessageWorker) refundCompareShare(userID, reservationID int64, modelName string, cost int, reason currency.RefundReason) bool {
+	if reservationID == 0 || cost <= 0 {
+		return false
+	}
+
+	if _, err := w.currencyService.RefundPart(context.Background(), reservationID, cost, modelName, reason); err != nil {
+		w.log.Error("Ошибка возврата нейронов за модель в режиме сравнения",
+			zap.Int64("user_id", userID),
+			zap.Int64("transaction_id", reservationID),
+			zap.String("model_name", modelName),
+			zap.Error(err))
+		return false
+	}
+
+	return true
+}
+
+// truncateText обрезает текст до указанного количества символов
+func truncateText(text string, limit int) string {
+	runes := []rune(text)
+	if len(runes) <= limit {
+		return text
+	}
+	return string(runes[:limit]) + "...\n\n(Ответ был слишком длинным и был обрезан)"
+}
@@ -0,0 +1,193 @@
+// Обработчики подарков нейронов
+
+package app
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+	"go.uber.org/zap"
+
+	"neurobot-prod/internal/currency"
+	"neurobot-prod/internal/gift"
+	"neurobot-prod/internal/telegram"
+)
+
+// giftConfirmTTL - время, в течение которого можно подтвердить подарок
+const giftConfirmTTL = 10 * time.Minute
+
+// pendingGift представляет подарок, ожидающий подтверждения отправителя
+type pendingGift struct {
+	RecipientID   int64  `json:"recipient_id"`
+	RecipientName string `json:"recipient_name"`
+	Amount        int    `json:"amount"`
+	Comment       string `json:"comment,omitempty"`
+	Source        string `json:"source"`
+	CreatedAt     int64  `json:"created_at"` // Время создания в наносекундах, входит в ключ идемпотентности
+}
+
+// pendingGiftKey возвращает ключ Redis для ожидающего подтверждения подарка
+func pendingGiftKey(userID int64) string {
+	return fmt.Sprintf("gift:pending:%d", userID)
+}
+
+// handleGiftCommand обрабатывает команду /gift @username количество [комментарий]
+func (w *MessageWorker) handleGiftCommand(message *tgbotapi.Message) {
+	userID := int64(message.From.ID)
+	chatID := message.Chat.ID
+
+	args := strings.Fields(message.CommandArguments())
+	if len(args) < 2 {
+		w.sendGiftUsage(chatID, userID)
+		return
+	}
+
+	amount, err := strconv.Atoi(args[1])
+	if err != nil || amount <= 0 {
+		w.sendGiftUsage(chatID, userID)
+		return
+	}
+
+	w.startGift(chatID, userID, args[0], amount, strings.Join(args[2:], " "), gift.SourceCommand)
+}
+
+// sendGiftUsage отправляет справку по подаркам с лимитами пользователя
+func (w *MessageWorker) sendGiftUsage(chatID, userID int64) {
+	cfg := w.giftService.GetConfig()
+	text := "🎁 Подарок нейронов\n\n" +
+		"Использование: /gift @username количество [комментарий]\n" +
+		"Пример: /gift @friend 100 С днем рождения!\n\n" +
+		"Подарить можно только купленные нейроны. Бонусные и полученные в подарок нейроны не передаются, " +
+		"а подаренные нейроны сохраняют срок действия."
+
+	dailyLimit, sentToday, transferable, err := w.giftService.Limits(context.Background(), userID)
+	if err == nil {
+		text += fmt.Sprintf("\n\n💰 Доступно для подарка: %d нейронов", transferable)
+		if dailyLimit > 0 {
+			text += fmt.Sprintf("\n📅 Суточный лимит: %d нейронов (подарено: %d)", dailyLimit, sentToday)
+		} else {
+			text += "\n📅 В вашем плане подарки недоступны. Подробнее: /subscribe"
+		}
+		if cfg.MaxPerDay > 0 {
+			text += fmt.Sprintf("\n🔢 Не более %d подарков в сутки", cfg.MaxPerDay)
+		}
+	}
+
+	w.bot.SendMessage(chatID, text)
+}
+
+// startGift проверяет подарок и просит отправителя подтвердить его
+func (w *MessageWorker) startGift(chatID, userID int64, recipient string, amount int, comment, source string) {
+	ctx := context.Background()
+
+	preview, err := w.giftService.Preview(ctx, userID, recipient, amount)
+	if err != nil {
+		w.bot.SendMessage(chatID, giftErrorText(err, w.giftService.GetConfig().MinAmount))
+		return
+	}
+
+	pending := pendingGift{
+		RecipientID:   preview.Recipient.TelegramID,
+		RecipientName: "@" + preview.Recipient.Username,
+		Amount:        amount,
+		Comment:       comment,
+		Source:        source,
+		CreatedAt:     time.Now().UnixNano(),
+	}
+
+	data, err := json.Marshal(pending)
+	if err != nil {
+		w.bot.SendMessage(chatID, "Произошла ошибка. Попробуйте позже.")
+		return
+	}
+	if err := w.redis.Set(ctx, pendingGiftKey(userID), data, giftConfirmTTL).Err(); err != nil {
+		w.log.Error("Ошибка сохранения подарка",
+			zap.Int64("user_id", userID),
+			zap.Error(err))
+		w.bot.SendMessage(chatID, "Произошла ошибка. Попробуйте позже.")
+		return
+	}
+
+	keyboard := tgbotapi.NewInlineKeyboardMarkup(
+		tgbotapi.NewInlineKeyboardRow(
+			tgbotapi.NewInlineKeyboardButtonData(fmt.Sprintf("🎁 Подарить %d", amount), "gift:confirm"),
+			tgbotapi.NewInlineKeyboardButtonData("❌ Отмена", "gift:cancel"),
+		),
+	)
+
+	text := fmt.Sprintf("🎁 Подарить %d нейронов пользователю %s?\n\n💰 Доступно для подарка: %d нейронов\n📅 Подарено за сутки: %d из %d",
+		amount, pending.RecipientName, preview.Transferable, preview.SentToday, preview.DailyLimit)
+	if comment != "" {
+		text += "\n💬 " + comment
+	}
+
+	w.bot.SendMessage(chatID, text, telegram.WithReplyMarkup(keyboard))
+}
+
+// handleGiftCallback обрабатывает подтверждение или отмену подарка
+func (w *MessageWorker) handleGiftCallback(callback *tgbotapi.CallbackQuery, parts []string) {
+	userID := int64(callback.From.ID)
+	chatID := callback.Message.Chat.ID
+	ctx := context.Background()
+
+	// Получаем и удаляем ожидающий подарок, чтобы повторное нажатие не отправило его дважды
+	data, err := w.redis.GetDel(ctx, pendingGiftKey(userID)).Bytes()
+	if err != nil {
+		w.bot.SendMessage(chatID, "Подарок не найден или устарел. Отправьте /gift еще раз.")
+		return
+	}
+
+	if parts[1] != "confirm" {
+		w.bot.SendMessage(chatID, "Подарок отменен.")
+		return
+	}
+
+	var pending pendingGift
+	if err := json.Unmarshal(data, &pending); err != nil {
+		w.log.Error("Ошибка разбора подарка",
+			zap.Int64("user_id", userID),
+			zap.Error(err))
+		w.bot.SendMessage(chatID, "Произошла ошибка. Отправьте /gift еще раз.")
+		return
+	}
+
+	key := fmt.Sprintf("gift:%d:%d", userID, pending.CreatedAt)
+	transfer, err := w.giftService.Send(ctx, userID, pending.RecipientID, pending.Amount, pending.Comment, pending.Source, key)
+	if err != nil {
+		w.bot.SendMessage(chatID, giftErrorText(err, w.giftService.GetConfig().MinAmount))
+		return
+	}
+
+	w.bot.SendMessage(chatID, fmt.Sprintf("✅ Вы подарили %d нейронов пользователю %s.\n💰 Ваш баланс: %d нейронов",
+		pending.Amount, pending.RecipientName, transfer.Debit.BalanceAfter))
+}
+
+// giftErrorText возвращает текст для пользователя по ошибке подарка
+func giftErrorText(err error, minAmount int) string {
+	switch {
+	case errors.Is(err, gift.ErrDisabled):
+		return "Подарки нейронов временно недоступны."
+	case errors.Is(err, gift.ErrRecipientNotFound):
+		return "❌ Пользователь не найден. Получатель должен хотя бы раз запустить бота и иметь юзернейм в Telegram."
+	case errors.Is(err, gift.ErrInvalidRecipient):
+		return "❌ Этому пользователю нельзя подарить нейроны."
+	case errors.Is(err, gift.ErrAmountTooSmall):
+		return fmt.Sprintf("❌ Минимальный подарок: %d нейронов.", minAmount)
+	case errors.Is(err, gift.ErrAccountTooNew):
+		return "❌ Дарить нейроны можно через несколько дней после регистрации."
+	case errors.Is(err, gift.ErrNotAvailableOnPlan):
+		return "❌ В вашем плане подарки недоступны. Подробнее: /subscribe"
+	case errors.Is(err, currency.ErrTransferLimit):
+		return "❌ Превышен суточный лимит подарков. Попробуйте завтра."
+	case errors.Is(err, currency.ErrNotTransferable):
+		return "❌ Недостаточно нейронов для подарка. Подарить можно только купленные нейроны, бонусные и подаренные вам нейроны не передаются."
+	default:
+		return "Произошла ошибка при отправке подарка. Попробуйте позже."
+	}
+}
@@ -0,0 +1,211 @@
+// Обработчики истории транзакций и статистики использования
+
+package app
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+	"go.uber.org/zap"
+
+	"neurobot-prod/internal/currency"
+	"neurobot-prod/internal/telegram"
+)
+
+// historyPageSize - количество транзакций на странице истории
+const historyPageSize = 10
+
+// historyExportCooldown - минимальный интервал между выгрузками выписки
+const historyExportCooldown = time.Minute
+
+// transactionTypeNames содержит названия типов транзакций для пользователя
+var transactionTypeNames = map[currency.TransactionType]string{
+	currency.TypeDaily:        "Ежедневные",
+	currency.TypePurchase:     "Покупка",
+	currency.TypeUsage:        "Запрос",
+	currency.TypeReferral:     "Рефералы",
+	currency.TypeBonus:        "Бонус",
+	currency.TypeSubscription: "Подписка",
+	currency.TypeAdmin:        "Начисление",
+	currency.TypePromocode:    "Промокод",
+	currency.TypeAchievement:  "Достижение",
+	currency.TypeStreakFreeze: "Заморозка",
+	currency.TypeExpiry:       "Сгорание",
+	currency.TypeRefund:       "Возврат",
+	currency.TypeTransfer:     "Подарок",
+}
+
+// handleHistoryCommand обрабатывает команду /history [month | export csv|json]
+func (w *MessageWorker) handleHistoryCommand(message *tgbotapi.Message) {
+	userID := int64(message.From.ID)
+	chatID := message.Chat.ID
+
+	args := strings.Fields(strings.ToLower(message.CommandArguments()))
+	switch {
+	case len(args) > 0 && args[0] == "month":
+		w.sendMonthlySummary(chatID, userID)
+	case len(args) > 0 && args[0] == "export":
+		format := currency.ExportCSV
+		if len(args) > 1 {
+			format = currency.ExportFormat(args[1])
+		}
+		w.sendStatement(chatID, userID, format)
+	default:
+		text, keyboard, err := w.renderHistoryPage(userID, 0)
+		if err != nil {
+			w.bot.SendMessage(chatID, "Произошла ошибка при получении истории. Попробуйте позже.")
+			return
+		}
+		w.bot.SendMessage(chatID, text, telegram.WithReplyMarkup(keyboard))
+	}
+}
+
+// handleHistoryCallback обрабатывает навигацию по истории, месячную сводку и выгрузку
+func (w *MessageWorker) handleHistoryCallback(callback *tgbotapi.CallbackQuery, parts []string) {
+	userID := int64(callback.From.ID)
+	chatID := callback.Message.Chat.ID
+
+	switch parts[1] {
+	case "page":
+		if len(parts) < 3 {
+			return
+		}
+		page, err := strconv.Atoi(parts[2])
+		if err != nil {
+			return
+		}
+		text, keyboard, err := w.renderHistoryPage(userID, page)
+		if err != nil {
+			w.bot.SendMessage(chatID, "Произошла ошибка при получении истории. Попробуйте позже.")
+			return
+		}
+		// Страница открывается в том же сообщении, чтобы не засорять чат
+		edit := tgbotapi.NewEditMessageTextAndMarkup(chatID, callback.Message.MessageID, text, keyboard)
+		if _, err := w.api.Send(edit); err != nil {
+			w.log.Debug("Не удалось обновить страницу истории",
+				zap.Int64("user_id", userID),
+				zap.Error(err))
+		}
+	case "month":
+		w.sendMonthlySummary(chatID, userID)
+	case "export":
+		if len(parts) < 3 {
+			return
+		}
+		w.sendStatement(chatID, userID, currency.ExportFormat(parts[2]))
+	}
+}
+
+// renderHistoryPage формирует текст и клавиатуру страницы истории транзакций
+func (w *MessageWorker) renderHistoryPage(userID int64, page int) (string, tgbotapi.InlineKeyboardMarkup, error) {
+	result, err := w.currencyService.GetTransactionPage(context.Background(), userID, page, historyPageSize)
+	if err != nil {
+		return "", tgbotapi.InlineKeyboardMarkup{}, err
+	}
+
+	var sb strings.Builder
+	sb.WriteString(fmt.Sprintf("📜 История операций (стр. %d из %d)\n\n", result.Page+1, result.PageCount()))
+	if len(result.Transactions) == 0 {
+		sb.WriteString("Операций пока нет.")
+	}
+	for _, tx := range result.Transactions {
+		name, ok := transactionTypeNames[tx.TransactionType]
+		if !ok {
+			name = string(tx.TransactionType)
+		}
+		sb.WriteString(fmt.Sprintf("%s %+d · %s\n", tx.CreatedAt.Format("02.01 15:04"), tx.Amount, name))
+		if tx.Description != "" {
+			sb.WriteString("   " + tx.Description + "\n")
+		}
+		sb.WriteString(fmt.Sprintf("   Баланс: %d\n", tx.BalanceAfter))
+	}
+
+	var rows [][]tgbotapi.InlineKeyboardButton
+	var nav []tgbotapi.InlineKeyboardButton
+	if result.HasPrev() {
+		nav = append(nav, tgbotapi.NewInlineKeyboardButtonData("⬅️ Новее", fmt.Sprintf("hist:page:%d", result.Page-1)))
+	}
+	if result.HasNext() {
+		nav = append(nav, tgbotapi.NewInlineKeyboardButtonData("Старше ➡️", fmt.Sprintf("hist:page:%d", result.Page+1)))
+	}
+	if len(nav) > 0 {
+		rows = append(rows, nav)
+	}
+	rows = append(rows,
+		tgbotapi.NewInlineKeyboardRow(
+			tgbotapi.NewInlineKeyboardButtonData("📊 Итоги месяца", "hist:month"),
+		),
+		tgbotapi.NewInlineKeyboardRow(
+			tgbotapi.NewInlineKeyboardButtonData("📄 CSV", "hist:export:csv"),
+			tgbotapi.NewInlineKeyboardButtonData("📄 JSON", "hist:export:json"),
+		),
+	)
+
+	return sb.String(), tgbotapi.NewInlineKeyboardMarkup(rows...), nil
+}
+
+// sendMonthlySummary отправляет итоги текущего месяца: расход по моделям, токены и самую популярную модель
+func (w *MessageWorker) sendMonthlySummary(chatID, userID int64) {
+	summary, err := w.currencyService.GetMonthlySummary(context.Background(), userID, time.Now())
+	if err != nil {
+		w.bot.SendMessage(chatID, "Произошла ошибка при получении статистики. Попробуйте позже.")
+		return
+	}
+
+	var sb strings.Builder
+	sb.WriteString(fmt.Sprintf("📊 Итоги за %s\n\n", summary.From.Format("01.2006")))
+	sb.WriteString(fmt.Sprintf("➕ Начислено: %d нейронов\n", summary.Earned))
+	sb.WriteString(fmt.Sprintf("➖ Потрачено: %d нейронов\n", summary.Spent))
+
+	if top := summary.TopModel(); top != nil {
+		sb.WriteString(fmt.Sprintf("🔤 Токенов: %d\n", summary.TotalTokens()))
+		sb.WriteString(fmt.Sprintf("⭐ Любимая модель: %s\n\n", top.ModelName))
+		sb.WriteString("Расход по моделям:\n")
+		for _, u := range summary.Models {
+			sb.WriteString(fmt.Sprintf("• %s: %d нейронов, запросов: %d, токенов: %d\n",
+				u.ModelName, u.NeuronsCost, u.Requests, u.TotalTokens()))
+		}
+	} else {
+		sb.WriteString("\nВ этом месяце запросов к нейросетям еще не было.")
+	}
+
+	w.bot.SendMessage(chatID, sb.String())
+}
+
+// sendStatement выгружает выписку пользователя по нейронам и отправляет ее документом
+func (w *MessageWorker) sendStatement(chatID, userID int64, format currency.ExportFormat) {
+	ctx := context.Background()
+
+	// Выгрузка читает всю историю, поэтому ограничиваем частоту запросов
+	ok, err := w.redis.SetNX(ctx, fmt.Sprintf("history:export:%d", userID), 1, historyExportCooldown).Result()
+	if err == nil && !ok {
+		w.bot.SendMessage(chatID, "⏳ Выписку можно запрашивать не чаще раза в минуту.")
+		return
+	}
+
+	data, err := w.currencyService.ExportStatement(ctx, userID, format)
+	if err != nil {
+		if errors.Is(err, currency.ErrUnknownExportFormat) {
+			w.bot.SendMessage(chatID, "Использование: /history export csv или /history export json")
+			return
+		}
+		w.bot.SendMessage(chatID, "Произошла ошибка при формировании выписки. Попробуйте позже.")
+		return
+	}
+
+	file := tgbotapi.FileBytes{
+		Name:  fmt.Sprintf("neurons_%d_%s.%s", userID, time.Now().Format("20060102"), format),
+		Bytes: data,
+	}
+	if _, err := w.bot.SendDocument(chatID, file, "📄 Выписка по нейронам"); err != nil {
+		w.log.Error("Ошибка отправки выписки",
+			zap.Int64("user_id", userID),
+			zap.Error(err))
+		w.bot.SendMessage(chatID, "Не удалось отправить выписку. Попробуйте позже.")
+	}
+}
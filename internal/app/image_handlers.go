@@ -0,0 +1,96 @@
+package app
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+	"go.uber.org/zap"
+
+	"neurobot-prod/internal/llm"
+)
+
+// handleImagineCommand обрабатывает команду /imagine
+func (w *MessageWorker) handleImagineCommand(message *tgbotapi.Message) {
+	userID := int64(message.From.ID)
+	chatID := message.Chat.ID
+	args := strings.TrimSpace(message.CommandArguments())
+
+	model, err := w.llmService.GetImageModel("")
+	if err != nil {
+		w.bot.SendMessage(chatID, "Генерация изображений временно недоступна. Попробуйте позже.")
+		return
+	}
+
+	if args == "" {
+		w.bot.SendMessage(chatID, fmt.Sprintf(
+			"Использование: /imagine [размер] <описание изображения>\n\n"+
+				"Доступные размеры: %s\n"+
+				"Пример: /imagine 1024x1024 кот-космонавт в стиле акварели",
+			strings.Join(model.GetSizes(), ", ")))
+		return
+	}
+
+	// Первым словом может быть указан размер изображения
+	size := model.DefaultSize
+	prompt := args
+	if fields := strings.Fields(args); len(fields) > 1 {
+		if _, ok := model.GetSizeCost(fields[0]); ok {
+			size = fields[0]
+			prompt = strings.TrimSpace(strings.TrimPrefix(args, fields[0]))
+		}
+	}
+
+	w.bot.SendMessage(chatID, "🎨 Генерирую изображение...")
+
+	response, err := w.llmService.GenerateImage(context.Background(), &llm.ImageRequest{
+		UserID:    userID,
+		Prompt:    prompt,
+		ModelName: model.Name,
+		Size:      size,
+	})
+	if err != nil {
+		w.log.Error("Ошибка генерации изображения",
+			zap.Int64("user_id", userID),
+			zap.Error(err))
+		w.bot.SendMessage(chatID, imageErrorText(err))
+		return
+	}
+
+	w.trackReferralActivity(userID)
+	w.awardRequestXP(userID, model.Name)
+
+	caption := fmt.Sprintf("🎨 %s, %s\n💰 Стоимость: %d нейронов", model.DisplayName, response.Size, response.NeuronsCost)
+
+	var photo tgbotapi.RequestFileData
+	if response.ImageURL != "" {
+		photo = tgbotapi.FileURL(response.ImageURL)
+	} else {
+		photo = tgbotapi.FileBytes{Name: "image.png", Bytes: response.ImageData}
+	}
+
+	if _, err := w.bot.SendPhoto(chatID, photo, caption); err != nil {
+		if w.compensateDelivery(userID, response.TransactionID, err) {
+			w.bot.SendMessage(chatID, "Изображение сгенерировано, но его не удалось отправить. Нейроны возвращены, попробуйте позже.")
+			return
+		}
+		w.bot.SendMessage(chatID, "Изображение сгенерировано, но его не удалось отправить. Попробуйте позже.")
+	}
+}
+
+// imageErrorText возвращает текст для пользователя по ошибке генерации изображения.
+// Ошибки провайдера не показываются пользователю, они только логируются
+func imageErrorText(err error) string {
+	switch {
+	case errors.Is(err, llm.ErrNoImageAccess):
+		return "❌ Генерация изображений недоступна в вашем плане. Подробнее: /subscribe"
+	case errors.Is(err, llm.ErrInsufficientNeurons):
+		return "❌ Недостаточно нейронов для генерации изображения. Пополнить баланс: /buy"
+	case errors.Is(err, llm.ErrRequestTooLong):
+		return "❌ " + err.Error()
+	default:
+		return "❌ Не удалось сгенерировать изображение. Попробуйте позже."
+	}
+}
@@ -0,0 +1,204 @@
+package app
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/nats-io/nats.go"
+	"go.uber.org/zap"
+
+	"neurobot-prod/internal/admin"
+	"neurobot-prod/internal/config"
+	"neurobot-prod/internal/currency"
+	"neurobot-prod/internal/events"
+	"neurobot-prod/internal/llm"
+	"neurobot-prod/internal/queue"
+	"neurobot-prod/internal/storage/postgres"
+	"neurobot-prod/internal/subscription"
+)
+
+const (
+	// llmQueueGroup - группа очереди LLM-запросов, каждый запрос выполняет только один экземпляр
+	llmQueueGroup = "llm"
+	// llmTaskTimeout - максимальное время выполнения одного запроса к нейросети
+	llmTaskTimeout = 5 * time.Minute
+)
+
+// LLMWorker выполняет запросы к нейросетям из очереди NATS и возвращает ответы.
+// Ответ отправляется на адрес ответа сообщения, а если его нет - публикуется в тему результатов
+type LLMWorker struct {
+	db               *sql.DB
+	natsConn         *nats.Conn
+	natsSubscription *nats.Subscription
+	publisher        *queue.Publisher
+	config           *config.Config
+	log              *zap.Logger
+	llmService       *llm.Service
+	errorLog         *admin.ErrorLog
+}
+
+// NewLLMWorker создает новый обработчик LLM-запросов
+func NewLLMWorker(cfg *config.Config, log *zap.Logger) (*LLMWorker, error) {
+	logger := log.Named("llm_worker")
+
+	// Подключаемся к базе данных
+	db, err := postgres.NewPostgresDB(cfg.DB, logger)
+	if err != nil {
+		return nil, fmt.Errorf("ошибка подключения к базе данных: %w", err)
+	}
+
+	// Ошибки сервисов сохраняются для просмотра в консоли администратора
+	adminRepo := admin.NewRepository(db)
+	var errorLog *admin.ErrorLog
+	if cfg.Admin.ErrorLogEnabled {
+		errorLog = admin.NewErrorLog(adminRepo, cfg.Admin.ErrorLogBuffer)
+		logger = logger.WithOptions(errorLog.Hook())
+	}
+
+	// Настраиваем NATS
+	natsOpts := []nats.Option{
+		nats.Name("Neurobot LLM Worker"),
+		nats.ReconnectWait(cfg.NATS.GetReconnectWait()),
+		nats.MaxReconnects(cfg.NATS.MaxReconnects),
+		nats.Timeout(cfg.NATS.GetTimeout()),
+	}
+
+	natsConn, err := nats.Connect(cfg.NATS.URL, natsOpts...)
+	if err != nil {
+		return nil, fmt.Errorf("ошибка подключения к NATS: %w", err)
+	}
+
+	// Создаем NATS Publisher
+	publisher, err := queue.NewPublisher(cfg.NATS, logger)
+	if err != nil {
+		return nil, fmt.Errorf("ошибка создания NATS publisher: %w", err)
+	}
+
+	// Создаем сервисы
+	subService := subscription.NewService(subscription.NewRepository(db), logger)
+	currencyService := currency.NewService(currency.NewRepository(db), subService, logger)
+	llmService := llm.NewService(cfg, subService, currencyService, logger)
+
+	// События запросов обрабатываются сервисом достижений в обработчике сообщений
+	eventBus := events.NewBus(publisher, cfg.NATS.Subjects.Events, logger)
+	currencyService.SetEvents(eventBus)
+	llmService.SetEvents(eventBus)
+	subService.SetEvents(eventBus)
+	// Модели, отключенные администратором, недоступны и в очереди
+	llmService.SetModelSwitch(adminRepo)
+
+	return &LLMWorker{
+		db:         db,
+		natsConn:   natsConn,
+		publisher:  publisher,
+		config:     cfg,
+		log:        logger,
+		llmService: llmService,
+		errorLog:   errorLog,
+	}, nil
+}
+
+// Start подписывается на очередь LLM-запросов
+func (w *LLMWorker) Start() error {
+	sub, err := w.natsConn.QueueSubscribe(w.config.NATS.Subjects.LLMTasks, llmQueueGroup, w.handleTask)
+	if err != nil {
+		return fmt.Errorf("ошибка подписки на тему NATS: %w", err)
+	}
+
+	w.natsSubscription = sub
+	w.log.Info("Начало обработки LLM-запросов",
+		zap.String("subject", w.config.NATS.Subjects.LLMTasks),
+		zap.String("queue_group", llmQueueGroup))
+
+	return nil
+}
+
+// Stop дожидается выполнения начатых запросов и закрывает соединения
+func (w *LLMWorker) Stop() {
+	// Drain прекращает получение новых запросов и дожидается обработки полученных
+	if w.natsSubscription != nil {
+		if err := w.natsSubscription.Drain(); err != nil {
+			w.log.Error("Ошибка остановки подписки на LLM-запросы", zap.Error(err))
+		}
+	}
+
+	// Закрываем соединение с NATS
+	if w.natsConn != nil {
+		w.natsConn.Drain()
+	}
+	if w.publisher != nil {
+		w.publisher.Close()
+	}
+
+	// Дописываем накопленные ошибки до закрытия базы данных
+	if w.errorLog != nil {
+		w.errorLog.Close()
+	}
+
+	// Закрываем соединение с базой данных
+	if w.db != nil {
+		w.db.Close()
+	}
+
+	w.log.Info("Обработчик LLM-запросов остановлен")
+}
+
+// handleTask выполняет запрос к нейросети из очереди и отправляет ответ
+func (w *LLMWorker) handleTask(msg *nats.Msg) {
+	var request llm.Request
+	if err := json.Unmarshal(msg.Data, &request); err != nil {
+		w.log.Error("Ошибка разбора LLM-запроса", zap.Error(err))
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), llmTaskTimeout)
+	defer cancel()
+
+	startTime := time.Now()
+	response, err := w.llmService.ProcessRequest(ctx, &request)
+	if err != nil {
+		w.log.Error("Ошибка выполнения LLM-запроса",
+			zap.Int64("user_id", request.UserID),
+			zap.String("model", request.ModelName),
+			zap.Error(err))
+		response = &llm.Response{
+			UserID:    request.UserID,
+			ModelType: request.ModelType,
+			ModelName: request.ModelName,
+			Error:     err.Error(),
+		}
+	}
+
+	w.log.Debug("LLM-запрос выполнен",
+		zap.Int64("user_id", request.UserID),
+		zap.String("model", request.ModelName),
+		zap.Duration("duration", time.Since(startTime)))
+
+	w.reply(ctx, msg, response)
+}
+
+// reply отправляет ответ на адрес ответа сообщения или публикует его в тему результатов
+func (w *LLMWorker) reply(ctx context.Context, msg *nats.Msg, response *llm.Response) {
+	if msg.Reply == "" {
+		if err := w.publisher.Publish(ctx, w.config.NATS.Subjects.LLMResults, response); err != nil {
+			w.log.Error("Ошибка публикации ответа нейросети",
+				zap.Int64("user_id", response.UserID),
+				zap.Error(err))
+		}
+		return
+	}
+
+	data, err := json.Marshal(response)
+	if err != nil {
+		w.log.Error("Ошибка сериализации ответа нейросети", zap.Error(err))
+		return
+	}
+	if err := msg.Respond(data); err != nil {
+		w.log.Error("Ошибка отправки ответа нейросети",
+			zap.Int64("user_id", response.UserID),
+			zap.Error(err))
+	}
+}
@@ -0,0 +1,16 @@
+package app
+
+import (
+	"context"
+
+	"go.uber.org/zap"
+)
+
+// awardRequestXP начисляет опыт за оплаченный запрос к нейросети
+func (w *MessageWorker) awardRequestXP(userID int64, modelName string) {
+	if _, err := w.loyaltyService.AwardRequest(context.Background(), userID, modelName); err != nil {
+		w.log.Error("Ошибка начисления опыта за запрос",
+			zap.Int64("user_id", userID),
+			zap.Error(err))
+	}
+}
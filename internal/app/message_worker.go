@@ -4,7 +4,9 @@ import (
 	"context"
 	"database/sql"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"strconv"
 	"strings"
 	"time"
 
@@ -13,32 +15,59 @@ import (
 	"github.com/redis/go-redis/v9"
 	"go.uber.org/zap"
 
+	"neurobot-prod/internal/achievement"
+	"neurobot-prod/internal/admin"
+	"neurobot-prod/internal/broadcast"
 	"neurobot-prod/internal/config"
+	"neurobot-prod/internal/conversation"
 	"neurobot-prod/internal/currency"
+	"neurobot-prod/internal/events"
+	"neurobot-prod/internal/gift"
 	"neurobot-prod/internal/llm"
+	"neurobot-prod/internal/loyalty"
+	"neurobot-prod/internal/payment"
+	"neurobot-prod/internal/promo"
 	"neurobot-prod/internal/queue"
+	"neurobot-prod/internal/referral"
 	"neurobot-prod/internal/storage/postgres"
 	redisStorage "neurobot-prod/internal/storage/redis"
+	"neurobot-prod/internal/streak"
 	"neurobot-prod/internal/subscription"
 	"neurobot-prod/internal/telegram"
 	"neurobot-prod/internal/user"
+	"neurobot-prod/internal/wallet"
 )
 
 // MessageWorker обрабатывает сообщения от пользователей
 type MessageWorker struct {
-	db               *sql.DB
-	redis            *redis.Client
-	bot              *telegram.Bot
-	api              *tgbotapi.BotAPI // API для прямых вызовов Telegram API
-	natsConn         *nats.Conn
-	natsSubscription *nats.Subscription
-	publisher        *queue.Publisher
-	config           *config.Config
-	log              *zap.Logger
-	currencyService  *currency.Service
-	subService       *subscription.Service
-	llmService       *llm.Service
-	userService      *user.Service
+	db                  *sql.DB
+	redis               *redis.Client
+	bot                 *telegram.Bot
+	api                 *tgbotapi.BotAPI // API для прямых вызовов Telegram API
+	natsConn            *nats.Conn
+	natsSubscription    *nats.Subscription
+	eventsSubscription  *nats.Subscription
+	broadcastSub        *nats.Subscription
+	publisher           *queue.Publisher
+	config              *config.Config
+	log                 *zap.Logger
+	currencyService     *currency.Service
+	subService          *subscription.Service
+	llmService          *llm.Service
+	userService         *user.Service
+	conversationService *conversation.Service
+	paymentService      *payment.Service
+	promoService        *promo.Service
+	referralService     *referral.Service
+	loyaltyService      *loyalty.Service
+	streakService       *streak.Service
+	achievementService  *achievement.Service
+	giftService         *gift.Service
+	walletService       *wallet.Service
+	adminService        *admin.Service
+	broadcastService    *broadcast.Service
+	errorLog            *admin.ErrorLog
+	eventBus            *events.Bus
 }
 
 // NewMessageWorker создает новый обработчик сообщений
@@ -51,6 +80,14 @@ func NewMessageWorker(cfg *config.Config, log *zap.Logger) (*MessageWorker, erro
 		return nil, fmt.Errorf("ошибка подключения к базе данных: %w", err)
 	}
 
+	// Ошибки сервисов сохраняются для просмотра в консоли администратора
+	adminRepo := admin.NewRepository(db)
+	var errorLog *admin.ErrorLog
+	if cfg.Admin.ErrorLogEnabled {
+		errorLog = admin.NewErrorLog(adminRepo, cfg.Admin.ErrorLogBuffer)
+		logger = logger.WithOptions(errorLog.Hook())
+	}
+
 	// Подключаемся к Redis
 	redisClient, err := redisStorage.NewRedisClient(cfg.Redis, logger)
 	if err != nil {
@@ -86,12 +123,71 @@ func NewMessageWorker(cfg *config.Config, log *zap.Logger) (*MessageWorker, erro
 	currencyRepo := currency.NewRepository(db)
 	subRepo := subscription.NewRepository(db)
 	userRepo := user.NewRepository(db)
+	conversationRepo := conversation.NewRepository(db)
 
 	// Создаем сервисы
 	subService := subscription.NewService(subRepo, logger)
 	currencyService := currency.NewService(currencyRepo, subService, logger)
 	llmService := llm.NewService(cfg, subService, currencyService, logger)
 	userService := user.NewService(userRepo, redisClient, logger)
+	conversationService := conversation.NewService(conversationRepo, subService, logger)
+	paymentService := payment.NewService(payment.NewRepository(db), cfg.Payment, subService, currencyService, logger)
+	paymentService.SetNotifier(func(userID int64, text string) {
+		bot.SendMessage(userID, text)
+	})
+	paymentService.SetStarsRefunder(bot.RefundStarPayment)
+	subService.SetRenewals(paymentService, cfg.Subscription, func(userID int64, text string) {
+		bot.SendMessage(userID, text)
+	})
+	promoService := promo.NewService(promo.NewRepository(db), subService, currencyService, logger)
+	paymentService.SetPromo(promoService)
+	referralService := referral.NewService(referral.NewRepository(db), currencyService, cfg.Referral, logger)
+	referralService.SetNotifier(func(userID int64, text string) {
+		bot.SendMessage(userID, text)
+	})
+	paymentService.SetReferrals(referralService)
+	loyaltyService := loyalty.NewService(loyalty.NewRepository(db), cfg.Loyalty, logger)
+	loyaltyService.SetNotifier(func(userID int64, text string) {
+		bot.SendMessage(userID, text)
+	})
+	paymentService.SetLoyalty(loyaltyService)
+	referralService.SetLoyalty(loyaltyService)
+	streakService := streak.NewService(streak.NewRepository(db), currencyService, cfg.Streak, logger)
+	streakService.SetNotifier(func(userID int64, text string) {
+		bot.SendMessage(userID, text)
+	})
+
+	// Доменные события публикуются в NATS и обрабатываются сервисом достижений
+	eventBus := events.NewBus(publisher, cfg.NATS.Subjects.Events, logger)
+	currencyService.SetEvents(eventBus)
+	llmService.SetEvents(eventBus)
+	subService.SetEvents(eventBus)
+	referralService.SetEvents(eventBus)
+	achievementService := achievement.NewService(achievement.NewRepository(db), currencyService, loyaltyService, llmService, logger)
+	achievementService.SetNotifier(func(userID int64, text string) {
+		bot.SendMessage(userID, text)
+	})
+	achievementService.Subscribe(eventBus)
+	giftService := gift.NewService(currencyService, subService, userService, cfg.Gift, logger)
+	giftService.SetNotifier(func(userID int64, text string) {
+		bot.SendMessage(userID, text)
+	})
+	walletService := wallet.NewService(wallet.NewRepository(db), currencyService, userService, cfg.Wallet, logger)
+	walletService.SetNotifier(func(userID int64, text string) {
+		bot.SendMessage(userID, text)
+	})
+	adminService := admin.NewService(adminRepo, userService, currencyService, subService, llmService, cfg, logger)
+	adminService.SetNotifier(func(userID int64, text string) {
+		bot.SendMessage(userID, text)
+	})
+	llmService.SetModelSwitch(adminService)
+	broadcastService := broadcast.NewService(broadcast.NewRepository(db), userService, publisher, redisClient, cfg, logger)
+	broadcastService.SetSender(func(userID int64, text string) error {
+		_, err := bot.SendMessage(userID, text)
+		return err
+	})
+	adminService.SetBroadcasts(broadcastService)
+	adminService.SetPersonas(conversationService)
 
 	// Получаем API-интерфейс для прямых вызовов API
 	api, err := tgbotapi.NewBotAPI(cfg.Telegram.Token)
@@ -100,18 +196,31 @@ func NewMessageWorker(cfg *config.Config, log *zap.Logger) (*MessageWorker, erro
 	}
 
 	return &MessageWorker{
-		db:              db,
-		redis:           redisClient,
-		bot:             bot,
-		api:             api, // Инициализируем поле api
-		natsConn:        natsConn,
-		publisher:       publisher,
-		config:          cfg,
-		log:             logger,
-		currencyService: currencyService,
-		subService:      subService,
-		llmService:      llmService,
-		userService:     userService,
+		db:                  db,
+		redis:               redisClient,
+		bot:                 bot,
+		api:                 api, // Инициализируем поле api
+		natsConn:            natsConn,
+		publisher:           publisher,
+		config:              cfg,
+		log:                 logger,
+		currencyService:     currencyService,
+		subService:          subService,
+		llmService:          llmService,
+		userService:         userService,
+		conversationService: conversationService,
+		paymentService:      paymentService,
+		promoService:        promoService,
+		referralService:     referralService,
+		loyaltyService:      loyaltyService,
+		streakService:       streakService,
+		achievementService:  achievementService,
+		giftService:         giftService,
+		walletService:       walletService,
+		adminService:        adminService,
+		broadcastService:    broadcastService,
+		errorLog:            errorLog,
+		eventBus:            eventBus,
 	}, nil
 }
 
@@ -127,6 +236,21 @@ func (w *MessageWorker) Start() error {
 	w.log.Info("Начало обработки сообщений",
 		zap.String("subject", w.config.NATS.Subjects.TelegramUpdates))
 
+	// Подписываемся на доменные события. Группа очереди гарантирует,
+	// что каждое событие обработает только один экземпляр обработчика
+	eventsSub, err := w.eventBus.Listen(w.natsConn, "achievements")
+	if err != nil {
+		return fmt.Errorf("ошибка подписки на доменные события: %w", err)
+	}
+	w.eventsSubscription = eventsSub
+
+	// Подписываемся на очередь рассылок
+	broadcastSub, err := w.broadcastService.Listen(w.natsConn)
+	if err != nil {
+		return fmt.Errorf("ошибка подписки на очередь рассылок: %w", err)
+	}
+	w.broadcastSub = broadcastSub
+
 	return nil
 }
 
@@ -136,12 +260,23 @@ func (w *MessageWorker) Stop() {
 	if w.natsSubscription != nil {
 		w.natsSubscription.Unsubscribe()
 	}
+	if w.eventsSubscription != nil {
+		w.eventsSubscription.Unsubscribe()
+	}
+	if w.broadcastSub != nil {
+		w.broadcastSub.Unsubscribe()
+	}
 
 	// Закрываем соединение с NATS
 	if w.natsConn != nil {
 		w.natsConn.Close()
 	}
 
+	// Дописываем накопленные ошибки до закрытия базы данных
+	if w.errorLog != nil {
+		w.errorLog.Close()
+	}
+
 	// Закрываем соединение с базой данных
 	if w.db != nil {
 		w.db.Close()
@@ -190,6 +325,14 @@ func (w *MessageWorker) handleMessage(msg *nats.Msg) {
 		languageCode = update.CallbackQuery.From.LanguageCode
 		isBot = update.CallbackQuery.From.IsBot
 		chatID = update.CallbackQuery.Message.Chat.ID
+	case update.PreCheckoutQuery != nil:
+		telegramID = int64(update.PreCheckoutQuery.From.ID)
+		username = update.PreCheckoutQuery.From.UserName
+		firstName = update.PreCheckoutQuery.From.FirstName
+		lastName = update.PreCheckoutQuery.From.LastName
+		languageCode = update.PreCheckoutQuery.From.LanguageCode
+		isBot = update.PreCheckoutQuery.From.IsBot
+		chatID = telegramID
 	default:
 		w.log.Debug("Получен неподдерживаемый тип обновления")
 		return
@@ -227,7 +370,11 @@ func (w *MessageWorker) handleMessage(msg *nats.Msg) {
 					zap.Int64("telegram_id", telegramID),
 					zap.Error(err))
 			}
+			return
 		}
+
+		// Время последней активности используется для сегментации рассылок
+		w.userService.TouchActivity(ctx, telegramID)
 	}()
 
 	// Параллельно начинаем обработку обновления для улучшения отзывчивости
@@ -239,10 +386,14 @@ func (w *MessageWorker) handleMessage(msg *nats.Msg) {
 
 		// Обрабатываем обновление в зависимости от его типа
 		switch {
+		case update.Message != nil && update.Message.SuccessfulPayment != nil:
+			w.handleSuccessfulPayment(update.Message)
 		case update.Message != nil:
 			w.handleTextMessage(&update)
 		case update.CallbackQuery != nil:
 			w.handleCallbackQuery(&update)
+		case update.PreCheckoutQuery != nil:
+			w.handlePreCheckoutQuery(update.PreCheckoutQuery)
 		}
 	}()
 
@@ -290,6 +441,17 @@ func (w *MessageWorker) handleTextMessage(update *tgbotapi.Update) {
 		return
 	}
 
+	// Если бот ожидает собственный промпт, сообщение не отправляется нейросети
+	if w.handlePendingCustomPrompt(message) {
+		return
+	}
+
+	// Кнопка старой клавиатуры отправляет свой текст, а не открывает Mini App
+	if message.Text == legacyProfileButtonText {
+		w.handleLegacyProfileButton(message)
+		return
+	}
+
 	// Здесь обрабатываем обычные текстовые сообщения (запросы к нейросети)
 	w.handleNeuralRequest(message)
 }
@@ -305,12 +467,46 @@ func (w *MessageWorker) handleCommand(message *tgbotapi.Message) {
 		w.handleHelpCommand(message)
 	case "profile":
 		w.handleProfileCommand(message)
+	case "history":
+		w.handleHistoryCommand(message)
 	case "daily":
 		w.handleDailyCommand(message)
+	case "streak":
+		w.handleStreakCommand(message)
 	case "models":
 		w.handleModelsCommand(message)
 	case "subscribe":
 		w.handleSubscribeCommand(message)
+	case "buy":
+		w.handleBuyCommand(message)
+	case "ref":
+		w.handleRefCommand(message)
+	case "promo":
+		w.handlePromoCommand(message)
+	case "promogen":
+		w.handlePromoGenCommand(message)
+	case "refund":
+		w.handleRefundCommand(message)
+	case "imagine":
+		w.handleImagineCommand(message)
+	case "persona":
+		w.handlePersonaCommand(message)
+	case "compare":
+		w.handleCompareCommand(message)
+	case "achievements":
+		w.handleAchievementsCommand(message)
+	case "gift":
+		w.handleGiftCommand(message)
+	case "wallet":
+		w.handleWalletCommand(message)
+	case "admin":
+		w.handleAdminCommand(message)
+	case "broadcast":
+		w.handleBroadcastCommand(message)
+	case achievement.HiddenCommand:
+		w.handleHiddenCommand(message)
+	case "cancel":
+		w.handleCancelCommand(message)
 	default:
 		w.bot.SendMessage(message.Chat.ID, "Неизвестная команда. Введите /help для получения списка доступных команд.")
 	}
@@ -326,16 +522,32 @@ func (w *MessageWorker) handleStartCommand(message *tgbotapi.Message) {
 			"Просто напиши мне свой вопрос, и я отправлю его нейросети!\n\n"+
 			"Команды:\n"+
 			"/daily - получить ежедневные нейроны\n"+
+			"/streak - серия ежедневных начислений\n"+
 			"/profile - информация о профиле\n"+
+			"/history - история операций\n"+
 			"/models - доступные модели нейросетей\n"+
+			"/imagine - сгенерировать изображение\n"+
+			"/persona - выбрать персону нейросети\n"+
+			"/compare - сравнить ответы нескольких моделей\n"+
 			"/subscribe - информация о подписках\n"+
+			"/buy - купить нейроны\n"+
+			"/promo - активировать промокод\n"+
+			"/ref - пригласить друзей\n"+
+			"/gift - подарить нейроны\n"+
+			"/wallet - общие кошельки для семьи и команды\n"+
+			"/achievements - ваши достижения\n"+
 			"/help - справка по командам",
 		message.From.FirstName)
 
-	// Отправляем приветственное сообщение с базовой клавиатурой
+	// Отправляем приветственное сообщение с кнопкой Mini App
 	w.bot.SendMessage(message.Chat.ID, text,
 		telegram.WithParseMode("Markdown"),
-		telegram.WithWebAppInfo())
+		w.bot.WithWebAppButton(webAppProfileButtonText, telegram.ScreenProfile))
+
+	// Пользователь мог прийти по реферальной ссылке t.me/<бот>?start=ref_<код>
+	if code, ok := referral.ParseDeepLink(message.CommandArguments()); ok {
+		w.handleReferralDeepLink(message, code)
+	}
 }
 
 // handleHelpCommand обрабатывает команду /help
@@ -343,9 +555,20 @@ func (w *MessageWorker) handleHelpCommand(message *tgbotapi.Message) {
 	text := "Список доступных команд:\n\n" +
 		"/start - начало работы с ботом\n" +
 		"/daily - получить ежедневные нейроны\n" +
+		"/streak - серия, заморозки и напоминания\n" +
 		"/profile - информация о профиле\n" +
+		"/history - история операций, итоги месяца и выписка\n" +
 		"/models - доступные модели нейросетей\n" +
+		"/imagine <описание> - сгенерировать изображение\n" +
+		"/persona - выбрать персону или задать свой промпт\n" +
+		"/compare <запрос> - сравнить ответы нескольких моделей (Pro)\n" +
 		"/subscribe - информация о подписках\n" +
+		"/buy - купить пакет нейронов\n" +
+		"/promo <код> - активировать промокод\n" +
+		"/ref - реферальная ссылка и статистика приглашений\n" +
+		"/gift @username количество - подарить купленные нейроны\n" +
+		"/wallet - общие кошельки: участники, лимиты и выбор оплаты\n" +
+		"/achievements - достижения и награды\n" +
 		"/help - справка по командам\n\n" +
 		"Для взаимодействия с нейросетью просто отправь мне свой вопрос!"
 
@@ -374,6 +597,21 @@ func (w *MessageWorker) handleProfileCommand(message *tgbotapi.Message) {
 		return
 	}
 
+	// Получаем уровень лояльности
+	progress, err := w.loyaltyService.GetProgress(context.Background(), int64(message.From.ID))
+	if err != nil {
+		w.log.Error("Ошибка получения уровня",
+			zap.Int64("user_id", int64(message.From.ID)),
+			zap.Error(err))
+		w.bot.SendMessage(message.Chat.ID, "Произошла ошибка при получении информации о профиле. Попробуйте позже.")
+		return
+	}
+
+	levelInfo := fmt.Sprintf("%s (%d XP)", progress.Level.Name, progress.XP)
+	if progress.NextLevel != nil {
+		levelInfo += fmt.Sprintf(", до уровня «%s»: %d XP", progress.NextLevel.Name, progress.XPToNextLevel())
+	}
+
 	// Формируем текст профиля
 	var subscriptionInfo string
 	if subscription != nil && subscription.Plan != nil {
@@ -392,52 +630,60 @@ func (w *MessageWorker) handleProfileCommand(message *tgbotapi.Message) {
 			"🧠 *Нейроны:* %d\n"+
 			"📊 *Всего получено:* %d\n"+
 			"📉 *Всего потрачено:* %d\n"+
-			"🔎 *Тип подписки:* %s\n\n"+
-			"Для просмотра полной информации о профиле, включая достижения и историю транзакций, нажмите кнопку \"Открыть Профиль\" ниже.",
+			"🔎 *Тип подписки:* %s\n"+
+			"🏅 *Уровень:* %s\n\n"+
+			"История операций и расход по моделям: /history\n\n"+
+			"Для просмотра полной информации о профиле, включая достижения и историю транзакций, нажмите кнопку \"Открыть профиль\" ниже.",
 		balance.Balance,
 		balance.LifetimeEarned,
 		balance.LifetimeSpent,
-		subscriptionInfo)
+		subscriptionInfo,
+		levelInfo)
 
-	// Отправляем сообщение с клавиатурой для открытия профиля
+	// Отправляем сообщение с кнопкой открытия профиля в Mini App
 	w.bot.SendMessage(message.Chat.ID, text,
 		telegram.WithParseMode("Markdown"),
-		telegram.WithWebAppInfo())
+		w.bot.WithWebAppButton(webAppProfileButtonText, telegram.ScreenProfile))
 }
 
 // handleDailyCommand обрабатывает команду /daily
 func (w *MessageWorker) handleDailyCommand(message *tgbotapi.Message) {
-	// Получаем баланс пользователя для проверки
-	balance, err := w.currencyService.GetBalance(context.Background(), int64(message.From.ID))
+	userID := int64(message.From.ID)
+
+	// Начисление доступно один раз за календарный день по времени пользователя
+	st, err := w.streakService.Get(context.Background(), userID)
 	if err != nil {
-		w.log.Error("Ошибка получения баланса",
-			zap.Int64("user_id", int64(message.From.ID)),
-			zap.Error(err))
-		w.bot.SendMessage(message.Chat.ID, "Произошла ошибка при получении информации о балансе. Попробуйте позже.")
+		w.bot.SendMessage(message.Chat.ID, "Произошла ошибка при получении информации о ежедневном начислении. Попробуйте позже.")
 		return
 	}
-
-	// Проверяем, может ли пользователь получить ежедневное вознаграждение
-	if !balance.CanReceiveDailyReward() {
-		timeLeft := time.Until(*balance.LastDailyRewardAt) + 20*time.Hour
-		hours := int(timeLeft.Hours())
-		minutes := int(timeLeft.Minutes()) % 60
-
-		w.bot.SendMessage(message.Chat.ID,
-			fmt.Sprintf("Вы уже получили ежедневные нейроны. Следующее начисление будет доступно через %d ч %d мин.",
-				hours, minutes))
+	if st.ClaimedToday(time.Now()) {
+		w.sendDailyAlreadyClaimed(message.Chat.ID, st)
 		return
 	}
 
-	// Получаем реферальный бонус
-	// TODO: Реализовать логику получения реферального бонуса
-	loyaltyBonusPercent := 0
+	// Получаем бонус уровня лояльности
+	loyaltyBonusPercent, err := w.loyaltyService.GetBonusPercent(context.Background(), userID)
+	if err != nil {
+		// Без бонуса начисление все равно выполняется
+		w.log.Error("Ошибка получения бонуса лояльности",
+			zap.Int64("user_id", userID),
+			zap.Error(err))
+		loyaltyBonusPercent = 0
+	}
 
-	// Добавляем ежедневные нейроны
-	tx, err := w.currencyService.AddDailyNeurons(context.Background(), int64(message.From.ID), loyaltyBonusPercent)
+	// Добавляем ежедневные нейроны с учетом серии
+	result, err := w.streakService.Claim(context.Background(), userID, loyaltyBonusPercent)
 	if err != nil {
+		if errors.Is(err, streak.ErrAlreadyClaimed) {
+			// Начисление получено параллельным запросом, показываем актуальную серию
+			if current, err := w.streakService.Get(context.Background(), userID); err == nil {
+				st = current
+			}
+			w.sendDailyAlreadyClaimed(message.Chat.ID, st)
+			return
+		}
 		w.log.Error("Ошибка начисления ежедневных нейронов",
-			zap.Int64("user_id", int64(message.From.ID)),
+			zap.Int64("user_id", userID),
 			zap.Error(err))
 		w.bot.SendMessage(message.Chat.ID, "Произошла ошибка при начислении ежедневных нейронов. Попробуйте позже.")
 		return
@@ -449,10 +695,31 @@ func (w *MessageWorker) handleDailyCommand(message *tgbotapi.Message) {
 			"Вам начислено *%d нейронов*!\n"+
 			"Текущий баланс: *%d нейронов*\n\n"+
 			"Эти нейроны будут действовать в течение ограниченного периода времени. Используйте их для запросов к нейросетям!",
-		tx.Amount,
-		tx.BalanceAfter)
+		result.Amount,
+		result.BalanceAfter)
+
+	text += fmt.Sprintf("\n\n🔥 Серия: %d дн.", result.Streak)
+	if result.BonusPercent > 0 {
+		text += fmt.Sprintf(" (бонус +%d%%)", result.BonusPercent)
+	}
+	if result.FreezesUsed > 0 {
+		text += fmt.Sprintf("\n❄️ Пропущенные дни покрыты заморозками: %d", result.FreezesUsed)
+	}
+	if result.Broken {
+		text += fmt.Sprintf("\nПредыдущая серия (%d дн.) прервалась. Заморозки из /streak помогут сохранить серию в следующий раз.",
+			result.PreviousStreak)
+	}
+	if loyaltyBonusPercent > 0 {
+		text += fmt.Sprintf("\n🏅 Бонус уровня: +%d%%", loyaltyBonusPercent)
+	}
 
 	w.bot.SendMessage(message.Chat.ID, text, telegram.WithParseMode("Markdown"))
+
+	if _, err := w.loyaltyService.AwardDaily(context.Background(), userID, result.TransactionID); err != nil {
+		w.log.Error("Ошибка начисления опыта за ежедневное начисление",
+			zap.Int64("user_id", userID),
+			zap.Error(err))
+	}
 }
 
 // handleModelsCommand обрабатывает команду /models
@@ -552,13 +819,29 @@ func (w *MessageWorker) handleSubscribeCommand(message *tgbotapi.Message) {
 		}
 	}
 
-	parts = append(parts, "Для оформления подписки и просмотра всех преимуществ, используйте кнопку \"Открыть Профиль\" ниже.")
+	parts = append(parts, "Выберите подписку для оформления. Все преимущества планов можно сравнить в приложении.")
+
+	// Кнопки оплаты платных планов
+	var rows [][]tgbotapi.InlineKeyboardButton
+	for _, plan := range plans {
+		if plan.PriceMonthly <= 0 {
+			continue
+		}
+		rows = append(rows, tgbotapi.NewInlineKeyboardRow(
+			tgbotapi.NewInlineKeyboardButtonData(
+				fmt.Sprintf("%s - месяц (%.0f ₽)", plan.Name, plan.GetMonthlyPriceRub()),
+				fmt.Sprintf("sub:%s:monthly", plan.Code)),
+			tgbotapi.NewInlineKeyboardButtonData(
+				fmt.Sprintf("%s - год (%.0f ₽)", plan.Name, plan.GetYearlyPriceRub()),
+				fmt.Sprintf("sub:%s:yearly", plan.Code)),
+		))
+	}
 
-	// Отправляем сообщение с клавиатурой
+	// Отправляем сообщение с кнопками оплаты и кнопкой экрана подписок в Mini App
 	text := strings.Join(parts, "\n")
 	w.bot.SendMessage(message.Chat.ID, text,
 		telegram.WithParseMode("Markdown"),
-		telegram.WithWebAppInfo())
+		w.bot.WithWebAppButton("📱 Подписки в приложении", telegram.ScreenSubscribe, rows...))
 }
 
 // handleCallbackQuery обрабатывает callback-запросы (нажатия на инлайн-кнопки)
@@ -609,6 +892,42 @@ func (w *MessageWorker) handleCallbackQuery(update *tgbotapi.Update) {
 		packageID := parts[1]
 		w.handleBuyNeuronsRequest(callbackQuery, packageID)
 
+	case "chplan":
+		// Подтверждение смены плана подписки
+		w.handlePlanChangeCallback(callbackQuery, parts)
+
+	case "pay":
+		// Выбор способа оплаты
+		w.handlePayCallback(callbackQuery, parts)
+
+	case "persona":
+		// Обработка выбора персоны
+		w.handlePersonaCallback(callbackQuery, parts)
+
+	case "compare":
+		// Подтверждение или отмена сравнения моделей
+		w.handleCompareCallback(callbackQuery, parts)
+
+	case "streak":
+		// Заморозки и напоминания серии
+		w.handleStreakCallback(callbackQuery, parts)
+
+	case "ach":
+		// Получение награды за достижение
+		w.handleAchievementCallback(callbackQuery, parts)
+
+	case "gift":
+		// Подтверждение или отмена подарка нейронов
+		w.handleGiftCallback(callbackQuery, parts)
+
+	case "hist":
+		// Навигация по истории операций и выгрузка выписки
+		w.handleHistoryCallback(callbackQuery, parts)
+
+	case "wallet":
+		// Выбор кошелька для оплаты запросов и просмотр кошелька
+		w.handleWalletCallback(callbackQuery, parts)
+
 	default:
 		w.log.Warn("Неизвестное действие в callback",
 			zap.String("action", action))
@@ -617,24 +936,27 @@ func (w *MessageWorker) handleCallbackQuery(update *tgbotapi.Update) {
 
 // handleSubscriptionRequest обрабатывает запрос на подписку
 func (w *MessageWorker) handleSubscriptionRequest(callback *tgbotapi.CallbackQuery, planCode string, period string) {
-	chatID := callback.Message.Chat.ID
+	// Владельцам платной подписки предлагаем смену плана с перерасчетом
+	if w.offerPlanChange(callback, planCode, period) {
+		return
+	}
 
-	// Здесь должна быть логика для создания платежа на подписку
-	// Пока просто отправляем сообщение
-	w.bot.SendMessage(chatID, fmt.Sprintf(
-		"Запрос на оформление подписки:\nПлан: %s\nПериод: %s\n\nПлатежная система пока не подключена.",
-		planCode, period))
+	if w.paymentService.TelegramPaymentsEnabled() {
+		w.sendPaymentMethods(callback.Message.Chat.ID, fmt.Sprintf("sub:%s:%s", planCode, period))
+		return
+	}
+
+	w.paySubscription(callback, payment.ProviderYooKassa, planCode, period)
 }
 
 // handleBuyNeuronsRequest обрабатывает запрос на покупку нейронов
 func (w *MessageWorker) handleBuyNeuronsRequest(callback *tgbotapi.CallbackQuery, packageID string) {
-	chatID := callback.Message.Chat.ID
+	if w.paymentService.TelegramPaymentsEnabled() {
+		w.sendPaymentMethods(callback.Message.Chat.ID, "buy:"+packageID)
+		return
+	}
 
-	// Здесь должна быть логика для создания платежа на покупку нейронов
-	// Пока просто отправляем сообщение
-	w.bot.SendMessage(chatID, fmt.Sprintf(
-		"Запрос на покупку нейронов:\nПакет: %s\n\nПлатежная система пока не подключена.",
-		packageID))
+	w.payPackage(callback, payment.ProviderYooKassa, packageID)
 }
 
 // handleNeuralRequest обрабатывает запрос к нейросети
@@ -667,8 +989,8 @@ func (w *MessageWorker) handleNeuralRequest(message *tgbotapi.Message) {
 		return
 	}
 
-	// Проверяем баланс нейронов
-	balance, err := w.currencyService.GetBalance(context.Background(), userID)
+	// Проверяем баланс нейронов, из которого оплачиваются запросы: личный или общего кошелька
+	balance, err := w.currencyService.GetSpendingBalance(context.Background(), userID)
 	if err != nil {
 		w.log.Error("Ошибка получения баланса",
 			zap.Int64("user_id", userID),
@@ -712,24 +1034,70 @@ func (w *MessageWorker) handleNeuralRequest(message *tgbotapi.Message) {
 
 	// Проверяем, достаточно ли нейронов
 	if balance.Balance < selectedModel.NeuronsCost {
+		if balance.WalletID != nil {
+			w.bot.SendMessage(chatID, fmt.Sprintf(
+				"❌ Недостаточно нейронов в общем кошельке!\n\n"+
+					"Стоимость запроса: %d нейронов\n"+
+					"Доступно вам сегодня: %d нейронов\n\n"+
+					"Попросите владельца пополнить кошелек или переключитесь на личный баланс через /wallet.",
+				selectedModel.NeuronsCost,
+				balance.Balance))
+			return
+		}
 		w.bot.SendMessage(chatID, fmt.Sprintf(
 			"❌ Недостаточно нейронов для запроса!\n\n"+
 				"Стоимость запроса: %d нейронов\n"+
 				"Ваш баланс: %d нейронов\n\n"+
-				"Получите ежедневное начисление через /daily или приобретите дополнительные нейроны через \"Открыть Профиль\".",
+				"Получите ежедневное начисление через /daily или приобретите дополнительные нейроны через /buy.",
 			selectedModel.NeuronsCost,
 			balance.Balance))
 		return
 	}
 
+	// Получаем активный диалог с выбранной персоной
+	conv, err := w.conversationService.GetActiveConversation(context.Background(), userID)
+	if err != nil {
+		w.log.Error("Ошибка получения диалога",
+			zap.Int64("user_id", userID),
+			zap.Error(err))
+		w.bot.SendMessage(chatID, "Произошла ошибка при получении настроек диалога. Попробуйте позже.")
+		return
+	}
+
+	// Загружаем историю после краткого содержания; сообщения сверх лимита плана
+	// сворачиваются в краткое содержание (для бесплатных пользователей история не добавляется)
+	var history []*conversation.Message
+	if plan.ContextMessages > 0 {
+		history, err = w.conversationService.GetHistory(context.Background(), conv)
+		if err != nil {
+			w.bot.SendMessage(chatID, "Произошла ошибка при получении истории диалога. Попробуйте позже.")
+			return
+		}
+	}
+
+	messageHistory := make([]llm.Message, 0, len(history))
+	for _, msg := range history {
+		messageHistory = append(messageHistory, llm.Message{
+			Role:    msg.Role,
+			Content: msg.Content,
+		})
+	}
+
 	// Создаем запрос к нейросети
 	llmRequest := &llm.Request{
-		UserID:      userID,
-		UserMessage: messageText,
-		ModelType:   selectedModel.Type,
-		ModelName:   selectedModel.Name,
-		// Для бесплатных пользователей не добавляем историю сообщений
-		MessageHistory: []llm.Message{},
+		UserID:         userID,
+		UserMessage:    messageText,
+		ModelType:      selectedModel.Type,
+		ModelName:      selectedModel.Name,
+		MessageHistory: messageHistory,
+		HistoryWindow:  plan.ContextMessages,
+		SystemPrompt:   conv.GetSystemPrompt(),
+		ConversationID: strconv.FormatInt(conv.ID, 10),
+	}
+
+	// Краткое содержание нужно только вместе с историей
+	if plan.ContextMessages > 0 {
+		llmRequest.ContextSummary = conv.Summary
 	}
 
 	// Отправляем запрос к нейросети
@@ -738,10 +1106,33 @@ func (w *MessageWorker) handleNeuralRequest(message *tgbotapi.Message) {
 		w.log.Error("Ошибка обработки запроса к нейросети",
 			zap.Int64("user_id", userID),
 			zap.Error(err))
-		w.bot.SendMessage(chatID, "Произошла ошибка при обработке запроса к нейросети. Попробуйте позже.")
+		w.bot.SendMessage(chatID, neuralErrorText(err))
 		return
 	}
 
+	// Оплаченные запросы засчитываются для активации реферала и приносят опыт
+	if !response.Cached {
+		w.trackReferralActivity(userID)
+		w.awardRequestXP(userID, selectedModel.Name)
+	}
+
+	// Сохраняем обмен сообщениями в историю диалога
+	if err := w.conversationService.SaveExchange(context.Background(), conv.ID, messageText, response.ResponseText, selectedModel.Name); err != nil {
+		w.log.Error("Ошибка сохранения истории диалога",
+			zap.Int64("user_id", userID),
+			zap.Error(err))
+	}
+
+	// Сохраняем краткое содержание, если старая часть истории была свернута
+	if response.SummarizedMessages > 0 && response.SummarizedMessages <= len(history) {
+		summarizedUntilID := history[response.SummarizedMessages-1].ID
+		if err := w.conversationService.UpdateSummary(context.Background(), conv.ID, response.ContextSummary, summarizedUntilID); err != nil {
+			w.log.Error("Ошибка сохранения краткого содержания диалога",
+				zap.Int64("user_id", userID),
+				zap.Error(err))
+		}
+	}
+
 	// Формируем подпись с информацией о модели и стоимости
 	footer := fmt.Sprintf("\n\n---\n📊 Модель: %s\n💰 Стоимость: %d нейронов",
 		selectedModel.DisplayName, response.NeuronsCost)
@@ -757,6 +1148,10 @@ func (w *MessageWorker) handleNeuralRequest(message *tgbotapi.Message) {
 		limitedResponse = limitedResponse[:4000] + "...\n\n(Ответ был слишком длинным и был обрезан)"
 	}
 
-	// Отправляем готовый ответ
-	w.bot.SendMessage(chatID, limitedResponse+footer)
+	// Отправляем готовый ответ. Если доставить его не удалось, возвращаем нейроны
+	if _, err := w.bot.SendMessage(chatID, limitedResponse+footer); err != nil {
+		if w.compensateDelivery(userID, response.TransactionID, err) {
+			w.bot.SendMessage(chatID, "Не удалось отправить ответ нейросети. Нейроны за запрос возвращены, попробуйте еще раз.")
+		}
+	}
 }
@@ -0,0 +1,252 @@
+package app
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+	"go.uber.org/zap"
+
+	"neurobot-prod/internal/payment"
+	"neurobot-prod/internal/telegram"
+)
+
+// handleBuyCommand обрабатывает команду /buy
+func (w *MessageWorker) handleBuyCommand(message *tgbotapi.Message) {
+	packages, err := w.currencyService.GetAvailablePackages(context.Background())
+	if err != nil {
+		w.log.Error("Ошибка получения пакетов нейронов",
+			zap.Int64("user_id", int64(message.From.ID)),
+			zap.Error(err))
+		w.bot.SendMessage(message.Chat.ID, "Произошла ошибка при получении пакетов нейронов. Попробуйте позже.")
+		return
+	}
+
+	if len(packages) == 0 {
+		w.bot.SendMessage(message.Chat.ID, "Сейчас нет доступных пакетов нейронов.")
+		return
+	}
+
+	var parts []string
+	parts = append(parts, "*Пакеты нейронов:*\n")
+
+	var rows [][]tgbotapi.InlineKeyboardButton
+	for _, pkg := range packages {
+		line := fmt.Sprintf("*%s* - %d нейронов", pkg.Name, pkg.Amount)
+		if pkg.BonusAmount > 0 {
+			line += fmt.Sprintf(" + %d бонусных", pkg.BonusAmount)
+		}
+		line += fmt.Sprintf(" за %.2f ₽", float64(pkg.Price)/100.0)
+		parts = append(parts, line)
+
+		rows = append(rows, tgbotapi.NewInlineKeyboardRow(
+			tgbotapi.NewInlineKeyboardButtonData(
+				fmt.Sprintf("%s - %.0f ₽", pkg.Name, float64(pkg.Price)/100.0),
+				fmt.Sprintf("buy:%d", pkg.ID))))
+	}
+
+	w.bot.SendMessage(message.Chat.ID, strings.Join(parts, "\n"),
+		telegram.WithParseMode("Markdown"),
+		w.bot.WithWebAppButton("📱 Купить в приложении", telegram.ScreenBuy, rows...))
+}
+
+// sendPaymentLink отправляет пользователю ссылку на оплату
+func (w *MessageWorker) sendPaymentLink(chatID int64, p *payment.Payment, title string) {
+	if p.PaymentURL == "" {
+		w.bot.SendMessage(chatID, "Не удалось получить ссылку на оплату. Попробуйте позже.")
+		return
+	}
+
+	keyboard := tgbotapi.NewInlineKeyboardMarkup(
+		tgbotapi.NewInlineKeyboardRow(
+			tgbotapi.NewInlineKeyboardButtonURL(fmt.Sprintf("💳 Оплатить %.2f ₽", p.GetAmountRub()), p.PaymentURL),
+		),
+	)
+
+	w.bot.SendMessage(chatID, fmt.Sprintf(
+		"%s\n\nСумма к оплате: %.2f ₽\nПосле оплаты бот пришлет подтверждение автоматически.",
+		title, p.GetAmountRub()),
+		telegram.WithReplyMarkup(keyboard))
+}
+
+// sendPaymentMethods предлагает пользователю выбрать способ оплаты товара
+func (w *MessageWorker) sendPaymentMethods(chatID int64, item string) {
+	var rows [][]tgbotapi.InlineKeyboardButton
+	rows = append(rows, tgbotapi.NewInlineKeyboardRow(
+		tgbotapi.NewInlineKeyboardButtonData("💳 Картой (ЮKassa)", fmt.Sprintf("pay:%s:%s", payment.ProviderYooKassa, item))))
+	if w.paymentService.TelegramCardsEnabled() {
+		rows = append(rows, tgbotapi.NewInlineKeyboardRow(
+			tgbotapi.NewInlineKeyboardButtonData("💳 Картой в Telegram", fmt.Sprintf("pay:%s:%s", payment.ProviderTelegramCard, item))))
+	}
+	if w.paymentService.TelegramStarsEnabled() {
+		rows = append(rows, tgbotapi.NewInlineKeyboardRow(
+			tgbotapi.NewInlineKeyboardButtonData("⭐ Telegram Stars", fmt.Sprintf("pay:%s:%s", payment.ProviderTelegramStars, item))))
+	}
+
+	w.bot.SendMessage(chatID, "Выберите способ оплаты:",
+		telegram.WithReplyMarkup(tgbotapi.NewInlineKeyboardMarkup(rows...)))
+}
+
+// handlePayCallback обрабатывает выбор способа оплаты: pay:<провайдер>:sub:<план>:<период> или pay:<провайдер>:buy:<пакет>
+func (w *MessageWorker) handlePayCallback(callback *tgbotapi.CallbackQuery, parts []string) {
+	if len(parts) < 4 {
+		return
+	}
+
+	provider := parts[1]
+	switch {
+	case parts[2] == "sub" && len(parts) >= 5:
+		w.paySubscription(callback, provider, parts[3], parts[4])
+	case parts[2] == "buy":
+		w.payPackage(callback, provider, parts[3])
+	default:
+		w.log.Warn("Некорректный формат данных оплаты",
+			zap.String("data", callback.Data))
+	}
+}
+
+// paySubscription создает платеж за подписку у выбранного провайдера
+func (w *MessageWorker) paySubscription(callback *tgbotapi.CallbackQuery, provider, planCode, period string) {
+	chatID := callback.Message.Chat.ID
+	userID := int64(callback.From.ID)
+	ctx := context.Background()
+
+	if provider == payment.ProviderYooKassa {
+		p, err := w.paymentService.CreateSubscriptionPayment(ctx, userID, planCode, period)
+		if err != nil {
+			w.log.Error("Ошибка создания платежа за подписку",
+				zap.Int64("user_id", userID),
+				zap.String("plan_code", planCode),
+				zap.Error(err))
+			w.bot.SendMessage(chatID, "Не удалось создать платеж. Попробуйте позже.")
+			return
+		}
+
+		w.sendPaymentLink(chatID, p, "Оформление подписки")
+		return
+	}
+
+	invoice, err := w.paymentService.CreateSubscriptionInvoice(ctx, userID, planCode, period, provider)
+	if err != nil {
+		w.log.Error("Ошибка создания счета за подписку",
+			zap.Int64("user_id", userID),
+			zap.String("plan_code", planCode),
+			zap.String("provider", provider),
+			zap.Error(err))
+		w.bot.SendMessage(chatID, "Не удалось создать счет. Попробуйте позже.")
+		return
+	}
+
+	w.sendInvoice(chatID, invoice)
+}
+
+// payPackage создает платеж за пакет нейронов у выбранного провайдера
+func (w *MessageWorker) payPackage(callback *tgbotapi.CallbackQuery, provider, packageID string) {
+	chatID := callback.Message.Chat.ID
+	userID := int64(callback.From.ID)
+	ctx := context.Background()
+
+	id, err := strconv.Atoi(packageID)
+	if err != nil {
+		w.bot.SendMessage(chatID, "Пакет не найден.")
+		return
+	}
+
+	if provider == payment.ProviderYooKassa {
+		p, err := w.paymentService.CreatePackagePayment(ctx, userID, id)
+		if err != nil {
+			w.log.Error("Ошибка создания платежа за пакет нейронов",
+				zap.Int64("user_id", userID),
+				zap.Int("package_id", id),
+				zap.Error(err))
+			w.bot.SendMessage(chatID, "Не удалось создать платеж. Попробуйте позже.")
+			return
+		}
+
+		w.sendPaymentLink(chatID, p, "Покупка нейронов")
+		return
+	}
+
+	invoice, err := w.paymentService.CreatePackageInvoice(ctx, userID, id, provider)
+	if err != nil {
+		w.log.Error("Ошибка создания счета за пакет нейронов",
+			zap.Int64("user_id", userID),
+			zap.Int("package_id", id),
+			zap.String("provider", provider),
+			zap.Error(err))
+		w.bot.SendMessage(chatID, "Не удалось создать счет. Попробуйте позже.")
+		return
+	}
+
+	w.sendInvoice(chatID, invoice)
+}
+
+// sendInvoice отправляет пользователю счет Telegram Payments
+func (w *MessageWorker) sendInvoice(chatID int64, invoice *payment.Invoice) {
+	_, err := w.bot.SendInvoice(chatID, invoice.Title, invoice.Description, invoice.Payload,
+		invoice.ProviderToken, invoice.Currency, invoice.Amount)
+	if err != nil {
+		w.log.Error("Ошибка отправки счета",
+			zap.Int64("payment_id", invoice.PaymentID),
+			zap.Error(err))
+		w.bot.SendMessage(chatID, "Не удалось отправить счет. Попробуйте позже.")
+	}
+}
+
+// handlePreCheckoutQuery подтверждает или отклоняет оплату перед списанием средств
+func (w *MessageWorker) handlePreCheckoutQuery(query *tgbotapi.PreCheckoutQuery) {
+	userID := int64(query.From.ID)
+
+	answer := tgbotapi.PreCheckoutConfig{
+		PreCheckoutQueryID: query.ID,
+		OK:                 true,
+	}
+
+	err := w.paymentService.ValidatePreCheckout(context.Background(), userID, query.InvoicePayload, query.Currency, query.TotalAmount)
+	if err != nil {
+		w.log.Warn("Оплата отклонена при предварительной проверке",
+			zap.Int64("user_id", userID),
+			zap.String("payload", query.InvoicePayload),
+			zap.Error(err))
+
+		answer.OK = false
+		switch {
+		case errors.Is(err, payment.ErrPriceChanged):
+			answer.ErrorMessage = "Цена изменилась. Запросите новый счет."
+		case errors.Is(err, payment.ErrPaymentNotPayable):
+			answer.ErrorMessage = "Этот счет уже недействителен. Запросите новый счет."
+		default:
+			answer.ErrorMessage = "Не удалось проверить счет. Попробуйте позже."
+		}
+	}
+
+	if _, err := w.api.Request(answer); err != nil {
+		w.log.Error("Ошибка ответа на pre_checkout_query",
+			zap.Int64("user_id", userID),
+			zap.Error(err))
+	}
+}
+
+// handleSuccessfulPayment обрабатывает сообщение об успешной оплате счета
+func (w *MessageWorker) handleSuccessfulPayment(message *tgbotapi.Message) {
+	userID := int64(message.From.ID)
+	sp := message.SuccessfulPayment
+
+	err := w.paymentService.HandleTelegramPayment(context.Background(), userID, &payment.TelegramPaymentResult{
+		Currency:                sp.Currency,
+		TotalAmount:             sp.TotalAmount,
+		InvoicePayload:          sp.InvoicePayload,
+		TelegramPaymentChargeID: sp.TelegramPaymentChargeID,
+		ProviderPaymentChargeID: sp.ProviderPaymentChargeID,
+	})
+	if err != nil {
+		w.log.Error("Ошибка обработки успешной оплаты",
+			zap.Int64("user_id", userID),
+			zap.String("charge_id", sp.TelegramPaymentChargeID),
+			zap.Error(err))
+		w.bot.SendMessage(message.Chat.ID, "Оплата получена, но товар не удалось выдать автоматически. Мы уже разбираемся, обратитесь в поддержку, если он не появится в течение часа.")
+	}
+}
@@ -0,0 +1,176 @@
+package app
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+	"github.com/redis/go-redis/v9"
+	"go.uber.org/zap"
+
+	"neurobot-prod/internal/telegram"
+)
+
+// customPromptWaitTTL - время ожидания ввода собственного промпта
+const customPromptWaitTTL = 10 * time.Minute
+
+// customPromptWaitKey возвращает ключ Redis для состояния ожидания собственного промпта
+func customPromptWaitKey(userID int64) string {
+	return fmt.Sprintf("persona:await_prompt:%d", userID)
+}
+
+// handlePersonaCommand обрабатывает команду /persona
+func (w *MessageWorker) handlePersonaCommand(message *tgbotapi.Message) {
+	userID := int64(message.From.ID)
+	chatID := message.Chat.ID
+	args := strings.TrimSpace(message.CommandArguments())
+
+	// Собственный промпт можно задать сразу: /persona custom <текст>
+	if strings.HasPrefix(args, "custom ") {
+		w.applyCustomPrompt(chatID, userID, strings.TrimPrefix(args, "custom "))
+		return
+	}
+
+	ctx := context.Background()
+
+	conv, err := w.conversationService.GetActiveConversation(ctx, userID)
+	if err != nil {
+		w.log.Error("Ошибка получения диалога",
+			zap.Int64("user_id", userID),
+			zap.Error(err))
+		w.bot.SendMessage(chatID, "Произошла ошибка при получении настроек диалога. Попробуйте позже.")
+		return
+	}
+
+	personas, err := w.conversationService.GetPersonas(ctx)
+	if err != nil {
+		w.bot.SendMessage(chatID, "Произошла ошибка при получении списка персон. Попробуйте позже.")
+		return
+	}
+
+	var parts []string
+	parts = append(parts, fmt.Sprintf("*Текущая персона:* %s\n", conv.GetPersonaName()))
+	parts = append(parts, "Персона задает стиль и роль нейросети для всех запросов в диалоге.\n")
+
+	var rows [][]tgbotapi.InlineKeyboardButton
+	for _, persona := range personas {
+		if persona.Description != "" {
+			parts = append(parts, fmt.Sprintf("*%s* - %s", persona.Name, persona.Description))
+		}
+
+		label := persona.Name
+		if conv.Persona != nil && conv.Persona.ID == persona.ID && !conv.HasCustomPrompt() {
+			label = "✅ " + label
+		}
+		rows = append(rows, tgbotapi.NewInlineKeyboardRow(
+			tgbotapi.NewInlineKeyboardButtonData(label, "persona:set:"+persona.Code)))
+	}
+
+	customLabel := "✏️ Свой промпт"
+	if conv.HasCustomPrompt() {
+		customLabel = "✅ Свой промпт (изменить)"
+	}
+	rows = append(rows,
+		tgbotapi.NewInlineKeyboardRow(tgbotapi.NewInlineKeyboardButtonData(customLabel, "persona:custom")),
+		tgbotapi.NewInlineKeyboardRow(tgbotapi.NewInlineKeyboardButtonData("🚫 Без персоны", "persona:reset")),
+	)
+
+	w.bot.SendMessage(chatID, strings.Join(parts, "\n"),
+		telegram.WithParseMode("Markdown"),
+		telegram.WithReplyMarkup(tgbotapi.NewInlineKeyboardMarkup(rows...)))
+}
+
+// handlePersonaCallback обрабатывает нажатия на кнопки выбора персоны
+func (w *MessageWorker) handlePersonaCallback(callback *tgbotapi.CallbackQuery, parts []string) {
+	userID := int64(callback.From.ID)
+	chatID := callback.Message.Chat.ID
+	ctx := context.Background()
+
+	switch parts[1] {
+	case "set":
+		if len(parts) < 3 {
+			return
+		}
+		persona, err := w.conversationService.SelectPersona(ctx, userID, parts[2])
+		if err != nil {
+			w.bot.SendMessage(chatID, "Не удалось выбрать персону. Попробуйте позже.")
+			return
+		}
+		w.redis.Del(ctx, customPromptWaitKey(userID))
+		w.bot.SendMessage(chatID, fmt.Sprintf("✅ Выбрана персона «%s». Она будет применяться ко всем запросам в диалоге.", persona.Name))
+
+	case "custom":
+		maxLength, err := w.conversationService.GetCustomPromptMaxLength(ctx, userID)
+		if err != nil {
+			w.bot.SendMessage(chatID, "Произошла ошибка при проверке подписки. Попробуйте позже.")
+			return
+		}
+		if maxLength <= 0 {
+			w.bot.SendMessage(chatID, "Собственные промпты недоступны для вашего плана подписки. Подробнее: /subscribe")
+			return
+		}
+
+		if err := w.redis.Set(ctx, customPromptWaitKey(userID), "1", customPromptWaitTTL).Err(); err != nil {
+			w.log.Error("Ошибка сохранения состояния ожидания промпта",
+				zap.Int64("user_id", userID),
+				zap.Error(err))
+			w.bot.SendMessage(chatID, "Произошла ошибка. Попробуйте позже.")
+			return
+		}
+		w.bot.SendMessage(chatID, fmt.Sprintf(
+			"✏️ Отправьте следующим сообщением системный промпт (до %d символов).\n\n"+
+				"Например: «Отвечай кратко, как опытный юрист».\n"+
+				"Для отмены отправьте /cancel.",
+			maxLength))
+
+	case "reset":
+		if err := w.conversationService.ResetPersona(ctx, userID); err != nil {
+			w.bot.SendMessage(chatID, "Не удалось сбросить персону. Попробуйте позже.")
+			return
+		}
+		w.redis.Del(ctx, customPromptWaitKey(userID))
+		w.bot.SendMessage(chatID, "Персона сброшена. Нейросеть будет отвечать без дополнительных инструкций.")
+
+	default:
+		w.log.Warn("Неизвестное действие персоны",
+			zap.String("data", callback.Data))
+	}
+}
+
+// handlePendingCustomPrompt обрабатывает сообщение как собственный промпт, если бот его ожидает.
+// Возвращает true, если сообщение было обработано
+func (w *MessageWorker) handlePendingCustomPrompt(message *tgbotapi.Message) bool {
+	userID := int64(message.From.ID)
+	ctx := context.Background()
+
+	// GETDEL за один запрос проверяет и сбрасывает состояние ожидания
+	if err := w.redis.GetDel(ctx, customPromptWaitKey(userID)).Err(); err != nil {
+		if !errors.Is(err, redis.Nil) {
+			w.log.Error("Ошибка проверки состояния ожидания промпта",
+				zap.Int64("user_id", userID),
+				zap.Error(err))
+		}
+		return false
+	}
+
+	w.applyCustomPrompt(message.Chat.ID, userID, message.Text)
+	return true
+}
+
+// handleCancelCommand обрабатывает команду /cancel
+func (w *MessageWorker) handleCancelCommand(message *tgbotapi.Message) {
+	w.redis.Del(context.Background(), customPromptWaitKey(int64(message.From.ID)))
+	w.bot.SendMessage(message.Chat.ID, "Действие отменено.")
+}
+
+// applyCustomPrompt сохраняет собственный промпт пользователя
+func (w *MessageWorker) applyCustomPrompt(chatID, userID int64, prompt string) {
+	if err := w.conversationService.SetCustomPrompt(context.Background(), userID, prompt); err != nil {
+		w.bot.SendMessage(chatID, fmt.Sprintf("❌ Не удалось сохранить промпт: %s", err.Error()))
+		return
+	}
+	w.bot.SendMessage(chatID, "✅ Собственный промпт сохранен и будет применяться ко всем запросам в диалоге.")
+}
@@ -0,0 +1,148 @@
+package app
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+	"go.uber.org/zap"
+
+	"neurobot-prod/internal/subscription"
+	"neurobot-prod/internal/telegram"
+)
+
+// offerPlanChange показывает расчет смены плана, если у пользователя уже есть платная подписка.
+// Возвращает false, если подписки нет и план оформляется обычной покупкой
+func (w *MessageWorker) offerPlanChange(callback *tgbotapi.CallbackQuery, planCode, period string) bool {
+	chatID := callback.Message.Chat.ID
+	userID := int64(callback.From.ID)
+	ctx := context.Background()
+
+	discount, err := w.subService.PreviewPlanChange(ctx, userID, planCode, period, subscription.ChangeModeDiscount)
+	if errors.Is(err, subscription.ErrNoPaidSubscription) {
+		return false
+	}
+	if errors.Is(err, subscription.ErrSamePlan) {
+		w.bot.SendMessage(chatID, "У вас уже оформлена эта подписка.")
+		return true
+	}
+	if err != nil {
+		w.log.Error("Ошибка расчета смены плана",
+			zap.Int64("user_id", userID),
+			zap.String("plan_code", planCode),
+			zap.Error(err))
+		w.bot.SendMessage(chatID, "Не удалось рассчитать смену плана. Попробуйте позже.")
+		return true
+	}
+
+	var parts []string
+	var rows [][]tgbotapi.InlineKeyboardButton
+
+	if !discount.IsUpgrade {
+		parts = append(parts,
+			fmt.Sprintf("*Переход на «%s»*\n", discount.NewPlan.Name),
+			fmt.Sprintf("Текущая подписка «%s» действует до %s.", discount.CurrentPlan.Name, discount.Current.EndDate.Format("02.01.2006")),
+			"Новый план начнет действовать с этой даты.")
+		if discount.Price > 0 {
+			parts = append(parts, fmt.Sprintf("Стоимость продления: %.2f ₽.", float64(discount.Price)/100.0))
+		}
+		rows = append(rows, tgbotapi.NewInlineKeyboardRow(
+			tgbotapi.NewInlineKeyboardButtonData("Запланировать переход",
+				fmt.Sprintf("chplan:%s:%s:%s", planCode, discount.Period, subscription.ChangeModeDiscount))))
+	} else {
+		extend, err := w.subService.PreviewPlanChange(ctx, userID, planCode, period, subscription.ChangeModeExtend)
+		if err != nil {
+			w.log.Error("Ошибка расчета смены плана",
+				zap.Int64("user_id", userID),
+				zap.String("plan_code", planCode),
+				zap.Error(err))
+			w.bot.SendMessage(chatID, "Не удалось рассчитать смену плана. Попробуйте позже.")
+			return true
+		}
+
+		parts = append(parts,
+			fmt.Sprintf("*Переход с «%s» на «%s»*\n", discount.CurrentPlan.Name, discount.NewPlan.Name),
+			fmt.Sprintf("Остаток текущей подписки: %.2f ₽.", float64(discount.Credit)/100.0),
+			fmt.Sprintf("Цена нового плана: %.2f ₽.\n", float64(discount.Price)/100.0),
+			fmt.Sprintf("• Зачесть остаток: к оплате %.2f ₽, подписка до %s.",
+				float64(discount.AmountDue)/100.0, discount.EndDate.Format("02.01.2006")),
+			fmt.Sprintf("• Продлить срок: к оплате %.2f ₽, +%d дн., подписка до %s.",
+				float64(extend.AmountDue)/100.0, extend.ExtraDays, extend.EndDate.Format("02.01.2006")))
+
+		rows = append(rows,
+			tgbotapi.NewInlineKeyboardRow(tgbotapi.NewInlineKeyboardButtonData(
+				fmt.Sprintf("Зачесть остаток (%.0f ₽)", float64(discount.AmountDue)/100.0),
+				fmt.Sprintf("chplan:%s:%s:%s", planCode, discount.Period, subscription.ChangeModeDiscount))),
+			tgbotapi.NewInlineKeyboardRow(tgbotapi.NewInlineKeyboardButtonData(
+				fmt.Sprintf("Продлить срок (%.0f ₽)", float64(extend.AmountDue)/100.0),
+				fmt.Sprintf("chplan:%s:%s:%s", planCode, extend.Period, subscription.ChangeModeExtend))))
+	}
+
+	w.bot.SendMessage(chatID, strings.Join(parts, "\n"),
+		telegram.WithParseMode("Markdown"),
+		telegram.WithReplyMarkup(tgbotapi.NewInlineKeyboardMarkup(rows...)))
+	return true
+}
+
+// handlePlanChangeCallback обрабатывает подтверждение смены плана: chplan:<план>:<период>:<режим>
+func (w *MessageWorker) handlePlanChangeCallback(callback *tgbotapi.CallbackQuery, parts []string) {
+	if len(parts) < 4 {
+		return
+	}
+
+	chatID := callback.Message.Chat.ID
+	userID := int64(callback.From.ID)
+	planCode, period, mode := parts[1], parts[2], subscription.ChangeMode(parts[3])
+	ctx := context.Background()
+
+	preview, err := w.subService.PreviewPlanChange(ctx, userID, planCode, period, mode)
+	if err != nil {
+		w.log.Error("Ошибка расчета смены плана",
+			zap.Int64("user_id", userID),
+			zap.String("plan_code", planCode),
+			zap.Error(err))
+		w.bot.SendMessage(chatID, "Не удалось сменить план. Попробуйте позже.")
+		return
+	}
+
+	// Понижение и повышение, полностью покрытое остатком, не требуют оплаты
+	if !preview.IsUpgrade || preview.AmountDue <= 0 {
+		result, err := w.subService.ChangePlan(ctx, subscription.ChangePlanRequest{
+			UserID:   userID,
+			PlanCode: planCode,
+			Period:   period,
+			Mode:     mode,
+		})
+		if err != nil {
+			w.log.Error("Ошибка смены плана",
+				zap.Int64("user_id", userID),
+				zap.String("plan_code", planCode),
+				zap.Error(err))
+			w.bot.SendMessage(chatID, "Не удалось сменить план. Попробуйте позже.")
+			return
+		}
+
+		if result.IsUpgrade {
+			w.bot.SendMessage(chatID, fmt.Sprintf("✅ Подписка «%s» активна до %s.",
+				result.NewPlan.Name, result.EndDate.Format("02.01.2006")))
+		} else {
+			w.bot.SendMessage(chatID, fmt.Sprintf("✅ Переход на «%s» запланирован с %s.",
+				result.NewPlan.Name, result.StartDate.Format("02.01.2006")))
+		}
+		return
+	}
+
+	p, err := w.paymentService.CreatePlanChangePayment(ctx, userID, planCode, period, mode)
+	if err != nil {
+		w.log.Error("Ошибка создания платежа за смену плана",
+			zap.Int64("user_id", userID),
+			zap.String("plan_code", planCode),
+			zap.Error(err))
+		w.bot.SendMessage(chatID, "Не удалось создать платеж. Попробуйте позже.")
+		return
+	}
+
+	w.sendPaymentLink(chatID, p, fmt.Sprintf("Переход на подписку «%s»", preview.NewPlan.Name))
+}
@@ -0,0 +1,163 @@
+package app
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+	"go.uber.org/zap"
+
+	"neurobot-prod/internal/promo"
+)
+
+// handlePromoCommand обрабатывает команду /promo
+func (w *MessageWorker) handlePromoCommand(message *tgbotapi.Message) {
+	userID := int64(message.From.ID)
+	chatID := message.Chat.ID
+	code := strings.TrimSpace(message.CommandArguments())
+
+	if code == "" {
+		w.bot.SendMessage(chatID, "Использование: /promo <код>\n\nПример: /promo NEURO2025")
+		return
+	}
+
+	result, err := w.promoService.Redeem(context.Background(), userID, code)
+	if err != nil {
+		switch {
+		case errors.Is(err, promo.ErrNotFound):
+			w.bot.SendMessage(chatID, "❌ Промокод не найден.")
+		case errors.Is(err, promo.ErrExpired):
+			w.bot.SendMessage(chatID, "❌ Срок действия промокода истек.")
+		case errors.Is(err, promo.ErrExhausted):
+			w.bot.SendMessage(chatID, "❌ Промокод больше недоступен: лимит активаций исчерпан.")
+		case errors.Is(err, promo.ErrAlreadyUsed):
+			w.bot.SendMessage(chatID, "Вы уже активировали этот промокод.")
+		case errors.Is(err, promo.ErrNotApplicable):
+			w.bot.SendMessage(chatID, "❌ Этот промокод нельзя применить: пробный период доступен один раз и только без платной подписки.")
+		default:
+			w.log.Error("Ошибка активации промокода",
+				zap.Int64("user_id", userID),
+				zap.Error(err))
+			w.bot.SendMessage(chatID, "Произошла ошибка при активации промокода. Попробуйте позже.")
+		}
+		return
+	}
+
+	p := result.Promocode
+	var text string
+	switch p.DiscountType {
+	case promo.DiscountNeurons:
+		text = fmt.Sprintf("✅ Промокод активирован! Начислено %d нейронов.\nТекущий баланс: %d нейронов.",
+			result.Transaction.Amount, result.Transaction.BalanceAfter)
+	case promo.DiscountFreeTrial:
+		text = fmt.Sprintf("✅ Промокод активирован! Пробная подписка «%s» действует до %s.",
+			result.Subscription.Plan.Name, result.Subscription.EndDate.Format("02.01.2006"))
+	case promo.DiscountPercent:
+		text = fmt.Sprintf("✅ Промокод активирован! Скидка %d%% будет применена при оплате подписки: /subscribe", p.DiscountValue)
+	case promo.DiscountFixed:
+		text = fmt.Sprintf("✅ Промокод активирован! Скидка %.2f ₽ будет применена при оплате подписки: /subscribe",
+			float64(p.DiscountValue)/100.0)
+	}
+
+	w.bot.SendMessage(chatID, text)
+}
+
+// handlePromoGenCommand обрабатывает команду администратора /promogen
+func (w *MessageWorker) handlePromoGenCommand(message *tgbotapi.Message) {
+	userID := int64(message.From.ID)
+	chatID := message.Chat.ID
+
+	if !w.isAdmin(userID) {
+		w.bot.SendMessage(chatID, "Неизвестная команда. Введите /help для получения списка доступных команд.")
+		return
+	}
+
+	usage := "Использование: /promogen <тип> <значение> <количество> [лимит] [дней] [план]\n\n" +
+		"Типы: percent (%), fixed (копейки), neurons (нейроны), free_trial (дни пробного периода)\n" +
+		"Лимит 0 - без ограничений, дней 0 - бессрочно\n" +
+		"Пример: /promogen neurons 500 10 1 30"
+
+	args := strings.Fields(message.CommandArguments())
+	if len(args) < 3 {
+		w.bot.SendMessage(chatID, usage)
+		return
+	}
+
+	numbers := make([]int, 0, 4)
+	for _, arg := range args[1:] {
+		if len(numbers) == 4 {
+			break
+		}
+		n, err := strconv.Atoi(arg)
+		if err != nil {
+			break
+		}
+		numbers = append(numbers, n)
+	}
+	if len(numbers) < 2 {
+		w.bot.SendMessage(chatID, usage)
+		return
+	}
+
+	req := promo.BatchRequest{
+		Prefix:       "NB",
+		DiscountType: promo.DiscountType(args[0]),
+		Value:        numbers[0],
+		Count:        numbers[1],
+		CreatedBy:    strconv.FormatInt(userID, 10),
+	}
+	if len(numbers) > 2 && numbers[2] > 0 {
+		req.MaxUses = &numbers[2]
+	}
+	if len(numbers) > 3 && numbers[3] > 0 {
+		endDate := time.Now().AddDate(0, 0, numbers[3])
+		req.EndDate = &endDate
+	}
+
+	// План указывается последним аргументом после чисел
+	if planArgIndex := len(numbers) + 1; len(args) > planArgIndex {
+		plan, err := w.subService.GetPlanByCode(context.Background(), args[planArgIndex])
+		if err != nil {
+			w.bot.SendMessage(chatID, fmt.Sprintf("❌ План «%s» не найден.", args[planArgIndex]))
+			return
+		}
+		req.PlanID = &plan.ID
+	}
+
+	codes, err := w.promoService.GenerateBatch(context.Background(), req)
+	if err != nil {
+		w.log.Error("Ошибка генерации промокодов",
+			zap.Int64("admin_id", userID),
+			zap.Error(err))
+		if len(codes) == 0 {
+			// Ошибки базы данных не показываются, сообщаются только неверные параметры
+			if errors.Is(err, promo.ErrInvalidBatch) {
+				w.bot.SendMessage(chatID, "❌ "+err.Error())
+			} else {
+				w.bot.SendMessage(chatID, "❌ Не удалось создать промокоды. Попробуйте позже.")
+			}
+			return
+		}
+	}
+
+	lines := make([]string, 0, len(codes))
+	for _, p := range codes {
+		lines = append(lines, p.Code)
+	}
+
+	caption := fmt.Sprintf("Создано промокодов: %d (%s, %d)", len(codes), req.DiscountType, req.Value)
+	file := tgbotapi.FileBytes{
+		Name:  fmt.Sprintf("promocodes_%s.txt", time.Now().Format("20060102_150405")),
+		Bytes: []byte(strings.Join(lines, "\n")),
+	}
+	if _, err := w.bot.SendDocument(chatID, file, caption); err != nil {
+		w.log.Error("Ошибка отправки промокодов",
+			zap.Int64("admin_id", userID),
+			zap.Error(err))
+		w.bot.SendMessage(chatID, caption+"\n\nНе удалось отправить файл с кодами. Попробуйте позже.")
+	}
+}
@@ -0,0 +1,29 @@
+package app
+
+import (
+	"context"
+	"fmt"
+
+	"go.uber.org/zap"
+
+	"neurobot-prod/internal/config"
+	"neurobot-prod/internal/currency"
+	"neurobot-prod/internal/storage/postgres"
+	"neurobot-prod/internal/subscription"
+)
+
+// RunReconciliation сверяет балансы нейронов с главной книгой и при repair исправляет расхождения
+func RunReconciliation(ctx context.Context, cfg *config.Config, log *zap.Logger, repair bool) (*currency.ReconcileReport, error) {
+	logger := log.Named("reconcile")
+
+	db, err := postgres.NewPostgresDB(cfg.DB, logger)
+	if err != nil {
+		return nil, fmt.Errorf("ошибка подключения к базе данных: %w", err)
+	}
+	defer db.Close()
+
+	subService := subscription.NewService(subscription.NewRepository(db), logger)
+	currencyService := currency.NewService(currency.NewRepository(db), subService, logger)
+
+	return currencyService.Reconcile(ctx, repair)
+}
@@ -0,0 +1,107 @@
+package app
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+	"go.uber.org/zap"
+
+	"neurobot-prod/internal/referral"
+)
+
+// handleRefCommand обрабатывает команду /ref
+func (w *MessageWorker) handleRefCommand(message *tgbotapi.Message) {
+	userID := int64(message.From.ID)
+	chatID := message.Chat.ID
+
+	if !w.referralService.Enabled() {
+		w.bot.SendMessage(chatID, "Реферальная программа сейчас недоступна.")
+		return
+	}
+
+	stats, err := w.referralService.GetStats(context.Background(), userID)
+	if err != nil {
+		w.log.Error("Ошибка получения реферальной статистики",
+			zap.Int64("user_id", userID),
+			zap.Error(err))
+		w.bot.SendMessage(chatID, "Произошла ошибка при получении реферальной ссылки. Попробуйте позже.")
+		return
+	}
+
+	cfg := w.referralService.GetConfig()
+	link := fmt.Sprintf("https://t.me/%s?start=%s%s", w.api.Self.UserName, referral.DeepLinkPrefix, stats.Code.ReferralCode)
+
+	var parts []string
+	parts = append(parts, "👥 Приглашайте друзей и получайте нейроны!\n")
+	parts = append(parts, fmt.Sprintf("Ваша ссылка:\n%s\n", link))
+	parts = append(parts, "Как это работает:")
+	if cfg.ReferredBonus > 0 {
+		parts = append(parts, fmt.Sprintf("• Друг получает %d нейронов сразу после перехода по ссылке", cfg.ReferredBonus))
+	}
+	if cfg.ReferrerBonus > 0 {
+		parts = append(parts, fmt.Sprintf("• Вы получаете %d нейронов, когда друг сделает %d запросов к нейросети",
+			cfg.ReferrerBonus, cfg.ActivationRequests))
+	}
+	if stats.PurchasePercent > 0 {
+		parts = append(parts, fmt.Sprintf("• Вы получаете %d%% от покупок друга в нейронах", stats.PurchasePercent))
+	}
+
+	parts = append(parts, "\n📊 Статистика:")
+	parts = append(parts, fmt.Sprintf("Приглашено: %d", stats.Code.TotalReferrals))
+	parts = append(parts, fmt.Sprintf("Активных: %d", stats.Code.ActiveReferrals))
+	if stats.PendingCount > 0 {
+		parts = append(parts, fmt.Sprintf("Ожидают активации: %d", stats.PendingCount))
+	}
+	parts = append(parts, fmt.Sprintf("Заработано: %d нейронов", stats.Code.TotalEarnings))
+
+	if stats.NextTierActive > 0 {
+		parts = append(parts, fmt.Sprintf("\n⬆️ Пригласите еще %d активных друзей, чтобы получать %d%% от их покупок.",
+			stats.NextTierActive-stats.Code.ActiveReferrals, stats.NextTierPercent))
+	}
+
+	w.bot.SendMessage(chatID, strings.Join(parts, "\n"))
+}
+
+// handleReferralDeepLink обрабатывает переход по реферальной ссылке
+func (w *MessageWorker) handleReferralDeepLink(message *tgbotapi.Message, code string) {
+	userID := int64(message.From.ID)
+	chatID := message.Chat.ID
+
+	_, bonus, err := w.referralService.RegisterReferral(context.Background(), userID, code)
+	if err != nil {
+		switch {
+		case errors.Is(err, referral.ErrInvalidCode),
+			errors.Is(err, referral.ErrSelfReferral),
+			errors.Is(err, referral.ErrAlreadyReferred),
+			errors.Is(err, referral.ErrNotNewUser),
+			errors.Is(err, referral.ErrDisabled):
+			// Повторный /start по ссылке - обычная ситуация, сообщать об этом не нужно
+			w.log.Debug("Реферальная ссылка не применена",
+				zap.Int64("user_id", userID),
+				zap.String("code", code),
+				zap.Error(err))
+		default:
+			w.log.Error("Ошибка обработки реферальной ссылки",
+				zap.Int64("user_id", userID),
+				zap.String("code", code),
+				zap.Error(err))
+		}
+		return
+	}
+
+	if bonus > 0 {
+		w.bot.SendMessage(chatID, fmt.Sprintf("🎁 Вы пришли по приглашению друга! Начислено %d нейронов.", bonus))
+	}
+}
+
+// trackReferralActivity засчитывает запрос к нейросети для активации реферала
+func (w *MessageWorker) trackReferralActivity(userID int64) {
+	if err := w.referralService.TrackActivity(context.Background(), userID); err != nil {
+		w.log.Error("Ошибка учета активности реферала",
+			zap.Int64("user_id", userID),
+			zap.Error(err))
+	}
+}
@@ -0,0 +1,117 @@
+// Обработчики возвратов нейронов и платежей
+
+package app
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+	"go.uber.org/zap"
+
+	"neurobot-prod/internal/currency"
+	"neurobot-prod/internal/llm"
+	"neurobot-prod/internal/payment"
+)
+
+// neuralErrorText возвращает текст для пользователя по ошибке запроса к нейросети
+func neuralErrorText(err error) string {
+	switch {
+	case errors.Is(err, llm.ErrEmptyResponse):
+		return "🤷 Нейросеть не вернула ответ. Нейроны за запрос возвращены, попробуйте переформулировать вопрос."
+	case errors.Is(err, llm.ErrResponseBlocked):
+		return "🚫 Ответ заблокирован фильтром безопасности нейросети. Нейроны за запрос возвращены."
+	default:
+		return "Произошла ошибка при обработке запроса к нейросети. Попробуйте позже."
+	}
+}
+
+// compensateDelivery возвращает нейроны за ответ, который не удалось доставить пользователю.
+// Возвращает true, если нейроны возвращены
+func (w *MessageWorker) compensateDelivery(userID, transactionID int64, sendErr error) bool {
+	w.log.Error("Ошибка доставки оплаченного ответа",
+		zap.Int64("user_id", userID),
+		zap.Int64("transaction_id", transactionID),
+		zap.Error(sendErr))
+
+	// Ответ из кэша не оплачивался
+	if transactionID == 0 {
+		return false
+	}
+
+	if _, err := w.currencyService.Refund(context.Background(), transactionID, currency.RefundDeliveryFailed, ""); err != nil {
+		w.log.Error("Ошибка возврата нейронов за недоставленный ответ",
+			zap.Int64("user_id", userID),
+			zap.Int64("transaction_id", transactionID),
+			zap.Error(err))
+		return false
+	}
+
+	return true
+}
+
+// handleRefundCommand обрабатывает команду администратора /refund <ID платежа> [комментарий]
+func (w *MessageWorker) handleRefundCommand(message *tgbotapi.Message) {
+	userID := int64(message.From.ID)
+	chatID := message.Chat.ID
+
+	if !w.isAdmin(userID) {
+		w.bot.SendMessage(chatID, "Неизвестная команда. Введите /help для получения списка доступных команд.")
+		return
+	}
+
+	args := strings.Fields(message.CommandArguments())
+	if len(args) == 0 {
+		w.bot.SendMessage(chatID, "Использование: /refund <ID платежа> [комментарий]\n\n"+
+			"Деньги возвращаются через платежную систему, начисленные нейроны списываются в пределах баланса, "+
+			"подписка, оплаченная платежом, отменяется.")
+		return
+	}
+
+	paymentID, err := strconv.ParseInt(args[0], 10, 64)
+	if err != nil {
+		w.bot.SendMessage(chatID, "❌ Некорректный ID платежа.")
+		return
+	}
+	comment := strings.Join(args[1:], " ")
+
+	result, err := w.paymentService.RefundPayment(context.Background(), paymentID, comment)
+	if err != nil {
+		switch {
+		case errors.Is(err, payment.ErrUnknownPayment):
+			w.bot.SendMessage(chatID, "❌ Платеж не найден.")
+		case errors.Is(err, payment.ErrNotRefundable):
+			w.bot.SendMessage(chatID, "❌ Платеж не оплачен или уже возвращен.")
+		default:
+			w.log.Error("Ошибка возврата платежа",
+				zap.Int64("admin_id", userID),
+				zap.Int64("payment_id", paymentID),
+				zap.Error(err))
+			w.bot.SendMessage(chatID, fmt.Sprintf("❌ Не удалось вернуть платеж: %s", err.Error()))
+		}
+		return
+	}
+
+	w.log.Info("Платеж возвращен администратором",
+		zap.Int64("admin_id", userID),
+		zap.Int64("payment_id", paymentID),
+		zap.String("comment", comment))
+
+	text := fmt.Sprintf("✅ Платеж #%d на %.2f ₽ возвращен (пользователь %d).",
+		result.Payment.ID, result.Payment.GetAmountRub(), result.Payment.UserID)
+	if result.Manual {
+		text += "\n⚠️ Деньги нужно вернуть вручную в кабинете платежного провайдера."
+	} else if result.ProviderRefundID != "" {
+		text += "\nID возврата: " + result.ProviderRefundID
+	}
+	if result.NeuronsCredited > 0 {
+		text += fmt.Sprintf("\nСписано нейронов: %d из %d начисленных.", result.NeuronsReversed, result.NeuronsCredited)
+	}
+	if result.SubscriptionCancelled {
+		text += "\nПодписка отменена."
+	}
+	w.bot.SendMessage(chatID, text)
+}
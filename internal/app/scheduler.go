@@ -0,0 +1,207 @@
+package app
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+	"go.uber.org/zap"
+
+	"neurobot-prod/internal/admin"
+	"neurobot-prod/internal/config"
+	"neurobot-prod/internal/currency"
+	"neurobot-prod/internal/events"
+	"neurobot-prod/internal/loyalty"
+	"neurobot-prod/internal/payment"
+	"neurobot-prod/internal/queue"
+	"neurobot-prod/internal/referral"
+	"neurobot-prod/internal/scheduler"
+	"neurobot-prod/internal/storage/postgres"
+	redisStorage "neurobot-prod/internal/storage/redis"
+	"neurobot-prod/internal/streak"
+	"neurobot-prod/internal/subscription"
+	"neurobot-prod/internal/telegram"
+	"neurobot-prod/internal/user"
+)
+
+// JobScheduler выполняет периодические задачи: списание истекших нейронов, продление
+// и завершение подписок, отмену неоплаченных платежей, повтор прерванной выдачи оплаченных
+// товаров, напоминания и прогрев кэшей
+type JobScheduler struct {
+	db        *sql.DB
+	redis     *redis.Client
+	publisher *queue.Publisher
+	scheduler *scheduler.Scheduler
+	errorLog  *admin.ErrorLog
+	log       *zap.Logger
+}
+
+// NewJobScheduler создает планировщик и регистрирует задачи
+func NewJobScheduler(cfg *config.Config, log *zap.Logger) (*JobScheduler, error) {
+	logger := log.Named("job_scheduler")
+
+	// Подключаемся к базе данных
+	db, err := postgres.NewPostgresDB(cfg.DB, logger)
+	if err != nil {
+		return nil, fmt.Errorf("ошибка подключения к базе данных: %w", err)
+	}
+
+	// Ошибки задач сохраняются для просмотра в консоли администратора
+	adminRepo := admin.NewRepository(db)
+	var errorLog *admin.ErrorLog
+	if cfg.Admin.ErrorLogEnabled {
+		errorLog = admin.NewErrorLog(adminRepo, cfg.Admin.ErrorLogBuffer)
+		logger = logger.WithOptions(errorLog.Hook())
+	}
+
+	// Подключаемся к Redis
+	redisClient, err := redisStorage.NewRedisClient(cfg.Redis, logger)
+	if err != nil {
+		return nil, fmt.Errorf("ошибка подключения к Redis: %w", err)
+	}
+
+	// Создаем бота для уведомлений пользователей
+	bot, err := telegram.NewBot(cfg.Telegram, logger)
+	if err != nil {
+		return nil, fmt.Errorf("ошибка создания Telegram бота: %w", err)
+	}
+
+	// Доменные события задач (например, о продлении подписки) обрабатывает message worker
+	publisher, err := queue.NewPublisher(cfg.NATS, logger)
+	if err != nil {
+		return nil, fmt.Errorf("ошибка создания NATS publisher: %w", err)
+	}
+
+	notify := func(userID int64, text string) {
+		bot.SendMessage(userID, text)
+	}
+
+	// Создаем сервисы
+	subService := subscription.NewService(subscription.NewRepository(db), logger)
+	currencyService := currency.NewService(currency.NewRepository(db), subService, logger)
+	userService := user.NewService(user.NewRepository(db), redisClient, logger)
+	paymentService := payment.NewService(payment.NewRepository(db), cfg.Payment, subService, currencyService, logger)
+	paymentService.SetNotifier(notify)
+	subService.SetRenewals(paymentService, cfg.Subscription, notify)
+	referralService := referral.NewService(referral.NewRepository(db), currencyService, cfg.Referral, logger)
+	referralService.SetNotifier(notify)
+	paymentService.SetReferrals(referralService)
+	loyaltyService := loyalty.NewService(loyalty.NewRepository(db), cfg.Loyalty, logger)
+	loyaltyService.SetNotifier(notify)
+	paymentService.SetLoyalty(loyaltyService)
+	referralService.SetLoyalty(loyaltyService)
+	streakService := streak.NewService(streak.NewRepository(db), currencyService, cfg.Streak, logger)
+	streakService.SetNotifier(notify)
+
+	eventBus := events.NewBus(publisher, cfg.NATS.Subjects.Events, logger)
+	currencyService.SetEvents(eventBus)
+	subService.SetEvents(eventBus)
+	referralService.SetEvents(eventBus)
+
+	// Создаем планировщик
+	jobRepo := scheduler.NewRepository(db)
+	locker := scheduler.NewLocker(redisClient, cfg.Scheduler.GetLockTTL(), logger)
+	sched, err := scheduler.NewScheduler(jobRepo, locker, cfg.Scheduler, logger)
+	if err != nil {
+		return nil, fmt.Errorf("ошибка создания планировщика: %w", err)
+	}
+
+	retention := time.Duration(cfg.Scheduler.RetentionDays) * 24 * time.Hour
+	jobs := []struct {
+		name string
+		run  scheduler.JobFunc
+	}{
+		{"expire_neurons", func(ctx context.Context) (string, error) {
+			count, err := currencyService.ProcessExpiredNeurons(ctx)
+			return fmt.Sprintf("пользователей: %d", count), err
+		}},
+		{"renew_subscriptions", func(ctx context.Context) (string, error) {
+			count, err := subService.ProcessRenewals(ctx)
+			return fmt.Sprintf("продлено: %d", count), err
+		}},
+		{"expire_subscriptions", func(ctx context.Context) (string, error) {
+			count, err := subService.ExpireSubscriptions(ctx)
+			return fmt.Sprintf("истекло: %d", count), err
+		}},
+		{"expire_pending_payments", func(ctx context.Context) (string, error) {
+			count, err := paymentService.ExpirePendingPayments(ctx, cfg.Scheduler.GetPendingPaymentTTL())
+			return fmt.Sprintf("отменено: %d", count), err
+		}},
+		{"retry_fulfillments", func(ctx context.Context) (string, error) {
+			count, err := paymentService.RetryFulfillments(ctx)
+			return fmt.Sprintf("выдано: %d", count), err
+		}},
+		{"streak_reminders", func(ctx context.Context) (string, error) {
+			count, err := streakService.SendReminders(ctx)
+			return fmt.Sprintf("отправлено: %d", count), err
+		}},
+		{"warm_caches", func(ctx context.Context) (string, error) {
+			count, err := userService.RefreshUserCount(ctx)
+			return fmt.Sprintf("пользователей: %d", count), err
+		}},
+		{"cleanup_logs", func(ctx context.Context) (string, error) {
+			if cfg.Scheduler.RetentionDays <= 0 {
+				return "хранение не ограничено", nil
+			}
+			before := time.Now().Add(-retention)
+			errorsDeleted, err := adminRepo.DeleteErrorsBefore(ctx, before)
+			if err != nil {
+				return "", err
+			}
+			runsDeleted, err := jobRepo.DeleteRunsBefore(ctx, before)
+			if err != nil {
+				return "", err
+			}
+			return fmt.Sprintf("удалено ошибок: %d, запусков задач: %d", errorsDeleted, runsDeleted), nil
+		}},
+	}
+	for _, job := range jobs {
+		if err := sched.Register(job.name, job.run); err != nil {
+			return nil, err
+		}
+	}
+
+	return &JobScheduler{
+		db:        db,
+		redis:     redisClient,
+		publisher: publisher,
+		scheduler: sched,
+		errorLog:  errorLog,
+		log:       logger,
+	}, nil
+}
+
+// Start запускает выполнение задач по расписанию
+func (s *JobScheduler) Start() {
+	s.scheduler.Start()
+	s.log.Info("Планировщик задач запущен")
+}
+
+// Stop прерывает выполняющиеся задачи и закрывает соединения
+func (s *JobScheduler) Stop() {
+	s.scheduler.Stop()
+
+	// Закрываем соединение с NATS
+	if s.publisher != nil {
+		s.publisher.Close()
+	}
+
+	// Дописываем накопленные ошибки до закрытия базы данных
+	if s.errorLog != nil {
+		s.errorLog.Close()
+	}
+
+	// Закрываем соединение с базой данных
+	if s.db != nil {
+		s.db.Close()
+	}
+
+	// Закрываем соединение с Redis
+	if s.redis != nil {
+		s.redis.Close()
+	}
+
+	s.log.Info("Планировщик задач остановлен")
+}
@@ -0,0 +1,154 @@
+package app
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+	"go.uber.org/zap"
+
+	"neurobot-prod/internal/streak"
+	"neurobot-prod/internal/telegram"
+)
+
+// handleStreakCommand обрабатывает команду /streak
+func (w *MessageWorker) handleStreakCommand(message *tgbotapi.Message) {
+	userID := int64(message.From.ID)
+	chatID := message.Chat.ID
+
+	// /streak tz <часовой пояс> - смена часового пояса
+	args := strings.Fields(message.CommandArguments())
+	if len(args) > 0 && args[0] == "tz" {
+		if len(args) < 2 {
+			w.bot.SendMessage(chatID, "Укажите часовой пояс, например: /streak tz Europe/Moscow")
+			return
+		}
+		st, err := w.streakService.SetTimezone(context.Background(), userID, args[1])
+		if err != nil {
+			if errors.Is(err, streak.ErrInvalidTimezone) {
+				w.bot.SendMessage(chatID, "Неизвестный часовой пояс. Используйте название из базы IANA, например: Europe/Moscow, Asia/Yekaterinburg, Asia/Novosibirsk.")
+				return
+			}
+			w.bot.SendMessage(chatID, "Произошла ошибка при сохранении часового пояса. Попробуйте позже.")
+			return
+		}
+		w.bot.SendMessage(chatID, fmt.Sprintf("🕒 Часовой пояс изменен: %s. Новый день для /daily начинается в полночь по этому времени.", st.Timezone))
+		return
+	}
+
+	st, err := w.streakService.Get(context.Background(), userID)
+	if err != nil {
+		w.bot.SendMessage(chatID, "Произошла ошибка при получении информации о серии. Попробуйте позже.")
+		return
+	}
+
+	w.sendStreakInfo(chatID, st)
+}
+
+// sendStreakInfo отправляет информацию о серии с кнопками управления
+func (w *MessageWorker) sendStreakInfo(chatID int64, st *streak.Streak) {
+	cfg := w.streakService.GetConfig()
+	now := time.Now()
+
+	current := st.CurrentStreak
+	if current > 0 && st.MissedDays(now) > st.Freezes {
+		current = 0 // Серия прервется при следующем начислении
+	}
+
+	var parts []string
+	parts = append(parts, "🔥 Серия ежедневных начислений\n")
+	parts = append(parts, fmt.Sprintf("Текущая серия: %d дн.", current))
+	parts = append(parts, fmt.Sprintf("Рекорд: %d дн.", st.LongestStreak))
+	if st.ClaimedToday(now) {
+		parts = append(parts, "Сегодня начисление уже получено ✅")
+	} else {
+		next := current + 1
+		parts = append(parts, fmt.Sprintf("Следующее начисление: день %d, бонус +%d%%", next, cfg.GetBonusPercent(next)))
+	}
+	parts = append(parts, fmt.Sprintf("Заморозки: %d из %d", st.Freezes, cfg.MaxFreezes))
+	parts = append(parts, fmt.Sprintf("Часовой пояс: %s", st.Timezone))
+
+	reminders := "выключены"
+	if st.RemindersEnabled {
+		reminders = "включены"
+	}
+	parts = append(parts, fmt.Sprintf("Напоминания: %s", reminders))
+
+	parts = append(parts, fmt.Sprintf("\nКаждый день серии добавляет +%d%% к ежедневному начислению (до +%d%%). "+
+		"Если пропустить день, серия начнется заново — заморозка сохранит ее за один пропущенный день.",
+		cfg.BonusPercentPerDay, cfg.MaxBonusPercent))
+	parts = append(parts, "Сменить часовой пояс: /streak tz Europe/Moscow")
+
+	var rows [][]tgbotapi.InlineKeyboardButton
+	if cfg.FreezePrice > 0 && st.Freezes < cfg.MaxFreezes {
+		rows = append(rows, tgbotapi.NewInlineKeyboardRow(
+			tgbotapi.NewInlineKeyboardButtonData(fmt.Sprintf("❄️ Купить заморозку (%d нейронов)", cfg.FreezePrice), "streak:freeze")))
+	}
+	if st.RemindersEnabled {
+		rows = append(rows, tgbotapi.NewInlineKeyboardRow(
+			tgbotapi.NewInlineKeyboardButtonData("🔕 Выключить напоминания", "streak:remind:off")))
+	} else {
+		rows = append(rows, tgbotapi.NewInlineKeyboardRow(
+			tgbotapi.NewInlineKeyboardButtonData("🔔 Напоминать о /daily", "streak:remind:on")))
+	}
+
+	w.bot.SendMessage(chatID, strings.Join(parts, "\n"),
+		telegram.WithReplyMarkup(tgbotapi.NewInlineKeyboardMarkup(rows...)))
+}
+
+// handleStreakCallback обрабатывает кнопки управления серией
+func (w *MessageWorker) handleStreakCallback(callback *tgbotapi.CallbackQuery, parts []string) {
+	userID := int64(callback.From.ID)
+	chatID := callback.Message.Chat.ID
+	ctx := context.Background()
+
+	switch parts[1] {
+	case "freeze":
+		st, err := w.streakService.BuyFreeze(ctx, userID)
+		if err != nil {
+			switch {
+			case errors.Is(err, streak.ErrFreezeLimit):
+				w.bot.SendMessage(chatID, "У вас уже максимальное количество заморозок.")
+			case errors.Is(err, streak.ErrInsufficientNeurons):
+				w.bot.SendMessage(chatID, "Недостаточно нейронов для покупки заморозки. Пополнить баланс: /buy")
+			default:
+				w.log.Error("Ошибка покупки заморозки",
+					zap.Int64("user_id", userID),
+					zap.Error(err))
+				w.bot.SendMessage(chatID, "Произошла ошибка при покупке заморозки. Попробуйте позже.")
+			}
+			return
+		}
+		w.bot.SendMessage(chatID, fmt.Sprintf("❄️ Заморозка куплена! В запасе: %d. Она автоматически сохранит серию, если вы пропустите день.", st.Freezes))
+
+	case "remind":
+		if len(parts) < 3 {
+			return
+		}
+		enabled := parts[2] == "on"
+		if err := w.streakService.SetReminders(ctx, userID, enabled); err != nil {
+			w.bot.SendMessage(chatID, "Произошла ошибка при изменении настроек напоминаний. Попробуйте позже.")
+			return
+		}
+		if enabled {
+			w.bot.SendMessage(chatID, fmt.Sprintf("🔔 Напоминания включены. Если вы не получите ежедневные нейроны до %d:00 по вашему времени, я напомню.",
+				w.streakService.GetConfig().ReminderHour))
+		} else {
+			w.bot.SendMessage(chatID, "🔕 Напоминания выключены.")
+		}
+	}
+}
+
+// sendDailyAlreadyClaimed сообщает, когда будет доступно следующее начисление
+func (w *MessageWorker) sendDailyAlreadyClaimed(chatID int64, st *streak.Streak) {
+	timeLeft := time.Until(st.NextClaimAt(time.Now()))
+	hours := int(timeLeft.Hours())
+	minutes := int(timeLeft.Minutes()) % 60
+
+	w.bot.SendMessage(chatID,
+		fmt.Sprintf("Вы уже получили ежедневные нейроны. Следующее начисление будет доступно через %d ч %d мин.\n🔥 Серия: %d дн.",
+			hours, minutes, st.CurrentStreak))
+}
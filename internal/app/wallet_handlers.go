@@ -0,0 +1,337 @@
+// Обработчики общих кошельков нейронов
+
+package app
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+
+	"neurobot-prod/internal/currency"
+	"neurobot-prod/internal/telegram"
+	"neurobot-prod/internal/wallet"
+)
+
+// walletUsage - справка по команде /wallet
+const walletUsage = "👛 Общие кошельки\n\n" +
+	"Кошелек пополняют участники, а тратят на запросы все, кого добавил владелец.\n\n" +
+	"/wallet - ваши кошельки и выбор, откуда оплачивать запросы\n" +
+	"/wallet create <название> - создать кошелек\n" +
+	"/wallet <id> - участники, лимиты и траты за сутки\n" +
+	"/wallet add <id> @username [лимит] - добавить участника с суточным лимитом\n" +
+	"/wallet remove <id> @username - исключить участника\n" +
+	"/wallet limit <id> @username <лимит|0> - изменить суточный лимит (0 - без лимита)\n" +
+	"/wallet deposit <id> <количество> - пополнить кошелек купленными нейронами\n" +
+	"/wallet use <id|0> - оплачивать запросы из кошелька (0 - с личного баланса)\n" +
+	"/wallet leave <id> - выйти из кошелька"
+
+// handleWalletCommand обрабатывает команду /wallet и ее подкоманды
+func (w *MessageWorker) handleWalletCommand(message *tgbotapi.Message) {
+	userID := int64(message.From.ID)
+	chatID := message.Chat.ID
+	ctx := context.Background()
+
+	if !w.walletService.GetConfig().Enabled {
+		w.bot.SendMessage(chatID, walletErrorText(wallet.ErrDisabled))
+		return
+	}
+
+	args := strings.Fields(message.CommandArguments())
+	if len(args) == 0 {
+		w.sendWalletList(chatID, userID)
+		return
+	}
+
+	// /wallet <id> - информация о кошельке
+	if walletID, err := strconv.ParseInt(args[0], 10, 64); err == nil {
+		w.sendWalletDetails(chatID, userID, walletID)
+		return
+	}
+
+	if args[0] == "create" {
+		if len(args) < 2 {
+			w.bot.SendMessage(chatID, walletUsage)
+			return
+		}
+		name := strings.TrimSpace(strings.TrimPrefix(strings.TrimSpace(message.CommandArguments()), args[0]))
+		created, err := w.walletService.Create(ctx, userID, name)
+		if err != nil {
+			w.bot.SendMessage(chatID, walletErrorText(err))
+			return
+		}
+		w.bot.SendMessage(chatID, fmt.Sprintf(
+			"✅ Кошелек «%s» создан (id %d).\n\nПополнить: /wallet deposit %d <количество>\nДобавить участника: /wallet add %d @username [лимит]",
+			created.Name, created.ID, created.ID, created.ID))
+		return
+	}
+
+	if len(args) < 2 {
+		w.bot.SendMessage(chatID, walletUsage)
+		return
+	}
+	walletID, err := strconv.ParseInt(args[1], 10, 64)
+	if err != nil || walletID < 0 {
+		w.bot.SendMessage(chatID, walletUsage)
+		return
+	}
+
+	switch args[0] {
+	case "add":
+		if len(args) < 3 {
+			w.bot.SendMessage(chatID, walletUsage)
+			return
+		}
+		var limit *int
+		if len(args) > 3 {
+			if limit, err = parseWalletLimit(args[3]); err != nil {
+				w.bot.SendMessage(chatID, walletUsage)
+				return
+			}
+		}
+		added, err := w.walletService.AddMember(ctx, userID, walletID, args[2], limit)
+		if err != nil {
+			w.bot.SendMessage(chatID, walletErrorText(err))
+			return
+		}
+		w.bot.SendMessage(chatID, fmt.Sprintf("✅ @%s добавлен в кошелек. %s", added.Username, walletLimitText(limit)))
+
+	case "remove":
+		if len(args) < 3 {
+			w.bot.SendMessage(chatID, walletUsage)
+			return
+		}
+		removed, err := w.walletService.RemoveMember(ctx, userID, walletID, args[2])
+		if err != nil {
+			w.bot.SendMessage(chatID, walletErrorText(err))
+			return
+		}
+		w.bot.SendMessage(chatID, fmt.Sprintf("✅ @%s исключен из кошелька.", removed.Username))
+
+	case "limit":
+		if len(args) < 4 {
+			w.bot.SendMessage(chatID, walletUsage)
+			return
+		}
+		limit, err := parseWalletLimit(args[3])
+		if err != nil {
+			w.bot.SendMessage(chatID, walletUsage)
+			return
+		}
+		member, err := w.walletService.SetLimit(ctx, userID, walletID, args[2], limit)
+		if err != nil {
+			w.bot.SendMessage(chatID, walletErrorText(err))
+			return
+		}
+		w.bot.SendMessage(chatID, fmt.Sprintf("✅ Лимит @%s обновлен. %s", member.Username, walletLimitText(limit)))
+
+	case "deposit":
+		if len(args) < 3 {
+			w.bot.SendMessage(chatID, walletUsage)
+			return
+		}
+		amount, err := strconv.Atoi(args[2])
+		if err != nil || amount <= 0 {
+			w.bot.SendMessage(chatID, walletUsage)
+			return
+		}
+		// Повторная доставка того же сообщения не должна пополнить кошелек дважды
+		key := fmt.Sprintf("deposit:%d:%d", userID, message.MessageID)
+		deposit, err := w.walletService.Deposit(ctx, userID, walletID, amount, key)
+		if err != nil {
+			w.bot.SendMessage(chatID, walletErrorText(err))
+			return
+		}
+		w.bot.SendMessage(chatID, fmt.Sprintf("✅ Кошелек пополнен на %d нейронов. Баланс кошелька: %d.",
+			amount, deposit.Credit.BalanceAfter))
+
+	case "use":
+		w.selectWallet(chatID, userID, walletID)
+
+	case "leave":
+		if err := w.walletService.Leave(ctx, userID, walletID); err != nil {
+			w.bot.SendMessage(chatID, walletErrorText(err))
+			return
+		}
+		w.bot.SendMessage(chatID, "✅ Вы вышли из кошелька. Запросы снова оплачиваются с личного баланса, если кошелек был выбран.")
+
+	default:
+		w.bot.SendMessage(chatID, walletUsage)
+	}
+}
+
+// handleWalletCallback обрабатывает выбор кошелька для оплаты и просмотр кошелька
+func (w *MessageWorker) handleWalletCallback(callback *tgbotapi.CallbackQuery, parts []string) {
+	if len(parts) < 3 {
+		return
+	}
+	userID := int64(callback.From.ID)
+	chatID := callback.Message.Chat.ID
+
+	walletID, err := strconv.ParseInt(parts[2], 10, 64)
+	if err != nil {
+		return
+	}
+
+	switch parts[1] {
+	case "use":
+		w.selectWallet(chatID, userID, walletID)
+	case "info":
+		w.sendWalletDetails(chatID, userID, walletID)
+	}
+}
+
+// sendWalletList отправляет список кошельков пользователя с кнопками выбора оплаты
+func (w *MessageWorker) sendWalletList(chatID, userID int64) {
+	memberships, err := w.walletService.List(context.Background(), userID)
+	if err != nil {
+		w.bot.SendMessage(chatID, "Произошла ошибка при получении кошельков. Попробуйте позже.")
+		return
+	}
+	if len(memberships) == 0 {
+		w.bot.SendMessage(chatID, "У вас пока нет общих кошельков.\n\n"+walletUsage)
+		return
+	}
+
+	var sb strings.Builder
+	sb.WriteString("👛 Ваши кошельки\n\n")
+	personal := "✅ Личный баланс"
+	var rows [][]tgbotapi.InlineKeyboardButton
+	for _, ms := range memberships {
+		mark := ""
+		if ms.Member.IsSelected {
+			mark = " ✅"
+			personal = "Личный баланс"
+		}
+		role := "участник"
+		if ms.Member.IsOwner() {
+			role = "владелец"
+		}
+		sb.WriteString(fmt.Sprintf("• %s (id %d, %s): %d нейронов%s\n", ms.Wallet.Name, ms.Wallet.ID, role, ms.Wallet.Balance, mark))
+		if ms.Member.DailyLimit != nil {
+			sb.WriteString(fmt.Sprintf("   Ваш суточный лимит: %d нейронов\n", *ms.Member.DailyLimit))
+		}
+		rows = append(rows, tgbotapi.NewInlineKeyboardRow(
+			tgbotapi.NewInlineKeyboardButtonData("Оплачивать: "+ms.Wallet.Name, fmt.Sprintf("wallet:use:%d", ms.Wallet.ID)),
+			tgbotapi.NewInlineKeyboardButtonData("ℹ️", fmt.Sprintf("wallet:info:%d", ms.Wallet.ID)),
+		))
+	}
+	rows = append(rows, tgbotapi.NewInlineKeyboardRow(
+		tgbotapi.NewInlineKeyboardButtonData(personal, "wallet:use:0"),
+	))
+	sb.WriteString("\nВыберите, откуда оплачивать запросы к нейросетям:")
+
+	w.bot.SendMessage(chatID, sb.String(), telegram.WithReplyMarkup(tgbotapi.NewInlineKeyboardMarkup(rows...)))
+}
+
+// sendWalletDetails отправляет информацию о кошельке: баланс, участников, лимиты и траты за сутки
+func (w *MessageWorker) sendWalletDetails(chatID, userID, walletID int64) {
+	details, err := w.walletService.Get(context.Background(), userID, walletID)
+	if err != nil {
+		w.bot.SendMessage(chatID, walletErrorText(err))
+		return
+	}
+
+	var sb strings.Builder
+	sb.WriteString(fmt.Sprintf("👛 %s (id %d)\n\n", details.Wallet.Name, details.Wallet.ID))
+	sb.WriteString(fmt.Sprintf("🧠 Баланс: %d нейронов\n", details.Wallet.Balance))
+	sb.WriteString(fmt.Sprintf("📊 Всего пополнено: %d\n", details.Wallet.LifetimeEarned))
+	sb.WriteString(fmt.Sprintf("📉 Всего потрачено: %d\n\n", details.Wallet.LifetimeSpent))
+	sb.WriteString("Участники (потрачено за сутки):\n")
+	for _, m := range details.Members {
+		line := fmt.Sprintf("• %s: %d", m.DisplayName(), m.SpentToday)
+		if m.Member.DailyLimit != nil {
+			line += fmt.Sprintf(" из %d", *m.Member.DailyLimit)
+		}
+		if m.Member.IsOwner() {
+			line += " (владелец)"
+		}
+		sb.WriteString(line + "\n")
+	}
+
+	keyboard := tgbotapi.NewInlineKeyboardMarkup(
+		tgbotapi.NewInlineKeyboardRow(
+			tgbotapi.NewInlineKeyboardButtonData("Оплачивать из кошелька", fmt.Sprintf("wallet:use:%d", walletID)),
+		),
+	)
+	if details.Member.IsSelected {
+		keyboard = tgbotapi.NewInlineKeyboardMarkup(
+			tgbotapi.NewInlineKeyboardRow(
+				tgbotapi.NewInlineKeyboardButtonData("Оплачивать с личного баланса", "wallet:use:0"),
+			),
+		)
+	}
+
+	w.bot.SendMessage(chatID, sb.String(), telegram.WithReplyMarkup(keyboard))
+}
+
+// selectWallet выбирает, откуда оплачиваются запросы пользователя (0 - личный баланс)
+func (w *MessageWorker) selectWallet(chatID, userID, walletID int64) {
+	selected, err := w.walletService.Select(context.Background(), userID, walletID)
+	if err != nil {
+		w.bot.SendMessage(chatID, walletErrorText(err))
+		return
+	}
+	if selected == nil {
+		w.bot.SendMessage(chatID, "✅ Запросы оплачиваются с личного баланса.")
+		return
+	}
+	w.bot.SendMessage(chatID, fmt.Sprintf("✅ Запросы оплачиваются из кошелька «%s».", selected.Name))
+}
+
+// parseWalletLimit разбирает суточный лимит: 0 означает отсутствие лимита
+func parseWalletLimit(arg string) (*int, error) {
+	limit, err := strconv.Atoi(arg)
+	if err != nil || limit < 0 {
+		return nil, wallet.ErrInvalidLimit
+	}
+	if limit == 0 {
+		return nil, nil
+	}
+	return &limit, nil
+}
+
+// walletLimitText возвращает описание суточного лимита участника
+func walletLimitText(limit *int) string {
+	if limit == nil {
+		return "Суточный лимит: без ограничений."
+	}
+	return fmt.Sprintf("Суточный лимит: %d нейронов.", *limit)
+}
+
+// walletErrorText возвращает текст для пользователя по ошибке общего кошелька
+func walletErrorText(err error) string {
+	switch {
+	case errors.Is(err, wallet.ErrDisabled):
+		return "Общие кошельки временно недоступны."
+	case errors.Is(err, wallet.ErrNotFound), errors.Is(err, currency.ErrWalletNotFound):
+		return "❌ Кошелек не найден. Список ваших кошельков: /wallet"
+	case errors.Is(err, wallet.ErrNotOwner):
+		return "❌ Это действие доступно только владельцу кошелька."
+	case errors.Is(err, wallet.ErrUserNotFound):
+		return "❌ Пользователь не найден. Участник должен хотя бы раз запустить бота и иметь юзернейм в Telegram."
+	case errors.Is(err, wallet.ErrNotMember):
+		return "❌ Этот пользователь не состоит в кошельке."
+	case errors.Is(err, wallet.ErrAlreadyMember):
+		return "❌ Этот пользователь уже состоит в кошельке."
+	case errors.Is(err, wallet.ErrMemberLimit):
+		return "❌ В кошельке максимальное количество участников."
+	case errors.Is(err, wallet.ErrOwnedLimit):
+		return "❌ Вы уже создали максимальное количество кошельков."
+	case errors.Is(err, wallet.ErrJoinedLimit):
+		return "❌ Пользователь состоит в максимальном количестве кошельков."
+	case errors.Is(err, wallet.ErrOwnerCannotLeave):
+		return "❌ Владелец не может выйти из своего кошелька или исключить себя."
+	case errors.Is(err, wallet.ErrInvalidName):
+		return "❌ Название кошелька должно быть от 1 до 64 символов."
+	case errors.Is(err, wallet.ErrInvalidLimit):
+		return "❌ Лимит должен быть положительным числом или 0 (без лимита)."
+	case errors.Is(err, currency.ErrNotTransferable):
+		return "❌ Недостаточно нейронов для пополнения. Пополнить кошелек можно только купленными нейронами."
+	default:
+		return "Произошла ошибка при работе с кошельком. Попробуйте позже."
+	}
+}
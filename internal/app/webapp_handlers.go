@@ -0,0 +1,27 @@
+// Обработчики кнопок Mini App
+
+package app
+
+import (
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+
+	"neurobot-prod/internal/telegram"
+)
+
+const (
+	// webAppProfileButtonText - текст кнопки, открывающей профиль в Mini App
+	webAppProfileButtonText = "👤 Открыть профиль"
+	// legacyProfileButtonText - текст кнопки старой обычной клавиатуры, которая осталась у части пользователей
+	legacyProfileButtonText = "Открыть Профиль"
+)
+
+// handleLegacyProfileButton убирает старую обычную клавиатуру и отправляет кнопку Mini App.
+// Без этого текст кнопки уходил нейросети как запрос и за него списывались нейроны.
+// Mini App открывается инлайн-кнопкой или кнопкой меню, из которых Telegram.WebApp.sendData не работает,
+// поэтому покупки и подарки выполняются через API (/checkout, /transfer), а не через данные в чате
+func (w *MessageWorker) handleLegacyProfileButton(message *tgbotapi.Message) {
+	w.bot.SendMessage(message.Chat.ID, "Клавиатура обновлена: профиль теперь открывается кнопкой меню или кнопкой ниже.",
+		telegram.WithRemoveKeyboard())
+	w.bot.SendMessage(message.Chat.ID, "👤 Профиль, баланс и история операций:",
+		w.bot.WithWebAppButton(webAppProfileButtonText, telegram.ScreenProfile))
+}
@@ -0,0 +1,237 @@
+package app
+
+import (
+	"crypto/subtle"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/redis/go-redis/v9"
+	"go.uber.org/zap"
+
+	"neurobot-prod/internal/admin"
+	"neurobot-prod/internal/api"
+	"neurobot-prod/internal/broadcast"
+	"neurobot-prod/internal/config"
+	"neurobot-prod/internal/conversation"
+	"neurobot-prod/internal/currency"
+	"neurobot-prod/internal/events"
+	"neurobot-prod/internal/gift"
+	"neurobot-prod/internal/llm"
+	"neurobot-prod/internal/loyalty"
+	"neurobot-prod/internal/payment"
+	"neurobot-prod/internal/promo"
+	"neurobot-prod/internal/queue"
+	"neurobot-prod/internal/referral"
+	"neurobot-prod/internal/storage/postgres"
+	redisStorage "neurobot-prod/internal/storage/redis"
+	"neurobot-prod/internal/subscription"
+	"neurobot-prod/internal/telegram"
+	"neurobot-prod/internal/user"
+)
+
+// maxUpdateSize - максимальный размер тела обновления Telegram
+const maxUpdateSize = 1 << 20
+
+// WebhookHandler принимает вебхуки Telegram и платежных систем
+type WebhookHandler struct {
+	db             *sql.DB
+	redis          *redis.Client
+	bot            *telegram.Bot
+	publisher      *queue.Publisher
+	config         *config.Config
+	log            *zap.Logger
+	paymentHandler *payment.Handler
+	apiHandler     *api.Handler
+	adminHandler   *admin.Handler
+	errorLog       *admin.ErrorLog
+}
+
+// NewWebhookHandler создает новый обработчик вебхуков
+func NewWebhookHandler(cfg *config.Config, log *zap.Logger) (*WebhookHandler, error) {
+	logger := log.Named("webhook_handler")
+
+	// Подключаемся к базе данных
+	db, err := postgres.NewPostgresDB(cfg.DB, logger)
+	if err != nil {
+		return nil, fmt.Errorf("ошибка подключения к базе данных: %w", err)
+	}
+
+	// Ошибки сервисов сохраняются для просмотра в консоли администратора
+	adminRepo := admin.NewRepository(db)
+	var errorLog *admin.ErrorLog
+	if cfg.Admin.ErrorLogEnabled {
+		errorLog = admin.NewErrorLog(adminRepo, cfg.Admin.ErrorLogBuffer)
+		logger = logger.WithOptions(errorLog.Hook())
+	}
+
+	// Redis нужен сервису пользователей API Mini App
+	redisClient, err := redisStorage.NewRedisClient(cfg.Redis, logger)
+	if err != nil {
+		return nil, fmt.Errorf("ошибка подключения к Redis: %w", err)
+	}
+
+	// Создаем бота для уведомлений пользователей
+	bot, err := telegram.NewBot(cfg.Telegram, logger)
+	if err != nil {
+		return nil, fmt.Errorf("ошибка создания Telegram бота: %w", err)
+	}
+
+	// Кнопка меню открывает профиль в Mini App во всех чатах бота
+	if err := bot.SetMenuButton("Профиль"); err != nil {
+		logger.Warn("Не удалось установить кнопку меню Mini App", zap.Error(err))
+	}
+
+	// Создаем NATS Publisher
+	publisher, err := queue.NewPublisher(cfg.NATS, logger)
+	if err != nil {
+		return nil, fmt.Errorf("ошибка создания NATS publisher: %w", err)
+	}
+
+	// Создаем сервисы
+	subService := subscription.NewService(subscription.NewRepository(db), logger)
+	currencyService := currency.NewService(currency.NewRepository(db), subService, logger)
+	paymentService := payment.NewService(payment.NewRepository(db), cfg.Payment, subService, currencyService, logger)
+	paymentService.SetNotifier(func(userID int64, text string) {
+		bot.SendMessage(userID, text)
+	})
+	subService.SetRenewals(paymentService, cfg.Subscription, func(userID int64, text string) {
+		bot.SendMessage(userID, text)
+	})
+	// Уведомления об оплате отмечают примененные скидки, поэтому промокоды нужны и здесь
+	paymentService.SetPromo(promo.NewService(promo.NewRepository(db), subService, currencyService, logger))
+	referralService := referral.NewService(referral.NewRepository(db), currencyService, cfg.Referral, logger)
+	referralService.SetNotifier(func(userID int64, text string) {
+		bot.SendMessage(userID, text)
+	})
+	paymentService.SetReferrals(referralService)
+	loyaltyService := loyalty.NewService(loyalty.NewRepository(db), cfg.Loyalty, logger)
+	loyaltyService.SetNotifier(func(userID int64, text string) {
+		bot.SendMessage(userID, text)
+	})
+	paymentService.SetLoyalty(loyaltyService)
+	referralService.SetLoyalty(loyaltyService)
+
+	// События о покупках и подписках обрабатывает сервис достижений в обработчике сообщений
+	eventBus := events.NewBus(publisher, cfg.NATS.Subjects.Events, logger)
+	subService.SetEvents(eventBus)
+	currencyService.SetEvents(eventBus)
+	referralService.SetEvents(eventBus)
+
+	// API Mini App использует те же сервисы, что и бот
+	userService := user.NewService(user.NewRepository(db), redisClient, logger)
+	llmService := llm.NewService(cfg, subService, currencyService, logger)
+	conversationService := conversation.NewService(conversation.NewRepository(db), subService, logger)
+	apiHandler := api.NewHandler(userService, currencyService, subService, paymentService, loyaltyService,
+		llmService, conversationService, cfg, logger)
+	giftService := gift.NewService(currencyService, subService, userService, cfg.Gift, logger)
+	giftService.SetNotifier(func(userID int64, text string) {
+		bot.SendMessage(userID, text)
+	})
+	apiHandler.SetGifts(giftService)
+
+	// Консоль администратора использует токены доступа Mini App
+	adminService := admin.NewService(adminRepo, userService, currencyService, subService, llmService, cfg, logger)
+	adminService.SetNotifier(func(userID int64, text string) {
+		bot.SendMessage(userID, text)
+	})
+	llmService.SetModelSwitch(adminService)
+
+	// Рассылки из HTTP API только ставятся в очередь, отправляет их обработчик сообщений
+	broadcastService := broadcast.NewService(broadcast.NewRepository(db), userService, publisher, redisClient, cfg, logger)
+	broadcastService.SetSender(func(userID int64, text string) error {
+		_, err := bot.SendMessage(userID, text)
+		return err
+	})
+	adminService.SetBroadcasts(broadcastService)
+	adminService.SetPersonas(conversationService)
+
+	return &WebhookHandler{
+		db:             db,
+		redis:          redisClient,
+		bot:            bot,
+		publisher:      publisher,
+		config:         cfg,
+		log:            logger,
+		paymentHandler: payment.NewHandler(paymentService, logger),
+		apiHandler:     apiHandler,
+		adminHandler:   admin.NewHandler(adminService, cfg, logger),
+		errorLog:       errorLog,
+	}, nil
+}
+
+// Router возвращает HTTP-маршрутизатор
+func (h *WebhookHandler) Router() http.Handler {
+	if h.config.App.Env == "production" {
+		gin.SetMode(gin.ReleaseMode)
+	}
+
+	router := gin.New()
+	router.Use(gin.Recovery())
+
+	router.GET("/health", func(c *gin.Context) {
+		c.JSON(http.StatusOK, gin.H{"status": "ok"})
+	})
+
+	router.POST(h.config.Telegram.WebhookPath, h.handleTelegramUpdate)
+
+	h.paymentHandler.RegisterRoutes(router.Group("/api/v1/payments"))
+
+	// Без секрета токены доступа нельзя подписать, поэтому API Mini App не поднимается
+	if h.config.Services.API.JWTSecret != "" {
+		h.apiHandler.RegisterRoutes(router.Group("/api/v1"))
+		h.adminHandler.RegisterRoutes(router.Group("/api/v1/admin"))
+	} else {
+		h.log.Warn("API Mini App и консоль администратора отключены: не задан секрет JWT")
+	}
+
+	return router
+}
+
+// Close освобождает ресурсы обработчика
+func (h *WebhookHandler) Close() {
+	if h.publisher != nil {
+		h.publisher.Close()
+	}
+	if h.redis != nil {
+		h.redis.Close()
+	}
+	if h.errorLog != nil {
+		h.errorLog.Close()
+	}
+	if h.db != nil {
+		h.db.Close()
+	}
+}
+
+// handleTelegramUpdate принимает обновление Telegram и передает его в очередь
+func (h *WebhookHandler) handleTelegramUpdate(c *gin.Context) {
+	// Проверяем секретный токен, который Telegram передает в заголовке
+	if h.config.Telegram.SecretToken != "" {
+		token := c.GetHeader("X-Telegram-Bot-Api-Secret-Token")
+		if subtle.ConstantTimeCompare([]byte(token), []byte(h.config.Telegram.SecretToken)) != 1 {
+			h.log.Warn("Отклонен запрос с неверным секретным токеном",
+				zap.String("remote_addr", c.ClientIP()))
+			c.Status(http.StatusUnauthorized)
+			return
+		}
+	}
+
+	body, err := io.ReadAll(io.LimitReader(c.Request.Body, maxUpdateSize))
+	if err != nil || !json.Valid(body) {
+		c.Status(http.StatusBadRequest)
+		return
+	}
+
+	if err := h.publisher.Publish(c.Request.Context(), h.config.NATS.Subjects.TelegramUpdates, json.RawMessage(body)); err != nil {
+		h.log.Error("Ошибка публикации обновления", zap.Error(err))
+		// Telegram повторит доставку обновления
+		c.Status(http.StatusInternalServerError)
+		return
+	}
+
+	c.Status(http.StatusOK)
+}
@@ -0,0 +1,69 @@
+// Ограничение частоты отправки рассылок
+
+package broadcast
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+	"go.uber.org/zap"
+)
+
+// rateKeyPrefix - префикс счетчиков отправок в Redis, ключ содержит номер секунды
+const rateKeyPrefix = "broadcast:rate:"
+
+// rateLimiter ограничивает количество отправок в секунду на все экземпляры обработчика.
+// Счетчик ведется в Redis окнами по одной секунде
+type rateLimiter struct {
+	redis *redis.Client
+	limit int
+	log   *zap.Logger
+}
+
+// newRateLimiter создает ограничитель на limit отправок в секунду
+func newRateLimiter(redisClient *redis.Client, limit int, log *zap.Logger) *rateLimiter {
+	if limit <= 0 {
+		limit = 1
+	}
+	return &rateLimiter{redis: redisClient, limit: limit, log: log}
+}
+
+// Wait ждет, пока в текущем окне освободится место для отправки
+func (l *rateLimiter) Wait(ctx context.Context) error {
+	for {
+		now := time.Now()
+		key := fmt.Sprintf("%s%d", rateKeyPrefix, now.Unix())
+
+		count, err := l.redis.Incr(ctx, key).Result()
+		if err != nil {
+			// Без Redis ограничиваем частоту только в этом экземпляре
+			l.log.Warn("Ошибка счетчика отправок в Redis, используется локальное ограничение", zap.Error(err))
+			return sleep(ctx, time.Second/time.Duration(l.limit))
+		}
+		if count == 1 {
+			l.redis.Expire(ctx, key, 2*time.Second)
+		}
+		if count <= int64(l.limit) {
+			return nil
+		}
+
+		if err := sleep(ctx, now.Truncate(time.Second).Add(time.Second).Sub(now)); err != nil {
+			return err
+		}
+	}
+}
+
+// sleep ждет указанное время или отмены контекста
+func sleep(ctx context.Context, d time.Duration) error {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+}
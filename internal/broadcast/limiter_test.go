@@ -0,0 +1,41 @@
+// Тесты ограничения частоты отправки рассылок
+
+package broadcast
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+	"go.uber.org/zap"
+)
+
+// unavailableRedis возвращает клиент Redis, все команды которого завершаются ошибкой
+func unavailableRedis(t *testing.T) *redis.Client {
+	client := redis.NewClient(&redis.Options{Addr: "127.0.0.1:1", MaxRetries: -1})
+	t.Cleanup(func() { client.Close() })
+	return client
+}
+
+func TestRateLimiterWithoutRedis(t *testing.T) {
+	limiter := newRateLimiter(unavailableRedis(t), 10, zap.NewNop())
+
+	// Без Redis отправки разносятся локально на 1/limit секунды
+	start := time.Now()
+	for i := 0; i < 3; i++ {
+		if err := limiter.Wait(context.Background()); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if elapsed := time.Since(start); elapsed < 300*time.Millisecond {
+		t.Errorf("три отправки заняли %s, ожидалось не меньше 300ms", elapsed)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if err := limiter.Wait(ctx); !errors.Is(err, context.Canceled) {
+		t.Errorf("ожидание с отмененным контекстом: %v, ожидалась %v", err, context.Canceled)
+	}
+}
@@ -0,0 +1,230 @@
+// Модель рассылок по сегментам пользователей
+
+package broadcast
+
+import (
+	"database/sql/driver"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Status представляет статус кампании
+type Status string
+
+const (
+	StatusDraft     Status = "draft"     // Создана, можно проверить аудиторию и отправить пробное сообщение
+	StatusRunning   Status = "running"   // Получатели поставлены в очередь, идет отправка
+	StatusCompleted Status = "completed" // Все доставки обработаны
+	StatusCancelled Status = "cancelled" // Остановлена администратором, оставшиеся доставки пропускаются
+)
+
+// DeliveryStatus представляет статус доставки одному получателю
+type DeliveryStatus string
+
+const (
+	DeliveryPending DeliveryStatus = "pending" // В очереди
+	DeliverySending DeliveryStatus = "sending" // Взята обработчиком
+	DeliverySent    DeliveryStatus = "sent"
+	DeliveryFailed  DeliveryStatus = "failed"
+	DeliveryBlocked DeliveryStatus = "blocked" // Пользователь заблокировал бота
+	DeliverySkipped DeliveryStatus = "skipped" // Кампания отменена до отправки
+)
+
+// ReferralFilter отбирает пользователей по участию в реферальной программе
+type ReferralFilter string
+
+const (
+	ReferralAny         ReferralFilter = ""
+	ReferralReferred    ReferralFilter = "referred"     // Пришел по приглашению
+	ReferralNotReferred ReferralFilter = "not_referred" // Пришел сам
+	ReferralReferrer    ReferralFilter = "referrer"     // Пригласил хотя бы одного пользователя
+)
+
+// FreePlan - код плана в сегменте для пользователей без платной подписки
+const FreePlan = "free"
+
+// Segment описывает условия отбора получателей. Пустые условия не ограничивают аудиторию,
+// пользователи, заблокировавшие бота, в рассылки не попадают
+type Segment struct {
+	Plans            []string       `json:"plans,omitempty"`              // Коды планов текущей подписки
+	Languages        []string       `json:"languages,omitempty"`          // Языки из настроек Telegram, например ru или en
+	ActiveWithinDays int            `json:"active_within_days,omitempty"` // Писали боту за последние N дней
+	InactiveForDays  int            `json:"inactive_for_days,omitempty"`  // Не писали боту N дней и больше
+	MinBalance       *int           `json:"min_balance,omitempty"`
+	MaxBalance       *int           `json:"max_balance,omitempty"`
+	Referral         ReferralFilter `json:"referral,omitempty"`
+}
+
+// Validate проверяет корректность условий
+func (s Segment) Validate() error {
+	if s.ActiveWithinDays < 0 || s.InactiveForDays < 0 {
+		return fmt.Errorf("%w: количество дней не может быть отрицательным", ErrInvalidSegment)
+	}
+	if s.MinBalance != nil && s.MaxBalance != nil && *s.MinBalance > *s.MaxBalance {
+		return fmt.Errorf("%w: минимальный баланс больше максимального", ErrInvalidSegment)
+	}
+	switch s.Referral {
+	case ReferralAny, ReferralReferred, ReferralNotReferred, ReferralReferrer:
+	default:
+		return fmt.Errorf("%w: неизвестный реферальный статус %q", ErrInvalidSegment, s.Referral)
+	}
+	return nil
+}
+
+// normalized возвращает условия со списками в нижнем регистре, как их разбирает ParseSegment
+func (s Segment) normalized() Segment {
+	s.Plans = splitList(strings.Join(s.Plans, ","))
+	s.Languages = splitList(strings.Join(s.Languages, ","))
+	s.Referral = ReferralFilter(strings.ToLower(string(s.Referral)))
+	return s
+}
+
+// String возвращает условия в формате команды /broadcast
+func (s Segment) String() string {
+	var parts []string
+	if len(s.Plans) > 0 {
+		parts = append(parts, "plan="+strings.Join(s.Plans, ","))
+	}
+	if len(s.Languages) > 0 {
+		parts = append(parts, "lang="+strings.Join(s.Languages, ","))
+	}
+	if s.ActiveWithinDays > 0 {
+		parts = append(parts, fmt.Sprintf("active=%d", s.ActiveWithinDays))
+	}
+	if s.InactiveForDays > 0 {
+		parts = append(parts, fmt.Sprintf("inactive=%d", s.InactiveForDays))
+	}
+	if s.MinBalance != nil {
+		parts = append(parts, fmt.Sprintf("min_balance=%d", *s.MinBalance))
+	}
+	if s.MaxBalance != nil {
+		parts = append(parts, fmt.Sprintf("max_balance=%d", *s.MaxBalance))
+	}
+	if s.Referral != ReferralAny {
+		parts = append(parts, "referral="+string(s.Referral))
+	}
+	if len(parts) == 0 {
+		return "все пользователи"
+	}
+	return strings.Join(parts, " ")
+}
+
+// ParseSegment разбирает условия вида key=value из команды /broadcast:
+// plan=free,premium lang=ru,en active=7 inactive=30 min_balance=100 max_balance=500 referral=referred
+func ParseSegment(args []string) (Segment, error) {
+	var s Segment
+	for _, arg := range args {
+		key, value, ok := strings.Cut(arg, "=")
+		if !ok || value == "" {
+			return s, fmt.Errorf("%w: ожидается условие вида key=value, получено %q", ErrInvalidSegment, arg)
+		}
+
+		var err error
+		switch strings.ToLower(key) {
+		case "plan":
+			s.Plans = splitList(value)
+		case "lang":
+			s.Languages = splitList(value)
+		case "active":
+			s.ActiveWithinDays, err = strconv.Atoi(value)
+		case "inactive":
+			s.InactiveForDays, err = strconv.Atoi(value)
+		case "min_balance":
+			s.MinBalance, err = parseIntPtr(value)
+		case "max_balance":
+			s.MaxBalance, err = parseIntPtr(value)
+		case "referral":
+			s.Referral = ReferralFilter(strings.ToLower(value))
+		default:
+			return s, fmt.Errorf("%w: неизвестное условие %q", ErrInvalidSegment, key)
+		}
+		if err != nil {
+			return s, fmt.Errorf("%w: %s должно быть числом", ErrInvalidSegment, key)
+		}
+	}
+	return s, s.Validate()
+}
+
+// splitList разбирает список через запятую в нижнем регистре
+func splitList(value string) []string {
+	var items []string
+	for _, item := range strings.Split(value, ",") {
+		if item = strings.ToLower(strings.TrimSpace(item)); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
+
+// parseIntPtr разбирает число в указатель
+func parseIntPtr(value string) (*int, error) {
+	n, err := strconv.Atoi(value)
+	if err != nil {
+		return nil, err
+	}
+	return &n, nil
+}
+
+// Value реализует интерфейс driver.Valuer для конвертации в JSONB
+func (s Segment) Value() (driver.Value, error) {
+	return json.Marshal(s)
+}
+
+// Scan реализует интерфейс sql.Scanner для чтения из JSONB
+func (s *Segment) Scan(value interface{}) error {
+	if value == nil {
+		*s = Segment{}
+		return nil
+	}
+
+	var data []byte
+	switch v := value.(type) {
+	case []byte:
+		data = v
+	case string:
+		data = []byte(v)
+	default:
+		return errors.New("тип данных не поддерживается для Segment.Scan")
+	}
+
+	return json.Unmarshal(data, s)
+}
+
+// Campaign представляет кампанию рассылки
+type Campaign struct {
+	ID              int64      `db:"id"`
+	Title           string     `db:"title"`
+	Text            string     `db:"text"`
+	Segment         Segment    `db:"segment"`
+	Status          Status     `db:"status"`
+	CreatedBy       int64      `db:"created_by"`
+	TotalRecipients int        `db:"total_recipients"`
+	StartedAt       *time.Time `db:"started_at"`
+	FinishedAt      *time.Time `db:"finished_at"`
+	CreatedAt       time.Time  `db:"created_at"`
+	UpdatedAt       time.Time  `db:"updated_at"`
+}
+
+// Stats представляет статистику доставки кампании
+type Stats struct {
+	Pending int // Включая доставки, взятые обработчиком
+	Sent    int
+	Failed  int
+	Blocked int
+	Skipped int
+}
+
+// Total возвращает количество доставок кампании
+func (s Stats) Total() int {
+	return s.Pending + s.Sent + s.Failed + s.Blocked + s.Skipped
+}
+
+// batch - сообщение очереди отправки с частью получателей кампании
+type batch struct {
+	CampaignID int64   `json:"campaign_id"`
+	UserIDs    []int64 `json:"user_ids"`
+}
@@ -0,0 +1,369 @@
+// Репозиторий рассылок
+
+package broadcast
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"strings"
+
+	"github.com/lib/pq"
+)
+
+// staleSendingInterval - через сколько доставка, взятая обработчиком, считается потерянной
+// и может быть отправлена повторно при возобновлении кампании
+const staleSendingInterval = "10 minutes"
+
+// campaignColumns - колонки кампании в порядке сканирования
+const campaignColumns = `id, title, text, segment, status, created_by, total_recipients,
+	started_at, finished_at, created_at, updated_at`
+
+// Repository представляет репозиторий кампаний и доставок
+type Repository struct {
+	db *sql.DB
+}
+
+// NewRepository создает новый репозиторий рассылок
+func NewRepository(db *sql.DB) *Repository {
+	return &Repository{
+		db: db,
+	}
+}
+
+// scanCampaign сканирует кампанию из строки результата
+func scanCampaign(row interface{ Scan(...interface{}) error }) (*Campaign, error) {
+	c := &Campaign{}
+	err := row.Scan(
+		&c.ID,
+		&c.Title,
+		&c.Text,
+		&c.Segment,
+		&c.Status,
+		&c.CreatedBy,
+		&c.TotalRecipients,
+		&c.StartedAt,
+		&c.FinishedAt,
+		&c.CreatedAt,
+		&c.UpdatedAt,
+	)
+	return c, err
+}
+
+// CreateCampaign создает черновик кампании
+func (r *Repository) CreateCampaign(ctx context.Context, c *Campaign) error {
+	err := r.db.QueryRowContext(ctx, `
+		INSERT INTO broadcast_campaigns (title, text, segment, status, created_by)
+		VALUES ($1, $2, $3, $4, $5)
+		RETURNING id, created_at, updated_at
+	`, c.Title, c.Text, c.Segment, c.Status, c.CreatedBy).Scan(&c.ID, &c.CreatedAt, &c.UpdatedAt)
+	if err != nil {
+		return fmt.Errorf("ошибка создания кампании: %w", err)
+	}
+	return nil
+}
+
+// GetCampaign возвращает кампанию по ID или nil, если кампания не найдена
+func (r *Repository) GetCampaign(ctx context.Context, id int64) (*Campaign, error) {
+	c, err := scanCampaign(r.db.QueryRowContext(ctx,
+		`SELECT `+campaignColumns+` FROM broadcast_campaigns WHERE id = $1`, id))
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("ошибка получения кампании: %w", err)
+	}
+	return c, nil
+}
+
+// ListCampaigns возвращает последние кампании
+func (r *Repository) ListCampaigns(ctx context.Context, limit int) ([]*Campaign, error) {
+	rows, err := r.db.QueryContext(ctx,
+		`SELECT `+campaignColumns+` FROM broadcast_campaigns ORDER BY created_at DESC, id DESC LIMIT $1`, limit)
+	if err != nil {
+		return nil, fmt.Errorf("ошибка получения кампаний: %w", err)
+	}
+	defer rows.Close()
+
+	var campaigns []*Campaign
+	for rows.Next() {
+		c, err := scanCampaign(rows)
+		if err != nil {
+			return nil, fmt.Errorf("ошибка сканирования кампании: %w", err)
+		}
+		campaigns = append(campaigns, c)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("ошибка при итерации кампаний: %w", err)
+	}
+
+	return campaigns, nil
+}
+
+// StartCampaign переводит черновик в статус running. Возвращает false, если кампания не черновик
+func (r *Repository) StartCampaign(ctx context.Context, id int64) (bool, error) {
+	return r.updateStatus(ctx, `
+		UPDATE broadcast_campaigns
+		SET status = $2, started_at = NOW(), updated_at = NOW()
+		WHERE id = $1 AND status = $3
+	`, id, StatusRunning, StatusDraft)
+}
+
+// CancelCampaign отменяет черновик или идущую кампанию. Возвращает false, если кампания уже завершена
+func (r *Repository) CancelCampaign(ctx context.Context, id int64) (bool, error) {
+	return r.updateStatus(ctx, `
+		UPDATE broadcast_campaigns
+		SET status = $2, finished_at = NOW(), updated_at = NOW()
+		WHERE id = $1 AND status IN ($3, $4)
+	`, id, StatusCancelled, StatusDraft, StatusRunning)
+}
+
+// CompleteIfDone завершает идущую кампанию, если необработанных доставок не осталось
+func (r *Repository) CompleteIfDone(ctx context.Context, id int64) (bool, error) {
+	return r.updateStatus(ctx, `
+		UPDATE broadcast_campaigns
+		SET status = $2, finished_at = NOW(), updated_at = NOW()
+		WHERE id = $1 AND status = $3
+		  AND NOT EXISTS (
+			SELECT 1 FROM broadcast_deliveries
+			WHERE campaign_id = $1 AND status IN ($4, $5)
+		  )
+	`, id, StatusCompleted, StatusRunning, DeliveryPending, DeliverySending)
+}
+
+// updateStatus выполняет условный переход статуса кампании
+func (r *Repository) updateStatus(ctx context.Context, query string, args ...interface{}) (bool, error) {
+	result, err := r.db.ExecContext(ctx, query, args...)
+	if err != nil {
+		return false, fmt.Errorf("ошибка изменения статуса кампании: %w", err)
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return false, fmt.Errorf("ошибка получения количества затронутых строк: %w", err)
+	}
+
+	return rowsAffected > 0, nil
+}
+
+// SetTotalRecipients сохраняет количество получателей кампании
+func (r *Repository) SetTotalRecipients(ctx context.Context, id int64, total int) error {
+	_, err := r.db.ExecContext(ctx, `
+		UPDATE broadcast_campaigns SET total_recipients = $2, updated_at = NOW() WHERE id = $1
+	`, id, total)
+	if err != nil {
+		return fmt.Errorf("ошибка сохранения количества получателей: %w", err)
+	}
+	return nil
+}
+
+// segmentFilter формирует условия отбора пользователей сегмента. Аргументы запроса
+// нумеруются начиная с firstArg
+func segmentFilter(s Segment, firstArg int) (string, []interface{}) {
+	conditions := []string{"NOT u.is_bot", "u.blocked_at IS NULL"}
+	var args []interface{}
+	arg := func(value interface{}) string {
+		args = append(args, value)
+		return fmt.Sprintf("$%d", firstArg+len(args)-1)
+	}
+
+	if len(s.Plans) > 0 {
+		// Тот же отбор, что и у активной подписки: оплаченная или в периоде повторных списаний
+		conditions = append(conditions, `COALESCE((
+			SELECT p.code FROM user_subscriptions s
+			JOIN subscription_plans p ON p.id = s.plan_id
+			WHERE s.user_id = u.telegram_id
+			  AND ((s.status = 'active' AND s.end_date > NOW()) OR s.status = 'grace_period')
+			ORDER BY s.end_date DESC
+			LIMIT 1
+		), '`+FreePlan+`') = ANY(`+arg(pq.Array(s.Plans))+`)`)
+	}
+	if len(s.Languages) > 0 {
+		// Код языка может содержать регион, например pt-br
+		conditions = append(conditions,
+			`LOWER(SPLIT_PART(COALESCE(u.language_code, ''), '-', 1)) = ANY(`+arg(pq.Array(s.Languages))+`)`)
+	}
+	if s.ActiveWithinDays > 0 {
+		conditions = append(conditions,
+			`u.last_active_at >= NOW() - MAKE_INTERVAL(days => `+arg(s.ActiveWithinDays)+`)`)
+	}
+	if s.InactiveForDays > 0 {
+		conditions = append(conditions,
+			`(u.last_active_at IS NULL OR u.last_active_at < NOW() - MAKE_INTERVAL(days => `+arg(s.InactiveForDays)+`))`)
+	}
+	if s.MinBalance != nil || s.MaxBalance != nil {
+		balance := `COALESCE((SELECT b.balance FROM user_neuron_balance b WHERE b.user_id = u.telegram_id), 0)`
+		if s.MinBalance != nil {
+			conditions = append(conditions, balance+` >= `+arg(*s.MinBalance))
+		}
+		if s.MaxBalance != nil {
+			conditions = append(conditions, balance+` <= `+arg(*s.MaxBalance))
+		}
+	}
+	switch s.Referral {
+	case ReferralReferred:
+		conditions = append(conditions, `EXISTS (SELECT 1 FROM user_referrals r WHERE r.referred_id = u.telegram_id)`)
+	case ReferralNotReferred:
+		conditions = append(conditions, `NOT EXISTS (SELECT 1 FROM user_referrals r WHERE r.referred_id = u.telegram_id)`)
+	case ReferralReferrer:
+		conditions = append(conditions, `EXISTS (SELECT 1 FROM user_referrals r WHERE r.referrer_id = u.telegram_id)`)
+	}
+
+	return strings.Join(conditions, " AND "), args
+}
+
+// CountAudience возвращает количество пользователей сегмента
+func (r *Repository) CountAudience(ctx context.Context, s Segment) (int, error) {
+	where, args := segmentFilter(s, 1)
+
+	var count int
+	if err := r.db.QueryRowContext(ctx, `SELECT COUNT(*) FROM users u WHERE `+where, args...).Scan(&count); err != nil {
+		return 0, fmt.Errorf("ошибка подсчета аудитории: %w", err)
+	}
+	return count, nil
+}
+
+// AudiencePage возвращает Telegram ID пользователей сегмента больше afterID по возрастанию
+func (r *Repository) AudiencePage(ctx context.Context, s Segment, afterID int64, limit int) ([]int64, error) {
+	where, args := segmentFilter(s, 3)
+	query := `SELECT u.telegram_id FROM users u WHERE u.telegram_id > $1 AND ` + where +
+		` ORDER BY u.telegram_id LIMIT $2`
+
+	return r.queryIDs(ctx, query, append([]interface{}{afterID, limit}, args...)...)
+}
+
+// AddDeliveries добавляет доставки кампании в статусе pending, уже добавленные пропускаются
+func (r *Repository) AddDeliveries(ctx context.Context, campaignID int64, userIDs []int64) error {
+	_, err := r.db.ExecContext(ctx, `
+		INSERT INTO broadcast_deliveries (campaign_id, user_id, status)
+		SELECT $1, UNNEST($2::BIGINT[]), $3
+		ON CONFLICT (campaign_id, user_id) DO NOTHING
+	`, campaignID, pq.Array(userIDs), DeliveryPending)
+	if err != nil {
+		return fmt.Errorf("ошибка добавления доставок: %w", err)
+	}
+	return nil
+}
+
+// UnsentPage возвращает получателей, которым сообщение еще не отправлено: в очереди
+// или взятых обработчиком слишком давно
+func (r *Repository) UnsentPage(ctx context.Context, campaignID, afterID int64, limit int) ([]int64, error) {
+	return r.queryIDs(ctx, `
+		SELECT user_id FROM broadcast_deliveries
+		WHERE campaign_id = $1 AND user_id > $2
+		  AND (status = $3 OR (status = $4 AND updated_at < NOW() - INTERVAL '`+staleSendingInterval+`'))
+		ORDER BY user_id
+		LIMIT $5
+	`, campaignID, afterID, DeliveryPending, DeliverySending, limit)
+}
+
+// queryIDs выполняет запрос, возвращающий список ID
+func (r *Repository) queryIDs(ctx context.Context, query string, args ...interface{}) ([]int64, error) {
+	rows, err := r.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("ошибка получения получателей: %w", err)
+	}
+	defer rows.Close()
+
+	var ids []int64
+	for rows.Next() {
+		var id int64
+		if err := rows.Scan(&id); err != nil {
+			return nil, fmt.Errorf("ошибка сканирования получателя: %w", err)
+		}
+		ids = append(ids, id)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("ошибка при итерации получателей: %w", err)
+	}
+
+	return ids, nil
+}
+
+// ClaimDelivery берет доставку в обработку. Возвращает false, если доставка уже обработана
+// или взята другим обработчиком, чтобы повторная доставка сообщения очереди не отправила его дважды
+func (r *Repository) ClaimDelivery(ctx context.Context, campaignID, userID int64) (bool, error) {
+	result, err := r.db.ExecContext(ctx, `
+		UPDATE broadcast_deliveries
+		SET status = $3, attempts = attempts + 1, updated_at = NOW()
+		WHERE campaign_id = $1 AND user_id = $2
+		  AND (status = $4 OR (status = $3 AND updated_at < NOW() - INTERVAL '`+staleSendingInterval+`'))
+	`, campaignID, userID, DeliverySending, DeliveryPending)
+	if err != nil {
+		return false, fmt.Errorf("ошибка захвата доставки: %w", err)
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return false, fmt.Errorf("ошибка получения количества затронутых строк: %w", err)
+	}
+
+	return rowsAffected > 0, nil
+}
+
+// FinishDelivery сохраняет результат доставки
+func (r *Repository) FinishDelivery(ctx context.Context, campaignID, userID int64, status DeliveryStatus, errText string) error {
+	_, err := r.db.ExecContext(ctx, `
+		UPDATE broadcast_deliveries
+		SET status = $3, error = NULLIF($4, ''),
+			sent_at = CASE WHEN $3 = 'sent' THEN NOW() ELSE sent_at END,
+			updated_at = NOW()
+		WHERE campaign_id = $1 AND user_id = $2
+	`, campaignID, userID, status, errText)
+	if err != nil {
+		return fmt.Errorf("ошибка сохранения результата доставки: %w", err)
+	}
+	return nil
+}
+
+// SkipUnsent пропускает доставки отмененной кампании, которые еще не отправлены
+func (r *Repository) SkipUnsent(ctx context.Context, campaignID int64) error {
+	_, err := r.db.ExecContext(ctx, `
+		UPDATE broadcast_deliveries SET status = $2, updated_at = NOW()
+		WHERE campaign_id = $1 AND status = $3
+	`, campaignID, DeliverySkipped, DeliveryPending)
+	if err != nil {
+		return fmt.Errorf("ошибка пропуска доставок: %w", err)
+	}
+	return nil
+}
+
+// GetStats возвращает статистику доставки кампании
+func (r *Repository) GetStats(ctx context.Context, campaignID int64) (*Stats, error) {
+	rows, err := r.db.QueryContext(ctx, `
+		SELECT status, COUNT(*) FROM broadcast_deliveries WHERE campaign_id = $1 GROUP BY status
+	`, campaignID)
+	if err != nil {
+		return nil, fmt.Errorf("ошибка получения статистики кампании: %w", err)
+	}
+	defer rows.Close()
+
+	stats := &Stats{}
+	for rows.Next() {
+		var status DeliveryStatus
+		var count int
+		if err := rows.Scan(&status, &count); err != nil {
+			return nil, fmt.Errorf("ошибка сканирования статистики: %w", err)
+		}
+		switch status {
+		case DeliveryPending, DeliverySending:
+			stats.Pending += count
+		case DeliverySent:
+			stats.Sent = count
+		case DeliveryFailed:
+			stats.Failed = count
+		case DeliveryBlocked:
+			stats.Blocked = count
+		case DeliverySkipped:
+			stats.Skipped = count
+		}
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("ошибка при итерации статистики: %w", err)
+	}
+
+	return stats, nil
+}
@@ -0,0 +1,485 @@
+// Сервис рассылок по сегментам пользователей
+
+package broadcast
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/nats-io/nats.go"
+	"github.com/redis/go-redis/v9"
+	"go.uber.org/zap"
+
+	"neurobot-prod/internal/config"
+	"neurobot-prod/internal/telegram"
+	"neurobot-prod/internal/user"
+)
+
+const (
+	// maxTextLength - максимальная длина сообщения Telegram
+	maxTextLength = 4096
+	// maxTitleLength - длина названия кампании, взятого из первой строки текста
+	maxTitleLength = 60
+	// audiencePageSize - количество получателей, читаемых из базы данных за один запрос
+	audiencePageSize = 1000
+	// batchTimeout - максимальное время обработки одного сообщения очереди
+	batchTimeout = 10 * time.Minute
+	// queueGroup - группа очереди, каждое сообщение обрабатывает только один экземпляр
+	queueGroup = "broadcast"
+)
+
+var (
+	// ErrCampaignNotFound возвращается, если кампания не найдена
+	ErrCampaignNotFound = errors.New("кампания не найдена")
+	// ErrNotDraft возвращается при запуске кампании, которая уже запущена или завершена
+	ErrNotDraft = errors.New("кампания уже запущена или завершена")
+	// ErrNotRunning возвращается при возобновлении кампании, которая не идет
+	ErrNotRunning = errors.New("кампания не запущена")
+	// ErrFinished возвращается при отмене завершенной кампании
+	ErrFinished = errors.New("кампания уже завершена")
+	// ErrEmptyText возвращается при создании кампании без текста
+	ErrEmptyText = errors.New("текст рассылки не указан")
+	// ErrTextTooLong возвращается, если текст не помещается в одно сообщение Telegram
+	ErrTextTooLong = errors.New("текст рассылки длиннее 4096 символов")
+	// ErrInvalidSegment возвращается при некорректных условиях сегмента
+	ErrInvalidSegment = errors.New("некорректные условия сегмента")
+	// ErrEmptyAudience возвращается при запуске кампании без получателей
+	ErrEmptyAudience = errors.New("в сегмент не попал ни один пользователь")
+)
+
+// Sender отправляет текстовое сообщение пользователю
+type Sender func(userID int64, text string) error
+
+// Publisher публикует сообщения в брокер
+type Publisher interface {
+	Publish(ctx context.Context, subject string, data interface{}) error
+}
+
+// Service предоставляет методы для рассылок. Кампания ставит получателей в очередь NATS
+// частями, обработчик очереди отправляет сообщения с общим ограничением частоты
+type Service struct {
+	repo        *Repository
+	userService *user.Service
+	publisher   Publisher
+	limiter     *rateLimiter
+	subject     string
+	config      config.BroadcastConfig
+	send        Sender
+	log         *zap.Logger
+}
+
+// NewService создает новый сервис рассылок
+func NewService(
+	repo *Repository,
+	userService *user.Service,
+	publisher Publisher,
+	redisClient *redis.Client,
+	cfg *config.Config,
+	log *zap.Logger,
+) *Service {
+	logger := log.Named("broadcast_service")
+	return &Service{
+		repo:        repo,
+		userService: userService,
+		publisher:   publisher,
+		limiter:     newRateLimiter(redisClient, cfg.Broadcast.RateLimit, logger),
+		subject:     cfg.NATS.Subjects.Broadcast,
+		config:      cfg.Broadcast,
+		log:         logger,
+	}
+}
+
+// SetSender устанавливает функцию отправки сообщений
+func (s *Service) SetSender(send Sender) {
+	s.send = send
+}
+
+// Create создает черновик кампании. Без названия используется первая строка текста
+func (s *Service) Create(ctx context.Context, createdBy int64, title, text string, segment Segment) (*Campaign, error) {
+	text = strings.TrimSpace(text)
+	if text == "" {
+		return nil, ErrEmptyText
+	}
+	if utf8.RuneCountInString(text) > maxTextLength {
+		return nil, ErrTextTooLong
+	}
+	segment = segment.normalized()
+	if err := segment.Validate(); err != nil {
+		return nil, err
+	}
+
+	title = strings.TrimSpace(title)
+	if title == "" {
+		title, _, _ = strings.Cut(text, "\n")
+	}
+	if runes := []rune(title); len(runes) > maxTitleLength {
+		title = string(runes[:maxTitleLength])
+	}
+
+	c := &Campaign{
+		Title:     title,
+		Text:      text,
+		Segment:   segment,
+		Status:    StatusDraft,
+		CreatedBy: createdBy,
+	}
+	if err := s.repo.CreateCampaign(ctx, c); err != nil {
+		return nil, err
+	}
+
+	s.log.Info("Создана кампания рассылки",
+		zap.Int64("campaign_id", c.ID),
+		zap.Int64("created_by", createdBy),
+		zap.String("segment", segment.String()))
+
+	return c, nil
+}
+
+// Get возвращает кампанию со статистикой доставки
+func (s *Service) Get(ctx context.Context, id int64) (*Campaign, *Stats, error) {
+	c, err := s.getCampaign(ctx, id)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	stats, err := s.repo.GetStats(ctx, id)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return c, stats, nil
+}
+
+// getCampaign возвращает кампанию или ErrCampaignNotFound
+func (s *Service) getCampaign(ctx context.Context, id int64) (*Campaign, error) {
+	c, err := s.repo.GetCampaign(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	if c == nil {
+		return nil, ErrCampaignNotFound
+	}
+	return c, nil
+}
+
+// List возвращает последние кампании
+func (s *Service) List(ctx context.Context, limit int) ([]*Campaign, error) {
+	return s.repo.ListCampaigns(ctx, limit)
+}
+
+// Estimate возвращает размер аудитории сегмента без отправки (пробный запуск)
+func (s *Service) Estimate(ctx context.Context, segment Segment) (int, error) {
+	segment = segment.normalized()
+	if err := segment.Validate(); err != nil {
+		return 0, err
+	}
+	return s.repo.CountAudience(ctx, segment)
+}
+
+// Preview отправляет текст кампании администратору, чтобы проверить его перед запуском
+func (s *Service) Preview(ctx context.Context, id, adminID int64) error {
+	c, err := s.getCampaign(ctx, id)
+	if err != nil {
+		return err
+	}
+	if s.send == nil {
+		return fmt.Errorf("отправка сообщений не настроена")
+	}
+	if err := s.send(adminID, c.Text); err != nil {
+		return fmt.Errorf("ошибка отправки пробного сообщения: %w", err)
+	}
+	return nil
+}
+
+// Start запускает черновик: фиксирует получателей и ставит их в очередь отправки
+func (s *Service) Start(ctx context.Context, id int64) (*Campaign, error) {
+	c, err := s.getCampaign(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	if c.Status != StatusDraft {
+		return nil, ErrNotDraft
+	}
+
+	audience, err := s.repo.CountAudience(ctx, c.Segment)
+	if err != nil {
+		return nil, err
+	}
+	if audience == 0 {
+		return nil, ErrEmptyAudience
+	}
+
+	started, err := s.repo.StartCampaign(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	if !started {
+		return nil, ErrNotDraft
+	}
+
+	total, err := s.enqueueAudience(ctx, c)
+	if err != nil {
+		return nil, err
+	}
+
+	s.log.Info("Кампания рассылки запущена",
+		zap.Int64("campaign_id", id),
+		zap.Int("recipients", total))
+	return s.getCampaign(ctx, id)
+}
+
+// Resume повторно ставит в очередь неотправленные доставки идущей кампании, например
+// после перезапуска обработчика или ошибки постановки в очередь при запуске
+func (s *Service) Resume(ctx context.Context, id int64) (int, error) {
+	c, err := s.getCampaign(ctx, id)
+	if err != nil {
+		return 0, err
+	}
+	if c.Status != StatusRunning {
+		return 0, ErrNotRunning
+	}
+
+	// Количество получателей сохраняется после постановки в очередь всей аудитории.
+	// Если запуск прервался раньше, ставим аудиторию в очередь заново: уже отправленные
+	// доставки не будут взяты обработчиком повторно
+	if c.TotalRecipients == 0 {
+		return s.enqueueAudience(ctx, c)
+	}
+
+	queued := 0
+	var afterID int64
+	for {
+		ids, err := s.repo.UnsentPage(ctx, id, afterID, audiencePageSize)
+		if err != nil {
+			return queued, err
+		}
+		if len(ids) == 0 {
+			break
+		}
+		if err := s.publish(ctx, id, ids); err != nil {
+			return queued, err
+		}
+		queued += len(ids)
+		afterID = ids[len(ids)-1]
+	}
+
+	if queued == 0 {
+		s.complete(ctx, id)
+	}
+
+	s.log.Info("Кампания рассылки возобновлена",
+		zap.Int64("campaign_id", id),
+		zap.Int("queued", queued))
+
+	return queued, nil
+}
+
+// Cancel останавливает кампанию. Доставки, еще не взятые обработчиком, пропускаются
+func (s *Service) Cancel(ctx context.Context, id int64) error {
+	if _, err := s.getCampaign(ctx, id); err != nil {
+		return err
+	}
+
+	cancelled, err := s.repo.CancelCampaign(ctx, id)
+	if err != nil {
+		return err
+	}
+	if !cancelled {
+		return ErrFinished
+	}
+
+	if err := s.repo.SkipUnsent(ctx, id); err != nil {
+		return err
+	}
+
+	s.log.Info("Кампания рассылки отменена", zap.Int64("campaign_id", id))
+	return nil
+}
+
+// enqueueAudience создает доставки для пользователей сегмента и ставит их в очередь.
+// Возвращает количество получателей
+func (s *Service) enqueueAudience(ctx context.Context, c *Campaign) (int, error) {
+	total := 0
+	var afterID int64
+	for {
+		ids, err := s.repo.AudiencePage(ctx, c.Segment, afterID, audiencePageSize)
+		if err != nil {
+			return total, err
+		}
+		if len(ids) == 0 {
+			break
+		}
+		if err := s.repo.AddDeliveries(ctx, c.ID, ids); err != nil {
+			return total, err
+		}
+		if err := s.publish(ctx, c.ID, ids); err != nil {
+			return total, err
+		}
+		total += len(ids)
+		afterID = ids[len(ids)-1]
+	}
+
+	if err := s.repo.SetTotalRecipients(ctx, c.ID, total); err != nil {
+		return total, err
+	}
+	if total == 0 {
+		s.complete(ctx, c.ID)
+	}
+	return total, nil
+}
+
+// publish ставит получателей в очередь частями по BatchSize
+func (s *Service) publish(ctx context.Context, campaignID int64, userIDs []int64) error {
+	size := s.config.BatchSize
+	if size <= 0 {
+		size = len(userIDs)
+	}
+
+	for start := 0; start < len(userIDs); start += size {
+		end := min(start+size, len(userIDs))
+		msg := batch{CampaignID: campaignID, UserIDs: userIDs[start:end]}
+		if err := s.publisher.Publish(ctx, s.subject, msg); err != nil {
+			return fmt.Errorf("ошибка постановки рассылки в очередь: %w", err)
+		}
+	}
+	return nil
+}
+
+// complete завершает кампанию, если все доставки обработаны
+func (s *Service) complete(ctx context.Context, id int64) {
+	completed, err := s.repo.CompleteIfDone(ctx, id)
+	if err != nil {
+		s.log.Error("Ошибка завершения кампании рассылки",
+			zap.Int64("campaign_id", id),
+			zap.Error(err))
+		return
+	}
+	if completed {
+		s.log.Info("Кампания рассылки завершена", zap.Int64("campaign_id", id))
+	}
+}
+
+// Listen подписывается на очередь отправки. Группа очереди гарантирует,
+// что при нескольких экземплярах обработчика каждую часть отправит только один
+func (s *Service) Listen(nc *nats.Conn) (*nats.Subscription, error) {
+	sub, err := nc.QueueSubscribe(s.subject, queueGroup, s.handleBatch)
+	if err != nil {
+		return nil, fmt.Errorf("ошибка подписки на очередь рассылок: %w", err)
+	}
+
+	s.log.Info("Подписка на очередь рассылок",
+		zap.String("subject", s.subject),
+		zap.String("queue_group", queueGroup))
+
+	return sub, nil
+}
+
+// handleBatch отправляет сообщения получателям из одной части очереди
+func (s *Service) handleBatch(msg *nats.Msg) {
+	var b batch
+	if err := json.Unmarshal(msg.Data, &b); err != nil {
+		s.log.Error("Ошибка разбора сообщения очереди рассылок", zap.Error(err))
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), batchTimeout)
+	defer cancel()
+
+	c, err := s.repo.GetCampaign(ctx, b.CampaignID)
+	if err != nil {
+		s.log.Error("Ошибка получения кампании рассылки",
+			zap.Int64("campaign_id", b.CampaignID),
+			zap.Error(err))
+		return
+	}
+	if c == nil || c.Status != StatusRunning {
+		return
+	}
+	if s.send == nil {
+		s.log.Error("Отправка сообщений не настроена, часть рассылки пропущена",
+			zap.Int64("campaign_id", b.CampaignID))
+		return
+	}
+
+	for _, userID := range b.UserIDs {
+		s.deliver(ctx, c, userID)
+	}
+
+	s.complete(ctx, c.ID)
+}
+
+// deliver отправляет сообщение кампании одному получателю и сохраняет результат
+func (s *Service) deliver(ctx context.Context, c *Campaign, userID int64) {
+	claimed, err := s.repo.ClaimDelivery(ctx, c.ID, userID)
+	if err != nil {
+		s.log.Error("Ошибка захвата доставки рассылки",
+			zap.Int64("campaign_id", c.ID),
+			zap.Int64("user_id", userID),
+			zap.Error(err))
+		return
+	}
+	if !claimed {
+		return
+	}
+
+	status, sendErr := s.sendWithRetry(ctx, userID, c.Text)
+	errText := ""
+	if sendErr != nil {
+		errText = sendErr.Error()
+	}
+
+	if err := s.repo.FinishDelivery(ctx, c.ID, userID, status, errText); err != nil {
+		s.log.Error("Ошибка сохранения результата доставки рассылки",
+			zap.Int64("campaign_id", c.ID),
+			zap.Int64("user_id", userID),
+			zap.Error(err))
+	}
+
+	switch status {
+	case DeliveryBlocked:
+		if err := s.userService.MarkBlocked(ctx, userID); err != nil {
+			s.log.Error("Ошибка отметки блокировки бота",
+				zap.Int64("user_id", userID),
+				zap.Error(err))
+		}
+	case DeliveryFailed:
+		s.log.Warn("Не удалось отправить сообщение рассылки",
+			zap.Int64("campaign_id", c.ID),
+			zap.Int64("user_id", userID),
+			zap.Error(sendErr))
+	}
+}
+
+// sendWithRetry отправляет сообщение с учетом общего ограничения частоты.
+// При ответе 429 ждет указанное Telegram время и повторяет отправку до MaxRetries раз
+func (s *Service) sendWithRetry(ctx context.Context, userID int64, text string) (DeliveryStatus, error) {
+	for attempt := 0; ; attempt++ {
+		if err := s.limiter.Wait(ctx); err != nil {
+			return DeliveryFailed, err
+		}
+
+		err := s.send(userID, text)
+		if err == nil {
+			return DeliverySent, nil
+		}
+		if telegram.IsBlocked(err) {
+			return DeliveryBlocked, err
+		}
+
+		wait, limited := telegram.RetryAfter(err)
+		if !limited || attempt >= s.config.MaxRetries {
+			return DeliveryFailed, err
+		}
+		s.log.Warn("Telegram ограничил частоту отправки рассылки",
+			zap.Int64("user_id", userID),
+			zap.Duration("retry_after", wait))
+		if err := sleep(ctx, wait); err != nil {
+			return DeliveryFailed, err
+		}
+	}
+}
@@ -0,0 +1,174 @@
+// Тесты отправки рассылок обработчиком очереди
+
+package broadcast
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"net/http"
+	"sync"
+	"testing"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+	"github.com/nats-io/nats.go"
+	"go.uber.org/zap"
+
+	"neurobot-prod/internal/config"
+	"neurobot-prod/internal/storage/postgres/pgtest"
+	"neurobot-prod/internal/user"
+)
+
+// fakePublisher запоминает части рассылки, поставленные в очередь
+type fakePublisher struct {
+	batches []interface{}
+}
+
+func (p *fakePublisher) Publish(ctx context.Context, subject string, data interface{}) error {
+	p.batches = append(p.batches, data)
+	return nil
+}
+
+// fakeSender отвечает на отправку заданными по очереди ошибками для каждого получателя
+// и считает попытки отправки
+type fakeSender struct {
+	mu       sync.Mutex
+	errors   map[int64][]error
+	attempts map[int64]int
+}
+
+func (s *fakeSender) send(userID int64, text string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.attempts[userID]++
+	if errs := s.errors[userID]; len(errs) > 0 {
+		s.errors[userID] = errs[1:]
+		return errs[0]
+	}
+	return nil
+}
+
+// newTestService создает сервис рассылок с базой из pgtest и недоступным Redis
+func newTestService(t *testing.T, sender *fakeSender, userIDs ...int64) (*Service, *fakePublisher, *sql.DB) {
+	db := pgtest.Open(t)
+	for _, userID := range userIDs {
+		pgtest.CreateUser(t, db, userID)
+	}
+
+	log := zap.NewNop()
+	redisClient := unavailableRedis(t)
+	cfg := &config.Config{}
+	cfg.Broadcast = config.BroadcastConfig{RateLimit: 1000, BatchSize: 2, MaxRetries: 1}
+	publisher := &fakePublisher{}
+	service := NewService(NewRepository(db), user.NewService(user.NewRepository(db), redisClient, log),
+		publisher, redisClient, cfg, log)
+	service.SetSender(sender.send)
+	return service, publisher, db
+}
+
+// handlePublished передает обработчику очереди все поставленные в очередь части
+func handlePublished(t *testing.T, service *Service, publisher *fakePublisher) {
+	t.Helper()
+
+	for _, b := range publisher.batches {
+		data, err := json.Marshal(b)
+		if err != nil {
+			t.Fatal(err)
+		}
+		service.handleBatch(&nats.Msg{Data: data})
+	}
+}
+
+func TestHandleBatchDelivery(t *testing.T) {
+	sender := &fakeSender{
+		errors: map[int64][]error{
+			4902: {&tgbotapi.Error{Code: http.StatusForbidden, Message: "Forbidden: bot was blocked by the user"}},
+			4903: {&tgbotapi.Error{Code: http.StatusTooManyRequests, ResponseParameters: tgbotapi.ResponseParameters{RetryAfter: 1}}},
+			4904: {
+				&tgbotapi.Error{Code: http.StatusTooManyRequests, ResponseParameters: tgbotapi.ResponseParameters{RetryAfter: 1}},
+				&tgbotapi.Error{Code: http.StatusTooManyRequests, ResponseParameters: tgbotapi.ResponseParameters{RetryAfter: 1}},
+			},
+		},
+		attempts: make(map[int64]int),
+	}
+	service, publisher, db := newTestService(t, sender, 4901, 4902, 4903, 4904)
+	ctx := context.Background()
+
+	c, err := service.Create(ctx, 1, "", "Новости", Segment{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := service.Start(ctx, c.ID); err != nil {
+		t.Fatal(err)
+	}
+	if len(publisher.batches) != 2 {
+		t.Fatalf("в очередь поставлено %d частей, ожидалось 2", len(publisher.batches))
+	}
+
+	handlePublished(t, service, publisher)
+	// Повторная доставка сообщений очереди не отправляет сообщения второй раз
+	handlePublished(t, service, publisher)
+
+	// После 429 отправка повторяется не больше MaxRetries раз
+	want := map[int64]int{4901: 1, 4902: 1, 4903: 2, 4904: 2}
+	for userID, attempts := range want {
+		if sender.attempts[userID] != attempts {
+			t.Errorf("попыток отправки пользователю %d: %d, ожидалось %d", userID, sender.attempts[userID], attempts)
+		}
+	}
+
+	c, stats, err := service.Get(ctx, c.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if *stats != (Stats{Sent: 2, Blocked: 1, Failed: 1}) {
+		t.Errorf("статистика %+v, ожидалось 2 отправлено, 1 заблокировано, 1 ошибка", *stats)
+	}
+	if c.Status != StatusCompleted {
+		t.Errorf("статус кампании %s, ожидался %s", c.Status, StatusCompleted)
+	}
+
+	// Заблокировавший бота пользователь исключается из следующих рассылок
+	var blocked bool
+	if err := db.QueryRowContext(ctx, `SELECT blocked_at IS NOT NULL FROM users WHERE telegram_id = $1`, 4902).Scan(&blocked); err != nil {
+		t.Fatal(err)
+	}
+	if !blocked {
+		t.Error("пользователь, заблокировавший бота, не отмечен")
+	}
+	if audience, err := service.Estimate(ctx, Segment{}); err != nil || audience != 3 {
+		t.Errorf("аудитория следующей рассылки %d (%v), ожидалось 3", audience, err)
+	}
+}
+
+func TestHandleBatchSkipsCancelledCampaign(t *testing.T) {
+	sender := &fakeSender{attempts: make(map[int64]int)}
+	service, publisher, _ := newTestService(t, sender, 4911, 4912)
+	ctx := context.Background()
+
+	c, err := service.Create(ctx, 1, "", "Новости", Segment{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := service.Start(ctx, c.ID); err != nil {
+		t.Fatal(err)
+	}
+	if err := service.Cancel(ctx, c.ID); err != nil {
+		t.Fatal(err)
+	}
+
+	// Части, оставшиеся в очереди после отмены, не отправляются
+	handlePublished(t, service, publisher)
+	if len(sender.attempts) != 0 {
+		t.Errorf("после отмены отправлены сообщения: %v", sender.attempts)
+	}
+
+	_, stats, err := service.Get(ctx, c.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if *stats != (Stats{Skipped: 2}) {
+		t.Errorf("статистика %+v, ожидалось 2 пропущено", *stats)
+	}
+}
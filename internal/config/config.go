@@ -15,6 +15,18 @@ type AppConfig struct {
 	Env      string `mapstructure:"env"`
 	LogLevel string `mapstructure:"log_level"`
 	Domain   string `mapstructure:"domain"` // Домен для вебхуков и Mini App
+
+	AdminIDs []int64 `mapstructure:"admin_ids"` // Telegram ID администраторов бота
+}
+
+// IsAdmin проверяет, является ли пользователь администратором бота
+func (c AppConfig) IsAdmin(userID int64) bool {
+	for _, id := range c.AdminIDs {
+		if id == userID {
+			return true
+		}
+	}
+	return false
 }
 
 // NATSConfig содержит настройки для NATS
@@ -31,6 +43,8 @@ type NATSSubjects struct {
 	TelegramUpdates string `mapstructure:"telegram_updates"`
 	LLMTasks        string `mapstructure:"llm_tasks"`
 	LLMResults      string `mapstructure:"llm_results"`
+	Events          string `mapstructure:"events"`    // Префикс тем доменных событий
+	Broadcast       string `mapstructure:"broadcast"` // Очередь отправки рассылок
 }
 
 // TelegramConfig содержит настройки для Telegram API
@@ -65,10 +79,13 @@ type RedisConfig struct {
 
 // LLMConfig содержит настройки для различных моделей ИИ
 type LLMConfig struct {
-	OpenAI OpenAIConfig `mapstructure:"openai"`
-	Claude ClaudeConfig `mapstructure:"claude"`
-	Grok   GrokConfig   `mapstructure:"grok"`
-	Gemini GeminiConfig `mapstructure:"gemini"`
+	OpenAI  OpenAIConfig  `mapstructure:"openai"`
+	Claude  ClaudeConfig  `mapstructure:"claude"`
+	Grok    GrokConfig    `mapstructure:"grok"`
+	Gemini  GeminiConfig  `mapstructure:"gemini"`
+	Image   ImageConfig   `mapstructure:"image"`
+	Tools   ToolsConfig   `mapstructure:"tools"`
+	Context ContextConfig `mapstructure:"context"`
 }
 
 // OpenAIConfig содержит настройки для OpenAI API
@@ -111,6 +128,38 @@ type GeminiConfig struct {
 	ApiKey            string // Заполняется из ENV
 }
 
+// ImageConfig содержит настройки для генерации изображений
+type ImageConfig struct {
+	Provider    string         `mapstructure:"provider"` // openai или mock
+	Model       string         `mapstructure:"model"`
+	APIURL      string         `mapstructure:"api_url"` // Адрес OpenAI Images-совместимого API
+	DefaultSize string         `mapstructure:"default_size"`
+	SizeCosts   map[string]int `mapstructure:"size_costs"` // Стоимость изображения в нейронах по размерам
+	ApiKey      string         // Заполняется из ENV (по умолчанию используется ключ OpenAI)
+}
+
+// ToolsConfig содержит настройки вызова инструментов (function calling)
+type ToolsConfig struct {
+	Enabled       bool           `mapstructure:"enabled"`
+	MaxIterations int            `mapstructure:"max_iterations"` // Максимальное число циклов вызова инструментов на один запрос
+	CallCost      int            `mapstructure:"call_cost"`      // Стоимость вызова инструмента в нейронах по умолчанию
+	Costs         map[string]int `mapstructure:"costs"`          // Стоимость вызова отдельных инструментов
+}
+
+// GetCallCost возвращает стоимость вызова инструмента
+func (c ToolsConfig) GetCallCost(toolName string) int {
+	if cost, ok := c.Costs[toolName]; ok {
+		return cost
+	}
+	return c.CallCost
+}
+
+// ContextConfig содержит настройки управления контекстом диалога
+type ContextConfig struct {
+	SummaryModel     string `mapstructure:"summary_model"`      // Дешевая модель для составления краткого содержания
+	SummaryMaxTokens int    `mapstructure:"summary_max_tokens"` // Максимальный размер краткого содержания в токенах
+}
+
 // ServiceConfig содержит настройки для различных сервисов
 type ServiceConfig struct {
 	Webhook WebhookServiceConfig `mapstructure:"webhook"`
@@ -125,10 +174,12 @@ type WebhookServiceConfig struct {
 
 // APIServiceConfig содержит настройки для API сервиса
 type APIServiceConfig struct {
-	Port               int      `mapstructure:"port"`
-	CORSAllowedOrigins []string `mapstructure:"cors_allowed_origins"`
-	JWTSecret          string   // Заполняется из ENV
-	JWTExpiryHours     int      `mapstructure:"jwt_expiry_hours"`
+	Port                int      `mapstructure:"port"`
+	CORSAllowedOrigins  []string `mapstructure:"cors_allowed_origins"`
+	JWTSecret           string   // Заполняется из ENV
+	JWTExpiryHours      int      `mapstructure:"jwt_expiry_hours"`
+	AdminJWTExpiryHours int      `mapstructure:"admin_jwt_expiry_hours"`  // Срок действия токена консоли администратора
+	InitDataMaxAgeHours int      `mapstructure:"init_data_max_age_hours"` // Срок действия initData Mini App для авторизации
 }
 
 // MetricsConfig содержит настройки для сбора метрик
@@ -151,21 +202,166 @@ type SubscriptionConfig struct {
 	BaseModelCost    int `mapstructure:"base_model_cost"`
 	PremiumModelCost int `mapstructure:"premium_model_cost"`
 	ProModelCost     int `mapstructure:"pro_model_cost"`
+
+	// Автопродление
+	RenewBeforeHours    int   `mapstructure:"renew_before_hours"`    // За сколько часов до окончания списывать оплату
+	DunningScheduleDays []int `mapstructure:"dunning_schedule_days"` // Дни попыток списания от первой попытки
+}
+
+// GetRenewBefore возвращает интервал до окончания подписки, когда начинается продление
+func (c SubscriptionConfig) GetRenewBefore() time.Duration {
+	return time.Duration(c.RenewBeforeHours) * time.Hour
 }
 
 // PaymentConfig содержит настройки для системы платежей
 type PaymentConfig struct {
-	YooKassa YooKassaConfig `mapstructure:"yookassa"`
-	// Можно добавить другие платежные системы
+	YooKassa YooKassaConfig         `mapstructure:"yookassa"`
+	Telegram TelegramPaymentsConfig `mapstructure:"telegram"`
 }
 
 // YooKassaConfig содержит настройки для ЮKassa
 type YooKassaConfig struct {
 	ShopID      string `mapstructure:"shop_id"`
 	CallbackURL string `mapstructure:"callback_url"`
+	APIURL      string `mapstructure:"api_url"`    // Адрес API (можно заменить на локальный тестовый сервер)
+	ReturnURL   string `mapstructure:"return_url"` // Куда вернуть пользователя после оплаты
 	SecretKey   string // Заполняется из ENV
 }
 
+// TelegramPaymentsConfig содержит настройки оплаты через Telegram Payments
+type TelegramPaymentsConfig struct {
+	CardsEnabled   bool   `mapstructure:"cards_enabled"`    // Оплата картой через платежного провайдера Telegram
+	StarsEnabled   bool   `mapstructure:"stars_enabled"`    // Оплата Telegram Stars
+	KopecksPerStar int    `mapstructure:"kopecks_per_star"` // Курс: стоимость одной звезды в копейках
+	ProviderToken  string // Заполняется из ENV
+}
+
+// ReferralConfig содержит настройки реферальной программы
+type ReferralConfig struct {
+	Enabled            bool           `mapstructure:"enabled"`
+	ReferredBonus      int            `mapstructure:"referred_bonus"`      // Нейроны приглашенному сразу после перехода по ссылке
+	ReferrerBonus      int            `mapstructure:"referrer_bonus"`      // Нейроны пригласившему после активации реферала
+	ActivationRequests int            `mapstructure:"activation_requests"` // Сколько платных запросов к нейросети нужно для активации
+	KopecksPerNeuron   int            `mapstructure:"kopecks_per_neuron"`  // Курс пересчета покупок в нейроны для вознаграждения
+	Tiers              []ReferralTier `mapstructure:"tiers"`               // Уровни вознаграждения за покупки рефералов
+}
+
+// ReferralTier определяет процент вознаграждения в зависимости от числа активных рефералов
+type ReferralTier struct {
+	MinActive       int `mapstructure:"min_active"`
+	PurchasePercent int `mapstructure:"purchase_percent"`
+}
+
+// GetTier возвращает уровень реферальной программы для указанного числа активных рефералов
+func (c ReferralConfig) GetTier(activeReferrals int) ReferralTier {
+	var tier ReferralTier
+	for _, t := range c.Tiers {
+		if activeReferrals >= t.MinActive && t.MinActive >= tier.MinActive {
+			tier = t
+		}
+	}
+	return tier
+}
+
+// GetNextTier возвращает следующий уровень реферальной программы, если он есть
+func (c ReferralConfig) GetNextTier(activeReferrals int) *ReferralTier {
+	var next *ReferralTier
+	for i := range c.Tiers {
+		t := c.Tiers[i]
+		if t.MinActive > activeReferrals && (next == nil || t.MinActive < next.MinActive) {
+			next = &t
+		}
+	}
+	return next
+}
+
+// LoyaltyConfig содержит настройки начисления опыта
+type LoyaltyConfig struct {
+	RequestXP         int `mapstructure:"request_xp"`           // Опыт за оплаченный запрос к нейросети
+	RequestXPDailyMax int `mapstructure:"request_xp_daily_max"` // Максимум опыта за запросы в сутки (0 - без ограничений)
+	DailyXP           int `mapstructure:"daily_xp"`             // Опыт за ежедневное начисление нейронов
+	PurchaseXPPerRub  int `mapstructure:"purchase_xp_per_rub"`  // Опыт за каждый рубль покупки
+	ReferralXP        int `mapstructure:"referral_xp"`          // Опыт за активного приглашенного
+}
+
+// StreakConfig содержит настройки серий ежедневных начислений
+type StreakConfig struct {
+	DefaultTimezone    string `mapstructure:"default_timezone"`      // Часовой пояс новых пользователей
+	BonusPercentPerDay int    `mapstructure:"bonus_percent_per_day"` // Бонус к начислению за каждый день серии после первого
+	MaxBonusPercent    int    `mapstructure:"max_bonus_percent"`     // Максимальный бонус за серию
+	FreezePrice        int    `mapstructure:"freeze_price"`          // Стоимость заморозки серии в нейронах
+	MaxFreezes         int    `mapstructure:"max_freezes"`           // Максимум заморозок в запасе
+	ReminderHour       int    `mapstructure:"reminder_hour"`         // Час по времени пользователя, начиная с которого отправляется напоминание
+	ReminderBatchSize  int    `mapstructure:"reminder_batch_size"`   // Количество напоминаний за один запуск
+}
+
+// GetBonusPercent возвращает бонус к ежедневному начислению для серии указанной длины
+func (c StreakConfig) GetBonusPercent(streak int) int {
+	if streak <= 1 {
+		return 0
+	}
+	bonus := (streak - 1) * c.BonusPercentPerDay
+	if c.MaxBonusPercent > 0 && bonus > c.MaxBonusPercent {
+		bonus = c.MaxBonusPercent
+	}
+	return bonus
+}
+
+// GiftConfig содержит настройки подарков нейронов между пользователями
+type GiftConfig struct {
+	Enabled           bool `mapstructure:"enabled"`
+	MinAmount         int  `mapstructure:"min_amount"`           // Минимальный подарок в нейронах
+	MaxPerDay         int  `mapstructure:"max_per_day"`          // Максимум подарков за сутки (0 - без ограничений)
+	MinAccountAgeDays int  `mapstructure:"min_account_age_days"` // Сколько дней должно пройти с регистрации отправителя
+}
+
+// WalletConfig содержит настройки общих кошельков нейронов
+type WalletConfig struct {
+	Enabled    bool `mapstructure:"enabled"`
+	MaxMembers int  `mapstructure:"max_members"` // Максимум участников кошелька, включая владельца
+	MaxOwned   int  `mapstructure:"max_owned"`   // Максимум кошельков, которыми владеет пользователь
+	MaxJoined  int  `mapstructure:"max_joined"`  // Максимум кошельков, в которых состоит пользователь
+}
+
+// AdminConfig содержит настройки консоли администратора
+type AdminConfig struct {
+	MaxAdjustment   int  `mapstructure:"max_adjustment"`    // Максимальная корректировка баланса за одно действие (0 - без ограничений)
+	ErrorLogEnabled bool `mapstructure:"error_log_enabled"` // Сохранять ошибки из логов для просмотра в консоли
+	ErrorLogBuffer  int  `mapstructure:"error_log_buffer"`  // Очередь записи ошибок, при переполнении ошибки отбрасываются
+}
+
+// BroadcastConfig содержит настройки рассылок
+type BroadcastConfig struct {
+	RateLimit  int `mapstructure:"rate_limit"`  // Сообщений в секунду на все экземпляры (лимит Telegram - около 30)
+	BatchSize  int `mapstructure:"batch_size"`  // Получателей в одном сообщении очереди
+	MaxRetries int `mapstructure:"max_retries"` // Повторов отправки при ответе 429
+}
+
+// SchedulerConfig содержит настройки режима scheduler
+type SchedulerConfig struct {
+	Timezone               string            `mapstructure:"timezone"`                  // Часовой пояс cron-выражений
+	LockTTLSeconds         int               `mapstructure:"lock_ttl_seconds"`          // Время жизни блокировки задачи, продлевается во время выполнения
+	JobTimeoutMinutes      int               `mapstructure:"job_timeout_minutes"`       // Максимальное время выполнения задачи
+	PendingPaymentTTLHours int               `mapstructure:"pending_payment_ttl_hours"` // Через сколько неоплаченный платеж без срока действия отменяется
+	RetentionDays          int               `mapstructure:"retention_days"`            // Срок хранения журнала ошибок и истории запусков задач
+	Jobs                   map[string]string `mapstructure:"jobs"`                      // Cron-выражения задач, пустое выражение отключает задачу
+}
+
+// GetLockTTL возвращает время жизни блокировки задачи
+func (c SchedulerConfig) GetLockTTL() time.Duration {
+	return time.Duration(c.LockTTLSeconds) * time.Second
+}
+
+// GetJobTimeout возвращает максимальное время выполнения задачи
+func (c SchedulerConfig) GetJobTimeout() time.Duration {
+	return time.Duration(c.JobTimeoutMinutes) * time.Minute
+}
+
+// GetPendingPaymentTTL возвращает срок, после которого неоплаченный платеж отменяется
+func (c SchedulerConfig) GetPendingPaymentTTL() time.Duration {
+	return time.Duration(c.PendingPaymentTTLHours) * time.Hour
+}
+
 // Config содержит полную конфигурацию приложения
 type Config struct {
 	App          AppConfig
@@ -177,6 +373,14 @@ type Config struct {
 	Services     ServiceConfig
 	Subscription SubscriptionConfig
 	Payment      PaymentConfig
+	Referral     ReferralConfig
+	Loyalty      LoyaltyConfig
+	Streak       StreakConfig
+	Gift         GiftConfig
+	Wallet       WalletConfig
+	Admin        AdminConfig
+	Broadcast    BroadcastConfig
+	Scheduler    SchedulerConfig
 }
 
 // Функции для time.Duration
@@ -228,8 +432,13 @@ func LoadConfig(configPath string) (*Config, error) {
 	cfg.LLM.Claude.ApiKey = v.GetString("llm.claude.api_key")
 	cfg.LLM.Grok.ApiKey = v.GetString("llm.grok.api_key")
 	cfg.LLM.Gemini.ApiKey = v.GetString("llm.gemini.api_key")
+	cfg.LLM.Image.ApiKey = v.GetString("llm.image.api_key")
+	if cfg.LLM.Image.ApiKey == "" {
+		cfg.LLM.Image.ApiKey = cfg.LLM.OpenAI.ApiKey
+	}
 	cfg.Services.API.JWTSecret = v.GetString("services.api.jwt_secret")
 	cfg.Payment.YooKassa.SecretKey = v.GetString("payment.yookassa.secret_key")
+	cfg.Payment.Telegram.ProviderToken = v.GetString("payment.telegram.provider_token")
 
 	if err := validateSecrets(cfg); err != nil {
 		fmt.Fprintf(os.Stderr, "ПРЕДУПРЕЖДЕНИЕ: %v\n", err)
@@ -268,6 +477,7 @@ func setDefaults(v *viper.Viper) {
 	v.SetDefault("app.env", "development")
 	v.SetDefault("app.log_level", "info")
 	v.SetDefault("app.domain", "yourneuro.ru")
+	v.SetDefault("app.admin_ids", []int64{})
 
 	// NATS
 	v.SetDefault("nats.url", "nats://localhost:4222")
@@ -277,6 +487,8 @@ func setDefaults(v *viper.Viper) {
 	v.SetDefault("nats.subjects.telegram_updates", "tg.updates.v1")
 	v.SetDefault("nats.subjects.llm_tasks", "llm.tasks.v1")
 	v.SetDefault("nats.subjects.llm_results", "llm.results.v1")
+	v.SetDefault("nats.subjects.events", "events.v1")
+	v.SetDefault("nats.subjects.broadcast", "broadcast.v1")
 
 	// Telegram
 	v.SetDefault("telegram.webhook_path", "/webhook")
@@ -326,6 +538,26 @@ func setDefaults(v *viper.Viper) {
 	v.SetDefault("llm.gemini.base_token_limit", 4000)
 	v.SetDefault("llm.gemini.premium_token_limit", 8000)
 
+	// LLM - Image
+	v.SetDefault("llm.image.provider", "openai")
+	v.SetDefault("llm.image.model", "dall-e-3")
+	v.SetDefault("llm.image.api_url", "https://api.openai.com/v1/images/generations")
+	v.SetDefault("llm.image.default_size", "1024x1024")
+	v.SetDefault("llm.image.size_costs", map[string]int{
+		"1024x1024": 10,
+		"1024x1792": 15,
+		"1792x1024": 15,
+	})
+
+	// LLM - Tools
+	v.SetDefault("llm.tools.enabled", true)
+	v.SetDefault("llm.tools.max_iterations", 3)
+	v.SetDefault("llm.tools.call_cost", 1)
+
+	// LLM - Context
+	v.SetDefault("llm.context.summary_model", "gpt-3.5-turbo")
+	v.SetDefault("llm.context.summary_max_tokens", 512)
+
 	// Services - Webhook
 	v.SetDefault("services.webhook.port", 8080)
 	v.SetDefault("services.webhook.metrics.enabled", false)
@@ -336,6 +568,8 @@ func setDefaults(v *viper.Viper) {
 	v.SetDefault("services.api.port", 8081)
 	v.SetDefault("services.api.cors_allowed_origins", []string{"https://yourneuro.ru", "https://t.me"})
 	v.SetDefault("services.api.jwt_expiry_hours", 24)
+	v.SetDefault("services.api.admin_jwt_expiry_hours", 1)
+	v.SetDefault("services.api.init_data_max_age_hours", 24)
 
 	// Subscription
 	v.SetDefault("subscription.free_neurons_per_day", 5)
@@ -346,9 +580,83 @@ func setDefaults(v *viper.Viper) {
 	v.SetDefault("subscription.base_model_cost", 1)
 	v.SetDefault("subscription.premium_model_cost", 3)
 	v.SetDefault("subscription.pro_model_cost", 5)
+	v.SetDefault("subscription.renew_before_hours", 24)
+	v.SetDefault("subscription.dunning_schedule_days", []int{0, 1, 3})
 
 	// Payment - YooKassa
 	v.SetDefault("payment.yookassa.callback_url", "https://yourneuro.ru/api/v1/payments/callback")
+	v.SetDefault("payment.yookassa.api_url", "https://api.yookassa.ru/v3")
+	v.SetDefault("payment.yookassa.return_url", "https://yourneuro.ru/")
+
+	// Payment - Telegram Payments
+	v.SetDefault("payment.telegram.cards_enabled", false)
+	v.SetDefault("payment.telegram.stars_enabled", true)
+	v.SetDefault("payment.telegram.kopecks_per_star", 180)
+
+	// Referral
+	v.SetDefault("referral.enabled", true)
+	v.SetDefault("referral.referred_bonus", 20)
+	v.SetDefault("referral.referrer_bonus", 30)
+	v.SetDefault("referral.activation_requests", 3)
+	v.SetDefault("referral.kopecks_per_neuron", 200)
+	v.SetDefault("referral.tiers", []map[string]interface{}{
+		{"min_active": 0, "purchase_percent": 5},
+		{"min_active": 10, "purchase_percent": 10},
+		{"min_active": 50, "purchase_percent": 15},
+	})
+
+	// Loyalty
+	v.SetDefault("loyalty.request_xp", 5)
+	v.SetDefault("loyalty.request_xp_daily_max", 200)
+	v.SetDefault("loyalty.daily_xp", 10)
+	v.SetDefault("loyalty.purchase_xp_per_rub", 1)
+	v.SetDefault("loyalty.referral_xp", 100)
+
+	// Streak
+	v.SetDefault("streak.default_timezone", "Europe/Moscow")
+	v.SetDefault("streak.bonus_percent_per_day", 5)
+	v.SetDefault("streak.max_bonus_percent", 50)
+	v.SetDefault("streak.freeze_price", 30)
+	v.SetDefault("streak.max_freezes", 2)
+	v.SetDefault("streak.reminder_hour", 19)
+	v.SetDefault("streak.reminder_batch_size", 500)
+
+	// Gift
+	v.SetDefault("gift.enabled", true)
+	v.SetDefault("gift.min_amount", 10)
+	v.SetDefault("gift.max_per_day", 5)
+	v.SetDefault("gift.min_account_age_days", 3)
+
+	// Wallet
+	v.SetDefault("wallet.enabled", true)
+	v.SetDefault("wallet.max_members", 10)
+	v.SetDefault("wallet.max_owned", 3)
+	v.SetDefault("wallet.max_joined", 10)
+
+	// Admin
+	v.SetDefault("admin.max_adjustment", 100000)
+	v.SetDefault("admin.error_log_enabled", true)
+	v.SetDefault("admin.error_log_buffer", 256)
+
+	// Broadcast
+	v.SetDefault("broadcast.rate_limit", 25)
+	v.SetDefault("broadcast.batch_size", 50)
+	v.SetDefault("broadcast.max_retries", 3)
+
+	// Scheduler
+	v.SetDefault("scheduler.timezone", "Europe/Moscow")
+	v.SetDefault("scheduler.lock_ttl_seconds", 60)
+	v.SetDefault("scheduler.job_timeout_minutes", 30)
+	v.SetDefault("scheduler.pending_payment_ttl_hours", 24)
+	v.SetDefault("scheduler.retention_days", 30)
+	v.SetDefault("scheduler.jobs.expire_neurons", "5 * * * *")
+	v.SetDefault("scheduler.jobs.renew_subscriptions", "*/15 * * * *")
+	v.SetDefault("scheduler.jobs.expire_subscriptions", "*/15 * * * *")
+	v.SetDefault("scheduler.jobs.expire_pending_payments", "20 * * * *")
+	v.SetDefault("scheduler.jobs.retry_fulfillments", "*/5 * * * *")
+	v.SetDefault("scheduler.jobs.streak_reminders", "0 * * * *")
+	v.SetDefault("scheduler.jobs.warm_caches", "*/10 * * * *")
+	v.SetDefault("scheduler.jobs.cleanup_logs", "30 4 * * *")
 }
 
 // ConnectionString генерирует строку подключения к PostgreSQL
@@ -0,0 +1,74 @@
+// Модель диалогов и персон
+
+package conversation
+
+import (
+	"time"
+)
+
+// Persona представляет шаблон системного промпта, настраиваемый администраторами
+type Persona struct {
+	ID           int       `db:"id"`
+	Code         string    `db:"code"`
+	Name         string    `db:"name"`
+	Description  string    `db:"description"`
+	SystemPrompt string    `db:"system_prompt"`
+	SortOrder    int       `db:"sort_order"`
+	IsActive     bool      `db:"is_active"`
+	CreatedAt    time.Time `db:"created_at"`
+	UpdatedAt    time.Time `db:"updated_at"`
+}
+
+// Conversation представляет диалог пользователя с нейросетью
+type Conversation struct {
+	ID                 int64     `db:"id"`
+	UserID             int64     `db:"user_id"`
+	PersonaID          *int      `db:"persona_id"`
+	CustomSystemPrompt string    `db:"custom_system_prompt"`
+	Summary            string    `db:"summary"`             // Краткое содержание старой части диалога
+	SummarizedUntilID  int64     `db:"summarized_until_id"` // ID последнего сообщения, вошедшего в краткое содержание
+	IsActive           bool      `db:"is_active"`
+	CreatedAt          time.Time `db:"created_at"`
+	UpdatedAt          time.Time `db:"updated_at"`
+
+	// Связанные данные
+	Persona *Persona `db:"-"`
+}
+
+// HasCustomPrompt проверяет, задан ли собственный системный промпт
+func (c *Conversation) HasCustomPrompt() bool {
+	return c.CustomSystemPrompt != ""
+}
+
+// GetSystemPrompt возвращает системный промпт, применяемый к запросам диалога.
+// Собственный промпт пользователя имеет приоритет над промптом персоны
+func (c *Conversation) GetSystemPrompt() string {
+	if c.HasCustomPrompt() {
+		return c.CustomSystemPrompt
+	}
+	if c.Persona != nil {
+		return c.Persona.SystemPrompt
+	}
+	return ""
+}
+
+// GetPersonaName возвращает название активной персоны для отображения пользователю
+func (c *Conversation) GetPersonaName() string {
+	if c.HasCustomPrompt() {
+		return "Собственный промпт"
+	}
+	if c.Persona != nil {
+		return c.Persona.Name
+	}
+	return "Без персоны"
+}
+
+// Message представляет сообщение в истории диалога
+type Message struct {
+	ID             int64     `db:"id"`
+	ConversationID int64     `db:"conversation_id"`
+	Role           string    `db:"role"` // user, assistant
+	Content        string    `db:"content"`
+	ModelName      string    `db:"model_name"`
+	CreatedAt      time.Time `db:"created_at"`
+}
@@ -0,0 +1,412 @@
+// Репозиторий диалогов и персон
+
+package conversation
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+)
+
+// Repository представляет репозиторий для работы с диалогами и персонами
+type Repository struct {
+	db *sql.DB
+}
+
+// NewRepository создает новый репозиторий диалогов
+func NewRepository(db *sql.DB) *Repository {
+	return &Repository{
+		db: db,
+	}
+}
+
+// GetActivePersonas возвращает все активные персоны
+func (r *Repository) GetActivePersonas(ctx context.Context) ([]*Persona, error) {
+	query := `
+		SELECT id, code, name, COALESCE(description, ''), system_prompt,
+			   sort_order, is_active, created_at, updated_at
+		FROM personas
+		WHERE is_active = true
+		ORDER BY sort_order ASC, id ASC
+	`
+
+	rows, err := r.db.QueryContext(ctx, query)
+	if err != nil {
+		return nil, fmt.Errorf("ошибка получения персон: %w", err)
+	}
+	defer rows.Close()
+
+	var personas []*Persona
+	for rows.Next() {
+		persona := &Persona{}
+		err := rows.Scan(
+			&persona.ID,
+			&persona.Code,
+			&persona.Name,
+			&persona.Description,
+			&persona.SystemPrompt,
+			&persona.SortOrder,
+			&persona.IsActive,
+			&persona.CreatedAt,
+			&persona.UpdatedAt,
+		)
+		if err != nil {
+			return nil, fmt.Errorf("ошибка сканирования персоны: %w", err)
+		}
+		personas = append(personas, persona)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("ошибка при итерации персон: %w", err)
+	}
+
+	return personas, nil
+}
+
+// GetAllPersonas возвращает все персоны, включая отключенные
+func (r *Repository) GetAllPersonas(ctx context.Context) ([]*Persona, error) {
+	query := `
+		SELECT id, code, name, COALESCE(description, ''), system_prompt,
+			   sort_order, is_active, created_at, updated_at
+		FROM personas
+		ORDER BY sort_order ASC, id ASC
+	`
+
+	rows, err := r.db.QueryContext(ctx, query)
+	if err != nil {
+		return nil, fmt.Errorf("ошибка получения персон: %w", err)
+	}
+	defer rows.Close()
+
+	var personas []*Persona
+	for rows.Next() {
+		persona := &Persona{}
+		err := rows.Scan(
+			&persona.ID,
+			&persona.Code,
+			&persona.Name,
+			&persona.Description,
+			&persona.SystemPrompt,
+			&persona.SortOrder,
+			&persona.IsActive,
+			&persona.CreatedAt,
+			&persona.UpdatedAt,
+		)
+		if err != nil {
+			return nil, fmt.Errorf("ошибка сканирования персоны: %w", err)
+		}
+		personas = append(personas, persona)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("ошибка при итерации персон: %w", err)
+	}
+
+	return personas, nil
+}
+
+// CreatePersona создает персону. Возвращает false, если персона с таким кодом уже есть
+func (r *Repository) CreatePersona(ctx context.Context, persona *Persona) (bool, error) {
+	query := `
+		INSERT INTO personas (code, name, description, system_prompt, sort_order, is_active, created_at, updated_at)
+		VALUES ($1, $2, $3, $4, $5, $6, NOW(), NOW())
+		ON CONFLICT (code) DO NOTHING
+		RETURNING id, created_at, updated_at
+	`
+
+	err := r.db.QueryRowContext(ctx, query,
+		persona.Code,
+		persona.Name,
+		persona.Description,
+		persona.SystemPrompt,
+		persona.SortOrder,
+		persona.IsActive,
+	).Scan(&persona.ID, &persona.CreatedAt, &persona.UpdatedAt)
+
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return false, nil // Код уже занят
+		}
+		return false, fmt.Errorf("ошибка создания персоны: %w", err)
+	}
+
+	return true, nil
+}
+
+// UpdatePersona обновляет персону по коду. Возвращает false, если персона не найдена
+func (r *Repository) UpdatePersona(ctx context.Context, persona *Persona) (bool, error) {
+	query := `
+		UPDATE personas
+		SET name = $2, description = $3, system_prompt = $4, sort_order = $5, is_active = $6, updated_at = NOW()
+		WHERE code = $1
+		RETURNING id, created_at, updated_at
+	`
+
+	err := r.db.QueryRowContext(ctx, query,
+		persona.Code,
+		persona.Name,
+		persona.Description,
+		persona.SystemPrompt,
+		persona.SortOrder,
+		persona.IsActive,
+	).Scan(&persona.ID, &persona.CreatedAt, &persona.UpdatedAt)
+
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return false, nil // Персона не найдена
+		}
+		return false, fmt.Errorf("ошибка обновления персоны: %w", err)
+	}
+
+	return true, nil
+}
+
+// DeletePersona удаляет персону по коду и сбрасывает ее в диалогах, где она выбрана.
+// Возвращает false, если персона не найдена
+func (r *Repository) DeletePersona(ctx context.Context, code string) (bool, error) {
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return false, fmt.Errorf("ошибка начала транзакции: %w", err)
+	}
+	defer tx.Rollback()
+
+	_, err = tx.ExecContext(ctx, `
+		UPDATE conversations
+		SET persona_id = NULL, updated_at = NOW()
+		WHERE persona_id = (SELECT id FROM personas WHERE code = $1)
+	`, code)
+	if err != nil {
+		return false, fmt.Errorf("ошибка сброса персоны в диалогах: %w", err)
+	}
+
+	result, err := tx.ExecContext(ctx, `DELETE FROM personas WHERE code = $1`, code)
+	if err != nil {
+		return false, fmt.Errorf("ошибка удаления персоны: %w", err)
+	}
+
+	deleted, err := result.RowsAffected()
+	if err != nil {
+		return false, fmt.Errorf("ошибка получения количества удаленных персон: %w", err)
+	}
+	if deleted == 0 {
+		return false, nil
+	}
+
+	if err := tx.Commit(); err != nil {
+		return false, fmt.Errorf("ошибка подтверждения транзакции: %w", err)
+	}
+
+	return true, nil
+}
+
+// GetPersonaByCode находит активную персону по ее коду
+func (r *Repository) GetPersonaByCode(ctx context.Context, code string) (*Persona, error) {
+	query := `
+		SELECT id, code, name, COALESCE(description, ''), system_prompt,
+			   sort_order, is_active, created_at, updated_at
+		FROM personas
+		WHERE code = $1 AND is_active = true
+	`
+
+	return r.scanPersona(r.db.QueryRowContext(ctx, query, code))
+}
+
+// GetPersonaByID находит персону по ее ID
+func (r *Repository) GetPersonaByID(ctx context.Context, personaID int) (*Persona, error) {
+	query := `
+		SELECT id, code, name, COALESCE(description, ''), system_prompt,
+			   sort_order, is_active, created_at, updated_at
+		FROM personas
+		WHERE id = $1
+	`
+
+	return r.scanPersona(r.db.QueryRowContext(ctx, query, personaID))
+}
+
+// scanPersona сканирует одну персону из результата запроса
+func (r *Repository) scanPersona(row *sql.Row) (*Persona, error) {
+	persona := &Persona{}
+	err := row.Scan(
+		&persona.ID,
+		&persona.Code,
+		&persona.Name,
+		&persona.Description,
+		&persona.SystemPrompt,
+		&persona.SortOrder,
+		&persona.IsActive,
+		&persona.CreatedAt,
+		&persona.UpdatedAt,
+	)
+
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, nil // Персона не найдена
+		}
+		return nil, fmt.Errorf("ошибка получения персоны: %w", err)
+	}
+
+	return persona, nil
+}
+
+// GetActiveConversation получает активный диалог пользователя
+func (r *Repository) GetActiveConversation(ctx context.Context, userID int64) (*Conversation, error) {
+	query := `
+		SELECT id, user_id, persona_id, COALESCE(custom_system_prompt, ''),
+			   COALESCE(summary, ''), summarized_until_id,
+			   is_active, created_at, updated_at
+		FROM conversations
+		WHERE user_id = $1 AND is_active = true
+	`
+
+	conv := &Conversation{}
+	var personaID sql.NullInt64
+	err := r.db.QueryRowContext(ctx, query, userID).Scan(
+		&conv.ID,
+		&conv.UserID,
+		&personaID,
+		&conv.CustomSystemPrompt,
+		&conv.Summary,
+		&conv.SummarizedUntilID,
+		&conv.IsActive,
+		&conv.CreatedAt,
+		&conv.UpdatedAt,
+	)
+
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, nil // Активного диалога нет
+		}
+		return nil, fmt.Errorf("ошибка получения активного диалога: %w", err)
+	}
+
+	if personaID.Valid {
+		id := int(personaID.Int64)
+		conv.PersonaID = &id
+	}
+
+	return conv, nil
+}
+
+// CreateConversation создает активный диалог пользователя, если его еще нет
+func (r *Repository) CreateConversation(ctx context.Context, userID int64) error {
+	query := `
+		INSERT INTO conversations (user_id, is_active, created_at, updated_at)
+		VALUES ($1, true, NOW(), NOW())
+		ON CONFLICT (user_id) WHERE is_active DO NOTHING
+	`
+
+	_, err := r.db.ExecContext(ctx, query, userID)
+	if err != nil {
+		return fmt.Errorf("ошибка создания диалога: %w", err)
+	}
+
+	return nil
+}
+
+// SetPersona устанавливает персону диалога и сбрасывает собственный промпт
+func (r *Repository) SetPersona(ctx context.Context, conversationID int64, personaID *int) error {
+	query := `
+		UPDATE conversations
+		SET persona_id = $1, custom_system_prompt = NULL, updated_at = NOW()
+		WHERE id = $2
+	`
+
+	_, err := r.db.ExecContext(ctx, query, personaID, conversationID)
+	if err != nil {
+		return fmt.Errorf("ошибка установки персоны: %w", err)
+	}
+
+	return nil
+}
+
+// SetCustomPrompt устанавливает собственный системный промпт диалога
+func (r *Repository) SetCustomPrompt(ctx context.Context, conversationID int64, prompt string) error {
+	query := `
+		UPDATE conversations
+		SET persona_id = NULL, custom_system_prompt = $1, updated_at = NOW()
+		WHERE id = $2
+	`
+
+	_, err := r.db.ExecContext(ctx, query, prompt, conversationID)
+	if err != nil {
+		return fmt.Errorf("ошибка установки собственного промпта: %w", err)
+	}
+
+	return nil
+}
+
+// AddMessage добавляет сообщение в историю диалога
+func (r *Repository) AddMessage(ctx context.Context, msg *Message) error {
+	query := `
+		INSERT INTO conversation_messages (conversation_id, role, content, model_name, created_at)
+		VALUES ($1, $2, $3, NULLIF($4, ''), NOW())
+		RETURNING id, created_at
+	`
+
+	err := r.db.QueryRowContext(ctx, query,
+		msg.ConversationID,
+		msg.Role,
+		msg.Content,
+		msg.ModelName,
+	).Scan(&msg.ID, &msg.CreatedAt)
+	if err != nil {
+		return fmt.Errorf("ошибка добавления сообщения в историю: %w", err)
+	}
+
+	return nil
+}
+
+// GetMessagesAfter возвращает все сообщения диалога после указанного ID в хронологическом порядке
+func (r *Repository) GetMessagesAfter(ctx context.Context, conversationID, afterID int64) ([]*Message, error) {
+	query := `
+		SELECT id, conversation_id, role, content, COALESCE(model_name, ''), created_at
+		FROM conversation_messages
+		WHERE conversation_id = $1 AND id > $2
+		ORDER BY id ASC
+	`
+
+	rows, err := r.db.QueryContext(ctx, query, conversationID, afterID)
+	if err != nil {
+		return nil, fmt.Errorf("ошибка получения истории диалога: %w", err)
+	}
+	defer rows.Close()
+
+	var messages []*Message
+	for rows.Next() {
+		msg := &Message{}
+		err := rows.Scan(
+			&msg.ID,
+			&msg.ConversationID,
+			&msg.Role,
+			&msg.Content,
+			&msg.ModelName,
+			&msg.CreatedAt,
+		)
+		if err != nil {
+			return nil, fmt.Errorf("ошибка сканирования сообщения: %w", err)
+		}
+		messages = append(messages, msg)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("ошибка при итерации сообщений: %w", err)
+	}
+
+	return messages, nil
+}
+
+// UpdateSummary сохраняет краткое содержание диалога
+func (r *Repository) UpdateSummary(ctx context.Context, conversationID int64, summary string, summarizedUntilID int64) error {
+	query := `
+		UPDATE conversations
+		SET summary = $1, summarized_until_id = $2, summary_updated_at = NOW(), updated_at = NOW()
+		WHERE id = $3 AND summarized_until_id < $2
+	`
+
+	_, err := r.db.ExecContext(ctx, query, summary, summarizedUntilID, conversationID)
+	if err != nil {
+		return fmt.Errorf("ошибка сохранения краткого содержания диалога: %w", err)
+	}
+
+	return nil
+}
@@ -0,0 +1,319 @@
+// Сервис диалогов и персон
+
+package conversation
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+
+	"go.uber.org/zap"
+
+	"neurobot-prod/internal/subscription"
+)
+
+const (
+	// personaNameMaxLength - максимальная длина названия персоны
+	personaNameMaxLength = 100
+)
+
+// personaCodePattern - допустимый код персоны. Код передается в данных кнопки выбора,
+// поэтому ограничен по длине и не содержит разделителя ":"
+var personaCodePattern = regexp.MustCompile(`^[a-z0-9_]{1,50}$`)
+
+var (
+	// ErrPersonaNotFound возвращается, если персона не найдена
+	ErrPersonaNotFound = errors.New("персона не найдена")
+	// ErrPersonaExists возвращается при создании персоны с занятым кодом
+	ErrPersonaExists = errors.New("персона с таким кодом уже есть")
+	// ErrInvalidPersonaCode возвращается при недопустимом коде персоны
+	ErrInvalidPersonaCode = errors.New("код персоны должен состоять из строчных латинских букв, цифр и _ (до 50 символов)")
+	// ErrInvalidPersona возвращается, если у персоны не заполнено название или системный промпт
+	ErrInvalidPersona = errors.New("не указано название или системный промпт персоны")
+)
+
+// Service предоставляет методы для работы с диалогами и персонами
+type Service struct {
+	repo       *Repository
+	subService *subscription.Service
+	log        *zap.Logger
+}
+
+// NewService создает новый сервис диалогов
+func NewService(repo *Repository, subService *subscription.Service, log *zap.Logger) *Service {
+	return &Service{
+		repo:       repo,
+		subService: subService,
+		log:        log.Named("conversation_service"),
+	}
+}
+
+// GetPersonas возвращает список персон, доступных для выбора
+func (s *Service) GetPersonas(ctx context.Context) ([]*Persona, error) {
+	personas, err := s.repo.GetActivePersonas(ctx)
+	if err != nil {
+		s.log.Error("Ошибка получения персон", zap.Error(err))
+		return nil, fmt.Errorf("ошибка получения персон: %w", err)
+	}
+	return personas, nil
+}
+
+// GetAllPersonas возвращает все персоны, включая отключенные, для консоли администратора
+func (s *Service) GetAllPersonas(ctx context.Context) ([]*Persona, error) {
+	return s.repo.GetAllPersonas(ctx)
+}
+
+// validatePersona нормализует поля персоны и проверяет их
+func validatePersona(persona *Persona) error {
+	persona.Code = strings.TrimSpace(persona.Code)
+	persona.Name = strings.TrimSpace(persona.Name)
+	persona.Description = strings.TrimSpace(persona.Description)
+	persona.SystemPrompt = strings.TrimSpace(persona.SystemPrompt)
+
+	if !personaCodePattern.MatchString(persona.Code) {
+		return ErrInvalidPersonaCode
+	}
+	if persona.Name == "" || persona.SystemPrompt == "" || len([]rune(persona.Name)) > personaNameMaxLength {
+		return ErrInvalidPersona
+	}
+	return nil
+}
+
+// CreatePersona создает персону, доступную для выбора через /persona
+func (s *Service) CreatePersona(ctx context.Context, persona *Persona) error {
+	if err := validatePersona(persona); err != nil {
+		return err
+	}
+
+	created, err := s.repo.CreatePersona(ctx, persona)
+	if err != nil {
+		return err
+	}
+	if !created {
+		return ErrPersonaExists
+	}
+
+	s.log.Info("Создана персона", zap.String("persona", persona.Code))
+	return nil
+}
+
+// UpdatePersona обновляет персону по коду. Код персоны не меняется, так как он
+// используется в кнопках выбора, уже отправленных пользователям
+func (s *Service) UpdatePersona(ctx context.Context, persona *Persona) error {
+	if err := validatePersona(persona); err != nil {
+		return err
+	}
+
+	updated, err := s.repo.UpdatePersona(ctx, persona)
+	if err != nil {
+		return err
+	}
+	if !updated {
+		return ErrPersonaNotFound
+	}
+
+	s.log.Info("Обновлена персона",
+		zap.String("persona", persona.Code),
+		zap.Bool("active", persona.IsActive))
+	return nil
+}
+
+// DeletePersona удаляет персону. Диалоги, в которых она выбрана, продолжаются без персоны
+func (s *Service) DeletePersona(ctx context.Context, code string) error {
+	deleted, err := s.repo.DeletePersona(ctx, code)
+	if err != nil {
+		return err
+	}
+	if !deleted {
+		return ErrPersonaNotFound
+	}
+
+	s.log.Info("Удалена персона", zap.String("persona", code))
+	return nil
+}
+
+// GetActiveConversation возвращает активный диалог пользователя вместе с персоной.
+// Если диалога еще нет, он создается
+func (s *Service) GetActiveConversation(ctx context.Context, userID int64) (*Conversation, error) {
+	conv, err := s.repo.GetActiveConversation(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	if conv == nil {
+		if err := s.repo.CreateConversation(ctx, userID); err != nil {
+			s.log.Error("Ошибка создания диалога",
+				zap.Int64("user_id", userID),
+				zap.Error(err))
+			return nil, err
+		}
+
+		conv, err = s.repo.GetActiveConversation(ctx, userID)
+		if err != nil {
+			return nil, err
+		}
+		if conv == nil {
+			return nil, errors.New("не удалось создать диалог")
+		}
+	}
+
+	if conv.PersonaID != nil {
+		persona, err := s.repo.GetPersonaByID(ctx, *conv.PersonaID)
+		if err != nil {
+			return nil, err
+		}
+		// Отключенная администратором персона больше не применяется
+		if persona != nil && persona.IsActive {
+			conv.Persona = persona
+		}
+	}
+
+	return conv, nil
+}
+
+// SelectPersona устанавливает персону для активного диалога пользователя
+func (s *Service) SelectPersona(ctx context.Context, userID int64, code string) (*Persona, error) {
+	persona, err := s.repo.GetPersonaByCode(ctx, code)
+	if err != nil {
+		return nil, err
+	}
+	if persona == nil {
+		return nil, ErrPersonaNotFound
+	}
+
+	conv, err := s.GetActiveConversation(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := s.repo.SetPersona(ctx, conv.ID, &persona.ID); err != nil {
+		s.log.Error("Ошибка установки персоны",
+			zap.Int64("user_id", userID),
+			zap.String("persona", code),
+			zap.Error(err))
+		return nil, err
+	}
+
+	s.log.Info("Пользователь выбрал персону",
+		zap.Int64("user_id", userID),
+		zap.String("persona", code))
+
+	return persona, nil
+}
+
+// ResetPersona сбрасывает персону и собственный промпт активного диалога
+func (s *Service) ResetPersona(ctx context.Context, userID int64) error {
+	conv, err := s.GetActiveConversation(ctx, userID)
+	if err != nil {
+		return err
+	}
+
+	if err := s.repo.SetPersona(ctx, conv.ID, nil); err != nil {
+		s.log.Error("Ошибка сброса персоны",
+			zap.Int64("user_id", userID),
+			zap.Error(err))
+		return err
+	}
+
+	return nil
+}
+
+// GetCustomPromptMaxLength возвращает максимальную длину собственного промпта для плана пользователя
+func (s *Service) GetCustomPromptMaxLength(ctx context.Context, userID int64) (int, error) {
+	plan, err := s.subService.GetSubscriptionPlan(ctx, userID)
+	if err != nil {
+		return 0, err
+	}
+	return plan.GetCustomPromptMaxLength(), nil
+}
+
+// SetCustomPrompt устанавливает собственный системный промпт с учетом ограничений плана
+func (s *Service) SetCustomPrompt(ctx context.Context, userID int64, prompt string) error {
+	prompt = strings.TrimSpace(prompt)
+	if prompt == "" {
+		return errors.New("промпт не может быть пустым")
+	}
+
+	maxLength, err := s.GetCustomPromptMaxLength(ctx, userID)
+	if err != nil {
+		return err
+	}
+
+	if maxLength <= 0 {
+		return errors.New("собственные промпты недоступны для вашего плана подписки")
+	}
+
+	if length := len([]rune(prompt)); length > maxLength {
+		return fmt.Errorf("промпт слишком длинный: %d символов при максимуме %d для вашего плана подписки", length, maxLength)
+	}
+
+	conv, err := s.GetActiveConversation(ctx, userID)
+	if err != nil {
+		return err
+	}
+
+	if err := s.repo.SetCustomPrompt(ctx, conv.ID, prompt); err != nil {
+		s.log.Error("Ошибка установки собственного промпта",
+			zap.Int64("user_id", userID),
+			zap.Error(err))
+		return err
+	}
+
+	s.log.Info("Пользователь установил собственный промпт",
+		zap.Int64("user_id", userID),
+		zap.Int("length", len([]rune(prompt))))
+
+	return nil
+}
+
+// GetHistory возвращает все сообщения диалога, не вошедшие в краткое содержание.
+// Сообщения сверх окна контекста плана сворачиваются в краткое содержание при запросе к нейросети,
+// поэтому их количество не растет неограниченно
+func (s *Service) GetHistory(ctx context.Context, conv *Conversation) ([]*Message, error) {
+	messages, err := s.repo.GetMessagesAfter(ctx, conv.ID, conv.SummarizedUntilID)
+	if err != nil {
+		s.log.Error("Ошибка получения истории диалога",
+			zap.Int64("conversation_id", conv.ID),
+			zap.Error(err))
+		return nil, err
+	}
+
+	return messages, nil
+}
+
+// SaveExchange сохраняет запрос пользователя и ответ нейросети в историю диалога
+func (s *Service) SaveExchange(ctx context.Context, conversationID int64, userText, assistantText, modelName string) error {
+	messages := []*Message{
+		{ConversationID: conversationID, Role: "user", Content: userText},
+		{ConversationID: conversationID, Role: "assistant", Content: assistantText, ModelName: modelName},
+	}
+
+	for _, msg := range messages {
+		if err := s.repo.AddMessage(ctx, msg); err != nil {
+			s.log.Error("Ошибка сохранения сообщения",
+				zap.Int64("conversation_id", conversationID),
+				zap.Error(err))
+			return err
+		}
+	}
+
+	return nil
+}
+
+// UpdateSummary сохраняет краткое содержание диалога для повторного использования
+func (s *Service) UpdateSummary(ctx context.Context, conversationID int64, summary string, summarizedUntilID int64) error {
+	if err := s.repo.UpdateSummary(ctx, conversationID, summary, summarizedUntilID); err != nil {
+		s.log.Error("Ошибка сохранения краткого содержания",
+			zap.Int64("conversation_id", conversationID),
+			zap.Error(err))
+		return err
+	}
+
+	s.log.Info("Обновлено краткое содержание диалога",
+		zap.Int64("conversation_id", conversationID),
+		zap.Int64("summarized_until_id", summarizedUntilID))
+
+	return nil
+}
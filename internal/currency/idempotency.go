@@ -0,0 +1,100 @@
+// Идемпотентность операций с нейронами
+
+package currency
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+
+	"github.com/lib/pq"
+	"go.uber.org/zap"
+)
+
+// ErrIdempotencyKeyReused возвращается, если ключ идемпотентности уже использован другим пользователем
+var ErrIdempotencyKeyReused = errors.New("ключ идемпотентности уже использован для другой операции")
+
+// DailyKey возвращает ключ идемпотентности ежедневного начисления за дату в формате 2006-01-02
+func DailyKey(userID int64, date string) string {
+	return "daily:" + strconv.FormatInt(userID, 10) + ":" + date
+}
+
+// PaymentKey возвращает ключ идемпотентности начисления по платежу
+func PaymentKey(paymentID int64) string {
+	return "payment:" + strconv.FormatInt(paymentID, 10)
+}
+
+// StreakFreezeKey возвращает ключ идемпотентности оплаты заморозки серии по номеру покупки
+func StreakFreezeKey(userID int64, purchase int) string {
+	return "streak_freeze:" + strconv.FormatInt(userID, 10) + ":" + strconv.Itoa(purchase)
+}
+
+// addTransaction проводит транзакцию. Если транзакция того же типа с тем же ключом
+// идемпотентности уже проведена, возвращает ее без изменения баланса и replayed = true
+func (s *Service) addTransaction(ctx context.Context, tx *Transaction) (*Transaction, bool, error) {
+	return s.addTransactionWith(ctx, tx, s.repo.AddTransaction)
+}
+
+// addTransactionWith проводит транзакцию функцией add с той же обработкой повторов, что и addTransaction
+func (s *Service) addTransactionWith(ctx context.Context, tx *Transaction, add func(context.Context, *Transaction) error) (*Transaction, bool, error) {
+	if tx.IdempotencyKey != "" {
+		existing, err := s.repo.GetTransactionByIdempotencyKey(ctx, tx.TransactionType, tx.IdempotencyKey)
+		if err != nil {
+			return nil, false, err
+		}
+		if existing != nil {
+			return s.replay(tx, existing)
+		}
+	}
+
+	err := add(ctx, tx)
+	if isConcurrentDuplicate(err, tx.IdempotencyKey) {
+		// Операция с тем же ключом проведена параллельным запросом
+		existing, findErr := s.repo.GetTransactionByIdempotencyKey(ctx, tx.TransactionType, tx.IdempotencyKey)
+		if findErr != nil {
+			return nil, false, findErr
+		}
+		if existing == nil {
+			return nil, false, fmt.Errorf("транзакция с ключом %s не найдена: %w", tx.IdempotencyKey, err)
+		}
+		return s.replay(tx, existing)
+	}
+	if err != nil {
+		return nil, false, err
+	}
+
+	return tx, false, nil
+}
+
+// isConcurrentDuplicate проверяет, может ли ошибка означать, что операция с тем же ключом
+// проведена параллельным запросом. При REPEATABLE READ вставка, конфликтующая со строкой
+// параллельной транзакции, и блокировка измененного ею баланса завершаются ошибкой
+// сериализации, а не пропуском вставки через ON CONFLICT DO NOTHING
+func isConcurrentDuplicate(err error, key string) bool {
+	if errors.Is(err, ErrDuplicateTransaction) {
+		return true
+	}
+	var pqErr *pq.Error
+	return key != "" && errors.As(err, &pqErr) && pqErr.Code == "40001"
+}
+
+// replay возвращает ранее проведенную транзакцию вместо повторной
+func (s *Service) replay(tx, existing *Transaction) (*Transaction, bool, error) {
+	if existing.UserID != tx.UserID {
+		s.log.Error("Ключ идемпотентности использован для другой операции",
+			zap.String("key", tx.IdempotencyKey),
+			zap.String("type", string(tx.TransactionType)),
+			zap.Int64("user_id", tx.UserID),
+			zap.Int64("existing_transaction_id", existing.ID))
+		return nil, false, ErrIdempotencyKeyReused
+	}
+
+	s.log.Info("Повтор операции с нейронами, возвращена исходная транзакция",
+		zap.String("key", tx.IdempotencyKey),
+		zap.String("type", string(tx.TransactionType)),
+		zap.Int64("user_id", tx.UserID),
+		zap.Int64("transaction_id", existing.ID))
+
+	return existing, true, nil
+}
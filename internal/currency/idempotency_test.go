@@ -0,0 +1,134 @@
+// Тесты идемпотентности операций с нейронами
+
+package currency
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+)
+
+func TestIdempotentReplaySameUser(t *testing.T) {
+	service, _ := newTestService(t, 3101)
+	ctx := context.Background()
+
+	first, err := service.AddNeurons(ctx, 3101, 50, TypeBonus, "Бонус", nil, "", "bonus:3101:1", 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	second, err := service.AddNeurons(ctx, 3101, 50, TypeBonus, "Бонус", nil, "", "bonus:3101:1", 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if second.ID != first.ID {
+		t.Errorf("повтор создал транзакцию %d, ожидалась исходная %d", second.ID, first.ID)
+	}
+
+	// Тот же ключ с другим типом транзакции - другая операция
+	if _, err := service.SpendNeurons(ctx, 3101, 10, TypeUsage, "Запрос", nil, "", "bonus:3101:1"); err != nil {
+		t.Fatal(err)
+	}
+
+	assertLifetime(t, service, 3101, 40, 50, 10)
+}
+
+func TestIdempotencyKeyReusedByAnotherUser(t *testing.T) {
+	service, _ := newTestService(t, 3102, 3103)
+	ctx := context.Background()
+
+	if _, err := service.AddNeurons(ctx, 3102, 50, TypeBonus, "Бонус", nil, "", "shared-key", 0); err != nil {
+		t.Fatal(err)
+	}
+
+	_, err := service.AddNeurons(ctx, 3103, 50, TypeBonus, "Бонус", nil, "", "shared-key", 0)
+	if !errors.Is(err, ErrIdempotencyKeyReused) {
+		t.Fatalf("ошибка %v, ожидалась %v", err, ErrIdempotencyKeyReused)
+	}
+
+	// Чужая транзакция не возвращается и не начисляется второму пользователю
+	assertLifetime(t, service, 3102, 50, 50, 0)
+	b, err := service.repo.GetBalance(ctx, 3103)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if b.Balance != 0 {
+		t.Errorf("баланс второго пользователя %d, ожидался 0", b.Balance)
+	}
+}
+
+func TestDuplicateInsertSkippedOnConflict(t *testing.T) {
+	service, _ := newTestService(t, 3104)
+	ctx := context.Background()
+
+	if _, err := service.AddNeurons(ctx, 3104, 100, TypeBonus, "Бонус", nil, "", "", 0); err != nil {
+		t.Fatal(err)
+	}
+
+	// Вставка в обход предварительной проверки ключа, как у проигравшего гонку запроса
+	spend := func() *Transaction {
+		return &Transaction{UserID: 3104, Amount: -30, TransactionType: TypeUsage, IdempotencyKey: "usage:3104:1"}
+	}
+	if err := service.repo.AddTransaction(ctx, spend()); err != nil {
+		t.Fatal(err)
+	}
+	if err := service.repo.AddTransaction(ctx, spend()); !errors.Is(err, ErrDuplicateTransaction) {
+		t.Fatalf("ошибка %v, ожидалась %v", err, ErrDuplicateTransaction)
+	}
+
+	// Баланс изменен только первой вставкой
+	assertLifetime(t, service, 3104, 70, 100, 30)
+}
+
+func TestConcurrentSpendWithSameKey(t *testing.T) {
+	service, db := newTestService(t, 3105)
+	ctx := context.Background()
+
+	if _, err := service.AddNeurons(ctx, 3105, 100, TypeBonus, "Бонус", nil, "", "", 0); err != nil {
+		t.Fatal(err)
+	}
+
+	const workers = 8
+	var (
+		wg    sync.WaitGroup
+		start = make(chan struct{})
+		ids   = make([]int64, workers)
+		errs  = make([]error, workers)
+	)
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			<-start
+			tx, err := service.SpendNeurons(ctx, 3105, 30, TypeUsage, "Запрос", nil, "", "usage:3105:1")
+			if err == nil {
+				ids[i] = tx.ID
+			}
+			errs[i] = err
+		}(i)
+	}
+	close(start)
+	wg.Wait()
+
+	// Все параллельные повторы получают одну и ту же транзакцию
+	for i := range errs {
+		if errs[i] != nil {
+			t.Fatalf("запрос %d: %v", i, errs[i])
+		}
+		if ids[i] != ids[0] {
+			t.Errorf("запрос %d получил транзакцию %d, ожидалась %d", i, ids[i], ids[0])
+		}
+	}
+
+	var count int
+	err := db.QueryRowContext(ctx, `
+		SELECT COUNT(*) FROM neuron_transactions WHERE transaction_type = $1 AND idempotency_key = $2
+	`, TypeUsage, "usage:3105:1").Scan(&count)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if count != 1 {
+		t.Errorf("транзакций с ключом %d, ожидалась 1", count)
+	}
+	assertLifetime(t, service, 3105, 70, 100, 30)
+}
@@ -13,15 +13,31 @@ import (
 type TransactionType string
 
 const (
-	TypeDaily        TransactionType = "daily"        // Ежедневное начисление
-	TypePurchase     TransactionType = "purchase"     // Покупка Нейронов
-	TypeUsage        TransactionType = "usage"        // Использование нейросети
-	TypeReferral     TransactionType = "referral"     // Реферальная программа
-	TypeBonus        TransactionType = "bonus"        // Бонусное начисление
-	TypeSubscription TransactionType = "subscription" // Начисление за подписку
-	TypeAdmin        TransactionType = "admin"        // Начисление администратором
-	TypePromocode    TransactionType = "promocode"    // Начисление по промокоду
-	TypeAchievement  TransactionType = "achievement"  // Начисление за достижение
+	TypeDaily        TransactionType = "daily"         // Ежедневное начисление
+	TypePurchase     TransactionType = "purchase"      // Покупка Нейронов
+	TypeUsage        TransactionType = "usage"         // Использование нейросети
+	TypeReferral     TransactionType = "referral"      // Реферальная программа
+	TypeBonus        TransactionType = "bonus"         // Бонусное начисление
+	TypeSubscription TransactionType = "subscription"  // Начисление за подписку
+	TypeAdmin        TransactionType = "admin"         // Начисление администратором
+	TypePromocode    TransactionType = "promocode"     // Начисление по промокоду
+	TypeAchievement  TransactionType = "achievement"   // Начисление за достижение
+	TypeStreakFreeze TransactionType = "streak_freeze" // Покупка заморозки серии
+	TypeExpiry       TransactionType = "expiry"        // Списание нейронов с истекшим сроком
+	TypeRefund       TransactionType = "refund"        // Возврат транзакции
+	TypeTransfer     TransactionType = "transfer"      // Перевод между пользователями (списание или начисление)
+	TypeDeposit      TransactionType = "deposit"       // Пополнение общего кошелька (списание или начисление)
+)
+
+// AccountCode представляет системный счет главной книги
+type AccountCode string
+
+const (
+	AccountIssuance AccountCode = "issuance" // Выпуск нейронов (ежедневные, покупки, бонусы)
+	AccountRevenue  AccountCode = "revenue"  // Нейроны, потраченные пользователями
+	AccountExpiry   AccountCode = "expiry"   // Сгоревшие нейроны
+	AccountPromo    AccountCode = "promo"    // Нейроны, выданные по промокодам
+	AccountTransfer AccountCode = "transfer" // Транзитный счет переводов между пользователями
 )
 
 // Metadata представляет дополнительные данные для транзакций
@@ -59,6 +75,7 @@ func (m *Metadata) Scan(value interface{}) error {
 type Balance struct {
 	ID                int64      `db:"id"`
 	UserID            int64      `db:"user_id"`
+	WalletID          *int64     `db:"wallet_id"`            // Общий кошелек, nil для личного баланса
 	Balance           int        `db:"balance"`              // Текущий баланс
 	LifetimeEarned    int        `db:"lifetime_earned"`      // Всего заработано
 	LifetimeSpent     int        `db:"lifetime_spent"`       // Всего потрачено
@@ -67,31 +84,93 @@ type Balance struct {
 	UpdatedAt         time.Time  `db:"updated_at"`
 }
 
-// CanReceiveDailyReward проверяет, может ли пользователь получить ежедневное вознаграждение
-func (b *Balance) CanReceiveDailyReward() bool {
-	if b.LastDailyRewardAt == nil {
-		return true
-	}
+// DailyBonus описывает надбавки к ежедневному начислению нейронов
+type DailyBonus struct {
+	LoyaltyPercent int // Бонус уровня лояльности
+	StreakPercent  int // Бонус за серию ежедневных начислений
+	Streak         int // Длина серии с учетом текущего начисления
+}
 
-	// Проверяем, прошло ли более 20 часов с момента последнего вознаграждения
-	// (делаем запас в 4 часа, чтобы пользователь мог получать вознаграждение каждый день в одно и то же время)
-	return time.Since(*b.LastDailyRewardAt) > 20*time.Hour
+// TotalPercent возвращает суммарный бонус к ежедневному начислению
+func (b DailyBonus) TotalPercent() int {
+	return b.LoyaltyPercent + b.StreakPercent
 }
 
 // Transaction представляет транзакцию с нейронами
 type Transaction struct {
 	ID              int64           `db:"id"`
 	UserID          int64           `db:"user_id"`
+	WalletID        *int64          `db:"wallet_id"`        // Общий кошелек, с которым проведена транзакция; nil - личный баланс
 	Amount          int             `db:"amount"`           // Может быть положительным или отрицательным
 	BalanceAfter    int             `db:"balance_after"`    // Баланс после транзакции
 	TransactionType TransactionType `db:"transaction_type"` // Тип транзакции
 	Description     string          `db:"description"`      // Описание транзакции
 	ExpiresAt       *time.Time      `db:"expires_at"`       // Время истечения срока действия нейронов
 	ReferenceID     string          `db:"reference_id"`     // Связанный ID (например, ID платежа)
+	IdempotencyKey  string          `db:"idempotency_key"`  // Ключ идемпотентности, уникален в пределах типа транзакции
 	Metadata        Metadata        `db:"metadata"`         // Дополнительные данные
 	CreatedAt       time.Time       `db:"created_at"`
 }
 
+// CounterAccount возвращает системный счет для встречной проводки по транзакции
+func (t *Transaction) CounterAccount() AccountCode {
+	// Возврат проводится по тому же системному счету, что и исходная транзакция
+	if t.TransactionType == TypeRefund {
+		if originalType, ok := t.Metadata["original_type"].(string); ok {
+			original := Transaction{Amount: -t.Amount, TransactionType: TransactionType(originalType)}
+			return original.CounterAccount()
+		}
+	}
+
+	// Обе части перевода и пополнения кошелька проводятся через транзитный счет
+	if t.TransactionType == TypeTransfer || t.TransactionType == TypeDeposit {
+		return AccountTransfer
+	}
+
+	if t.Amount > 0 {
+		if t.TransactionType == TypePromocode {
+			return AccountPromo
+		}
+		return AccountIssuance
+	}
+
+	switch t.TransactionType {
+	case TypeExpiry:
+		return AccountExpiry
+	case TypeAdmin:
+		// Списание администратором отменяет выпуск
+		return AccountIssuance
+	default:
+		return AccountRevenue
+	}
+}
+
+// LifetimeDelta возвращает изменение lifetime_earned и lifetime_spent от транзакции.
+// Возврат отменяет исходную транзакцию: возврат списания уменьшает потраченное,
+// а возврат начисления уменьшает заработанное
+func (t *Transaction) LifetimeDelta() (earned, spent int) {
+	if t.TransactionType == TypeRefund {
+		if t.Amount > 0 {
+			return 0, -t.Amount
+		}
+		return t.Amount, 0
+	}
+
+	if t.Amount > 0 {
+		return t.Amount, 0
+	}
+	return 0, -t.Amount
+}
+
+// IsRefundable проверяет, можно ли вернуть транзакцию
+func (t *Transaction) IsRefundable() bool {
+	switch t.TransactionType {
+	case TypeUsage, TypeStreakFreeze, TypePurchase:
+		return true
+	}
+	return false
+}
+
 // Package представляет пакет нейронов для покупки
 type Package struct {
 	ID          int       `db:"id"`
@@ -127,6 +206,7 @@ func (p *Package) GetValueRatio() float64 {
 type LLMUsage struct {
 	ID               int64     `db:"id"`
 	UserID           int64     `db:"user_id"`
+	WalletID         *int64    `db:"wallet_id"`         // Кошелек, оплативший запрос
 	ModelName        string    `db:"model_name"`        // Название модели
 	PromptTokens     int       `db:"prompt_tokens"`     // Количество токенов запроса
 	CompletionTokens int       `db:"completion_tokens"` // Количество токенов ответа
@@ -0,0 +1,43 @@
+// Управление пакетами нейронов администратором
+
+package currency
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"go.uber.org/zap"
+)
+
+// ErrPackageNotFound возвращается, если пакет нейронов не существует
+var ErrPackageNotFound = errors.New("пакет не найден")
+
+// ListPackages возвращает все пакеты нейронов, включая отключенные
+func (s *Service) ListPackages(ctx context.Context) ([]*Package, error) {
+	packages, err := s.repo.ListPackages(ctx)
+	if err != nil {
+		s.log.Error("Ошибка получения списка пакетов", zap.Error(err))
+		return nil, fmt.Errorf("ошибка получения списка пакетов: %w", err)
+	}
+	return packages, nil
+}
+
+// SetPackageActive включает или отключает пакет нейронов. Отключенный пакет не предлагается к покупке
+func (s *Service) SetPackageActive(ctx context.Context, packageID int, active bool) error {
+	found, err := s.repo.SetPackageActive(ctx, packageID, active)
+	if err != nil {
+		s.log.Error("Ошибка изменения доступности пакета",
+			zap.Int("package_id", packageID),
+			zap.Error(err))
+		return fmt.Errorf("ошибка изменения доступности пакета: %w", err)
+	}
+	if !found {
+		return ErrPackageNotFound
+	}
+
+	s.log.Info("Изменена доступность пакета",
+		zap.Int("package_id", packageID),
+		zap.Bool("active", active))
+	return nil
+}
@@ -0,0 +1,141 @@
+// Сверка балансов с главной книгой
+
+package currency
+
+import (
+	"context"
+	"fmt"
+
+	"go.uber.org/zap"
+)
+
+// Объекты, для которых ищутся расхождения
+const (
+	SubjectUser        = "user"        // Баланс пользователя
+	SubjectAccount     = "account"     // Системный счет
+	SubjectTransaction = "transaction" // Проводки транзакции
+	SubjectWallet      = "wallet"      // Баланс общего кошелька
+)
+
+// Discrepancy представляет расхождение между сохраненным значением и главной книгой
+type Discrepancy struct {
+	Subject   string
+	SubjectID int64
+	Field     string
+	Expected  int64 // Значение по главной книге
+	Actual    int64 // Сохраненное значение
+	Repaired  bool
+}
+
+// ReconcileReport содержит итоги сверки
+type ReconcileReport struct {
+	ID            int64
+	Repair        bool
+	UsersChecked  int
+	Discrepancies []*Discrepancy
+	Repaired      int
+}
+
+// Reconcile пересчитывает балансы по проводкам и сообщает о расхождениях. При repair
+// сохраненные балансы исправляются по главной книге, а транзакциям без проводок
+// добавляются проводки. Каждый запуск и найденные расхождения сохраняются для аудита
+func (s *Service) Reconcile(ctx context.Context, repair bool) (*ReconcileReport, error) {
+	id, err := s.repo.StartReconciliation(ctx, repair)
+	if err != nil {
+		return nil, err
+	}
+	report := &ReconcileReport{ID: id, Repair: repair}
+
+	report.UsersChecked, err = s.repo.CountBalances(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	// Сначала проводки: исправленные проводки влияют на ожидаемые балансы
+	unbalanced, err := s.repo.FindUnbalancedTransactions(ctx)
+	if err != nil {
+		return nil, err
+	}
+	for _, d := range unbalanced {
+		// Транзакцию с несбалансированными проводками автоматически не исправляем
+		if repair && d.Field == "entries" {
+			if err := s.repo.PostMissingEntries(ctx, d.SubjectID); err != nil {
+				return nil, fmt.Errorf("ошибка создания проводок для транзакции %d: %w", d.SubjectID, err)
+			}
+			d.Repaired = true
+		}
+	}
+
+	balances, err := s.repo.FindBalanceDiscrepancies(ctx)
+	if err != nil {
+		return nil, err
+	}
+	repairedUsers := make(map[int64]bool)
+	for _, d := range balances {
+		if repair {
+			if !repairedUsers[d.SubjectID] {
+				if err := s.repo.RepairBalance(ctx, d.SubjectID); err != nil {
+					return nil, fmt.Errorf("ошибка исправления баланса пользователя %d: %w", d.SubjectID, err)
+				}
+				repairedUsers[d.SubjectID] = true
+			}
+			d.Repaired = true
+		}
+	}
+
+	accounts, err := s.repo.FindAccountDiscrepancies(ctx)
+	if err != nil {
+		return nil, err
+	}
+	for _, d := range accounts {
+		if repair {
+			if err := s.repo.RepairAccount(ctx, d.SubjectID); err != nil {
+				return nil, fmt.Errorf("ошибка исправления системного счета %d: %w", d.SubjectID, err)
+			}
+			d.Repaired = true
+		}
+	}
+
+	wallets, err := s.repo.FindWalletDiscrepancies(ctx)
+	if err != nil {
+		return nil, err
+	}
+	for _, d := range wallets {
+		if repair {
+			if err := s.repo.RepairWallet(ctx, d.SubjectID); err != nil {
+				return nil, fmt.Errorf("ошибка исправления баланса кошелька %d: %w", d.SubjectID, err)
+			}
+			d.Repaired = true
+		}
+	}
+
+	report.Discrepancies = append(append(append(unbalanced, balances...), accounts...), wallets...)
+	for _, d := range report.Discrepancies {
+		if d.Repaired {
+			report.Repaired++
+		}
+		if err := s.repo.AddDiscrepancy(ctx, report.ID, d); err != nil {
+			return nil, err
+		}
+
+		s.log.Warn("Расхождение с главной книгой",
+			zap.String("subject", d.Subject),
+			zap.Int64("subject_id", d.SubjectID),
+			zap.String("field", d.Field),
+			zap.Int64("expected", d.Expected),
+			zap.Int64("actual", d.Actual),
+			zap.Bool("repaired", d.Repaired))
+	}
+
+	if err := s.repo.FinishReconciliation(ctx, report); err != nil {
+		return nil, err
+	}
+
+	s.log.Info("Сверка с главной книгой завершена",
+		zap.Int64("reconciliation_id", report.ID),
+		zap.Int("users_checked", report.UsersChecked),
+		zap.Int("discrepancies", len(report.Discrepancies)),
+		zap.Int("repaired", report.Repaired))
+
+	return report, nil
+}
@@ -0,0 +1,131 @@
+// Тесты сверки балансов с главной книгой
+
+package currency
+
+import (
+	"context"
+	"database/sql"
+	"testing"
+
+	"go.uber.org/zap"
+
+	"neurobot-prod/internal/storage/postgres/pgtest"
+	"neurobot-prod/internal/subscription"
+)
+
+// newTestService создает сервис валюты с базой из pgtest и заданными пользователями
+func newTestService(t *testing.T, userIDs ...int64) (*Service, *sql.DB) {
+	db := pgtest.Open(t)
+	for _, userID := range userIDs {
+		pgtest.CreateUser(t, db, userID)
+	}
+
+	log := zap.NewNop()
+	subService := subscription.NewService(subscription.NewRepository(db), log)
+	return NewService(NewRepository(db), subService, log), db
+}
+
+// assertLifetime проверяет баланс и lifetime метрики пользователя
+func assertLifetime(t *testing.T, service *Service, userID int64, balance, earned, spent int) {
+	t.Helper()
+
+	b, err := service.repo.GetBalance(context.Background(), userID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if b.Balance != balance || b.LifetimeEarned != earned || b.LifetimeSpent != spent {
+		t.Errorf("баланс %d, заработано %d, потрачено %d; ожидалось %d, %d, %d",
+			b.Balance, b.LifetimeEarned, b.LifetimeSpent, balance, earned, spent)
+	}
+}
+
+func TestRefundLowersLifetimeSpent(t *testing.T) {
+	service, _ := newTestService(t, 3001)
+	ctx := context.Background()
+
+	if _, err := service.AddNeurons(ctx, 3001, 100, TypeBonus, "Бонус", nil, "", "", 0); err != nil {
+		t.Fatal(err)
+	}
+	usage, err := service.SpendNeurons(ctx, 3001, 30, TypeUsage, "Запрос", nil, "", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := service.Refund(ctx, usage.ID, RefundRequestFailed, ""); err != nil {
+		t.Fatal(err)
+	}
+
+	// Возврат отменяет списание, а не считается заработком
+	assertLifetime(t, service, 3001, 100, 100, 0)
+
+	report, err := service.Reconcile(ctx, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(report.Discrepancies) != 0 {
+		t.Errorf("расхождений %d после возврата, ожидалось 0: %+v", len(report.Discrepancies), report.Discrepancies[0])
+	}
+}
+
+func TestReconcileRepairsBalance(t *testing.T) {
+	service, db := newTestService(t, 3002)
+	ctx := context.Background()
+
+	if _, err := service.AddNeurons(ctx, 3002, 100, TypeBonus, "Бонус", nil, "", "", 0); err != nil {
+		t.Fatal(err)
+	}
+	usage, err := service.SpendNeurons(ctx, 3002, 40, TypeUsage, "Запрос", nil, "", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := service.RefundPart(ctx, usage.ID, 10, "model", RefundRequestFailed); err != nil {
+		t.Fatal(err)
+	}
+	assertLifetime(t, service, 3002, 70, 100, 30)
+
+	// Сохраненный баланс расходится с проводками
+	_, err = db.ExecContext(ctx, `
+		UPDATE user_neuron_balance SET balance = 500, lifetime_spent = 7 WHERE user_id = $1
+	`, 3002)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	report, err := service.Reconcile(ctx, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := map[string][2]int64{
+		"balance":        {70, 500},
+		"lifetime_spent": {30, 7},
+	}
+	if len(report.Discrepancies) != len(want) || report.Repaired != 0 {
+		t.Fatalf("расхождений %d, исправлено %d; ожидалось %d и 0",
+			len(report.Discrepancies), report.Repaired, len(want))
+	}
+	for _, d := range report.Discrepancies {
+		w, ok := want[d.Field]
+		if d.Subject != SubjectUser || d.SubjectID != 3002 || !ok || d.Expected != w[0] || d.Actual != w[1] {
+			t.Errorf("неожиданное расхождение: %+v", d)
+		}
+	}
+	// Без repair сохраненный баланс не меняется
+	assertLifetime(t, service, 3002, 500, 100, 7)
+
+	report, err = service.Reconcile(ctx, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(report.Discrepancies) != len(want) || report.Repaired != len(want) {
+		t.Errorf("расхождений %d, исправлено %d; ожидалось %d", len(report.Discrepancies), report.Repaired, len(want))
+	}
+	assertLifetime(t, service, 3002, 70, 100, 30)
+
+	// Повторная сверка не находит расхождений
+	report, err = service.Reconcile(ctx, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(report.Discrepancies) != 0 {
+		t.Errorf("после исправления осталось расхождений: %d", len(report.Discrepancies))
+	}
+}
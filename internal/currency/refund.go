@@ -0,0 +1,242 @@
+// Возвраты нейронов
+
+package currency
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+
+	"go.uber.org/zap"
+)
+
+var (
+	// ErrTransactionNotFound возвращается, если транзакция не найдена
+	ErrTransactionNotFound = errors.New("транзакция не найдена")
+	// ErrNotRefundable возвращается при попытке вернуть транзакцию неподходящего типа
+	ErrNotRefundable = errors.New("транзакцию нельзя вернуть")
+	// ErrNothingToRefund возвращается, если на балансе не осталось нейронов для списания по возврату
+	// или списание уже полностью возвращено частичными возвратами
+	ErrNothingToRefund = errors.New("нет нейронов для списания")
+)
+
+// RefundReason представляет причину возврата
+type RefundReason string
+
+const (
+	RefundEmptyResponse  RefundReason = "empty_response"  // Нейросеть вернула пустой ответ
+	RefundSafetyBlocked  RefundReason = "safety_blocked"  // Ответ заблокирован фильтром провайдера
+	RefundDeliveryFailed RefundReason = "delivery_failed" // Ответ не удалось доставить пользователю
+	RefundRequestFailed  RefundReason = "request_failed"  // Запрос к нейросети завершился ошибкой
+	RefundCachedResponse RefundReason = "cached_response" // Ответ получен из кэша без запроса к нейросети
+	RefundPayment        RefundReason = "payment_refund"  // Возврат платежа
+	RefundAdmin          RefundReason = "admin"           // Решение администратора
+)
+
+// Description возвращает описание причины возврата для истории транзакций
+func (r RefundReason) Description() string {
+	switch r {
+	case RefundEmptyResponse:
+		return "нейросеть не вернула ответ"
+	case RefundSafetyBlocked:
+		return "ответ заблокирован фильтром нейросети"
+	case RefundDeliveryFailed:
+		return "ответ не удалось доставить"
+	case RefundRequestFailed:
+		return "запрос к нейросети не выполнен"
+	case RefundCachedResponse:
+		return "ответ получен из кэша"
+	case RefundPayment:
+		return "возврат платежа"
+	default:
+		return "решение администратора"
+	}
+}
+
+// refundReference возвращает reference_id и ключ идемпотентности возврата.
+// Уникальный ключ гарантирует, что транзакция будет возвращена не более одного раза
+func refundReference(transactionID int64) string {
+	return "refund:" + strconv.FormatInt(transactionID, 10)
+}
+
+// Refund возвращает транзакцию по ID. Списание за использование возвращается за вычетом
+// уже проведенных частичных возвратов, а начисление (например, покупка пакета) списывается
+// в пределах оставшегося баланса.
+// Повторный вызов для той же транзакции возвращает уже созданный возврат
+func (s *Service) Refund(ctx context.Context, transactionID int64, reason RefundReason, comment string) (*Transaction, error) {
+	original, err := s.repo.GetTransactionByID(ctx, transactionID)
+	if err != nil {
+		return nil, err
+	}
+	if original == nil {
+		return nil, ErrTransactionNotFound
+	}
+	if !original.IsRefundable() {
+		return nil, ErrNotRefundable
+	}
+
+	reference := refundReference(transactionID)
+	existing, err := s.repo.GetTransactionByIdempotencyKey(ctx, TypeRefund, reference)
+	if err != nil {
+		return nil, err
+	}
+	if existing != nil {
+		return existing, nil
+	}
+
+	amount := -original.Amount
+	metadata := Metadata{
+		"original_transaction_id": original.ID,
+		"original_type":           string(original.TransactionType),
+		"reason":                  string(reason),
+	}
+	if comment != "" {
+		metadata["comment"] = comment
+	}
+
+	// Потраченные нейроны вернуть нельзя, поэтому начисление списывается в пределах баланса
+	if amount < 0 {
+		var balance *Balance
+		if original.WalletID != nil {
+			balance, err = s.GetWalletBalance(ctx, *original.WalletID)
+		} else {
+			balance, err = s.repo.GetBalance(ctx, original.UserID)
+		}
+		if err != nil {
+			return nil, err
+		}
+		if balance.Balance < -amount {
+			metadata["requested_amount"] = -amount
+			amount = -balance.Balance
+		}
+		if amount == 0 {
+			return nil, ErrNothingToRefund
+		}
+	}
+
+	// Возврат проводится по тому же балансу: личному или общего кошелька
+	tx := &Transaction{
+		UserID:          original.UserID,
+		WalletID:        original.WalletID,
+		Amount:          amount,
+		TransactionType: TypeRefund,
+		Description:     fmt.Sprintf("Возврат: %s", reason.Description()),
+		ReferenceID:     reference,
+		IdempotencyKey:  reference,
+		Metadata:        metadata,
+	}
+
+	// Возврат мог быть создан параллельным вызовом, тогда возвращается он
+	var replayed bool
+	if amount > 0 {
+		limit := amount
+		tx, replayed, err = s.addTransactionWith(ctx, tx, func(ctx context.Context, tx *Transaction) error {
+			return s.repo.AddRefund(ctx, tx, limit)
+		})
+	} else {
+		tx, replayed, err = s.addTransaction(ctx, tx)
+	}
+	if errors.Is(err, ErrNothingToRefund) {
+		return nil, err
+	}
+	if err != nil {
+		s.log.Error("Ошибка возврата транзакции",
+			zap.Int64("transaction_id", transactionID),
+			zap.String("reason", string(reason)),
+			zap.Error(err))
+		return nil, fmt.Errorf("ошибка возврата транзакции: %w", err)
+	}
+	if replayed {
+		return tx, nil
+	}
+
+	// Ответ, за который вернули нейроны, не должен попадать в кэш
+	if original.TransactionType == TypeUsage {
+		if err := s.repo.MarkUsageRefunded(ctx, original.ID); err != nil {
+			s.log.Error("Ошибка отметки возврата использования нейросети",
+				zap.Int64("transaction_id", transactionID),
+				zap.Error(err))
+		}
+	}
+
+	s.log.Info("Транзакция возвращена",
+		zap.Int64("transaction_id", transactionID),
+		zap.Int64("refund_id", tx.ID),
+		zap.Int64("user_id", tx.UserID),
+		zap.Int("amount", tx.Amount),
+		zap.String("reason", string(reason)))
+
+	return tx, nil
+}
+
+// RefundPart возвращает часть списания за использование, например долю модели, не ответившей
+// в режиме сравнения. Часть определяет ключ идемпотентности, поэтому каждая часть
+// возвращается не более одного раза. Вместе с другими возвратами той же транзакции
+// возвращается не больше исходного списания
+func (s *Service) RefundPart(ctx context.Context, transactionID int64, amount int, part string, reason RefundReason) (*Transaction, error) {
+	if amount <= 0 {
+		return nil, errors.New("сумма должна быть положительной")
+	}
+
+	original, err := s.repo.GetTransactionByID(ctx, transactionID)
+	if err != nil {
+		return nil, err
+	}
+	if original == nil {
+		return nil, ErrTransactionNotFound
+	}
+	if original.TransactionType != TypeUsage || amount > -original.Amount {
+		return nil, ErrNotRefundable
+	}
+
+	reference := refundReference(transactionID) + ":" + part
+	tx := &Transaction{
+		UserID:          original.UserID,
+		WalletID:        original.WalletID,
+		Amount:          amount,
+		TransactionType: TypeRefund,
+		Description:     fmt.Sprintf("Возврат: %s", reason.Description()),
+		ReferenceID:     refundReference(transactionID),
+		IdempotencyKey:  reference,
+		Metadata: Metadata{
+			"original_transaction_id": original.ID,
+			"original_type":           string(original.TransactionType),
+			"reason":                  string(reason),
+			"part":                    part,
+		},
+	}
+
+	limit := -original.Amount
+	tx, replayed, err := s.addTransactionWith(ctx, tx, func(ctx context.Context, tx *Transaction) error {
+		return s.repo.AddRefund(ctx, tx, limit)
+	})
+	if errors.Is(err, ErrNothingToRefund) {
+		return nil, err
+	}
+	if err != nil {
+		s.log.Error("Ошибка частичного возврата транзакции",
+			zap.Int64("transaction_id", transactionID),
+			zap.String("part", part),
+			zap.Error(err))
+		return nil, fmt.Errorf("ошибка возврата транзакции: %w", err)
+	}
+	if replayed {
+		return tx, nil
+	}
+
+	s.log.Info("Часть транзакции возвращена",
+		zap.Int64("transaction_id", transactionID),
+		zap.Int64("refund_id", tx.ID),
+		zap.Int64("user_id", tx.UserID),
+		zap.String("part", part),
+		zap.Int("amount", tx.Amount),
+		zap.String("reason", string(reason)))
+
+	return tx, nil
+}
+
+// FindTransaction возвращает транзакцию указанного типа по связанному ID
+func (s *Service) FindTransaction(ctx context.Context, txType TransactionType, referenceID string) (*Transaction, error) {
+	return s.repo.GetTransactionByReference(ctx, txType, referenceID)
+}
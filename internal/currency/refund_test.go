@@ -0,0 +1,82 @@
+// Тесты возвратов нейронов
+
+package currency
+
+import (
+	"context"
+	"errors"
+	"testing"
+)
+
+func TestRefundAfterRefundPart(t *testing.T) {
+	service, _ := newTestService(t, 3301)
+	ctx := context.Background()
+
+	if _, err := service.AddNeurons(ctx, 3301, 100, TypeBonus, "Бонус", nil, "", "", 0); err != nil {
+		t.Fatal(err)
+	}
+	usage, err := service.SpendNeurons(ctx, 3301, 40, TypeUsage, "Сравнение", nil, "", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Одна из моделей сравнения не ответила, ее доля возвращена
+	if _, err := service.RefundPart(ctx, usage.ID, 15, "model-a", RefundRequestFailed); err != nil {
+		t.Fatal(err)
+	}
+	assertLifetime(t, service, 3301, 75, 100, 25)
+
+	// Полный возврат возвращает только остаток списания
+	refund, err := service.Refund(ctx, usage.ID, RefundDeliveryFailed, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if refund.Amount != 25 {
+		t.Errorf("возвращено %d нейронов, ожидалось 25", refund.Amount)
+	}
+	assertLifetime(t, service, 3301, 100, 100, 0)
+
+	// Повтор полного возврата возвращает тот же возврат
+	again, err := service.Refund(ctx, usage.ID, RefundDeliveryFailed, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if again.ID != refund.ID {
+		t.Errorf("повтор создал возврат %d, ожидался %d", again.ID, refund.ID)
+	}
+
+	// После полного возврата возвращать больше нечего
+	if _, err := service.RefundPart(ctx, usage.ID, 10, "model-b", RefundRequestFailed); !errors.Is(err, ErrNothingToRefund) {
+		t.Errorf("частичный возврат после полного: %v, ожидалась %v", err, ErrNothingToRefund)
+	}
+	assertLifetime(t, service, 3301, 100, 100, 0)
+}
+
+func TestRefundPartsCappedByUsage(t *testing.T) {
+	service, _ := newTestService(t, 3302)
+	ctx := context.Background()
+
+	if _, err := service.AddNeurons(ctx, 3302, 100, TypeBonus, "Бонус", nil, "", "", 0); err != nil {
+		t.Fatal(err)
+	}
+	usage, err := service.SpendNeurons(ctx, 3302, 30, TypeUsage, "Сравнение", nil, "", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := service.RefundPart(ctx, usage.ID, 20, "model-a", RefundRequestFailed); err != nil {
+		t.Fatal(err)
+	}
+	// Вторая часть уменьшается до невозвращенного остатка
+	part, err := service.RefundPart(ctx, usage.ID, 20, "model-b", RefundRequestFailed)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if part.Amount != 10 {
+		t.Errorf("возвращено %d нейронов, ожидалось 10", part.Amount)
+	}
+	if _, err := service.Refund(ctx, usage.ID, RefundDeliveryFailed, ""); !errors.Is(err, ErrNothingToRefund) {
+		t.Errorf("полный возврат после частичных: %v, ожидалась %v", err, ErrNothingToRefund)
+	}
+	assertLifetime(t, service, 3302, 100, 100, 0)
+}
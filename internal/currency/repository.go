@@ -10,6 +10,9 @@ import (
 	"time"
 )
 
+// ErrDuplicateTransaction возвращается, если транзакция с таким ключом идемпотентности уже проведена
+var ErrDuplicateTransaction = errors.New("транзакция с таким ключом идемпотентности уже проведена")
+
 // Repository представляет репозиторий для работы с нейронами
 type Repository struct {
 	db *sql.DB
@@ -92,11 +95,71 @@ func (r *Repository) AddTransaction(ctx context.Context, tx *Transaction) error
 	}
 	defer dbTx.Rollback()
 
+	if err := r.applyTransaction(ctx, dbTx, tx); err != nil {
+		return err
+	}
+
+	// Подтверждаем транзакцию
+	if err := dbTx.Commit(); err != nil {
+		return fmt.Errorf("ошибка подтверждения транзакции: %w", err)
+	}
+
+	return nil
+}
+
+// AddRefund проводит возврат списания, уменьшая его до суммы, которая еще не возвращена
+// возвратами той же транзакции (с тем же reference_id). Уже проведенные возвраты считаются
+// в той же транзакции БД, что и изменение баланса: параллельный возврат изменяет ту же строку баланса,
+// поэтому при REPEATABLE READ один из возвратов завершается ошибкой сериализации
+func (r *Repository) AddRefund(ctx context.Context, tx *Transaction, limit int) error {
+	dbTx, err := r.db.BeginTx(ctx, &sql.TxOptions{Isolation: sql.LevelRepeatableRead})
+	if err != nil {
+		return fmt.Errorf("ошибка начала транзакции: %w", err)
+	}
+	defer dbTx.Rollback()
+
+	var refunded int
+	err = dbTx.QueryRowContext(ctx, `
+		SELECT COALESCE(SUM(amount), 0)
+		FROM neuron_transactions
+		WHERE transaction_type = $1 AND reference_id = $2
+	`, TypeRefund, tx.ReferenceID).Scan(&refunded)
+	if err != nil {
+		return fmt.Errorf("ошибка получения суммы возвратов: %w", err)
+	}
+
+	remaining := limit - refunded
+	if remaining <= 0 {
+		return ErrNothingToRefund
+	}
+	if tx.Amount > remaining {
+		tx.Metadata["requested_amount"] = tx.Amount
+		tx.Amount = remaining
+	}
+
+	if err := r.applyTransaction(ctx, dbTx, tx); err != nil {
+		return err
+	}
+
+	if err := dbTx.Commit(); err != nil {
+		return fmt.Errorf("ошибка подтверждения транзакции: %w", err)
+	}
+
+	return nil
+}
+
+// applyTransaction обновляет баланс пользователя, сохраняет транзакцию и ее проводки
+// в рамках переданной транзакции БД
+func (r *Repository) applyTransaction(ctx context.Context, dbTx *sql.Tx, tx *Transaction) error {
+	if tx.WalletID != nil {
+		return r.applyWalletTransaction(ctx, dbTx, tx)
+	}
+
 	// Получаем текущий баланс пользователя с блокировкой строки
 	var currentBalance, lifetimeEarned, lifetimeSpent int
 	var lastDailyRewardAt *time.Time
 
-	err = dbTx.QueryRowContext(ctx, `
+	err := dbTx.QueryRowContext(ctx, `
 		SELECT balance, lifetime_earned, lifetime_spent, last_daily_reward_at
 		FROM user_neuron_balance 
 		WHERE user_id = $1 
@@ -128,11 +191,9 @@ func (r *Repository) AddTransaction(ctx context.Context, tx *Transaction) error
 	}
 
 	// Обновляем lifetime метрики и последнюю дату ежедневного вознаграждения
-	if tx.Amount > 0 {
-		lifetimeEarned += tx.Amount
-	} else {
-		lifetimeSpent += -tx.Amount
-	}
+	earned, spent := tx.LifetimeDelta()
+	lifetimeEarned += earned
+	lifetimeSpent += spent
 
 	updateFields := "balance = $1, lifetime_earned = $2, lifetime_spent = $3, updated_at = NOW()"
 	updateArgs := []interface{}{newBalance, lifetimeEarned, lifetimeSpent, tx.UserID}
@@ -158,20 +219,28 @@ func (r *Repository) AddTransaction(ctx context.Context, tx *Transaction) error
 	// Устанавливаем баланс после транзакции
 	tx.BalanceAfter = newBalance
 
-	// Вставляем запись транзакции
+	return r.insertTransaction(ctx, dbTx, tx)
+}
+
+// insertTransaction сохраняет транзакцию с уже рассчитанным балансом и ее проводки
+func (r *Repository) insertTransaction(ctx context.Context, dbTx *sql.Tx, tx *Transaction) error {
+	// Вставляем запись транзакции. Повтор операции с тем же ключом идемпотентности
+	// не вставляет строку, и вся транзакция БД, включая изменение баланса, откатывается
 	query := `
 		INSERT INTO neuron_transactions (
-			user_id, amount, balance_after, transaction_type, 
-			description, expires_at, reference_id, metadata
+			user_id, wallet_id, amount, balance_after, transaction_type,
+			description, expires_at, reference_id, metadata, idempotency_key
 		)
-		VALUES ($1, $2, $3, $4, $5, $6, $7, $8)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, NULLIF($10, ''))
+		ON CONFLICT (transaction_type, idempotency_key) WHERE idempotency_key IS NOT NULL DO NOTHING
 		RETURNING id, created_at
 	`
 
-	err = dbTx.QueryRowContext(
+	err := dbTx.QueryRowContext(
 		ctx,
 		query,
 		tx.UserID,
+		tx.WalletID,
 		tx.Amount,
 		tx.BalanceAfter,
 		tx.TransactionType,
@@ -179,13 +248,90 @@ func (r *Repository) AddTransaction(ctx context.Context, tx *Transaction) error
 		tx.ExpiresAt,
 		tx.ReferenceID,
 		tx.Metadata,
+		tx.IdempotencyKey,
 	).Scan(&tx.ID, &tx.CreatedAt)
 
 	if err != nil {
+		if err == sql.ErrNoRows {
+			return ErrDuplicateTransaction
+		}
 		return fmt.Errorf("ошибка создания транзакции: %w", err)
 	}
 
-	// Подтверждаем транзакцию
+	return r.postEntries(ctx, dbTx, tx)
+}
+
+// Transfer атомарно переводит нейроны между пользователями: списание у отправителя
+// и начисление получателю записываются в одной транзакции БД и ссылаются друг на друга.
+// Переводить можно только нейроны, доступные для перевода, с учетом суточных лимитов
+func (r *Repository) Transfer(ctx context.Context, debit, credit *Transaction, limits TransferLimits) error {
+	dbTx, err := r.db.BeginTx(ctx, &sql.TxOptions{Isolation: sql.LevelRepeatableRead})
+	if err != nil {
+		return fmt.Errorf("ошибка начала транзакции: %w", err)
+	}
+	defer dbTx.Rollback()
+
+	// Баланс получателя создается заранее, чтобы блокировать обе строки в одном порядке
+	_, err = dbTx.ExecContext(ctx, `
+		INSERT INTO user_neuron_balance (user_id, balance, lifetime_earned, lifetime_spent)
+		VALUES ($1, 0, 0, 0)
+		ON CONFLICT (user_id) DO NOTHING
+	`, credit.UserID)
+	if err != nil {
+		return fmt.Errorf("ошибка создания баланса: %w", err)
+	}
+
+	// Блокируем балансы по возрастанию ID пользователя, чтобы встречные переводы не взаимоблокировались
+	_, err = dbTx.ExecContext(ctx, `
+		SELECT user_id FROM user_neuron_balance
+		WHERE user_id IN ($1, $2)
+		ORDER BY user_id
+		FOR UPDATE
+	`, debit.UserID, credit.UserID)
+	if err != nil {
+		return fmt.Errorf("ошибка блокировки балансов: %w", err)
+	}
+
+	// Лимиты проверяются под блокировкой, поэтому параллельные переводы не превышают их
+	if limits.DailyAmount > 0 || limits.DailyCount > 0 {
+		sentAmount, sentCount, err := countTransfers(ctx, dbTx, debit.UserID)
+		if err != nil {
+			return err
+		}
+		if limits.DailyAmount > 0 && sentAmount-debit.Amount > limits.DailyAmount {
+			return ErrTransferLimit
+		}
+		if limits.DailyCount > 0 && sentCount >= limits.DailyCount {
+			return ErrTransferLimit
+		}
+	}
+
+	transferable, expiresAt, err := r.getTransferable(ctx, dbTx, debit.UserID)
+	if err != nil {
+		return err
+	}
+	if transferable < -debit.Amount {
+		return ErrNotTransferable
+	}
+
+	// Подаренные нейроны сохраняют срок действия купленных нейронов отправителя
+	credit.ExpiresAt = expiresAt
+
+	if err := r.applyTransaction(ctx, dbTx, debit); err != nil {
+		return err
+	}
+
+	credit.Metadata["linked_transaction_id"] = debit.ID
+	if err := r.applyTransaction(ctx, dbTx, credit); err != nil {
+		return err
+	}
+
+	debit.Metadata["linked_transaction_id"] = credit.ID
+	_, err = dbTx.ExecContext(ctx, `UPDATE neuron_transactions SET metadata = $1 WHERE id = $2`, debit.Metadata, debit.ID)
+	if err != nil {
+		return fmt.Errorf("ошибка связывания транзакций перевода: %w", err)
+	}
+
 	if err := dbTx.Commit(); err != nil {
 		return fmt.Errorf("ошибка подтверждения транзакции: %w", err)
 	}
@@ -193,166 +339,596 @@ func (r *Repository) AddTransaction(ctx context.Context, tx *Transaction) error
 	return nil
 }
 
-// GetTransactionHistory получает историю транзакций пользователя
-func (r *Repository) GetTransactionHistory(ctx context.Context, userID int64, limit, offset int) ([]*Transaction, error) {
-	query := `
-		SELECT id, user_id, amount, balance_after, transaction_type, 
-		       description, expires_at, reference_id, metadata, created_at
+// getTransferable возвращает количество нейронов, доступных для перевода, и ближайший
+// срок их действия. Переводить можно только купленные нейроны, которые еще не сгорели
+// и не были подарены, переведены в кошелек или возвращены; бонусные и полученные
+// в подарок нейроны не переводятся
+func (r *Repository) getTransferable(ctx context.Context, dbTx *sql.Tx, userID int64) (int, *time.Time, error) {
+	var balance, purchased, withdrawn int
+	var expiresAt *time.Time
+
+	err := dbTx.QueryRowContext(ctx, `
+		WITH active AS (
+			SELECT amount, expires_at, created_at
+			FROM neuron_transactions
+			WHERE user_id = $1 AND transaction_type = 'purchase' AND expired_at IS NULL
+			  AND (expires_at IS NULL OR expires_at > NOW())
+		)
+		SELECT
+			COALESCE((SELECT balance FROM user_neuron_balance WHERE user_id = $1), 0),
+			COALESCE((SELECT SUM(amount) FROM active), 0),
+			COALESCE((
+				SELECT SUM(-t.amount)
+				FROM neuron_transactions t
+				WHERE t.user_id = $1 AND t.amount < 0
+				  AND (t.transaction_type IN ('transfer', 'deposit')
+				       OR (t.transaction_type = 'refund' AND t.metadata->>'original_type' = 'purchase'))
+				  AND t.created_at >= (SELECT MIN(created_at) FROM active)
+			), 0),
+			(SELECT MIN(expires_at) FROM active)
+	`, userID).Scan(&balance, &purchased, &withdrawn, &expiresAt)
+	if err != nil {
+		return 0, nil, fmt.Errorf("ошибка расчета нейронов для перевода: %w", err)
+	}
+
+	transferable := purchased - withdrawn
+	if transferable > balance {
+		transferable = balance
+	}
+	if transferable < 0 {
+		transferable = 0
+	}
+
+	return transferable, expiresAt, nil
+}
+
+// GetTransferable возвращает количество нейронов, доступных для перевода
+func (r *Repository) GetTransferable(ctx context.Context, userID int64) (int, error) {
+	dbTx, err := r.db.BeginTx(ctx, &sql.TxOptions{ReadOnly: true})
+	if err != nil {
+		return 0, fmt.Errorf("ошибка начала транзакции: %w", err)
+	}
+	defer dbTx.Rollback()
+
+	transferable, _, err := r.getTransferable(ctx, dbTx, userID)
+	return transferable, err
+}
+
+// GetTransferredToday возвращает сумму и количество переводов пользователя за последние сутки
+func (r *Repository) GetTransferredToday(ctx context.Context, userID int64) (int, int, error) {
+	return countTransfers(ctx, r.db, userID)
+}
+
+// queryRower объединяет sql.DB и sql.Tx для запросов, возвращающих одну строку
+type queryRower interface {
+	QueryRowContext(ctx context.Context, query string, args ...interface{}) *sql.Row
+}
+
+// countTransfers возвращает сумму и количество переводов пользователя за последние сутки
+func countTransfers(ctx context.Context, q queryRower, userID int64) (int, int, error) {
+	var amount, count int
+	err := q.QueryRowContext(ctx, `
+		SELECT COALESCE(SUM(-amount), 0), COUNT(*)
 		FROM neuron_transactions
-		WHERE user_id = $1
-		ORDER BY created_at DESC
-		LIMIT $2 OFFSET $3
-	`
+		WHERE user_id = $1 AND transaction_type = $2 AND amount < 0
+		  AND created_at > NOW() - INTERVAL '24 hours'
+	`, userID, TypeTransfer).Scan(&amount, &count)
+	if err != nil {
+		return 0, 0, fmt.Errorf("ошибка подсчета переводов за сутки: %w", err)
+	}
+	return amount, count, nil
+}
 
-	rows, err := r.db.QueryContext(ctx, query, userID, limit, offset)
+// applyWalletTransaction обновляет баланс общего кошелька и сохраняет транзакцию.
+// Траты участника на запросы проверяются по его суточному лимиту под блокировкой кошелька
+func (r *Repository) applyWalletTransaction(ctx context.Context, dbTx *sql.Tx, tx *Transaction) error {
+	var currentBalance, lifetimeEarned, lifetimeSpent int
+	err := dbTx.QueryRowContext(ctx, `
+		SELECT balance, lifetime_earned, lifetime_spent
+		FROM neuron_wallets
+		WHERE id = $1
+		FOR UPDATE
+	`, *tx.WalletID).Scan(&currentBalance, &lifetimeEarned, &lifetimeSpent)
 	if err != nil {
-		return nil, fmt.Errorf("ошибка получения истории транзакций: %w", err)
+		if err == sql.ErrNoRows {
+			return ErrWalletNotFound
+		}
+		return fmt.Errorf("ошибка получения баланса кошелька: %w", err)
 	}
-	defer rows.Close()
 
-	var transactions []*Transaction
-	for rows.Next() {
-		tx := &Transaction{}
-		err := rows.Scan(
-			&tx.ID,
-			&tx.UserID,
-			&tx.Amount,
-			&tx.BalanceAfter,
-			&tx.TransactionType,
-			&tx.Description,
-			&tx.ExpiresAt,
-			&tx.ReferenceID,
-			&tx.Metadata,
-			&tx.CreatedAt,
-		)
+	if tx.TransactionType == TypeUsage && tx.Amount < 0 {
+		var dailyLimit *int
+		err := dbTx.QueryRowContext(ctx, `
+			SELECT daily_limit FROM neuron_wallet_members WHERE wallet_id = $1 AND user_id = $2
+		`, *tx.WalletID, tx.UserID).Scan(&dailyLimit)
 		if err != nil {
-			return nil, fmt.Errorf("ошибка сканирования транзакции: %w", err)
+			if err == sql.ErrNoRows {
+				return ErrNotWalletMember
+			}
+			return fmt.Errorf("ошибка получения участника кошелька: %w", err)
+		}
+		if dailyLimit != nil {
+			spent, err := walletSpentToday(ctx, dbTx, *tx.WalletID, tx.UserID)
+			if err != nil {
+				return err
+			}
+			if spent-tx.Amount > *dailyLimit {
+				return ErrWalletDailyLimit
+			}
 		}
-		transactions = append(transactions, tx)
 	}
 
-	if err := rows.Err(); err != nil {
-		return nil, fmt.Errorf("ошибка при итерации транзакций: %w", err)
+	newBalance := currentBalance + tx.Amount
+	if newBalance < 0 {
+		return errors.New("недостаточно нейронов в кошельке")
 	}
 
-	return transactions, nil
+	earned, spent := tx.LifetimeDelta()
+	lifetimeEarned += earned
+	lifetimeSpent += spent
+
+	_, err = dbTx.ExecContext(ctx, `
+		UPDATE neuron_wallets
+		SET balance = $1, lifetime_earned = $2, lifetime_spent = $3, updated_at = NOW()
+		WHERE id = $4
+	`, newBalance, lifetimeEarned, lifetimeSpent, *tx.WalletID)
+	if err != nil {
+		return fmt.Errorf("ошибка обновления баланса кошелька: %w", err)
+	}
+
+	tx.BalanceAfter = newBalance
+
+	return r.insertTransaction(ctx, dbTx, tx)
 }
 
-// GetAllPackages получает все доступные пакеты нейронов
-func (r *Repository) GetAllPackages(ctx context.Context) ([]*Package, error) {
-	query := `
-		SELECT id, name, amount, bonus_amount, price, sort_order, is_active, created_at, updated_at
-		FROM neuron_packages
-		WHERE is_active = true
-		ORDER BY sort_order ASC
-	`
+// walletSpentToday возвращает, сколько нейронов участник потратил из кошелька за последние сутки
+// с учетом возвратов
+func walletSpentToday(ctx context.Context, q queryRower, walletID, userID int64) (int, error) {
+	var spent int
+	err := q.QueryRowContext(ctx, `
+		SELECT COALESCE(-SUM(amount), 0)
+		FROM neuron_transactions
+		WHERE wallet_id = $1 AND user_id = $2 AND transaction_type IN ('usage', 'refund')
+		  AND created_at > NOW() - INTERVAL '24 hours'
+	`, walletID, userID).Scan(&spent)
+	if err != nil {
+		return 0, fmt.Errorf("ошибка подсчета трат участника кошелька: %w", err)
+	}
+	if spent < 0 {
+		spent = 0
+	}
+	return spent, nil
+}
 
-	rows, err := r.db.QueryContext(ctx, query)
+// GetWalletSpentToday возвращает траты участников кошелька за последние сутки
+func (r *Repository) GetWalletSpentToday(ctx context.Context, walletID int64) (map[int64]int, error) {
+	rows, err := r.db.QueryContext(ctx, `
+		SELECT user_id, COALESCE(-SUM(amount), 0)
+		FROM neuron_transactions
+		WHERE wallet_id = $1 AND transaction_type IN ('usage', 'refund')
+		  AND created_at > NOW() - INTERVAL '24 hours'
+		GROUP BY user_id
+	`, walletID)
 	if err != nil {
-		return nil, fmt.Errorf("ошибка получения пакетов нейронов: %w", err)
+		return nil, fmt.Errorf("ошибка подсчета трат участников кошелька: %w", err)
 	}
 	defer rows.Close()
 
-	var packages []*Package
+	spent := make(map[int64]int)
 	for rows.Next() {
-		pkg := &Package{}
-		err := rows.Scan(
-			&pkg.ID,
-			&pkg.Name,
-			&pkg.Amount,
-			&pkg.BonusAmount,
-			&pkg.Price,
-			&pkg.SortOrder,
-			&pkg.IsActive,
-			&pkg.CreatedAt,
-			&pkg.UpdatedAt,
-		)
-		if err != nil {
-			return nil, fmt.Errorf("ошибка сканирования пакета нейронов: %w", err)
+		var userID int64
+		var amount int
+		if err := rows.Scan(&userID, &amount); err != nil {
+			return nil, fmt.Errorf("ошибка сканирования трат участника кошелька: %w", err)
 		}
-		packages = append(packages, pkg)
+		spent[userID] = amount
 	}
 
 	if err := rows.Err(); err != nil {
-		return nil, fmt.Errorf("ошибка при итерации пакетов нейронов: %w", err)
+		return nil, fmt.Errorf("ошибка при итерации трат участников кошелька: %w", err)
 	}
 
-	return packages, nil
+	return spent, nil
 }
 
-// GetPackageByID получает пакет нейронов по ID
-func (r *Repository) GetPackageByID(ctx context.Context, packageID int) (*Package, error) {
-	query := `
-		SELECT id, name, amount, bonus_amount, price, sort_order, is_active, created_at, updated_at
-		FROM neuron_packages
-		WHERE id = $1
-	`
+// GetWalletSpentTodayByUser возвращает траты участника из кошелька за последние сутки
+func (r *Repository) GetWalletSpentTodayByUser(ctx context.Context, walletID, userID int64) (int, error) {
+	return walletSpentToday(ctx, r.db, walletID, userID)
+}
 
-	pkg := &Package{}
-	err := r.db.QueryRowContext(ctx, query, packageID).Scan(
-		&pkg.ID,
-		&pkg.Name,
-		&pkg.Amount,
-		&pkg.BonusAmount,
-		&pkg.Price,
-		&pkg.SortOrder,
-		&pkg.IsActive,
-		&pkg.CreatedAt,
-		&pkg.UpdatedAt,
+// GetWalletBalance получает баланс общего кошелька. Владелец кошелька возвращается в UserID
+func (r *Repository) GetWalletBalance(ctx context.Context, walletID int64) (*Balance, error) {
+	balance := &Balance{}
+	err := r.db.QueryRowContext(ctx, `
+		SELECT id, owner_id, balance, lifetime_earned, lifetime_spent, created_at, updated_at
+		FROM neuron_wallets
+		WHERE id = $1
+	`, walletID).Scan(
+		&balance.ID,
+		&balance.UserID,
+		&balance.Balance,
+		&balance.LifetimeEarned,
+		&balance.LifetimeSpent,
+		&balance.CreatedAt,
+		&balance.UpdatedAt,
 	)
-
 	if err != nil {
 		if err == sql.ErrNoRows {
-			return nil, nil // Пакет не найден
+			return nil, nil
 		}
-		return nil, fmt.Errorf("ошибка получения пакета нейронов: %w", err)
+		return nil, fmt.Errorf("ошибка получения баланса кошелька: %w", err)
 	}
 
-	return pkg, nil
+	balance.WalletID = &balance.ID
+	return balance, nil
 }
 
-// AddLLMUsage добавляет запись об использовании нейросети
-func (r *Repository) AddLLMUsage(ctx context.Context, usage *LLMUsage) error {
-	query := `
-		INSERT INTO llm_usage (
-			user_id, model_name, prompt_tokens, completion_tokens, 
-			neurons_cost, transaction_id, request_hash, 
-			request_text, response_text, metadata
-		)
-		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10)
-		RETURNING id, created_at
-	`
+// GetSelectedWallet возвращает кошелек, который оплачивает запросы пользователя,
+// и суточный лимит пользователя в нем. Если кошелек не выбран, возвращает nil
+func (r *Repository) GetSelectedWallet(ctx context.Context, userID int64) (*int64, *int, error) {
+	var walletID int64
+	var dailyLimit *int
+	err := r.db.QueryRowContext(ctx, `
+		SELECT wallet_id, daily_limit
+		FROM neuron_wallet_members
+		WHERE user_id = $1 AND is_selected
+	`, userID).Scan(&walletID, &dailyLimit)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, nil, nil
+		}
+		return nil, nil, fmt.Errorf("ошибка получения выбранного кошелька: %w", err)
+	}
+	return &walletID, dailyLimit, nil
+}
 
-	err := r.db.QueryRowContext(
-		ctx,
-		query,
-		usage.UserID,
-		usage.ModelName,
-		usage.PromptTokens,
-		usage.CompletionTokens,
-		usage.NeuronsCost,
-		usage.TransactionID,
-		usage.RequestHash,
-		usage.RequestText,
-		usage.ResponseText,
-		usage.Metadata,
-	).Scan(&usage.ID, &usage.CreatedAt)
+// Deposit атомарно переводит нейроны с личного баланса в общий кошелек. Как и при подарке,
+// переводить можно только купленные нейроны, и они сохраняют срок действия
+func (r *Repository) Deposit(ctx context.Context, debit, credit *Transaction) error {
+	dbTx, err := r.db.BeginTx(ctx, &sql.TxOptions{Isolation: sql.LevelRepeatableRead})
+	if err != nil {
+		return fmt.Errorf("ошибка начала транзакции: %w", err)
+	}
+	defer dbTx.Rollback()
 
+	// Сначала блокируем личный баланс, затем кошелек
+	_, err = dbTx.ExecContext(ctx, `
+		SELECT user_id FROM user_neuron_balance WHERE user_id = $1 FOR UPDATE
+	`, debit.UserID)
 	if err != nil {
-		return fmt.Errorf("ошибка добавления записи об использовании нейросети: %w", err)
+		return fmt.Errorf("ошибка блокировки баланса: %w", err)
+	}
+
+	transferable, expiresAt, err := r.getTransferable(ctx, dbTx, debit.UserID)
+	if err != nil {
+		return err
+	}
+	if transferable < -debit.Amount {
+		return ErrNotTransferable
+	}
+	credit.ExpiresAt = expiresAt
+
+	if err := r.applyTransaction(ctx, dbTx, debit); err != nil {
+		return err
+	}
+
+	credit.Metadata["linked_transaction_id"] = debit.ID
+	if err := r.applyTransaction(ctx, dbTx, credit); err != nil {
+		return err
+	}
+
+	debit.Metadata["linked_transaction_id"] = credit.ID
+	_, err = dbTx.ExecContext(ctx, `UPDATE neuron_transactions SET metadata = $1 WHERE id = $2`, debit.Metadata, debit.ID)
+	if err != nil {
+		return fmt.Errorf("ошибка связывания транзакций пополнения: %w", err)
+	}
+
+	if err := dbTx.Commit(); err != nil {
+		return fmt.Errorf("ошибка подтверждения транзакции: %w", err)
 	}
 
 	return nil
 }
 
-// GetLLMUsageByHash получает запись об использовании нейросети по хэшу запроса
-func (r *Repository) GetLLMUsageByHash(ctx context.Context, requestHash string) (*LLMUsage, error) {
-	query := `
+// postEntries записывает проводки по транзакции: по счету пользователя
+// и встречную по системному счету, так что сумма проводок равна нулю
+func (r *Repository) postEntries(ctx context.Context, dbTx *sql.Tx, tx *Transaction) error {
+	if tx.Amount == 0 {
+		return nil
+	}
+
+	// Транзакции кошелька проводятся по счету кошелька, а не участника
+	var err error
+	if tx.WalletID != nil {
+		_, err = dbTx.ExecContext(ctx, `
+			INSERT INTO ledger_entries (transaction_id, wallet_id, amount, created_at)
+			VALUES ($1, $2, $3, $4)
+		`, tx.ID, *tx.WalletID, tx.Amount, tx.CreatedAt)
+	} else {
+		_, err = dbTx.ExecContext(ctx, `
+			INSERT INTO ledger_entries (transaction_id, user_id, amount, created_at)
+			VALUES ($1, $2, $3, $4)
+		`, tx.ID, tx.UserID, tx.Amount, tx.CreatedAt)
+	}
+	if err != nil {
+		return fmt.Errorf("ошибка создания проводки по счету пользователя: %w", err)
+	}
+
+	result, err := dbTx.ExecContext(ctx, `
+		WITH account AS (
+			UPDATE ledger_accounts
+			SET balance = balance + $3, updated_at = NOW()
+			WHERE code = $2
+			RETURNING id
+		)
+		INSERT INTO ledger_entries (transaction_id, account_id, amount, created_at)
+		SELECT $1, id, $3, $4 FROM account
+	`, tx.ID, tx.CounterAccount(), -tx.Amount, tx.CreatedAt)
+	if err != nil {
+		return fmt.Errorf("ошибка создания проводки по системному счету: %w", err)
+	}
+
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("ошибка получения количества созданных проводок: %w", err)
+	}
+	if affected == 0 {
+		return fmt.Errorf("системный счет %s не найден", tx.CounterAccount())
+	}
+
+	return nil
+}
+
+// GetTransactionHistory получает историю транзакций личного баланса пользователя
+func (r *Repository) GetTransactionHistory(ctx context.Context, userID int64, limit, offset int) ([]*Transaction, error) {
+	query := `
+		SELECT ` + transactionColumns + `
+		FROM neuron_transactions
+		WHERE user_id = $1 AND wallet_id IS NULL
+		ORDER BY created_at DESC, id DESC
+		LIMIT $2 OFFSET $3
+	`
+
+	rows, err := r.db.QueryContext(ctx, query, userID, limit, offset)
+	if err != nil {
+		return nil, fmt.Errorf("ошибка получения истории транзакций: %w", err)
+	}
+	defer rows.Close()
+
+	var transactions []*Transaction
+	for rows.Next() {
+		tx, err := scanTransaction(rows)
+		if err != nil {
+			return nil, fmt.Errorf("ошибка сканирования транзакции: %w", err)
+		}
+		transactions = append(transactions, tx)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("ошибка при итерации транзакций: %w", err)
+	}
+
+	return transactions, nil
+}
+
+// transactionColumns - список колонок для выборки транзакции
+const transactionColumns = `
+	id, user_id, wallet_id, amount, balance_after, transaction_type,
+	description, expires_at, COALESCE(reference_id, ''), metadata,
+	COALESCE(idempotency_key, ''), created_at
+`
+
+// rowScanner объединяет sql.Row и sql.Rows
+type rowScanner interface {
+	Scan(dest ...interface{}) error
+}
+
+// scanTransaction сканирует транзакцию из результата запроса
+func scanTransaction(row rowScanner) (*Transaction, error) {
+	tx := &Transaction{}
+	err := row.Scan(
+		&tx.ID,
+		&tx.UserID,
+		&tx.WalletID,
+		&tx.Amount,
+		&tx.BalanceAfter,
+		&tx.TransactionType,
+		&tx.Description,
+		&tx.ExpiresAt,
+		&tx.ReferenceID,
+		&tx.Metadata,
+		&tx.IdempotencyKey,
+		&tx.CreatedAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+	return tx, nil
+}
+
+// GetTransactionByID получает транзакцию по ID
+func (r *Repository) GetTransactionByID(ctx context.Context, transactionID int64) (*Transaction, error) {
+	query := `SELECT ` + transactionColumns + ` FROM neuron_transactions WHERE id = $1`
+
+	tx, err := scanTransaction(r.db.QueryRowContext(ctx, query, transactionID))
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("ошибка получения транзакции: %w", err)
+	}
+	return tx, nil
+}
+
+// GetTransactionByReference получает последнюю транзакцию указанного типа по связанному ID
+func (r *Repository) GetTransactionByReference(ctx context.Context, txType TransactionType, referenceID string) (*Transaction, error) {
+	query := `
+		SELECT ` + transactionColumns + `
+		FROM neuron_transactions
+		WHERE transaction_type = $1 AND reference_id = $2
+		ORDER BY id DESC
+		LIMIT 1
+	`
+
+	tx, err := scanTransaction(r.db.QueryRowContext(ctx, query, txType, referenceID))
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("ошибка получения транзакции: %w", err)
+	}
+	return tx, nil
+}
+
+// GetTransactionByIdempotencyKey получает транзакцию указанного типа по ключу идемпотентности
+func (r *Repository) GetTransactionByIdempotencyKey(ctx context.Context, txType TransactionType, key string) (*Transaction, error) {
+	query := `
+		SELECT ` + transactionColumns + `
+		FROM neuron_transactions
+		WHERE transaction_type = $1 AND idempotency_key = $2
+	`
+
+	tx, err := scanTransaction(r.db.QueryRowContext(ctx, query, txType, key))
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("ошибка получения транзакции: %w", err)
+	}
+	return tx, nil
+}
+
+// MarkUsageRefunded отмечает использование нейросети как возвращенное
+func (r *Repository) MarkUsageRefunded(ctx context.Context, transactionID int64) error {
+	query := `
+		UPDATE llm_usage
+		SET metadata = COALESCE(metadata, '{}'::jsonb) || '{"refunded": true}'::jsonb
+		WHERE transaction_id = $1
+	`
+
+	if _, err := r.db.ExecContext(ctx, query, transactionID); err != nil {
+		return fmt.Errorf("ошибка отметки возврата использования: %w", err)
+	}
+	return nil
+}
+
+// GetAllPackages получает все доступные пакеты нейронов
+func (r *Repository) GetAllPackages(ctx context.Context) ([]*Package, error) {
+	query := `
+		SELECT id, name, amount, bonus_amount, price, sort_order, is_active, created_at, updated_at
+		FROM neuron_packages
+		WHERE is_active = true
+		ORDER BY sort_order ASC
+	`
+
+	rows, err := r.db.QueryContext(ctx, query)
+	if err != nil {
+		return nil, fmt.Errorf("ошибка получения пакетов нейронов: %w", err)
+	}
+	defer rows.Close()
+
+	var packages []*Package
+	for rows.Next() {
+		pkg := &Package{}
+		err := rows.Scan(
+			&pkg.ID,
+			&pkg.Name,
+			&pkg.Amount,
+			&pkg.BonusAmount,
+			&pkg.Price,
+			&pkg.SortOrder,
+			&pkg.IsActive,
+			&pkg.CreatedAt,
+			&pkg.UpdatedAt,
+		)
+		if err != nil {
+			return nil, fmt.Errorf("ошибка сканирования пакета нейронов: %w", err)
+		}
+		packages = append(packages, pkg)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("ошибка при итерации пакетов нейронов: %w", err)
+	}
+
+	return packages, nil
+}
+
+// GetPackageByID получает пакет нейронов по ID
+func (r *Repository) GetPackageByID(ctx context.Context, packageID int) (*Package, error) {
+	query := `
+		SELECT id, name, amount, bonus_amount, price, sort_order, is_active, created_at, updated_at
+		FROM neuron_packages
+		WHERE id = $1
+	`
+
+	pkg := &Package{}
+	err := r.db.QueryRowContext(ctx, query, packageID).Scan(
+		&pkg.ID,
+		&pkg.Name,
+		&pkg.Amount,
+		&pkg.BonusAmount,
+		&pkg.Price,
+		&pkg.SortOrder,
+		&pkg.IsActive,
+		&pkg.CreatedAt,
+		&pkg.UpdatedAt,
+	)
+
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, nil // Пакет не найден
+		}
+		return nil, fmt.Errorf("ошибка получения пакета нейронов: %w", err)
+	}
+
+	return pkg, nil
+}
+
+// AddLLMUsage добавляет запись об использовании нейросети
+func (r *Repository) AddLLMUsage(ctx context.Context, usage *LLMUsage) error {
+	query := `
+		INSERT INTO llm_usage (
+			user_id, wallet_id, model_name, prompt_tokens, completion_tokens,
+			neurons_cost, transaction_id, request_hash,
+			request_text, response_text, metadata
+		)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11)
+		RETURNING id, created_at
+	`
+
+	err := r.db.QueryRowContext(
+		ctx,
+		query,
+		usage.UserID,
+		usage.WalletID,
+		usage.ModelName,
+		usage.PromptTokens,
+		usage.CompletionTokens,
+		usage.NeuronsCost,
+		usage.TransactionID,
+		usage.RequestHash,
+		usage.RequestText,
+		usage.ResponseText,
+		usage.Metadata,
+	).Scan(&usage.ID, &usage.CreatedAt)
+
+	if err != nil {
+		return fmt.Errorf("ошибка добавления записи об использовании нейросети: %w", err)
+	}
+
+	return nil
+}
+
+// GetLLMUsageByHash получает запись об использовании нейросети по хэшу запроса
+func (r *Repository) GetLLMUsageByHash(ctx context.Context, requestHash string) (*LLMUsage, error) {
+	query := `
 		SELECT id, user_id, model_name, prompt_tokens, completion_tokens, 
 		       neurons_cost, transaction_id, request_hash, 
 		       request_text, response_text, metadata, created_at
 		FROM llm_usage
 		WHERE request_hash = $1
+			AND NOT COALESCE((metadata->>'refunded')::boolean, false)
 		ORDER BY created_at DESC
 		LIMIT 1
 	`
@@ -415,7 +991,101 @@ func (r *Repository) GetUserLLMUsageStatistics(ctx context.Context, userID int64
 	return stats, nil
 }
 
-// ExpireNeurons помечает истекшие нейроны как недоступные
+// CountTransactions возвращает количество транзакций личного баланса пользователя
+func (r *Repository) CountTransactions(ctx context.Context, userID int64) (int, error) {
+	var count int
+	err := r.db.QueryRowContext(ctx, `SELECT COUNT(*) FROM neuron_transactions WHERE user_id = $1 AND wallet_id IS NULL`, userID).Scan(&count)
+	if err != nil {
+		return 0, fmt.Errorf("ошибка подсчета транзакций: %w", err)
+	}
+	return count, nil
+}
+
+// GetAllTransactions получает все транзакции личного баланса пользователя в порядке проведения
+func (r *Repository) GetAllTransactions(ctx context.Context, userID int64) ([]*Transaction, error) {
+	query := `
+		SELECT ` + transactionColumns + `
+		FROM neuron_transactions
+		WHERE user_id = $1 AND wallet_id IS NULL
+		ORDER BY created_at, id
+	`
+
+	rows, err := r.db.QueryContext(ctx, query, userID)
+	if err != nil {
+		return nil, fmt.Errorf("ошибка получения транзакций: %w", err)
+	}
+	defer rows.Close()
+
+	var transactions []*Transaction
+	for rows.Next() {
+		tx, err := scanTransaction(rows)
+		if err != nil {
+			return nil, fmt.Errorf("ошибка сканирования транзакции: %w", err)
+		}
+		transactions = append(transactions, tx)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("ошибка при итерации транзакций: %w", err)
+	}
+
+	return transactions, nil
+}
+
+// GetTransactionTotals возвращает сумму начислений и списаний личного баланса пользователя за период.
+// Возвраты уменьшают итог исходной транзакции, как в lifetime метриках
+func (r *Repository) GetTransactionTotals(ctx context.Context, userID int64, from, to time.Time) (earned, spent int, err error) {
+	query := `
+		SELECT
+			COALESCE(SUM(amount) FILTER (WHERE (amount > 0) <> (transaction_type = 'refund')), 0),
+			COALESCE(-SUM(amount) FILTER (WHERE (amount < 0) <> (transaction_type = 'refund')), 0)
+		FROM neuron_transactions
+		WHERE user_id = $1 AND wallet_id IS NULL AND created_at >= $2 AND created_at < $3
+	`
+
+	if err := r.db.QueryRowContext(ctx, query, userID, from, to).Scan(&earned, &spent); err != nil {
+		return 0, 0, fmt.Errorf("ошибка получения итогов по транзакциям: %w", err)
+	}
+	return earned, spent, nil
+}
+
+// GetModelUsage возвращает использование нейросетей пользователем за период по моделям.
+// Запросы, нейроны за которые возвращены, не учитываются
+func (r *Repository) GetModelUsage(ctx context.Context, userID int64, from, to time.Time) ([]*ModelUsage, error) {
+	query := `
+		SELECT model_name, COUNT(*),
+		       COALESCE(SUM(prompt_tokens), 0), COALESCE(SUM(completion_tokens), 0),
+		       COALESCE(SUM(neurons_cost), 0)
+		FROM llm_usage
+		WHERE user_id = $1 AND created_at >= $2 AND created_at < $3
+		  AND NOT COALESCE((metadata->>'refunded')::boolean, false)
+		GROUP BY model_name
+		ORDER BY COUNT(*) DESC, model_name
+	`
+
+	rows, err := r.db.QueryContext(ctx, query, userID, from, to)
+	if err != nil {
+		return nil, fmt.Errorf("ошибка получения использования нейросетей: %w", err)
+	}
+	defer rows.Close()
+
+	var usage []*ModelUsage
+	for rows.Next() {
+		u := &ModelUsage{}
+		if err := rows.Scan(&u.ModelName, &u.Requests, &u.PromptTokens, &u.CompletionTokens, &u.NeuronsCost); err != nil {
+			return nil, fmt.Errorf("ошибка сканирования использования нейросетей: %w", err)
+		}
+		usage = append(usage, u)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("ошибка при итерации использования нейросетей: %w", err)
+	}
+
+	return usage, nil
+}
+
+// ExpireNeurons списывает нейроны из истекших начислений
 func (r *Repository) ExpireNeurons(ctx context.Context) (int, error) {
 	// Начинаем транзакцию в БД
 	dbTx, err := r.db.BeginTx(ctx, nil)
@@ -424,34 +1094,34 @@ func (r *Repository) ExpireNeurons(ctx context.Context) (int, error) {
 	}
 	defer dbTx.Rollback()
 
-	// Получаем истекшие транзакции, сгруппированные по пользователям
+	// Граница фиксируется заранее, чтобы отметить ровно те начисления, которые были учтены
+	cutoff := time.Now()
+
+	// Получаем необработанные истекшие начисления, сгруппированные по пользователям
+	// и кошелькам. Списание с кошелька проводится от имени его владельца
 	query := `
-		SELECT user_id, SUM(amount) as total_amount
-		FROM neuron_transactions
-		WHERE expires_at < NOW() AND amount > 0
-			AND NOT EXISTS (
-				SELECT 1 FROM neuron_transactions t2
-				WHERE t2.reference_id = neuron_transactions.id::text
-				AND t2.transaction_type = 'admin'
-				AND t2.amount < 0
-			)
-		GROUP BY user_id
+		SELECT COALESCE(w.owner_id, t.user_id), t.wallet_id, SUM(t.amount) as total_amount
+		FROM neuron_transactions t
+		LEFT JOIN neuron_wallets w ON w.id = t.wallet_id
+		WHERE t.expires_at < $1 AND t.amount > 0 AND t.expired_at IS NULL
+		GROUP BY COALESCE(w.owner_id, t.user_id), t.wallet_id
 	`
 
-	rows, err := dbTx.QueryContext(ctx, query)
+	rows, err := dbTx.QueryContext(ctx, query, cutoff)
 	if err != nil {
 		return 0, fmt.Errorf("ошибка получения истекших нейронов: %w", err)
 	}
 
 	type expiredEntry struct {
-		UserID int64
-		Amount int
+		UserID   int64
+		WalletID *int64
+		Amount   int
 	}
 
 	var expiredEntries []expiredEntry
 	for rows.Next() {
 		var entry expiredEntry
-		if err := rows.Scan(&entry.UserID, &entry.Amount); err != nil {
+		if err := rows.Scan(&entry.UserID, &entry.WalletID, &entry.Amount); err != nil {
 			rows.Close()
 			return 0, fmt.Errorf("ошибка сканирования истекших нейронов: %w", err)
 		}
@@ -465,13 +1135,20 @@ func (r *Repository) ExpireNeurons(ctx context.Context) (int, error) {
 
 	// Создаем транзакции для списания истекших нейронов
 	for _, entry := range expiredEntries {
-		// Получаем текущий баланс пользователя
+		// Получаем текущий баланс пользователя или кошелька
 		var currentBalance int
-		err := dbTx.QueryRowContext(ctx, `
-			SELECT balance FROM user_neuron_balance 
-			WHERE user_id = $1 
-			FOR UPDATE
-		`, entry.UserID).Scan(&currentBalance)
+		var err error
+		if entry.WalletID != nil {
+			err = dbTx.QueryRowContext(ctx, `
+				SELECT balance FROM neuron_wallets WHERE id = $1 FOR UPDATE
+			`, *entry.WalletID).Scan(&currentBalance)
+		} else {
+			err = dbTx.QueryRowContext(ctx, `
+				SELECT balance FROM user_neuron_balance 
+				WHERE user_id = $1 
+				FOR UPDATE
+			`, entry.UserID).Scan(&currentBalance)
+		}
 
 		if err != nil {
 			return 0, fmt.Errorf("ошибка получения баланса для списания: %w", err)
@@ -484,33 +1161,38 @@ func (r *Repository) ExpireNeurons(ctx context.Context) (int, error) {
 			amountToExpire = currentBalance
 		}
 
-		if amountToExpire <= 0 {
-			continue
+		if amountToExpire > 0 {
+			// Списание проходит через общий путь, поэтому обновляются lifetime_spent и проводки
+			tx := &Transaction{
+				UserID:          entry.UserID,
+				WalletID:        entry.WalletID,
+				Amount:          -amountToExpire,
+				TransactionType: TypeExpiry,
+				Description:     "Истечение срока действия нейронов",
+				ReferenceID:     "expire_system",
+				Metadata:        Metadata{"expired_amount": entry.Amount},
+			}
+			if err := r.applyTransaction(ctx, dbTx, tx); err != nil {
+				return 0, fmt.Errorf("ошибка создания транзакции списания: %w", err)
+			}
 		}
 
-		// Обновляем баланс
-		newBalance := currentBalance - amountToExpire
-		_, err = dbTx.ExecContext(ctx, `
-			UPDATE user_neuron_balance
-			SET balance = $1, updated_at = NOW()
-			WHERE user_id = $2
-		`, newBalance, entry.UserID)
-
-		if err != nil {
-			return 0, fmt.Errorf("ошибка обновления баланса при списании: %w", err)
+		// Отмечаем начисления обработанными, даже если списывать было нечего
+		if entry.WalletID != nil {
+			_, err = dbTx.ExecContext(ctx, `
+				UPDATE neuron_transactions
+				SET expired_at = NOW()
+				WHERE wallet_id = $1 AND expires_at < $2 AND amount > 0 AND expired_at IS NULL
+			`, *entry.WalletID, cutoff)
+		} else {
+			_, err = dbTx.ExecContext(ctx, `
+				UPDATE neuron_transactions
+				SET expired_at = NOW()
+				WHERE user_id = $1 AND wallet_id IS NULL AND expires_at < $2 AND amount > 0 AND expired_at IS NULL
+			`, entry.UserID, cutoff)
 		}
-
-		// Создаем транзакцию списания
-		_, err = dbTx.ExecContext(ctx, `
-			INSERT INTO neuron_transactions (
-				user_id, amount, balance_after, transaction_type, 
-				description, reference_id
-			)
-			VALUES ($1, $2, $3, $4, $5, $6)
-		`, entry.UserID, -amountToExpire, newBalance, TypeAdmin, "Истечение срока действия нейронов", "expire_system")
-
 		if err != nil {
-			return 0, fmt.Errorf("ошибка создания транзакции списания: %w", err)
+			return 0, fmt.Errorf("ошибка отметки истекших начислений: %w", err)
 		}
 	}
 
@@ -521,3 +1203,386 @@ func (r *Repository) ExpireNeurons(ctx context.Context) (int, error) {
 
 	return len(expiredEntries), nil
 }
+
+// CountBalances возвращает количество балансов пользователей
+func (r *Repository) CountBalances(ctx context.Context) (int, error) {
+	var count int
+	if err := r.db.QueryRowContext(ctx, `SELECT COUNT(*) FROM user_neuron_balance`).Scan(&count); err != nil {
+		return 0, fmt.Errorf("ошибка подсчета балансов: %w", err)
+	}
+	return count, nil
+}
+
+// Lifetime метрики по проводкам e с транзакциями t, как в Transaction.LifetimeDelta:
+// проводки возврата уменьшают метрику исходной транзакции
+const (
+	ledgerEarnedSQL = `COALESCE(SUM(e.amount) FILTER (WHERE (e.amount > 0) <> (t.transaction_type = 'refund')), 0)`
+	ledgerSpentSQL  = `COALESCE(-SUM(e.amount) FILTER (WHERE (e.amount < 0) <> (t.transaction_type = 'refund')), 0)`
+)
+
+// FindBalanceDiscrepancies возвращает балансы пользователей, расходящиеся с суммой проводок
+func (r *Repository) FindBalanceDiscrepancies(ctx context.Context) ([]*Discrepancy, error) {
+	query := `
+		SELECT b.user_id, b.balance, b.lifetime_earned, b.lifetime_spent,
+			COALESCE(SUM(e.amount), 0), ` + ledgerEarnedSQL + `, ` + ledgerSpentSQL + `
+		FROM user_neuron_balance b
+		LEFT JOIN ledger_entries e ON e.user_id = b.user_id
+		LEFT JOIN neuron_transactions t ON t.id = e.transaction_id
+		GROUP BY b.user_id, b.balance, b.lifetime_earned, b.lifetime_spent
+		HAVING b.balance <> COALESCE(SUM(e.amount), 0)
+			OR b.lifetime_earned <> ` + ledgerEarnedSQL + `
+			OR b.lifetime_spent <> ` + ledgerSpentSQL + `
+		ORDER BY b.user_id
+	`
+
+	rows, err := r.db.QueryContext(ctx, query)
+	if err != nil {
+		return nil, fmt.Errorf("ошибка сверки балансов: %w", err)
+	}
+	defer rows.Close()
+
+	var discrepancies []*Discrepancy
+	for rows.Next() {
+		var userID, balance, earned, spent, ledgerBalance, ledgerEarned, ledgerSpent int64
+		if err := rows.Scan(&userID, &balance, &earned, &spent, &ledgerBalance, &ledgerEarned, &ledgerSpent); err != nil {
+			return nil, fmt.Errorf("ошибка сканирования сверки баланса: %w", err)
+		}
+
+		fields := []struct {
+			name             string
+			expected, actual int64
+		}{
+			{"balance", ledgerBalance, balance},
+			{"lifetime_earned", ledgerEarned, earned},
+			{"lifetime_spent", ledgerSpent, spent},
+		}
+		for _, f := range fields {
+			if f.expected != f.actual {
+				discrepancies = append(discrepancies, &Discrepancy{
+					Subject:   SubjectUser,
+					SubjectID: userID,
+					Field:     f.name,
+					Expected:  f.expected,
+					Actual:    f.actual,
+				})
+			}
+		}
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("ошибка при итерации сверки балансов: %w", err)
+	}
+
+	return discrepancies, nil
+}
+
+// FindAccountDiscrepancies возвращает системные счета, баланс которых расходится с суммой проводок
+func (r *Repository) FindAccountDiscrepancies(ctx context.Context) ([]*Discrepancy, error) {
+	query := `
+		SELECT a.id, a.balance, COALESCE(SUM(e.amount), 0)
+		FROM ledger_accounts a
+		LEFT JOIN ledger_entries e ON e.account_id = a.id
+		GROUP BY a.id, a.balance
+		HAVING a.balance <> COALESCE(SUM(e.amount), 0)
+		ORDER BY a.id
+	`
+
+	rows, err := r.db.QueryContext(ctx, query)
+	if err != nil {
+		return nil, fmt.Errorf("ошибка сверки системных счетов: %w", err)
+	}
+	defer rows.Close()
+
+	var discrepancies []*Discrepancy
+	for rows.Next() {
+		d := &Discrepancy{Subject: SubjectAccount, Field: "balance"}
+		if err := rows.Scan(&d.SubjectID, &d.Actual, &d.Expected); err != nil {
+			return nil, fmt.Errorf("ошибка сканирования сверки счета: %w", err)
+		}
+		discrepancies = append(discrepancies, d)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("ошибка при итерации сверки счетов: %w", err)
+	}
+
+	return discrepancies, nil
+}
+
+// FindWalletDiscrepancies возвращает общие кошельки, балансы которых расходятся с суммой проводок
+func (r *Repository) FindWalletDiscrepancies(ctx context.Context) ([]*Discrepancy, error) {
+	query := `
+		SELECT w.id, w.balance, COALESCE(SUM(e.amount), 0)
+		FROM neuron_wallets w
+		LEFT JOIN ledger_entries e ON e.wallet_id = w.id
+		GROUP BY w.id, w.balance
+		HAVING w.balance <> COALESCE(SUM(e.amount), 0)
+		ORDER BY w.id
+	`
+
+	rows, err := r.db.QueryContext(ctx, query)
+	if err != nil {
+		return nil, fmt.Errorf("ошибка сверки кошельков: %w", err)
+	}
+	defer rows.Close()
+
+	var discrepancies []*Discrepancy
+	for rows.Next() {
+		d := &Discrepancy{Subject: SubjectWallet, Field: "balance"}
+		if err := rows.Scan(&d.SubjectID, &d.Actual, &d.Expected); err != nil {
+			return nil, fmt.Errorf("ошибка сканирования сверки кошелька: %w", err)
+		}
+		discrepancies = append(discrepancies, d)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("ошибка при итерации сверки кошельков: %w", err)
+	}
+
+	return discrepancies, nil
+}
+
+// FindUnbalancedTransactions возвращает транзакции без проводок или с ненулевой суммой проводок.
+// Для транзакций без проводок ожидаемое значение - количество проводок (2)
+func (r *Repository) FindUnbalancedTransactions(ctx context.Context) ([]*Discrepancy, error) {
+	query := `
+		SELECT t.id, COUNT(e.id), COALESCE(SUM(e.amount), 0)
+		FROM neuron_transactions t
+		LEFT JOIN ledger_entries e ON e.transaction_id = t.id
+		WHERE t.amount <> 0
+		GROUP BY t.id
+		HAVING COUNT(e.id) = 0 OR COALESCE(SUM(e.amount), 0) <> 0
+		ORDER BY t.id
+	`
+
+	rows, err := r.db.QueryContext(ctx, query)
+	if err != nil {
+		return nil, fmt.Errorf("ошибка проверки проводок: %w", err)
+	}
+	defer rows.Close()
+
+	var discrepancies []*Discrepancy
+	for rows.Next() {
+		var transactionID, count, sum int64
+		if err := rows.Scan(&transactionID, &count, &sum); err != nil {
+			return nil, fmt.Errorf("ошибка сканирования проверки проводок: %w", err)
+		}
+
+		d := &Discrepancy{Subject: SubjectTransaction, SubjectID: transactionID}
+		if count == 0 {
+			d.Field, d.Expected, d.Actual = "entries", 2, 0
+		} else {
+			d.Field, d.Expected, d.Actual = "entries_sum", 0, sum
+		}
+		discrepancies = append(discrepancies, d)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("ошибка при итерации проверки проводок: %w", err)
+	}
+
+	return discrepancies, nil
+}
+
+// PostMissingEntries создает проводки для транзакции, у которой их нет
+func (r *Repository) PostMissingEntries(ctx context.Context, transactionID int64) error {
+	dbTx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("ошибка начала транзакции: %w", err)
+	}
+	defer dbTx.Rollback()
+
+	tx := &Transaction{}
+	err = dbTx.QueryRowContext(ctx, `
+		SELECT id, user_id, wallet_id, amount, transaction_type, metadata, created_at
+		FROM neuron_transactions
+		WHERE id = $1 AND NOT EXISTS (SELECT 1 FROM ledger_entries WHERE transaction_id = $1)
+		FOR UPDATE
+	`, transactionID).Scan(&tx.ID, &tx.UserID, &tx.WalletID, &tx.Amount, &tx.TransactionType, &tx.Metadata, &tx.CreatedAt)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil // Проводки уже созданы
+		}
+		return fmt.Errorf("ошибка получения транзакции: %w", err)
+	}
+
+	if err := r.postEntries(ctx, dbTx, tx); err != nil {
+		return err
+	}
+
+	if err := dbTx.Commit(); err != nil {
+		return fmt.Errorf("ошибка подтверждения транзакции: %w", err)
+	}
+	return nil
+}
+
+// RepairBalance пересчитывает баланс пользователя по проводкам
+func (r *Repository) RepairBalance(ctx context.Context, userID int64) error {
+	dbTx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("ошибка начала транзакции: %w", err)
+	}
+	defer dbTx.Rollback()
+
+	// Блокируем баланс, чтобы пересчет не пересекся с новой транзакцией
+	var balance int
+	err = dbTx.QueryRowContext(ctx, `
+		SELECT balance FROM user_neuron_balance WHERE user_id = $1 FOR UPDATE
+	`, userID).Scan(&balance)
+	if err != nil {
+		return fmt.Errorf("ошибка получения баланса: %w", err)
+	}
+
+	query := `
+		UPDATE user_neuron_balance b
+		SET balance = l.balance, lifetime_earned = l.earned, lifetime_spent = l.spent, updated_at = NOW()
+		FROM (
+			SELECT COALESCE(SUM(e.amount), 0) AS balance,
+				` + ledgerEarnedSQL + ` AS earned,
+				` + ledgerSpentSQL + ` AS spent
+			FROM ledger_entries e
+			JOIN neuron_transactions t ON t.id = e.transaction_id
+			WHERE e.user_id = $1
+		) l
+		WHERE b.user_id = $1
+	`
+	_, err = dbTx.ExecContext(ctx, query, userID)
+	if err != nil {
+		return fmt.Errorf("ошибка пересчета баланса: %w", err)
+	}
+
+	if err := dbTx.Commit(); err != nil {
+		return fmt.Errorf("ошибка подтверждения транзакции: %w", err)
+	}
+	return nil
+}
+
+// RepairAccount пересчитывает баланс системного счета по проводкам
+func (r *Repository) RepairAccount(ctx context.Context, accountID int64) error {
+	_, err := r.db.ExecContext(ctx, `
+		UPDATE ledger_accounts
+		SET balance = COALESCE((SELECT SUM(amount) FROM ledger_entries WHERE account_id = $1), 0), updated_at = NOW()
+		WHERE id = $1
+	`, accountID)
+	if err != nil {
+		return fmt.Errorf("ошибка пересчета системного счета: %w", err)
+	}
+	return nil
+}
+
+// RepairWallet пересчитывает баланс общего кошелька по проводкам
+func (r *Repository) RepairWallet(ctx context.Context, walletID int64) error {
+	query := `
+		UPDATE neuron_wallets w
+		SET balance = l.balance, lifetime_earned = l.earned, lifetime_spent = l.spent, updated_at = NOW()
+		FROM (
+			SELECT COALESCE(SUM(e.amount), 0) AS balance,
+				` + ledgerEarnedSQL + ` AS earned,
+				` + ledgerSpentSQL + ` AS spent
+			FROM ledger_entries e
+			JOIN neuron_transactions t ON t.id = e.transaction_id
+			WHERE e.wallet_id = $1
+		) l
+		WHERE w.id = $1
+	`
+	_, err := r.db.ExecContext(ctx, query, walletID)
+	if err != nil {
+		return fmt.Errorf("ошибка пересчета баланса кошелька: %w", err)
+	}
+	return nil
+}
+
+// StartReconciliation создает запись о запуске сверки
+func (r *Repository) StartReconciliation(ctx context.Context, repair bool) (int64, error) {
+	var id int64
+	err := r.db.QueryRowContext(ctx, `
+		INSERT INTO ledger_reconciliations (repair) VALUES ($1) RETURNING id
+	`, repair).Scan(&id)
+	if err != nil {
+		return 0, fmt.Errorf("ошибка создания записи сверки: %w", err)
+	}
+	return id, nil
+}
+
+// AddDiscrepancy сохраняет найденное расхождение
+func (r *Repository) AddDiscrepancy(ctx context.Context, reconciliationID int64, d *Discrepancy) error {
+	_, err := r.db.ExecContext(ctx, `
+		INSERT INTO ledger_discrepancies (reconciliation_id, subject, subject_id, field, expected, actual, repaired)
+		VALUES ($1, $2, $3, $4, $5, $6, $7)
+	`, reconciliationID, d.Subject, d.SubjectID, d.Field, d.Expected, d.Actual, d.Repaired)
+	if err != nil {
+		return fmt.Errorf("ошибка сохранения расхождения: %w", err)
+	}
+	return nil
+}
+
+// FinishReconciliation сохраняет итоги сверки
+func (r *Repository) FinishReconciliation(ctx context.Context, report *ReconcileReport) error {
+	_, err := r.db.ExecContext(ctx, `
+		UPDATE ledger_reconciliations
+		SET users_checked = $2, discrepancies = $3, repaired = $4, finished_at = NOW()
+		WHERE id = $1
+	`, report.ID, report.UsersChecked, len(report.Discrepancies), report.Repaired)
+	if err != nil {
+		return fmt.Errorf("ошибка сохранения итогов сверки: %w", err)
+	}
+	return nil
+}
+
+// ListPackages получает все пакеты нейронов, включая отключенные
+func (r *Repository) ListPackages(ctx context.Context) ([]*Package, error) {
+	query := `
+		SELECT id, name, amount, bonus_amount, price, sort_order, is_active, created_at, updated_at
+		FROM neuron_packages
+		ORDER BY sort_order ASC, id ASC
+	`
+
+	rows, err := r.db.QueryContext(ctx, query)
+	if err != nil {
+		return nil, fmt.Errorf("ошибка получения пакетов нейронов: %w", err)
+	}
+	defer rows.Close()
+
+	var packages []*Package
+	for rows.Next() {
+		pkg := &Package{}
+		err := rows.Scan(
+			&pkg.ID,
+			&pkg.Name,
+			&pkg.Amount,
+			&pkg.BonusAmount,
+			&pkg.Price,
+			&pkg.SortOrder,
+			&pkg.IsActive,
+			&pkg.CreatedAt,
+			&pkg.UpdatedAt,
+		)
+		if err != nil {
+			return nil, fmt.Errorf("ошибка сканирования пакета нейронов: %w", err)
+		}
+		packages = append(packages, pkg)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("ошибка при итерации пакетов нейронов: %w", err)
+	}
+
+	return packages, nil
+}
+
+// SetPackageActive включает или отключает пакет нейронов. Возвращает false, если пакет не найден
+func (r *Repository) SetPackageActive(ctx context.Context, packageID int, active bool) (bool, error) {
+	result, err := r.db.ExecContext(ctx, `
+		UPDATE neuron_packages SET is_active = $1, updated_at = NOW() WHERE id = $2
+	`, active, packageID)
+	if err != nil {
+		return false, fmt.Errorf("ошибка изменения доступности пакета: %w", err)
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return false, fmt.Errorf("ошибка получения количества затронутых строк: %w", err)
+	}
+
+	return rowsAffected > 0, nil
+}
@@ -12,6 +12,7 @@ import (
 
 	"go.uber.org/zap"
 
+	"neurobot-prod/internal/events"
 	"neurobot-prod/internal/subscription"
 )
 
@@ -19,6 +20,7 @@ import (
 type Service struct {
 	repo       *Repository
 	subService *subscription.Service
+	events     events.Emitter
 	log        *zap.Logger
 }
 
@@ -31,6 +33,18 @@ func NewService(repo *Repository, subService *subscription.Service, log *zap.Log
 	}
 }
 
+// SetEvents включает публикацию доменных событий
+func (s *Service) SetEvents(emitter events.Emitter) {
+	s.events = emitter
+}
+
+// emit публикует доменное событие, если задана шина событий
+func (s *Service) emit(ctx context.Context, eventType events.Type, userID int64, data map[string]interface{}) {
+	if s.events != nil {
+		s.events.Emit(ctx, events.New(eventType, userID, data))
+	}
+}
+
 // GetBalance получает текущий баланс пользователя
 func (s *Service) GetBalance(ctx context.Context, userID int64) (*Balance, error) {
 	balance, err := s.repo.GetBalance(ctx, userID)
@@ -43,21 +57,12 @@ func (s *Service) GetBalance(ctx context.Context, userID int64) (*Balance, error
 	return balance, nil
 }
 
-// AddDailyNeurons добавляет ежедневные нейроны пользователю
-func (s *Service) AddDailyNeurons(ctx context.Context, userID int64, loyaltyBonusPercent int) (*Transaction, error) {
-	// Получаем баланс пользователя
-	balance, err := s.repo.GetBalance(ctx, userID)
-	if err != nil {
-		return nil, err
-	}
-
-	// Проверяем, можно ли начислить ежедневное вознаграждение
-	if !balance.CanReceiveDailyReward() {
-		return nil, errors.New("ежедневное вознаграждение уже получено")
-	}
-
+// AddDailyNeurons добавляет ежедневные нейроны пользователю. Частоту начислений
+// контролирует вызывающий код (серии ежедневных начислений по дням пользователя),
+// а повтор с тем же ключом идемпотентности возвращает исходное начисление
+func (s *Service) AddDailyNeurons(ctx context.Context, userID int64, bonus DailyBonus, idempotencyKey string) (*Transaction, error) {
 	// Получаем подписку пользователя для определения количества нейронов
-	dailyNeurons, err := s.subService.GetDailyNeurons(ctx, userID, loyaltyBonusPercent)
+	dailyNeurons, err := s.subService.GetDailyNeurons(ctx, userID, bonus.TotalPercent())
 	if err != nil {
 		return nil, err
 	}
@@ -80,14 +85,17 @@ func (s *Service) AddDailyNeurons(ctx context.Context, userID int64, loyaltyBonu
 		TransactionType: TypeDaily,
 		Description:     fmt.Sprintf("Ежедневное начисление: %d нейронов", dailyNeurons),
 		ExpiresAt:       &expiresAt,
+		IdempotencyKey:  idempotencyKey,
 		Metadata: Metadata{
-			"loyalty_bonus_percent": loyaltyBonusPercent,
+			"loyalty_bonus_percent": bonus.LoyaltyPercent,
+			"streak_bonus_percent":  bonus.StreakPercent,
+			"streak":                bonus.Streak,
 			"expiry_days":           neuronExpiryDays,
 			"subscription_plan":     plan.Code,
 		},
 	}
 
-	err = s.repo.AddTransaction(ctx, tx)
+	tx, replayed, err := s.addTransaction(ctx, tx)
 	if err != nil {
 		s.log.Error("Ошибка добавления ежедневных нейронов",
 			zap.Int64("user_id", userID),
@@ -95,17 +103,27 @@ func (s *Service) AddDailyNeurons(ctx context.Context, userID int64, loyaltyBonu
 			zap.Error(err))
 		return nil, fmt.Errorf("ошибка добавления ежедневных нейронов: %w", err)
 	}
+	if replayed {
+		return tx, nil
+	}
 
 	s.log.Info("Добавлены ежедневные нейроны",
 		zap.Int64("user_id", userID),
 		zap.Int("amount", dailyNeurons),
 		zap.Int("balance", tx.BalanceAfter))
 
+	s.emit(ctx, events.DailyClaimed, userID, map[string]interface{}{
+		"transaction_id": tx.ID,
+		"amount":         dailyNeurons,
+		"streak":         bonus.Streak,
+	})
+
 	return tx, nil
 }
 
-// AddNeurons добавляет нейроны на баланс пользователя
-func (s *Service) AddNeurons(ctx context.Context, userID int64, amount int, txType TransactionType, description string, metadata Metadata, referenceID string, expiryDays int) (*Transaction, error) {
+// AddNeurons добавляет нейроны на баланс пользователя. Повтор с тем же ключом
+// идемпотентности возвращает исходную транзакцию без повторного начисления
+func (s *Service) AddNeurons(ctx context.Context, userID int64, amount int, txType TransactionType, description string, metadata Metadata, referenceID, idempotencyKey string, expiryDays int) (*Transaction, error) {
 	if amount <= 0 {
 		return nil, errors.New("сумма должна быть положительной")
 	}
@@ -125,10 +143,11 @@ func (s *Service) AddNeurons(ctx context.Context, userID int64, amount int, txTy
 		Description:     description,
 		ExpiresAt:       expiresAt,
 		ReferenceID:     referenceID,
+		IdempotencyKey:  idempotencyKey,
 		Metadata:        metadata,
 	}
 
-	err := s.repo.AddTransaction(ctx, tx)
+	tx, replayed, err := s.addTransaction(ctx, tx)
 	if err != nil {
 		s.log.Error("Ошибка добавления нейронов",
 			zap.Int64("user_id", userID),
@@ -137,6 +156,9 @@ func (s *Service) AddNeurons(ctx context.Context, userID int64, amount int, txTy
 			zap.Error(err))
 		return nil, fmt.Errorf("ошибка добавления нейронов: %w", err)
 	}
+	if replayed {
+		return tx, nil
+	}
 
 	s.log.Info("Нейроны успешно добавлены",
 		zap.Int64("user_id", userID),
@@ -147,8 +169,9 @@ func (s *Service) AddNeurons(ctx context.Context, userID int64, amount int, txTy
 	return tx, nil
 }
 
-// SpendNeurons списывает нейроны с баланса пользователя
-func (s *Service) SpendNeurons(ctx context.Context, userID int64, amount int, txType TransactionType, description string, metadata Metadata, referenceID string) (*Transaction, error) {
+// SpendNeurons списывает нейроны с баланса пользователя. Повтор с тем же ключом
+// идемпотентности возвращает исходную транзакцию без повторного списания
+func (s *Service) SpendNeurons(ctx context.Context, userID int64, amount int, txType TransactionType, description string, metadata Metadata, referenceID, idempotencyKey string) (*Transaction, error) {
 	if amount <= 0 {
 		return nil, errors.New("сумма должна быть положительной")
 	}
@@ -160,10 +183,11 @@ func (s *Service) SpendNeurons(ctx context.Context, userID int64, amount int, tx
 		TransactionType: txType,
 		Description:     description,
 		ReferenceID:     referenceID,
+		IdempotencyKey:  idempotencyKey,
 		Metadata:        metadata,
 	}
 
-	err := s.repo.AddTransaction(ctx, tx)
+	tx, replayed, err := s.addTransaction(ctx, tx)
 	if err != nil {
 		s.log.Error("Ошибка списания нейронов",
 			zap.Int64("user_id", userID),
@@ -172,6 +196,9 @@ func (s *Service) SpendNeurons(ctx context.Context, userID int64, amount int, tx
 			zap.Error(err))
 		return nil, fmt.Errorf("ошибка списания нейронов: %w", err)
 	}
+	if replayed {
+		return tx, nil
+	}
 
 	s.log.Info("Нейроны успешно списаны",
 		zap.Int64("user_id", userID),
@@ -204,8 +231,26 @@ func (s *Service) GetAvailablePackages(ctx context.Context) ([]*Package, error)
 	return packages, nil
 }
 
-// PurchaseNeuronsPackage обрабатывает покупку пакета нейронов
-func (s *Service) PurchaseNeuronsPackage(ctx context.Context, userID int64, packageID int, paymentID string) (*Transaction, error) {
+// GetPackage возвращает пакет нейронов по ID
+func (s *Service) GetPackage(ctx context.Context, packageID int) (*Package, error) {
+	pkg, err := s.repo.GetPackageByID(ctx, packageID)
+	if err != nil {
+		s.log.Error("Ошибка получения информации о пакете",
+			zap.Int("package_id", packageID),
+			zap.Error(err))
+		return nil, fmt.Errorf("ошибка получения информации о пакете: %w", err)
+	}
+
+	if pkg == nil {
+		return nil, errors.New("пакет не найден")
+	}
+
+	return pkg, nil
+}
+
+// PurchaseNeuronsPackage обрабатывает покупку пакета нейронов. Повторная доставка
+// уведомления об оплате с тем же ключом идемпотентности не начисляет пакет дважды
+func (s *Service) PurchaseNeuronsPackage(ctx context.Context, userID int64, packageID int, paymentID, idempotencyKey string) (*Transaction, error) {
 	// Получаем информацию о пакете
 	pkg, err := s.repo.GetPackageByID(ctx, packageID)
 	if err != nil {
@@ -247,7 +292,7 @@ func (s *Service) PurchaseNeuronsPackage(ctx context.Context, userID int64, pack
 	description := fmt.Sprintf("Покупка пакета '%s' (%d + %d бонус нейронов)",
 		pkg.Name, pkg.Amount, pkg.BonusAmount)
 
-	return s.AddNeurons(ctx, userID, totalAmount, TypePurchase, description, metadata, paymentID, neuronExpiryDays)
+	return s.AddNeurons(ctx, userID, totalAmount, TypePurchase, description, metadata, paymentID, idempotencyKey, neuronExpiryDays)
 }
 
 // HasEnoughNeurons проверяет, достаточно ли у пользователя нейронов
@@ -315,7 +360,8 @@ func (s *Service) RecordLLMUsage(ctx context.Context, userID int64, modelName, r
 
 	// Если запрос не найден в кэше, проверяем баланс и списываем нейроны
 	if neuronsCost > 0 {
-		balance, err := s.repo.GetBalance(ctx, userID)
+		// Запрос оплачивается с личного баланса или из выбранного общего кошелька
+		balance, err := s.GetSpendingBalance(ctx, userID)
 		if err != nil {
 			return nil, err
 		}
@@ -327,6 +373,7 @@ func (s *Service) RecordLLMUsage(ctx context.Context, userID int64, modelName, r
 		// Списываем нейроны
 		tx := &Transaction{
 			UserID:          userID,
+			WalletID:        balance.WalletID,
 			Amount:          -neuronsCost,
 			TransactionType: TypeUsage,
 			Description:     fmt.Sprintf("Использование нейросети %s (%d нейронов)", modelName, neuronsCost),
@@ -350,6 +397,7 @@ func (s *Service) RecordLLMUsage(ctx context.Context, userID int64, modelName, r
 		// Создаем запись использования нейросети
 		usage := &LLMUsage{
 			UserID:           userID,
+			WalletID:         balance.WalletID,
 			ModelName:        modelName,
 			PromptTokens:     promptTokens,
 			CompletionTokens: completionTokens,
@@ -405,6 +453,115 @@ func (s *Service) RecordLLMUsage(ctx context.Context, userID int64, modelName, r
 	return usage, nil
 }
 
+// RecordImageUsage записывает генерацию изображения и списывает нейроны
+func (s *Service) RecordImageUsage(ctx context.Context, userID int64, modelName, prompt, imageURL string, neuronsCost int, metadata Metadata) (*LLMUsage, error) {
+	if metadata == nil {
+		metadata = Metadata{}
+	}
+	metadata["kind"] = "image"
+
+	usage := &LLMUsage{
+		UserID:       userID,
+		ModelName:    modelName,
+		NeuronsCost:  neuronsCost,
+		RequestText:  prompt,
+		ResponseText: imageURL,
+		Metadata:     metadata,
+	}
+
+	// Изображения не кэшируются, поэтому списываем нейроны за каждую генерацию
+	if neuronsCost > 0 {
+		// Генерация оплачивается с личного баланса или из выбранного общего кошелька
+		balance, err := s.GetSpendingBalance(ctx, userID)
+		if err != nil {
+			return nil, err
+		}
+		usage.WalletID = balance.WalletID
+
+		tx := &Transaction{
+			UserID:          userID,
+			WalletID:        balance.WalletID,
+			Amount:          -neuronsCost,
+			TransactionType: TypeUsage,
+			Description:     fmt.Sprintf("Генерация изображения %s (%d нейронов)", modelName, neuronsCost),
+			Metadata: Metadata{
+				"model": modelName,
+				"kind":  "image",
+				"size":  metadata["size"],
+			},
+		}
+
+		if err := s.repo.AddTransaction(ctx, tx); err != nil {
+			s.log.Error("Ошибка списания нейронов за генерацию изображения",
+				zap.Int64("user_id", userID),
+				zap.String("model", modelName),
+				zap.Int("cost", neuronsCost),
+				zap.Error(err))
+			return nil, fmt.Errorf("ошибка списания нейронов: %w", err)
+		}
+
+		usage.TransactionID = &tx.ID
+	}
+
+	if err := s.repo.AddLLMUsage(ctx, usage); err != nil {
+		s.log.Error("Ошибка записи генерации изображения",
+			zap.Int64("user_id", userID),
+			zap.String("model", modelName),
+			zap.Error(err))
+		return nil, fmt.Errorf("ошибка записи использования нейросети: %w", err)
+	}
+
+	s.log.Info("Записана генерация изображения",
+		zap.Int64("user_id", userID),
+		zap.String("model", modelName),
+		zap.Int("cost", neuronsCost))
+
+	return usage, nil
+}
+
+// ReserveUsage заранее списывает нейроны за несколько запросов к нейросети с личного
+// баланса или из выбранного общего кошелька. Неиспользованную часть возвращает RefundPart.
+// Повтор с тем же ключом идемпотентности возвращает исходное списание
+func (s *Service) ReserveUsage(ctx context.Context, userID int64, amount int, description string, metadata Metadata, idempotencyKey string) (*Transaction, error) {
+	if amount <= 0 {
+		return nil, errors.New("сумма должна быть положительной")
+	}
+
+	balance, err := s.GetSpendingBalance(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	tx := &Transaction{
+		UserID:          userID,
+		WalletID:        balance.WalletID,
+		Amount:          -amount,
+		TransactionType: TypeUsage,
+		Description:     description,
+		IdempotencyKey:  idempotencyKey,
+		Metadata:        metadata,
+	}
+
+	tx, replayed, err := s.addTransaction(ctx, tx)
+	if err != nil {
+		s.log.Error("Ошибка резервирования нейронов",
+			zap.Int64("user_id", userID),
+			zap.Int("amount", amount),
+			zap.Error(err))
+		return nil, fmt.Errorf("ошибка резервирования нейронов: %w", err)
+	}
+	if replayed {
+		return tx, nil
+	}
+
+	s.log.Info("Нейроны зарезервированы",
+		zap.Int64("user_id", userID),
+		zap.Int64("transaction_id", tx.ID),
+		zap.Int("amount", amount))
+
+	return tx, nil
+}
+
 // generateRequestHash генерирует хэш запроса для кэширования
 func (s *Service) generateRequestHash(requestText, modelName string) string {
 	// Создаем хэш на основе текста запроса и названия модели
@@ -427,14 +584,14 @@ func (s *Service) GetUserLLMUsageStatistics(ctx context.Context, userID int64) (
 	return stats, nil
 }
 
-// ProcessExpiredNeurons обрабатывает истекшие нейроны
-func (s *Service) ProcessExpiredNeurons(ctx context.Context) error {
+// ProcessExpiredNeurons списывает истекшие нейроны и возвращает количество затронутых пользователей
+func (s *Service) ProcessExpiredNeurons(ctx context.Context) (int, error) {
 	count, err := s.repo.ExpireNeurons(ctx)
 	if err != nil {
 		s.log.Error("Ошибка обработки истекших нейронов", zap.Error(err))
-		return fmt.Errorf("ошибка обработки истекших нейронов: %w", err)
+		return 0, fmt.Errorf("ошибка обработки истекших нейронов: %w", err)
 	}
 
 	s.log.Info("Обработаны истекшие нейроны", zap.Int("user_count", count))
-	return nil
+	return count, nil
 }
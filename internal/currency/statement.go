@@ -0,0 +1,226 @@
+// Выписка по нейронам и статистика использования
+
+package currency
+
+import (
+	"bytes"
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// ExportFormat представляет формат выгрузки выписки
+type ExportFormat string
+
+const (
+	ExportCSV  ExportFormat = "csv"
+	ExportJSON ExportFormat = "json"
+)
+
+// ErrUnknownExportFormat возвращается при запросе выгрузки в неизвестном формате
+var ErrUnknownExportFormat = errors.New("неизвестный формат выгрузки")
+
+// ModelUsage представляет использование одной модели за период
+type ModelUsage struct {
+	ModelName        string `json:"model_name"`
+	Requests         int    `json:"requests"`
+	PromptTokens     int    `json:"prompt_tokens"`
+	CompletionTokens int    `json:"completion_tokens"`
+	NeuronsCost      int    `json:"neurons_cost"`
+}
+
+// TotalTokens возвращает общее количество токенов
+func (u *ModelUsage) TotalTokens() int {
+	return u.PromptTokens + u.CompletionTokens
+}
+
+// MonthlySummary представляет итоги пользователя за месяц
+type MonthlySummary struct {
+	From   time.Time
+	To     time.Time
+	Earned int           // Начислено нейронов
+	Spent  int           // Списано нейронов
+	Models []*ModelUsage // Использование по моделям, самые популярные первыми
+}
+
+// TopModel возвращает самую используемую модель за период или nil, если запросов не было
+func (s *MonthlySummary) TopModel() *ModelUsage {
+	if len(s.Models) == 0 {
+		return nil
+	}
+	return s.Models[0]
+}
+
+// TotalTokens возвращает общее количество токенов за период
+func (s *MonthlySummary) TotalTokens() int {
+	total := 0
+	for _, u := range s.Models {
+		total += u.TotalTokens()
+	}
+	return total
+}
+
+// TransactionPage представляет страницу истории транзакций
+type TransactionPage struct {
+	Transactions []*Transaction
+	Page         int // Номер страницы, начиная с 0
+	PageSize     int
+	Total        int // Всего транзакций
+}
+
+// PageCount возвращает количество страниц
+func (p *TransactionPage) PageCount() int {
+	if p.Total == 0 {
+		return 1
+	}
+	return (p.Total + p.PageSize - 1) / p.PageSize
+}
+
+// HasPrev сообщает, есть ли предыдущая страница
+func (p *TransactionPage) HasPrev() bool {
+	return p.Page > 0
+}
+
+// HasNext сообщает, есть ли следующая страница
+func (p *TransactionPage) HasNext() bool {
+	return p.Page+1 < p.PageCount()
+}
+
+// GetTransactionPage получает страницу истории транзакций. Номер страницы за пределами
+// истории заменяется на последнюю страницу
+func (s *Service) GetTransactionPage(ctx context.Context, userID int64, page, pageSize int) (*TransactionPage, error) {
+	total, err := s.repo.CountTransactions(ctx, userID)
+	if err != nil {
+		s.log.Error("Ошибка подсчета транзакций",
+			zap.Int64("user_id", userID),
+			zap.Error(err))
+		return nil, fmt.Errorf("ошибка получения истории транзакций: %w", err)
+	}
+
+	result := &TransactionPage{Page: page, PageSize: pageSize, Total: total}
+	if result.Page >= result.PageCount() {
+		result.Page = result.PageCount() - 1
+	}
+	if result.Page < 0 {
+		result.Page = 0
+	}
+
+	result.Transactions, err = s.GetTransactionHistory(ctx, userID, pageSize, result.Page*pageSize)
+	if err != nil {
+		return nil, err
+	}
+
+	return result, nil
+}
+
+// GetMonthlySummary возвращает итоги пользователя за календарный месяц, содержащий month
+func (s *Service) GetMonthlySummary(ctx context.Context, userID int64, month time.Time) (*MonthlySummary, error) {
+	from := time.Date(month.Year(), month.Month(), 1, 0, 0, 0, 0, month.Location())
+	to := from.AddDate(0, 1, 0)
+
+	earned, spent, err := s.repo.GetTransactionTotals(ctx, userID, from, to)
+	if err != nil {
+		s.log.Error("Ошибка получения итогов за месяц",
+			zap.Int64("user_id", userID),
+			zap.Error(err))
+		return nil, fmt.Errorf("ошибка получения итогов за месяц: %w", err)
+	}
+
+	models, err := s.repo.GetModelUsage(ctx, userID, from, to)
+	if err != nil {
+		s.log.Error("Ошибка получения использования нейросетей за месяц",
+			zap.Int64("user_id", userID),
+			zap.Error(err))
+		return nil, fmt.Errorf("ошибка получения итогов за месяц: %w", err)
+	}
+
+	return &MonthlySummary{
+		From:   from,
+		To:     to,
+		Earned: earned,
+		Spent:  spent,
+		Models: models,
+	}, nil
+}
+
+// statementEntry представляет строку выписки при выгрузке
+type statementEntry struct {
+	ID           int64           `json:"id"`
+	CreatedAt    time.Time       `json:"created_at"`
+	Type         TransactionType `json:"type"`
+	Amount       int             `json:"amount"`
+	BalanceAfter int             `json:"balance_after"`
+	Description  string          `json:"description"`
+	ExpiresAt    *time.Time      `json:"expires_at,omitempty"`
+	ReferenceID  string          `json:"reference_id,omitempty"`
+}
+
+// ExportStatement выгружает все транзакции пользователя в указанном формате.
+// Служебные данные (метаданные и ключи идемпотентности) в выгрузку не попадают
+func (s *Service) ExportStatement(ctx context.Context, userID int64, format ExportFormat) ([]byte, error) {
+	if format != ExportCSV && format != ExportJSON {
+		return nil, ErrUnknownExportFormat
+	}
+
+	transactions, err := s.repo.GetAllTransactions(ctx, userID)
+	if err != nil {
+		s.log.Error("Ошибка выгрузки транзакций",
+			zap.Int64("user_id", userID),
+			zap.Error(err))
+		return nil, fmt.Errorf("ошибка выгрузки выписки: %w", err)
+	}
+
+	entries := make([]statementEntry, 0, len(transactions))
+	for _, tx := range transactions {
+		entries = append(entries, statementEntry{
+			ID:           tx.ID,
+			CreatedAt:    tx.CreatedAt,
+			Type:         tx.TransactionType,
+			Amount:       tx.Amount,
+			BalanceAfter: tx.BalanceAfter,
+			Description:  tx.Description,
+			ExpiresAt:    tx.ExpiresAt,
+			ReferenceID:  tx.ReferenceID,
+		})
+	}
+
+	if format == ExportJSON {
+		data, err := json.MarshalIndent(entries, "", "  ")
+		if err != nil {
+			return nil, fmt.Errorf("ошибка формирования выписки: %w", err)
+		}
+		return data, nil
+	}
+
+	var buf bytes.Buffer
+	writer := csv.NewWriter(&buf)
+	writer.Write([]string{"id", "created_at", "type", "amount", "balance_after", "description", "expires_at", "reference_id"})
+	for _, e := range entries {
+		expiresAt := ""
+		if e.ExpiresAt != nil {
+			expiresAt = e.ExpiresAt.Format(time.RFC3339)
+		}
+		writer.Write([]string{
+			strconv.FormatInt(e.ID, 10),
+			e.CreatedAt.Format(time.RFC3339),
+			string(e.Type),
+			strconv.Itoa(e.Amount),
+			strconv.Itoa(e.BalanceAfter),
+			e.Description,
+			expiresAt,
+			e.ReferenceID,
+		})
+	}
+	writer.Flush()
+	if err := writer.Error(); err != nil {
+		return nil, fmt.Errorf("ошибка формирования выписки: %w", err)
+	}
+
+	return buf.Bytes(), nil
+}
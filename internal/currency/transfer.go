@@ -0,0 +1,153 @@
+// Переводы нейронов между пользователями
+
+package currency
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"go.uber.org/zap"
+
+	"neurobot-prod/internal/events"
+)
+
+var (
+	// ErrNotTransferable возвращается, если у отправителя недостаточно нейронов, доступных для перевода
+	ErrNotTransferable = errors.New("недостаточно нейронов, доступных для перевода")
+	// ErrTransferLimit возвращается при превышении суточного лимита переводов
+	ErrTransferLimit = errors.New("превышен суточный лимит переводов")
+)
+
+// TransferLimits содержит суточные лимиты переводов отправителя (0 - без ограничений)
+type TransferLimits struct {
+	DailyAmount int // Нейронов за последние 24 часа
+	DailyCount  int // Переводов за последние 24 часа
+}
+
+// TransferRequest представляет запрос на перевод нейронов
+type TransferRequest struct {
+	SenderID       int64
+	RecipientID    int64
+	Amount         int
+	Comment        string
+	Source         string // Откуда отправлен перевод: command, webapp
+	IdempotencyKey string
+	Limits         TransferLimits
+}
+
+// Transfer представляет проведенный перевод: связанные списание и начисление
+type Transfer struct {
+	Debit  *Transaction
+	Credit *Transaction
+}
+
+// Transfer переводит нейроны от одного пользователя другому одной транзакцией БД.
+// Повтор с тем же ключом идемпотентности возвращает уже проведенный перевод
+func (s *Service) Transfer(ctx context.Context, req TransferRequest) (*Transfer, error) {
+	if req.Amount <= 0 {
+		return nil, errors.New("сумма должна быть положительной")
+	}
+	if req.SenderID == req.RecipientID {
+		return nil, errors.New("нельзя перевести нейроны самому себе")
+	}
+
+	if req.IdempotencyKey != "" {
+		if transfer, err := s.findTransfer(ctx, TypeTransfer, req.IdempotencyKey); err != nil || transfer != nil {
+			return transfer, err
+		}
+	}
+
+	metadata := func(counterpartyID int64) Metadata {
+		m := Metadata{"counterparty_id": counterpartyID, "source": req.Source}
+		if req.Comment != "" {
+			m["comment"] = req.Comment
+		}
+		return m
+	}
+
+	debit := &Transaction{
+		UserID:          req.SenderID,
+		Amount:          -req.Amount,
+		TransactionType: TypeTransfer,
+		Description:     fmt.Sprintf("Подарок пользователю (%d нейронов)", req.Amount),
+		IdempotencyKey:  req.IdempotencyKey,
+		Metadata:        metadata(req.RecipientID),
+	}
+	credit := &Transaction{
+		UserID:          req.RecipientID,
+		Amount:          req.Amount,
+		TransactionType: TypeTransfer,
+		Description:     fmt.Sprintf("Подарок от пользователя (%d нейронов)", req.Amount),
+		Metadata:        metadata(req.SenderID),
+	}
+	if req.IdempotencyKey != "" {
+		credit.IdempotencyKey = req.IdempotencyKey + ":credit"
+	}
+
+	err := s.repo.Transfer(ctx, debit, credit, req.Limits)
+	if isConcurrentDuplicate(err, req.IdempotencyKey) {
+		// Перевод с тем же ключом проведен параллельным запросом
+		transfer, findErr := s.findTransfer(ctx, TypeTransfer, req.IdempotencyKey)
+		if findErr != nil {
+			return nil, findErr
+		}
+		if transfer != nil {
+			return transfer, nil
+		}
+	}
+	if err != nil {
+		if !errors.Is(err, ErrNotTransferable) && !errors.Is(err, ErrTransferLimit) {
+			s.log.Error("Ошибка перевода нейронов",
+				zap.Int64("sender_id", req.SenderID),
+				zap.Int64("recipient_id", req.RecipientID),
+				zap.Int("amount", req.Amount),
+				zap.Error(err))
+		}
+		return nil, err
+	}
+
+	s.log.Info("Нейроны переведены",
+		zap.Int64("sender_id", req.SenderID),
+		zap.Int64("recipient_id", req.RecipientID),
+		zap.Int("amount", req.Amount),
+		zap.Int64("debit_id", debit.ID),
+		zap.Int64("credit_id", credit.ID))
+
+	s.emit(ctx, events.NeuronsGifted, req.SenderID, map[string]interface{}{
+		"recipient_id": req.RecipientID,
+		"amount":       req.Amount,
+		"source":       req.Source,
+	})
+
+	return &Transfer{Debit: debit, Credit: credit}, nil
+}
+
+// GetTransfer возвращает перевод, проведенный с указанным ключом идемпотентности, или nil
+func (s *Service) GetTransfer(ctx context.Context, idempotencyKey string) (*Transfer, error) {
+	return s.findTransfer(ctx, TypeTransfer, idempotencyKey)
+}
+
+// findTransfer возвращает проведенный перевод или пополнение кошелька указанного типа
+// по ключу идемпотентности списания
+func (s *Service) findTransfer(ctx context.Context, txType TransactionType, idempotencyKey string) (*Transfer, error) {
+	debit, err := s.repo.GetTransactionByIdempotencyKey(ctx, txType, idempotencyKey)
+	if err != nil || debit == nil {
+		return nil, err
+	}
+	credit, err := s.repo.GetTransactionByIdempotencyKey(ctx, txType, idempotencyKey+":credit")
+	if err != nil {
+		return nil, err
+	}
+	return &Transfer{Debit: debit, Credit: credit}, nil
+}
+
+// GetTransferable возвращает количество нейронов, которые пользователь может подарить
+func (s *Service) GetTransferable(ctx context.Context, userID int64) (int, error) {
+	return s.repo.GetTransferable(ctx, userID)
+}
+
+// GetTransferredToday возвращает сумму и количество подарков пользователя за последние сутки
+func (s *Service) GetTransferredToday(ctx context.Context, userID int64) (int, int, error) {
+	return s.repo.GetTransferredToday(ctx, userID)
+}
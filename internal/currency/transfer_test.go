@@ -0,0 +1,119 @@
+// Тесты переводов нейронов между пользователями
+
+package currency
+
+import (
+	"context"
+	"errors"
+	"testing"
+)
+
+// transfer переводит нейроны с заданными лимитами
+func transfer(service *Service, senderID, recipientID int64, amount int, limits TransferLimits) error {
+	_, err := service.Transfer(context.Background(), TransferRequest{
+		SenderID:    senderID,
+		RecipientID: recipientID,
+		Amount:      amount,
+		Source:      "command",
+		Limits:      limits,
+	})
+	return err
+}
+
+func TestTransferDailyLimit(t *testing.T) {
+	service, db := newTestService(t, 3201, 3202)
+	ctx := context.Background()
+
+	if _, err := service.AddNeurons(ctx, 3201, 500, TypePurchase, "Покупка", nil, "", "", 0); err != nil {
+		t.Fatal(err)
+	}
+
+	amountLimit := TransferLimits{DailyAmount: 100}
+	if err := transfer(service, 3201, 3202, 60, amountLimit); err != nil {
+		t.Fatal(err)
+	}
+	if err := transfer(service, 3201, 3202, 50, amountLimit); !errors.Is(err, ErrTransferLimit) {
+		t.Fatalf("перевод сверх суточной суммы: %v, ожидалась %v", err, ErrTransferLimit)
+	}
+	// Лимит можно выбрать полностью
+	if err := transfer(service, 3201, 3202, 40, amountLimit); err != nil {
+		t.Fatal(err)
+	}
+
+	countLimit := TransferLimits{DailyCount: 2}
+	if err := transfer(service, 3201, 3202, 1, countLimit); !errors.Is(err, ErrTransferLimit) {
+		t.Fatalf("перевод сверх суточного количества: %v, ожидалась %v", err, ErrTransferLimit)
+	}
+
+	// Отклоненные переводы не меняют балансы
+	assertLifetime(t, service, 3201, 400, 500, 100)
+	assertLifetime(t, service, 3202, 100, 100, 0)
+
+	// Лимит считается за последние 24 часа
+	_, err := db.ExecContext(ctx, `
+		UPDATE neuron_transactions SET created_at = created_at - INTERVAL '25 hours' WHERE user_id = $1
+	`, 3201)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := transfer(service, 3201, 3202, 100, amountLimit); err != nil {
+		t.Fatalf("перевод после истечения суток: %v", err)
+	}
+	assertLifetime(t, service, 3201, 300, 500, 200)
+}
+
+func TestTransferOnlyPurchasedNeurons(t *testing.T) {
+	service, _ := newTestService(t, 3203, 3204, 3205)
+	ctx := context.Background()
+
+	if _, err := service.AddNeurons(ctx, 3203, 100, TypeBonus, "Бонус", nil, "", "", 0); err != nil {
+		t.Fatal(err)
+	}
+	purchase, err := service.AddNeurons(ctx, 3203, 50, TypePurchase, "Покупка", nil, "", "", 30)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Срок действия берется из базы, где он хранится с точностью до микросекунды
+	purchase, err = service.repo.GetTransactionByID(ctx, purchase.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Бонусные нейроны не переводятся, хотя баланс позволяет
+	if err := transfer(service, 3203, 3204, 60, TransferLimits{}); !errors.Is(err, ErrNotTransferable) {
+		t.Fatalf("перевод бонусных нейронов: %v, ожидалась %v", err, ErrNotTransferable)
+	}
+
+	result, err := service.Transfer(ctx, TransferRequest{SenderID: 3203, RecipientID: 3204, Amount: 50, Source: "command"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Подаренные нейроны сгорают вместе с купленными нейронами отправителя
+	if result.Credit.ExpiresAt == nil || purchase.ExpiresAt == nil || !result.Credit.ExpiresAt.Equal(*purchase.ExpiresAt) {
+		t.Errorf("срок действия подарка %v, ожидался %v", result.Credit.ExpiresAt, purchase.ExpiresAt)
+	}
+	credit, err := service.repo.GetTransactionByID(ctx, result.Credit.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if credit.ExpiresAt == nil || !credit.ExpiresAt.Equal(*purchase.ExpiresAt) {
+		t.Errorf("сохраненный срок действия подарка %v, ожидался %v", credit.ExpiresAt, purchase.ExpiresAt)
+	}
+
+	// Купленные нейроны подарены, остались только бонусные
+	if transferable, err := service.GetTransferable(ctx, 3203); err != nil || transferable != 0 {
+		t.Errorf("доступно для перевода %d (%v), ожидалось 0", transferable, err)
+	}
+	if err := transfer(service, 3203, 3204, 1, TransferLimits{}); !errors.Is(err, ErrNotTransferable) {
+		t.Errorf("повторный перевод: %v, ожидалась %v", err, ErrNotTransferable)
+	}
+
+	// Полученные в подарок нейроны нельзя передарить
+	if err := transfer(service, 3204, 3205, 10, TransferLimits{}); !errors.Is(err, ErrNotTransferable) {
+		t.Errorf("передаривание подарка: %v, ожидалась %v", err, ErrNotTransferable)
+	}
+
+	assertLifetime(t, service, 3203, 100, 150, 50)
+	assertLifetime(t, service, 3204, 50, 50, 0)
+}
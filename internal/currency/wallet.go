@@ -0,0 +1,148 @@
+// Общие кошельки нейронов
+
+package currency
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"go.uber.org/zap"
+)
+
+var (
+	// ErrWalletNotFound возвращается, если кошелек не существует
+	ErrWalletNotFound = errors.New("кошелек не найден")
+	// ErrNotWalletMember возвращается при попытке потратить нейроны кошелька, участником которого пользователь не является
+	ErrNotWalletMember = errors.New("пользователь не является участником кошелька")
+	// ErrWalletDailyLimit возвращается при превышении суточного лимита участника кошелька
+	ErrWalletDailyLimit = errors.New("превышен суточный лимит трат из кошелька")
+)
+
+// GetWalletBalance возвращает баланс общего кошелька
+func (s *Service) GetWalletBalance(ctx context.Context, walletID int64) (*Balance, error) {
+	balance, err := s.repo.GetWalletBalance(ctx, walletID)
+	if err != nil {
+		s.log.Error("Ошибка получения баланса кошелька",
+			zap.Int64("wallet_id", walletID),
+			zap.Error(err))
+		return nil, fmt.Errorf("ошибка получения баланса кошелька: %w", err)
+	}
+	if balance == nil {
+		return nil, ErrWalletNotFound
+	}
+	return balance, nil
+}
+
+// GetSpendingBalance возвращает баланс, из которого оплачиваются запросы пользователя:
+// выбранный общий кошелек или личный баланс. Для кошелька доступная сумма
+// ограничена остатком суточного лимита участника
+func (s *Service) GetSpendingBalance(ctx context.Context, userID int64) (*Balance, error) {
+	walletID, dailyLimit, err := s.repo.GetSelectedWallet(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	if walletID == nil {
+		return s.repo.GetBalance(ctx, userID)
+	}
+
+	balance, err := s.GetWalletBalance(ctx, *walletID)
+	if err != nil {
+		return nil, err
+	}
+
+	if dailyLimit != nil {
+		spent, err := s.repo.GetWalletSpentTodayByUser(ctx, *walletID, userID)
+		if err != nil {
+			return nil, err
+		}
+		remaining := *dailyLimit - spent
+		if remaining < 0 {
+			remaining = 0
+		}
+		if remaining < balance.Balance {
+			balance.Balance = remaining
+		}
+	}
+
+	return balance, nil
+}
+
+// HasEnoughForRequest проверяет, хватает ли нейронов на запрос к нейросети
+// на балансе, который оплачивает запросы пользователя
+func (s *Service) HasEnoughForRequest(ctx context.Context, userID int64, amount int) (bool, error) {
+	balance, err := s.GetSpendingBalance(ctx, userID)
+	if err != nil {
+		return false, err
+	}
+	return balance.Balance >= amount, nil
+}
+
+// GetWalletSpentToday возвращает траты участников кошелька за последние сутки
+func (s *Service) GetWalletSpentToday(ctx context.Context, walletID int64) (map[int64]int, error) {
+	return s.repo.GetWalletSpentToday(ctx, walletID)
+}
+
+// Deposit переводит купленные нейроны пользователя в общий кошелек. Повтор с тем же
+// ключом идемпотентности возвращает уже проведенное пополнение
+func (s *Service) Deposit(ctx context.Context, userID, walletID int64, amount int, idempotencyKey string) (*Transfer, error) {
+	if amount <= 0 {
+		return nil, errors.New("сумма должна быть положительной")
+	}
+
+	if idempotencyKey != "" {
+		if deposit, err := s.findTransfer(ctx, TypeDeposit, idempotencyKey); err != nil || deposit != nil {
+			return deposit, err
+		}
+	}
+
+	debit := &Transaction{
+		UserID:          userID,
+		Amount:          -amount,
+		TransactionType: TypeDeposit,
+		Description:     fmt.Sprintf("Пополнение общего кошелька (%d нейронов)", amount),
+		IdempotencyKey:  idempotencyKey,
+		Metadata:        Metadata{"wallet_id": walletID},
+	}
+	credit := &Transaction{
+		UserID:          userID,
+		WalletID:        &walletID,
+		Amount:          amount,
+		TransactionType: TypeDeposit,
+		Description:     fmt.Sprintf("Пополнение от участника (%d нейронов)", amount),
+		Metadata:        Metadata{},
+	}
+	if idempotencyKey != "" {
+		credit.IdempotencyKey = idempotencyKey + ":credit"
+	}
+
+	err := s.repo.Deposit(ctx, debit, credit)
+	if isConcurrentDuplicate(err, idempotencyKey) {
+		// Пополнение с тем же ключом проведено параллельным запросом
+		deposit, findErr := s.findTransfer(ctx, TypeDeposit, idempotencyKey)
+		if findErr != nil {
+			return nil, findErr
+		}
+		if deposit != nil {
+			return deposit, nil
+		}
+	}
+	if err != nil {
+		if !errors.Is(err, ErrNotTransferable) && !errors.Is(err, ErrWalletNotFound) {
+			s.log.Error("Ошибка пополнения кошелька",
+				zap.Int64("user_id", userID),
+				zap.Int64("wallet_id", walletID),
+				zap.Int("amount", amount),
+				zap.Error(err))
+		}
+		return nil, err
+	}
+
+	s.log.Info("Кошелек пополнен",
+		zap.Int64("user_id", userID),
+		zap.Int64("wallet_id", walletID),
+		zap.Int("amount", amount),
+		zap.Int("wallet_balance", credit.BalanceAfter))
+
+	return &Transfer{Debit: debit, Credit: credit}, nil
+}
@@ -0,0 +1,138 @@
+// Тесты трат из общего кошелька
+
+package currency
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"testing"
+)
+
+// createTestWallet создает кошелек владельца с участником, для которого кошелек выбран
+// для оплаты запросов, и пополняет его купленными нейронами владельца
+func createTestWallet(t *testing.T, service *Service, db *sql.DB, ownerID, memberID int64, dailyLimit, amount int) int64 {
+	t.Helper()
+	ctx := context.Background()
+
+	var walletID int64
+	if err := db.QueryRowContext(ctx, `
+		INSERT INTO neuron_wallets (name, owner_id) VALUES ('Семья', $1) RETURNING id
+	`, ownerID).Scan(&walletID); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := db.ExecContext(ctx, `
+		INSERT INTO neuron_wallet_members (wallet_id, user_id, role, daily_limit, is_selected)
+		VALUES ($1, $2, 'owner', NULL, false), ($1, $3, 'member', $4, true)
+	`, walletID, ownerID, memberID, dailyLimit); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := service.AddNeurons(ctx, ownerID, amount, TypePurchase, "Покупка", nil, "", "", 0); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := service.Deposit(ctx, ownerID, walletID, amount, "deposit:wallet-test"); err != nil {
+		t.Fatal(err)
+	}
+	return walletID
+}
+
+// assertWalletBalance проверяет баланс кошелька
+func assertWalletBalance(t *testing.T, service *Service, walletID int64, want int) {
+	t.Helper()
+
+	b, err := service.GetWalletBalance(context.Background(), walletID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if b.Balance != want {
+		t.Errorf("баланс кошелька %d, ожидался %d", b.Balance, want)
+	}
+}
+
+func TestWalletDailyLimit(t *testing.T) {
+	service, db := newTestService(t, 3601, 3602)
+	ctx := context.Background()
+	walletID := createTestWallet(t, service, db, 3601, 3602, 50, 200)
+
+	first, err := service.ReserveUsage(ctx, 3602, 30, "Запрос", nil, "usage:3602:1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if first.WalletID == nil || *first.WalletID != walletID {
+		t.Fatalf("списание прошло не из кошелька: %v", first.WalletID)
+	}
+
+	// Повтор возвращает исходное списание, хотя повторное списание превысило бы лимит
+	again, err := service.ReserveUsage(ctx, 3602, 30, "Запрос", nil, "usage:3602:1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if again.ID != first.ID {
+		t.Errorf("повтор создал списание %d, ожидалось %d", again.ID, first.ID)
+	}
+	assertWalletBalance(t, service, walletID, 170)
+
+	// Лимит можно израсходовать полностью, но не больше
+	if _, err := service.ReserveUsage(ctx, 3602, 20, "Запрос", nil, "usage:3602:2"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := service.ReserveUsage(ctx, 3602, 1, "Запрос", nil, "usage:3602:3"); !errors.Is(err, ErrWalletDailyLimit) {
+		t.Fatalf("ошибка %v, ожидалась %v", err, ErrWalletDailyLimit)
+	}
+	assertWalletBalance(t, service, walletID, 150)
+
+	balance, err := service.GetSpendingBalance(ctx, 3602)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if balance.Balance != 0 {
+		t.Errorf("доступно %d нейронов при исчерпанном лимите, ожидалось 0", balance.Balance)
+	}
+}
+
+func TestWalletDailyLimitResets(t *testing.T) {
+	service, db := newTestService(t, 3611, 3612)
+	ctx := context.Background()
+	walletID := createTestWallet(t, service, db, 3611, 3612, 50, 200)
+
+	if _, err := service.ReserveUsage(ctx, 3612, 50, "Запрос", nil, "usage:3612:1"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := service.ReserveUsage(ctx, 3612, 10, "Запрос", nil, "usage:3612:2"); !errors.Is(err, ErrWalletDailyLimit) {
+		t.Fatalf("ошибка %v, ожидалась %v", err, ErrWalletDailyLimit)
+	}
+
+	// Траты старше суток в лимит не входят
+	if _, err := db.ExecContext(ctx, `
+		UPDATE neuron_transactions SET created_at = NOW() - INTERVAL '25 hours'
+		WHERE wallet_id = $1 AND user_id = $2
+	`, walletID, 3612); err != nil {
+		t.Fatal(err)
+	}
+	balance, err := service.GetSpendingBalance(ctx, 3612)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if balance.Balance != 50 {
+		t.Errorf("доступно %d нейронов после смены суток, ожидалось 50", balance.Balance)
+	}
+	if _, err := service.ReserveUsage(ctx, 3612, 50, "Запрос", nil, "usage:3612:3"); err != nil {
+		t.Fatal(err)
+	}
+	assertWalletBalance(t, service, walletID, 100)
+}
+
+func TestWalletSpendByNonMember(t *testing.T) {
+	service, db := newTestService(t, 3621, 3622, 3623)
+	ctx := context.Background()
+	walletID := createTestWallet(t, service, db, 3621, 3622, 50, 200)
+
+	err := service.repo.AddTransaction(ctx, &Transaction{
+		UserID: 3623, WalletID: &walletID, Amount: -10, TransactionType: TypeUsage, Description: "Запрос",
+	})
+	if !errors.Is(err, ErrNotWalletMember) {
+		t.Fatalf("ошибка %v, ожидалась %v", err, ErrNotWalletMember)
+	}
+	assertWalletBalance(t, service, walletID, 200)
+}
@@ -0,0 +1,107 @@
+// Шина доменных событий поверх NATS
+
+package events
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/nats-io/nats.go"
+	"go.uber.org/zap"
+)
+
+// handlerTimeout - максимальное время обработки одного события
+const handlerTimeout = 10 * time.Second
+
+// Emitter публикует доменные события. Ошибки публикации не должны прерывать
+// основную операцию, поэтому реализация только логирует их
+type Emitter interface {
+	Emit(ctx context.Context, event Event)
+}
+
+// Handler обрабатывает доменное событие
+type Handler func(ctx context.Context, event Event) error
+
+// Publisher публикует сообщения в брокер
+type Publisher interface {
+	Publish(ctx context.Context, subject string, data interface{}) error
+}
+
+// Bus публикует события в NATS и доставляет их подписанным обработчикам.
+// События публикуются в тему <prefix>.<тип>, поэтому их можно получать в другом процессе
+type Bus struct {
+	publisher Publisher
+	prefix    string
+	handlers  map[Type][]Handler
+	log       *zap.Logger
+}
+
+// NewBus создает новую шину событий
+func NewBus(publisher Publisher, prefix string, log *zap.Logger) *Bus {
+	return &Bus{
+		publisher: publisher,
+		prefix:    prefix,
+		handlers:  make(map[Type][]Handler),
+		log:       log.Named("event_bus"),
+	}
+}
+
+// Emit публикует событие
+func (b *Bus) Emit(ctx context.Context, event Event) {
+	if event.OccurredAt.IsZero() {
+		event.OccurredAt = time.Now()
+	}
+
+	subject := fmt.Sprintf("%s.%s", b.prefix, event.Type)
+	if err := b.publisher.Publish(ctx, subject, event); err != nil {
+		b.log.Error("Ошибка публикации события",
+			zap.String("type", string(event.Type)),
+			zap.Int64("user_id", event.UserID),
+			zap.Error(err))
+	}
+}
+
+// Subscribe регистрирует обработчик событий указанного типа.
+// Обработчики нужно зарегистрировать до вызова Listen
+func (b *Bus) Subscribe(eventType Type, handler Handler) {
+	b.handlers[eventType] = append(b.handlers[eventType], handler)
+}
+
+// Listen подписывается на события в NATS. Группа очереди гарантирует,
+// что при нескольких экземплярах обработчика каждое событие обработает только один
+func (b *Bus) Listen(nc *nats.Conn, queueGroup string) (*nats.Subscription, error) {
+	sub, err := nc.QueueSubscribe(b.prefix+".>", queueGroup, b.dispatch)
+	if err != nil {
+		return nil, fmt.Errorf("ошибка подписки на события: %w", err)
+	}
+
+	b.log.Info("Подписка на события",
+		zap.String("subject", b.prefix+".>"),
+		zap.String("queue_group", queueGroup))
+
+	return sub, nil
+}
+
+// dispatch разбирает событие и вызывает его обработчики
+func (b *Bus) dispatch(msg *nats.Msg) {
+	var event Event
+	if err := json.Unmarshal(msg.Data, &event); err != nil {
+		b.log.Error("Ошибка разбора события",
+			zap.String("subject", msg.Subject),
+			zap.Error(err))
+		return
+	}
+
+	for _, handler := range b.handlers[event.Type] {
+		ctx, cancel := context.WithTimeout(context.Background(), handlerTimeout)
+		if err := handler(ctx, event); err != nil {
+			b.log.Error("Ошибка обработки события",
+				zap.String("type", string(event.Type)),
+				zap.Int64("user_id", event.UserID),
+				zap.Error(err))
+		}
+		cancel()
+	}
+}
@@ -0,0 +1,65 @@
+// Доменные события
+
+package events
+
+import (
+	"time"
+)
+
+// Type представляет тип доменного события
+type Type string
+
+const (
+	LLMRequestCompleted Type = "llm.request.completed" // Запрос к нейросети выполнен
+	DailyClaimed        Type = "daily.claimed"         // Получены ежедневные нейроны
+	SubscriptionCreated Type = "subscription.created"  // Оформлена подписка
+	ReferralActivated   Type = "referral.activated"    // Приглашенный пользователь стал активным
+	CommandUsed         Type = "command.used"          // Пользователь выполнил команду бота
+	NeuronsGifted       Type = "neurons.gifted"        // Пользователь подарил нейроны другому пользователю
+)
+
+// Event представляет доменное событие, связанное с пользователем
+type Event struct {
+	Type       Type                   `json:"type"`
+	UserID     int64                  `json:"user_id"`
+	Data       map[string]interface{} `json:"data,omitempty"`
+	OccurredAt time.Time              `json:"occurred_at"`
+}
+
+// New создает событие с текущим временем
+func New(eventType Type, userID int64, data map[string]interface{}) Event {
+	return Event{
+		Type:       eventType,
+		UserID:     userID,
+		Data:       data,
+		OccurredAt: time.Now(),
+	}
+}
+
+// GetString возвращает строковое значение из данных события
+func (e Event) GetString(key string) string {
+	if v, ok := e.Data[key].(string); ok {
+		return v
+	}
+	return ""
+}
+
+// GetInt возвращает целое значение из данных события.
+// После передачи через JSON числа приходят как float64
+func (e Event) GetInt(key string) int {
+	switch v := e.Data[key].(type) {
+	case int:
+		return v
+	case int64:
+		return int(v)
+	case float64:
+		return int(v)
+	}
+	return 0
+}
+
+// GetBool возвращает логическое значение из данных события
+func (e Event) GetBool(key string) bool {
+	v, _ := e.Data[key].(bool)
+	return v
+}
@@ -0,0 +1,235 @@
+// Сервис подарков нейронов
+
+package gift
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"go.uber.org/zap"
+
+	"neurobot-prod/internal/config"
+	"neurobot-prod/internal/currency"
+	"neurobot-prod/internal/subscription"
+	"neurobot-prod/internal/user"
+)
+
+var (
+	// ErrDisabled возвращается, если подарки отключены
+	ErrDisabled = errors.New("подарки нейронов отключены")
+	// ErrRecipientNotFound возвращается, если получатель не пользуется ботом
+	ErrRecipientNotFound = errors.New("получатель не найден")
+	// ErrInvalidRecipient возвращается при попытке подарить нейроны себе или боту
+	ErrInvalidRecipient = errors.New("этому пользователю нельзя подарить нейроны")
+	// ErrAmountTooSmall возвращается, если сумма подарка меньше минимальной
+	ErrAmountTooSmall = errors.New("сумма подарка меньше минимальной")
+	// ErrAccountTooNew возвращается, если с регистрации отправителя прошло слишком мало времени
+	ErrAccountTooNew = errors.New("подарки доступны не сразу после регистрации")
+	// ErrNotAvailableOnPlan возвращается, если план подписки не позволяет дарить нейроны
+	ErrNotAvailableOnPlan = errors.New("подарки недоступны в текущем плане")
+)
+
+// Источники подарков
+const (
+	SourceCommand = "command" // Команда /gift
+	SourceWebApp  = "webapp"  // Mini App
+)
+
+// Notifier отправляет получателю уведомление о подарке
+type Notifier func(userID int64, text string)
+
+// Preview содержит проверенные параметры подарка для подтверждения отправителем
+type Preview struct {
+	Recipient    *user.UserDTO
+	Amount       int
+	Transferable int // Нейронов доступно для подарка
+	DailyLimit   int // Суточный лимит плана в нейронах
+	SentToday    int // Подарено за последние сутки
+}
+
+// Service управляет подарками нейронов между пользователями
+type Service struct {
+	currencyService *currency.Service
+	subService      *subscription.Service
+	userService     *user.Service
+	config          config.GiftConfig
+	notify          Notifier
+	log             *zap.Logger
+}
+
+// NewService создает новый сервис подарков
+func NewService(currencyService *currency.Service, subService *subscription.Service, userService *user.Service, cfg config.GiftConfig, log *zap.Logger) *Service {
+	return &Service{
+		currencyService: currencyService,
+		subService:      subService,
+		userService:     userService,
+		config:          cfg,
+		log:             log.Named("gift_service"),
+	}
+}
+
+// SetNotifier устанавливает функцию уведомления получателей
+func (s *Service) SetNotifier(notify Notifier) {
+	s.notify = notify
+}
+
+// GetConfig возвращает настройки подарков
+func (s *Service) GetConfig() config.GiftConfig {
+	return s.config
+}
+
+// Preview проверяет подарок и возвращает его параметры. Нейроны не списываются
+func (s *Service) Preview(ctx context.Context, senderID int64, recipientUsername string, amount int) (*Preview, error) {
+	recipient, err := s.userService.GetUserByUsername(ctx, recipientUsername)
+	if err != nil {
+		return nil, err
+	}
+	if recipient == nil {
+		return nil, ErrRecipientNotFound
+	}
+
+	return s.check(ctx, senderID, recipient, amount)
+}
+
+// Send дарит нейроны пользователю. Ключ идемпотентности защищает от повторной отправки
+// того же подарка, например при повторном нажатии кнопки подтверждения
+func (s *Service) Send(ctx context.Context, senderID, recipientID int64, amount int, comment, source, idempotencyKey string) (*currency.Transfer, error) {
+	// Повтор уже отправленного подарка не проверяет лимиты заново: подарок сам входит в суточную сумму
+	if idempotencyKey != "" {
+		transfer, err := s.currencyService.GetTransfer(ctx, idempotencyKey)
+		if err != nil {
+			return nil, err
+		}
+		if transfer != nil {
+			if transfer.Debit.UserID != senderID {
+				return nil, currency.ErrIdempotencyKeyReused
+			}
+			return transfer, nil
+		}
+	}
+
+	recipient, err := s.userService.GetUserByTelegramID(ctx, recipientID)
+	if err != nil {
+		return nil, ErrRecipientNotFound
+	}
+
+	preview, err := s.check(ctx, senderID, recipient, amount)
+	if err != nil {
+		return nil, err
+	}
+
+	transfer, err := s.currencyService.Transfer(ctx, currency.TransferRequest{
+		SenderID:       senderID,
+		RecipientID:    recipientID,
+		Amount:         amount,
+		Comment:        comment,
+		Source:         source,
+		IdempotencyKey: idempotencyKey,
+		Limits: currency.TransferLimits{
+			DailyAmount: preview.DailyLimit,
+			DailyCount:  s.config.MaxPerDay,
+		},
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	s.log.Info("Нейроны подарены",
+		zap.Int64("sender_id", senderID),
+		zap.Int64("recipient_id", recipientID),
+		zap.Int("amount", amount),
+		zap.String("source", source))
+
+	text := fmt.Sprintf("🎁 Вам подарили %d нейронов!", amount)
+	if comment != "" {
+		text += "\n💬 " + comment
+	}
+	if transfer.Credit != nil && transfer.Credit.ExpiresAt != nil {
+		text += fmt.Sprintf("\n⏳ Действуют до %s.", transfer.Credit.ExpiresAt.Format("02.01.2006"))
+	}
+	s.sendNotification(recipientID, text)
+
+	return transfer, nil
+}
+
+// check проверяет ограничения подарка: настройки, получателя, возраст аккаунта,
+// лимиты плана и количество нейронов, доступных для подарка
+func (s *Service) check(ctx context.Context, senderID int64, recipient *user.UserDTO, amount int) (*Preview, error) {
+	if !s.config.Enabled {
+		return nil, ErrDisabled
+	}
+	if recipient.TelegramID == senderID || recipient.IsBot {
+		return nil, ErrInvalidRecipient
+	}
+	if amount < s.config.MinAmount || amount <= 0 {
+		return nil, ErrAmountTooSmall
+	}
+
+	// Новые аккаунты не могут дарить нейроны, чтобы их нельзя было использовать для вывода бонусов
+	sender, err := s.userService.GetUserByTelegramID(ctx, senderID)
+	if err != nil {
+		return nil, err
+	}
+	if time.Since(sender.CreatedAt) < time.Duration(s.config.MinAccountAgeDays)*24*time.Hour {
+		return nil, ErrAccountTooNew
+	}
+
+	plan, err := s.subService.GetSubscriptionPlan(ctx, senderID)
+	if err != nil {
+		return nil, err
+	}
+	dailyLimit := plan.GetGiftDailyLimit()
+	if dailyLimit <= 0 {
+		return nil, ErrNotAvailableOnPlan
+	}
+
+	sentToday, sentCount, err := s.currencyService.GetTransferredToday(ctx, senderID)
+	if err != nil {
+		return nil, err
+	}
+	if sentToday+amount > dailyLimit || (s.config.MaxPerDay > 0 && sentCount >= s.config.MaxPerDay) {
+		return nil, currency.ErrTransferLimit
+	}
+
+	transferable, err := s.currencyService.GetTransferable(ctx, senderID)
+	if err != nil {
+		return nil, err
+	}
+	if transferable < amount {
+		return nil, currency.ErrNotTransferable
+	}
+
+	return &Preview{
+		Recipient:    recipient,
+		Amount:       amount,
+		Transferable: transferable,
+		DailyLimit:   dailyLimit,
+		SentToday:    sentToday,
+	}, nil
+}
+
+// Limits возвращает суточный лимит плана, сумму подарков за сутки и количество нейронов, доступных для подарка
+func (s *Service) Limits(ctx context.Context, senderID int64) (dailyLimit, sentToday, transferable int, err error) {
+	plan, err := s.subService.GetSubscriptionPlan(ctx, senderID)
+	if err != nil {
+		return 0, 0, 0, err
+	}
+	sentToday, _, err = s.currencyService.GetTransferredToday(ctx, senderID)
+	if err != nil {
+		return 0, 0, 0, err
+	}
+	transferable, err = s.currencyService.GetTransferable(ctx, senderID)
+	if err != nil {
+		return 0, 0, 0, err
+	}
+	return plan.GetGiftDailyLimit(), sentToday, transferable, nil
+}
+
+// sendNotification отправляет уведомление пользователю, если задан способ уведомления
+func (s *Service) sendNotification(userID int64, text string) {
+	if s.notify != nil {
+		s.notify(userID, text)
+	}
+}
@@ -0,0 +1,190 @@
+// Встроенные инструменты для нейросетей
+
+package llm
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"neurobot-prod/internal/currency"
+)
+
+// RegisterBuiltinTools регистрирует встроенные инструменты бота
+func RegisterBuiltinTools(registry *ToolRegistry, neuronService *currency.Service) {
+	registry.Register(Tool{
+		Name:        "get_balance",
+		Description: "Возвращает текущий баланс нейронов пользователя, а также сколько нейронов он заработал и потратил за все время.",
+		Parameters: map[string]interface{}{
+			"type":       "object",
+			"properties": map[string]interface{}{},
+		},
+	}, func(ctx context.Context, userID int64, arguments json.RawMessage) (string, error) {
+		balance, err := neuronService.GetBalance(ctx, userID)
+		if err != nil {
+			return "", fmt.Errorf("ошибка получения баланса: %w", err)
+		}
+		return fmt.Sprintf("Баланс: %d нейронов. Всего заработано: %d. Всего потрачено: %d.",
+			balance.Balance, balance.LifetimeEarned, balance.LifetimeSpent), nil
+	})
+
+	registry.Register(Tool{
+		Name:        "current_time",
+		Description: "Возвращает текущие дату и время. Можно указать часовой пояс IANA, например Europe/Moscow.",
+		Parameters: map[string]interface{}{
+			"type": "object",
+			"properties": map[string]interface{}{
+				"timezone": map[string]interface{}{
+					"type":        "string",
+					"description": "Часовой пояс IANA, по умолчанию Europe/Moscow",
+				},
+			},
+		},
+	}, currentTimeTool)
+
+	registry.Register(Tool{
+		Name:        "convert_units",
+		Description: "Точно переводит значение из одной единицы измерения в другую (длина, масса, объем, температура).",
+		Parameters: map[string]interface{}{
+			"type": "object",
+			"properties": map[string]interface{}{
+				"value": map[string]interface{}{
+					"type":        "number",
+					"description": "Исходное значение",
+				},
+				"from": map[string]interface{}{
+					"type":        "string",
+					"description": "Исходная единица: mm, cm, m, km, in, ft, yd, mi, mg, g, kg, t, oz, lb, ml, l, gal, c, f, k",
+				},
+				"to": map[string]interface{}{
+					"type":        "string",
+					"description": "Целевая единица из того же списка",
+				},
+			},
+			"required": []string{"value", "from", "to"},
+		},
+	}, convertUnitsTool)
+}
+
+// currentTimeTool возвращает текущее время в указанном часовом поясе
+func currentTimeTool(ctx context.Context, userID int64, arguments json.RawMessage) (string, error) {
+	var args struct {
+		Timezone string `json:"timezone"`
+	}
+	if err := json.Unmarshal(arguments, &args); err != nil {
+		return "", fmt.Errorf("некорректные аргументы: %w", err)
+	}
+
+	if args.Timezone == "" {
+		args.Timezone = "Europe/Moscow"
+	}
+
+	location, err := time.LoadLocation(args.Timezone)
+	if err != nil {
+		return "", fmt.Errorf("неизвестный часовой пояс %s", args.Timezone)
+	}
+
+	return time.Now().In(location).Format("2006-01-02 15:04:05 MST (Monday)"), nil
+}
+
+// unitInfo описывает единицу измерения: категорию и множитель к базовой единице категории
+type unitInfo struct {
+	category string
+	factor   float64
+}
+
+// convertibleUnits содержит поддерживаемые единицы (кроме температуры)
+var convertibleUnits = map[string]unitInfo{
+	// Длина (базовая единица - метр)
+	"mm": {"length", 0.001},
+	"cm": {"length", 0.01},
+	"m":  {"length", 1},
+	"km": {"length", 1000},
+	"in": {"length", 0.0254},
+	"ft": {"length", 0.3048},
+	"yd": {"length", 0.9144},
+	"mi": {"length", 1609.344},
+	// Масса (базовая единица - килограмм)
+	"mg": {"mass", 0.000001},
+	"g":  {"mass", 0.001},
+	"kg": {"mass", 1},
+	"t":  {"mass", 1000},
+	"oz": {"mass", 0.028349523125},
+	"lb": {"mass", 0.45359237},
+	// Объем (базовая единица - литр)
+	"ml":  {"volume", 0.001},
+	"l":   {"volume", 1},
+	"gal": {"volume", 3.785411784},
+}
+
+// convertUnitsTool переводит значение между единицами измерения
+func convertUnitsTool(ctx context.Context, userID int64, arguments json.RawMessage) (string, error) {
+	var args struct {
+		Value float64 `json:"value"`
+		From  string  `json:"from"`
+		To    string  `json:"to"`
+	}
+	if err := json.Unmarshal(arguments, &args); err != nil {
+		return "", fmt.Errorf("некорректные аргументы: %w", err)
+	}
+
+	from := strings.ToLower(strings.TrimSpace(args.From))
+	to := strings.ToLower(strings.TrimSpace(args.To))
+
+	var result float64
+	if isTemperatureUnit(from) || isTemperatureUnit(to) {
+		if !isTemperatureUnit(from) || !isTemperatureUnit(to) {
+			return "", fmt.Errorf("нельзя перевести %s в %s", args.From, args.To)
+		}
+		result = fromKelvin(toKelvin(args.Value, from), to)
+	} else {
+		fromUnit, ok := convertibleUnits[from]
+		if !ok {
+			return "", fmt.Errorf("неизвестная единица измерения %s", args.From)
+		}
+		toUnit, ok := convertibleUnits[to]
+		if !ok {
+			return "", fmt.Errorf("неизвестная единица измерения %s", args.To)
+		}
+		if fromUnit.category != toUnit.category {
+			return "", fmt.Errorf("нельзя перевести %s в %s", args.From, args.To)
+		}
+		result = args.Value * fromUnit.factor / toUnit.factor
+	}
+
+	return fmt.Sprintf("%s %s = %s %s",
+		strconv.FormatFloat(args.Value, 'f', -1, 64), args.From,
+		strconv.FormatFloat(result, 'f', 6, 64), args.To), nil
+}
+
+// isTemperatureUnit проверяет, является ли единица единицей температуры
+func isTemperatureUnit(unit string) bool {
+	return unit == "c" || unit == "f" || unit == "k"
+}
+
+// toKelvin переводит температуру в кельвины
+func toKelvin(value float64, unit string) float64 {
+	switch unit {
+	case "c":
+		return value + 273.15
+	case "f":
+		return (value-32)*5/9 + 273.15
+	default:
+		return value
+	}
+}
+
+// fromKelvin переводит температуру из кельвинов
+func fromKelvin(value float64, unit string) float64 {
+	switch unit {
+	case "c":
+		return value - 273.15
+	case "f":
+		return (value-273.15)*9/5 + 32
+	default:
+		return value
+	}
+}
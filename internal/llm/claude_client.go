@@ -30,26 +30,42 @@ type ClaudeRequest struct {
 	MaxTokens   int             `json:"max_tokens,omitempty"`
 	Temperature float64         `json:"temperature,omitempty"`
 	System      string          `json:"system,omitempty"`
+	Tools       []ClaudeTool    `json:"tools,omitempty"`
 }
 
 // ClaudeMessage представляет сообщение для API Claude
 type ClaudeMessage struct {
-	Role    string `json:"role"`
-	Content string `json:"content"`
+	Role    string      `json:"role"`
+	Content interface{} `json:"content"` // Строка или список блоков ClaudeContentBlock
+}
+
+// ClaudeContentBlock представляет блок содержимого сообщения Claude
+type ClaudeContentBlock struct {
+	Type      string          `json:"type"` // text, tool_use, tool_result
+	Text      string          `json:"text,omitempty"`
+	ID        string          `json:"id,omitempty"`
+	Name      string          `json:"name,omitempty"`
+	Input     json.RawMessage `json:"input,omitempty"`
+	ToolUseID string          `json:"tool_use_id,omitempty"`
+	Content   string          `json:"content,omitempty"`
+}
+
+// ClaudeTool представляет описание инструмента для API Claude
+type ClaudeTool struct {
+	Name        string                 `json:"name"`
+	Description string                 `json:"description,omitempty"`
+	InputSchema map[string]interface{} `json:"input_schema"`
 }
 
 // ClaudeResponse представляет ответ от API Claude
 type ClaudeResponse struct {
-	ID      string `json:"id"`
-	Type    string `json:"type"`
-	Role    string `json:"role"`
-	Content []struct {
-		Type string `json:"type"`
-		Text string `json:"text"`
-	} `json:"content"`
-	Model        string `json:"model"`
-	StopReason   string `json:"stop_reason"`
-	StopSequence string `json:"stop_sequence"`
+	ID           string               `json:"id"`
+	Type         string               `json:"type"`
+	Role         string               `json:"role"`
+	Content      []ClaudeContentBlock `json:"content"`
+	Model        string               `json:"model"`
+	StopReason   string               `json:"stop_reason"`
+	StopSequence string               `json:"stop_sequence"`
 	Usage        struct {
 		InputTokens  int `json:"input_tokens"`
 		OutputTokens int `json:"output_tokens"`
@@ -76,30 +92,74 @@ func (c *ClaudeClient) ProcessRequest(ctx context.Context, request *Request) (*R
 	var claudeMessages []ClaudeMessage
 
 	// Добавляем историю сообщений, если она есть
-	if len(request.MessageHistory) > 0 {
-		for _, msg := range request.MessageHistory {
-			claudeRole := msg.Role
-			if claudeRole == "assistant" {
-				claudeRole = "assistant"
-			} else if claudeRole == "system" {
-				// Системные сообщения обрабатываются отдельно в Claude
-				continue
-			} else {
-				claudeRole = "user"
+	for _, msg := range request.MessageHistory {
+		switch {
+		case msg.Role == "system":
+			// Системные сообщения обрабатываются отдельно в Claude
+			continue
+
+		case msg.Role == "tool":
+			block := ClaudeContentBlock{
+				Type:      "tool_result",
+				ToolUseID: msg.ToolCallID,
+				Content:   msg.Content,
+			}
+			// Результаты нескольких инструментов передаются в одном сообщении пользователя
+			if n := len(claudeMessages); n > 0 && claudeMessages[n-1].Role == "user" {
+				if blocks, ok := claudeMessages[n-1].Content.([]ClaudeContentBlock); ok {
+					claudeMessages[n-1].Content = append(blocks, block)
+					continue
+				}
 			}
+			claudeMessages = append(claudeMessages, ClaudeMessage{
+				Role:    "user",
+				Content: []ClaudeContentBlock{block},
+			})
 
+		case msg.Role == "assistant" && len(msg.ToolCalls) > 0:
+			var blocks []ClaudeContentBlock
+			if msg.Content != "" {
+				blocks = append(blocks, ClaudeContentBlock{Type: "text", Text: msg.Content})
+			}
+			for _, call := range msg.ToolCalls {
+				input := json.RawMessage(call.Arguments)
+				if len(input) == 0 {
+					input = json.RawMessage("{}")
+				}
+				blocks = append(blocks, ClaudeContentBlock{
+					Type:  "tool_use",
+					ID:    call.ID,
+					Name:  call.Name,
+					Input: input,
+				})
+			}
 			claudeMessages = append(claudeMessages, ClaudeMessage{
-				Role:    claudeRole,
+				Role:    "assistant",
+				Content: blocks,
+			})
+
+		case msg.Role == "assistant":
+			claudeMessages = append(claudeMessages, ClaudeMessage{
+				Role:    "assistant",
+				Content: msg.Content,
+			})
+
+		default:
+			claudeMessages = append(claudeMessages, ClaudeMessage{
+				Role:    "user",
 				Content: msg.Content,
 			})
 		}
 	}
 
 	// Добавляем текущее сообщение пользователя
-	claudeMessages = append(claudeMessages, ClaudeMessage{
-		Role:    "user",
-		Content: request.UserMessage,
-	})
+	// (при продолжении после вызова инструментов оно уже находится в истории)
+	if request.UserMessage != "" {
+		claudeMessages = append(claudeMessages, ClaudeMessage{
+			Role:    "user",
+			Content: request.UserMessage,
+		})
+	}
 
 	// Создаем запрос к API Claude
 	claudeReq := ClaudeRequest{
@@ -107,6 +167,15 @@ func (c *ClaudeClient) ProcessRequest(ctx context.Context, request *Request) (*R
 		Messages: claudeMessages,
 	}
 
+	// Добавляем описания инструментов, если они есть
+	for _, tool := range request.Tools {
+		claudeReq.Tools = append(claudeReq.Tools, ClaudeTool{
+			Name:        tool.Name,
+			Description: tool.Description,
+			InputSchema: tool.Parameters,
+		})
+	}
+
 	// Устанавливаем системный промпт, если он есть
 	if request.SystemPrompt != "" {
 		claudeReq.System = request.SystemPrompt
@@ -162,11 +231,19 @@ func (c *ClaudeClient) ProcessRequest(ctx context.Context, request *Request) (*R
 		return nil, fmt.Errorf("ошибка разбора ответа: %w", err)
 	}
 
-	// Извлекаем текст из ответа
+	// Извлекаем текст и вызовы инструментов из ответа
 	var responseText string
+	var toolCalls []ToolCall
 	for _, content := range claudeResp.Content {
-		if content.Type == "text" {
+		switch content.Type {
+		case "text":
 			responseText += content.Text
+		case "tool_use":
+			toolCalls = append(toolCalls, ToolCall{
+				ID:        content.ID,
+				Name:      content.Name,
+				Arguments: string(content.Input),
+			})
 		}
 	}
 
@@ -180,6 +257,7 @@ func (c *ClaudeClient) ProcessRequest(ctx context.Context, request *Request) (*R
 		PromptTokens:     claudeResp.Usage.InputTokens,
 		CompletionTokens: claudeResp.Usage.OutputTokens,
 		TotalTokens:      claudeResp.Usage.InputTokens + claudeResp.Usage.OutputTokens,
+		ToolCalls:        toolCalls,
 		Metadata: map[string]interface{}{
 			"stop_reason":   claudeResp.StopReason,
 			"stop_sequence": claudeResp.StopSequence,
@@ -217,7 +295,7 @@ func (c *ClaudeClient) GetModelInfo() []ModelConfig {
 			MaxTokensContext:  4096,
 			MaxTokensResponse: 2048,
 			NeuronsCost:       1,
-			SupportedFeatures: []string{"chat", "text-completion"},
+			SupportedFeatures: []string{"chat", "text-completion", "tools"},
 			Enabled:           true,
 		},
 		{
@@ -230,7 +308,7 @@ func (c *ClaudeClient) GetModelInfo() []ModelConfig {
 			MaxTokensContext:  8192,
 			MaxTokensResponse: 4096,
 			NeuronsCost:       3,
-			SupportedFeatures: []string{"chat", "text-completion", "reasoning"},
+			SupportedFeatures: []string{"chat", "text-completion", "reasoning", "tools"},
 			Enabled:           true,
 		},
 		{
@@ -243,7 +321,7 @@ func (c *ClaudeClient) GetModelInfo() []ModelConfig {
 			MaxTokensContext:  16384,
 			MaxTokensResponse: 8192,
 			NeuronsCost:       5,
-			SupportedFeatures: []string{"chat", "text-completion", "reasoning", "code-generation"},
+			SupportedFeatures: []string{"chat", "text-completion", "reasoning", "code-generation", "tools"},
 			Enabled:           true,
 		},
 	}
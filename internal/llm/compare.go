@@ -0,0 +1,133 @@
+// Режим сравнения моделей
+
+package llm
+
+import (
+	"context"
+	"sort"
+	"sync"
+
+	"go.uber.org/zap"
+)
+
+// CompareResult представляет ответ одной модели в режиме сравнения
+type CompareResult struct {
+	Model    ModelConfig
+	Response *Response
+	Err      error
+}
+
+// tierRank возвращает порядок уровня модели для сортировки (чем выше, тем мощнее)
+func tierRank(tier ModelTier) int {
+	switch tier {
+	case ModelTierPro:
+		return 3
+	case ModelTierPremium:
+		return 2
+	default:
+		return 1
+	}
+}
+
+// SelectCompareModels выбирает модели для сравнения: самую мощную доступную модель каждого провайдера
+func (s *Service) SelectCompareModels(ctx context.Context, userID int64, maxModels int) ([]ModelConfig, error) {
+	available, err := s.GetAvailableModels(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	sort.Slice(available, func(i, j int) bool {
+		if tierRank(available[i].Tier) != tierRank(available[j].Tier) {
+			return tierRank(available[i].Tier) > tierRank(available[j].Tier)
+		}
+		return available[i].Name < available[j].Name
+	})
+
+	var selected []ModelConfig
+	usedTypes := make(map[ModelType]bool)
+	for _, model := range available {
+		if len(selected) >= maxModels {
+			break
+		}
+		if !model.Enabled || usedTypes[model.Type] {
+			continue
+		}
+		usedTypes[model.Type] = true
+		selected = append(selected, model)
+	}
+
+	return selected, nil
+}
+
+// CompareModelCosts возвращает стоимость запроса к каждой модели сравнения с учетом скидки плана
+func (s *Service) CompareModelCosts(ctx context.Context, userID int64, models []ModelConfig) ([]int, error) {
+	costs := make([]int, len(models))
+	for i, model := range models {
+		cost, err := s.GetRequestCost(ctx, model.Type, model.Name)
+		if err != nil {
+			return nil, err
+		}
+		costs[i] = s.ApplyNeuronDiscount(ctx, userID, cost)
+	}
+	return costs, nil
+}
+
+// EstimateCompareCost возвращает итоговую стоимость сравнения с учетом скидки плана
+func (s *Service) EstimateCompareCost(ctx context.Context, userID int64, models []ModelConfig) (int, error) {
+	costs, err := s.CompareModelCosts(ctx, userID, models)
+	if err != nil {
+		return 0, err
+	}
+	total := 0
+	for _, cost := range costs {
+		total += cost
+	}
+	return total, nil
+}
+
+// Compare параллельно отправляет один запрос нескольким моделям.
+// Ошибка одной модели не прерывает остальные; результаты возвращаются в порядке моделей.
+// Если задан request.PrepaidBy, запросы к моделям не списывают нейроны отдельно
+func (s *Service) Compare(ctx context.Context, request *Request, models []ModelConfig) []CompareResult {
+	results := make([]CompareResult, len(models))
+
+	var wg sync.WaitGroup
+	for i, model := range models {
+		wg.Add(1)
+		go func(i int, model ModelConfig) {
+			defer wg.Done()
+
+			modelRequest := *request
+			modelRequest.ModelType = model.Type
+			modelRequest.ModelName = model.Name
+			// Инструменты отключены, чтобы итоговая стоимость совпадала с показанной пользователю
+			modelRequest.DisableTools = true
+
+			response, err := s.ProcessRequest(ctx, &modelRequest)
+			results[i] = CompareResult{
+				Model:    model,
+				Response: response,
+				Err:      err,
+			}
+		}(i, model)
+	}
+	wg.Wait()
+
+	failed := 0
+	for _, result := range results {
+		if result.Err != nil {
+			failed++
+			s.log.Warn("Модель не ответила в режиме сравнения",
+				zap.Int64("user_id", request.UserID),
+				zap.String("model_name", result.Model.Name),
+				zap.Error(result.Err))
+		}
+	}
+
+	s.log.Info("Сравнение моделей завершено",
+		zap.Int64("user_id", request.UserID),
+		zap.Int("models", len(models)),
+		zap.Int("failed", failed))
+
+	return results
+}
@@ -0,0 +1,243 @@
+// Управление контекстом диалога
+
+package llm
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+
+	"go.uber.org/zap"
+
+	"neurobot-prod/internal/config"
+)
+
+const (
+	// charsPerToken - приблизительное количество символов на один токен
+	charsPerToken = 3
+	// messageTokenOverhead - служебные токены на каждое сообщение (роль, разделители)
+	messageTokenOverhead = 4
+	// summaryMessageMaxChars - максимальная длина одного сообщения при составлении краткого содержания
+	summaryMessageMaxChars = 2000
+)
+
+// summarySystemPrompt - инструкция для модели, составляющей краткое содержание
+const summarySystemPrompt = "Ты составляешь краткое содержание диалога пользователя с ассистентом. " +
+	"Сохрани факты, договоренности, имена, числа и открытые вопросы, которые понадобятся для продолжения диалога. " +
+	"Пиши сжато, от третьего лица, без вступлений."
+
+// summaryProviders - порядок, в котором провайдеры проверяются при выборе модели
+// для краткого содержания, чтобы запасная модель не зависела от порядка обхода карты
+var summaryProviders = []ModelType{ModelTypeOpenAI, ModelTypeGemini, ModelTypeClaude, ModelTypeGrok}
+
+// ContextManager следит, чтобы запрос помещался в контекстное окно модели,
+// сворачивая старую часть истории в краткое содержание
+type ContextManager struct {
+	config  config.ContextConfig
+	clients map[ModelType]ClientInterface
+	log     *zap.Logger
+}
+
+// NewContextManager создает новый менеджер контекста
+func NewContextManager(cfg config.ContextConfig, clients map[ModelType]ClientInterface, log *zap.Logger) *ContextManager {
+	return &ContextManager{
+		config:  cfg,
+		clients: clients,
+		log:     log.Named("context_manager"),
+	}
+}
+
+// EstimateTokens приблизительно оценивает количество токенов в тексте
+func EstimateTokens(text string) int {
+	if text == "" {
+		return 0
+	}
+	return len([]rune(text))/charsPerToken + 1
+}
+
+// EstimateRequestTokens оценивает количество токенов в запросе с учетом истории и промптов
+func EstimateRequestTokens(request *Request) int {
+	tokens := EstimateTokens(request.SystemPrompt) + EstimateTokens(request.ContextSummary)
+	for _, msg := range request.MessageHistory {
+		tokens += EstimateTokens(msg.Content) + messageTokenOverhead
+	}
+	tokens += EstimateTokens(request.UserMessage) + messageTokenOverhead
+	return tokens
+}
+
+// Summary описывает краткое содержание, составленное при подготовке запроса
+type Summary struct {
+	Text             string // Новое краткое содержание
+	Messages         int    // Количество первых сообщений истории, вошедших в краткое содержание
+	ModelType        ModelType
+	ModelName        string
+	RequestText      string // Запрос к модели, составлявшей краткое содержание
+	PromptTokens     int
+	CompletionTokens int
+}
+
+// Prepare возвращает копию запроса, помещающуюся в окно истории и контекстное окно модели.
+// Сообщения сверх окна сворачиваются в краткое содержание, которое возвращается вторым
+// значением (nil, если история не сворачивалась)
+func (m *ContextManager) Prepare(ctx context.Context, request *Request, model ModelConfig) (*Request, *Summary) {
+	prepared := *request
+
+	var summary *Summary
+	prepared.MessageHistory, summary = m.fit(ctx, request, model)
+	if summary != nil {
+		prepared.ContextSummary = summary.Text
+	}
+
+	// Краткое содержание передается модели вместе с системным промптом
+	if prepared.ContextSummary != "" {
+		prepared.SystemPrompt = strings.TrimSpace(prepared.SystemPrompt +
+			"\n\nКраткое содержание предыдущей части диалога:\n" + prepared.ContextSummary)
+	}
+
+	return &prepared, summary
+}
+
+// fit сворачивает старую часть истории, если она не помещается в окно истории запроса
+// или в контекстное окно модели. Возвращает историю для передачи модели и краткое
+// содержание (nil, если история не сворачивалась)
+func (m *ContextManager) fit(ctx context.Context, request *Request, model ModelConfig) ([]Message, *Summary) {
+	history := request.MessageHistory
+
+	keep := len(history)
+	if request.HistoryWindow > 0 && keep > request.HistoryWindow {
+		keep = request.HistoryWindow
+	}
+
+	// Резервируем место под ответ модели
+	responseReserve := model.MaxTokensResponse
+	if request.MaxTokens > 0 {
+		responseReserve = request.MaxTokens
+	}
+	budget := model.MaxTokensContext - responseReserve
+
+	if model.MaxTokensContext > 0 && budget > 0 {
+		trial := *request
+		trial.MessageHistory = history[len(history)-keep:]
+		if keep < len(history) || EstimateRequestTokens(&trial) > budget {
+			// Новое краткое содержание заменит текущее, под него резервируется место
+			trial.ContextSummary = ""
+			for keep > 0 && EstimateRequestTokens(&trial)+m.config.SummaryMaxTokens > budget {
+				keep--
+				trial.MessageHistory = history[len(history)-keep:]
+			}
+		}
+	}
+
+	toSummarize := history[:len(history)-keep]
+	if len(toSummarize) == 0 {
+		return history, nil
+	}
+
+	summary, err := m.summarize(ctx, request.UserID, request.ContextSummary, toSummarize)
+	if err != nil {
+		// Без краткого содержания старые сообщения не передаются модели, чтобы запрос не завершился
+		// ошибкой. Они не отмечаются свернутыми и попадут в краткое содержание при следующем запросе
+		m.log.Warn("Не удалось составить краткое содержание диалога, старые сообщения пропущены",
+			zap.Int64("user_id", request.UserID),
+			zap.Int("skipped_messages", len(toSummarize)),
+			zap.Error(err))
+		return history[len(history)-keep:], nil
+	}
+	summary.Messages = len(toSummarize)
+
+	m.log.Info("Старая часть диалога свернута в краткое содержание",
+		zap.Int64("user_id", request.UserID),
+		zap.String("model_name", model.Name),
+		zap.Int("summarized_messages", len(toSummarize)),
+		zap.Int("kept_messages", keep))
+
+	return history[len(history)-keep:], summary
+}
+
+// summarize составляет краткое содержание сообщений с помощью дешевой базовой модели
+func (m *ContextManager) summarize(ctx context.Context, userID int64, previousSummary string, messages []Message) (*Summary, error) {
+	client, model, err := m.summaryClient()
+	if err != nil {
+		return nil, err
+	}
+
+	var transcript strings.Builder
+	if previousSummary != "" {
+		transcript.WriteString("Ранее составленное краткое содержание:\n")
+		transcript.WriteString(previousSummary)
+		transcript.WriteString("\n\nПродолжение диалога:\n")
+	}
+	for _, msg := range messages {
+		role := "Пользователь"
+		if msg.Role == "assistant" {
+			role = "Ассистент"
+		}
+		content := []rune(msg.Content)
+		if len(content) > summaryMessageMaxChars {
+			content = append(content[:summaryMessageMaxChars], []rune("...")...)
+		}
+		fmt.Fprintf(&transcript, "%s: %s\n", role, string(content))
+	}
+
+	requestText := "Составь обновленное краткое содержание диалога:\n\n" + transcript.String()
+	response, err := client.ProcessRequest(ctx, &Request{
+		UserID:       userID,
+		UserMessage:  requestText,
+		ModelType:    model.Type,
+		ModelName:    model.Name,
+		SystemPrompt: summarySystemPrompt,
+		MaxTokens:    m.config.SummaryMaxTokens,
+		Temperature:  0.3,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("ошибка составления краткого содержания: %w", err)
+	}
+
+	text := strings.TrimSpace(response.ResponseText)
+	if text == "" {
+		return nil, errors.New("модель вернула пустое краткое содержание")
+	}
+
+	return &Summary{
+		Text:             text,
+		ModelType:        model.Type,
+		ModelName:        model.Name,
+		RequestText:      requestText,
+		PromptTokens:     response.PromptTokens,
+		CompletionTokens: response.CompletionTokens,
+	}, nil
+}
+
+// summaryClient возвращает клиент и модель для составления краткого содержания:
+// модель из настроек или, если она недоступна, первую базовую модель провайдеров
+// в порядке summaryProviders
+func (m *ContextManager) summaryClient() (ClientInterface, ModelConfig, error) {
+	var fallback ClientInterface
+	var fallbackModel ModelConfig
+
+	for _, modelType := range summaryProviders {
+		client, ok := m.clients[modelType]
+		if !ok {
+			continue
+		}
+		for _, model := range client.GetModelInfo() {
+			if !model.Enabled {
+				continue
+			}
+			if model.Name == m.config.SummaryModel {
+				return client, model, nil
+			}
+			if fallback == nil && model.Tier == ModelTierBase {
+				fallback = client
+				fallbackModel = model
+			}
+		}
+	}
+
+	if fallback == nil {
+		return nil, ModelConfig{}, errors.New("нет доступной модели для составления краткого содержания")
+	}
+
+	return fallback, fallbackModel, nil
+}
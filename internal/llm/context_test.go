@@ -0,0 +1,193 @@
+// Тесты сворачивания истории диалога
+
+package llm
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+
+	"go.uber.org/zap"
+
+	"neurobot-prod/internal/config"
+)
+
+// fakeClient возвращает заданный ответ и запоминает запросы
+type fakeClient struct {
+	models   []ModelConfig
+	response string
+	err      error
+	requests []*Request
+}
+
+func (c *fakeClient) ProcessRequest(ctx context.Context, request *Request) (*Response, error) {
+	c.requests = append(c.requests, request)
+	if c.err != nil {
+		return nil, c.err
+	}
+	return &Response{ResponseText: c.response, PromptTokens: 100, CompletionTokens: 20}, nil
+}
+
+func (c *fakeClient) GetModelInfo() []ModelConfig {
+	return c.models
+}
+
+func newTestContextManager(client *fakeClient) *ContextManager {
+	return NewContextManager(
+		config.ContextConfig{SummaryModel: "cheap", SummaryMaxTokens: 50},
+		map[ModelType]ClientInterface{ModelTypeOpenAI: client},
+		zap.NewNop(),
+	)
+}
+
+func testHistory(n int) []Message {
+	history := make([]Message, n)
+	for i := range history {
+		role := "user"
+		if i%2 == 1 {
+			role = "assistant"
+		}
+		history[i] = Message{Role: role, Content: strings.Repeat("x", 30)}
+	}
+	return history
+}
+
+func TestPrepareFoldsMessagesOutsideWindow(t *testing.T) {
+	client := &fakeClient{
+		models:   []ModelConfig{{Name: "cheap", Type: ModelTypeOpenAI, Tier: ModelTierBase, Enabled: true}},
+		response: "новое содержание",
+	}
+	m := newTestContextManager(client)
+
+	request := &Request{
+		UserID:         1,
+		UserMessage:    "вопрос",
+		MessageHistory: testHistory(10),
+		ContextSummary: "старое содержание",
+		HistoryWindow:  4,
+	}
+	// Контекстное окно большое: сворачивание вызвано только окном истории
+	prepared, summary := m.Prepare(context.Background(), request, ModelConfig{MaxTokensContext: 100000, MaxTokensResponse: 1000})
+
+	if summary == nil {
+		t.Fatal("ожидалось краткое содержание")
+	}
+	if summary.Messages != 6 {
+		t.Errorf("свернуто %d сообщений, ожидалось 6", summary.Messages)
+	}
+	if len(prepared.MessageHistory) != 4 {
+		t.Errorf("передано %d сообщений, ожидалось 4", len(prepared.MessageHistory))
+	}
+	if summary.ModelName != "cheap" || summary.PromptTokens != 100 || summary.CompletionTokens != 20 {
+		t.Errorf("неверные данные использования модели: %+v", summary)
+	}
+	if !strings.Contains(summary.RequestText, "старое содержание") {
+		t.Error("предыдущее краткое содержание должно входить в запрос")
+	}
+	if prepared.ContextSummary != "новое содержание" || !strings.Contains(prepared.SystemPrompt, "новое содержание") {
+		t.Error("новое краткое содержание не передано модели")
+	}
+	if len(request.MessageHistory) != 10 || request.ContextSummary != "старое содержание" {
+		t.Error("исходный запрос не должен изменяться")
+	}
+}
+
+func TestPrepareWithinWindow(t *testing.T) {
+	client := &fakeClient{
+		models:   []ModelConfig{{Name: "cheap", Type: ModelTypeOpenAI, Tier: ModelTierBase, Enabled: true}},
+		response: "новое содержание",
+	}
+	m := newTestContextManager(client)
+
+	request := &Request{UserMessage: "вопрос", MessageHistory: testHistory(4), HistoryWindow: 4}
+	prepared, summary := m.Prepare(context.Background(), request, ModelConfig{MaxTokensContext: 100000, MaxTokensResponse: 1000})
+
+	if summary != nil || len(client.requests) != 0 {
+		t.Error("история в пределах окна не должна сворачиваться")
+	}
+	if len(prepared.MessageHistory) != 4 {
+		t.Errorf("передано %d сообщений, ожидалось 4", len(prepared.MessageHistory))
+	}
+}
+
+func TestPrepareFoldsOnTokenOverflow(t *testing.T) {
+	client := &fakeClient{
+		models:   []ModelConfig{{Name: "cheap", Type: ModelTypeOpenAI, Tier: ModelTierBase, Enabled: true}},
+		response: "новое содержание",
+	}
+	m := newTestContextManager(client)
+
+	// Каждое сообщение - около 15 токенов, в бюджет 100 - 50 на содержание помещаются 3
+	request := &Request{UserMessage: "вопрос", MessageHistory: testHistory(8), HistoryWindow: 8}
+	prepared, summary := m.Prepare(context.Background(), request, ModelConfig{MaxTokensContext: 200, MaxTokensResponse: 100})
+
+	if summary == nil {
+		t.Fatal("ожидалось краткое содержание")
+	}
+	if summary.Messages+len(prepared.MessageHistory) != 8 {
+		t.Errorf("потеряны сообщения: свернуто %d, передано %d", summary.Messages, len(prepared.MessageHistory))
+	}
+	if EstimateRequestTokens(&Request{UserMessage: "вопрос", MessageHistory: prepared.MessageHistory})+50 > 100 {
+		t.Error("оставшаяся история не помещается в контекстное окно")
+	}
+}
+
+func TestPrepareSummaryFailure(t *testing.T) {
+	client := &fakeClient{
+		models: []ModelConfig{{Name: "cheap", Type: ModelTypeOpenAI, Tier: ModelTierBase, Enabled: true}},
+		err:    errors.New("недоступно"),
+	}
+	m := newTestContextManager(client)
+
+	request := &Request{UserMessage: "вопрос", MessageHistory: testHistory(10), ContextSummary: "старое", HistoryWindow: 4}
+	prepared, summary := m.Prepare(context.Background(), request, ModelConfig{})
+
+	if summary != nil {
+		t.Fatal("при ошибке краткое содержание не возвращается")
+	}
+	if len(prepared.MessageHistory) != 4 {
+		t.Errorf("передано %d сообщений, ожидалось 4", len(prepared.MessageHistory))
+	}
+	if prepared.ContextSummary != "старое" {
+		t.Error("при ошибке должно сохраняться прежнее краткое содержание")
+	}
+	if len(request.MessageHistory) != 10 {
+		t.Error("исходный запрос не должен изменяться")
+	}
+}
+
+func TestSummaryClientPreferenceOrder(t *testing.T) {
+	clients := map[ModelType]ClientInterface{
+		ModelTypeClaude: &fakeClient{models: []ModelConfig{{Name: "claude-base", Type: ModelTypeClaude, Tier: ModelTierBase, Enabled: true}}},
+		ModelTypeGemini: &fakeClient{models: []ModelConfig{{Name: "gemini-base", Type: ModelTypeGemini, Tier: ModelTierBase, Enabled: true}}},
+		ModelTypeGrok:   &fakeClient{models: []ModelConfig{{Name: "grok-mini", Type: ModelTypeGrok, Tier: ModelTierBase, Enabled: true}}},
+		ModelTypeOpenAI: &fakeClient{models: []ModelConfig{{Name: "openai-base", Type: ModelTypeOpenAI, Tier: ModelTierBase, Enabled: false}}},
+	}
+
+	tests := []struct {
+		name         string
+		summaryModel string
+		want         string
+	}{
+		{name: "модель из настроек", summaryModel: "grok-mini", want: "grok-mini"},
+		// Отключенная модель OpenAI пропускается, следующий по порядку провайдер - Gemini
+		{name: "первая доступная базовая модель", summaryModel: "missing", want: "gemini-base"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m := NewContextManager(config.ContextConfig{SummaryModel: tt.summaryModel}, clients, zap.NewNop())
+			// Порядок обхода карты случаен, поэтому выбор проверяется несколько раз
+			for i := 0; i < 20; i++ {
+				_, model, err := m.summaryClient()
+				if err != nil {
+					t.Fatal(err)
+				}
+				if model.Name != tt.want {
+					t.Fatalf("выбрана модель %s, ожидалась %s", model.Name, tt.want)
+				}
+			}
+		})
+	}
+}
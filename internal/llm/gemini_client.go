@@ -26,6 +26,7 @@ type GeminiRequest struct {
 	Contents         []GeminiContent        `json:"contents"`
 	GenerationConfig GeminiGenerationConfig `json:"generationConfig,omitempty"`
 	SafetySettings   []GeminiSafetySetting  `json:"safetySettings,omitempty"`
+	Tools            []GeminiTool           `json:"tools,omitempty"`
 }
 
 // GeminiContent представляет содержимое запроса к Gemini
@@ -36,7 +37,33 @@ type GeminiContent struct {
 
 // GeminiPart представляет часть содержимого запроса к Gemini
 type GeminiPart struct {
-	Text string `json:"text"`
+	Text             string                  `json:"text,omitempty"`
+	FunctionCall     *GeminiFunctionCall     `json:"functionCall,omitempty"`
+	FunctionResponse *GeminiFunctionResponse `json:"functionResponse,omitempty"`
+}
+
+// GeminiFunctionCall представляет вызов функции, запрошенный Gemini
+type GeminiFunctionCall struct {
+	Name string          `json:"name"`
+	Args json.RawMessage `json:"args,omitempty"`
+}
+
+// GeminiFunctionResponse представляет результат вызова функции для Gemini
+type GeminiFunctionResponse struct {
+	Name     string                 `json:"name"`
+	Response map[string]interface{} `json:"response"`
+}
+
+// GeminiTool представляет набор функций, доступных Gemini
+type GeminiTool struct {
+	FunctionDeclarations []GeminiFunctionDeclaration `json:"functionDeclarations"`
+}
+
+// GeminiFunctionDeclaration представляет описание функции для Gemini
+type GeminiFunctionDeclaration struct {
+	Name        string                 `json:"name"`
+	Description string                 `json:"description,omitempty"`
+	Parameters  map[string]interface{} `json:"parameters,omitempty"`
 }
 
 // GeminiGenerationConfig представляет настройки генерации для Gemini
@@ -57,9 +84,7 @@ type GeminiSafetySetting struct {
 type GeminiResponse struct {
 	Candidates []struct {
 		Content struct {
-			Parts []struct {
-				Text string `json:"text"`
-			} `json:"parts"`
+			Parts []GeminiPart `json:"parts"`
 		} `json:"content"`
 		FinishReason string `json:"finishReason"`
 	} `json:"candidates"`
@@ -103,15 +128,46 @@ func (c *GeminiClient) ProcessRequest(ctx context.Context, request *Request) (*R
 	}
 
 	// Добавляем историю сообщений, если она есть
-	if len(request.MessageHistory) > 0 {
-		for _, msg := range request.MessageHistory {
-			role := "user"
-			if msg.Role == "assistant" {
-				role = "model"
+	for _, msg := range request.MessageHistory {
+		switch {
+		case msg.Role == "tool":
+			part := GeminiPart{
+				FunctionResponse: &GeminiFunctionResponse{
+					Name:     msg.Name,
+					Response: map[string]interface{}{"result": msg.Content},
+				},
+			}
+			// Результаты нескольких функций передаются в одном сообщении
+			if n := len(contents); n > 0 && contents[n-1].Role == "function" {
+				contents[n-1].Parts = append(contents[n-1].Parts, part)
+				continue
+			}
+			contents = append(contents, GeminiContent{
+				Role:  "function",
+				Parts: []GeminiPart{part},
+			})
+
+		case msg.Role == "assistant":
+			var parts []GeminiPart
+			if msg.Content != "" {
+				parts = append(parts, GeminiPart{Text: msg.Content})
+			}
+			for _, call := range msg.ToolCalls {
+				parts = append(parts, GeminiPart{
+					FunctionCall: &GeminiFunctionCall{
+						Name: call.Name,
+						Args: json.RawMessage(call.Arguments),
+					},
+				})
 			}
+			contents = append(contents, GeminiContent{
+				Role:  "model",
+				Parts: parts,
+			})
 
+		default:
 			contents = append(contents, GeminiContent{
-				Role: role,
+				Role: "user",
 				Parts: []GeminiPart{
 					{Text: msg.Content},
 				},
@@ -120,12 +176,15 @@ func (c *GeminiClient) ProcessRequest(ctx context.Context, request *Request) (*R
 	}
 
 	// Добавляем текущее сообщение пользователя
-	contents = append(contents, GeminiContent{
-		Role: "user",
-		Parts: []GeminiPart{
-			{Text: request.UserMessage},
-		},
-	})
+	// (при продолжении после вызова инструментов оно уже находится в истории)
+	if request.UserMessage != "" {
+		contents = append(contents, GeminiContent{
+			Role: "user",
+			Parts: []GeminiPart{
+				{Text: request.UserMessage},
+			},
+		})
+	}
 
 	// Создаем запрос к API Gemini
 	geminiReq := GeminiRequest{
@@ -143,6 +202,19 @@ func (c *GeminiClient) ProcessRequest(ctx context.Context, request *Request) (*R
 		},
 	}
 
+	// Добавляем описания инструментов, если они есть
+	if len(request.Tools) > 0 {
+		var declarations []GeminiFunctionDeclaration
+		for _, tool := range request.Tools {
+			declarations = append(declarations, GeminiFunctionDeclaration{
+				Name:        tool.Name,
+				Description: tool.Description,
+				Parameters:  tool.Parameters,
+			})
+		}
+		geminiReq.Tools = []GeminiTool{{FunctionDeclarations: declarations}}
+	}
+
 	// Если температура не указана, устанавливаем по умолчанию
 	if geminiReq.GenerationConfig.Temperature == 0 {
 		geminiReq.GenerationConfig.Temperature = 0.7
@@ -198,8 +270,17 @@ func (c *GeminiClient) ProcessRequest(ctx context.Context, request *Request) (*R
 
 	// Получаем текст ответа
 	var responseText string
-	for _, part := range geminiResp.Candidates[0].Content.Parts {
+	var toolCalls []ToolCall
+	for i, part := range geminiResp.Candidates[0].Content.Parts {
 		responseText += part.Text
+		if part.FunctionCall != nil {
+			// Gemini не присваивает вызовам идентификаторы, поэтому формируем их сами
+			toolCalls = append(toolCalls, ToolCall{
+				ID:        fmt.Sprintf("%s-%d", part.FunctionCall.Name, i),
+				Name:      part.FunctionCall.Name,
+				Arguments: string(part.FunctionCall.Args),
+			})
+		}
 	}
 
 	// Создаем ответ
@@ -212,6 +293,7 @@ func (c *GeminiClient) ProcessRequest(ctx context.Context, request *Request) (*R
 		PromptTokens:     geminiResp.UsageMetadata.PromptTokenCount,
 		CompletionTokens: geminiResp.UsageMetadata.CandidatesTokenCount,
 		TotalTokens:      geminiResp.UsageMetadata.TotalTokenCount,
+		ToolCalls:        toolCalls,
 		Metadata: map[string]interface{}{
 			"finish_reason": geminiResp.Candidates[0].FinishReason,
 		},
@@ -246,7 +328,7 @@ func (c *GeminiClient) GetModelInfo() []ModelConfig {
 			MaxTokensContext:  4096,
 			MaxTokensResponse: 2048,
 			NeuronsCost:       1,
-			SupportedFeatures: []string{"chat", "text-completion"},
+			SupportedFeatures: []string{"chat", "text-completion", "tools"},
 			Enabled:           true,
 		},
 		{
@@ -259,7 +341,7 @@ func (c *GeminiClient) GetModelInfo() []ModelConfig {
 			MaxTokensContext:  8192,
 			MaxTokensResponse: 4096,
 			NeuronsCost:       3,
-			SupportedFeatures: []string{"chat", "text-completion", "reasoning"},
+			SupportedFeatures: []string{"chat", "text-completion", "reasoning", "tools"},
 			Enabled:           true,
 		},
 	}
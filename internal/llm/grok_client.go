@@ -85,10 +85,12 @@ func (c *GrokClient) ProcessRequest(ctx context.Context, request *Request) (*Res
 	}
 
 	// Добавляем текущее сообщение пользователя
-	messages = append(messages, Message{
-		Role:    "user",
-		Content: request.UserMessage,
-	})
+	if request.UserMessage != "" {
+		messages = append(messages, Message{
+			Role:    "user",
+			Content: request.UserMessage,
+		})
+	}
 
 	// Создаем запрос к API Grok
 	grokReq := GrokRequest{
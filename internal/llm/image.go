@@ -0,0 +1,65 @@
+// Генерация изображений
+
+package llm
+
+import (
+	"context"
+	"sort"
+)
+
+// ImageClientInterface определяет интерфейс для клиентов генерации изображений
+type ImageClientInterface interface {
+	GenerateImage(ctx context.Context, request *ImageRequest) (*ImageResponse, error)
+	GetImageModelInfo() []ImageModelConfig
+}
+
+// ImageRequest представляет запрос на генерацию изображения
+type ImageRequest struct {
+	UserID    int64  `json:"user_id"`
+	Prompt    string `json:"prompt"`
+	ModelName string `json:"model_name,omitempty"`
+	Size      string `json:"size,omitempty"` // Например, 1024x1024
+}
+
+// ImageResponse представляет результат генерации изображения
+type ImageResponse struct {
+	UserID        int64                  `json:"user_id"`
+	RequestID     string                 `json:"request_id"`
+	ModelName     string                 `json:"model_name"`
+	Size          string                 `json:"size"`
+	ImageURL      string                 `json:"image_url,omitempty"`
+	ImageData     []byte                 `json:"-"` // Данные изображения, если провайдер вернул base64
+	RevisedPrompt string                 `json:"revised_prompt,omitempty"`
+	NeuronsCost   int                    `json:"neurons_cost"`
+	TransactionID int64                  `json:"transaction_id,omitempty"` // Транзакция списания нейронов, используется для возврата
+	Metadata      map[string]interface{} `json:"metadata,omitempty"`
+}
+
+// ImageModelConfig представляет конфигурацию модели генерации изображений
+type ImageModelConfig struct {
+	ID          string         `json:"id"`
+	Type        ModelType      `json:"type"`
+	Name        string         `json:"name"`
+	DisplayName string         `json:"display_name"`
+	Description string         `json:"description"`
+	Tier        ModelTier      `json:"tier"`
+	DefaultSize string         `json:"default_size"`
+	SizeCosts   map[string]int `json:"size_costs"` // Стоимость одного изображения в нейронах по размерам
+	Enabled     bool           `json:"enabled"`
+}
+
+// GetSizeCost возвращает стоимость изображения указанного размера
+func (m *ImageModelConfig) GetSizeCost(size string) (int, bool) {
+	cost, ok := m.SizeCosts[size]
+	return cost, ok
+}
+
+// GetSizes возвращает отсортированный список поддерживаемых размеров
+func (m *ImageModelConfig) GetSizes() []string {
+	sizes := make([]string, 0, len(m.SizeCosts))
+	for size := range m.SizeCosts {
+		sizes = append(sizes, size)
+	}
+	sort.Strings(sizes)
+	return sizes
+}
@@ -0,0 +1,69 @@
+// Тестовый клиент генерации изображений
+
+package llm
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+	"time"
+
+	"go.uber.org/zap"
+
+	"neurobot-prod/internal/config"
+)
+
+// MockImageClient возвращает изображения-заглушки без обращения к платному API
+type MockImageClient struct {
+	config config.ImageConfig
+	log    *zap.Logger
+}
+
+// NewMockImageClient создает новый тестовый клиент генерации изображений
+func NewMockImageClient(config config.ImageConfig, log *zap.Logger) *MockImageClient {
+	return &MockImageClient{
+		config: config,
+		log:    log.Named("mock_image_client"),
+	}
+}
+
+// GenerateImage возвращает ссылку на изображение-заглушку
+func (c *MockImageClient) GenerateImage(ctx context.Context, request *ImageRequest) (*ImageResponse, error) {
+	size := request.Size
+	if size == "" {
+		size = c.config.DefaultSize
+	}
+
+	c.log.Debug("Генерация тестового изображения",
+		zap.Int64("user_id", request.UserID),
+		zap.String("size", size))
+
+	return &ImageResponse{
+		UserID:        request.UserID,
+		RequestID:     "mock-" + time.Now().Format("20060102150405"),
+		ModelName:     c.config.Model,
+		Size:          size,
+		ImageURL:      fmt.Sprintf("https://placehold.co/%s/png?text=%s", size, url.QueryEscape(request.Prompt)),
+		RevisedPrompt: request.Prompt,
+		Metadata: map[string]interface{}{
+			"provider": "mock",
+		},
+	}, nil
+}
+
+// GetImageModelInfo возвращает информацию о тестовой модели
+func (c *MockImageClient) GetImageModelInfo() []ImageModelConfig {
+	return []ImageModelConfig{
+		{
+			ID:          c.config.Model,
+			Type:        ModelTypeImage,
+			Name:        c.config.Model,
+			DisplayName: "Тестовая генерация изображений",
+			Description: "Возвращает изображения-заглушки",
+			Tier:        ModelTierBase,
+			DefaultSize: c.config.DefaultSize,
+			SizeCosts:   c.config.SizeCosts,
+			Enabled:     true,
+		},
+	}
+}
@@ -14,6 +14,7 @@ const (
 	ModelTypeClaude ModelType = "claude"
 	ModelTypeGrok   ModelType = "grok"
 	ModelTypeGemini ModelType = "gemini"
+	ModelTypeImage  ModelType = "image" // Генерация изображений
 )
 
 // ModelTier представляет уровень модели
@@ -34,6 +35,11 @@ type Request struct {
 	SystemPrompt   string                 `json:"system_prompt,omitempty"`
 	ConversationID string                 `json:"conversation_id,omitempty"`
 	MessageHistory []Message              `json:"message_history,omitempty"`
+	ContextSummary string                 `json:"context_summary,omitempty"` // Краткое содержание предыдущей части диалога
+	HistoryWindow  int                    `json:"history_window,omitempty"`  // Сколько последних сообщений истории передается модели, более старые сворачиваются в краткое содержание
+	Tools          []Tool                 `json:"tools,omitempty"`           // Инструменты, доступные нейросети
+	DisableTools   bool                   `json:"disable_tools,omitempty"`   // Не подключать инструменты (стоимость запроса известна заранее)
+	PrepaidBy      int64                  `json:"prepaid_by,omitempty"`      // Транзакция, которой запрос оплачен заранее: баланс не проверяется, нейроны не списываются
 	MaxTokens      int                    `json:"max_tokens,omitempty"`
 	Temperature    float64                `json:"temperature,omitempty"`
 	Options        map[string]interface{} `json:"options,omitempty"`
@@ -41,24 +47,45 @@ type Request struct {
 
 // Response представляет ответ от нейросети
 type Response struct {
-	UserID           int64                  `json:"user_id"`
-	RequestID        string                 `json:"request_id"`
-	ModelType        ModelType              `json:"model_type"`
-	ModelName        string                 `json:"model_name"`
-	ResponseText     string                 `json:"response_text"`
-	PromptTokens     int                    `json:"prompt_tokens"`
-	CompletionTokens int                    `json:"completion_tokens"`
-	TotalTokens      int                    `json:"total_tokens"`
-	NeuronsCost      int                    `json:"neurons_cost"`
-	Cached           bool                   `json:"cached"`
-	Error            string                 `json:"error,omitempty"`
-	Metadata         map[string]interface{} `json:"metadata,omitempty"`
+	UserID             int64                  `json:"user_id"`
+	RequestID          string                 `json:"request_id"`
+	ModelType          ModelType              `json:"model_type"`
+	ModelName          string                 `json:"model_name"`
+	ResponseText       string                 `json:"response_text"`
+	PromptTokens       int                    `json:"prompt_tokens"`
+	CompletionTokens   int                    `json:"completion_tokens"`
+	TotalTokens        int                    `json:"total_tokens"`
+	NeuronsCost        int                    `json:"neurons_cost"`
+	TransactionID      int64                  `json:"transaction_id,omitempty"` // Транзакция списания нейронов, используется для возврата
+	ToolCalls          []ToolCall             `json:"tool_calls,omitempty"`     // Вызовы инструментов, запрошенные нейросетью
+	Cached             bool                   `json:"cached"`
+	ContextSummary     string                 `json:"context_summary,omitempty"`     // Новое краткое содержание, если старая часть истории была свернута
+	SummarizedMessages int                    `json:"summarized_messages,omitempty"` // Количество первых сообщений истории, вошедших в краткое содержание
+	Error              string                 `json:"error,omitempty"`
+	Metadata           map[string]interface{} `json:"metadata,omitempty"`
 }
 
 // Message представляет сообщение в диалоге
 type Message struct {
-	Role    string `json:"role"`    // system, user, assistant
-	Content string `json:"content"` // текст сообщения
+	Role       string     `json:"role"`                   // system, user, assistant, tool
+	Content    string     `json:"content"`                // текст сообщения
+	ToolCalls  []ToolCall `json:"tool_calls,omitempty"`   // вызовы инструментов в ответе ассистента
+	ToolCallID string     `json:"tool_call_id,omitempty"` // ID вызова, на который отвечает сообщение с ролью tool
+	Name       string     `json:"name,omitempty"`         // название инструмента для сообщения с ролью tool
+}
+
+// Tool представляет описание инструмента, который может вызвать нейросеть
+type Tool struct {
+	Name        string                 `json:"name"`
+	Description string                 `json:"description"`
+	Parameters  map[string]interface{} `json:"parameters"` // JSON Schema параметров
+}
+
+// ToolCall представляет вызов инструмента, запрошенный нейросетью
+type ToolCall struct {
+	ID        string `json:"id"`
+	Name      string `json:"name"`
+	Arguments string `json:"arguments"` // Аргументы в формате JSON
 }
 
 // ModelConfig представляет конфигурацию модели
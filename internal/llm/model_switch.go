@@ -0,0 +1,69 @@
+// Отключение моделей администратором
+
+package llm
+
+import (
+	"context"
+	"sort"
+
+	"go.uber.org/zap"
+)
+
+// ModelSwitch сообщает, какие модели отключены администратором
+type ModelSwitch interface {
+	DisabledModels(ctx context.Context) (map[string]bool, error)
+}
+
+// ModelInfo описывает модель текстовой нейросети или генерации изображений
+type ModelInfo struct {
+	Name        string    `json:"name"`
+	DisplayName string    `json:"display_name"`
+	Type        ModelType `json:"type"`
+}
+
+// SetModelSwitch включает проверку моделей, отключенных администратором
+func (s *Service) SetModelSwitch(modelSwitch ModelSwitch) {
+	s.modelSwitch = modelSwitch
+}
+
+// disabledModels возвращает отключенные модели. Если список получить не удалось,
+// модели считаются включенными, чтобы сбой не останавливал обработку запросов
+func (s *Service) disabledModels(ctx context.Context) map[string]bool {
+	if s.modelSwitch == nil {
+		return nil
+	}
+
+	disabled, err := s.modelSwitch.DisabledModels(ctx)
+	if err != nil {
+		s.log.Warn("Ошибка получения отключенных моделей", zap.Error(err))
+		return nil
+	}
+	return disabled
+}
+
+// ListModels возвращает все модели подключенных провайдеров, отсортированные по типу и названию
+func (s *Service) ListModels() []ModelInfo {
+	var models []ModelInfo
+	for _, client := range s.clients {
+		for _, model := range client.GetModelInfo() {
+			if model.Enabled {
+				models = append(models, ModelInfo{Name: model.Name, DisplayName: model.DisplayName, Type: model.Type})
+			}
+		}
+	}
+	if s.imageClient != nil {
+		for _, model := range s.imageClient.GetImageModelInfo() {
+			if model.Enabled {
+				models = append(models, ModelInfo{Name: model.Name, DisplayName: model.DisplayName, Type: model.Type})
+			}
+		}
+	}
+
+	sort.Slice(models, func(i, j int) bool {
+		if models[i].Type != models[j].Type {
+			return models[i].Type < models[j].Type
+		}
+		return models[i].Name < models[j].Name
+	})
+	return models
+}
@@ -25,15 +25,47 @@ type OpenAIClient struct {
 
 // OpenAIRequest представляет запрос к API OpenAI
 type OpenAIRequest struct {
-	Model       string    `json:"model"`
-	Messages    []Message `json:"messages"`
-	MaxTokens   int       `json:"max_tokens,omitempty"`
-	Temperature float64   `json:"temperature,omitempty"`
-	TopP        float64   `json:"top_p,omitempty"`
-	N           int       `json:"n,omitempty"`
-	Stream      bool      `json:"stream,omitempty"`
-	Stop        []string  `json:"stop,omitempty"`
-	User        string    `json:"user,omitempty"`
+	Model       string          `json:"model"`
+	Messages    []OpenAIMessage `json:"messages"`
+	Tools       []OpenAITool    `json:"tools,omitempty"`
+	MaxTokens   int             `json:"max_tokens,omitempty"`
+	Temperature float64         `json:"temperature,omitempty"`
+	TopP        float64         `json:"top_p,omitempty"`
+	N           int             `json:"n,omitempty"`
+	Stream      bool            `json:"stream,omitempty"`
+	Stop        []string        `json:"stop,omitempty"`
+	User        string          `json:"user,omitempty"`
+}
+
+// OpenAIMessage представляет сообщение для API OpenAI
+type OpenAIMessage struct {
+	Role       string           `json:"role"`
+	Content    string           `json:"content"`
+	ToolCalls  []OpenAIToolCall `json:"tool_calls,omitempty"`
+	ToolCallID string           `json:"tool_call_id,omitempty"`
+}
+
+// OpenAITool представляет описание инструмента для API OpenAI
+type OpenAITool struct {
+	Type     string         `json:"type"`
+	Function OpenAIFunction `json:"function"`
+}
+
+// OpenAIFunction представляет описание функции для API OpenAI
+type OpenAIFunction struct {
+	Name        string                 `json:"name"`
+	Description string                 `json:"description,omitempty"`
+	Parameters  map[string]interface{} `json:"parameters,omitempty"`
+}
+
+// OpenAIToolCall представляет вызов инструмента в API OpenAI
+type OpenAIToolCall struct {
+	ID       string `json:"id"`
+	Type     string `json:"type"`
+	Function struct {
+		Name      string `json:"name"`
+		Arguments string `json:"arguments"`
+	} `json:"function"`
 }
 
 // OpenAIResponse представляет ответ от API OpenAI
@@ -49,8 +81,9 @@ type OpenAIResponse struct {
 	} `json:"usage"`
 	Choices []struct {
 		Message struct {
-			Role    string `json:"role"`
-			Content string `json:"content"`
+			Role      string           `json:"role"`
+			Content   string           `json:"content"`
+			ToolCalls []OpenAIToolCall `json:"tool_calls"`
 		} `json:"message"`
 		FinishReason string `json:"finish_reason"`
 		Index        int    `json:"index"`
@@ -74,26 +107,40 @@ func (c *OpenAIClient) ProcessRequest(ctx context.Context, request *Request) (*R
 	modelName := c.getModelName(request.ModelName)
 
 	// Создаем сообщения для запроса
-	messages := make([]Message, 0)
+	messages := make([]OpenAIMessage, 0)
 
 	// Добавляем системный промпт, если он есть
 	if request.SystemPrompt != "" {
-		messages = append(messages, Message{
+		messages = append(messages, OpenAIMessage{
 			Role:    "system",
 			Content: request.SystemPrompt,
 		})
 	}
 
 	// Добавляем историю сообщений, если она есть
-	if len(request.MessageHistory) > 0 {
-		messages = append(messages, request.MessageHistory...)
+	for _, msg := range request.MessageHistory {
+		openaiMsg := OpenAIMessage{
+			Role:       msg.Role,
+			Content:    msg.Content,
+			ToolCallID: msg.ToolCallID,
+		}
+		for _, call := range msg.ToolCalls {
+			toolCall := OpenAIToolCall{ID: call.ID, Type: "function"}
+			toolCall.Function.Name = call.Name
+			toolCall.Function.Arguments = call.Arguments
+			openaiMsg.ToolCalls = append(openaiMsg.ToolCalls, toolCall)
+		}
+		messages = append(messages, openaiMsg)
 	}
 
 	// Добавляем текущее сообщение пользователя
-	messages = append(messages, Message{
-		Role:    "user",
-		Content: request.UserMessage,
-	})
+	// (при продолжении после вызова инструментов оно уже находится в истории)
+	if request.UserMessage != "" {
+		messages = append(messages, OpenAIMessage{
+			Role:    "user",
+			Content: request.UserMessage,
+		})
+	}
 
 	// Создаем запрос к API OpenAI
 	openaiReq := OpenAIRequest{
@@ -101,6 +148,18 @@ func (c *OpenAIClient) ProcessRequest(ctx context.Context, request *Request) (*R
 		Messages: messages,
 	}
 
+	// Добавляем описания инструментов, если они есть
+	for _, tool := range request.Tools {
+		openaiReq.Tools = append(openaiReq.Tools, OpenAITool{
+			Type: "function",
+			Function: OpenAIFunction{
+				Name:        tool.Name,
+				Description: tool.Description,
+				Parameters:  tool.Parameters,
+			},
+		})
+	}
+
 	// Устанавливаем максимальное количество токенов, если указано
 	if request.MaxTokens > 0 {
 		openaiReq.MaxTokens = request.MaxTokens
@@ -168,6 +227,15 @@ func (c *OpenAIClient) ProcessRequest(ctx context.Context, request *Request) (*R
 		},
 	}
 
+	// Извлекаем вызовы инструментов
+	for _, call := range openaiResp.Choices[0].Message.ToolCalls {
+		response.ToolCalls = append(response.ToolCalls, ToolCall{
+			ID:        call.ID,
+			Name:      call.Function.Name,
+			Arguments: call.Function.Arguments,
+		})
+	}
+
 	return response, nil
 }
 
@@ -199,7 +267,7 @@ func (c *OpenAIClient) GetModelInfo() []ModelConfig {
 			MaxTokensContext:  4096,
 			MaxTokensResponse: 2048,
 			NeuronsCost:       1,
-			SupportedFeatures: []string{"chat", "text-completion"},
+			SupportedFeatures: []string{"chat", "text-completion", "tools"},
 			Enabled:           true,
 		},
 		{
@@ -212,7 +280,7 @@ func (c *OpenAIClient) GetModelInfo() []ModelConfig {
 			MaxTokensContext:  8192,
 			MaxTokensResponse: 4096,
 			NeuronsCost:       3,
-			SupportedFeatures: []string{"chat", "text-completion", "code-generation"},
+			SupportedFeatures: []string{"chat", "text-completion", "code-generation", "tools"},
 			Enabled:           true,
 		},
 		{
@@ -225,7 +293,7 @@ func (c *OpenAIClient) GetModelInfo() []ModelConfig {
 			MaxTokensContext:  16384,
 			MaxTokensResponse: 8192,
 			NeuronsCost:       5,
-			SupportedFeatures: []string{"chat", "text-completion", "code-generation", "reasoning"},
+			SupportedFeatures: []string{"chat", "text-completion", "code-generation", "reasoning", "tools"},
 			Enabled:           true,
 		},
 	}
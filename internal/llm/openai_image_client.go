@@ -0,0 +1,152 @@
+// Клиент OpenAI Images
+
+package llm
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+
+	"go.uber.org/zap"
+
+	"neurobot-prod/internal/config"
+)
+
+// OpenAIImageClient представляет клиент для OpenAI Images-совместимого API
+type OpenAIImageClient struct {
+	config     config.ImageConfig
+	httpClient *http.Client
+	log        *zap.Logger
+}
+
+// OpenAIImageRequest представляет запрос к API генерации изображений
+type OpenAIImageRequest struct {
+	Model          string `json:"model"`
+	Prompt         string `json:"prompt"`
+	N              int    `json:"n"`
+	Size           string `json:"size,omitempty"`
+	ResponseFormat string `json:"response_format,omitempty"`
+	User           string `json:"user,omitempty"`
+}
+
+// OpenAIImageResponse представляет ответ API генерации изображений
+type OpenAIImageResponse struct {
+	Created int64 `json:"created"`
+	Data    []struct {
+		URL           string `json:"url"`
+		B64JSON       string `json:"b64_json"`
+		RevisedPrompt string `json:"revised_prompt"`
+	} `json:"data"`
+}
+
+// NewOpenAIImageClient создает новый клиент генерации изображений
+func NewOpenAIImageClient(config config.ImageConfig, log *zap.Logger) *OpenAIImageClient {
+	return &OpenAIImageClient{
+		config: config,
+		httpClient: &http.Client{
+			Timeout: 180 * time.Second,
+		},
+		log: log.Named("openai_image_client"),
+	}
+}
+
+// GenerateImage генерирует изображение по текстовому описанию
+func (c *OpenAIImageClient) GenerateImage(ctx context.Context, request *ImageRequest) (*ImageResponse, error) {
+	size := request.Size
+	if size == "" {
+		size = c.config.DefaultSize
+	}
+
+	imageReq := OpenAIImageRequest{
+		Model:          c.config.Model,
+		Prompt:         request.Prompt,
+		N:              1,
+		Size:           size,
+		ResponseFormat: "url",
+		User:           fmt.Sprintf("%d", request.UserID),
+	}
+
+	// Создаем JSON для запроса
+	jsonData, err := json.Marshal(imageReq)
+	if err != nil {
+		return nil, fmt.Errorf("ошибка сериализации запроса: %w", err)
+	}
+
+	// Создаем HTTP-запрос
+	req, err := http.NewRequestWithContext(ctx, "POST", c.config.APIURL, bytes.NewBuffer(jsonData))
+	if err != nil {
+		return nil, fmt.Errorf("ошибка создания HTTP-запроса: %w", err)
+	}
+
+	// Устанавливаем заголовки
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Authorization", "Bearer "+c.config.ApiKey)
+
+	// Отправляем запрос
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("ошибка отправки запроса: %w", err)
+	}
+	defer resp.Body.Close()
+
+	// Проверяем код ответа
+	if resp.StatusCode != http.StatusOK {
+		bodyBytes, _ := io.ReadAll(resp.Body)
+		return nil, fmt.Errorf("ошибка API: код %d, тело: %s", resp.StatusCode, string(bodyBytes))
+	}
+
+	// Разбираем ответ
+	var imageResp OpenAIImageResponse
+	if err := json.NewDecoder(resp.Body).Decode(&imageResp); err != nil {
+		return nil, fmt.Errorf("ошибка разбора ответа: %w", err)
+	}
+
+	if len(imageResp.Data) == 0 {
+		return nil, fmt.Errorf("в ответе нет изображений")
+	}
+
+	response := &ImageResponse{
+		UserID:        request.UserID,
+		RequestID:     fmt.Sprintf("image-%d", imageResp.Created),
+		ModelName:     c.config.Model,
+		Size:          size,
+		ImageURL:      imageResp.Data[0].URL,
+		RevisedPrompt: imageResp.Data[0].RevisedPrompt,
+		Metadata: map[string]interface{}{
+			"provider": "openai",
+		},
+	}
+
+	// Некоторые совместимые API возвращают изображение только в base64
+	if response.ImageURL == "" && imageResp.Data[0].B64JSON != "" {
+		data, err := base64.StdEncoding.DecodeString(imageResp.Data[0].B64JSON)
+		if err != nil {
+			return nil, fmt.Errorf("ошибка декодирования изображения: %w", err)
+		}
+		response.ImageData = data
+	}
+
+	return response, nil
+}
+
+// GetImageModelInfo возвращает информацию о доступных моделях генерации изображений
+func (c *OpenAIImageClient) GetImageModelInfo() []ImageModelConfig {
+	return []ImageModelConfig{
+		{
+			ID:          c.config.Model,
+			Type:        ModelTypeImage,
+			Name:        c.config.Model,
+			DisplayName: "DALL·E 3",
+			Description: "Генерация изображений по текстовому описанию",
+			Tier:        ModelTierPremium,
+			DefaultSize: c.config.DefaultSize,
+			SizeCosts:   c.config.SizeCosts,
+			Enabled:     true,
+		},
+	}
+}
@@ -7,14 +7,56 @@ import (
 	"errors"
 	"fmt"
 	"strings"
+	"time"
 
 	"go.uber.org/zap"
 
 	"neurobot-prod/internal/config"
 	"neurobot-prod/internal/currency"
+	"neurobot-prod/internal/events"
 	"neurobot-prod/internal/subscription"
 )
 
+var (
+	// ErrEmptyResponse возвращается, если нейросеть не вернула текст ответа
+	ErrEmptyResponse = errors.New("нейросеть вернула пустой ответ")
+	// ErrResponseBlocked возвращается, если ответ заблокирован фильтром провайдера
+	ErrResponseBlocked = errors.New("ответ заблокирован фильтром нейросети")
+	// ErrRequestTooLong возвращается, если запрос длиннее, чем позволяет план подписки
+	ErrRequestTooLong = errors.New("длина запроса превышает максимально допустимую")
+	// ErrNoImageAccess возвращается, если план подписки не включает генерацию изображений
+	ErrNoImageAccess = errors.New("нет доступа к генерации изображений")
+	// ErrInsufficientNeurons возвращается, если нейронов не хватает на генерацию изображения
+	ErrInsufficientNeurons = errors.New("недостаточно нейронов для генерации изображения")
+)
+
+// blockedFinishReasons содержит причины завершения, означающие блокировку ответа провайдером
+var blockedFinishReasons = map[string]bool{
+	"content_filter":     true, // OpenAI, Grok
+	"refusal":            true, // Claude
+	"SAFETY":             true, // Gemini
+	"RECITATION":         true,
+	"BLOCKLIST":          true,
+	"PROHIBITED_CONTENT": true,
+	"SPII":               true,
+}
+
+// checkResponse проверяет, что ответ пригоден для отправки пользователю.
+// Для неудачного ответа возвращает причину возврата нейронов и ошибку
+func checkResponse(response *Response) (currency.RefundReason, error) {
+	for _, key := range []string{"finish_reason", "stop_reason"} {
+		if reason, ok := response.Metadata[key].(string); ok && blockedFinishReasons[reason] {
+			return currency.RefundSafetyBlocked, ErrResponseBlocked
+		}
+	}
+
+	if strings.TrimSpace(response.ResponseText) == "" {
+		return currency.RefundEmptyResponse, ErrEmptyResponse
+	}
+
+	return "", nil
+}
+
 // ClientInterface определяет интерфейс для клиентов нейросетей
 type ClientInterface interface {
 	ProcessRequest(ctx context.Context, request *Request) (*Response, error)
@@ -23,11 +65,16 @@ type ClientInterface interface {
 
 // Service предоставляет методы для работы с нейросетями
 type Service struct {
-	config        *config.Config
-	clients       map[ModelType]ClientInterface
-	subService    *subscription.Service
-	neuronService *currency.Service
-	log           *zap.Logger
+	config         *config.Config
+	clients        map[ModelType]ClientInterface
+	imageClient    ImageClientInterface
+	tools          *ToolRegistry
+	contextManager *ContextManager
+	subService     *subscription.Service
+	neuronService  *currency.Service
+	events         events.Emitter
+	modelSwitch    ModelSwitch
+	log            *zap.Logger
 }
 
 // NewService создает новый сервис для работы с нейросетями
@@ -37,9 +84,13 @@ func NewService(cfg *config.Config, subService *subscription.Service, neuronServ
 		clients:       make(map[ModelType]ClientInterface),
 		subService:    subService,
 		neuronService: neuronService,
+		tools:         NewToolRegistry(),
 		log:           log.Named("llm_service"),
 	}
 
+	// Регистрируем встроенные инструменты
+	RegisterBuiltinTools(service.tools, neuronService)
+
 	// Инициализируем клиенты для разных типов нейросетей
 	if cfg.LLM.OpenAI.ApiKey != "" {
 		service.clients[ModelTypeOpenAI] = NewOpenAIClient(cfg.LLM.OpenAI, log)
@@ -57,9 +108,34 @@ func NewService(cfg *config.Config, subService *subscription.Service, neuronServ
 		service.clients[ModelTypeGemini] = NewGeminiClient(cfg.LLM.Gemini, log)
 	}
 
+	// Менеджер контекста использует уже инициализированные клиенты
+	service.contextManager = NewContextManager(cfg.LLM.Context, service.clients, log)
+
+	// Инициализируем клиент генерации изображений
+	switch cfg.LLM.Image.Provider {
+	case "mock":
+		service.imageClient = NewMockImageClient(cfg.LLM.Image, log)
+	case "openai":
+		if cfg.LLM.Image.ApiKey != "" {
+			service.imageClient = NewOpenAIImageClient(cfg.LLM.Image, log)
+		}
+	}
+
 	return service
 }
 
+// SetEvents включает публикацию доменных событий
+func (s *Service) SetEvents(emitter events.Emitter) {
+	s.events = emitter
+}
+
+// emit публикует доменное событие, если задана шина событий
+func (s *Service) emit(ctx context.Context, eventType events.Type, userID int64, data map[string]interface{}) {
+	if s.events != nil {
+		s.events.Emit(ctx, events.New(eventType, userID, data))
+	}
+}
+
 // ProcessRequest обрабатывает запрос к нейросети
 func (s *Service) ProcessRequest(ctx context.Context, request *Request) (*Response, error) {
 	// Проверяем, что клиент для указанного типа модели существует
@@ -91,18 +167,24 @@ func (s *Service) ProcessRequest(ctx context.Context, request *Request) (*Respon
 		return nil, err
 	}
 
-	// Проверяем наличие достаточного количества нейронов
-	hasEnough, err := s.neuronService.HasEnoughNeurons(ctx, request.UserID, cost)
-	if err != nil {
-		return nil, err
-	}
+	// Проверяем наличие достаточного количества нейронов, если запрос не оплачен заранее
+	if request.PrepaidBy == 0 {
+		hasEnough, err := s.neuronService.HasEnoughForRequest(ctx, request.UserID, cost)
+		if err != nil {
+			return nil, err
+		}
 
-	if !hasEnough {
-		return nil, errors.New("недостаточно нейронов для выполнения запроса")
+		if !hasEnough {
+			return nil, errors.New("недостаточно нейронов для выполнения запроса")
+		}
 	}
 
-	// Выполняем запрос к нейросети
-	response, err := client.ProcessRequest(ctx, request)
+	// Сворачиваем старую часть истории, если запрос не помещается в контекстное окно модели
+	model, _ := s.findModelConfig(client, request.ModelName)
+	prepared, summary := s.contextManager.Prepare(ctx, request, model)
+
+	// Выполняем запрос к нейросети (с вызовом инструментов, если модель их поддерживает)
+	response, tools, err := s.processWithTools(ctx, client, prepared, cost)
 	if err != nil {
 		s.log.Error("Ошибка выполнения запроса к нейросети",
 			zap.Int64("user_id", request.UserID),
@@ -121,11 +203,29 @@ func (s *Service) ProcessRequest(ctx context.Context, request *Request) (*Respon
 		"conversation_id":   request.ConversationID,
 	}
 
+	if len(tools.calls) > 0 {
+		metadata["tool_calls"] = tools.calls
+		metadata["tools_cost"] = tools.callsCost
+		metadata["tool_round_trips"] = tools.roundTrips
+		metadata["round_trips_cost"] = tools.roundTripsCost
+	}
+
+	if summary != nil {
+		metadata["context_summarized_messages"] = summary.Messages
+	}
+
 	// Применяем скидку на нейроны в зависимости от подписки
-	actualCost := s.ApplyNeuronDiscount(ctx, request.UserID, cost)
+	actualCost := s.ApplyNeuronDiscount(ctx, request.UserID, cost+tools.cost())
 	response.NeuronsCost = actualCost
 
-	_, err = s.neuronService.RecordLLMUsage(
+	// Оплаченный заранее запрос только записывается, возврат проводит владелец резерва
+	chargedCost := actualCost
+	if request.PrepaidBy != 0 {
+		metadata["prepaid_by"] = request.PrepaidBy
+		chargedCost = 0
+	}
+
+	usage, err := s.neuronService.RecordLLMUsage(
 		ctx,
 		request.UserID,
 		request.ModelName,
@@ -133,7 +233,7 @@ func (s *Service) ProcessRequest(ctx context.Context, request *Request) (*Respon
 		response.ResponseText,
 		response.PromptTokens,
 		response.CompletionTokens,
-		actualCost,
+		chargedCost,
 		currency.Metadata(metadata),
 	)
 
@@ -143,6 +243,34 @@ func (s *Service) ProcessRequest(ctx context.Context, request *Request) (*Respon
 			zap.String("model_name", request.ModelName),
 			zap.Error(err))
 		// Не возвращаем ошибку, так как запрос уже выполнен
+	} else if usage.TransactionID != nil {
+		response.TransactionID = *usage.TransactionID
+	}
+
+	// Пустой или заблокированный ответ не оплачивается: возвращаем списанные нейроны
+	if refundReason, failure := checkResponse(response); failure != nil {
+		s.log.Warn("Нейросеть не вернула пригодный ответ",
+			zap.Int64("user_id", request.UserID),
+			zap.String("model_name", request.ModelName),
+			zap.String("reason", string(refundReason)))
+
+		if response.TransactionID != 0 {
+			if _, err := s.neuronService.Refund(ctx, response.TransactionID, refundReason, request.ModelName); err != nil {
+				s.log.Error("Ошибка возврата нейронов за неудачный ответ",
+					zap.Int64("user_id", request.UserID),
+					zap.Int64("transaction_id", response.TransactionID),
+					zap.Error(err))
+			}
+		}
+		return nil, failure
+	}
+
+	// Краткое содержание оплачивается, только если ответ получен и оно будет сохранено
+	if summary != nil {
+		response.ContextSummary = summary.Text
+		response.SummarizedMessages = summary.Messages
+		response.NeuronsCost += s.recordSummaryUsage(ctx, request, summary)
+		actualCost = response.NeuronsCost
 	}
 
 	s.log.Info("Запрос к нейросети выполнен успешно",
@@ -153,9 +281,241 @@ func (s *Service) ProcessRequest(ctx context.Context, request *Request) (*Respon
 		zap.Int("completion_tokens", response.CompletionTokens),
 		zap.Int("neurons_cost", actualCost))
 
+	s.emit(ctx, events.LLMRequestCompleted, request.UserID, map[string]interface{}{
+		"model_type":   string(request.ModelType),
+		"model_name":   request.ModelName,
+		"neurons_cost": actualCost,
+		"cached":       response.Cached,
+	})
+
 	return response, nil
 }
 
+// recordSummaryUsage записывает использование модели, составившей краткое содержание,
+// и списывает нейроны по ее стоимости. Возвращает списанную сумму
+func (s *Service) recordSummaryUsage(ctx context.Context, request *Request, summary *Summary) int {
+	cost, err := s.GetRequestCost(ctx, summary.ModelType, summary.ModelName)
+	if err != nil {
+		s.log.Error("Ошибка получения стоимости краткого содержания",
+			zap.Int64("user_id", request.UserID),
+			zap.Error(err))
+		return 0
+	}
+	cost = s.ApplyNeuronDiscount(ctx, request.UserID, cost)
+
+	usage, err := s.neuronService.RecordLLMUsage(
+		ctx,
+		request.UserID,
+		summary.ModelName,
+		summary.RequestText,
+		summary.Text,
+		summary.PromptTokens,
+		summary.CompletionTokens,
+		cost,
+		currency.Metadata{
+			"purpose":             "context_summary",
+			"model_type":          summary.ModelType,
+			"conversation_id":     request.ConversationID,
+			"summarized_messages": summary.Messages,
+		},
+	)
+	if err != nil {
+		// Ответ уже получен, поэтому ошибка списания не прерывает запрос
+		s.log.Error("Ошибка записи использования нейросети для краткого содержания",
+			zap.Int64("user_id", request.UserID),
+			zap.String("model_name", summary.ModelName),
+			zap.Error(err))
+		return 0
+	}
+
+	return usage.NeuronsCost
+}
+
+// Tools возвращает реестр инструментов для регистрации дополнительных инструментов
+func (s *Service) Tools() *ToolRegistry {
+	return s.tools
+}
+
+// toolUsage описывает вызовы инструментов в рамках одного запроса
+type toolUsage struct {
+	calls          []map[string]interface{} // Журнал вызовов
+	callsCost      int                      // Стоимость вызовов инструментов
+	roundTrips     int                      // Повторные обращения к нейросети с результатами инструментов
+	roundTripsCost int                      // Стоимость повторных обращений
+}
+
+// cost возвращает стоимость инструментов сверх первого обращения к нейросети
+func (u toolUsage) cost() int {
+	return u.callsCost + u.roundTripsCost
+}
+
+// processWithTools выполняет запрос к нейросети и обрабатывает запрошенные ею вызовы инструментов.
+// Каждое повторное обращение к нейросети с результатами инструментов оплачивается как отдельный запрос.
+// Возвращает итоговый ответ и сведения о вызовах инструментов
+func (s *Service) processWithTools(ctx context.Context, client ClientInterface, request *Request, baseCost int) (*Response, toolUsage, error) {
+	var usage toolUsage
+
+	// Инструменты подключаются к копии, запрос вызывающего не изменяется
+	withTools := *request
+	if s.config.LLM.Tools.Enabled && !request.DisableTools && len(request.Tools) == 0 && s.modelSupportsTools(client, request.ModelName) {
+		withTools.Tools = s.tools.Definitions()
+	}
+
+	response, err := client.ProcessRequest(ctx, &withTools)
+	if err != nil || len(withTools.Tools) == 0 {
+		return response, usage, err
+	}
+
+	// Продолжение диалога формируется на отдельной копии истории
+	followUp := withTools
+	followUp.MessageHistory = append([]Message{}, request.MessageHistory...)
+	if request.UserMessage != "" {
+		followUp.MessageHistory = append(followUp.MessageHistory, Message{
+			Role:    "user",
+			Content: request.UserMessage,
+		})
+	}
+	followUp.UserMessage = ""
+
+	promptTokens := response.PromptTokens
+	completionTokens := response.CompletionTokens
+
+	for iteration := 0; len(response.ToolCalls) > 0; iteration++ {
+		if iteration >= s.config.LLM.Tools.MaxIterations {
+			s.log.Warn("Превышено максимальное число циклов вызова инструментов",
+				zap.Int64("user_id", request.UserID),
+				zap.String("model_name", request.ModelName),
+				zap.Int("max_iterations", s.config.LLM.Tools.MaxIterations))
+			if response.ResponseText == "" {
+				response.ResponseText = "Не удалось завершить ответ: превышено максимальное число обращений к инструментам."
+			}
+			break
+		}
+
+		followUp.MessageHistory = append(followUp.MessageHistory, Message{
+			Role:      "assistant",
+			Content:   response.ResponseText,
+			ToolCalls: response.ToolCalls,
+		})
+
+		for _, call := range response.ToolCalls {
+			result, record, callCost := s.executeToolCall(ctx, request.UserID, call, baseCost+usage.cost())
+			usage.callsCost += callCost
+			usage.calls = append(usage.calls, record)
+
+			followUp.MessageHistory = append(followUp.MessageHistory, Message{
+				Role:       "tool",
+				Content:    result,
+				ToolCallID: call.ID,
+				Name:       call.Name,
+			})
+		}
+
+		// Повторное обращение стоит как обычный запрос к модели
+		hasEnough, err := s.neuronService.HasEnoughForRequest(ctx, request.UserID, baseCost+usage.cost()+baseCost)
+		if err != nil {
+			return nil, usage, err
+		}
+		if !hasEnough {
+			s.log.Warn("Повторное обращение к нейросети отклонено: недостаточно нейронов",
+				zap.Int64("user_id", request.UserID),
+				zap.String("model_name", request.ModelName))
+			if response.ResponseText == "" {
+				response.ResponseText = "Не удалось завершить ответ: недостаточно нейронов для обработки результатов инструментов."
+			}
+			break
+		}
+
+		response, err = client.ProcessRequest(ctx, &followUp)
+		if err != nil {
+			return nil, usage, err
+		}
+
+		usage.roundTrips++
+		usage.roundTripsCost += baseCost
+		promptTokens += response.PromptTokens
+		completionTokens += response.CompletionTokens
+	}
+
+	response.ToolCalls = nil
+	response.PromptTokens = promptTokens
+	response.CompletionTokens = completionTokens
+	response.TotalTokens = promptTokens + completionTokens
+
+	return response, usage, nil
+}
+
+// executeToolCall выполняет один вызов инструмента.
+// Возвращает результат для нейросети, запись для журнала и стоимость вызова
+func (s *Service) executeToolCall(ctx context.Context, userID int64, call ToolCall, alreadySpent int) (string, map[string]interface{}, int) {
+	startTime := time.Now()
+	record := map[string]interface{}{
+		"id":        call.ID,
+		"name":      call.Name,
+		"arguments": call.Arguments,
+	}
+
+	cost := s.config.LLM.Tools.GetCallCost(call.Name)
+
+	// Проверяем, хватит ли нейронов с учетом уже набранной стоимости запроса
+	hasEnough, err := s.neuronService.HasEnoughForRequest(ctx, userID, alreadySpent+cost)
+	if err != nil || !hasEnough {
+		record["error"] = "недостаточно нейронов"
+		record["neurons_cost"] = 0
+		s.log.Warn("Вызов инструмента отклонен: недостаточно нейронов",
+			zap.Int64("user_id", userID),
+			zap.String("tool", call.Name))
+		return "Ошибка: у пользователя недостаточно нейронов для вызова инструмента", record, 0
+	}
+
+	result, err := s.tools.Execute(ctx, userID, call)
+	if err != nil {
+		// Неудачные вызовы не оплачиваются, а ошибка передается нейросети
+		record["error"] = err.Error()
+		record["neurons_cost"] = 0
+		s.log.Warn("Ошибка выполнения инструмента",
+			zap.Int64("user_id", userID),
+			zap.String("tool", call.Name),
+			zap.String("arguments", call.Arguments),
+			zap.Error(err))
+		return "Ошибка: " + err.Error(), record, 0
+	}
+
+	record["neurons_cost"] = cost
+	s.log.Info("Выполнен вызов инструмента",
+		zap.Int64("user_id", userID),
+		zap.String("tool", call.Name),
+		zap.String("arguments", call.Arguments),
+		zap.Int("neurons_cost", cost),
+		zap.Duration("duration", time.Since(startTime)))
+
+	return result, record, cost
+}
+
+// modelSupportsTools проверяет, поддерживает ли модель вызов инструментов
+func (s *Service) modelSupportsTools(client ClientInterface, modelName string) bool {
+	model, ok := s.findModelConfig(client, modelName)
+	if !ok {
+		return false
+	}
+	for _, feature := range model.SupportedFeatures {
+		if feature == "tools" {
+			return true
+		}
+	}
+	return false
+}
+
+// findModelConfig возвращает конфигурацию модели клиента по ее названию
+func (s *Service) findModelConfig(client ClientInterface, modelName string) (ModelConfig, bool) {
+	for _, model := range client.GetModelInfo() {
+		if model.Name == modelName {
+			return model, true
+		}
+	}
+	return ModelConfig{}, false
+}
+
 // GetAvailableModels возвращает список доступных моделей для пользователя
 func (s *Service) GetAvailableModels(ctx context.Context, userID int64) ([]ModelConfig, error) {
 	// Получаем план подписки пользователя
@@ -173,9 +533,13 @@ func (s *Service) GetAvailableModels(ctx context.Context, userID int64) ([]Model
 		allModels = append(allModels, client.GetModelInfo()...)
 	}
 
-	// Фильтруем модели по доступности для данного плана
+	// Фильтруем модели по доступности для данного плана, пропуская отключенные администратором
+	disabled := s.disabledModels(ctx)
 	var userModels []ModelConfig
 	for _, model := range allModels {
+		if disabled[model.Name] {
+			continue
+		}
 		for _, availableModel := range availableModels {
 			if model.Name == availableModel {
 				userModels = append(userModels, model)
@@ -195,6 +559,11 @@ func (s *Service) CheckModelAccess(ctx context.Context, userID int64, modelType
 		return false, err
 	}
 
+	// Модель, отключенная администратором, недоступна на любом плане
+	if s.disabledModels(ctx)[modelName] {
+		return false, nil
+	}
+
 	// Получаем доступные модели из плана подписки
 	availableModels := plan.GetAvailableModels()
 
@@ -226,7 +595,7 @@ func (s *Service) CheckRequestLength(ctx context.Context, userID int64, message
 
 	// Проверяем длину запроса
 	if len([]rune(message)) > maxLength {
-		return fmt.Errorf("длина запроса превышает максимально допустимую (%d символов)", maxLength)
+		return fmt.Errorf("%w (%d символов)", ErrRequestTooLong, maxLength)
 	}
 
 	return nil
@@ -299,3 +668,119 @@ func (s *Service) ModelMessageLimit(ctx context.Context, userID int64) (int, err
 
 	return plan.ContextMessages, nil
 }
+
+// GetImageModel возвращает конфигурацию модели генерации изображений
+func (s *Service) GetImageModel(modelName string) (*ImageModelConfig, error) {
+	if s.imageClient == nil {
+		return nil, errors.New("генерация изображений недоступна")
+	}
+
+	models := s.imageClient.GetImageModelInfo()
+	for i := range models {
+		if !models[i].Enabled {
+			continue
+		}
+		if modelName == "" || models[i].Name == modelName {
+			return &models[i], nil
+		}
+	}
+
+	return nil, fmt.Errorf("модель генерации изображений %s не найдена", modelName)
+}
+
+// GenerateImage генерирует изображение и списывает нейроны за него
+func (s *Service) GenerateImage(ctx context.Context, request *ImageRequest) (*ImageResponse, error) {
+	model, err := s.GetImageModel(request.ModelName)
+	if err != nil {
+		return nil, err
+	}
+	request.ModelName = model.Name
+
+	if request.Size == "" {
+		request.Size = model.DefaultSize
+	}
+
+	// Проверяем доступ к модели через план подписки
+	hasAccess, err := s.CheckModelAccess(ctx, request.UserID, ModelTypeImage, model.Name)
+	if err != nil {
+		return nil, err
+	}
+
+	if !hasAccess {
+		return nil, ErrNoImageAccess
+	}
+
+	// Проверяем длину описания в зависимости от подписки
+	if err := s.CheckRequestLength(ctx, request.UserID, request.Prompt); err != nil {
+		return nil, err
+	}
+
+	// Стоимость зависит от размера изображения
+	cost, ok := model.GetSizeCost(request.Size)
+	if !ok {
+		return nil, fmt.Errorf("размер %s не поддерживается", request.Size)
+	}
+
+	actualCost := s.ApplyNeuronDiscount(ctx, request.UserID, cost)
+
+	hasEnough, err := s.neuronService.HasEnoughForRequest(ctx, request.UserID, actualCost)
+	if err != nil {
+		return nil, err
+	}
+
+	if !hasEnough {
+		return nil, ErrInsufficientNeurons
+	}
+
+	response, err := s.imageClient.GenerateImage(ctx, request)
+	if err != nil {
+		s.log.Error("Ошибка генерации изображения",
+			zap.Int64("user_id", request.UserID),
+			zap.String("model_name", model.Name),
+			zap.String("size", request.Size),
+			zap.Error(err))
+		return nil, fmt.Errorf("ошибка генерации изображения: %w", err)
+	}
+
+	response.NeuronsCost = actualCost
+
+	metadata := currency.Metadata{
+		"model_type":     ModelTypeImage,
+		"model_name":     model.Name,
+		"size":           response.Size,
+		"image_url":      response.ImageURL,
+		"revised_prompt": response.RevisedPrompt,
+		"request_id":     response.RequestID,
+		"base_cost":      cost,
+	}
+	for key, value := range response.Metadata {
+		metadata[key] = value
+	}
+
+	usage, err := s.neuronService.RecordImageUsage(ctx, request.UserID, model.Name, request.Prompt, response.ImageURL, actualCost, metadata)
+	if err != nil {
+		s.log.Error("Ошибка записи генерации изображения",
+			zap.Int64("user_id", request.UserID),
+			zap.String("model_name", model.Name),
+			zap.Error(err))
+		return nil, fmt.Errorf("ошибка списания нейронов: %w", err)
+	}
+	if usage.TransactionID != nil {
+		response.TransactionID = *usage.TransactionID
+	}
+
+	s.log.Info("Изображение сгенерировано",
+		zap.Int64("user_id", request.UserID),
+		zap.String("model_name", model.Name),
+		zap.String("size", response.Size),
+		zap.Int("neurons_cost", actualCost))
+
+	s.emit(ctx, events.LLMRequestCompleted, request.UserID, map[string]interface{}{
+		"model_type":   string(ModelTypeImage),
+		"model_name":   model.Name,
+		"neurons_cost": actualCost,
+		"kind":         "image",
+	})
+
+	return response, nil
+}
@@ -0,0 +1,83 @@
+// Реестр инструментов, доступных нейросетям
+
+package llm
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sync"
+)
+
+// ToolHandler выполняет инструмент и возвращает результат в текстовом виде
+type ToolHandler func(ctx context.Context, userID int64, arguments json.RawMessage) (string, error)
+
+// RegisteredTool представляет инструмент вместе с его обработчиком
+type RegisteredTool struct {
+	Tool
+	Handler ToolHandler
+}
+
+// ToolRegistry хранит инструменты, которые сервер может выполнить по запросу нейросети
+type ToolRegistry struct {
+	mu    sync.RWMutex
+	tools map[string]*RegisteredTool
+	order []string // Порядок регистрации для стабильного списка описаний
+}
+
+// NewToolRegistry создает новый реестр инструментов
+func NewToolRegistry() *ToolRegistry {
+	return &ToolRegistry{
+		tools: make(map[string]*RegisteredTool),
+	}
+}
+
+// Register регистрирует инструмент. Повторная регистрация заменяет обработчик
+func (r *ToolRegistry) Register(tool Tool, handler ToolHandler) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if _, exists := r.tools[tool.Name]; !exists {
+		r.order = append(r.order, tool.Name)
+	}
+	r.tools[tool.Name] = &RegisteredTool{
+		Tool:    tool,
+		Handler: handler,
+	}
+}
+
+// Get возвращает зарегистрированный инструмент по названию
+func (r *ToolRegistry) Get(name string) (*RegisteredTool, bool) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	tool, ok := r.tools[name]
+	return tool, ok
+}
+
+// Definitions возвращает описания всех зарегистрированных инструментов
+func (r *ToolRegistry) Definitions() []Tool {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	definitions := make([]Tool, 0, len(r.order))
+	for _, name := range r.order {
+		definitions = append(definitions, r.tools[name].Tool)
+	}
+	return definitions
+}
+
+// Execute выполняет вызов инструмента
+func (r *ToolRegistry) Execute(ctx context.Context, userID int64, call ToolCall) (string, error) {
+	tool, ok := r.Get(call.Name)
+	if !ok {
+		return "", fmt.Errorf("инструмент %s не найден", call.Name)
+	}
+
+	arguments := json.RawMessage(call.Arguments)
+	if len(arguments) == 0 {
+		arguments = json.RawMessage("{}")
+	}
+
+	return tool.Handler(ctx, userID, arguments)
+}
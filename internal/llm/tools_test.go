@@ -0,0 +1,172 @@
+// Тесты вызова инструментов нейросетью
+
+package llm
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"go.uber.org/zap"
+
+	"neurobot-prod/internal/config"
+	"neurobot-prod/internal/currency"
+	"neurobot-prod/internal/storage/postgres/pgtest"
+	"neurobot-prod/internal/subscription"
+)
+
+const toolsTestModel = "tools-model"
+
+// scriptedClient возвращает заданные ответы по очереди, повторяя последний, и запоминает запросы
+type scriptedClient struct {
+	responses []Response
+	requests  []*Request
+}
+
+func (c *scriptedClient) ProcessRequest(ctx context.Context, request *Request) (*Response, error) {
+	c.requests = append(c.requests, request)
+	i := len(c.requests) - 1
+	if i >= len(c.responses) {
+		i = len(c.responses) - 1
+	}
+	response := c.responses[i]
+	return &response, nil
+}
+
+func (c *scriptedClient) GetModelInfo() []ModelConfig {
+	return []ModelConfig{{Name: toolsTestModel, SupportedFeatures: []string{"tools"}}}
+}
+
+// toolCallResponse возвращает ответ нейросети с вызовом инструмента
+func toolCallResponse(name, arguments string) Response {
+	return Response{
+		ToolCalls:    []ToolCall{{ID: "call-" + name, Name: name, Arguments: arguments}},
+		PromptTokens: 10,
+	}
+}
+
+// textResponse возвращает итоговый ответ нейросети
+func textResponse(text string) Response {
+	return Response{ResponseText: text, PromptTokens: 10}
+}
+
+func TestProcessWithTools(t *testing.T) {
+	const baseCost = 10
+
+	tests := []struct {
+		name           string
+		balance        int
+		responses      []Response
+		wantRequests   int
+		wantRoundTrips int
+		wantCallsCost  int
+		wantText       string
+		wantToolError  string // Начало результата последнего вызова инструмента, переданного нейросети
+	}{
+		{
+			name:         "ответ без инструментов",
+			balance:      100,
+			responses:    []Response{textResponse("готово")},
+			wantRequests: 1,
+			wantText:     "готово",
+		},
+		{
+			name:           "оплата каждого обращения",
+			balance:        100,
+			responses:      []Response{toolCallResponse("current_time", `{}`), textResponse("сейчас полдень")},
+			wantRequests:   2,
+			wantRoundTrips: 1,
+			wantCallsCost:  1,
+			wantText:       "сейчас полдень",
+		},
+		{
+			name:           "ограничение числа циклов",
+			balance:        100,
+			responses:      []Response{toolCallResponse("current_time", `{}`)},
+			wantRequests:   3,
+			wantRoundTrips: 2,
+			wantCallsCost:  2,
+			wantText:       "превышено максимальное число обращений",
+		},
+		{
+			// 10 за запрос, 1 за вызов и 10 за повторное обращение, на второе обращение нейронов не хватает
+			name:           "нейроны закончились посреди цикла",
+			balance:        25,
+			responses:      []Response{toolCallResponse("current_time", `{}`)},
+			wantRequests:   2,
+			wantRoundTrips: 1,
+			wantCallsCost:  2,
+			wantText:       "недостаточно нейронов",
+		},
+		{
+			name:           "некорректные аргументы",
+			balance:        100,
+			responses:      []Response{toolCallResponse("convert_units", `{"value":`), textResponse("не получилось")},
+			wantRequests:   2,
+			wantRoundTrips: 1,
+			wantText:       "не получилось",
+			wantToolError:  "Ошибка: некорректные аргументы",
+		},
+	}
+
+	for i, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db := pgtest.Open(t)
+			userID := int64(3401 + i)
+			pgtest.CreateUser(t, db, userID)
+			ctx := context.Background()
+
+			log := zap.NewNop()
+			subService := subscription.NewService(subscription.NewRepository(db), log)
+			currencyService := currency.NewService(currency.NewRepository(db), subService, log)
+			if _, err := currencyService.AddNeurons(ctx, userID, tt.balance, currency.TypeBonus, "Бонус", nil, "", "", 0); err != nil {
+				t.Fatal(err)
+			}
+
+			cfg := &config.Config{}
+			cfg.LLM.Tools = config.ToolsConfig{Enabled: true, MaxIterations: 2, CallCost: 1}
+			service := NewService(cfg, subService, currencyService, log)
+			client := &scriptedClient{responses: tt.responses}
+
+			response, usage, err := service.processWithTools(ctx, client, &Request{
+				UserID:      userID,
+				ModelName:   toolsTestModel,
+				UserMessage: "который час?",
+			}, baseCost)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if len(client.requests) != tt.wantRequests {
+				t.Errorf("обращений к нейросети %d, ожидалось %d", len(client.requests), tt.wantRequests)
+			}
+			if usage.roundTrips != tt.wantRoundTrips || usage.roundTripsCost != tt.wantRoundTrips*baseCost {
+				t.Errorf("повторных обращений %d на %d нейронов, ожидалось %d на %d",
+					usage.roundTrips, usage.roundTripsCost, tt.wantRoundTrips, tt.wantRoundTrips*baseCost)
+			}
+			if usage.callsCost != tt.wantCallsCost {
+				t.Errorf("стоимость вызовов %d, ожидалась %d", usage.callsCost, tt.wantCallsCost)
+			}
+			if !strings.Contains(response.ResponseText, tt.wantText) {
+				t.Errorf("ответ %q, ожидался %q", response.ResponseText, tt.wantText)
+			}
+			if response.ToolCalls != nil {
+				t.Errorf("в итоговом ответе остались вызовы инструментов: %v", response.ToolCalls)
+			}
+			if want := 10 * len(client.requests); response.PromptTokens != want {
+				t.Errorf("токенов запроса %d, ожидалось %d по всем обращениям", response.PromptTokens, want)
+			}
+
+			if tt.wantToolError != "" {
+				history := client.requests[len(client.requests)-1].MessageHistory
+				last := history[len(history)-1]
+				if last.Role != "tool" || !strings.HasPrefix(last.Content, tt.wantToolError) {
+					t.Errorf("результат инструмента %q (%s), ожидалась ошибка %q", last.Content, last.Role, tt.wantToolError)
+				}
+				if len(usage.calls) != 1 || usage.calls[0]["error"] == nil || usage.calls[0]["neurons_cost"] != 0 {
+					t.Errorf("журнал вызова %v, ожидался неоплаченный вызов с ошибкой", usage.calls)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,109 @@
+// Модель системы лояльности
+
+package loyalty
+
+import (
+	"database/sql/driver"
+	"encoding/json"
+	"errors"
+	"time"
+)
+
+// Source представляет источник получения опыта
+type Source string
+
+const (
+	SourceMessage     Source = "message"     // Запрос к нейросети
+	SourceDaily       Source = "daily"       // Ежедневное начисление нейронов
+	SourcePurchase    Source = "purchase"    // Покупка подписки или нейронов
+	SourceReferral    Source = "referral"    // Активный приглашенный пользователь
+	SourceAchievement Source = "achievement" // Награда за достижение
+)
+
+// Metadata представляет дополнительные данные
+type Metadata map[string]interface{}
+
+// Value реализует интерфейс driver.Valuer для конвертации в JSONB
+func (m Metadata) Value() (driver.Value, error) {
+	if m == nil {
+		return nil, nil
+	}
+	return json.Marshal(m)
+}
+
+// Scan реализует интерфейс sql.Scanner для чтения из JSONB
+func (m *Metadata) Scan(value interface{}) error {
+	if value == nil {
+		*m = nil
+		return nil
+	}
+
+	var data []byte
+	switch v := value.(type) {
+	case []byte:
+		data = v
+	case string:
+		data = []byte(v)
+	default:
+		return errors.New("тип данных не поддерживается для Metadata.Scan")
+	}
+
+	return json.Unmarshal(data, m)
+}
+
+// Level представляет уровень пользователя
+type Level struct {
+	ID                 int       `db:"id"`
+	Level              int       `db:"level"`
+	Name               string    `db:"name"`
+	MinXP              int       `db:"min_xp"`
+	NeuronBonusPercent int       `db:"neuron_bonus_percent"` // Бонус к ежедневным нейронам
+	Features           Metadata  `db:"features"`
+	CreatedAt          time.Time `db:"created_at"`
+	UpdatedAt          time.Time `db:"updated_at"`
+}
+
+// Experience представляет опыт пользователя
+type Experience struct {
+	ID           int64     `db:"id"`
+	UserID       int64     `db:"user_id"`
+	CurrentXP    int       `db:"current_xp"`
+	CurrentLevel int       `db:"current_level"`
+	CreatedAt    time.Time `db:"created_at"`
+	UpdatedAt    time.Time `db:"updated_at"`
+}
+
+// HistoryEntry представляет запись в истории получения опыта
+type HistoryEntry struct {
+	ID          int64     `db:"id"`
+	UserID      int64     `db:"user_id"`
+	Amount      int       `db:"amount"`
+	Source      Source    `db:"source"`
+	Description string    `db:"description"`
+	ReferenceID string    `db:"reference_id"`
+	Metadata    Metadata  `db:"metadata"`
+	CreatedAt   time.Time `db:"created_at"`
+}
+
+// Progress содержит текущий уровень пользователя и прогресс до следующего
+type Progress struct {
+	XP        int
+	Level     *Level
+	NextLevel *Level // nil на максимальном уровне
+}
+
+// XPToNextLevel возвращает количество опыта до следующего уровня
+func (p *Progress) XPToNextLevel() int {
+	if p.NextLevel == nil {
+		return 0
+	}
+	return p.NextLevel.MinXP - p.XP
+}
+
+// Award содержит результат начисления опыта
+type Award struct {
+	Amount    int    // Фактически начисленный опыт с учетом дневного лимита
+	XP        int    // Опыт после начисления
+	Level     *Level // Уровень после начисления
+	LeveledUp bool   // Уровень повысился
+}
@@ -0,0 +1,189 @@
+// Репозиторий системы лояльности
+
+package loyalty
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"time"
+)
+
+// Repository представляет репозиторий для работы с системой лояльности
+type Repository struct {
+	db *sql.DB
+}
+
+// NewRepository создает новый репозиторий системы лояльности
+func NewRepository(db *sql.DB) *Repository {
+	return &Repository{
+		db: db,
+	}
+}
+
+// GetLevels возвращает все уровни в порядке возрастания требуемого опыта
+func (r *Repository) GetLevels(ctx context.Context) ([]*Level, error) {
+	query := `
+		SELECT id, level, name, min_xp, neuron_bonus_percent, features, created_at, updated_at
+		FROM user_levels
+		ORDER BY min_xp ASC
+	`
+
+	rows, err := r.db.QueryContext(ctx, query)
+	if err != nil {
+		return nil, fmt.Errorf("ошибка получения уровней: %w", err)
+	}
+	defer rows.Close()
+
+	var levels []*Level
+	for rows.Next() {
+		level := &Level{}
+		err := rows.Scan(
+			&level.ID,
+			&level.Level,
+			&level.Name,
+			&level.MinXP,
+			&level.NeuronBonusPercent,
+			&level.Features,
+			&level.CreatedAt,
+			&level.UpdatedAt,
+		)
+		if err != nil {
+			return nil, fmt.Errorf("ошибка сканирования уровня: %w", err)
+		}
+		levels = append(levels, level)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("ошибка при итерации уровней: %w", err)
+	}
+
+	return levels, nil
+}
+
+// GetExperience возвращает опыт пользователя
+func (r *Repository) GetExperience(ctx context.Context, userID int64) (*Experience, error) {
+	query := `
+		SELECT id, user_id, current_xp, current_level, created_at, updated_at
+		FROM user_experience
+		WHERE user_id = $1
+	`
+
+	exp := &Experience{}
+	err := r.db.QueryRowContext(ctx, query, userID).Scan(
+		&exp.ID,
+		&exp.UserID,
+		&exp.CurrentXP,
+		&exp.CurrentLevel,
+		&exp.CreatedAt,
+		&exp.UpdatedAt,
+	)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, nil // Пользователь еще не получал опыт
+		}
+		return nil, fmt.Errorf("ошибка получения опыта пользователя: %w", err)
+	}
+
+	return exp, nil
+}
+
+// AddXP записывает начисление опыта в историю и увеличивает опыт пользователя.
+// Возвращает опыт и уровень пользователя после начисления
+func (r *Repository) AddXP(ctx context.Context, entry *HistoryEntry) (*Experience, error) {
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, fmt.Errorf("ошибка начала транзакции: %w", err)
+	}
+	defer tx.Rollback()
+
+	err = tx.QueryRowContext(ctx, `
+		INSERT INTO xp_history (user_id, amount, source, description, reference_id, metadata)
+		VALUES ($1, $2, $3, $4, NULLIF($5, ''), $6)
+		RETURNING id, created_at
+	`,
+		entry.UserID,
+		entry.Amount,
+		entry.Source,
+		entry.Description,
+		entry.ReferenceID,
+		entry.Metadata,
+	).Scan(&entry.ID, &entry.CreatedAt)
+	if err != nil {
+		return nil, fmt.Errorf("ошибка записи истории опыта: %w", err)
+	}
+
+	exp := &Experience{UserID: entry.UserID}
+	err = tx.QueryRowContext(ctx, `
+		INSERT INTO user_experience (user_id, current_xp)
+		VALUES ($1, $2)
+		ON CONFLICT (user_id) DO UPDATE
+		SET current_xp = user_experience.current_xp + EXCLUDED.current_xp, updated_at = NOW()
+		RETURNING id, current_xp, current_level, created_at, updated_at
+	`, entry.UserID, entry.Amount).Scan(
+		&exp.ID,
+		&exp.CurrentXP,
+		&exp.CurrentLevel,
+		&exp.CreatedAt,
+		&exp.UpdatedAt,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("ошибка обновления опыта пользователя: %w", err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, fmt.Errorf("ошибка подтверждения транзакции: %w", err)
+	}
+
+	return exp, nil
+}
+
+// RaiseLevel повышает уровень пользователя. Возвращает false, если уровень уже не ниже указанного,
+// поэтому о повышении уведомляется только один из параллельных запросов
+func (r *Repository) RaiseLevel(ctx context.Context, userID int64, level int) (bool, error) {
+	result, err := r.db.ExecContext(ctx, `
+		UPDATE user_experience
+		SET current_level = $1, updated_at = NOW()
+		WHERE user_id = $2 AND current_level < $1
+	`, level, userID)
+	if err != nil {
+		return false, fmt.Errorf("ошибка обновления уровня пользователя: %w", err)
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return false, fmt.Errorf("ошибка получения количества затронутых строк: %w", err)
+	}
+
+	return rowsAffected > 0, nil
+}
+
+// SumXPSince возвращает опыт, полученный пользователем из источника с указанного момента
+func (r *Repository) SumXPSince(ctx context.Context, userID int64, source Source, since time.Time) (int, error) {
+	var total int
+	err := r.db.QueryRowContext(ctx, `
+		SELECT COALESCE(SUM(amount), 0)
+		FROM xp_history
+		WHERE user_id = $1 AND source = $2 AND created_at >= $3
+	`, userID, source, since).Scan(&total)
+	if err != nil {
+		return 0, fmt.Errorf("ошибка подсчета опыта: %w", err)
+	}
+
+	return total, nil
+}
+
+// HasXPForReference проверяет, начислялся ли опыт за указанную сущность
+func (r *Repository) HasXPForReference(ctx context.Context, userID int64, source Source, referenceID string) (bool, error) {
+	var exists bool
+	err := r.db.QueryRowContext(ctx, `
+		SELECT EXISTS(
+			SELECT 1 FROM xp_history WHERE user_id = $1 AND source = $2 AND reference_id = $3
+		)
+	`, userID, source, referenceID).Scan(&exists)
+	if err != nil {
+		return false, fmt.Errorf("ошибка проверки истории опыта: %w", err)
+	}
+
+	return exists, nil
+}
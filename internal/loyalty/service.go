@@ -0,0 +1,246 @@
+// Сервис системы лояльности
+
+package loyalty
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"sync"
+	"time"
+
+	"go.uber.org/zap"
+
+	"neurobot-prod/internal/config"
+)
+
+// levelsCacheTTL - время, на которое кэшируется список уровней
+const levelsCacheTTL = 10 * time.Minute
+
+// Notifier отправляет пользователю сообщение о повышении уровня
+type Notifier func(userID int64, text string)
+
+// Service предоставляет методы для работы с опытом и уровнями пользователей
+type Service struct {
+	repo   *Repository
+	config config.LoyaltyConfig
+	notify Notifier
+	log    *zap.Logger
+
+	mu             sync.RWMutex
+	levels         []*Level
+	levelsLoadedAt time.Time
+}
+
+// NewService создает новый сервис системы лояльности
+func NewService(repo *Repository, cfg config.LoyaltyConfig, log *zap.Logger) *Service {
+	return &Service{
+		repo:   repo,
+		config: cfg,
+		log:    log.Named("loyalty_service"),
+	}
+}
+
+// SetNotifier устанавливает функцию уведомления о повышении уровня
+func (s *Service) SetNotifier(notify Notifier) {
+	s.notify = notify
+}
+
+// getLevels возвращает уровни из кэша, обновляя его по истечении времени жизни
+func (s *Service) getLevels(ctx context.Context) ([]*Level, error) {
+	s.mu.RLock()
+	if s.levels != nil && time.Since(s.levelsLoadedAt) < levelsCacheTTL {
+		levels := s.levels
+		s.mu.RUnlock()
+		return levels, nil
+	}
+	s.mu.RUnlock()
+
+	levels, err := s.repo.GetLevels(ctx)
+	if err != nil {
+		s.log.Error("Ошибка получения уровней", zap.Error(err))
+		return nil, err
+	}
+	if len(levels) == 0 {
+		return nil, fmt.Errorf("уровни пользователей не настроены")
+	}
+
+	s.mu.Lock()
+	s.levels = levels
+	s.levelsLoadedAt = time.Now()
+	s.mu.Unlock()
+
+	return levels, nil
+}
+
+// levelForXP возвращает уровень и следующий уровень для указанного опыта
+func levelForXP(levels []*Level, xp int) (*Level, *Level) {
+	current := levels[0]
+	var next *Level
+	for _, level := range levels {
+		if xp >= level.MinXP {
+			current = level
+			continue
+		}
+		next = level
+		break
+	}
+	return current, next
+}
+
+// GetProgress возвращает уровень пользователя и прогресс до следующего уровня
+func (s *Service) GetProgress(ctx context.Context, userID int64) (*Progress, error) {
+	levels, err := s.getLevels(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	exp, err := s.repo.GetExperience(ctx, userID)
+	if err != nil {
+		s.log.Error("Ошибка получения опыта пользователя",
+			zap.Int64("user_id", userID),
+			zap.Error(err))
+		return nil, err
+	}
+
+	xp := 0
+	if exp != nil {
+		xp = exp.CurrentXP
+	}
+
+	level, next := levelForXP(levels, xp)
+	return &Progress{
+		XP:        xp,
+		Level:     level,
+		NextLevel: next,
+	}, nil
+}
+
+// GetBonusPercent возвращает бонус к ежедневным нейронам для уровня пользователя
+func (s *Service) GetBonusPercent(ctx context.Context, userID int64) (int, error) {
+	progress, err := s.GetProgress(ctx, userID)
+	if err != nil {
+		return 0, err
+	}
+	return progress.Level.NeuronBonusPercent, nil
+}
+
+// AwardXP начисляет пользователю опыт и повышает уровень при достижении порога.
+// Возвращает nil, если начислять нечего
+func (s *Service) AwardXP(ctx context.Context, userID int64, source Source, amount int, description, referenceID string) (*Award, error) {
+	if amount <= 0 {
+		return nil, nil
+	}
+
+	levels, err := s.getLevels(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	exp, err := s.repo.AddXP(ctx, &HistoryEntry{
+		UserID:      userID,
+		Amount:      amount,
+		Source:      source,
+		Description: description,
+		ReferenceID: referenceID,
+	})
+	if err != nil {
+		s.log.Error("Ошибка начисления опыта",
+			zap.Int64("user_id", userID),
+			zap.String("source", string(source)),
+			zap.Error(err))
+		return nil, fmt.Errorf("ошибка начисления опыта: %w", err)
+	}
+
+	level, _ := levelForXP(levels, exp.CurrentXP)
+	award := &Award{
+		Amount: amount,
+		XP:     exp.CurrentXP,
+		Level:  level,
+	}
+
+	if level.Level > exp.CurrentLevel {
+		raised, err := s.repo.RaiseLevel(ctx, userID, level.Level)
+		if err != nil {
+			s.log.Error("Ошибка повышения уровня",
+				zap.Int64("user_id", userID),
+				zap.Int("level", level.Level),
+				zap.Error(err))
+			return award, nil
+		}
+
+		if raised {
+			award.LeveledUp = true
+			s.log.Info("Уровень пользователя повышен",
+				zap.Int64("user_id", userID),
+				zap.Int("level", level.Level),
+				zap.Int("xp", exp.CurrentXP))
+
+			text := fmt.Sprintf("🎉 Новый уровень: «%s»!", level.Name)
+			if level.NeuronBonusPercent > 0 {
+				text += fmt.Sprintf("\nБонус к ежедневным нейронам: +%d%%", level.NeuronBonusPercent)
+			}
+			s.sendNotification(userID, text)
+		}
+	}
+
+	return award, nil
+}
+
+// AwardRequest начисляет опыт за оплаченный запрос к нейросети с учетом дневного лимита
+func (s *Service) AwardRequest(ctx context.Context, userID int64, modelName string) (*Award, error) {
+	amount := s.config.RequestXP
+	if limit := s.config.RequestXPDailyMax; limit > 0 {
+		// Лимит считается за последние сутки, чтобы не зависеть от часового пояса
+		earned, err := s.repo.SumXPSince(ctx, userID, SourceMessage, time.Now().Add(-24*time.Hour))
+		if err != nil {
+			return nil, err
+		}
+		if earned+amount > limit {
+			amount = limit - earned
+		}
+	}
+
+	return s.AwardXP(ctx, userID, SourceMessage, amount,
+		fmt.Sprintf("Запрос к нейросети %s", modelName), "")
+}
+
+// AwardDaily начисляет опыт за получение ежедневных нейронов
+func (s *Service) AwardDaily(ctx context.Context, userID int64, transactionID int64) (*Award, error) {
+	return s.AwardXP(ctx, userID, SourceDaily, s.config.DailyXP,
+		"Ежедневное начисление нейронов", strconv.FormatInt(transactionID, 10))
+}
+
+// AwardPurchase начисляет опыт за покупку. Повторный вызов для того же платежа опыт не начисляет
+func (s *Service) AwardPurchase(ctx context.Context, userID int64, amountKopecks int, paymentID string) (*Award, error) {
+	amount := amountKopecks / 100 * s.config.PurchaseXPPerRub
+	if amount <= 0 {
+		return nil, nil
+	}
+
+	exists, err := s.repo.HasXPForReference(ctx, userID, SourcePurchase, paymentID)
+	if err != nil || exists {
+		return nil, err
+	}
+
+	return s.AwardXP(ctx, userID, SourcePurchase, amount, "Покупка", paymentID)
+}
+
+// AwardReferral начисляет опыт за активного приглашенного пользователя
+func (s *Service) AwardReferral(ctx context.Context, userID int64, referredID int64) (*Award, error) {
+	referenceID := strconv.FormatInt(referredID, 10)
+
+	exists, err := s.repo.HasXPForReference(ctx, userID, SourceReferral, referenceID)
+	if err != nil || exists {
+		return nil, err
+	}
+
+	return s.AwardXP(ctx, userID, SourceReferral, s.config.ReferralXP, "Приглашенный пользователь", referenceID)
+}
+
+// sendNotification отправляет уведомление пользователю, если задан способ уведомления
+func (s *Service) sendNotification(userID int64, text string) {
+	if s.notify != nil {
+		s.notify(userID, text)
+	}
+}
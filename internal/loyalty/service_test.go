@@ -0,0 +1,150 @@
+// Тесты начисления опыта и пересчета уровней
+
+package loyalty
+
+import (
+	"context"
+	"sync"
+	"testing"
+
+	"go.uber.org/zap"
+
+	"neurobot-prod/internal/config"
+	"neurobot-prod/internal/storage/postgres/pgtest"
+)
+
+// newTestService создает сервис лояльности, запоминающий уведомления о новых уровнях
+func newTestService(t *testing.T, cfg config.LoyaltyConfig, userIDs ...int64) (*Service, *[]string) {
+	db := pgtest.Open(t)
+	for _, userID := range userIDs {
+		pgtest.CreateUser(t, db, userID)
+	}
+
+	service := NewService(NewRepository(db), cfg, zap.NewNop())
+	var (
+		mu            sync.Mutex
+		notifications []string
+	)
+	service.SetNotifier(func(userID int64, text string) {
+		mu.Lock()
+		defer mu.Unlock()
+		notifications = append(notifications, text)
+	})
+	return service, &notifications
+}
+
+func TestAwardXPRecalculatesLevel(t *testing.T) {
+	service, notifications := newTestService(t, config.LoyaltyConfig{PurchaseXPPerRub: 1}, 3801)
+	ctx := context.Background()
+
+	award, err := service.AwardXP(ctx, 3801, SourceMessage, 400, "Запросы", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if award.Level.Level != 1 || award.LeveledUp {
+		t.Errorf("уровень %d, повышен %v; ожидался прежний уровень 1", award.Level.Level, award.LeveledUp)
+	}
+	progress, err := service.GetProgress(ctx, 3801)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if progress.NextLevel == nil || progress.NextLevel.Level != 5 || progress.XPToNextLevel() != 100 {
+		t.Errorf("до следующего уровня %d опыта (%v), ожидалось 100 до уровня 5", progress.XPToNextLevel(), progress.NextLevel)
+	}
+
+	// Покупка на 500 рублей переводит на следующий уровень, повтор того же платежа опыт не дает
+	award, err = service.AwardPurchase(ctx, 3801, 50000, "pay-1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if award == nil || award.Level.Level != 5 || !award.LeveledUp || award.XP != 900 {
+		t.Fatalf("после покупки %+v, ожидался уровень 5 с 900 опыта", award)
+	}
+	if award, err := service.AwardPurchase(ctx, 3801, 50000, "pay-1"); err != nil || award != nil {
+		t.Errorf("повтор покупки начислил %+v (%v)", award, err)
+	}
+
+	// Большое начисление перескакивает промежуточные пороги
+	award, err = service.AwardXP(ctx, 3801, SourceReferral, 4500, "Приглашенные", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if award.Level.Level != 20 || !award.LeveledUp {
+		t.Errorf("уровень %d, ожидался 20", award.Level.Level)
+	}
+	bonus, err := service.GetBonusPercent(ctx, 3801)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if bonus != 15 {
+		t.Errorf("бонус к ежедневным нейронам %d%%, ожидалось 15%%", bonus)
+	}
+
+	if len(*notifications) != 2 {
+		t.Errorf("уведомлений о новых уровнях %d, ожидалось 2: %v", len(*notifications), *notifications)
+	}
+}
+
+func TestConcurrentAwardsLevelUpOnce(t *testing.T) {
+	service, notifications := newTestService(t, config.LoyaltyConfig{}, 3802)
+	ctx := context.Background()
+
+	if _, err := service.AwardXP(ctx, 3802, SourceMessage, 450, "Запросы", ""); err != nil {
+		t.Fatal(err)
+	}
+
+	// Каждое из параллельных начислений пересекает порог 500, но уровень повышается один раз
+	const workers = 5
+	var wg sync.WaitGroup
+	awards := make([]*Award, workers)
+	errs := make([]error, workers)
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			awards[i], errs[i] = service.AwardXP(ctx, 3802, SourceMessage, 100, "Запрос", "")
+		}(i)
+	}
+	wg.Wait()
+
+	leveledUp := 0
+	for i := range awards {
+		if errs[i] != nil {
+			t.Fatal(errs[i])
+		}
+		if awards[i].LeveledUp {
+			leveledUp++
+		}
+	}
+	if leveledUp != 1 || len(*notifications) != 1 {
+		t.Errorf("повышений %d, уведомлений %d; ожидалось по одному", leveledUp, len(*notifications))
+	}
+
+	progress, err := service.GetProgress(ctx, 3802)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if progress.XP != 950 || progress.Level.Level != 5 {
+		t.Errorf("опыт %d, уровень %d; ожидалось 950 и уровень 5", progress.XP, progress.Level.Level)
+	}
+}
+
+func TestAwardRequestDailyMax(t *testing.T) {
+	service, _ := newTestService(t, config.LoyaltyConfig{RequestXP: 10, RequestXPDailyMax: 25}, 3803)
+	ctx := context.Background()
+
+	// Последнее начисление урезается до остатка лимита, после него опыт за запросы не начисляется
+	for i, want := range []int{10, 10, 5, 0} {
+		award, err := service.AwardRequest(ctx, 3803, "model")
+		if err != nil {
+			t.Fatal(err)
+		}
+		got := 0
+		if award != nil {
+			got = award.Amount
+		}
+		if got != want {
+			t.Errorf("запрос %d: начислено %d опыта, ожидалось %d", i+1, got, want)
+		}
+	}
+}
@@ -0,0 +1,58 @@
+// HTTP-обработчики платежей
+
+package payment
+
+import (
+	"errors"
+	"io"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+)
+
+// maxNotificationSize - максимальный размер тела уведомления
+const maxNotificationSize = 1 << 20
+
+// Handler обрабатывает HTTP-запросы платежных систем
+type Handler struct {
+	service *Service
+	log     *zap.Logger
+}
+
+// NewHandler создает новый обработчик платежей
+func NewHandler(service *Service, log *zap.Logger) *Handler {
+	return &Handler{
+		service: service,
+		log:     log.Named("payment_handler"),
+	}
+}
+
+// RegisterRoutes регистрирует маршруты платежей
+func (h *Handler) RegisterRoutes(group *gin.RouterGroup) {
+	group.POST("/callback", h.handleYooKassaCallback)
+}
+
+// handleYooKassaCallback принимает уведомления ЮKassa
+func (h *Handler) handleYooKassaCallback(c *gin.Context) {
+	payload, err := io.ReadAll(io.LimitReader(c.Request.Body, maxNotificationSize))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "не удалось прочитать тело запроса"})
+		return
+	}
+
+	err = h.service.HandleYooKassaNotification(c.Request.Context(), payload)
+	switch {
+	case err == nil:
+		c.JSON(http.StatusOK, gin.H{"status": "ok"})
+	case errors.Is(err, ErrInvalidNotification):
+		c.JSON(http.StatusBadRequest, gin.H{"error": "некорректное уведомление"})
+	case errors.Is(err, ErrUnknownPayment):
+		// Повторная доставка не поможет, поэтому подтверждаем получение
+		c.JSON(http.StatusOK, gin.H{"status": "ignored"})
+	default:
+		h.log.Error("Ошибка обработки уведомления ЮKassa", zap.Error(err))
+		// Код ошибки заставит ЮKassa повторить уведомление позже
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "ошибка обработки уведомления"})
+	}
+}
@@ -0,0 +1,156 @@
+// Модель платежей
+
+package payment
+
+import (
+	"database/sql/driver"
+	"encoding/json"
+	"errors"
+	"time"
+)
+
+// Status представляет статус платежа
+type Status string
+
+const (
+	StatusPending   Status = "pending"
+	StatusSucceeded Status = "succeeded"
+	StatusFailed    Status = "failed"
+	StatusCanceled  Status = "canceled"
+	StatusRefunded  Status = "refunded" // Деньги возвращены пользователю
+)
+
+// Type представляет тип оплачиваемого товара
+type Type string
+
+const (
+	TypeSubscription Type = "subscription" // Подписка
+	TypeNeurons      Type = "neurons"      // Пакет нейронов
+)
+
+// Провайдеры платежей
+const (
+	ProviderYooKassa      = "yookassa"
+	ProviderTelegramCard  = "telegram"       // Оплата картой через Telegram Payments
+	ProviderTelegramStars = "telegram_stars" // Оплата Telegram Stars
+)
+
+// Валюты счетов Telegram Payments
+const (
+	CurrencyRUB   = "RUB"
+	CurrencyStars = "XTR"
+)
+
+// Metadata представляет дополнительные данные платежа
+type Metadata map[string]interface{}
+
+// Value реализует интерфейс driver.Valuer для конвертации в JSONB
+func (m Metadata) Value() (driver.Value, error) {
+	if m == nil {
+		return nil, nil
+	}
+	return json.Marshal(m)
+}
+
+// Scan реализует интерфейс sql.Scanner для чтения из JSONB
+func (m *Metadata) Scan(value interface{}) error {
+	if value == nil {
+		*m = nil
+		return nil
+	}
+
+	var data []byte
+	switch v := value.(type) {
+	case []byte:
+		data = v
+	case string:
+		data = []byte(v)
+	default:
+		return errors.New("тип данных не поддерживается для Metadata.Scan")
+	}
+
+	return json.Unmarshal(data, m)
+}
+
+// GetString возвращает строковое значение из метаданных
+func (m Metadata) GetString(key string) string {
+	if value, ok := m[key].(string); ok {
+		return value
+	}
+	return ""
+}
+
+// GetInt возвращает целое значение из метаданных
+func (m Metadata) GetInt(key string) int {
+	switch value := m[key].(type) {
+	case int:
+		return value
+	case int64:
+		return int(value)
+	case float64:
+		return int(value)
+	}
+	return 0
+}
+
+// Payment представляет платеж пользователя
+type Payment struct {
+	ID              int64      `db:"id"`
+	UserID          int64      `db:"user_id"`
+	ExternalID      string     `db:"external_id"` // ID платежа у провайдера
+	PaymentType     Type       `db:"payment_type"`
+	ItemID          int        `db:"item_id"` // ID плана подписки или пакета нейронов
+	Amount          int        `db:"amount"`  // Сумма в копейках
+	Status          Status     `db:"status"`
+	PaymentMethod   string     `db:"payment_method"`
+	PaymentProvider string     `db:"payment_provider"`
+	PaymentURL      string     `db:"payment_url"`
+	Metadata        Metadata   `db:"metadata"`
+	ExpiresAt       *time.Time `db:"expires_at"`
+	FulfilledAt     *time.Time `db:"fulfilled_at"` // Когда товар был выдан пользователю
+	RefundedAt      *time.Time `db:"refunded_at"`  // Когда платеж был возвращен
+	CreatedAt       time.Time  `db:"created_at"`
+	UpdatedAt       time.Time  `db:"updated_at"`
+}
+
+// GetAmountRub возвращает сумму платежа в рублях
+func (p *Payment) GetAmountRub() float64 {
+	return float64(p.Amount) / 100.0
+}
+
+// IsRenewal возвращает true, если платеж списан за продление существующей подписки
+func (p *Payment) IsRenewal() bool {
+	return p.GetSubscriptionID() != 0
+}
+
+// GetSubscriptionID возвращает ID продлеваемой подписки
+func (p *Payment) GetSubscriptionID() int64 {
+	return int64(p.Metadata.GetInt("subscription_id"))
+}
+
+// SavedMethod представляет сохраненный способ оплаты для автопродления
+type SavedMethod struct {
+	ID         int64     `db:"id"`
+	UserID     int64     `db:"user_id"`
+	Provider   string    `db:"provider"`
+	ExternalID string    `db:"external_id"` // ID способа оплаты у провайдера
+	MethodType string    `db:"method_type"`
+	Title      string    `db:"title"`
+	IsActive   bool      `db:"is_active"`
+	CreatedAt  time.Time `db:"created_at"`
+	UpdatedAt  time.Time `db:"updated_at"`
+}
+
+// Notification представляет уведомление от платежной системы
+type Notification struct {
+	ID               int64           `db:"id"`
+	PaymentID        *int64          `db:"payment_id"`
+	Provider         string          `db:"provider"`
+	ExternalID       string          `db:"external_id"`
+	NotificationType string          `db:"notification_type"`
+	Payload          json.RawMessage `db:"payload"`
+	IsProcessed      bool            `db:"is_processed"`
+	ErrorMessage     string          `db:"error_message"`
+	ProcessedAt      *time.Time      `db:"processed_at"`
+	CreatedAt        time.Time       `db:"created_at"`
+}
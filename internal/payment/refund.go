@@ -0,0 +1,240 @@
+// Возврат платежей
+
+package payment
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+
+	"go.uber.org/zap"
+
+	"neurobot-prod/internal/currency"
+)
+
+// ErrNotRefundable возвращается при попытке вернуть неоплаченный или уже возвращенный платеж
+var ErrNotRefundable = errors.New("платеж не оплачен или уже возвращен")
+
+// StarsRefunder возвращает пользователю оплату Telegram Stars по ID списания
+type StarsRefunder func(userID int64, chargeID string) error
+
+// RefundResult представляет результат возврата платежа
+type RefundResult struct {
+	Payment               *Payment
+	ProviderRefundID      string // ID возврата у провайдера
+	Manual                bool   // Деньги нужно вернуть вручную в кабинете провайдера
+	NeuronsCredited       int    // Нейронов было начислено по платежу
+	NeuronsReversed       int    // Нейронов списано при возврате
+	SubscriptionCancelled bool
+}
+
+// SetStarsRefunder включает автоматический возврат оплаты Telegram Stars
+func (s *Service) SetStarsRefunder(refund StarsRefunder) {
+	s.refundStars = refund
+}
+
+// RefundPayment возвращает пользователю деньги за платеж и отзывает выданный товар.
+// Начисленные нейроны списываются в пределах баланса, подписка, оформленная платежом, отменяется
+func (s *Service) RefundPayment(ctx context.Context, paymentID int64, comment string) (*RefundResult, error) {
+	p, err := s.repo.GetPaymentByID(ctx, paymentID)
+	if err != nil {
+		return nil, err
+	}
+	if p == nil {
+		return nil, ErrUnknownPayment
+	}
+
+	return s.refund(ctx, p, comment, "")
+}
+
+// refund возвращает платеж ровно один раз. Если providerRefundID не пуст,
+// деньги уже возвращены на стороне провайдера и остается только отозвать товар
+func (s *Service) refund(ctx context.Context, p *Payment, comment, providerRefundID string) (*RefundResult, error) {
+	claimed, err := s.repo.ClaimRefund(ctx, p.ID)
+	if err != nil {
+		return nil, err
+	}
+	if !claimed {
+		return nil, ErrNotRefundable
+	}
+
+	result := &RefundResult{Payment: p, ProviderRefundID: providerRefundID}
+
+	if providerRefundID == "" {
+		result.ProviderRefundID, result.Manual, err = s.refundAtProvider(ctx, p, comment)
+		if err != nil {
+			// Деньги не возвращены, поэтому платеж остается успешным
+			if releaseErr := s.repo.ReleaseRefund(ctx, p.ID); releaseErr != nil {
+				s.log.Error("Ошибка снятия отметки возврата платежа",
+					zap.Int64("payment_id", p.ID),
+					zap.Error(releaseErr))
+			}
+			s.log.Error("Ошибка возврата платежа у провайдера",
+				zap.Int64("payment_id", p.ID),
+				zap.String("provider", p.PaymentProvider),
+				zap.Error(err))
+			return nil, fmt.Errorf("ошибка возврата платежа: %w", err)
+		}
+	}
+
+	if result.ProviderRefundID != "" {
+		if err := s.repo.SetRefundExternalID(ctx, p.ID, result.ProviderRefundID); err != nil {
+			s.log.Error("Ошибка сохранения ID возврата",
+				zap.Int64("payment_id", p.ID),
+				zap.Error(err))
+		}
+	}
+
+	// Деньги уже возвращены, поэтому ошибки отзыва товара только записываются в журнал
+	if p.FulfilledAt != nil {
+		s.revokeItem(ctx, p, result)
+	}
+
+	s.log.Info("Платеж возвращен",
+		zap.Int64("payment_id", p.ID),
+		zap.Int64("user_id", p.UserID),
+		zap.String("provider", p.PaymentProvider),
+		zap.Bool("manual", result.Manual),
+		zap.Int("neurons_reversed", result.NeuronsReversed),
+		zap.Bool("subscription_cancelled", result.SubscriptionCancelled))
+
+	text := fmt.Sprintf("↩️ Платеж на %.2f ₽ возвращен.", p.GetAmountRub())
+	if result.NeuronsReversed > 0 {
+		text += fmt.Sprintf("\nСписано %d нейронов, начисленных по этому платежу.", result.NeuronsReversed)
+	}
+	if result.SubscriptionCancelled {
+		text += "\nПодписка, оплаченная этим платежом, отменена."
+	}
+	s.sendNotification(p.UserID, text)
+
+	return result, nil
+}
+
+// refundAtProvider возвращает деньги через платежную систему.
+// Возвращает ID возврата и признак того, что вернуть деньги нужно вручную
+func (s *Service) refundAtProvider(ctx context.Context, p *Payment, comment string) (string, bool, error) {
+	switch p.PaymentProvider {
+	case ProviderYooKassa:
+		description := "Возврат платежа"
+		if comment != "" {
+			description += ": " + comment
+		}
+		refund, err := s.yookassa.CreateRefund(ctx, &YooKassaCreateRefundRequest{
+			PaymentID:   p.ExternalID,
+			Amount:      FormatAmount(p.Amount),
+			Description: description,
+		}, "refund-"+strconv.FormatInt(p.ID, 10))
+		if err != nil {
+			return "", false, err
+		}
+		if refund.Status == "canceled" {
+			return "", false, errors.New("ЮKassa отклонила возврат")
+		}
+		return refund.ID, false, nil
+
+	case ProviderTelegramStars:
+		if s.refundStars == nil {
+			return "", true, nil
+		}
+		if err := s.refundStars(p.UserID, p.ExternalID); err != nil {
+			return "", false, err
+		}
+		return p.ExternalID, false, nil
+
+	default:
+		// Оплата картой через Telegram возвращается в кабинете платежного провайдера
+		return "", true, nil
+	}
+}
+
+// revokeItem отзывает товар, выданный по возвращенному платежу
+func (s *Service) revokeItem(ctx context.Context, p *Payment, result *RefundResult) {
+	switch p.PaymentType {
+	case TypeNeurons:
+		purchase, err := s.currencyService.FindTransaction(ctx, currency.TypePurchase, p.ExternalID)
+		if err != nil || purchase == nil {
+			s.log.Error("Не найдено начисление нейронов по платежу",
+				zap.Int64("payment_id", p.ID),
+				zap.Error(err))
+			return
+		}
+		result.NeuronsCredited = purchase.Amount
+
+		refund, err := s.currencyService.Refund(ctx, purchase.ID, currency.RefundPayment, "payment:"+strconv.FormatInt(p.ID, 10))
+		if err != nil {
+			// Все начисленные нейроны уже потрачены
+			if !errors.Is(err, currency.ErrNothingToRefund) {
+				s.log.Error("Ошибка списания нейронов по возвращенному платежу",
+					zap.Int64("payment_id", p.ID),
+					zap.Error(err))
+			}
+			return
+		}
+		result.NeuronsReversed = -refund.Amount
+
+	case TypeSubscription:
+		sub, err := s.subService.GetActiveSubscription(ctx, p.UserID)
+		if err != nil {
+			s.log.Error("Ошибка получения подписки по возвращенному платежу",
+				zap.Int64("payment_id", p.ID),
+				zap.Error(err))
+			return
+		}
+		// Подписку отменяем, только если ее последний период оплачен этим платежом
+		if sub == nil || sub.PaymentID != p.ExternalID {
+			return
+		}
+		if err := s.subService.CancelSubscription(ctx, p.UserID, sub.ID); err != nil {
+			s.log.Error("Ошибка отмены подписки по возвращенному платежу",
+				zap.Int64("payment_id", p.ID),
+				zap.Error(err))
+			return
+		}
+		result.SubscriptionCancelled = true
+	}
+}
+
+// processYooKassaRefund применяет возврат, оформленный в кабинете ЮKassa.
+// Возврат проверяется запросом к API, поэтому поддельное уведомление не может отозвать товар
+func (s *Service) processYooKassaRefund(ctx context.Context, notification *YooKassaNotification) (*int64, error) {
+	if notification.Object.ID == "" {
+		return nil, errors.New("в уведомлении нет ID возврата")
+	}
+
+	refund, err := s.yookassa.GetRefund(ctx, notification.Object.ID)
+	if err != nil {
+		return nil, fmt.Errorf("ошибка проверки возврата: %w", err)
+	}
+
+	p, err := s.repo.GetPaymentByExternalID(ctx, ProviderYooKassa, refund.PaymentID)
+	if err != nil {
+		return nil, err
+	}
+	if p == nil {
+		s.log.Warn("Уведомление о возврате неизвестного платежа",
+			zap.String("refund_id", refund.ID),
+			zap.String("external_id", refund.PaymentID))
+		return nil, ErrUnknownPayment
+	}
+
+	// Частичные возвраты оформляются вручную и не отзывают товар
+	if refund.Status != "succeeded" || refund.Amount.Value != FormatAmount(p.Amount).Value {
+		s.log.Info("Возврат не применяется автоматически",
+			zap.Int64("payment_id", p.ID),
+			zap.String("refund_id", refund.ID),
+			zap.String("status", refund.Status),
+			zap.String("amount", refund.Amount.Value))
+		return &p.ID, nil
+	}
+
+	if _, err := s.refund(ctx, p, "", refund.ID); err != nil {
+		// Возврат, оформленный через бота, уже применен
+		if errors.Is(err, ErrNotRefundable) {
+			return &p.ID, nil
+		}
+		return &p.ID, err
+	}
+
+	return &p.ID, nil
+}
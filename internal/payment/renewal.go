@@ -0,0 +1,173 @@
+// Списания за автопродление подписок
+
+package payment
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+
+	"go.uber.org/zap"
+
+	"neurobot-prod/internal/subscription"
+)
+
+// Причины отмены ЮKassa, после которых сохраненный способ оплаты больше не работает
+var revokedReasons = map[string]bool{
+	"permission_revoked": true,
+	"card_expired":       true,
+}
+
+// ChargeRenewal списывает оплату за продление подписки сохраненным способом оплаты.
+// Реализует subscription.Charger: при успешном списании подписка продлевается через Fulfill
+func (s *Service) ChargeRenewal(ctx context.Context, sub *subscription.Subscription, amount int) error {
+	// Если прошлое списание еще не завершилось, сначала узнаем его результат, чтобы не списать дважды
+	pending, err := s.repo.GetPendingRenewalPayment(ctx, sub.ID)
+	if err != nil {
+		return err
+	}
+	if pending != nil && pending.ExternalID != "" {
+		external, err := s.yookassa.GetPayment(ctx, pending.ExternalID)
+		if err != nil {
+			return fmt.Errorf("ошибка проверки платежа: %w", err)
+		}
+		return s.applyRenewalResult(ctx, pending, external)
+	}
+
+	// Платеж без ID ЮKassa мог быть создан в ЮKassa, если ответ на запрос не дошел.
+	// Его запрос повторяется с теми же параметрами и ключом идемпотентности, поэтому ЮKassa
+	// вернет уже созданный платеж, а не спишет оплату второй раз
+	p := pending
+	if p == nil {
+		method, err := s.repo.GetActiveMethod(ctx, sub.UserID, ProviderYooKassa)
+		if err != nil {
+			return err
+		}
+		if method == nil {
+			return subscription.ErrNoPaymentMethod
+		}
+
+		p = &Payment{
+			UserID:          sub.UserID,
+			PaymentType:     TypeSubscription,
+			ItemID:          sub.PlanID,
+			Amount:          amount,
+			Status:          StatusPending,
+			PaymentProvider: ProviderYooKassa,
+			Metadata: Metadata{
+				"plan_code":          sub.GetRenewalPlan().Code,
+				"plan_name":          sub.GetRenewalPlan().Name,
+				"period":             sub.GetRenewalPeriod(),
+				"subscription_id":    sub.ID,
+				"method_id":          method.ID,
+				"method_external_id": method.ExternalID,
+				"attempt":            sub.RenewalAttempts + 1,
+			},
+		}
+		if err := s.repo.CreatePayment(ctx, p); err != nil {
+			return err
+		}
+	}
+
+	external, err := s.yookassa.CreatePayment(ctx, &YooKassaCreatePaymentRequest{
+		Amount:          FormatAmount(p.Amount),
+		Capture:         true,
+		Description:     fmt.Sprintf("Продление подписки «%s»", p.Metadata.GetString("plan_name")),
+		PaymentMethodID: p.Metadata.GetString("method_external_id"),
+		Metadata: map[string]string{
+			"payment_id":      strconv.FormatInt(p.ID, 10),
+			"user_id":         strconv.FormatInt(p.UserID, 10),
+			"subscription_id": strconv.FormatInt(sub.ID, 10),
+		},
+	}, fmt.Sprintf("neurobot-payment-%d", p.ID))
+	if err != nil {
+		// Платеж отменяется только при явном отказе ЮKassa. После сетевой ошибки или ответа 5xx
+		// он остается в ожидании, и следующая попытка повторит запрос с тем же ключом
+		var apiErr *YooKassaError
+		if !errors.As(err, &apiErr) || !apiErr.Rejected() {
+			s.log.Warn("Результат создания платежа за продление неизвестен",
+				zap.Int64("payment_id", p.ID),
+				zap.Int64("subscription_id", sub.ID),
+				zap.Error(err))
+			return fmt.Errorf("%w: %v", subscription.ErrRenewalPending, err)
+		}
+		if updateErr := s.repo.UpdateStatus(ctx, p.ID, StatusFailed, ""); updateErr != nil {
+			s.log.Error("Ошибка обновления статуса платежа", zap.Error(updateErr))
+		}
+		return fmt.Errorf("ошибка создания платежа: %w", err)
+	}
+
+	p.ExternalID = external.ID
+	if err := s.repo.SetExternalInfo(ctx, p.ID, p.ExternalID, "", nil); err != nil {
+		return err
+	}
+
+	s.log.Info("Создан платеж за продление подписки",
+		zap.Int64("user_id", p.UserID),
+		zap.Int64("payment_id", p.ID),
+		zap.Int64("subscription_id", sub.ID),
+		zap.String("status", external.Status))
+
+	return s.applyRenewalResult(ctx, p, external)
+}
+
+// applyRenewalResult применяет статус платежа ЮKassa к платежу за продление
+func (s *Service) applyRenewalResult(ctx context.Context, p *Payment, external *YooKassaPayment) error {
+	paymentMethod := ""
+	if external.PaymentMethod != nil {
+		paymentMethod = external.PaymentMethod.Type
+	}
+
+	switch external.Status {
+	case "succeeded":
+		if err := s.repo.UpdateStatus(ctx, p.ID, StatusSucceeded, paymentMethod); err != nil {
+			return err
+		}
+		p.Status = StatusSucceeded
+		return s.Fulfill(ctx, p)
+
+	case "canceled":
+		if err := s.repo.UpdateStatus(ctx, p.ID, StatusCanceled, paymentMethod); err != nil {
+			return err
+		}
+
+		reason := "unknown"
+		if external.CancellationDetails != nil {
+			reason = external.CancellationDetails.Reason
+		}
+
+		// Отозванную или истекшую карту больше не пытаемся использовать
+		if revokedReasons[reason] {
+			if methodID := p.Metadata.GetInt("method_id"); methodID != 0 {
+				if err := s.repo.DeactivateMethod(ctx, int64(methodID)); err != nil {
+					s.log.Error("Ошибка отключения способа оплаты", zap.Error(err))
+				}
+			}
+		}
+
+		return fmt.Errorf("платеж отклонен: %s", reason)
+	}
+
+	return subscription.ErrRenewalPending
+}
+
+// saveMethod сохраняет способ оплаты, если ЮKassa разрешила повторные списания
+func (s *Service) saveMethod(ctx context.Context, userID int64, method *YooKassaPaymentMethod) {
+	if method == nil || !method.Saved || method.ID == "" {
+		return
+	}
+
+	err := s.repo.SaveMethod(ctx, &SavedMethod{
+		UserID:     userID,
+		Provider:   ProviderYooKassa,
+		ExternalID: method.ID,
+		MethodType: method.Type,
+		Title:      method.Title,
+	})
+	if err != nil {
+		s.log.Error("Ошибка сохранения способа оплаты",
+			zap.Int64("user_id", userID),
+			zap.Error(err))
+	}
+}
@@ -0,0 +1,167 @@
+// Тесты списаний за автопродление подписок
+
+package payment
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"go.uber.org/zap"
+
+	"neurobot-prod/internal/config"
+	"neurobot-prod/internal/currency"
+	"neurobot-prod/internal/storage/postgres/pgtest"
+	"neurobot-prod/internal/subscription"
+)
+
+// fakeRenewalAPI отвечает на создание платежа заданными по очереди кодами ответа
+// и запоминает ключи идемпотентности запросов
+type fakeRenewalAPI struct {
+	mu       sync.Mutex
+	server   *httptest.Server
+	statuses []int // Коды ответа на очередные запросы, после них - 200
+	keys     []string
+}
+
+func newFakeRenewalAPI(t *testing.T, statuses ...int) *fakeRenewalAPI {
+	f := &fakeRenewalAPI{statuses: statuses}
+	f.server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost || r.URL.Path != "/payments" {
+			http.NotFound(w, r)
+			return
+		}
+
+		var req YooKassaCreatePaymentRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		f.mu.Lock()
+		f.keys = append(f.keys, r.Header.Get("Idempotence-Key"))
+		code := http.StatusOK
+		if len(f.statuses) > 0 {
+			code, f.statuses = f.statuses[0], f.statuses[1:]
+		}
+		f.mu.Unlock()
+
+		if code != http.StatusOK {
+			http.Error(w, `{"type":"error"}`, code)
+			return
+		}
+		json.NewEncoder(w).Encode(YooKassaPayment{
+			ID:            "yk-renewal-" + req.Metadata["payment_id"],
+			Status:        "succeeded",
+			Paid:          true,
+			Amount:        req.Amount,
+			PaymentMethod: &YooKassaPaymentMethod{Type: "bank_card"},
+		})
+	}))
+	t.Cleanup(f.server.Close)
+	return f
+}
+
+// newRenewalTestService создает сервис платежей и подписку с сохраненной картой, срок которой подходит к концу
+func newRenewalTestService(t *testing.T, api *fakeRenewalAPI) (*Service, *subscription.Subscription) {
+	db := pgtest.Open(t)
+	pgtest.CreateUser(t, db, testUserID)
+	ctx := context.Background()
+
+	log := zap.NewNop()
+	subRepo := subscription.NewRepository(db)
+	subService := subscription.NewService(subRepo, log)
+	currencyService := currency.NewService(currency.NewRepository(db), subService, log)
+	cfg := config.PaymentConfig{YooKassa: config.YooKassaConfig{APIURL: api.server.URL, ShopID: "shop", SecretKey: "secret"}}
+	service := NewService(NewRepository(db), cfg, subService, currencyService, log)
+
+	plan, err := subRepo.GetPlanByCode(ctx, "premium")
+	if err != nil {
+		t.Fatal(err)
+	}
+	end := time.Now().Add(12 * time.Hour)
+	if err := subRepo.CreateSubscription(ctx, &subscription.Subscription{
+		UserID: testUserID, PlanID: plan.ID, Status: subscription.StatusActive, StartDate: end.AddDate(0, -1, 0),
+		EndDate: end, AutoRenew: true, PaymentID: "yk-first", PaymentMethod: ProviderYooKassa, Period: "monthly",
+	}); err != nil {
+		t.Fatal(err)
+	}
+	if err := service.repo.SaveMethod(ctx, &SavedMethod{
+		UserID: testUserID, Provider: ProviderYooKassa, ExternalID: "card-1", MethodType: "bank_card",
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	sub, err := subService.GetActiveSubscription(ctx, testUserID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return service, sub
+}
+
+func TestChargeRenewalRetriesUnknownResult(t *testing.T) {
+	api := newFakeRenewalAPI(t, http.StatusInternalServerError)
+	service, sub := newRenewalTestService(t, api)
+	ctx := context.Background()
+
+	// Ответ 500 не означает отказ: платеж остается в ожидании
+	err := service.ChargeRenewal(ctx, sub, sub.Plan.PriceMonthly)
+	if !errors.Is(err, subscription.ErrRenewalPending) {
+		t.Fatalf("ошибка %v, ожидалась %v", err, subscription.ErrRenewalPending)
+	}
+	pending, err := service.repo.GetPendingRenewalPayment(ctx, sub.ID)
+	if err != nil || pending == nil {
+		t.Fatalf("платеж за продление не остался в ожидании: %v", err)
+	}
+
+	// Повтор использует тот же платеж и ключ идемпотентности
+	if err := service.ChargeRenewal(ctx, sub, sub.Plan.PriceMonthly); err != nil {
+		t.Fatal(err)
+	}
+	if len(api.keys) != 2 || api.keys[0] != api.keys[1] {
+		t.Errorf("ключи идемпотентности запросов %v, ожидался один и тот же ключ", api.keys)
+	}
+
+	p, err := service.repo.GetPaymentByID(ctx, pending.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if p.Status != StatusSucceeded || p.FulfilledAt == nil {
+		t.Errorf("платеж %s, выдан %v; ожидался выданный успешный платеж", p.Status, p.FulfilledAt)
+	}
+	renewed, err := service.subService.GetActiveSubscription(ctx, testUserID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := sub.EndDate.AddDate(0, 1, 0); !renewed.EndDate.Equal(want) {
+		t.Errorf("подписка продлена до %s, ожидалось %s", renewed.EndDate, want)
+	}
+}
+
+func TestChargeRenewalRejected(t *testing.T) {
+	api := newFakeRenewalAPI(t, http.StatusBadRequest, http.StatusOK)
+	service, sub := newRenewalTestService(t, api)
+	ctx := context.Background()
+
+	// Явный отказ ЮKassa завершает платеж, и продление уходит в повторные попытки по расписанию
+	err := service.ChargeRenewal(ctx, sub, sub.Plan.PriceMonthly)
+	if err == nil || errors.Is(err, subscription.ErrRenewalPending) {
+		t.Fatalf("ошибка %v, ожидался отказ", err)
+	}
+	if pending, err := service.repo.GetPendingRenewalPayment(ctx, sub.ID); err != nil || pending != nil {
+		t.Fatalf("после отказа остался ожидающий платеж: %v, %v", pending, err)
+	}
+
+	// Следующая попытка создает новый платеж с новым ключом
+	if err := service.ChargeRenewal(ctx, sub, sub.Plan.PriceMonthly); err != nil {
+		t.Fatal(err)
+	}
+	if len(api.keys) != 2 || api.keys[0] == api.keys[1] {
+		t.Errorf("ключи идемпотентности запросов %v, ожидались разные ключи", api.keys)
+	}
+}
@@ -0,0 +1,424 @@
+// Репозиторий платежей
+
+package payment
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"strconv"
+	"time"
+)
+
+// Repository представляет репозиторий для работы с платежами
+type Repository struct {
+	db *sql.DB
+}
+
+// NewRepository создает новый репозиторий платежей
+func NewRepository(db *sql.DB) *Repository {
+	return &Repository{
+		db: db,
+	}
+}
+
+// paymentColumns - список колонок для выборки платежа
+const paymentColumns = `
+	id, user_id, COALESCE(external_id, ''), payment_type, COALESCE(item_id, 0), amount, status,
+	COALESCE(payment_method, ''), payment_provider, COALESCE(payment_url, ''), metadata,
+	expires_at, fulfilled_at, refunded_at, created_at, updated_at
+`
+
+// scanPayment сканирует платеж из результата запроса
+func scanPayment(row *sql.Row) (*Payment, error) {
+	p := &Payment{}
+	err := row.Scan(
+		&p.ID,
+		&p.UserID,
+		&p.ExternalID,
+		&p.PaymentType,
+		&p.ItemID,
+		&p.Amount,
+		&p.Status,
+		&p.PaymentMethod,
+		&p.PaymentProvider,
+		&p.PaymentURL,
+		&p.Metadata,
+		&p.ExpiresAt,
+		&p.FulfilledAt,
+		&p.RefundedAt,
+		&p.CreatedAt,
+		&p.UpdatedAt,
+	)
+
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, nil // Платеж не найден
+		}
+		return nil, fmt.Errorf("ошибка получения платежа: %w", err)
+	}
+
+	return p, nil
+}
+
+// CreatePayment создает новый платеж
+func (r *Repository) CreatePayment(ctx context.Context, p *Payment) error {
+	query := `
+		INSERT INTO payments (
+			user_id, external_id, payment_type, item_id, amount, status,
+			payment_method, payment_provider, payment_url, metadata, expires_at,
+			created_at, updated_at
+		) VALUES ($1, NULLIF($2, ''), $3, $4, $5, $6, NULLIF($7, ''), $8, NULLIF($9, ''), $10, $11, NOW(), NOW())
+		RETURNING id, created_at, updated_at
+	`
+
+	err := r.db.QueryRowContext(ctx, query,
+		p.UserID,
+		p.ExternalID,
+		p.PaymentType,
+		p.ItemID,
+		p.Amount,
+		p.Status,
+		p.PaymentMethod,
+		p.PaymentProvider,
+		p.PaymentURL,
+		p.Metadata,
+		p.ExpiresAt,
+	).Scan(&p.ID, &p.CreatedAt, &p.UpdatedAt)
+	if err != nil {
+		return fmt.Errorf("ошибка создания платежа: %w", err)
+	}
+
+	return nil
+}
+
+// GetPaymentByID находит платеж по ID
+func (r *Repository) GetPaymentByID(ctx context.Context, paymentID int64) (*Payment, error) {
+	query := `SELECT ` + paymentColumns + ` FROM payments WHERE id = $1`
+	return scanPayment(r.db.QueryRowContext(ctx, query, paymentID))
+}
+
+// GetPaymentByExternalID находит платеж по ID у провайдера
+func (r *Repository) GetPaymentByExternalID(ctx context.Context, provider, externalID string) (*Payment, error) {
+	query := `SELECT ` + paymentColumns + ` FROM payments WHERE payment_provider = $1 AND external_id = $2`
+	return scanPayment(r.db.QueryRowContext(ctx, query, provider, externalID))
+}
+
+// SetExternalInfo сохраняет данные платежа, полученные от провайдера
+func (r *Repository) SetExternalInfo(ctx context.Context, paymentID int64, externalID, paymentURL string, expiresAt *time.Time) error {
+	query := `
+		UPDATE payments
+		SET external_id = $1, payment_url = NULLIF($2, ''), expires_at = COALESCE($3, expires_at), updated_at = NOW()
+		WHERE id = $4
+	`
+
+	_, err := r.db.ExecContext(ctx, query, externalID, paymentURL, expiresAt, paymentID)
+	if err != nil {
+		return fmt.Errorf("ошибка сохранения данных провайдера: %w", err)
+	}
+
+	return nil
+}
+
+// UpdateStatus обновляет статус платежа и способ оплаты.
+// Успешный платеж не может быть переведен в другой статус, а возвращенный не меняет статус
+func (r *Repository) UpdateStatus(ctx context.Context, paymentID int64, status Status, paymentMethod string) error {
+	query := `
+		UPDATE payments
+		SET status = $1, payment_method = COALESCE(NULLIF($2, ''), payment_method), updated_at = NOW()
+		WHERE id = $3 AND status <> 'refunded' AND (status <> 'succeeded' OR $1 = 'succeeded')
+	`
+
+	_, err := r.db.ExecContext(ctx, query, status, paymentMethod, paymentID)
+	if err != nil {
+		return fmt.Errorf("ошибка обновления статуса платежа: %w", err)
+	}
+
+	return nil
+}
+
+// CancelStalePending отменяет неоплаченные платежи с истекшим сроком оплаты,
+// а платежи без срока - созданные раньше before
+func (r *Repository) CancelStalePending(ctx context.Context, before time.Time) (int, error) {
+	result, err := r.db.ExecContext(ctx, `
+		UPDATE payments
+		SET status = $1, updated_at = NOW()
+		WHERE status = $2
+			AND (expires_at < NOW() OR (expires_at IS NULL AND created_at < $3))
+	`, StatusCanceled, StatusPending, before)
+	if err != nil {
+		return 0, fmt.Errorf("ошибка отмены неоплаченных платежей: %w", err)
+	}
+
+	count, err := result.RowsAffected()
+	if err != nil {
+		return 0, fmt.Errorf("ошибка получения количества отмененных платежей: %w", err)
+	}
+	return int(count), nil
+}
+
+// ClaimFulfillment атомарно отмечает начало выдачи товара по платежу. Выдачу, начатую
+// раньше lease назад и так и не завершенную, можно взять повторно.
+// Возвращает false, если товар уже выдан или выдается сейчас
+func (r *Repository) ClaimFulfillment(ctx context.Context, paymentID int64, lease time.Duration) (bool, error) {
+	query := `
+		UPDATE payments
+		SET fulfillment_started_at = NOW(), updated_at = NOW()
+		WHERE id = $1 AND status = 'succeeded' AND fulfilled_at IS NULL
+		  AND (fulfillment_started_at IS NULL OR fulfillment_started_at < NOW() - make_interval(secs => $2))
+	`
+
+	result, err := r.db.ExecContext(ctx, query, paymentID, lease.Seconds())
+	if err != nil {
+		return false, fmt.Errorf("ошибка отметки выдачи платежа: %w", err)
+	}
+
+	rows, err := result.RowsAffected()
+	if err != nil {
+		return false, fmt.Errorf("ошибка получения количества обновленных строк: %w", err)
+	}
+
+	return rows == 1, nil
+}
+
+// CompleteFulfillment отмечает товар по платежу как выданный
+func (r *Repository) CompleteFulfillment(ctx context.Context, paymentID int64) error {
+	query := `
+		UPDATE payments
+		SET fulfilled_at = NOW(), fulfillment_started_at = NULL, updated_at = NOW()
+		WHERE id = $1 AND fulfilled_at IS NULL
+	`
+
+	_, err := r.db.ExecContext(ctx, query, paymentID)
+	if err != nil {
+		return fmt.Errorf("ошибка отметки выдачи платежа: %w", err)
+	}
+
+	return nil
+}
+
+// ReleaseFulfillment снимает отметку о начале выдачи, если выдать товар не удалось
+func (r *Repository) ReleaseFulfillment(ctx context.Context, paymentID int64) error {
+	query := `
+		UPDATE payments
+		SET fulfillment_started_at = NULL, updated_at = NOW()
+		WHERE id = $1 AND fulfilled_at IS NULL
+	`
+
+	_, err := r.db.ExecContext(ctx, query, paymentID)
+	if err != nil {
+		return fmt.Errorf("ошибка снятия отметки выдачи платежа: %w", err)
+	}
+
+	return nil
+}
+
+// GetUnfulfilledPayments возвращает успешные платежи без выданного товара, которые
+// не менялись с момента before: выдача завершилась ошибкой или была прервана
+func (r *Repository) GetUnfulfilledPayments(ctx context.Context, before time.Time, limit int) ([]*Payment, error) {
+	query := `
+		SELECT id FROM payments
+		WHERE status = 'succeeded' AND fulfilled_at IS NULL AND updated_at < $1
+		ORDER BY updated_at
+		LIMIT $2
+	`
+
+	rows, err := r.db.QueryContext(ctx, query, before, limit)
+	if err != nil {
+		return nil, fmt.Errorf("ошибка получения невыданных платежей: %w", err)
+	}
+	defer rows.Close()
+
+	var ids []int64
+	for rows.Next() {
+		var id int64
+		if err := rows.Scan(&id); err != nil {
+			return nil, fmt.Errorf("ошибка сканирования платежа: %w", err)
+		}
+		ids = append(ids, id)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("ошибка при итерации по платежам: %w", err)
+	}
+
+	payments := make([]*Payment, 0, len(ids))
+	for _, id := range ids {
+		p, err := r.GetPaymentByID(ctx, id)
+		if err != nil {
+			return nil, err
+		}
+		if p != nil {
+			payments = append(payments, p)
+		}
+	}
+
+	return payments, nil
+}
+
+// ClaimRefund атомарно переводит успешный платеж в статус возвращенного.
+// Возвращает false, если платеж не оплачен или уже возвращен
+func (r *Repository) ClaimRefund(ctx context.Context, paymentID int64) (bool, error) {
+	query := `
+		UPDATE payments
+		SET status = 'refunded', refunded_at = NOW(), updated_at = NOW()
+		WHERE id = $1 AND status = 'succeeded' AND refunded_at IS NULL
+	`
+
+	result, err := r.db.ExecContext(ctx, query, paymentID)
+	if err != nil {
+		return false, fmt.Errorf("ошибка отметки возврата платежа: %w", err)
+	}
+
+	rows, err := result.RowsAffected()
+	if err != nil {
+		return false, fmt.Errorf("ошибка получения количества обновленных строк: %w", err)
+	}
+
+	return rows == 1, nil
+}
+
+// ReleaseRefund возвращает платежу статус успешного, если вернуть деньги не удалось
+func (r *Repository) ReleaseRefund(ctx context.Context, paymentID int64) error {
+	query := `
+		UPDATE payments
+		SET status = 'succeeded', refunded_at = NULL, updated_at = NOW()
+		WHERE id = $1 AND status = 'refunded'
+	`
+
+	_, err := r.db.ExecContext(ctx, query, paymentID)
+	if err != nil {
+		return fmt.Errorf("ошибка снятия отметки возврата платежа: %w", err)
+	}
+
+	return nil
+}
+
+// SetRefundExternalID сохраняет ID возврата у провайдера
+func (r *Repository) SetRefundExternalID(ctx context.Context, paymentID int64, refundID string) error {
+	query := `UPDATE payments SET refund_external_id = $1, updated_at = NOW() WHERE id = $2`
+
+	_, err := r.db.ExecContext(ctx, query, refundID, paymentID)
+	if err != nil {
+		return fmt.Errorf("ошибка сохранения ID возврата: %w", err)
+	}
+
+	return nil
+}
+
+// SaveNotification сохраняет исходное уведомление платежной системы
+func (r *Repository) SaveNotification(ctx context.Context, n *Notification) error {
+	query := `
+		INSERT INTO payment_notifications (provider, external_id, notification_type, payload, created_at)
+		VALUES ($1, NULLIF($2, ''), $3, $4, NOW())
+		RETURNING id, created_at
+	`
+
+	err := r.db.QueryRowContext(ctx, query,
+		n.Provider,
+		n.ExternalID,
+		n.NotificationType,
+		[]byte(n.Payload),
+	).Scan(&n.ID, &n.CreatedAt)
+	if err != nil {
+		return fmt.Errorf("ошибка сохранения уведомления: %w", err)
+	}
+
+	return nil
+}
+
+// MarkNotificationProcessed отмечает уведомление обработанным
+func (r *Repository) MarkNotificationProcessed(ctx context.Context, notificationID int64, paymentID *int64, errorMessage string) error {
+	query := `
+		UPDATE payment_notifications
+		SET payment_id = $1, is_processed = ($2 = ''), error_message = NULLIF($2, ''), processed_at = NOW()
+		WHERE id = $3
+	`
+
+	_, err := r.db.ExecContext(ctx, query, paymentID, errorMessage, notificationID)
+	if err != nil {
+		return fmt.Errorf("ошибка обновления уведомления: %w", err)
+	}
+
+	return nil
+}
+
+// GetPendingRenewalPayment находит незавершенный платеж за продление подписки
+func (r *Repository) GetPendingRenewalPayment(ctx context.Context, subscriptionID int64) (*Payment, error) {
+	query := `
+		SELECT ` + paymentColumns + `
+		FROM payments
+		WHERE payment_type = $1 AND status = $2 AND metadata->>'subscription_id' = $3
+		ORDER BY created_at DESC
+		LIMIT 1
+	`
+	return scanPayment(r.db.QueryRowContext(ctx, query, TypeSubscription, StatusPending, strconv.FormatInt(subscriptionID, 10)))
+}
+
+// SaveMethod сохраняет способ оплаты пользователя. Повторное сохранение делает его снова активным
+func (r *Repository) SaveMethod(ctx context.Context, m *SavedMethod) error {
+	query := `
+		INSERT INTO saved_payment_methods (user_id, provider, external_id, method_type, title, is_active, created_at, updated_at)
+		VALUES ($1, $2, $3, NULLIF($4, ''), NULLIF($5, ''), true, NOW(), NOW())
+		ON CONFLICT (provider, external_id) DO UPDATE
+		SET is_active = true, title = EXCLUDED.title, updated_at = NOW()
+		RETURNING id, is_active, created_at, updated_at
+	`
+
+	err := r.db.QueryRowContext(ctx, query,
+		m.UserID,
+		m.Provider,
+		m.ExternalID,
+		m.MethodType,
+		m.Title,
+	).Scan(&m.ID, &m.IsActive, &m.CreatedAt, &m.UpdatedAt)
+	if err != nil {
+		return fmt.Errorf("ошибка сохранения способа оплаты: %w", err)
+	}
+
+	return nil
+}
+
+// GetActiveMethod возвращает последний сохраненный активный способ оплаты пользователя
+func (r *Repository) GetActiveMethod(ctx context.Context, userID int64, provider string) (*SavedMethod, error) {
+	query := `
+		SELECT id, user_id, provider, external_id, COALESCE(method_type, ''), COALESCE(title, ''),
+		       is_active, created_at, updated_at
+		FROM saved_payment_methods
+		WHERE user_id = $1 AND provider = $2 AND is_active = true
+		ORDER BY updated_at DESC
+		LIMIT 1
+	`
+
+	m := &SavedMethod{}
+	err := r.db.QueryRowContext(ctx, query, userID, provider).Scan(
+		&m.ID,
+		&m.UserID,
+		&m.Provider,
+		&m.ExternalID,
+		&m.MethodType,
+		&m.Title,
+		&m.IsActive,
+		&m.CreatedAt,
+		&m.UpdatedAt,
+	)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("ошибка получения способа оплаты: %w", err)
+	}
+
+	return m, nil
+}
+
+// DeactivateMethod отключает сохраненный способ оплаты
+func (r *Repository) DeactivateMethod(ctx context.Context, methodID int64) error {
+	query := `UPDATE saved_payment_methods SET is_active = false, updated_at = NOW() WHERE id = $1`
+
+	_, err := r.db.ExecContext(ctx, query, methodID)
+	if err != nil {
+		return fmt.Errorf("ошибка отключения способа оплаты: %w", err)
+	}
+
+	return nil
+}
@@ -0,0 +1,569 @@
+// Сервис платежей
+
+package payment
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"go.uber.org/zap"
+
+	"neurobot-prod/internal/config"
+	"neurobot-prod/internal/currency"
+	"neurobot-prod/internal/loyalty"
+	"neurobot-prod/internal/promo"
+	"neurobot-prod/internal/referral"
+	"neurobot-prod/internal/subscription"
+)
+
+var (
+	// ErrUnknownPayment возвращается для уведомлений о платежах, которых нет в базе
+	ErrUnknownPayment = errors.New("платеж не найден")
+	// ErrInvalidNotification возвращается для уведомлений, которые не удалось разобрать
+	ErrInvalidNotification = errors.New("некорректное уведомление")
+)
+
+// Notifier отправляет пользователю сообщение о результате оплаты
+type Notifier func(userID int64, text string)
+
+// Service предоставляет методы для работы с платежами
+type Service struct {
+	repo            *Repository
+	yookassa        *YooKassaClient
+	config          config.PaymentConfig
+	subService      *subscription.Service
+	currencyService *currency.Service
+	promoService    *promo.Service
+	referralService *referral.Service
+	loyaltyService  *loyalty.Service
+	refundStars     StarsRefunder
+	notify          Notifier
+	log             *zap.Logger
+}
+
+// NewService создает новый сервис платежей
+func NewService(repo *Repository, cfg config.PaymentConfig, subService *subscription.Service, currencyService *currency.Service, log *zap.Logger) *Service {
+	return &Service{
+		repo:            repo,
+		yookassa:        NewYooKassaClient(cfg.YooKassa, log),
+		config:          cfg,
+		subService:      subService,
+		currencyService: currencyService,
+		log:             log.Named("payment_service"),
+	}
+}
+
+// SetNotifier устанавливает функцию уведомления пользователей об оплате
+func (s *Service) SetNotifier(notify Notifier) {
+	s.notify = notify
+}
+
+// SetPromo включает скидки по промокодам при оплате подписок
+func (s *Service) SetPromo(promoService *promo.Service) {
+	s.promoService = promoService
+}
+
+// SetReferrals включает вознаграждение пригласивших за покупки рефералов
+func (s *Service) SetReferrals(referralService *referral.Service) {
+	s.referralService = referralService
+}
+
+// SetLoyalty включает начисление опыта за покупки
+func (s *Service) SetLoyalty(loyaltyService *loyalty.Service) {
+	s.loyaltyService = loyaltyService
+}
+
+// CreateSubscriptionPayment создает платеж ЮKassa за подписку
+func (s *Service) CreateSubscriptionPayment(ctx context.Context, userID int64, planCode, period string) (*Payment, error) {
+	p, description, err := s.newSubscriptionPayment(ctx, userID, planCode, period, ProviderYooKassa)
+	if err != nil {
+		return nil, err
+	}
+
+	return p, s.createYooKassaPayment(ctx, p, description)
+}
+
+// CreatePlanChangePayment создает платеж ЮKassa за повышение плана подписки с учетом остатка текущего периода
+func (s *Service) CreatePlanChangePayment(ctx context.Context, userID int64, planCode, period string, mode subscription.ChangeMode) (*Payment, error) {
+	preview, err := s.subService.PreviewPlanChange(ctx, userID, planCode, period, mode)
+	if err != nil {
+		return nil, err
+	}
+
+	if !preview.IsUpgrade || preview.AmountDue <= 0 {
+		return nil, errors.New("смена плана не требует оплаты")
+	}
+
+	p := &Payment{
+		UserID:          userID,
+		PaymentType:     TypeSubscription,
+		ItemID:          preview.NewPlan.ID,
+		Amount:          preview.AmountDue,
+		Status:          StatusPending,
+		PaymentProvider: ProviderYooKassa,
+		Metadata: Metadata{
+			"plan_code":   preview.NewPlan.Code,
+			"period":      preview.Period,
+			"change_mode": string(preview.Mode),
+			"credit":      preview.Credit,
+		},
+	}
+
+	description := fmt.Sprintf("Переход на подписку «%s» с зачетом остатка", preview.NewPlan.Name)
+	return p, s.createYooKassaPayment(ctx, p, description)
+}
+
+// CreatePackagePayment создает платеж ЮKassa за пакет нейронов
+func (s *Service) CreatePackagePayment(ctx context.Context, userID int64, packageID int) (*Payment, error) {
+	p, description, err := s.newPackagePayment(ctx, userID, packageID, ProviderYooKassa)
+	if err != nil {
+		return nil, err
+	}
+
+	return p, s.createYooKassaPayment(ctx, p, description)
+}
+
+// newSubscriptionPayment формирует платеж за подписку по текущим ценам плана
+func (s *Service) newSubscriptionPayment(ctx context.Context, userID int64, planCode, period, provider string) (*Payment, string, error) {
+	plan, err := s.subService.GetPlanByCode(ctx, planCode)
+	if err != nil {
+		return nil, "", err
+	}
+
+	if period != "monthly" && period != "yearly" {
+		return nil, "", errors.New("неизвестный период подписки")
+	}
+
+	amount := plan.PriceMonthly
+	periodName := "1 месяц"
+	if period == "yearly" {
+		amount = plan.PriceYearly
+		periodName = "1 год"
+	}
+
+	if amount <= 0 {
+		return nil, "", errors.New("план подписки не требует оплаты")
+	}
+
+	p := &Payment{
+		UserID:          userID,
+		PaymentType:     TypeSubscription,
+		ItemID:          plan.ID,
+		Amount:          amount,
+		Status:          StatusPending,
+		PaymentProvider: provider,
+		Metadata: Metadata{
+			"plan_code": plan.Code,
+			"period":    period,
+		},
+	}
+
+	description := fmt.Sprintf("Подписка «%s» на %s", plan.Name, periodName)
+
+	if s.promoService != nil {
+		discount, err := s.promoService.GetCheckoutDiscount(ctx, userID, plan.ID, amount)
+		if err != nil {
+			return nil, "", err
+		}
+		if discount != nil {
+			p.Amount -= discount.Amount
+			p.Metadata["original_amount"] = amount
+			p.Metadata["promo_usage_id"] = discount.UsageID
+			p.Metadata["promo_code"] = discount.Code
+			description += fmt.Sprintf(" (промокод %s)", discount.Code)
+		}
+	}
+
+	return p, description, nil
+}
+
+// newPackagePayment формирует платеж за пакет нейронов по его текущей цене
+func (s *Service) newPackagePayment(ctx context.Context, userID int64, packageID int, provider string) (*Payment, string, error) {
+	pkg, err := s.currencyService.GetPackage(ctx, packageID)
+	if err != nil {
+		return nil, "", err
+	}
+
+	if !pkg.IsActive {
+		return nil, "", errors.New("пакет недоступен для покупки")
+	}
+
+	p := &Payment{
+		UserID:          userID,
+		PaymentType:     TypeNeurons,
+		ItemID:          pkg.ID,
+		Amount:          pkg.Price,
+		Status:          StatusPending,
+		PaymentProvider: provider,
+		Metadata: Metadata{
+			"package_name": pkg.Name,
+		},
+	}
+
+	return p, fmt.Sprintf("Пакет «%s»: %d нейронов", pkg.Name, pkg.GetTotalAmount()), nil
+}
+
+// createYooKassaPayment сохраняет платеж и создает его в ЮKassa
+func (s *Service) createYooKassaPayment(ctx context.Context, p *Payment, description string) error {
+	if err := s.repo.CreatePayment(ctx, p); err != nil {
+		s.log.Error("Ошибка создания платежа",
+			zap.Int64("user_id", p.UserID),
+			zap.Error(err))
+		return err
+	}
+
+	// Ключ идемпотентности привязан к платежу, поэтому повторная отправка запроса не создаст второй платеж
+	idempotenceKey := fmt.Sprintf("neurobot-payment-%d", p.ID)
+
+	external, err := s.yookassa.CreatePayment(ctx, &YooKassaCreatePaymentRequest{
+		Amount:  FormatAmount(p.Amount),
+		Capture: true,
+		Confirmation: &YooKassaConfirmation{
+			Type:      "redirect",
+			ReturnURL: s.config.YooKassa.ReturnURL,
+		},
+		Description: description,
+		Metadata: map[string]string{
+			"payment_id": strconv.FormatInt(p.ID, 10),
+			"user_id":    strconv.FormatInt(p.UserID, 10),
+		},
+		// Способ оплаты подписки сохраняется для автопродления
+		SavePaymentMethod: p.PaymentType == TypeSubscription,
+	}, idempotenceKey)
+	if err != nil {
+		s.log.Error("Ошибка создания платежа ЮKassa",
+			zap.Int64("user_id", p.UserID),
+			zap.Int64("payment_id", p.ID),
+			zap.Error(err))
+		if updateErr := s.repo.UpdateStatus(ctx, p.ID, StatusFailed, ""); updateErr != nil {
+			s.log.Error("Ошибка обновления статуса платежа", zap.Error(updateErr))
+		}
+		return fmt.Errorf("ошибка создания платежа: %w", err)
+	}
+
+	if external.Confirmation != nil {
+		p.PaymentURL = external.Confirmation.ConfirmationURL
+	}
+	p.ExternalID = external.ID
+	p.ExpiresAt = external.ExpiresAt
+
+	if err := s.repo.SetExternalInfo(ctx, p.ID, p.ExternalID, p.PaymentURL, p.ExpiresAt); err != nil {
+		s.log.Error("Ошибка сохранения данных платежа ЮKassa",
+			zap.Int64("payment_id", p.ID),
+			zap.Error(err))
+		return err
+	}
+
+	s.log.Info("Создан платеж",
+		zap.Int64("user_id", p.UserID),
+		zap.Int64("payment_id", p.ID),
+		zap.String("external_id", p.ExternalID),
+		zap.String("payment_type", string(p.PaymentType)),
+		zap.Int("amount", p.Amount))
+
+	return nil
+}
+
+// HandleYooKassaNotification обрабатывает уведомление ЮKassa.
+// Уведомление сохраняется как есть, а статус платежа проверяется запросом к API,
+// поэтому поддельное уведомление не может подтвердить платеж
+func (s *Service) HandleYooKassaNotification(ctx context.Context, payload []byte) error {
+	var notification YooKassaNotification
+	if err := json.Unmarshal(payload, &notification); err != nil {
+		return fmt.Errorf("%w: %v", ErrInvalidNotification, err)
+	}
+
+	stored := &Notification{
+		Provider:         ProviderYooKassa,
+		ExternalID:       notification.Object.ID,
+		NotificationType: notification.Event,
+		Payload:          payload,
+	}
+	if err := s.repo.SaveNotification(ctx, stored); err != nil {
+		s.log.Error("Ошибка сохранения уведомления ЮKassa", zap.Error(err))
+		return err
+	}
+
+	var paymentID *int64
+	var err error
+	if strings.HasPrefix(notification.Event, "refund.") {
+		paymentID, err = s.processYooKassaRefund(ctx, &notification)
+	} else {
+		paymentID, err = s.processYooKassaNotification(ctx, &notification)
+	}
+
+	errorMessage := ""
+	if err != nil {
+		errorMessage = err.Error()
+	}
+	if markErr := s.repo.MarkNotificationProcessed(ctx, stored.ID, paymentID, errorMessage); markErr != nil {
+		s.log.Error("Ошибка обновления уведомления", zap.Error(markErr))
+	}
+
+	return err
+}
+
+// processYooKassaNotification сверяет платеж с ЮKassa и применяет его результат
+func (s *Service) processYooKassaNotification(ctx context.Context, notification *YooKassaNotification) (*int64, error) {
+	if notification.Object.ID == "" {
+		return nil, errors.New("в уведомлении нет ID платежа")
+	}
+
+	p, err := s.repo.GetPaymentByExternalID(ctx, ProviderYooKassa, notification.Object.ID)
+	if err != nil {
+		return nil, err
+	}
+	if p == nil {
+		s.log.Warn("Уведомление о неизвестном платеже",
+			zap.String("external_id", notification.Object.ID),
+			zap.String("event", notification.Event))
+		return nil, ErrUnknownPayment
+	}
+
+	// Проверяем актуальный статус платежа напрямую в ЮKassa
+	external, err := s.yookassa.GetPayment(ctx, p.ExternalID)
+	if err != nil {
+		return &p.ID, fmt.Errorf("ошибка проверки платежа: %w", err)
+	}
+
+	if external.Amount.Value != FormatAmount(p.Amount).Value {
+		s.log.Error("Сумма платежа не совпадает",
+			zap.Int64("payment_id", p.ID),
+			zap.String("expected", FormatAmount(p.Amount).Value),
+			zap.String("actual", external.Amount.Value))
+		return &p.ID, errors.New("сумма платежа не совпадает")
+	}
+
+	paymentMethod := ""
+	if external.PaymentMethod != nil {
+		paymentMethod = external.PaymentMethod.Type
+	}
+
+	switch external.Status {
+	case "succeeded":
+		if err := s.repo.UpdateStatus(ctx, p.ID, StatusSucceeded, paymentMethod); err != nil {
+			return &p.ID, err
+		}
+		p.Status = StatusSucceeded
+		p.PaymentMethod = paymentMethod
+		s.saveMethod(ctx, p.UserID, external.PaymentMethod)
+		return &p.ID, s.Fulfill(ctx, p)
+
+	case "canceled":
+		if err := s.repo.UpdateStatus(ctx, p.ID, StatusCanceled, paymentMethod); err != nil {
+			return &p.ID, err
+		}
+		s.log.Info("Платеж отменен",
+			zap.Int64("payment_id", p.ID),
+			zap.Int64("user_id", p.UserID))
+		// О неудачном автопродлении пользователя уведомляет сервис подписок
+		if !p.IsRenewal() {
+			s.sendNotification(p.UserID, "❌ Оплата не прошла. Попробуйте еще раз или выберите другой способ оплаты.")
+		}
+	}
+
+	return &p.ID, nil
+}
+
+// fulfillmentLease - время, после которого незавершенная выдача товара считается прерванной
+// и может быть повторена задачей RetryFulfillments
+const fulfillmentLease = 10 * time.Minute
+
+// Fulfill выдает пользователю оплаченный товар ровно один раз. Платеж сначала отмечается
+// как выдаваемый, а выданным - только после выдачи товара, поэтому прерванная выдача
+// повторяется. Каждый шаг выдачи идемпотентен по платежу
+func (s *Service) Fulfill(ctx context.Context, p *Payment) error {
+	claimed, err := s.repo.ClaimFulfillment(ctx, p.ID, fulfillmentLease)
+	if err != nil {
+		return err
+	}
+	if !claimed {
+		s.log.Info("Товар по платежу уже выдан или выдается",
+			zap.Int64("payment_id", p.ID))
+		return nil
+	}
+
+	var text string
+	switch p.PaymentType {
+	case TypeSubscription:
+		text, err = s.fulfillSubscription(ctx, p)
+
+	case TypeNeurons:
+		var tx *currency.Transaction
+		tx, err = s.currencyService.PurchaseNeuronsPackage(ctx, p.UserID, p.ItemID, p.ExternalID, currency.PaymentKey(p.ID))
+		if err == nil {
+			text = fmt.Sprintf("✅ Оплата прошла! Начислено %d нейронов.", tx.Amount)
+		}
+
+	default:
+		err = fmt.Errorf("неизвестный тип платежа: %s", p.PaymentType)
+	}
+
+	if err != nil {
+		// Снимаем отметку, чтобы повторное уведомление смогло выдать товар
+		if releaseErr := s.repo.ReleaseFulfillment(ctx, p.ID); releaseErr != nil {
+			s.log.Error("Ошибка снятия отметки выдачи платежа",
+				zap.Int64("payment_id", p.ID),
+				zap.Error(releaseErr))
+		}
+		s.log.Error("Ошибка выдачи оплаченного товара",
+			zap.Int64("payment_id", p.ID),
+			zap.Int64("user_id", p.UserID),
+			zap.Error(err))
+		return fmt.Errorf("ошибка выдачи оплаченного товара: %w", err)
+	}
+
+	// Товар выдан: если отметка не сохранится, повторная выдача найдет уже выданный товар
+	if err := s.repo.CompleteFulfillment(ctx, p.ID); err != nil {
+		s.log.Error("Ошибка отметки выдачи платежа",
+			zap.Int64("payment_id", p.ID),
+			zap.Error(err))
+	}
+
+	s.log.Info("Оплаченный товар выдан",
+		zap.Int64("payment_id", p.ID),
+		zap.Int64("user_id", p.UserID),
+		zap.String("payment_type", string(p.PaymentType)))
+
+	s.sendNotification(p.UserID, text)
+
+	// Товар уже выдан, поэтому ошибка реферального вознаграждения не влияет на платеж
+	if s.referralService != nil {
+		err := s.referralService.RewardPurchase(ctx, p.UserID, p.Amount,
+			p.PaymentType == TypeSubscription, strconv.FormatInt(p.ID, 10))
+		if err != nil {
+			s.log.Error("Ошибка начисления реферального вознаграждения",
+				zap.Int64("payment_id", p.ID),
+				zap.Error(err))
+		}
+	}
+
+	if s.loyaltyService != nil {
+		if _, err := s.loyaltyService.AwardPurchase(ctx, p.UserID, p.Amount, strconv.FormatInt(p.ID, 10)); err != nil {
+			s.log.Error("Ошибка начисления опыта за покупку",
+				zap.Int64("payment_id", p.ID),
+				zap.Error(err))
+		}
+	}
+
+	return nil
+}
+
+// RetryFulfillments повторяет выдачу товара по успешным платежам, выдача по которым
+// завершилась ошибкой или была прервана. Возвращает количество выданных платежей
+func (s *Service) RetryFulfillments(ctx context.Context) (int, error) {
+	payments, err := s.repo.GetUnfulfilledPayments(ctx, time.Now().Add(-fulfillmentLease), 100)
+	if err != nil {
+		s.log.Error("Ошибка получения невыданных платежей", zap.Error(err))
+		return 0, err
+	}
+
+	fulfilled := 0
+	for _, p := range payments {
+		if err := s.Fulfill(ctx, p); err != nil {
+			continue
+		}
+		fulfilled++
+	}
+
+	if len(payments) > 0 {
+		s.log.Info("Повторена выдача оплаченных товаров",
+			zap.Int("payments", len(payments)),
+			zap.Int("fulfilled", fulfilled))
+	}
+
+	return fulfilled, nil
+}
+
+// fulfillSubscription оформляет, продлевает или меняет подписку по оплаченному платежу
+func (s *Service) fulfillSubscription(ctx context.Context, p *Payment) (string, error) {
+	// Подписка могла быть выдана прерванной попыткой, которая не успела отметить платеж
+	if p.ExternalID != "" {
+		sub, err := s.subService.FindByPayment(ctx, p.UserID, p.ExternalID)
+		if err != nil {
+			return "", err
+		}
+		if sub != nil {
+			return fmt.Sprintf("✅ Оплата прошла! Подписка «%s» активна до %s.",
+				sub.Plan.Name, sub.EndDate.Format("02.01.2006")), nil
+		}
+	}
+
+	if mode := p.Metadata.GetString("change_mode"); mode != "" {
+		preview, err := s.subService.ChangePlan(ctx, subscription.ChangePlanRequest{
+			UserID:        p.UserID,
+			PlanCode:      p.Metadata.GetString("plan_code"),
+			Period:        p.Metadata.GetString("period"),
+			Mode:          subscription.ChangeMode(mode),
+			AmountPaid:    p.Amount,
+			PaymentID:     p.ExternalID,
+			PaymentMethod: p.PaymentProvider,
+		})
+		if err == nil {
+			return fmt.Sprintf("✅ Оплата прошла! Подписка «%s» активна до %s.",
+				preview.NewPlan.Name, preview.EndDate.Format("02.01.2006")), nil
+		}
+		// Если прежняя подписка успела закончиться, оформляем новый план как обычную покупку
+		if !errors.Is(err, subscription.ErrNoPaidSubscription) {
+			return "", err
+		}
+	}
+
+	if p.IsRenewal() {
+		sub, err := s.subService.RenewSubscription(ctx, p.GetSubscriptionID(), p.ExternalID, p.PaymentProvider)
+		if err != nil {
+			return "", err
+		}
+		return fmt.Sprintf("✅ Подписка «%s» продлена до %s.",
+			sub.Plan.Name, sub.EndDate.Format("02.01.2006")), nil
+	}
+
+	sub, err := s.subService.Subscribe(ctx, subscription.SubscriptionRequest{
+		UserID:        p.UserID,
+		PlanCode:      p.Metadata.GetString("plan_code"),
+		Period:        p.Metadata.GetString("period"),
+		PaymentID:     p.ExternalID,
+		PaymentMethod: p.PaymentProvider,
+	})
+	if err != nil {
+		return "", err
+	}
+
+	// Подписка уже выдана, поэтому ошибка отметки скидки не должна приводить к повторной выдаче
+	if usageID := p.Metadata.GetInt("promo_usage_id"); usageID > 0 && s.promoService != nil {
+		if err := s.promoService.MarkDiscountApplied(ctx, int64(usageID), strconv.FormatInt(p.ID, 10)); err != nil {
+			s.log.Error("Ошибка применения скидки по промокоду",
+				zap.Int64("payment_id", p.ID),
+				zap.Int("usage_id", usageID),
+				zap.Error(err))
+		}
+	}
+	return fmt.Sprintf("✅ Оплата прошла! Подписка «%s» активна до %s.",
+		sub.Plan.Name, sub.EndDate.Format("02.01.2006")), nil
+}
+
+// ExpirePendingPayments отменяет платежи, которые так и не были оплачены: с истекшим
+// сроком оплаты или, если срок не задан, старше ttl. Если ЮKassa позже пришлет
+// уведомление об успешной оплате, оно переведет платеж в succeeded
+func (s *Service) ExpirePendingPayments(ctx context.Context, ttl time.Duration) (int, error) {
+	count, err := s.repo.CancelStalePending(ctx, time.Now().Add(-ttl))
+	if err != nil {
+		s.log.Error("Ошибка отмены неоплаченных платежей", zap.Error(err))
+		return 0, err
+	}
+
+	s.log.Info("Отменены неоплаченные платежи", zap.Int("count", count))
+	return count, nil
+}
+
+// sendNotification отправляет уведомление пользователю, если задан способ уведомления
+func (s *Service) sendNotification(userID int64, text string) {
+	if s.notify != nil {
+		s.notify(userID, text)
+	}
+}
@@ -0,0 +1,226 @@
+// Тесты обработки уведомлений ЮKassa с поддельным API ЮKassa
+
+package payment
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+
+	"go.uber.org/zap"
+
+	"neurobot-prod/internal/config"
+	"neurobot-prod/internal/currency"
+	"neurobot-prod/internal/storage/postgres/pgtest"
+	"neurobot-prod/internal/subscription"
+)
+
+const (
+	testUserID     = int64(1001)
+	testExternalID = "yk-test-1"
+	testPackageID  = 1 // 50 Нейронов за 99 ₽ из начальной миграции
+	testPrice      = 9900
+)
+
+// fakeYooKassa отвечает на запрос статуса платежа заданными суммой и кодом ответа
+type fakeYooKassa struct {
+	server *httptest.Server
+	amount atomic.Value // Сумма платежа в формате ЮKassa
+	status atomic.Int32 // HTTP-код ответа
+	calls  atomic.Int32
+}
+
+func newFakeYooKassa(t *testing.T) *fakeYooKassa {
+	f := &fakeYooKassa{}
+	f.amount.Store(FormatAmount(testPrice).Value)
+	f.status.Store(http.StatusOK)
+
+	f.server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		f.calls.Add(1)
+		if r.Method != http.MethodGet || r.URL.Path != "/payments/"+testExternalID {
+			http.NotFound(w, r)
+			return
+		}
+		if code := int(f.status.Load()); code != http.StatusOK {
+			http.Error(w, `{"type":"error"}`, code)
+			return
+		}
+		json.NewEncoder(w).Encode(YooKassaPayment{
+			ID:            testExternalID,
+			Status:        "succeeded",
+			Paid:          true,
+			Amount:        YooKassaAmount{Value: f.amount.Load().(string), Currency: "RUB"},
+			PaymentMethod: &YooKassaPaymentMethod{Type: "bank_card"},
+		})
+	}))
+	t.Cleanup(f.server.Close)
+	return f
+}
+
+// newTestService создает сервис платежей с базой из pgtest и ожидающим оплаты платежом за пакет нейронов
+func newTestService(t *testing.T, api *fakeYooKassa) (*Service, *sql.DB, *Payment) {
+	db := pgtest.Open(t)
+	pgtest.CreateUser(t, db, testUserID)
+
+	log := zap.NewNop()
+	subService := subscription.NewService(subscription.NewRepository(db), log)
+	currencyService := currency.NewService(currency.NewRepository(db), subService, log)
+	cfg := config.PaymentConfig{YooKassa: config.YooKassaConfig{APIURL: api.server.URL, ShopID: "shop", SecretKey: "secret"}}
+	service := NewService(NewRepository(db), cfg, subService, currencyService, log)
+
+	p := &Payment{
+		UserID:          testUserID,
+		ExternalID:      testExternalID,
+		PaymentType:     TypeNeurons,
+		ItemID:          testPackageID,
+		Amount:          testPrice,
+		Status:          StatusPending,
+		PaymentProvider: ProviderYooKassa,
+		Metadata:        Metadata{},
+	}
+	if err := service.repo.CreatePayment(context.Background(), p); err != nil {
+		t.Fatal(err)
+	}
+
+	return service, db, p
+}
+
+func notificationPayload(t *testing.T) []byte {
+	payload, err := json.Marshal(YooKassaNotification{
+		Type:   "notification",
+		Event:  "payment.succeeded",
+		Object: YooKassaPayment{ID: testExternalID, Status: "succeeded"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return payload
+}
+
+// assertFulfilled проверяет статус платежа и количество начислений по нему
+func assertFulfilled(t *testing.T, service *Service, db *sql.DB, paymentID int64, wantStatus Status, wantPurchases int) {
+	t.Helper()
+	ctx := context.Background()
+
+	p, err := service.repo.GetPaymentByID(ctx, paymentID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if p.Status != wantStatus {
+		t.Errorf("статус платежа %s, ожидался %s", p.Status, wantStatus)
+	}
+	if (p.FulfilledAt != nil) != (wantPurchases > 0) {
+		t.Errorf("отметка выдачи: %v, ожидалось начислений: %d", p.FulfilledAt, wantPurchases)
+	}
+
+	var purchases int
+	err = db.QueryRowContext(ctx,
+		`SELECT COUNT(*) FROM neuron_transactions WHERE user_id = $1 AND transaction_type = $2`,
+		testUserID, currency.TypePurchase).Scan(&purchases)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if purchases != wantPurchases {
+		t.Errorf("начислений по платежу %d, ожидалось %d", purchases, wantPurchases)
+	}
+}
+
+func TestYooKassaNotificationWrongAmount(t *testing.T) {
+	api := newFakeYooKassa(t)
+	service, db, p := newTestService(t, api)
+	api.amount.Store("1.00")
+
+	if err := service.HandleYooKassaNotification(context.Background(), notificationPayload(t)); err == nil {
+		t.Fatal("уведомление с неверной суммой должно завершиться ошибкой")
+	}
+
+	assertFulfilled(t, service, db, p.ID, StatusPending, 0)
+}
+
+func TestYooKassaNotificationRepeated(t *testing.T) {
+	api := newFakeYooKassa(t)
+	service, db, p := newTestService(t, api)
+
+	for i := 0; i < 3; i++ {
+		if err := service.HandleYooKassaNotification(context.Background(), notificationPayload(t)); err != nil {
+			t.Fatalf("уведомление %d: %v", i+1, err)
+		}
+	}
+
+	assertFulfilled(t, service, db, p.ID, StatusSucceeded, 1)
+
+	// Каждое уведомление сверяется с ЮKassa
+	if calls := api.calls.Load(); calls != 3 {
+		t.Errorf("запросов к ЮKassa %d, ожидалось 3", calls)
+	}
+}
+
+func TestYooKassaNotificationRefetchFailure(t *testing.T) {
+	api := newFakeYooKassa(t)
+	service, db, p := newTestService(t, api)
+	api.status.Store(http.StatusInternalServerError)
+
+	if err := service.HandleYooKassaNotification(context.Background(), notificationPayload(t)); err == nil {
+		t.Fatal("при недоступности ЮKassa уведомление должно завершиться ошибкой")
+	}
+	assertFulfilled(t, service, db, p.ID, StatusPending, 0)
+
+	// Повторное уведомление после восстановления API выдает товар
+	api.status.Store(http.StatusOK)
+	if err := service.HandleYooKassaNotification(context.Background(), notificationPayload(t)); err != nil {
+		t.Fatal(err)
+	}
+	assertFulfilled(t, service, db, p.ID, StatusSucceeded, 1)
+}
+
+func TestRetryInterruptedFulfillment(t *testing.T) {
+	api := newFakeYooKassa(t)
+	service, db, p := newTestService(t, api)
+	ctx := context.Background()
+
+	// Выдача только что началась в другом процессе
+	_, err := db.ExecContext(ctx, `
+		UPDATE payments SET status = 'succeeded', fulfillment_started_at = NOW(), updated_at = NOW() WHERE id = $1
+	`, p.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Уведомление не выдает товар повторно, пока выдача считается выполняющейся
+	if err := service.Fulfill(ctx, p); err != nil {
+		t.Fatal(err)
+	}
+	if count, err := service.RetryFulfillments(ctx); err != nil || count != 0 {
+		t.Fatalf("выполняющаяся выдача не должна повторяться: %d, %v", count, err)
+	}
+	assertFulfilled(t, service, db, p.ID, StatusSucceeded, 0)
+
+	// Процесс упал, не завершив выдачу, и срок выдачи истек
+	_, err = db.ExecContext(ctx, `
+		UPDATE payments
+		SET fulfillment_started_at = NOW() - INTERVAL '1 hour', updated_at = NOW() - INTERVAL '1 hour'
+		WHERE id = $1
+	`, p.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	count, err := service.RetryFulfillments(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if count != 1 {
+		t.Errorf("выдано %d платежей, ожидался 1", count)
+	}
+	assertFulfilled(t, service, db, p.ID, StatusSucceeded, 1)
+
+	// Выданный платеж больше не повторяется
+	if count, err := service.RetryFulfillments(ctx); err != nil || count != 0 {
+		t.Errorf("повторная выдача: %d, %v", count, err)
+	}
+	assertFulfilled(t, service, db, p.ID, StatusSucceeded, 1)
+}
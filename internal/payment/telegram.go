@@ -0,0 +1,300 @@
+// Оплата через Telegram Payments (карты и Telegram Stars)
+
+package payment
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"go.uber.org/zap"
+)
+
+// invoicePayloadPrefix - префикс полезной нагрузки счета, за которым следует ID платежа
+const invoicePayloadPrefix = "payment:"
+
+var (
+	// ErrPaymentMethodDisabled возвращается, если способ оплаты отключен в конфигурации
+	ErrPaymentMethodDisabled = errors.New("способ оплаты недоступен")
+	// ErrPriceChanged возвращается, если цена товара изменилась после выставления счета
+	ErrPriceChanged = errors.New("цена изменилась")
+	// ErrPaymentNotPayable возвращается, если счет уже оплачен, отменен или принадлежит другому пользователю
+	ErrPaymentNotPayable = errors.New("счет недействителен")
+)
+
+// Invoice представляет счет Telegram Payments для отправки пользователю
+type Invoice struct {
+	PaymentID     int64
+	Title         string
+	Description   string
+	Payload       string
+	ProviderToken string // Пустой для Telegram Stars
+	Currency      string
+	Amount        int // В минимальных единицах валюты: копейки или звезды
+}
+
+// TelegramPaymentResult представляет данные об успешной оплате из Telegram
+type TelegramPaymentResult struct {
+	Currency                string `json:"currency"`
+	TotalAmount             int    `json:"total_amount"`
+	InvoicePayload          string `json:"invoice_payload"`
+	TelegramPaymentChargeID string `json:"telegram_payment_charge_id"`
+	ProviderPaymentChargeID string `json:"provider_payment_charge_id"`
+}
+
+// TelegramCardsEnabled проверяет, доступна ли оплата картой через Telegram
+func (s *Service) TelegramCardsEnabled() bool {
+	return s.config.Telegram.CardsEnabled && s.config.Telegram.ProviderToken != ""
+}
+
+// TelegramStarsEnabled проверяет, доступна ли оплата Telegram Stars
+func (s *Service) TelegramStarsEnabled() bool {
+	return s.config.Telegram.StarsEnabled && s.config.Telegram.KopecksPerStar > 0
+}
+
+// TelegramPaymentsEnabled проверяет, доступен ли хотя бы один способ оплаты через Telegram
+func (s *Service) TelegramPaymentsEnabled() bool {
+	return s.TelegramCardsEnabled() || s.TelegramStarsEnabled()
+}
+
+// CreateSubscriptionInvoice создает счет Telegram Payments за подписку
+func (s *Service) CreateSubscriptionInvoice(ctx context.Context, userID int64, planCode, period, provider string) (*Invoice, error) {
+	p, description, err := s.newSubscriptionPayment(ctx, userID, planCode, period, provider)
+	if err != nil {
+		return nil, err
+	}
+
+	return s.createInvoice(ctx, p, "Подписка", description)
+}
+
+// CreatePackageInvoice создает счет Telegram Payments за пакет нейронов
+func (s *Service) CreatePackageInvoice(ctx context.Context, userID int64, packageID int, provider string) (*Invoice, error) {
+	p, description, err := s.newPackagePayment(ctx, userID, packageID, provider)
+	if err != nil {
+		return nil, err
+	}
+
+	return s.createInvoice(ctx, p, "Пакет нейронов", description)
+}
+
+// createInvoice сохраняет платеж и формирует счет для Telegram
+func (s *Service) createInvoice(ctx context.Context, p *Payment, title, description string) (*Invoice, error) {
+	currency, amount, err := s.invoiceAmount(p.PaymentProvider, p.Amount)
+	if err != nil {
+		return nil, err
+	}
+
+	// Сумма счета фиксируется, чтобы сверить ее с успешной оплатой даже при смене курса
+	p.Metadata["currency"] = currency
+	p.Metadata["invoice_amount"] = amount
+
+	if err := s.repo.CreatePayment(ctx, p); err != nil {
+		s.log.Error("Ошибка создания платежа",
+			zap.Int64("user_id", p.UserID),
+			zap.Error(err))
+		return nil, err
+	}
+
+	invoice := &Invoice{
+		PaymentID:   p.ID,
+		Title:       title,
+		Description: description,
+		Payload:     invoicePayloadPrefix + strconv.FormatInt(p.ID, 10),
+		Currency:    currency,
+		Amount:      amount,
+	}
+	if p.PaymentProvider == ProviderTelegramCard {
+		invoice.ProviderToken = s.config.Telegram.ProviderToken
+	}
+
+	s.log.Info("Создан счет Telegram Payments",
+		zap.Int64("user_id", p.UserID),
+		zap.Int64("payment_id", p.ID),
+		zap.String("provider", p.PaymentProvider),
+		zap.String("currency", currency),
+		zap.Int("amount", amount))
+
+	return invoice, nil
+}
+
+// invoiceAmount переводит сумму в копейках в валюту счета провайдера
+func (s *Service) invoiceAmount(provider string, kopecks int) (string, int, error) {
+	switch provider {
+	case ProviderTelegramCard:
+		if !s.TelegramCardsEnabled() {
+			return "", 0, ErrPaymentMethodDisabled
+		}
+		return CurrencyRUB, kopecks, nil
+
+	case ProviderTelegramStars:
+		if !s.TelegramStarsEnabled() {
+			return "", 0, ErrPaymentMethodDisabled
+		}
+		// Округляем вверх, чтобы не продавать дешевле цены в рублях
+		rate := s.config.Telegram.KopecksPerStar
+		return CurrencyStars, (kopecks + rate - 1) / rate, nil
+	}
+
+	return "", 0, fmt.Errorf("неизвестный провайдер Telegram Payments: %s", provider)
+}
+
+// ValidatePreCheckout проверяет счет перед списанием средств.
+// Сумма сверяется с текущими ценами пакетов и планов подписки
+func (s *Service) ValidatePreCheckout(ctx context.Context, userID int64, payload, currency string, totalAmount int) error {
+	p, err := s.getInvoicePayment(ctx, payload)
+	if err != nil {
+		return err
+	}
+
+	if p.UserID != userID || p.Status != StatusPending || p.FulfilledAt != nil {
+		return ErrPaymentNotPayable
+	}
+
+	var current *Payment
+	switch p.PaymentType {
+	case TypeSubscription:
+		current, _, err = s.newSubscriptionPayment(ctx, userID,
+			p.Metadata.GetString("plan_code"), p.Metadata.GetString("period"), p.PaymentProvider)
+	case TypeNeurons:
+		current, _, err = s.newPackagePayment(ctx, userID, p.ItemID, p.PaymentProvider)
+	default:
+		err = fmt.Errorf("неизвестный тип платежа: %s", p.PaymentType)
+	}
+	if err != nil {
+		return err
+	}
+
+	expectedCurrency, expectedAmount, err := s.invoiceAmount(p.PaymentProvider, current.Amount)
+	if err != nil {
+		return err
+	}
+
+	if current.Amount != p.Amount || currency != expectedCurrency || totalAmount != expectedAmount {
+		s.log.Warn("Цена изменилась после выставления счета",
+			zap.Int64("payment_id", p.ID),
+			zap.Int("payment_amount", p.Amount),
+			zap.Int("current_amount", current.Amount),
+			zap.String("currency", currency),
+			zap.Int("total_amount", totalAmount),
+			zap.Int("expected_amount", expectedAmount))
+		return ErrPriceChanged
+	}
+
+	return nil
+}
+
+// HandleTelegramPayment обрабатывает успешную оплату в Telegram.
+// Повторная доставка того же telegram_payment_charge_id не выдает товар второй раз
+func (s *Service) HandleTelegramPayment(ctx context.Context, userID int64, result *TelegramPaymentResult) error {
+	payload, err := json.Marshal(result)
+	if err != nil {
+		return fmt.Errorf("%w: %v", ErrInvalidNotification, err)
+	}
+
+	stored := &Notification{
+		Provider:         ProviderTelegramCard,
+		ExternalID:       result.TelegramPaymentChargeID,
+		NotificationType: "successful_payment",
+		Payload:          payload,
+	}
+	if result.Currency == CurrencyStars {
+		stored.Provider = ProviderTelegramStars
+	}
+	if err := s.repo.SaveNotification(ctx, stored); err != nil {
+		s.log.Error("Ошибка сохранения уведомления Telegram Payments", zap.Error(err))
+		return err
+	}
+
+	paymentID, err := s.processTelegramPayment(ctx, userID, result)
+
+	errorMessage := ""
+	if err != nil {
+		errorMessage = err.Error()
+	}
+	if markErr := s.repo.MarkNotificationProcessed(ctx, stored.ID, paymentID, errorMessage); markErr != nil {
+		s.log.Error("Ошибка обновления уведомления", zap.Error(markErr))
+	}
+
+	return err
+}
+
+// processTelegramPayment сверяет оплату со счетом и выдает товар
+func (s *Service) processTelegramPayment(ctx context.Context, userID int64, result *TelegramPaymentResult) (*int64, error) {
+	if result.TelegramPaymentChargeID == "" {
+		return nil, errors.New("в оплате нет telegram_payment_charge_id")
+	}
+
+	p, err := s.getInvoicePayment(ctx, result.InvoicePayload)
+	if err != nil {
+		return nil, err
+	}
+
+	switch p.ExternalID {
+	case result.TelegramPaymentChargeID:
+		// Повторная доставка: оплата уже записана, остается только убедиться, что товар выдан
+		return &p.ID, s.Fulfill(ctx, p)
+	case "":
+	default:
+		s.log.Error("Счет уже оплачен другим платежом",
+			zap.Int64("payment_id", p.ID),
+			zap.String("external_id", p.ExternalID),
+			zap.String("charge_id", result.TelegramPaymentChargeID))
+		return &p.ID, ErrPaymentNotPayable
+	}
+
+	if p.UserID != userID {
+		return &p.ID, ErrPaymentNotPayable
+	}
+
+	if result.Currency != p.Metadata.GetString("currency") || result.TotalAmount != p.Metadata.GetInt("invoice_amount") {
+		s.log.Error("Сумма платежа не совпадает",
+			zap.Int64("payment_id", p.ID),
+			zap.String("currency", result.Currency),
+			zap.Int("expected", p.Metadata.GetInt("invoice_amount")),
+			zap.Int("actual", result.TotalAmount))
+		return &p.ID, errors.New("сумма платежа не совпадает")
+	}
+
+	// ID списания в Telegram уникален, поэтому сохраняем его как внешний ID платежа
+	if err := s.repo.SetExternalInfo(ctx, p.ID, result.TelegramPaymentChargeID, "", nil); err != nil {
+		return &p.ID, err
+	}
+	p.ExternalID = result.TelegramPaymentChargeID
+
+	paymentMethod := "card"
+	if result.Currency == CurrencyStars {
+		paymentMethod = "stars"
+	}
+	if err := s.repo.UpdateStatus(ctx, p.ID, StatusSucceeded, paymentMethod); err != nil {
+		return &p.ID, err
+	}
+	p.Status = StatusSucceeded
+	p.PaymentMethod = paymentMethod
+
+	return &p.ID, s.Fulfill(ctx, p)
+}
+
+// getInvoicePayment находит платеж по полезной нагрузке счета
+func (s *Service) getInvoicePayment(ctx context.Context, payload string) (*Payment, error) {
+	if !strings.HasPrefix(payload, invoicePayloadPrefix) {
+		return nil, ErrInvalidNotification
+	}
+
+	paymentID, err := strconv.ParseInt(strings.TrimPrefix(payload, invoicePayloadPrefix), 10, 64)
+	if err != nil {
+		return nil, ErrInvalidNotification
+	}
+
+	p, err := s.repo.GetPaymentByID(ctx, paymentID)
+	if err != nil {
+		return nil, err
+	}
+	if p == nil || (p.PaymentProvider != ProviderTelegramCard && p.PaymentProvider != ProviderTelegramStars) {
+		return nil, ErrUnknownPayment
+	}
+
+	return p, nil
+}
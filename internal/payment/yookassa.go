@@ -0,0 +1,234 @@
+// Клиент ЮKassa
+
+package payment
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+
+	"go.uber.org/zap"
+
+	"neurobot-prod/internal/config"
+)
+
+// YooKassaError представляет ответ API ЮKassa с кодом ошибки
+type YooKassaError struct {
+	StatusCode int
+	Body       string
+}
+
+func (e *YooKassaError) Error() string {
+	return fmt.Sprintf("ошибка API ЮKassa: код %d, тело: %s", e.StatusCode, e.Body)
+}
+
+// Rejected сообщает, что ЮKassa отклонила запрос и его повтор не изменит результат.
+// При коде 5xx или 429 результат запроса неизвестен, и его нужно повторить с тем же ключом идемпотентности
+func (e *YooKassaError) Rejected() bool {
+	return e.StatusCode >= 400 && e.StatusCode < 500 && e.StatusCode != http.StatusTooManyRequests
+}
+
+// YooKassaClient представляет клиент API ЮKassa
+type YooKassaClient struct {
+	config     config.YooKassaConfig
+	httpClient *http.Client
+	log        *zap.Logger
+}
+
+// YooKassaAmount представляет сумму в формате ЮKassa
+type YooKassaAmount struct {
+	Value    string `json:"value"` // Сумма в рублях, например "399.00"
+	Currency string `json:"currency"`
+}
+
+// YooKassaConfirmation представляет способ подтверждения платежа
+type YooKassaConfirmation struct {
+	Type            string `json:"type"`
+	ReturnURL       string `json:"return_url,omitempty"`
+	ConfirmationURL string `json:"confirmation_url,omitempty"`
+}
+
+// YooKassaPaymentMethod представляет способ оплаты
+type YooKassaPaymentMethod struct {
+	Type  string `json:"type"`
+	ID    string `json:"id,omitempty"`
+	Saved bool   `json:"saved,omitempty"`
+	Title string `json:"title,omitempty"`
+}
+
+// YooKassaCreatePaymentRequest представляет запрос на создание платежа
+type YooKassaCreatePaymentRequest struct {
+	Amount            YooKassaAmount        `json:"amount"`
+	Capture           bool                  `json:"capture"`
+	Confirmation      *YooKassaConfirmation `json:"confirmation,omitempty"`
+	Description       string                `json:"description,omitempty"`
+	Metadata          map[string]string     `json:"metadata,omitempty"`
+	SavePaymentMethod bool                  `json:"save_payment_method,omitempty"`
+	PaymentMethodID   string                `json:"payment_method_id,omitempty"` // Для списания с сохраненного способа оплаты
+}
+
+// YooKassaPayment представляет платеж ЮKassa
+type YooKassaPayment struct {
+	ID                  string                 `json:"id"`
+	Status              string                 `json:"status"` // pending, waiting_for_capture, succeeded, canceled
+	Paid                bool                   `json:"paid"`
+	Amount              YooKassaAmount         `json:"amount"`
+	Confirmation        *YooKassaConfirmation  `json:"confirmation,omitempty"`
+	PaymentMethod       *YooKassaPaymentMethod `json:"payment_method,omitempty"`
+	Description         string                 `json:"description,omitempty"`
+	Metadata            map[string]string      `json:"metadata,omitempty"`
+	ExpiresAt           *time.Time             `json:"expires_at,omitempty"`
+	CreatedAt           time.Time              `json:"created_at"`
+	PaymentID           string                 `json:"payment_id,omitempty"` // ID возвращенного платежа в уведомлениях refund.*
+	CancellationDetails *struct {
+		Party  string `json:"party"`
+		Reason string `json:"reason"`
+	} `json:"cancellation_details,omitempty"`
+}
+
+// YooKassaCreateRefundRequest представляет запрос на возврат платежа
+type YooKassaCreateRefundRequest struct {
+	PaymentID   string         `json:"payment_id"`
+	Amount      YooKassaAmount `json:"amount"`
+	Description string         `json:"description,omitempty"`
+}
+
+// YooKassaRefund представляет возврат ЮKassa
+type YooKassaRefund struct {
+	ID          string         `json:"id"`
+	PaymentID   string         `json:"payment_id"`
+	Status      string         `json:"status"` // pending, succeeded, canceled
+	Amount      YooKassaAmount `json:"amount"`
+	Description string         `json:"description,omitempty"`
+	CreatedAt   time.Time      `json:"created_at"`
+}
+
+// YooKassaNotification представляет уведомление ЮKassa
+type YooKassaNotification struct {
+	Type   string          `json:"type"`  // notification
+	Event  string          `json:"event"` // payment.succeeded, payment.canceled, refund.succeeded, ...
+	Object YooKassaPayment `json:"object"`
+}
+
+// NewYooKassaClient создает новый клиент ЮKassa
+func NewYooKassaClient(cfg config.YooKassaConfig, log *zap.Logger) *YooKassaClient {
+	return &YooKassaClient{
+		config: cfg,
+		httpClient: &http.Client{
+			Timeout: 30 * time.Second,
+		},
+		log: log.Named("yookassa_client"),
+	}
+}
+
+// FormatAmount переводит сумму в копейках в формат ЮKassa
+func FormatAmount(kopecks int) YooKassaAmount {
+	return YooKassaAmount{
+		Value:    fmt.Sprintf("%d.%02d", kopecks/100, kopecks%100),
+		Currency: "RUB",
+	}
+}
+
+// CreatePayment создает платеж. Повторный запрос с тем же ключом идемпотентности
+// возвращает уже созданный платеж
+func (c *YooKassaClient) CreatePayment(ctx context.Context, request *YooKassaCreatePaymentRequest, idempotenceKey string) (*YooKassaPayment, error) {
+	jsonData, err := json.Marshal(request)
+	if err != nil {
+		return nil, fmt.Errorf("ошибка сериализации запроса: %w", err)
+	}
+
+	var payment YooKassaPayment
+	if err := c.do(ctx, "POST", "/payments", jsonData, idempotenceKey, &payment); err != nil {
+		return nil, err
+	}
+
+	c.log.Info("Создан платеж ЮKassa",
+		zap.String("external_id", payment.ID),
+		zap.String("status", payment.Status),
+		zap.String("amount", payment.Amount.Value))
+
+	return &payment, nil
+}
+
+// GetPayment получает актуальную информацию о платеже
+func (c *YooKassaClient) GetPayment(ctx context.Context, externalID string) (*YooKassaPayment, error) {
+	var payment YooKassaPayment
+	if err := c.do(ctx, "GET", "/payments/"+externalID, nil, "", &payment); err != nil {
+		return nil, err
+	}
+	return &payment, nil
+}
+
+// CreateRefund возвращает платеж полностью или частично.
+// Повторный запрос с тем же ключом идемпотентности возвращает уже созданный возврат
+func (c *YooKassaClient) CreateRefund(ctx context.Context, request *YooKassaCreateRefundRequest, idempotenceKey string) (*YooKassaRefund, error) {
+	jsonData, err := json.Marshal(request)
+	if err != nil {
+		return nil, fmt.Errorf("ошибка сериализации запроса: %w", err)
+	}
+
+	var refund YooKassaRefund
+	if err := c.do(ctx, "POST", "/refunds", jsonData, idempotenceKey, &refund); err != nil {
+		return nil, err
+	}
+
+	c.log.Info("Создан возврат ЮKassa",
+		zap.String("refund_id", refund.ID),
+		zap.String("payment_id", refund.PaymentID),
+		zap.String("status", refund.Status),
+		zap.String("amount", refund.Amount.Value))
+
+	return &refund, nil
+}
+
+// GetRefund получает актуальную информацию о возврате
+func (c *YooKassaClient) GetRefund(ctx context.Context, refundID string) (*YooKassaRefund, error) {
+	var refund YooKassaRefund
+	if err := c.do(ctx, "GET", "/refunds/"+refundID, nil, "", &refund); err != nil {
+		return nil, err
+	}
+	return &refund, nil
+}
+
+// do выполняет запрос к API ЮKassa
+func (c *YooKassaClient) do(ctx context.Context, method, path string, body []byte, idempotenceKey string, result interface{}) error {
+	url := strings.TrimRight(c.config.APIURL, "/") + path
+
+	var reader io.Reader
+	if body != nil {
+		reader = bytes.NewBuffer(body)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, method, url, reader)
+	if err != nil {
+		return fmt.Errorf("ошибка создания HTTP-запроса: %w", err)
+	}
+
+	req.SetBasicAuth(c.config.ShopID, c.config.SecretKey)
+	req.Header.Set("Content-Type", "application/json")
+	if idempotenceKey != "" {
+		req.Header.Set("Idempotence-Key", idempotenceKey)
+	}
+
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("ошибка отправки запроса: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		bodyBytes, _ := io.ReadAll(resp.Body)
+		return &YooKassaError{StatusCode: resp.StatusCode, Body: string(bodyBytes)}
+	}
+
+	if err := json.NewDecoder(resp.Body).Decode(result); err != nil {
+		return fmt.Errorf("ошибка разбора ответа: %w", err)
+	}
+
+	return nil
+}
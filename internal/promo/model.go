@@ -0,0 +1,142 @@
+// Модель промокодов
+
+package promo
+
+import (
+	"database/sql/driver"
+	"encoding/json"
+	"errors"
+	"time"
+)
+
+// DiscountType представляет тип промокода
+type DiscountType string
+
+const (
+	DiscountPercent   DiscountType = "percent"    // Скидка в процентах на подписку
+	DiscountFixed     DiscountType = "fixed"      // Скидка в копейках на подписку
+	DiscountNeurons   DiscountType = "neurons"    // Начисление нейронов
+	DiscountFreeTrial DiscountType = "free_trial" // Пробная подписка на указанное количество дней
+)
+
+// IsValid проверяет, поддерживается ли тип промокода
+func (t DiscountType) IsValid() bool {
+	switch t {
+	case DiscountPercent, DiscountFixed, DiscountNeurons, DiscountFreeTrial:
+		return true
+	}
+	return false
+}
+
+// IsCheckoutDiscount возвращает true для промокодов, которые применяются при оплате подписки
+func (t DiscountType) IsCheckoutDiscount() bool {
+	return t == DiscountPercent || t == DiscountFixed
+}
+
+// Metadata представляет дополнительные данные промокода
+type Metadata map[string]interface{}
+
+// Value реализует интерфейс driver.Valuer для конвертации в JSONB
+func (m Metadata) Value() (driver.Value, error) {
+	if m == nil {
+		return nil, nil
+	}
+	return json.Marshal(m)
+}
+
+// Scan реализует интерфейс sql.Scanner для чтения из JSONB
+func (m *Metadata) Scan(value interface{}) error {
+	if value == nil {
+		*m = nil
+		return nil
+	}
+
+	var data []byte
+	switch v := value.(type) {
+	case []byte:
+		data = v
+	case string:
+		data = []byte(v)
+	default:
+		return errors.New("тип данных не поддерживается для Metadata.Scan")
+	}
+
+	return json.Unmarshal(data, m)
+}
+
+// Promocode представляет промокод
+type Promocode struct {
+	ID                 int          `db:"id"`
+	Code               string       `db:"code"`
+	DiscountType       DiscountType `db:"discount_type"`
+	DiscountValue      int          `db:"discount_value"` // Проценты, копейки, нейроны или дни пробного периода
+	MaxUses            *int         `db:"max_uses"`       // nil - без ограничений
+	CurrentUses        int          `db:"current_uses"`
+	SubscriptionPlanID *int         `db:"subscription_plan_id"` // nil - для всех планов
+	StartDate          *time.Time   `db:"start_date"`
+	EndDate            *time.Time   `db:"end_date"`
+	IsActive           bool         `db:"is_active"`
+	CreatedByAdmin     string       `db:"created_by_admin"`
+	Metadata           Metadata     `db:"metadata"`
+	CreatedAt          time.Time    `db:"created_at"`
+	UpdatedAt          time.Time    `db:"updated_at"`
+}
+
+// IsStarted проверяет, начался ли срок действия промокода
+func (p *Promocode) IsStarted(now time.Time) bool {
+	return p.StartDate == nil || !now.Before(*p.StartDate)
+}
+
+// IsExpired проверяет, закончился ли срок действия промокода
+func (p *Promocode) IsExpired(now time.Time) bool {
+	return p.EndDate != nil && !now.Before(*p.EndDate)
+}
+
+// IsExhausted проверяет, исчерпан ли лимит использований
+func (p *Promocode) IsExhausted() bool {
+	return p.MaxUses != nil && p.CurrentUses >= *p.MaxUses
+}
+
+// AppliesToPlan проверяет, действует ли промокод на указанный план
+func (p *Promocode) AppliesToPlan(planID int) bool {
+	return p.SubscriptionPlanID == nil || *p.SubscriptionPlanID == planID
+}
+
+// GetDiscount возвращает размер скидки в копейках для указанной цены
+func (p *Promocode) GetDiscount(price int) int {
+	var discount int
+	switch p.DiscountType {
+	case DiscountPercent:
+		discount = price * p.DiscountValue / 100
+	case DiscountFixed:
+		discount = p.DiscountValue
+	}
+
+	if discount > price {
+		discount = price
+	}
+	return discount
+}
+
+// GetExpiryDays возвращает срок действия начисленных нейронов
+func (p *Promocode) GetExpiryDays() int {
+	if days, ok := p.Metadata["expiry_days"].(float64); ok {
+		return int(days)
+	}
+	return 0 // По умолчанию нейроны по промокоду не сгорают
+}
+
+// Usage представляет использование промокода пользователем
+type Usage struct {
+	ID             int64      `db:"id"`
+	PromocodeID    int        `db:"promocode_id"`
+	UserID         int64      `db:"user_id"`
+	DiscountAmount int        `db:"discount_amount"`
+	ReferenceID    string     `db:"reference_id"` // ID транзакции, подписки или платежа
+	Metadata       Metadata   `db:"metadata"`
+	AppliedAt      *time.Time `db:"applied_at"` // Когда скидка была применена к оплате
+	CreatedAt      time.Time  `db:"created_at"`
+
+	// Дополнительные поля (не из БД)
+	Promocode *Promocode `db:"-"`
+}
@@ -0,0 +1,283 @@
+// Репозиторий промокодов
+
+package promo
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"strings"
+)
+
+// Repository представляет репозиторий для работы с промокодами
+type Repository struct {
+	db *sql.DB
+}
+
+// NewRepository создает новый репозиторий промокодов
+func NewRepository(db *sql.DB) *Repository {
+	return &Repository{
+		db: db,
+	}
+}
+
+// promocodeColumns - список колонок для выборки промокода
+const promocodeColumns = `
+	id, code, discount_type, discount_value, max_uses, current_uses, subscription_plan_id,
+	start_date, end_date, is_active, COALESCE(created_by_admin, ''), metadata, created_at, updated_at
+`
+
+// rowScanner объединяет sql.Row и sql.Rows
+type rowScanner interface {
+	Scan(dest ...interface{}) error
+}
+
+// scanPromocode сканирует промокод из результата запроса
+func scanPromocode(row rowScanner) (*Promocode, error) {
+	p := &Promocode{}
+	err := row.Scan(
+		&p.ID,
+		&p.Code,
+		&p.DiscountType,
+		&p.DiscountValue,
+		&p.MaxUses,
+		&p.CurrentUses,
+		&p.SubscriptionPlanID,
+		&p.StartDate,
+		&p.EndDate,
+		&p.IsActive,
+		&p.CreatedByAdmin,
+		&p.Metadata,
+		&p.CreatedAt,
+		&p.UpdatedAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+	return p, nil
+}
+
+// GetByCode находит промокод без учета регистра
+func (r *Repository) GetByCode(ctx context.Context, code string) (*Promocode, error) {
+	query := `SELECT ` + promocodeColumns + ` FROM promocodes WHERE UPPER(code) = $1`
+
+	p, err := scanPromocode(r.db.QueryRowContext(ctx, query, strings.ToUpper(code)))
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, nil // Промокод не найден
+		}
+		return nil, fmt.Errorf("ошибка получения промокода: %w", err)
+	}
+
+	return p, nil
+}
+
+// GetByID находит промокод по ID
+func (r *Repository) GetByID(ctx context.Context, id int) (*Promocode, error) {
+	query := `SELECT ` + promocodeColumns + ` FROM promocodes WHERE id = $1`
+
+	p, err := scanPromocode(r.db.QueryRowContext(ctx, query, id))
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("ошибка получения промокода: %w", err)
+	}
+
+	return p, nil
+}
+
+// Create создает промокод. Возвращает false, если такой код уже существует
+func (r *Repository) Create(ctx context.Context, p *Promocode) (bool, error) {
+	query := `
+		INSERT INTO promocodes (
+			code, discount_type, discount_value, max_uses, subscription_plan_id,
+			start_date, end_date, is_active, created_by_admin, metadata
+		)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, NULLIF($9, ''), $10)
+		ON CONFLICT (code) DO NOTHING
+		RETURNING id, current_uses, created_at, updated_at
+	`
+
+	err := r.db.QueryRowContext(ctx, query,
+		p.Code,
+		p.DiscountType,
+		p.DiscountValue,
+		p.MaxUses,
+		p.SubscriptionPlanID,
+		p.StartDate,
+		p.EndDate,
+		p.IsActive,
+		p.CreatedByAdmin,
+		p.Metadata,
+	).Scan(&p.ID, &p.CurrentUses, &p.CreatedAt, &p.UpdatedAt)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return false, nil
+		}
+		return false, fmt.Errorf("ошибка создания промокода: %w", err)
+	}
+
+	return true, nil
+}
+
+// Reserve атомарно увеличивает счетчик использований и записывает использование пользователем.
+// Возвращает nil, если промокод недоступен или уже использован этим пользователем
+func (r *Repository) Reserve(ctx context.Context, promocodeID int, userID int64, discountAmount int, metadata Metadata) (*Usage, error) {
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, fmt.Errorf("ошибка начала транзакции: %w", err)
+	}
+	defer tx.Rollback()
+
+	// Условия проверяются в самом UPDATE, поэтому параллельные активации не превысят лимит
+	result, err := tx.ExecContext(ctx, `
+		UPDATE promocodes
+		SET current_uses = current_uses + 1, updated_at = NOW()
+		WHERE id = $1
+		  AND is_active = true
+		  AND (max_uses IS NULL OR current_uses < max_uses)
+		  AND (start_date IS NULL OR start_date <= NOW())
+		  AND (end_date IS NULL OR end_date > NOW())
+	`, promocodeID)
+	if err != nil {
+		return nil, fmt.Errorf("ошибка обновления счетчика промокода: %w", err)
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return nil, fmt.Errorf("ошибка получения количества затронутых строк: %w", err)
+	}
+	if rowsAffected == 0 {
+		return nil, ErrUnavailable
+	}
+
+	usage := &Usage{
+		PromocodeID:    promocodeID,
+		UserID:         userID,
+		DiscountAmount: discountAmount,
+		Metadata:       metadata,
+	}
+	err = tx.QueryRowContext(ctx, `
+		INSERT INTO promocode_usages (promocode_id, user_id, discount_amount, metadata)
+		VALUES ($1, $2, $3, $4)
+		ON CONFLICT (promocode_id, user_id) DO NOTHING
+		RETURNING id, created_at
+	`, promocodeID, userID, discountAmount, metadata).Scan(&usage.ID, &usage.CreatedAt)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, ErrAlreadyUsed
+		}
+		return nil, fmt.Errorf("ошибка записи использования промокода: %w", err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, fmt.Errorf("ошибка подтверждения транзакции: %w", err)
+	}
+
+	return usage, nil
+}
+
+// Release отменяет использование промокода, если его действие не удалось применить
+func (r *Repository) Release(ctx context.Context, usage *Usage) error {
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("ошибка начала транзакции: %w", err)
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.ExecContext(ctx, `DELETE FROM promocode_usages WHERE id = $1`, usage.ID); err != nil {
+		return fmt.Errorf("ошибка удаления использования промокода: %w", err)
+	}
+
+	_, err = tx.ExecContext(ctx, `
+		UPDATE promocodes
+		SET current_uses = GREATEST(current_uses - 1, 0), updated_at = NOW()
+		WHERE id = $1
+	`, usage.PromocodeID)
+	if err != nil {
+		return fmt.Errorf("ошибка обновления счетчика промокода: %w", err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("ошибка подтверждения транзакции: %w", err)
+	}
+
+	return nil
+}
+
+// SetReference сохраняет ID сущности, созданной по промокоду
+func (r *Repository) SetReference(ctx context.Context, usageID int64, referenceID string) error {
+	_, err := r.db.ExecContext(ctx, `
+		UPDATE promocode_usages SET reference_id = $1 WHERE id = $2
+	`, referenceID, usageID)
+	if err != nil {
+		return fmt.Errorf("ошибка обновления использования промокода: %w", err)
+	}
+
+	return nil
+}
+
+// GetPendingDiscounts возвращает активированные, но еще не примененные скидки пользователя
+func (r *Repository) GetPendingDiscounts(ctx context.Context, userID int64) ([]*Usage, error) {
+	query := `
+		SELECT u.id, u.promocode_id, u.user_id, u.discount_amount, COALESCE(u.reference_id, ''),
+		       u.metadata, u.applied_at, u.created_at
+		FROM promocode_usages u
+		JOIN promocodes p ON p.id = u.promocode_id
+		WHERE u.user_id = $1
+		  AND u.applied_at IS NULL
+		  AND p.discount_type IN ($2, $3)
+		ORDER BY u.created_at ASC
+	`
+
+	rows, err := r.db.QueryContext(ctx, query, userID, DiscountPercent, DiscountFixed)
+	if err != nil {
+		return nil, fmt.Errorf("ошибка получения скидок пользователя: %w", err)
+	}
+	defer rows.Close()
+
+	var usages []*Usage
+	for rows.Next() {
+		u := &Usage{}
+		err := rows.Scan(
+			&u.ID,
+			&u.PromocodeID,
+			&u.UserID,
+			&u.DiscountAmount,
+			&u.ReferenceID,
+			&u.Metadata,
+			&u.AppliedAt,
+			&u.CreatedAt,
+		)
+		if err != nil {
+			return nil, fmt.Errorf("ошибка сканирования использования промокода: %w", err)
+		}
+		usages = append(usages, u)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("ошибка при итерации использований промокодов: %w", err)
+	}
+
+	return usages, nil
+}
+
+// MarkApplied отмечает скидку примененной. Возвращает false, если она уже была применена
+func (r *Repository) MarkApplied(ctx context.Context, usageID int64, referenceID string) (bool, error) {
+	result, err := r.db.ExecContext(ctx, `
+		UPDATE promocode_usages
+		SET applied_at = NOW(), reference_id = $1
+		WHERE id = $2 AND applied_at IS NULL
+	`, referenceID, usageID)
+	if err != nil {
+		return false, fmt.Errorf("ошибка применения скидки: %w", err)
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return false, fmt.Errorf("ошибка получения количества затронутых строк: %w", err)
+	}
+
+	return rowsAffected > 0, nil
+}
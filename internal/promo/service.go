@@ -0,0 +1,340 @@
+// Сервис промокодов
+
+package promo
+
+import (
+	"context"
+	"crypto/rand"
+	"errors"
+	"fmt"
+	"math/big"
+	"strconv"
+	"strings"
+	"time"
+
+	"go.uber.org/zap"
+
+	"neurobot-prod/internal/currency"
+	"neurobot-prod/internal/subscription"
+)
+
+// minPayableAmount - минимальная сумма оплаты после скидки в копейках
+const minPayableAmount = 100
+
+// codeAlphabet - символы для генерации кодов без легко путаемых 0/O и 1/I
+const codeAlphabet = "ABCDEFGHJKLMNPQRSTUVWXYZ23456789"
+
+var (
+	// ErrNotFound возвращается, если промокод не существует
+	ErrNotFound = errors.New("промокод не найден")
+	// ErrExpired возвращается, если срок действия промокода не начался или закончился
+	ErrExpired = errors.New("срок действия промокода истек")
+	// ErrExhausted возвращается, если лимит использований промокода исчерпан
+	ErrExhausted = errors.New("промокод больше недоступен")
+	// ErrAlreadyUsed возвращается, если пользователь уже активировал этот промокод
+	ErrAlreadyUsed = errors.New("промокод уже использован")
+	// ErrNotApplicable возвращается, если действие промокода нельзя применить к пользователю
+	ErrNotApplicable = errors.New("промокод нельзя применить")
+	// ErrUnavailable возвращается, если промокод стал недоступен в момент активации
+	ErrUnavailable = errors.New("промокод недоступен")
+	// ErrInvalidBatch возвращается, если параметры партии промокодов заданы неверно
+	ErrInvalidBatch = errors.New("неверные параметры промокодов")
+)
+
+// Service предоставляет методы для работы с промокодами
+type Service struct {
+	repo            *Repository
+	subService      *subscription.Service
+	currencyService *currency.Service
+	log             *zap.Logger
+}
+
+// NewService создает новый сервис промокодов
+func NewService(repo *Repository, subService *subscription.Service, currencyService *currency.Service, log *zap.Logger) *Service {
+	return &Service{
+		repo:            repo,
+		subService:      subService,
+		currencyService: currencyService,
+		log:             log.Named("promo_service"),
+	}
+}
+
+// RedeemResult содержит результат активации промокода
+type RedeemResult struct {
+	Promocode    *Promocode
+	Usage        *Usage
+	Transaction  *currency.Transaction      // Для промокодов на нейроны
+	Subscription *subscription.Subscription // Для пробной подписки
+}
+
+// Redeem активирует промокод для пользователя и применяет его действие.
+// Использование резервируется атомарно, а при ошибке применения резерв снимается
+func (s *Service) Redeem(ctx context.Context, userID int64, code string) (*RedeemResult, error) {
+	code = strings.ToUpper(strings.TrimSpace(code))
+	if code == "" {
+		return nil, ErrNotFound
+	}
+
+	p, err := s.repo.GetByCode(ctx, code)
+	if err != nil {
+		s.log.Error("Ошибка получения промокода",
+			zap.String("code", code),
+			zap.Error(err))
+		return nil, err
+	}
+	if p == nil || !p.IsActive || !p.DiscountType.IsValid() {
+		return nil, ErrNotFound
+	}
+
+	// Предварительная проверка для понятного сообщения, окончательная выполняется при резервировании
+	now := time.Now()
+	if !p.IsStarted(now) || p.IsExpired(now) {
+		return nil, ErrExpired
+	}
+	if p.IsExhausted() {
+		return nil, ErrExhausted
+	}
+
+	usage, err := s.repo.Reserve(ctx, p.ID, userID, 0, Metadata{
+		"code":          p.Code,
+		"discount_type": string(p.DiscountType),
+	})
+	if err != nil {
+		if errors.Is(err, ErrUnavailable) {
+			return nil, ErrExhausted
+		}
+		if errors.Is(err, ErrAlreadyUsed) {
+			return nil, ErrAlreadyUsed
+		}
+		s.log.Error("Ошибка резервирования промокода",
+			zap.Int64("user_id", userID),
+			zap.String("code", code),
+			zap.Error(err))
+		return nil, err
+	}
+	usage.Promocode = p
+
+	result, err := s.apply(ctx, userID, p, usage)
+	if err != nil {
+		if releaseErr := s.repo.Release(ctx, usage); releaseErr != nil {
+			s.log.Error("Ошибка снятия резерва промокода",
+				zap.Int64("usage_id", usage.ID),
+				zap.Error(releaseErr))
+		}
+		s.log.Warn("Не удалось применить промокод",
+			zap.Int64("user_id", userID),
+			zap.String("code", code),
+			zap.Error(err))
+		return nil, err
+	}
+
+	s.log.Info("Промокод активирован",
+		zap.Int64("user_id", userID),
+		zap.String("code", code),
+		zap.String("discount_type", string(p.DiscountType)),
+		zap.Int("discount_value", p.DiscountValue))
+
+	return result, nil
+}
+
+// apply применяет действие промокода
+func (s *Service) apply(ctx context.Context, userID int64, p *Promocode, usage *Usage) (*RedeemResult, error) {
+	result := &RedeemResult{
+		Promocode: p,
+		Usage:     usage,
+	}
+
+	switch p.DiscountType {
+	case DiscountNeurons:
+		tx, err := s.currencyService.AddNeurons(ctx, userID, p.DiscountValue, currency.TypePromocode,
+			fmt.Sprintf("Промокод %s", p.Code),
+			currency.Metadata{"promocode_id": p.ID, "code": p.Code},
+			"promo:"+p.Code, "promo:"+strconv.FormatInt(usage.ID, 10), p.GetExpiryDays())
+		if err != nil {
+			return nil, fmt.Errorf("ошибка начисления нейронов: %w", err)
+		}
+		result.Transaction = tx
+
+		if err := s.repo.SetReference(ctx, usage.ID, strconv.FormatInt(tx.ID, 10)); err != nil {
+			s.log.Error("Ошибка сохранения ссылки на транзакцию", zap.Error(err))
+		}
+
+	case DiscountFreeTrial:
+		if p.SubscriptionPlanID == nil {
+			return nil, fmt.Errorf("%w: для пробного периода не указан план", ErrNotApplicable)
+		}
+
+		sub, err := s.subService.StartTrial(ctx, userID, *p.SubscriptionPlanID, p.DiscountValue, "promo:"+p.Code)
+		if err != nil {
+			if errors.Is(err, subscription.ErrTrialUsed) || errors.Is(err, subscription.ErrHasPaidSubscription) {
+				return nil, fmt.Errorf("%w: %v", ErrNotApplicable, err)
+			}
+			return nil, err
+		}
+		result.Subscription = sub
+
+		if err := s.repo.SetReference(ctx, usage.ID, strconv.FormatInt(sub.ID, 10)); err != nil {
+			s.log.Error("Ошибка сохранения ссылки на подписку", zap.Error(err))
+		}
+
+	case DiscountPercent, DiscountFixed:
+		// Скидка сохраняется за пользователем и применяется при оплате подписки
+
+	default:
+		return nil, ErrNotApplicable
+	}
+
+	return result, nil
+}
+
+// CheckoutDiscount представляет скидку по промокоду, применяемую к оплате
+type CheckoutDiscount struct {
+	UsageID int64
+	Code    string
+	Amount  int // Размер скидки в копейках
+}
+
+// GetCheckoutDiscount возвращает наибольшую доступную пользователю скидку на оплату плана.
+// Возвращает nil, если подходящих скидок нет
+func (s *Service) GetCheckoutDiscount(ctx context.Context, userID int64, planID, price int) (*CheckoutDiscount, error) {
+	usages, err := s.repo.GetPendingDiscounts(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	var best *CheckoutDiscount
+	for _, usage := range usages {
+		p, err := s.repo.GetByID(ctx, usage.PromocodeID)
+		if err != nil {
+			return nil, err
+		}
+		if p == nil || !p.AppliesToPlan(planID) {
+			continue
+		}
+
+		amount := p.GetDiscount(price)
+		// Оставляем минимальную сумму, которую примет платежный провайдер
+		if price-amount < minPayableAmount {
+			amount = price - minPayableAmount
+		}
+		if amount <= 0 {
+			continue
+		}
+
+		if best == nil || amount > best.Amount {
+			best = &CheckoutDiscount{
+				UsageID: usage.ID,
+				Code:    p.Code,
+				Amount:  amount,
+			}
+		}
+	}
+
+	return best, nil
+}
+
+// MarkDiscountApplied отмечает скидку примененной к оплаченному платежу
+func (s *Service) MarkDiscountApplied(ctx context.Context, usageID int64, paymentID string) error {
+	applied, err := s.repo.MarkApplied(ctx, usageID, paymentID)
+	if err != nil {
+		return err
+	}
+
+	if !applied {
+		// Скидку уже использовал другой платеж, выставленный одновременно с этим
+		s.log.Warn("Скидка по промокоду уже применена",
+			zap.Int64("usage_id", usageID),
+			zap.String("payment_id", paymentID))
+	}
+
+	return nil
+}
+
+// BatchRequest содержит параметры генерации партии промокодов
+type BatchRequest struct {
+	Prefix       string
+	DiscountType DiscountType
+	Value        int
+	Count        int
+	MaxUses      *int // nil - без ограничений
+	PlanID       *int
+	EndDate      *time.Time
+	CreatedBy    string
+}
+
+// GenerateBatch создает партию уникальных промокодов
+func (s *Service) GenerateBatch(ctx context.Context, req BatchRequest) ([]*Promocode, error) {
+	if !req.DiscountType.IsValid() {
+		return nil, fmt.Errorf("%w: неизвестный тип %s", ErrInvalidBatch, req.DiscountType)
+	}
+	if req.Value <= 0 {
+		return nil, fmt.Errorf("%w: значение должно быть положительным", ErrInvalidBatch)
+	}
+	if req.DiscountType == DiscountPercent && req.Value > 100 {
+		return nil, fmt.Errorf("%w: скидка не может превышать 100%%", ErrInvalidBatch)
+	}
+	if req.DiscountType == DiscountFreeTrial && req.PlanID == nil {
+		return nil, fmt.Errorf("%w: для пробного периода нужно указать план", ErrInvalidBatch)
+	}
+	if req.Count <= 0 || req.Count > 1000 {
+		return nil, fmt.Errorf("%w: количество должно быть от 1 до 1000", ErrInvalidBatch)
+	}
+
+	prefix := strings.ToUpper(strings.TrimSpace(req.Prefix))
+	now := time.Now()
+
+	codes := make([]*Promocode, 0, req.Count)
+	for attempts := 0; len(codes) < req.Count; attempts++ {
+		if attempts >= req.Count*3 {
+			return codes, errors.New("не удалось сгенерировать уникальные коды")
+		}
+
+		suffix, err := randomCode(8)
+		if err != nil {
+			return codes, err
+		}
+
+		p := &Promocode{
+			Code:               prefix + suffix,
+			DiscountType:       req.DiscountType,
+			DiscountValue:      req.Value,
+			MaxUses:            req.MaxUses,
+			SubscriptionPlanID: req.PlanID,
+			StartDate:          &now,
+			EndDate:            req.EndDate,
+			IsActive:           true,
+			CreatedByAdmin:     req.CreatedBy,
+		}
+
+		created, err := s.repo.Create(ctx, p)
+		if err != nil {
+			s.log.Error("Ошибка создания промокода", zap.Error(err))
+			return codes, err
+		}
+		if created {
+			codes = append(codes, p)
+		}
+	}
+
+	s.log.Info("Сгенерирована партия промокодов",
+		zap.String("created_by", req.CreatedBy),
+		zap.String("discount_type", string(req.DiscountType)),
+		zap.Int("value", req.Value),
+		zap.Int("count", len(codes)))
+
+	return codes, nil
+}
+
+// randomCode генерирует случайный код указанной длины
+func randomCode(length int) (string, error) {
+	var sb strings.Builder
+	max := big.NewInt(int64(len(codeAlphabet)))
+	for i := 0; i < length; i++ {
+		n, err := rand.Int(rand.Reader, max)
+		if err != nil {
+			return "", fmt.Errorf("ошибка генерации кода: %w", err)
+		}
+		sb.WriteByte(codeAlphabet[n.Int64()])
+	}
+	return sb.String(), nil
+}
@@ -0,0 +1,210 @@
+// Тесты активации промокодов
+
+package promo
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"go.uber.org/zap"
+
+	"neurobot-prod/internal/currency"
+	"neurobot-prod/internal/storage/postgres/pgtest"
+	"neurobot-prod/internal/subscription"
+)
+
+// newTestService создает сервис промокодов и пользователей с указанными ID
+func newTestService(t *testing.T, userIDs ...int64) (*Service, *currency.Service) {
+	db := pgtest.Open(t)
+	for _, id := range userIDs {
+		pgtest.CreateUser(t, db, id)
+	}
+
+	log := zap.NewNop()
+	subService := subscription.NewService(subscription.NewRepository(db), log)
+	currencyService := currency.NewService(currency.NewRepository(db), subService, log)
+	return NewService(NewRepository(db), subService, currencyService, log), currencyService
+}
+
+// createPromocode сохраняет активный промокод
+func createPromocode(t *testing.T, service *Service, p *Promocode) *Promocode {
+	t.Helper()
+
+	p.IsActive = true
+	created, err := service.repo.Create(context.Background(), p)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !created {
+		t.Fatalf("промокод %s уже существует", p.Code)
+	}
+	return p
+}
+
+// assertUses проверяет счетчик использований промокода
+func assertUses(t *testing.T, service *Service, id, want int) {
+	t.Helper()
+
+	p, err := service.repo.GetByID(context.Background(), id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if p.CurrentUses != want {
+		t.Errorf("использований промокода %d, ожидалось %d", p.CurrentUses, want)
+	}
+}
+
+func TestRedeemConcurrentMaxUses(t *testing.T) {
+	users := []int64{3501, 3502, 3503, 3504, 3505, 3506, 3507, 3508}
+	service, currencyService := newTestService(t, users...)
+	ctx := context.Background()
+
+	maxUses := 3
+	p := createPromocode(t, service, &Promocode{Code: "RUSH", DiscountType: DiscountNeurons, DiscountValue: 50, MaxUses: &maxUses})
+
+	// Все пользователи активируют промокод одновременно, лимит не должен быть превышен
+	errs := make([]error, len(users))
+	var wg sync.WaitGroup
+	for i, userID := range users {
+		wg.Add(1)
+		go func(i int, userID int64) {
+			defer wg.Done()
+			_, errs[i] = service.Redeem(ctx, userID, "rush")
+		}(i, userID)
+	}
+	wg.Wait()
+
+	redeemed := 0
+	for i, err := range errs {
+		switch {
+		case err == nil:
+			redeemed++
+			b, err := currencyService.GetBalance(ctx, users[i])
+			if err != nil {
+				t.Fatal(err)
+			}
+			if b.Balance != 50 {
+				t.Errorf("баланс пользователя %d: %d, ожидалось 50", users[i], b.Balance)
+			}
+		case !errors.Is(err, ErrExhausted):
+			t.Errorf("пользователь %d: ошибка %v, ожидалась %v", users[i], err, ErrExhausted)
+		}
+	}
+	if redeemed != maxUses {
+		t.Errorf("промокод активирован %d раз, ожидалось %d", redeemed, maxUses)
+	}
+	assertUses(t, service, p.ID, maxUses)
+}
+
+func TestRedeemOncePerUser(t *testing.T) {
+	service, currencyService := newTestService(t, 3511)
+	ctx := context.Background()
+
+	p := createPromocode(t, service, &Promocode{Code: "ONCE", DiscountType: DiscountNeurons, DiscountValue: 50})
+
+	// Параллельные активации одним пользователем проходят только один раз
+	errs := make([]error, 5)
+	var wg sync.WaitGroup
+	for i := range errs {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			_, errs[i] = service.Redeem(ctx, 3511, "ONCE")
+		}(i)
+	}
+	wg.Wait()
+
+	redeemed := 0
+	for _, err := range errs {
+		switch {
+		case err == nil:
+			redeemed++
+		case !errors.Is(err, ErrAlreadyUsed):
+			t.Errorf("ошибка %v, ожидалась %v", err, ErrAlreadyUsed)
+		}
+	}
+	if redeemed != 1 {
+		t.Errorf("промокод активирован %d раз, ожидался 1", redeemed)
+	}
+
+	if _, err := service.Redeem(ctx, 3511, "ONCE"); !errors.Is(err, ErrAlreadyUsed) {
+		t.Errorf("повторная активация: %v, ожидалась %v", err, ErrAlreadyUsed)
+	}
+
+	// Отклоненные попытки не занимают использования
+	assertUses(t, service, p.ID, 1)
+	b, err := currencyService.GetBalance(ctx, 3511)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if b.Balance != 50 {
+		t.Errorf("баланс %d, ожидалось 50", b.Balance)
+	}
+}
+
+func TestRedeemUnavailable(t *testing.T) {
+	service, _ := newTestService(t, 3521, 3522)
+	ctx := context.Background()
+
+	past := time.Now().Add(-time.Hour)
+	future := time.Now().Add(time.Hour)
+	maxUses := 1
+	createPromocode(t, service, &Promocode{Code: "EXPIRED", DiscountType: DiscountNeurons, DiscountValue: 50, EndDate: &past})
+	createPromocode(t, service, &Promocode{Code: "LATER", DiscountType: DiscountNeurons, DiscountValue: 50, StartDate: &future})
+	single := createPromocode(t, service, &Promocode{Code: "SINGLE", DiscountType: DiscountNeurons, DiscountValue: 50, MaxUses: &maxUses})
+
+	tests := []struct {
+		name   string
+		userID int64
+		code   string
+		want   error
+	}{
+		{name: "срок истек", userID: 3521, code: "EXPIRED", want: ErrExpired},
+		{name: "срок не начался", userID: 3521, code: "LATER", want: ErrExpired},
+		{name: "неизвестный код", userID: 3521, code: "MISSING", want: ErrNotFound},
+		{name: "первая активация", userID: 3521, code: "SINGLE"},
+		{name: "лимит исчерпан", userID: 3522, code: "SINGLE", want: ErrExhausted},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := service.Redeem(ctx, tt.userID, tt.code); !errors.Is(err, tt.want) {
+				t.Errorf("ошибка %v, ожидалась %v", err, tt.want)
+			}
+		})
+	}
+	assertUses(t, service, single.ID, 1)
+}
+
+func TestRedeemFreeTrial(t *testing.T) {
+	service, _ := newTestService(t, 3531)
+	ctx := context.Background()
+
+	plan, err := service.subService.GetPlanByCode(ctx, "premium")
+	if err != nil {
+		t.Fatal(err)
+	}
+	createPromocode(t, service, &Promocode{Code: "TRIAL7", DiscountType: DiscountFreeTrial, DiscountValue: 7, SubscriptionPlanID: &plan.ID})
+	second := createPromocode(t, service, &Promocode{Code: "TRIAL14", DiscountType: DiscountFreeTrial, DiscountValue: 14, SubscriptionPlanID: &plan.ID})
+
+	result, err := service.Redeem(ctx, 3531, "TRIAL7")
+	if err != nil {
+		t.Fatal(err)
+	}
+	sub := result.Subscription
+	if sub == nil || sub.PlanID != plan.ID || sub.PaymentMethod != subscription.PaymentMethodTrial || sub.AutoRenew {
+		t.Fatalf("пробная подписка %+v", sub)
+	}
+	if days := sub.EndDate.Sub(sub.StartDate); days != 7*24*time.Hour {
+		t.Errorf("длительность пробного периода %s, ожидалось 7 дней", days)
+	}
+
+	// Второй пробный период не выдается, и использование второго промокода снимается
+	if _, err := service.Redeem(ctx, 3531, "TRIAL14"); !errors.Is(err, ErrNotApplicable) {
+		t.Errorf("второй пробный период: %v, ожидалась %v", err, ErrNotApplicable)
+	}
+	assertUses(t, service, second.ID, 0)
+}
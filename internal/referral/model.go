@@ -0,0 +1,107 @@
+// Модель реферальной программы
+
+package referral
+
+import (
+	"database/sql/driver"
+	"encoding/json"
+	"errors"
+	"time"
+)
+
+// Status представляет статус реферала
+type Status string
+
+const (
+	StatusPending  Status = "pending"  // Перешел по ссылке, но еще не пользовался ботом
+	StatusActive   Status = "active"   // Сделал необходимое количество запросов к нейросети
+	StatusInactive Status = "inactive" // Отключен администратором
+)
+
+// RewardType представляет тип реферального вознаграждения
+type RewardType string
+
+const (
+	RewardWelcome      RewardType = "welcome"      // За активацию приглашенного
+	RewardSubscription RewardType = "subscription" // Процент от оплаты подписки
+	RewardPurchase     RewardType = "purchase"     // Процент от покупки нейронов
+)
+
+// Metadata представляет дополнительные данные вознаграждения
+type Metadata map[string]interface{}
+
+// Value реализует интерфейс driver.Valuer для конвертации в JSONB
+func (m Metadata) Value() (driver.Value, error) {
+	if m == nil {
+		return nil, nil
+	}
+	return json.Marshal(m)
+}
+
+// Scan реализует интерфейс sql.Scanner для чтения из JSONB
+func (m *Metadata) Scan(value interface{}) error {
+	if value == nil {
+		*m = nil
+		return nil
+	}
+
+	var data []byte
+	switch v := value.(type) {
+	case []byte:
+		data = v
+	case string:
+		data = []byte(v)
+	default:
+		return errors.New("тип данных не поддерживается для Metadata.Scan")
+	}
+
+	return json.Unmarshal(data, m)
+}
+
+// Code представляет реферальный код пользователя
+type Code struct {
+	ID              int64     `db:"id"`
+	UserID          int64     `db:"user_id"`
+	ReferralCode    string    `db:"referral_code"`
+	TotalReferrals  int       `db:"total_referrals"`
+	ActiveReferrals int       `db:"active_referrals"`
+	TotalEarnings   int       `db:"total_earnings"`
+	CreatedAt       time.Time `db:"created_at"`
+	UpdatedAt       time.Time `db:"updated_at"`
+}
+
+// Referral представляет связь между пригласившим и приглашенным пользователями
+type Referral struct {
+	ID                   int64      `db:"id"`
+	ReferrerID           int64      `db:"referrer_id"`
+	ReferredID           int64      `db:"referred_id"`
+	ReferralCode         string     `db:"referral_code"`
+	Status               Status     `db:"status"`
+	WelcomeRewardClaimed bool       `db:"welcome_reward_claimed"`
+	WelcomeRewardAmount  *int       `db:"welcome_reward_amount"`
+	ActivatedAt          *time.Time `db:"activated_at"`
+	CreatedAt            time.Time  `db:"created_at"`
+	UpdatedAt            time.Time  `db:"updated_at"`
+}
+
+// Reward представляет вознаграждение пригласившему пользователю
+type Reward struct {
+	ID            int64      `db:"id"`
+	ReferrerID    int64      `db:"referrer_id"`
+	ReferredID    int64      `db:"referred_id"`
+	Amount        int        `db:"amount"`
+	RewardType    RewardType `db:"reward_type"`
+	TransactionID *int64     `db:"transaction_id"`
+	ReferenceID   string     `db:"reference_id"`
+	Metadata      Metadata   `db:"metadata"`
+	CreatedAt     time.Time  `db:"created_at"`
+}
+
+// Stats содержит сводку реферальной программы для пользователя
+type Stats struct {
+	Code            *Code
+	PurchasePercent int // Текущий процент от покупок рефералов
+	NextTierActive  int // Сколько активных рефералов нужно для следующего уровня (0 - максимальный уровень)
+	NextTierPercent int // Процент на следующем уровне
+	PendingCount    int // Приглашенные, которые еще не активированы
+}
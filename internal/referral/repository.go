@@ -0,0 +1,323 @@
+// Репозиторий реферальной программы
+
+package referral
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+)
+
+// Repository представляет репозиторий для работы с реферальной программой
+type Repository struct {
+	db *sql.DB
+}
+
+// NewRepository создает новый репозиторий реферальной программы
+func NewRepository(db *sql.DB) *Repository {
+	return &Repository{
+		db: db,
+	}
+}
+
+// codeColumns - список колонок для выборки реферального кода
+const codeColumns = `
+	id, user_id, referral_code, total_referrals, active_referrals, total_earnings, created_at, updated_at
+`
+
+// scanCode сканирует реферальный код из результата запроса
+func scanCode(row *sql.Row) (*Code, error) {
+	c := &Code{}
+	err := row.Scan(
+		&c.ID,
+		&c.UserID,
+		&c.ReferralCode,
+		&c.TotalReferrals,
+		&c.ActiveReferrals,
+		&c.TotalEarnings,
+		&c.CreatedAt,
+		&c.UpdatedAt,
+	)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("ошибка получения реферального кода: %w", err)
+	}
+	return c, nil
+}
+
+// GetCodeByUser возвращает реферальный код пользователя
+func (r *Repository) GetCodeByUser(ctx context.Context, userID int64) (*Code, error) {
+	query := `SELECT ` + codeColumns + ` FROM user_referral_codes WHERE user_id = $1`
+	return scanCode(r.db.QueryRowContext(ctx, query, userID))
+}
+
+// GetCodeByCode находит реферальный код по его значению
+func (r *Repository) GetCodeByCode(ctx context.Context, code string) (*Code, error) {
+	query := `SELECT ` + codeColumns + ` FROM user_referral_codes WHERE referral_code = $1`
+	return scanCode(r.db.QueryRowContext(ctx, query, code))
+}
+
+// CreateCode создает реферальный код. Возвращает false, если код занят
+// или у пользователя уже есть код
+func (r *Repository) CreateCode(ctx context.Context, userID int64, code string) (bool, error) {
+	result, err := r.db.ExecContext(ctx, `
+		INSERT INTO user_referral_codes (user_id, referral_code)
+		VALUES ($1, $2)
+		ON CONFLICT DO NOTHING
+	`, userID, code)
+	if err != nil {
+		return false, fmt.Errorf("ошибка создания реферального кода: %w", err)
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return false, fmt.Errorf("ошибка получения количества затронутых строк: %w", err)
+	}
+
+	return rowsAffected > 0, nil
+}
+
+// CreateReferral записывает приглашение. Возвращает false, если пользователя уже пригласили
+func (r *Repository) CreateReferral(ctx context.Context, ref *Referral) (bool, error) {
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return false, fmt.Errorf("ошибка начала транзакции: %w", err)
+	}
+	defer tx.Rollback()
+
+	err = tx.QueryRowContext(ctx, `
+		INSERT INTO user_referrals (referrer_id, referred_id, referral_code, status)
+		VALUES ($1, $2, $3, $4)
+		ON CONFLICT (referred_id) DO NOTHING
+		RETURNING id, created_at, updated_at
+	`, ref.ReferrerID, ref.ReferredID, ref.ReferralCode, ref.Status).Scan(&ref.ID, &ref.CreatedAt, &ref.UpdatedAt)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return false, nil
+		}
+		return false, fmt.Errorf("ошибка создания реферала: %w", err)
+	}
+
+	_, err = tx.ExecContext(ctx, `
+		UPDATE user_referral_codes
+		SET total_referrals = total_referrals + 1, updated_at = NOW()
+		WHERE user_id = $1
+	`, ref.ReferrerID)
+	if err != nil {
+		return false, fmt.Errorf("ошибка обновления счетчика рефералов: %w", err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return false, fmt.Errorf("ошибка подтверждения транзакции: %w", err)
+	}
+
+	return true, nil
+}
+
+// GetReferralByReferred возвращает приглашение пользователя
+func (r *Repository) GetReferralByReferred(ctx context.Context, referredID int64) (*Referral, error) {
+	query := `
+		SELECT id, referrer_id, referred_id, referral_code, status, welcome_reward_claimed,
+		       welcome_reward_amount, activated_at, created_at, updated_at
+		FROM user_referrals
+		WHERE referred_id = $1
+	`
+
+	ref := &Referral{}
+	err := r.db.QueryRowContext(ctx, query, referredID).Scan(
+		&ref.ID,
+		&ref.ReferrerID,
+		&ref.ReferredID,
+		&ref.ReferralCode,
+		&ref.Status,
+		&ref.WelcomeRewardClaimed,
+		&ref.WelcomeRewardAmount,
+		&ref.ActivatedAt,
+		&ref.CreatedAt,
+		&ref.UpdatedAt,
+	)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("ошибка получения реферала: %w", err)
+	}
+
+	return ref, nil
+}
+
+// ClaimWelcomeReward отмечает получение стартовой награды приглашенным.
+// Возвращает false, если награда уже получена
+func (r *Repository) ClaimWelcomeReward(ctx context.Context, referralID int64, amount int) (bool, error) {
+	result, err := r.db.ExecContext(ctx, `
+		UPDATE user_referrals
+		SET welcome_reward_claimed = true, welcome_reward_amount = $1, updated_at = NOW()
+		WHERE id = $2 AND welcome_reward_claimed = false
+	`, amount, referralID)
+	if err != nil {
+		return false, fmt.Errorf("ошибка отметки стартовой награды: %w", err)
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return false, fmt.Errorf("ошибка получения количества затронутых строк: %w", err)
+	}
+
+	return rowsAffected > 0, nil
+}
+
+// ReleaseWelcomeReward снимает отметку о стартовой награде, если ее не удалось начислить
+func (r *Repository) ReleaseWelcomeReward(ctx context.Context, referralID int64) error {
+	_, err := r.db.ExecContext(ctx, `
+		UPDATE user_referrals
+		SET welcome_reward_claimed = false, welcome_reward_amount = NULL, updated_at = NOW()
+		WHERE id = $1
+	`, referralID)
+	if err != nil {
+		return fmt.Errorf("ошибка снятия отметки стартовой награды: %w", err)
+	}
+
+	return nil
+}
+
+// Activate переводит реферала в активные. Возвращает false, если он уже был активирован
+func (r *Repository) Activate(ctx context.Context, ref *Referral) (bool, error) {
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return false, fmt.Errorf("ошибка начала транзакции: %w", err)
+	}
+	defer tx.Rollback()
+
+	result, err := tx.ExecContext(ctx, `
+		UPDATE user_referrals
+		SET status = $1, activated_at = NOW(), updated_at = NOW()
+		WHERE id = $2 AND status = $3
+	`, StatusActive, ref.ID, StatusPending)
+	if err != nil {
+		return false, fmt.Errorf("ошибка активации реферала: %w", err)
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return false, fmt.Errorf("ошибка получения количества затронутых строк: %w", err)
+	}
+	if rowsAffected == 0 {
+		return false, nil
+	}
+
+	_, err = tx.ExecContext(ctx, `
+		UPDATE user_referral_codes
+		SET active_referrals = active_referrals + 1, updated_at = NOW()
+		WHERE user_id = $1
+	`, ref.ReferrerID)
+	if err != nil {
+		return false, fmt.Errorf("ошибка обновления счетчика активных рефералов: %w", err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return false, fmt.Errorf("ошибка подтверждения транзакции: %w", err)
+	}
+
+	return true, nil
+}
+
+// CountChargedRequests возвращает количество оплаченных нейронами запросов пользователя.
+// Ответы из кэша и бесплатные запросы не учитываются
+func (r *Repository) CountChargedRequests(ctx context.Context, userID int64) (int, error) {
+	var count int
+	err := r.db.QueryRowContext(ctx, `
+		SELECT COUNT(*) FROM llm_usage WHERE user_id = $1 AND transaction_id IS NOT NULL
+	`, userID).Scan(&count)
+	if err != nil {
+		return 0, fmt.Errorf("ошибка подсчета запросов пользователя: %w", err)
+	}
+
+	return count, nil
+}
+
+// HasUsedBot проверяет, пользовался ли пользователь нейросетями
+func (r *Repository) HasUsedBot(ctx context.Context, userID int64) (bool, error) {
+	var exists bool
+	err := r.db.QueryRowContext(ctx, `
+		SELECT EXISTS(SELECT 1 FROM llm_usage WHERE user_id = $1)
+	`, userID).Scan(&exists)
+	if err != nil {
+		return false, fmt.Errorf("ошибка проверки использования бота: %w", err)
+	}
+
+	return exists, nil
+}
+
+// RewardExists проверяет, начислено ли уже вознаграждение за указанную сущность
+func (r *Repository) RewardExists(ctx context.Context, referredID int64, rewardType RewardType, referenceID string) (bool, error) {
+	var exists bool
+	err := r.db.QueryRowContext(ctx, `
+		SELECT EXISTS(
+			SELECT 1 FROM referral_rewards
+			WHERE referred_id = $1 AND reward_type = $2 AND reference_id = $3
+		)
+	`, referredID, rewardType, referenceID).Scan(&exists)
+	if err != nil {
+		return false, fmt.Errorf("ошибка проверки вознаграждения: %w", err)
+	}
+
+	return exists, nil
+}
+
+// AddReward записывает вознаграждение и увеличивает сумму заработка пригласившего
+func (r *Repository) AddReward(ctx context.Context, reward *Reward) error {
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("ошибка начала транзакции: %w", err)
+	}
+	defer tx.Rollback()
+
+	err = tx.QueryRowContext(ctx, `
+		INSERT INTO referral_rewards (
+			referrer_id, referred_id, amount, reward_type, transaction_id, reference_id, metadata
+		)
+		VALUES ($1, $2, $3, $4, $5, $6, $7)
+		RETURNING id, created_at
+	`,
+		reward.ReferrerID,
+		reward.ReferredID,
+		reward.Amount,
+		reward.RewardType,
+		reward.TransactionID,
+		reward.ReferenceID,
+		reward.Metadata,
+	).Scan(&reward.ID, &reward.CreatedAt)
+	if err != nil {
+		return fmt.Errorf("ошибка записи вознаграждения: %w", err)
+	}
+
+	_, err = tx.ExecContext(ctx, `
+		UPDATE user_referral_codes
+		SET total_earnings = total_earnings + $1, updated_at = NOW()
+		WHERE user_id = $2
+	`, reward.Amount, reward.ReferrerID)
+	if err != nil {
+		return fmt.Errorf("ошибка обновления заработка: %w", err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("ошибка подтверждения транзакции: %w", err)
+	}
+
+	return nil
+}
+
+// CountPending возвращает количество неактивированных приглашенных
+func (r *Repository) CountPending(ctx context.Context, referrerID int64) (int, error) {
+	var count int
+	err := r.db.QueryRowContext(ctx, `
+		SELECT COUNT(*) FROM user_referrals WHERE referrer_id = $1 AND status = $2
+	`, referrerID, StatusPending).Scan(&count)
+	if err != nil {
+		return 0, fmt.Errorf("ошибка подсчета рефералов: %w", err)
+	}
+
+	return count, nil
+}
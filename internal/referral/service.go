@@ -0,0 +1,442 @@
+// Сервис реферальной программы
+
+package referral
+
+import (
+	"context"
+	"crypto/rand"
+	"errors"
+	"fmt"
+	"math/big"
+	"strconv"
+	"strings"
+
+	"go.uber.org/zap"
+
+	"neurobot-prod/internal/config"
+	"neurobot-prod/internal/currency"
+	"neurobot-prod/internal/events"
+	"neurobot-prod/internal/loyalty"
+)
+
+// DeepLinkPrefix - префикс параметра команды /start для реферальных ссылок
+const DeepLinkPrefix = "ref_"
+
+// codeAlphabet - символы реферальных кодов без легко путаемых 0/O и 1/I
+const codeAlphabet = "ABCDEFGHJKLMNPQRSTUVWXYZ23456789"
+
+var (
+	// ErrDisabled возвращается, если реферальная программа отключена
+	ErrDisabled = errors.New("реферальная программа отключена")
+	// ErrInvalidCode возвращается для несуществующего реферального кода
+	ErrInvalidCode = errors.New("реферальный код не найден")
+	// ErrSelfReferral возвращается при попытке пригласить самого себя
+	ErrSelfReferral = errors.New("нельзя использовать свой реферальный код")
+	// ErrAlreadyReferred возвращается, если пользователь уже был приглашен
+	ErrAlreadyReferred = errors.New("пользователь уже приглашен")
+	// ErrNotNewUser возвращается, если пользователь уже пользовался ботом до перехода по ссылке
+	ErrNotNewUser = errors.New("реферальная ссылка действует только для новых пользователей")
+)
+
+// Notifier отправляет пользователю сообщение о реферальном вознаграждении
+type Notifier func(userID int64, text string)
+
+// Service предоставляет методы для работы с реферальной программой
+type Service struct {
+	repo            *Repository
+	currencyService *currency.Service
+	loyaltyService  *loyalty.Service
+	events          events.Emitter
+	config          config.ReferralConfig
+	notify          Notifier
+	log             *zap.Logger
+}
+
+// NewService создает новый сервис реферальной программы
+func NewService(repo *Repository, currencyService *currency.Service, cfg config.ReferralConfig, log *zap.Logger) *Service {
+	return &Service{
+		repo:            repo,
+		currencyService: currencyService,
+		config:          cfg,
+		log:             log.Named("referral_service"),
+	}
+}
+
+// SetNotifier устанавливает функцию уведомления о вознаграждениях
+func (s *Service) SetNotifier(notify Notifier) {
+	s.notify = notify
+}
+
+// SetLoyalty включает начисление опыта пригласившему за активных рефералов
+func (s *Service) SetLoyalty(loyaltyService *loyalty.Service) {
+	s.loyaltyService = loyaltyService
+}
+
+// SetEvents включает публикацию доменных событий
+func (s *Service) SetEvents(emitter events.Emitter) {
+	s.events = emitter
+}
+
+// emit публикует доменное событие, если задана шина событий
+func (s *Service) emit(ctx context.Context, eventType events.Type, userID int64, data map[string]interface{}) {
+	if s.events != nil {
+		s.events.Emit(ctx, events.New(eventType, userID, data))
+	}
+}
+
+// Enabled проверяет, включена ли реферальная программа
+func (s *Service) Enabled() bool {
+	return s.config.Enabled
+}
+
+// GetOrCreateCode возвращает реферальный код пользователя, создавая его при первом обращении
+func (s *Service) GetOrCreateCode(ctx context.Context, userID int64) (*Code, error) {
+	code, err := s.repo.GetCodeByUser(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	if code != nil {
+		return code, nil
+	}
+
+	for attempt := 0; attempt < 5; attempt++ {
+		value, err := randomCode(8)
+		if err != nil {
+			return nil, err
+		}
+
+		if _, err := s.repo.CreateCode(ctx, userID, value); err != nil {
+			return nil, err
+		}
+
+		// Код мог создать параллельный запрос, поэтому перечитываем его
+		code, err := s.repo.GetCodeByUser(ctx, userID)
+		if err != nil {
+			return nil, err
+		}
+		if code != nil {
+			return code, nil
+		}
+	}
+
+	return nil, errors.New("не удалось создать уникальный реферальный код")
+}
+
+// ParseDeepLink извлекает реферальный код из параметра команды /start
+func ParseDeepLink(payload string) (string, bool) {
+	if !strings.HasPrefix(payload, DeepLinkPrefix) {
+		return "", false
+	}
+	code := strings.ToUpper(strings.TrimPrefix(payload, DeepLinkPrefix))
+	return code, code != ""
+}
+
+// RegisterReferral привязывает нового пользователя к пригласившему и начисляет стартовую награду.
+// Возвращает приглашение и количество начисленных нейронов
+func (s *Service) RegisterReferral(ctx context.Context, referredID int64, code string) (*Referral, int, error) {
+	if !s.config.Enabled {
+		return nil, 0, ErrDisabled
+	}
+
+	referrerCode, err := s.repo.GetCodeByCode(ctx, strings.ToUpper(code))
+	if err != nil {
+		return nil, 0, err
+	}
+	if referrerCode == nil {
+		return nil, 0, ErrInvalidCode
+	}
+	if referrerCode.UserID == referredID {
+		return nil, 0, ErrSelfReferral
+	}
+
+	existing, err := s.repo.GetReferralByReferred(ctx, referredID)
+	if err != nil {
+		return nil, 0, err
+	}
+	if existing != nil {
+		return nil, 0, ErrAlreadyReferred
+	}
+
+	// Ссылка не должна давать бонус тем, кто уже пользовался ботом
+	used, err := s.repo.HasUsedBot(ctx, referredID)
+	if err != nil {
+		return nil, 0, err
+	}
+	if used {
+		return nil, 0, ErrNotNewUser
+	}
+
+	ref := &Referral{
+		ReferrerID:   referrerCode.UserID,
+		ReferredID:   referredID,
+		ReferralCode: referrerCode.ReferralCode,
+		Status:       StatusPending,
+	}
+	created, err := s.repo.CreateReferral(ctx, ref)
+	if err != nil {
+		s.log.Error("Ошибка создания реферала",
+			zap.Int64("referred_id", referredID),
+			zap.String("code", referrerCode.ReferralCode),
+			zap.Error(err))
+		return nil, 0, err
+	}
+	if !created {
+		return nil, 0, ErrAlreadyReferred
+	}
+
+	s.log.Info("Новый реферал",
+		zap.Int64("referrer_id", ref.ReferrerID),
+		zap.Int64("referred_id", referredID))
+
+	bonus, err := s.grantWelcomeBonus(ctx, ref)
+	if err != nil {
+		// Приглашение уже записано, поэтому ошибку начисления только логируем
+		s.log.Error("Ошибка начисления стартовой награды рефералу",
+			zap.Int64("referred_id", referredID),
+			zap.Error(err))
+	}
+
+	return ref, bonus, nil
+}
+
+// grantWelcomeBonus начисляет стартовую награду приглашенному ровно один раз
+func (s *Service) grantWelcomeBonus(ctx context.Context, ref *Referral) (int, error) {
+	amount := s.config.ReferredBonus
+	if amount <= 0 {
+		return 0, nil
+	}
+
+	claimed, err := s.repo.ClaimWelcomeReward(ctx, ref.ID, amount)
+	if err != nil || !claimed {
+		return 0, err
+	}
+
+	// Ссылка на реферала уникальна и служит ключом идемпотентности начисления
+	reference := fmt.Sprintf("referral:%d:welcome", ref.ID)
+	_, err = s.currencyService.AddNeurons(ctx, ref.ReferredID, amount, currency.TypeReferral,
+		"Бонус за регистрацию по приглашению",
+		currency.Metadata{"referral_id": ref.ID, "referrer_id": ref.ReferrerID},
+		reference, reference, 0)
+	if err != nil {
+		if releaseErr := s.repo.ReleaseWelcomeReward(ctx, ref.ID); releaseErr != nil {
+			s.log.Error("Ошибка снятия отметки стартовой награды",
+				zap.Int64("referral_id", ref.ID),
+				zap.Error(releaseErr))
+		}
+		return 0, err
+	}
+
+	return amount, nil
+}
+
+// TrackActivity активирует реферала, когда он сделал нужное количество запросов к нейросети,
+// и начисляет награду пригласившему
+func (s *Service) TrackActivity(ctx context.Context, userID int64) error {
+	if !s.config.Enabled {
+		return nil
+	}
+
+	ref, err := s.repo.GetReferralByReferred(ctx, userID)
+	if err != nil {
+		return err
+	}
+	if ref == nil || ref.Status != StatusPending {
+		return nil
+	}
+
+	count, err := s.repo.CountChargedRequests(ctx, userID)
+	if err != nil {
+		return err
+	}
+	if count < s.config.ActivationRequests {
+		return nil
+	}
+
+	activated, err := s.repo.Activate(ctx, ref)
+	if err != nil {
+		s.log.Error("Ошибка активации реферала",
+			zap.Int64("referral_id", ref.ID),
+			zap.Error(err))
+		return err
+	}
+	if !activated {
+		return nil
+	}
+
+	s.log.Info("Реферал активирован",
+		zap.Int64("referrer_id", ref.ReferrerID),
+		zap.Int64("referred_id", ref.ReferredID))
+
+	s.emit(ctx, events.ReferralActivated, ref.ReferrerID, map[string]interface{}{
+		"referral_id": ref.ID,
+		"referred_id": ref.ReferredID,
+	})
+
+	if s.loyaltyService != nil {
+		if _, err := s.loyaltyService.AwardReferral(ctx, ref.ReferrerID, ref.ReferredID); err != nil {
+			s.log.Error("Ошибка начисления опыта за реферала",
+				zap.Int64("referrer_id", ref.ReferrerID),
+				zap.Error(err))
+		}
+	}
+
+	amount := s.config.ReferrerBonus
+	if amount <= 0 {
+		return nil
+	}
+
+	if err := s.reward(ctx, ref, RewardWelcome, amount, strconv.FormatInt(ref.ID, 10), nil); err != nil {
+		return err
+	}
+
+	s.sendNotification(ref.ReferrerID, fmt.Sprintf(
+		"🎉 Приглашенный вами пользователь начал пользоваться ботом! Начислено %d нейронов.", amount))
+
+	return nil
+}
+
+// RewardPurchase начисляет пригласившему процент от покупки приглашенного пользователя.
+// Повторный вызов для того же платежа не начисляет награду второй раз
+func (s *Service) RewardPurchase(ctx context.Context, userID int64, amountKopecks int, isSubscription bool, referenceID string) error {
+	if !s.config.Enabled || s.config.KopecksPerNeuron <= 0 {
+		return nil
+	}
+
+	ref, err := s.repo.GetReferralByReferred(ctx, userID)
+	if err != nil {
+		return err
+	}
+	if ref == nil || ref.Status == StatusInactive {
+		return nil
+	}
+
+	rewardType := RewardPurchase
+	if isSubscription {
+		rewardType = RewardSubscription
+	}
+
+	exists, err := s.repo.RewardExists(ctx, userID, rewardType, referenceID)
+	if err != nil || exists {
+		return err
+	}
+
+	referrerCode, err := s.repo.GetCodeByUser(ctx, ref.ReferrerID)
+	if err != nil {
+		return err
+	}
+	if referrerCode == nil {
+		return nil
+	}
+
+	tier := s.config.GetTier(referrerCode.ActiveReferrals)
+	amount := amountKopecks * tier.PurchasePercent / 100 / s.config.KopecksPerNeuron
+	if amount <= 0 {
+		return nil
+	}
+
+	metadata := Metadata{
+		"purchase_amount": amountKopecks,
+		"percent":         tier.PurchasePercent,
+	}
+	if err := s.reward(ctx, ref, rewardType, amount, referenceID, metadata); err != nil {
+		return err
+	}
+
+	s.sendNotification(ref.ReferrerID, fmt.Sprintf(
+		"💰 Приглашенный вами пользователь совершил покупку. Вам начислено %d нейронов (%d%%).",
+		amount, tier.PurchasePercent))
+
+	return nil
+}
+
+// reward начисляет нейроны пригласившему и записывает вознаграждение
+func (s *Service) reward(ctx context.Context, ref *Referral, rewardType RewardType, amount int, referenceID string, metadata Metadata) error {
+	reference := fmt.Sprintf("referral:%d:%s:%s", ref.ID, rewardType, referenceID)
+	tx, err := s.currencyService.AddNeurons(ctx, ref.ReferrerID, amount, currency.TypeReferral,
+		"Вознаграждение за приглашенного пользователя",
+		currency.Metadata{"referral_id": ref.ID, "referred_id": ref.ReferredID, "reward_type": string(rewardType)},
+		reference, reference, 0)
+	if err != nil {
+		s.log.Error("Ошибка начисления реферального вознаграждения",
+			zap.Int64("referrer_id", ref.ReferrerID),
+			zap.String("reward_type", string(rewardType)),
+			zap.Error(err))
+		return fmt.Errorf("ошибка начисления реферального вознаграждения: %w", err)
+	}
+
+	reward := &Reward{
+		ReferrerID:    ref.ReferrerID,
+		ReferredID:    ref.ReferredID,
+		Amount:        amount,
+		RewardType:    rewardType,
+		TransactionID: &tx.ID,
+		ReferenceID:   referenceID,
+		Metadata:      metadata,
+	}
+	if err := s.repo.AddReward(ctx, reward); err != nil {
+		s.log.Error("Ошибка записи реферального вознаграждения",
+			zap.Int64("referrer_id", ref.ReferrerID),
+			zap.Int64("transaction_id", tx.ID),
+			zap.Error(err))
+		return err
+	}
+
+	s.log.Info("Начислено реферальное вознаграждение",
+		zap.Int64("referrer_id", ref.ReferrerID),
+		zap.Int64("referred_id", ref.ReferredID),
+		zap.String("reward_type", string(rewardType)),
+		zap.Int("amount", amount))
+
+	return nil
+}
+
+// GetStats возвращает сводку реферальной программы для пользователя
+func (s *Service) GetStats(ctx context.Context, userID int64) (*Stats, error) {
+	code, err := s.GetOrCreateCode(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	pending, err := s.repo.CountPending(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	stats := &Stats{
+		Code:            code,
+		PurchasePercent: s.config.GetTier(code.ActiveReferrals).PurchasePercent,
+		PendingCount:    pending,
+	}
+	if next := s.config.GetNextTier(code.ActiveReferrals); next != nil {
+		stats.NextTierActive = next.MinActive
+		stats.NextTierPercent = next.PurchasePercent
+	}
+
+	return stats, nil
+}
+
+// GetConfig возвращает настройки реферальной программы
+func (s *Service) GetConfig() config.ReferralConfig {
+	return s.config
+}
+
+// sendNotification отправляет уведомление пользователю, если задан способ уведомления
+func (s *Service) sendNotification(userID int64, text string) {
+	if s.notify != nil {
+		s.notify(userID, text)
+	}
+}
+
+// randomCode генерирует случайный код указанной длины
+func randomCode(length int) (string, error) {
+	var sb strings.Builder
+	max := big.NewInt(int64(len(codeAlphabet)))
+	for i := 0; i < length; i++ {
+		n, err := rand.Int(rand.Reader, max)
+		if err != nil {
+			return "", fmt.Errorf("ошибка генерации кода: %w", err)
+		}
+		sb.WriteByte(codeAlphabet[n.Int64()])
+	}
+	return sb.String(), nil
+}
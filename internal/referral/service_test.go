@@ -0,0 +1,118 @@
+// Тесты начисления реферальных вознаграждений
+
+package referral
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+
+	"go.uber.org/zap"
+
+	"neurobot-prod/internal/config"
+	"neurobot-prod/internal/currency"
+	"neurobot-prod/internal/storage/postgres/pgtest"
+	"neurobot-prod/internal/subscription"
+)
+
+// assertBalance проверяет баланс пользователя
+func assertBalance(t *testing.T, currencyService *currency.Service, userID int64, want int) {
+	t.Helper()
+
+	b, err := currencyService.GetBalance(context.Background(), userID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if b.Balance != want {
+		t.Errorf("баланс пользователя %d: %d, ожидался %d", userID, b.Balance, want)
+	}
+}
+
+func TestReferralPaysOnce(t *testing.T) {
+	db := pgtest.Open(t)
+	pgtest.CreateUser(t, db, 3701)
+	pgtest.CreateUser(t, db, 3702)
+	ctx := context.Background()
+
+	log := zap.NewNop()
+	subService := subscription.NewService(subscription.NewRepository(db), log)
+	currencyService := currency.NewService(currency.NewRepository(db), subService, log)
+	service := NewService(NewRepository(db), currencyService, config.ReferralConfig{
+		Enabled:            true,
+		ReferredBonus:      20,
+		ReferrerBonus:      50,
+		ActivationRequests: 1,
+		KopecksPerNeuron:   100,
+		Tiers:              []config.ReferralTier{{MinActive: 0, PurchasePercent: 10}},
+	}, log)
+
+	code, err := service.GetOrCreateCode(ctx, 3701)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err := service.RegisterReferral(ctx, 3701, code.ReferralCode); !errors.Is(err, ErrSelfReferral) {
+		t.Errorf("свой код: %v, ожидалась %v", err, ErrSelfReferral)
+	}
+
+	// Стартовая награда начисляется только по первому переходу
+	if _, bonus, err := service.RegisterReferral(ctx, 3702, code.ReferralCode); err != nil || bonus != 20 {
+		t.Fatalf("стартовая награда %d: %v", bonus, err)
+	}
+	if _, _, err := service.RegisterReferral(ctx, 3702, code.ReferralCode); !errors.Is(err, ErrAlreadyReferred) {
+		t.Errorf("повторный переход: %v, ожидалась %v", err, ErrAlreadyReferred)
+	}
+	assertBalance(t, currencyService, 3702, 20)
+
+	// До первого платного запроса реферал не активен
+	if err := service.TrackActivity(ctx, 3702); err != nil {
+		t.Fatal(err)
+	}
+	assertBalance(t, currencyService, 3701, 0)
+
+	if _, err := currencyService.RecordLLMUsage(ctx, 3702, "model", "вопрос", "ответ", 10, 10, 5, nil); err != nil {
+		t.Fatal(err)
+	}
+
+	// Параллельные проверки активности начисляют награду пригласившему один раз
+	var wg sync.WaitGroup
+	errs := make([]error, 5)
+	for i := range errs {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			errs[i] = service.TrackActivity(ctx, 3702)
+		}(i)
+	}
+	wg.Wait()
+	for _, err := range errs {
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	assertBalance(t, currencyService, 3701, 50)
+
+	code, err = service.GetOrCreateCode(ctx, 3701)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if code.ActiveReferrals != 1 {
+		t.Errorf("активных рефералов %d, ожидался 1", code.ActiveReferrals)
+	}
+
+	// Награда за покупку начисляется один раз на платеж: 10% от 1000 рублей по курсу 1 рубль за нейрон
+	for i := 0; i < 2; i++ {
+		if err := service.RewardPurchase(ctx, 3702, 100000, false, "pay-1"); err != nil {
+			t.Fatal(err)
+		}
+	}
+	assertBalance(t, currencyService, 3701, 150)
+
+	code, err = service.GetOrCreateCode(ctx, 3701)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if code.TotalEarnings != 150 {
+		t.Errorf("заработок пригласившего %d, ожидалось 150", code.TotalEarnings)
+	}
+}
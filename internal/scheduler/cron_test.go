@@ -0,0 +1,111 @@
+// Тесты разбора cron-выражений
+
+package scheduler
+
+import (
+	"testing"
+	"time"
+)
+
+func TestParseScheduleErrors(t *testing.T) {
+	for _, expr := range []string{
+		"",
+		"* * * *",
+		"* * * * * *",
+		"60 * * * *",
+		"* 24 * * *",
+		"* * 0 * *",
+		"* * * 13 *",
+		"* * * * 8",
+		"5-1 * * * *",
+		"*/0 * * * *",
+		"a * * * *",
+		"1-x * * * *",
+		"@every",
+	} {
+		if _, err := ParseSchedule(expr); err == nil {
+			t.Errorf("ParseSchedule(%q): ожидалась ошибка", expr)
+		}
+	}
+}
+
+func TestScheduleNext(t *testing.T) {
+	loc, err := time.LoadLocation("Europe/Moscow")
+	if err != nil {
+		t.Skipf("нет данных часового пояса: %v", err)
+	}
+	at := func(s string) time.Time {
+		tm, err := time.ParseInLocation("2006-01-02 15:04", s, loc)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return tm
+	}
+
+	// 2026-10-18 - воскресенье
+	tests := []struct {
+		expr string
+		from string
+		want string
+	}{
+		{"* * * * *", "2026-10-18 10:00", "2026-10-18 10:01"},
+		{"5 * * * *", "2026-10-18 10:05", "2026-10-18 11:05"},
+		{"5 * * * *", "2026-10-18 10:04", "2026-10-18 10:05"},
+		{"*/15 * * * *", "2026-10-18 10:16", "2026-10-18 10:30"},
+		{"*/15 * * * *", "2026-10-18 10:45", "2026-10-18 11:00"},
+		{"30 4 * * *", "2026-10-18 04:30", "2026-10-19 04:30"},
+		{"0 9-17/4 * * *", "2026-10-18 10:00", "2026-10-18 13:00"},
+		{"0 0 1,15 * *", "2026-10-18 10:00", "2026-11-01 00:00"},
+		{"0 0 * * 1-5", "2026-10-17 12:00", "2026-10-19 00:00"},
+		{"0 0 * * 7", "2026-10-18 12:00", "2026-10-25 00:00"},
+		{"0 0 * * 0", "2026-10-18 12:00", "2026-10-25 00:00"},
+		{"0 0 31 * *", "2026-11-01 00:00", "2026-12-31 00:00"},
+		{"0 0 29 2 *", "2026-03-01 00:00", "2028-02-29 00:00"},
+		{"@daily", "2026-12-31 23:59", "2027-01-01 00:00"},
+		{"@hourly", "2026-10-18 10:59", "2026-10-18 11:00"},
+		{"@WEEKLY", "2026-10-18 00:00", "2026-10-25 00:00"},
+		// Ограничены оба дня: достаточно совпадения любого
+		{"0 0 1 * 1", "2026-10-18 00:00", "2026-10-19 00:00"},
+		{"0 0 20 * 6", "2026-10-18 00:00", "2026-10-20 00:00"},
+		// Поле с * и шагом не делает условие дня "или": должны совпасть оба поля
+		{"0 0 */2 * 1", "2026-10-19 00:00", "2026-11-09 00:00"},
+		{"0 0 1 * */2", "2026-11-01 00:00", "2026-12-01 00:00"},
+	}
+	for _, tt := range tests {
+		s, err := ParseSchedule(tt.expr)
+		if err != nil {
+			t.Errorf("ParseSchedule(%q): %v", tt.expr, err)
+			continue
+		}
+		if got := s.Next(at(tt.from)); !got.Equal(at(tt.want)) {
+			t.Errorf("%q от %s: получено %s, ожидалось %s", tt.expr, tt.from, got.Format("2006-01-02 15:04"), tt.want)
+		}
+	}
+}
+
+func TestScheduleNextNever(t *testing.T) {
+	s, err := ParseSchedule("0 0 30 2 *")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := s.Next(time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)); !got.IsZero() {
+		t.Errorf("30 февраля не существует, получено %s", got)
+	}
+}
+
+func TestScheduleNextLocation(t *testing.T) {
+	loc, err := time.LoadLocation("Europe/Moscow")
+	if err != nil {
+		t.Skipf("нет данных часового пояса: %v", err)
+	}
+	s, err := ParseSchedule("30 4 * * *")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// 01:00 UTC - это 04:00 по Москве, запуск в 04:30 по Москве
+	got := s.Next(time.Date(2026, 10, 18, 1, 0, 0, 0, time.UTC).In(loc))
+	if want := time.Date(2026, 10, 18, 1, 30, 0, 0, time.UTC); !got.Equal(want) {
+		t.Errorf("получено %s, ожидалось %s", got.UTC(), want)
+	}
+}
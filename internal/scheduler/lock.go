@@ -0,0 +1,150 @@
+// Блокировки задач в Redis для работы нескольких экземпляров scheduler
+
+package scheduler
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+	"go.uber.org/zap"
+)
+
+const (
+	// tickKeyPrefix - префикс ключей, отмечающих запуск задачи по расписанию
+	tickKeyPrefix = "scheduler:tick:"
+	// lockKeyPrefix - префикс ключей блокировки выполняющейся задачи
+	lockKeyPrefix = "scheduler:lock:"
+	// tickClaimTTL - время хранения отметки о запуске. Должно превышать возможное
+	// расхождение часов между экземплярами
+	tickClaimTTL = time.Hour
+)
+
+var (
+	// releaseScript снимает блокировку, только если она принадлежит этому экземпляру
+	releaseScript = redis.NewScript(`
+		if redis.call("GET", KEYS[1]) == ARGV[1] then
+			return redis.call("DEL", KEYS[1])
+		end
+		return 0
+	`)
+	// extendScript продлевает блокировку, только если она принадлежит этому экземпляру
+	extendScript = redis.NewScript(`
+		if redis.call("GET", KEYS[1]) == ARGV[1] then
+			return redis.call("PEXPIRE", KEYS[1], ARGV[2])
+		end
+		return 0
+	`)
+)
+
+// Locker распределяет запуски задач между экземплярами scheduler через Redis
+type Locker struct {
+	redis *redis.Client
+	ttl   time.Duration
+	log   *zap.Logger
+}
+
+// NewLocker создает новый распределитель запусков
+func NewLocker(redisClient *redis.Client, ttl time.Duration, log *zap.Logger) *Locker {
+	if ttl <= 0 {
+		ttl = time.Minute
+	}
+	return &Locker{redis: redisClient, ttl: ttl, log: log}
+}
+
+// ClaimTick отмечает запуск задачи по расписанию. Возвращает false, если этот запуск
+// уже взял другой экземпляр, в том числе завершивший задачу до пробуждения этого
+func (l *Locker) ClaimTick(ctx context.Context, job string, tick time.Time) (bool, error) {
+	key := fmt.Sprintf("%s%s:%d", tickKeyPrefix, job, tick.Unix())
+	claimed, err := l.redis.SetNX(ctx, key, 1, tickClaimTTL).Result()
+	if err != nil {
+		return false, fmt.Errorf("ошибка отметки запуска задачи: %w", err)
+	}
+	return claimed, nil
+}
+
+// Acquire берет блокировку выполняющейся задачи, чтобы долгий запуск не пересекся
+// со следующим на другом экземпляре. Блокировка продлевается, пока не вызван Release.
+// Возвращает nil, если задача уже выполняется
+func (l *Locker) Acquire(ctx context.Context, job string) (*Lock, error) {
+	token, err := newToken()
+	if err != nil {
+		return nil, err
+	}
+
+	key := lockKeyPrefix + job
+	acquired, err := l.redis.SetNX(ctx, key, token, l.ttl).Result()
+	if err != nil {
+		return nil, fmt.Errorf("ошибка получения блокировки задачи: %w", err)
+	}
+	if !acquired {
+		return nil, nil
+	}
+
+	lock := &Lock{
+		locker: l,
+		key:    key,
+		token:  token,
+		stop:   make(chan struct{}),
+		done:   make(chan struct{}),
+	}
+	go lock.keepAlive()
+	return lock, nil
+}
+
+// Lock представляет блокировку выполняющейся задачи
+type Lock struct {
+	locker *Locker
+	key    string
+	token  string
+	stop   chan struct{}
+	done   chan struct{}
+}
+
+// keepAlive продлевает блокировку на время выполнения задачи
+func (l *Lock) keepAlive() {
+	defer close(l.done)
+
+	ticker := time.NewTicker(l.locker.ttl / 3)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-l.stop:
+			return
+		case <-ticker.C:
+			ctx, cancel := context.WithTimeout(context.Background(), l.locker.ttl/3)
+			extended, err := extendScript.Run(ctx, l.locker.redis, []string{l.key}, l.token, l.locker.ttl.Milliseconds()).Int()
+			cancel()
+			if err != nil {
+				l.locker.log.Warn("Ошибка продления блокировки задачи", zap.String("key", l.key), zap.Error(err))
+			} else if extended == 0 {
+				l.locker.log.Warn("Блокировка задачи потеряна", zap.String("key", l.key))
+			}
+		}
+	}
+}
+
+// Release снимает блокировку
+func (l *Lock) Release() {
+	close(l.stop)
+	<-l.done
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := releaseScript.Run(ctx, l.locker.redis, []string{l.key}, l.token).Err(); err != nil {
+		l.locker.log.Warn("Ошибка снятия блокировки задачи", zap.String("key", l.key), zap.Error(err))
+	}
+}
+
+// newToken создает случайный идентификатор владельца блокировки
+func newToken() (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", fmt.Errorf("ошибка генерации токена блокировки: %w", err)
+	}
+	return hex.EncodeToString(b), nil
+}
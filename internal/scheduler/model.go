@@ -0,0 +1,34 @@
+// Модель периодических задач
+
+package scheduler
+
+import (
+	"context"
+	"time"
+)
+
+// JobFunc выполняет задачу и возвращает краткий итог для истории запусков
+type JobFunc func(ctx context.Context) (string, error)
+
+// RunStatus представляет статус запуска задачи
+type RunStatus string
+
+const (
+	RunRunning   RunStatus = "running"
+	RunSucceeded RunStatus = "succeeded"
+	RunFailed    RunStatus = "failed"
+)
+
+// Run представляет запуск задачи
+type Run struct {
+	ID          int64      `db:"id"`
+	JobName     string     `db:"job_name"`
+	Instance    string     `db:"instance"`
+	ScheduledAt time.Time  `db:"scheduled_at"`
+	StartedAt   time.Time  `db:"started_at"`
+	FinishedAt  *time.Time `db:"finished_at"`
+	DurationMs  int64      `db:"duration_ms"`
+	Status      RunStatus  `db:"status"`
+	Result      string     `db:"result"`
+	Error       string     `db:"error"`
+}
@@ -0,0 +1,63 @@
+// Репозиторий истории запусков задач
+
+package scheduler
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"time"
+)
+
+// Repository представляет репозиторий истории запусков задач
+type Repository struct {
+	db *sql.DB
+}
+
+// NewRepository создает новый репозиторий истории запусков
+func NewRepository(db *sql.DB) *Repository {
+	return &Repository{
+		db: db,
+	}
+}
+
+// StartRun сохраняет начало запуска задачи
+func (r *Repository) StartRun(ctx context.Context, run *Run) error {
+	err := r.db.QueryRowContext(ctx, `
+		INSERT INTO job_runs (job_name, instance, scheduled_at, status)
+		VALUES ($1, $2, $3, $4)
+		RETURNING id, started_at
+	`, run.JobName, run.Instance, run.ScheduledAt, run.Status).Scan(&run.ID, &run.StartedAt)
+	if err != nil {
+		return fmt.Errorf("ошибка сохранения запуска задачи: %w", err)
+	}
+	return nil
+}
+
+// FinishRun сохраняет результат запуска задачи
+func (r *Repository) FinishRun(ctx context.Context, run *Run) error {
+	_, err := r.db.ExecContext(ctx, `
+		UPDATE job_runs
+		SET status = $2, finished_at = $3, duration_ms = $4, result = NULLIF($5, ''), error = NULLIF($6, '')
+		WHERE id = $1
+	`, run.ID, run.Status, run.FinishedAt, run.DurationMs, run.Result, run.Error)
+	if err != nil {
+		return fmt.Errorf("ошибка сохранения результата задачи: %w", err)
+	}
+	return nil
+}
+
+// DeleteRunsBefore удаляет историю запусков старше указанного времени
+func (r *Repository) DeleteRunsBefore(ctx context.Context, before time.Time) (int, error) {
+	result, err := r.db.ExecContext(ctx, `DELETE FROM job_runs WHERE started_at < $1`, before)
+	if err != nil {
+		return 0, fmt.Errorf("ошибка удаления истории запусков: %w", err)
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return 0, fmt.Errorf("ошибка получения количества затронутых строк: %w", err)
+	}
+
+	return int(rowsAffected), nil
+}
@@ -0,0 +1,233 @@
+// Запуск периодических задач по расписанию
+
+package scheduler
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"sort"
+	"sync"
+	"time"
+
+	"go.uber.org/zap"
+
+	"neurobot-prod/internal/config"
+)
+
+// ErrDuplicateJob возвращается при повторной регистрации задачи с тем же названием
+var ErrDuplicateJob = errors.New("задача уже зарегистрирована")
+
+// job представляет зарегистрированную задачу
+type job struct {
+	name     string
+	spec     string
+	schedule *Schedule
+	run      JobFunc
+}
+
+// Scheduler запускает зарегистрированные задачи по cron-расписанию. Каждый запуск
+// выполняет только один экземпляр, его длительность и итог сохраняются в job_runs
+type Scheduler struct {
+	repo     *Repository
+	locker   *Locker
+	config   config.SchedulerConfig
+	location *time.Location
+	instance string
+	jobs     []*job
+	ctx      context.Context
+	cancel   context.CancelFunc
+	wg       sync.WaitGroup
+	log      *zap.Logger
+}
+
+// NewScheduler создает новый планировщик задач
+func NewScheduler(repo *Repository, locker *Locker, cfg config.SchedulerConfig, log *zap.Logger) (*Scheduler, error) {
+	location, err := time.LoadLocation(cfg.Timezone)
+	if err != nil {
+		return nil, fmt.Errorf("ошибка загрузки часового пояса %s: %w", cfg.Timezone, err)
+	}
+
+	hostname, err := os.Hostname()
+	if err != nil {
+		hostname = "unknown"
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	return &Scheduler{
+		repo:     repo,
+		locker:   locker,
+		config:   cfg,
+		location: location,
+		instance: fmt.Sprintf("%s/%d", hostname, os.Getpid()),
+		ctx:      ctx,
+		cancel:   cancel,
+		log:      log.Named("scheduler"),
+	}, nil
+}
+
+// Register добавляет задачу с расписанием из конфигурации (scheduler.jobs.<name>).
+// Задача без расписания в конфигурации отключена. Задачи нужно зарегистрировать до вызова Start
+func (s *Scheduler) Register(name string, run JobFunc) error {
+	for _, j := range s.jobs {
+		if j.name == name {
+			return fmt.Errorf("%w: %s", ErrDuplicateJob, name)
+		}
+	}
+
+	spec := s.config.Jobs[name]
+	if spec == "" {
+		s.log.Info("Задача отключена: нет расписания", zap.String("job", name))
+		return nil
+	}
+
+	schedule, err := ParseSchedule(spec)
+	if err != nil {
+		return fmt.Errorf("ошибка разбора расписания задачи %s: %w", name, err)
+	}
+
+	s.jobs = append(s.jobs, &job{name: name, spec: spec, schedule: schedule, run: run})
+	return nil
+}
+
+// Start запускает задачи по расписанию
+func (s *Scheduler) Start() {
+	// Расписания для незарегистрированных задач, скорее всего, содержат опечатку
+	names := make([]string, 0, len(s.config.Jobs))
+	for name := range s.config.Jobs {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		if !s.registered(name) && s.config.Jobs[name] != "" {
+			s.log.Warn("Расписание задано для неизвестной задачи", zap.String("job", name))
+		}
+	}
+
+	for _, j := range s.jobs {
+		s.log.Info("Задача запланирована",
+			zap.String("job", j.name),
+			zap.String("schedule", j.spec),
+			zap.Time("next_run", j.schedule.Next(time.Now().In(s.location))))
+
+		s.wg.Add(1)
+		go s.loop(j)
+	}
+}
+
+// registered проверяет, зарегистрирована ли задача
+func (s *Scheduler) registered(name string) bool {
+	for _, j := range s.jobs {
+		if j.name == name {
+			return true
+		}
+	}
+	return false
+}
+
+// Stop прерывает выполняющиеся задачи и дожидается их завершения
+func (s *Scheduler) Stop() {
+	s.cancel()
+	s.wg.Wait()
+}
+
+// loop ждет время запуска задачи и выполняет ее
+func (s *Scheduler) loop(j *job) {
+	defer s.wg.Done()
+
+	for {
+		next := j.schedule.Next(time.Now().In(s.location))
+		if next.IsZero() {
+			s.log.Warn("Для задачи не найдено время следующего запуска", zap.String("job", j.name))
+			return
+		}
+
+		timer := time.NewTimer(time.Until(next))
+		select {
+		case <-s.ctx.Done():
+			timer.Stop()
+			return
+		case <-timer.C:
+		}
+
+		s.execute(j, next)
+	}
+}
+
+// execute выполняет запуск задачи, если его не взял другой экземпляр
+func (s *Scheduler) execute(j *job, tick time.Time) {
+	claimed, err := s.locker.ClaimTick(s.ctx, j.name, tick)
+	if err != nil {
+		s.log.Error("Ошибка распределения запуска задачи", zap.String("job", j.name), zap.Error(err))
+		return
+	}
+	if !claimed {
+		return
+	}
+
+	lock, err := s.locker.Acquire(s.ctx, j.name)
+	if err != nil {
+		s.log.Error("Ошибка получения блокировки задачи", zap.String("job", j.name), zap.Error(err))
+		return
+	}
+	if lock == nil {
+		s.log.Warn("Запуск пропущен: предыдущий запуск задачи еще выполняется", zap.String("job", j.name))
+		return
+	}
+	defer lock.Release()
+
+	run := &Run{
+		JobName:     j.name,
+		Instance:    s.instance,
+		ScheduledAt: tick,
+		Status:      RunRunning,
+	}
+	if err := s.repo.StartRun(s.ctx, run); err != nil {
+		// История не должна мешать выполнению задачи
+		s.log.Error("Ошибка сохранения запуска задачи", zap.String("job", j.name), zap.Error(err))
+	}
+
+	ctx, cancel := context.WithTimeout(s.ctx, s.config.GetJobTimeout())
+	start := time.Now()
+	result, runErr := s.runSafely(ctx, j)
+	cancel()
+
+	finished := time.Now()
+	run.FinishedAt = &finished
+	run.DurationMs = finished.Sub(start).Milliseconds()
+	run.Result = result
+	run.Status = RunSucceeded
+	if runErr != nil {
+		run.Status = RunFailed
+		run.Error = runErr.Error()
+		s.log.Error("Ошибка выполнения задачи",
+			zap.String("job", j.name),
+			zap.Duration("duration", finished.Sub(start)),
+			zap.Error(runErr))
+	} else {
+		s.log.Info("Задача выполнена",
+			zap.String("job", j.name),
+			zap.Duration("duration", finished.Sub(start)),
+			zap.String("result", result))
+	}
+
+	if run.ID != 0 {
+		// Результат сохраняем и при остановке планировщика
+		saveCtx, saveCancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer saveCancel()
+		if err := s.repo.FinishRun(saveCtx, run); err != nil {
+			s.log.Error("Ошибка сохранения результата задачи", zap.String("job", j.name), zap.Error(err))
+		}
+	}
+}
+
+// runSafely выполняет задачу, превращая панику в ошибку, чтобы она не остановила планировщик
+func (s *Scheduler) runSafely(ctx context.Context, j *job) (result string, err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("паника при выполнении задачи: %v", r)
+		}
+	}()
+	return j.run(ctx)
+}
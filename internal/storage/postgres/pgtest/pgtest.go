@@ -0,0 +1,110 @@
+// Тестовая база данных PostgreSQL для интеграционных тестов
+
+package pgtest
+
+import (
+	"crypto/rand"
+	"database/sql"
+	"encoding/hex"
+	"net/url"
+	"os"
+	"path/filepath"
+	"runtime"
+	"sort"
+	"strings"
+	"testing"
+
+	_ "github.com/lib/pq"
+)
+
+// EnvDatabaseURL - переменная окружения со строкой подключения к тестовой базе.
+// Если она не задана, интеграционные тесты пропускаются
+const EnvDatabaseURL = "TEST_DATABASE_URL"
+
+// Open создает для теста отдельную схему, применяет к ней миграции и возвращает
+// подключение, работающее в этой схеме. Схема удаляется по завершении теста
+func Open(t testing.TB) *sql.DB {
+	t.Helper()
+
+	dsn := os.Getenv(EnvDatabaseURL)
+	if dsn == "" {
+		t.Skipf("%s не задана, интеграционный тест пропущен", EnvDatabaseURL)
+	}
+
+	admin, err := sql.Open("postgres", dsn)
+	if err != nil {
+		t.Fatalf("ошибка подключения к тестовой базе: %v", err)
+	}
+	t.Cleanup(func() { admin.Close() })
+
+	suffix := make([]byte, 6)
+	if _, err := rand.Read(suffix); err != nil {
+		t.Fatal(err)
+	}
+	schema := "test_" + hex.EncodeToString(suffix)
+	if _, err := admin.Exec("CREATE SCHEMA " + schema); err != nil {
+		t.Fatalf("ошибка создания схемы: %v", err)
+	}
+	t.Cleanup(func() {
+		if _, err := admin.Exec("DROP SCHEMA " + schema + " CASCADE"); err != nil {
+			t.Logf("ошибка удаления схемы %s: %v", schema, err)
+		}
+	})
+
+	db, err := sql.Open("postgres", withSearchPath(dsn, schema))
+	if err != nil {
+		t.Fatalf("ошибка подключения к тестовой схеме: %v", err)
+	}
+	t.Cleanup(func() { db.Close() })
+
+	migrate(t, db)
+	return db
+}
+
+// CreateUser добавляет пользователя, у которого внутренний ID совпадает с Telegram ID
+func CreateUser(t testing.TB, db *sql.DB, telegramID int64) {
+	t.Helper()
+
+	_, err := db.Exec(`INSERT INTO users (id, telegram_id, first_name) VALUES ($1, $1, 'test')`, telegramID)
+	if err != nil {
+		t.Fatalf("ошибка создания пользователя: %v", err)
+	}
+}
+
+// withSearchPath добавляет к строке подключения схему по умолчанию
+func withSearchPath(dsn, schema string) string {
+	if u, err := url.Parse(dsn); err == nil && (u.Scheme == "postgres" || u.Scheme == "postgresql") {
+		q := u.Query()
+		q.Set("search_path", schema)
+		u.RawQuery = q.Encode()
+		return u.String()
+	}
+	return dsn + " search_path=" + schema
+}
+
+// migrate применяет все up-миграции по порядку
+func migrate(t testing.TB, db *sql.DB) {
+	t.Helper()
+
+	_, file, _, _ := runtime.Caller(0)
+	dir := filepath.Join(filepath.Dir(file), "..", "..", "..", "..", "migrations")
+
+	files, err := filepath.Glob(filepath.Join(dir, "*.up.sql"))
+	if err != nil || len(files) == 0 {
+		t.Fatalf("миграции не найдены в %s: %v", dir, err)
+	}
+	sort.Strings(files)
+
+	for _, name := range files {
+		data, err := os.ReadFile(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if strings.TrimSpace(string(data)) == "" {
+			continue
+		}
+		if _, err := db.Exec(string(data)); err != nil {
+			t.Fatalf("ошибка применения миграции %s: %v", filepath.Base(name), err)
+		}
+	}
+}
@@ -0,0 +1,105 @@
+// Модель серий ежедневных начислений
+
+package streak
+
+import (
+	"time"
+)
+
+// Streak представляет серию ежедневных начислений пользователя
+type Streak struct {
+	UserID           int64      `db:"user_id"`
+	CurrentStreak    int        `db:"current_streak"`
+	LongestStreak    int        `db:"longest_streak"`
+	Timezone         string     `db:"timezone"`
+	LastClaimDate    *time.Time `db:"last_claim_date"` // Дата по времени пользователя
+	Freezes          int        `db:"freezes"`
+	RemindersEnabled bool       `db:"reminders_enabled"`
+	LastRemindedDate *time.Time `db:"last_reminded_date"`
+	CreatedAt        time.Time  `db:"created_at"`
+	UpdatedAt        time.Time  `db:"updated_at"`
+}
+
+// Location возвращает часовой пояс пользователя
+func (s *Streak) Location() *time.Location {
+	loc, err := time.LoadLocation(s.Timezone)
+	if err != nil {
+		return time.UTC
+	}
+	return loc
+}
+
+// Today возвращает текущую дату по времени пользователя
+func (s *Streak) Today(now time.Time) time.Time {
+	return dateOf(now.In(s.Location()))
+}
+
+// NextClaimAt возвращает момент, когда станет доступно следующее начисление
+func (s *Streak) NextClaimAt(now time.Time) time.Time {
+	local := now.In(s.Location())
+	return time.Date(local.Year(), local.Month(), local.Day()+1, 0, 0, 0, 0, local.Location())
+}
+
+// ClaimedToday проверяет, получено ли начисление сегодня по времени пользователя
+func (s *Streak) ClaimedToday(now time.Time) bool {
+	return s.LastClaimDate != nil && !dateOf(*s.LastClaimDate).Before(s.Today(now))
+}
+
+// MissedDays возвращает количество пропущенных дней между последним начислением и сегодняшним днем
+func (s *Streak) MissedDays(now time.Time) int {
+	if s.LastClaimDate == nil {
+		return 0
+	}
+	days := daysBetween(dateOf(*s.LastClaimDate), s.Today(now)) - 1
+	if days < 0 {
+		return 0
+	}
+	return days
+}
+
+// IsActive проверяет, продолжится ли серия при начислении сегодня без заморозок
+func (s *Streak) IsActive(now time.Time) bool {
+	return s.CurrentStreak > 0 && s.MissedDays(now) == 0
+}
+
+// Advance рассчитывает серию после начисления сегодня. Пропущенные дни
+// покрываются заморозками, если их хватает, иначе серия начинается заново
+func (s *Streak) Advance(now time.Time) (current int, freezesUsed int, broken bool) {
+	if s.LastClaimDate == nil || s.CurrentStreak == 0 {
+		return 1, 0, false
+	}
+
+	missed := s.MissedDays(now)
+	switch {
+	case missed == 0:
+		return s.CurrentStreak + 1, 0, false
+	case missed <= s.Freezes:
+		return s.CurrentStreak + 1, missed, false
+	default:
+		return 1, 0, true
+	}
+}
+
+// ClaimResult содержит результат ежедневного начисления
+type ClaimResult struct {
+	TransactionID  int64
+	Amount         int
+	BalanceAfter   int
+	Streak         int  // Серия с учетом начисления
+	LongestStreak  int  // Самая длинная серия
+	BonusPercent   int  // Бонус за серию
+	FreezesUsed    int  // Заморозки, потраченные на пропущенные дни
+	FreezesLeft    int  // Оставшиеся заморозки
+	Broken         bool // Предыдущая серия прервалась
+	PreviousStreak int  // Длина прерванной серии
+}
+
+// dateOf отбрасывает время, сохраняя календарную дату
+func dateOf(t time.Time) time.Time {
+	return time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, time.UTC)
+}
+
+// daysBetween возвращает количество календарных дней между датами
+func daysBetween(from, to time.Time) int {
+	return int(to.Sub(from).Hours() / 24)
+}
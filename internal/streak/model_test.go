@@ -0,0 +1,69 @@
+// Тесты расчета серий ежедневных начислений
+
+package streak
+
+import (
+	"testing"
+	"time"
+)
+
+func TestAdvance(t *testing.T) {
+	now := time.Date(2026, 3, 10, 12, 0, 0, 0, time.UTC)
+	date := func(day int) *time.Time {
+		d := time.Date(2026, 3, day, 0, 0, 0, 0, time.UTC)
+		return &d
+	}
+
+	tests := []struct {
+		name        string
+		streak      Streak
+		wantCurrent int
+		wantFreezes int
+		wantBroken  bool
+	}{
+		{name: "первое начисление", streak: Streak{Timezone: "UTC"}, wantCurrent: 1},
+		{name: "вчерашнее начисление", streak: Streak{Timezone: "UTC", CurrentStreak: 3, LastClaimDate: date(9)}, wantCurrent: 4},
+		{name: "пропуск покрыт заморозкой",
+			streak:      Streak{Timezone: "UTC", CurrentStreak: 3, LastClaimDate: date(8), Freezes: 1},
+			wantCurrent: 4, wantFreezes: 1},
+		{name: "заморозок хватает на несколько дней",
+			streak:      Streak{Timezone: "UTC", CurrentStreak: 3, LastClaimDate: date(7), Freezes: 3},
+			wantCurrent: 4, wantFreezes: 2},
+		{name: "заморозок не хватает",
+			streak:      Streak{Timezone: "UTC", CurrentStreak: 3, LastClaimDate: date(7), Freezes: 1},
+			wantCurrent: 1, wantBroken: true},
+		{name: "без заморозок серия сбрасывается",
+			streak:      Streak{Timezone: "UTC", CurrentStreak: 3, LastClaimDate: date(8)},
+			wantCurrent: 1, wantBroken: true},
+		{name: "в часовом поясе пользователя уже следующий день",
+			streak:      Streak{Timezone: "Asia/Vladivostok", CurrentStreak: 3, LastClaimDate: date(10)},
+			wantCurrent: 4},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			at := now
+			if tt.streak.Timezone != "UTC" {
+				// 20:00 по UTC - уже 06:00 следующего дня во Владивостоке
+				at = time.Date(2026, 3, 10, 20, 0, 0, 0, time.UTC)
+			}
+			current, freezes, broken := tt.streak.Advance(at)
+			if current != tt.wantCurrent || freezes != tt.wantFreezes || broken != tt.wantBroken {
+				t.Errorf("серия %d, заморозок %d, прервана %v; ожидалось %d, %d, %v",
+					current, freezes, broken, tt.wantCurrent, tt.wantFreezes, tt.wantBroken)
+			}
+		})
+	}
+}
+
+func TestClaimedTodayUsesTimezone(t *testing.T) {
+	last := time.Date(2026, 3, 10, 0, 0, 0, 0, time.UTC)
+	now := time.Date(2026, 3, 10, 20, 0, 0, 0, time.UTC)
+
+	if st := (&Streak{Timezone: "UTC", LastClaimDate: &last}); !st.ClaimedToday(now) {
+		t.Error("начисление по UTC не считается сегодняшним")
+	}
+	if st := (&Streak{Timezone: "Asia/Vladivostok", LastClaimDate: &last}); st.ClaimedToday(now) {
+		t.Error("во Владивостоке уже следующий день, но начисление считается сегодняшним")
+	}
+}
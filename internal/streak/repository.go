@@ -0,0 +1,252 @@
+// Репозиторий серий ежедневных начислений
+
+package streak
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"time"
+)
+
+// Repository представляет репозиторий для работы с сериями ежедневных начислений
+type Repository struct {
+	db *sql.DB
+}
+
+// NewRepository создает новый репозиторий серий
+func NewRepository(db *sql.DB) *Repository {
+	return &Repository{
+		db: db,
+	}
+}
+
+const streakColumns = `user_id, current_streak, longest_streak, timezone, last_claim_date, freezes,
+	reminders_enabled, last_reminded_date, created_at, updated_at`
+
+// rowScanner объединяет sql.Row и sql.Rows
+type rowScanner interface {
+	Scan(dest ...interface{}) error
+}
+
+// scanStreak сканирует строку серии
+func scanStreak(row rowScanner) (*Streak, error) {
+	s := &Streak{}
+	err := row.Scan(
+		&s.UserID,
+		&s.CurrentStreak,
+		&s.LongestStreak,
+		&s.Timezone,
+		&s.LastClaimDate,
+		&s.Freezes,
+		&s.RemindersEnabled,
+		&s.LastRemindedDate,
+		&s.CreatedAt,
+		&s.UpdatedAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// Get возвращает серию пользователя
+func (r *Repository) Get(ctx context.Context, userID int64) (*Streak, error) {
+	query := `SELECT ` + streakColumns + ` FROM daily_streaks WHERE user_id = $1`
+
+	s, err := scanStreak(r.db.QueryRowContext(ctx, query, userID))
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("ошибка получения серии: %w", err)
+	}
+	return s, nil
+}
+
+// GetOrCreate возвращает серию пользователя, создавая ее при необходимости
+func (r *Repository) GetOrCreate(ctx context.Context, userID int64, timezone string) (*Streak, error) {
+	query := `
+		INSERT INTO daily_streaks (user_id, timezone)
+		VALUES ($1, $2)
+		ON CONFLICT (user_id) DO NOTHING
+	`
+
+	if _, err := r.db.ExecContext(ctx, query, userID, timezone); err != nil {
+		return nil, fmt.Errorf("ошибка создания серии: %w", err)
+	}
+	return r.Get(ctx, userID)
+}
+
+// Claim сохраняет начисление за день. Обновление выполняется, только если серия
+// не изменилась с момента чтения, что исключает двойное начисление за день
+func (r *Repository) Claim(ctx context.Context, prev *Streak, today time.Time, current, freezesUsed int) (bool, error) {
+	query := `
+		UPDATE daily_streaks
+		SET current_streak = $2,
+			longest_streak = GREATEST(longest_streak, $2),
+			last_claim_date = $3::date,
+			freezes = freezes - $4,
+			updated_at = NOW()
+		WHERE user_id = $1
+			AND last_claim_date IS NOT DISTINCT FROM $5::date
+			AND current_streak = $6
+			AND freezes >= $4
+	`
+
+	result, err := r.db.ExecContext(ctx, query, prev.UserID, current, formatDate(today), freezesUsed, formatDatePtr(prev.LastClaimDate), prev.CurrentStreak)
+	if err != nil {
+		return false, fmt.Errorf("ошибка сохранения начисления серии: %w", err)
+	}
+
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return false, fmt.Errorf("ошибка получения количества обновленных строк: %w", err)
+	}
+	return affected > 0, nil
+}
+
+// ReleaseClaim возвращает серию в состояние до начисления, если начисление нейронов не удалось
+func (r *Repository) ReleaseClaim(ctx context.Context, prev *Streak, today time.Time, freezesUsed int) error {
+	query := `
+		UPDATE daily_streaks
+		SET current_streak = $2,
+			longest_streak = $3,
+			last_claim_date = $4::date,
+			freezes = freezes + $5,
+			updated_at = NOW()
+		WHERE user_id = $1 AND last_claim_date = $6::date
+	`
+
+	_, err := r.db.ExecContext(ctx, query, prev.UserID, prev.CurrentStreak, prev.LongestStreak, formatDatePtr(prev.LastClaimDate), freezesUsed, formatDate(today))
+	if err != nil {
+		return fmt.Errorf("ошибка отмены начисления серии: %w", err)
+	}
+	return nil
+}
+
+// AddFreeze добавляет заморозку, если не превышен лимит, и возвращает порядковый номер
+// покупки заморозки пользователем. Если лимит достигнут, возвращает 0
+func (r *Repository) AddFreeze(ctx context.Context, userID int64, maxFreezes int) (int, error) {
+	query := `
+		UPDATE daily_streaks
+		SET freezes = freezes + 1, freezes_purchased = freezes_purchased + 1, updated_at = NOW()
+		WHERE user_id = $1 AND freezes < $2
+		RETURNING freezes_purchased
+	`
+
+	var purchase int
+	err := r.db.QueryRowContext(ctx, query, userID, maxFreezes).Scan(&purchase)
+	if err == sql.ErrNoRows {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, fmt.Errorf("ошибка добавления заморозки: %w", err)
+	}
+	return purchase, nil
+}
+
+// RemoveFreeze снимает заморозку, если ее оплата не удалась. Номер покупки не освобождается,
+// чтобы следующая покупка не совпала по ключу идемпотентности с возможно проведенной оплатой
+func (r *Repository) RemoveFreeze(ctx context.Context, userID int64) error {
+	query := `
+		UPDATE daily_streaks
+		SET freezes = freezes - 1, updated_at = NOW()
+		WHERE user_id = $1 AND freezes > 0
+	`
+
+	if _, err := r.db.ExecContext(ctx, query, userID); err != nil {
+		return fmt.Errorf("ошибка снятия заморозки: %w", err)
+	}
+	return nil
+}
+
+// SetTimezone обновляет часовой пояс пользователя
+func (r *Repository) SetTimezone(ctx context.Context, userID int64, timezone string) error {
+	query := `UPDATE daily_streaks SET timezone = $2, updated_at = NOW() WHERE user_id = $1`
+
+	if _, err := r.db.ExecContext(ctx, query, userID, timezone); err != nil {
+		return fmt.Errorf("ошибка обновления часового пояса: %w", err)
+	}
+	return nil
+}
+
+// SetReminders включает или выключает напоминания
+func (r *Repository) SetReminders(ctx context.Context, userID int64, enabled bool) error {
+	query := `UPDATE daily_streaks SET reminders_enabled = $2, updated_at = NOW() WHERE user_id = $1`
+
+	if _, err := r.db.ExecContext(ctx, query, userID, enabled); err != nil {
+		return fmt.Errorf("ошибка обновления напоминаний: %w", err)
+	}
+	return nil
+}
+
+// GetReminderCandidates возвращает пользователей с включенными напоминаниями, которые
+// еще не получили начисление и не получали напоминание сегодня по своему времени
+func (r *Repository) GetReminderCandidates(ctx context.Context, reminderHour, limit int) ([]*Streak, error) {
+	query := `
+		SELECT ` + streakColumns + `
+		FROM daily_streaks
+		WHERE reminders_enabled
+			AND EXTRACT(HOUR FROM NOW() AT TIME ZONE timezone) >= $1
+			AND (last_claim_date IS NULL OR last_claim_date < (NOW() AT TIME ZONE timezone)::date)
+			AND (last_reminded_date IS NULL OR last_reminded_date < (NOW() AT TIME ZONE timezone)::date)
+		ORDER BY user_id
+		LIMIT $2
+	`
+
+	rows, err := r.db.QueryContext(ctx, query, reminderHour, limit)
+	if err != nil {
+		return nil, fmt.Errorf("ошибка получения пользователей для напоминаний: %w", err)
+	}
+	defer rows.Close()
+
+	var streaks []*Streak
+	for rows.Next() {
+		s, err := scanStreak(rows)
+		if err != nil {
+			return nil, fmt.Errorf("ошибка сканирования серии: %w", err)
+		}
+		streaks = append(streaks, s)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("ошибка при итерации серий: %w", err)
+	}
+
+	return streaks, nil
+}
+
+// MarkReminded отмечает отправку напоминания за день. Возвращает false,
+// если напоминание за этот день уже отмечено другим обработчиком
+func (r *Repository) MarkReminded(ctx context.Context, userID int64, today time.Time) (bool, error) {
+	query := `
+		UPDATE daily_streaks
+		SET last_reminded_date = $2::date, updated_at = NOW()
+		WHERE user_id = $1 AND (last_reminded_date IS NULL OR last_reminded_date < $2::date)
+	`
+
+	result, err := r.db.ExecContext(ctx, query, userID, formatDate(today))
+	if err != nil {
+		return false, fmt.Errorf("ошибка отметки напоминания: %w", err)
+	}
+
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return false, fmt.Errorf("ошибка получения количества обновленных строк: %w", err)
+	}
+	return affected > 0, nil
+}
+
+// formatDate форматирует календарную дату для параметра запроса
+func formatDate(t time.Time) string {
+	return t.Format("2006-01-02")
+}
+
+// formatDatePtr форматирует необязательную дату для параметра запроса
+func formatDatePtr(t *time.Time) interface{} {
+	if t == nil {
+		return nil
+	}
+	return formatDate(*t)
+}
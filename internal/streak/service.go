@@ -0,0 +1,258 @@
+// Сервис серий ежедневных начислений
+
+package streak
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"go.uber.org/zap"
+
+	"neurobot-prod/internal/config"
+	"neurobot-prod/internal/currency"
+)
+
+var (
+	// ErrAlreadyClaimed возвращается, если начисление за сегодня уже получено
+	ErrAlreadyClaimed = errors.New("ежедневное вознаграждение уже получено")
+	// ErrInvalidTimezone возвращается при неизвестном часовом поясе
+	ErrInvalidTimezone = errors.New("неизвестный часовой пояс")
+	// ErrFreezeLimit возвращается, если достигнут лимит заморозок
+	ErrFreezeLimit = errors.New("достигнут лимит заморозок")
+	// ErrInsufficientNeurons возвращается, если нейронов недостаточно для покупки заморозки
+	ErrInsufficientNeurons = errors.New("недостаточно нейронов")
+)
+
+// Notifier отправляет пользователю напоминание
+type Notifier func(userID int64, text string)
+
+// Service управляет сериями ежедневных начислений
+type Service struct {
+	repo            *Repository
+	currencyService *currency.Service
+	config          config.StreakConfig
+	notify          Notifier
+	log             *zap.Logger
+}
+
+// NewService создает новый сервис серий
+func NewService(repo *Repository, currencyService *currency.Service, cfg config.StreakConfig, log *zap.Logger) *Service {
+	return &Service{
+		repo:            repo,
+		currencyService: currencyService,
+		config:          cfg,
+		log:             log.Named("streak_service"),
+	}
+}
+
+// SetNotifier устанавливает функцию отправки напоминаний
+func (s *Service) SetNotifier(notify Notifier) {
+	s.notify = notify
+}
+
+// GetConfig возвращает настройки серий
+func (s *Service) GetConfig() config.StreakConfig {
+	return s.config
+}
+
+// Get возвращает серию пользователя
+func (s *Service) Get(ctx context.Context, userID int64) (*Streak, error) {
+	st, err := s.repo.GetOrCreate(ctx, userID, s.config.DefaultTimezone)
+	if err != nil {
+		s.log.Error("Ошибка получения серии",
+			zap.Int64("user_id", userID),
+			zap.Error(err))
+		return nil, err
+	}
+	return st, nil
+}
+
+// Claim начисляет ежедневные нейроны с бонусом за серию. Начисление доступно
+// один раз за календарный день по времени пользователя
+func (s *Service) Claim(ctx context.Context, userID int64, loyaltyBonusPercent int) (*ClaimResult, error) {
+	st, err := s.Get(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	if st.ClaimedToday(now) {
+		return nil, ErrAlreadyClaimed
+	}
+
+	today := st.Today(now)
+	current, freezesUsed, broken := st.Advance(now)
+
+	claimed, err := s.repo.Claim(ctx, st, today, current, freezesUsed)
+	if err != nil {
+		return nil, err
+	}
+	if !claimed {
+		// Параллельный запрос уже получил начисление
+		return nil, ErrAlreadyClaimed
+	}
+
+	bonusPercent := s.config.GetBonusPercent(current)
+	tx, err := s.currencyService.AddDailyNeurons(ctx, userID, currency.DailyBonus{
+		LoyaltyPercent: loyaltyBonusPercent,
+		StreakPercent:  bonusPercent,
+		Streak:         current,
+	}, currency.DailyKey(userID, today.Format("2006-01-02")))
+	if err != nil {
+		if releaseErr := s.repo.ReleaseClaim(ctx, st, today, freezesUsed); releaseErr != nil {
+			s.log.Error("Ошибка отмены начисления серии",
+				zap.Int64("user_id", userID),
+				zap.Error(releaseErr))
+		}
+		return nil, err
+	}
+
+	longest := st.LongestStreak
+	if current > longest {
+		longest = current
+	}
+
+	result := &ClaimResult{
+		TransactionID: tx.ID,
+		Amount:        tx.Amount,
+		BalanceAfter:  tx.BalanceAfter,
+		Streak:        current,
+		LongestStreak: longest,
+		BonusPercent:  bonusPercent,
+		FreezesUsed:   freezesUsed,
+		FreezesLeft:   st.Freezes - freezesUsed,
+		Broken:        broken,
+	}
+	if broken {
+		result.PreviousStreak = st.CurrentStreak
+	}
+
+	s.log.Info("Получено ежедневное начисление",
+		zap.Int64("user_id", userID),
+		zap.Int("streak", current),
+		zap.Int("bonus_percent", bonusPercent),
+		zap.Int("freezes_used", freezesUsed),
+		zap.Bool("broken", broken))
+
+	return result, nil
+}
+
+// BuyFreeze покупает заморозку серии за нейроны
+func (s *Service) BuyFreeze(ctx context.Context, userID int64) (*Streak, error) {
+	if _, err := s.Get(ctx, userID); err != nil {
+		return nil, err
+	}
+
+	enough, err := s.currencyService.HasEnoughNeurons(ctx, userID, s.config.FreezePrice)
+	if err != nil {
+		return nil, err
+	}
+	if !enough {
+		return nil, ErrInsufficientNeurons
+	}
+
+	purchase, err := s.repo.AddFreeze(ctx, userID, s.config.MaxFreezes)
+	if err != nil {
+		return nil, err
+	}
+	if purchase == 0 {
+		return nil, ErrFreezeLimit
+	}
+
+	_, err = s.currencyService.SpendNeurons(ctx, userID, s.config.FreezePrice, currency.TypeStreakFreeze,
+		"Заморозка серии ежедневных начислений", currency.Metadata{"price": s.config.FreezePrice, "purchase": purchase},
+		"", currency.StreakFreezeKey(userID, purchase))
+	if err != nil {
+		if releaseErr := s.repo.RemoveFreeze(ctx, userID); releaseErr != nil {
+			s.log.Error("Ошибка снятия неоплаченной заморозки",
+				zap.Int64("user_id", userID),
+				zap.Error(releaseErr))
+		}
+		return nil, fmt.Errorf("ошибка оплаты заморозки: %w", err)
+	}
+
+	s.log.Info("Куплена заморозка серии",
+		zap.Int64("user_id", userID),
+		zap.Int("price", s.config.FreezePrice))
+
+	return s.repo.Get(ctx, userID)
+}
+
+// SetTimezone устанавливает часовой пояс пользователя
+func (s *Service) SetTimezone(ctx context.Context, userID int64, timezone string) (*Streak, error) {
+	loc, err := time.LoadLocation(timezone)
+	if err != nil || timezone == "" || timezone == "Local" {
+		return nil, ErrInvalidTimezone
+	}
+
+	if _, err := s.Get(ctx, userID); err != nil {
+		return nil, err
+	}
+	if err := s.repo.SetTimezone(ctx, userID, loc.String()); err != nil {
+		return nil, err
+	}
+	return s.repo.Get(ctx, userID)
+}
+
+// SetReminders включает или выключает напоминания о ежедневном начислении
+func (s *Service) SetReminders(ctx context.Context, userID int64, enabled bool) error {
+	if _, err := s.Get(ctx, userID); err != nil {
+		return err
+	}
+	return s.repo.SetReminders(ctx, userID, enabled)
+}
+
+// SendReminders напоминает о неполученном ежедневном начислении пользователям,
+// включившим напоминания. Предназначен для периодического запуска (например, раз в час)
+func (s *Service) SendReminders(ctx context.Context) (int, error) {
+	if s.notify == nil {
+		return 0, nil
+	}
+
+	streaks, err := s.repo.GetReminderCandidates(ctx, s.config.ReminderHour, s.config.ReminderBatchSize)
+	if err != nil {
+		s.log.Error("Ошибка получения пользователей для напоминаний", zap.Error(err))
+		return 0, err
+	}
+
+	now := time.Now()
+	sent := 0
+	for _, st := range streaks {
+		// Отмечаем напоминание до отправки, чтобы параллельный запуск не отправил его повторно
+		marked, err := s.repo.MarkReminded(ctx, st.UserID, st.Today(now))
+		if err != nil {
+			s.log.Error("Ошибка отметки напоминания",
+				zap.Int64("user_id", st.UserID),
+				zap.Error(err))
+			continue
+		}
+		if !marked {
+			continue
+		}
+
+		s.notify(st.UserID, s.reminderText(st, now))
+		sent++
+	}
+
+	s.log.Info("Отправлены напоминания о ежедневном начислении",
+		zap.Int("candidates", len(streaks)),
+		zap.Int("sent", sent))
+
+	return sent, nil
+}
+
+// reminderText формирует текст напоминания
+func (s *Service) reminderText(st *Streak, now time.Time) string {
+	switch {
+	case st.IsActive(now):
+		return fmt.Sprintf("🔥 Ваша серия — %d дн. Получите ежедневные нейроны до полуночи, чтобы ее не потерять: /daily",
+			st.CurrentStreak)
+	case st.CurrentStreak > 0 && st.MissedDays(now) <= st.Freezes:
+		return fmt.Sprintf("❄️ Серия %d дн. сохранится за счет заморозок. Получите ежедневные нейроны: /daily",
+			st.CurrentStreak)
+	default:
+		return "🎁 Ежедневные нейроны ждут вас! Получите их командой /daily"
+	}
+}
@@ -0,0 +1,134 @@
+// Тесты ежедневных начислений и заморозок серии
+
+package streak
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"testing"
+	"time"
+
+	"go.uber.org/zap"
+
+	"neurobot-prod/internal/config"
+	"neurobot-prod/internal/currency"
+	"neurobot-prod/internal/storage/postgres/pgtest"
+	"neurobot-prod/internal/subscription"
+)
+
+// newTestService создает сервис серий с базой из pgtest и заданными пользователями
+func newTestService(t *testing.T, userIDs ...int64) (*Service, *currency.Service, *sql.DB) {
+	db := pgtest.Open(t)
+	for _, userID := range userIDs {
+		pgtest.CreateUser(t, db, userID)
+	}
+
+	log := zap.NewNop()
+	subService := subscription.NewService(subscription.NewRepository(db), log)
+	currencyService := currency.NewService(currency.NewRepository(db), subService, log)
+	service := NewService(NewRepository(db), currencyService, config.StreakConfig{
+		DefaultTimezone: "UTC",
+		FreezePrice:     10,
+		MaxFreezes:      2,
+	}, log)
+	return service, currencyService, db
+}
+
+// setStreak задает серию пользователя с последним начислением указанное число дней назад
+func setStreak(t *testing.T, service *Service, db *sql.DB, userID int64, streak, daysAgo, freezes int) {
+	t.Helper()
+	ctx := context.Background()
+
+	if _, err := service.Get(ctx, userID); err != nil {
+		t.Fatal(err)
+	}
+	lastClaim := time.Now().UTC().AddDate(0, 0, -daysAgo).Format("2006-01-02")
+	if _, err := db.ExecContext(ctx, `
+		UPDATE daily_streaks
+		SET current_streak = $2, longest_streak = $2, last_claim_date = $3::date, freezes = $4
+		WHERE user_id = $1
+	`, userID, streak, lastClaim, freezes); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestClaimConsumesFreezes(t *testing.T) {
+	service, _, db := newTestService(t, 3951)
+	ctx := context.Background()
+	setStreak(t, service, db, 3951, 5, 2, 1)
+
+	// Один пропущенный день покрывается заморозкой
+	result, err := service.Claim(ctx, 3951, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.Streak != 6 || result.FreezesUsed != 1 || result.FreezesLeft != 0 || result.Broken {
+		t.Errorf("результат %+v, ожидалась серия 6 с одной потраченной заморозкой", result)
+	}
+
+	if _, err := service.Claim(ctx, 3951, 0); !errors.Is(err, ErrAlreadyClaimed) {
+		t.Errorf("повторное начисление: %v, ожидалась %v", err, ErrAlreadyClaimed)
+	}
+
+	st, err := service.Get(ctx, 3951)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if st.CurrentStreak != 6 || st.LongestStreak != 6 || st.Freezes != 0 {
+		t.Errorf("серия %d, лучшая %d, заморозок %d; ожидалось 6, 6, 0", st.CurrentStreak, st.LongestStreak, st.Freezes)
+	}
+}
+
+func TestClaimResetsBrokenStreak(t *testing.T) {
+	service, _, db := newTestService(t, 3952)
+	ctx := context.Background()
+	setStreak(t, service, db, 3952, 5, 3, 1)
+
+	// На два пропущенных дня заморозок не хватает: серия начинается заново, заморозка сохраняется
+	result, err := service.Claim(ctx, 3952, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.Streak != 1 || !result.Broken || result.PreviousStreak != 5 || result.FreezesUsed != 0 {
+		t.Errorf("результат %+v, ожидался сброс серии 5", result)
+	}
+
+	st, err := service.Get(ctx, 3952)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if st.CurrentStreak != 1 || st.LongestStreak != 5 || st.Freezes != 1 {
+		t.Errorf("серия %d, лучшая %d, заморозок %d; ожидалось 1, 5, 1", st.CurrentStreak, st.LongestStreak, st.Freezes)
+	}
+}
+
+func TestBuyFreezeLimit(t *testing.T) {
+	service, currencyService, _ := newTestService(t, 3953)
+	ctx := context.Background()
+
+	if _, err := currencyService.AddNeurons(ctx, 3953, 25, currency.TypeBonus, "Бонус", nil, "", "", 0); err != nil {
+		t.Fatal(err)
+	}
+
+	for i := 0; i < 2; i++ {
+		if _, err := service.BuyFreeze(ctx, 3953); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if _, err := service.BuyFreeze(ctx, 3953); !errors.Is(err, ErrFreezeLimit) {
+		t.Errorf("заморозка сверх лимита: %v, ожидалась %v", err, ErrFreezeLimit)
+	}
+
+	st, err := service.Get(ctx, 3953)
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, err := currencyService.GetBalance(ctx, 3953)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if st.Freezes != 2 || b.Balance != 5 {
+		t.Errorf("заморозок %d, баланс %d; ожидалось 2 и 5", st.Freezes, b.Balance)
+	}
+}
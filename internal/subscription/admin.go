@@ -0,0 +1,103 @@
+// Управление планами и подписками администратором
+
+package subscription
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// PaymentMethodAdmin - способ оплаты подписки, выданной администратором
+const PaymentMethodAdmin = "admin"
+
+var (
+	// ErrPlanNotFound возвращается, если план с указанным кодом не существует
+	ErrPlanNotFound = errors.New("план подписки не найден")
+	// ErrFreePlanRequired возвращается при попытке отключить бесплатный план, без которого не работает выдача плана по умолчанию
+	ErrFreePlanRequired = errors.New("бесплатный план нельзя отключить")
+)
+
+// ListPlans возвращает все планы подписок, включая отключенные
+func (s *Service) ListPlans(ctx context.Context) ([]*Plan, error) {
+	plans, err := s.repo.ListPlans(ctx)
+	if err != nil {
+		s.log.Error("Ошибка получения списка планов", zap.Error(err))
+		return nil, fmt.Errorf("ошибка получения списка планов: %w", err)
+	}
+	return plans, nil
+}
+
+// SetPlanActive включает или отключает план подписки. Отключенный план не предлагается
+// к покупке, уже оформленные на него подписки продолжают действовать
+func (s *Service) SetPlanActive(ctx context.Context, code string, active bool) error {
+	if code == "free" && !active {
+		return ErrFreePlanRequired
+	}
+
+	found, err := s.repo.SetPlanActive(ctx, code, active)
+	if err != nil {
+		s.log.Error("Ошибка изменения доступности плана",
+			zap.String("code", code),
+			zap.Error(err))
+		return fmt.Errorf("ошибка изменения доступности плана: %w", err)
+	}
+	if !found {
+		return ErrPlanNotFound
+	}
+
+	s.log.Info("Изменена доступность плана",
+		zap.String("code", code),
+		zap.Bool("active", active))
+	return nil
+}
+
+// Grant выдает пользователю подписку на указанный план без оплаты. Текущая подписка
+// заменяется, автопродление не включается, так как способа оплаты нет
+func (s *Service) Grant(ctx context.Context, userID int64, planCode string, days int, reference string) (*Subscription, error) {
+	if days <= 0 {
+		return nil, errors.New("некорректная длительность подписки")
+	}
+
+	plan, err := s.repo.GetPlanByCode(ctx, planCode)
+	if err != nil {
+		return nil, fmt.Errorf("ошибка получения плана подписки: %w", err)
+	}
+	if plan == nil || plan.Code == "free" {
+		return nil, ErrPlanNotFound
+	}
+
+	startDate := time.Now()
+	sub := &Subscription{
+		UserID:        userID,
+		PlanID:        plan.ID,
+		Status:        StatusActive,
+		StartDate:     startDate,
+		EndDate:       startDate.AddDate(0, 0, days),
+		AutoRenew:     false,
+		PaymentID:     reference,
+		PaymentMethod: PaymentMethodAdmin,
+		Period:        "monthly",
+		Plan:          plan,
+	}
+
+	if err := s.repo.CreateSubscription(ctx, sub); err != nil {
+		s.log.Error("Ошибка выдачи подписки",
+			zap.Int64("user_id", userID),
+			zap.String("plan_code", planCode),
+			zap.Error(err))
+		return nil, fmt.Errorf("ошибка выдачи подписки: %w", err)
+	}
+
+	s.log.Info("Выдана подписка",
+		zap.Int64("user_id", userID),
+		zap.String("plan", plan.Code),
+		zap.Int("days", days))
+
+	s.emitCreated(ctx, sub, "admin")
+
+	return sub, nil
+}
@@ -16,6 +16,8 @@ const (
 	StatusActive    Status = "active"
 	StatusCancelled Status = "cancelled"
 	StatusExpired   Status = "expired"
+
+	StatusGracePeriod Status = "grace_period" // Продление не оплачено, доступ сохраняется на время повторных попыток
 )
 
 // Features представляет особенности плана подписки
@@ -76,6 +78,14 @@ func (p *Plan) GetYearlyPriceRub() float64 {
 	return float64(p.PriceYearly) / 100.0
 }
 
+// GetPrice возвращает цену плана за период в копейках
+func (p *Plan) GetPrice(period string) int {
+	if period == "yearly" {
+		return p.PriceYearly
+	}
+	return p.PriceMonthly
+}
+
 // GetYearlySavingPercent возвращает процент экономии при годовой подписке
 func (p *Plan) GetYearlySavingPercent() int {
 	if p.PriceMonthly == 0 {
@@ -112,6 +122,14 @@ func (p *Plan) GetNeuronExpiryDays() int {
 	return 3 // По умолчанию 3 дня
 }
 
+// GetGiftDailyLimit возвращает, сколько нейронов можно подарить за сутки (0 - подарки недоступны)
+func (p *Plan) GetGiftDailyLimit() int {
+	if limit, ok := p.Features["gift_daily_limit"].(float64); ok {
+		return int(limit)
+	}
+	return 0
+}
+
 // GetAvailableModels возвращает список доступных моделей
 func (p *Plan) GetAvailableModels() []string {
 	if models, ok := p.Features["available_models"].([]interface{}); ok {
@@ -126,6 +144,22 @@ func (p *Plan) GetAvailableModels() []string {
 	return []string{}
 }
 
+// GetCustomPromptMaxLength возвращает максимальную длину собственного системного промпта
+func (p *Plan) GetCustomPromptMaxLength() int {
+	if length, ok := p.Features["custom_prompt_max_length"].(float64); ok {
+		return int(length)
+	}
+	return 0 // По умолчанию собственные промпты недоступны
+}
+
+// GetMaxCompareModels возвращает максимальное количество моделей в режиме сравнения
+func (p *Plan) GetMaxCompareModels() int {
+	if count, ok := p.Features["compare_max_models"].(float64); ok {
+		return int(count)
+	}
+	return 0 // По умолчанию режим сравнения недоступен
+}
+
 // HasPriorityProcessing возвращает true, если план имеет приоритетную обработку
 func (p *Plan) HasPriorityProcessing() bool {
 	if priority, ok := p.Features["priority_processing"].(bool); ok {
@@ -145,15 +179,28 @@ type Subscription struct {
 	AutoRenew     bool      `db:"auto_renew"`
 	PaymentID     string    `db:"payment_id"`
 	PaymentMethod string    `db:"payment_method"`
+	Period        string    `db:"period"` // monthly или yearly
 	CreatedAt     time.Time `db:"created_at"`
 	UpdatedAt     time.Time `db:"updated_at"`
 
+	// Состояние автопродления
+	RenewalAttempts int        `db:"renewal_attempts"` // Неудачные попытки списания в текущем цикле
+	NextRenewalAt   *time.Time `db:"next_renewal_at"`  // Время следующей попытки списания
+
+	// Переход на другой план с начала следующего периода
+	ScheduledPlanID *int   `db:"scheduled_plan_id"`
+	ScheduledPeriod string `db:"scheduled_period"`
+
 	// Дополнительные поля (не из БД)
-	Plan *Plan `db:"-"`
+	Plan          *Plan `db:"-"`
+	ScheduledPlan *Plan `db:"-"`
 }
 
 // IsActive возвращает true, если подписка активна
 func (s *Subscription) IsActive() bool {
+	if s.Status == StatusGracePeriod {
+		return true
+	}
 	return s.Status == StatusActive && time.Now().Before(s.EndDate)
 }
 
@@ -164,9 +211,28 @@ func (s *Subscription) DaysLeft() int {
 	}
 
 	duration := s.EndDate.Sub(time.Now())
+	if duration < 0 {
+		return 0
+	}
 	return int(duration.Hours() / 24)
 }
 
+// GetRenewalPlan возвращает план, по которому будет продлена подписка
+func (s *Subscription) GetRenewalPlan() *Plan {
+	if s.ScheduledPlan != nil {
+		return s.ScheduledPlan
+	}
+	return s.Plan
+}
+
+// GetRenewalPeriod возвращает период, на который будет продлена подписка
+func (s *Subscription) GetRenewalPeriod() string {
+	if s.ScheduledPlan != nil && s.ScheduledPeriod != "" {
+		return s.ScheduledPeriod
+	}
+	return s.Period
+}
+
 // IsFree возвращает true, если это бесплатная подписка
 func (s *Subscription) IsFree() bool {
 	if s.Plan == nil {
@@ -192,4 +258,6 @@ const (
 	EventCancelled = "cancelled"
 	EventExpired   = "expired"
 	EventChanged   = "changed"
+
+	EventRenewalFailed = "renewal_failed" // Неудачная попытка списания за продление
 )
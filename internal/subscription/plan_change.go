@@ -0,0 +1,257 @@
+// Смена плана подписки с перерасчетом
+
+package subscription
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// ChangeMode определяет, как используется остаток оплаченного периода при повышении плана
+type ChangeMode string
+
+const (
+	ChangeModeDiscount ChangeMode = "discount" // Остаток уменьшает цену нового плана
+	ChangeModeExtend   ChangeMode = "extend"   // Остаток превращается в дополнительные дни нового плана
+)
+
+var (
+	// ErrNoPaidSubscription возвращается, если у пользователя нет платной подписки для смены плана
+	ErrNoPaidSubscription = errors.New("нет активной платной подписки")
+	// ErrSamePlan возвращается при попытке перейти на текущий план
+	ErrSamePlan = errors.New("подписка уже оформлена на этот план")
+)
+
+// PlanChangePreview содержит расчет смены плана
+type PlanChangePreview struct {
+	Current     *Subscription
+	CurrentPlan *Plan
+	NewPlan     *Plan
+	Period      string
+	Mode        ChangeMode
+	IsUpgrade   bool      // Повышение применяется сразу, понижение - с конца текущего периода
+	Credit      int       // Стоимость неиспользованной части текущего периода в копейках
+	Price       int       // Полная цена нового плана за период в копейках
+	AmountDue   int       // Сумма к оплате в копейках
+	ExtraDays   int       // Дополнительные дни за счет остатка
+	StartDate   time.Time // Начало нового плана
+	EndDate     time.Time // Окончание нового плана
+}
+
+// PreviewPlanChange рассчитывает смену плана без ее применения
+func (s *Service) PreviewPlanChange(ctx context.Context, userID int64, planCode, period string, mode ChangeMode) (*PlanChangePreview, error) {
+	if period != "yearly" {
+		period = "monthly"
+	}
+	if mode != ChangeModeExtend {
+		mode = ChangeModeDiscount
+	}
+
+	current, err := s.repo.GetActiveSubscription(ctx, userID)
+	if err != nil {
+		return nil, fmt.Errorf("ошибка получения активной подписки: %w", err)
+	}
+	// Бесплатная подписка возвращается без ID, сменить ее можно только обычной покупкой
+	if current == nil || current.ID == 0 || current.Plan == nil || current.IsFree() {
+		return nil, ErrNoPaidSubscription
+	}
+
+	newPlan, err := s.GetPlanByCode(ctx, planCode)
+	if err != nil {
+		return nil, err
+	}
+	if !newPlan.IsActive {
+		return nil, errors.New("план подписки не активен")
+	}
+
+	return calculatePlanChange(current, newPlan, period, mode, time.Now())
+}
+
+// calculatePlanChange рассчитывает смену плана подписки current на newPlan в момент now
+func calculatePlanChange(current *Subscription, newPlan *Plan, period string, mode ChangeMode, now time.Time) (*PlanChangePreview, error) {
+	if newPlan.ID == current.PlanID && period == current.Period {
+		return nil, ErrSamePlan
+	}
+
+	preview := &PlanChangePreview{
+		Current:     current,
+		CurrentPlan: current.Plan,
+		NewPlan:     newPlan,
+		Period:      period,
+		Mode:        mode,
+		IsUpgrade:   isUpgrade(current.Plan, current.Period, newPlan, period),
+		Price:       newPlan.GetPrice(period),
+	}
+
+	// Понижение вступает в силу с окончания оплаченного периода, перерасчет не нужен
+	if !preview.IsUpgrade {
+		preview.StartDate = current.EndDate
+		preview.EndDate = addPeriod(current.EndDate, period)
+		preview.AmountDue = preview.Price
+		return preview, nil
+	}
+
+	preview.Credit = proratedCredit(current, now)
+	preview.StartDate = now
+	periodEnd := addPeriod(now, period)
+
+	credit := preview.Credit
+	if mode == ChangeModeDiscount {
+		// Остаток вычитается из цены, а то, что не поместилось в цену, переходит в дни
+		discount := credit
+		if discount > preview.Price {
+			discount = preview.Price
+		}
+		preview.AmountDue = preview.Price - discount
+		credit -= discount
+	} else {
+		preview.AmountDue = preview.Price
+	}
+
+	if credit > 0 && preview.Price > 0 {
+		periodDays := int64(periodEnd.Sub(now).Hours() / 24)
+		preview.ExtraDays = int(int64(credit) * periodDays / int64(preview.Price))
+	}
+	preview.EndDate = periodEnd.AddDate(0, 0, preview.ExtraDays)
+
+	return preview, nil
+}
+
+// ChangePlanRequest содержит данные для смены плана
+type ChangePlanRequest struct {
+	UserID        int64
+	PlanCode      string
+	Period        string
+	Mode          ChangeMode
+	AmountPaid    int // Фактически оплаченная сумма в копейках
+	PaymentID     string
+	PaymentMethod string
+}
+
+// ChangePlan меняет план подписки. Повышение применяется сразу с перерасчетом остатка,
+// понижение планируется на окончание текущего периода
+func (s *Service) ChangePlan(ctx context.Context, req ChangePlanRequest) (*PlanChangePreview, error) {
+	preview, err := s.PreviewPlanChange(ctx, req.UserID, req.PlanCode, req.Period, req.Mode)
+	if err != nil {
+		return nil, err
+	}
+
+	current := preview.Current
+	details := map[string]interface{}{
+		"from_plan_id": preview.CurrentPlan.ID,
+		"from_plan":    preview.CurrentPlan.Code,
+		"from_period":  current.Period,
+		"to_plan_id":   preview.NewPlan.ID,
+		"to_plan":      preview.NewPlan.Code,
+		"to_period":    preview.Period,
+		"is_upgrade":   preview.IsUpgrade,
+		"price":        preview.Price,
+		"start_date":   preview.StartDate,
+		"end_date":     preview.EndDate,
+	}
+
+	if !preview.IsUpgrade {
+		// Переход на бесплатный план означает окончание подписки без продления
+		autoRenew := preview.Price > 0
+		details["scheduled"] = true
+		details["effective_date"] = current.EndDate
+
+		if err := s.repo.SchedulePlanChange(ctx, current, preview.NewPlan.ID, preview.Period, autoRenew, details); err != nil {
+			s.log.Error("Ошибка планирования смены плана",
+				zap.Int64("user_id", req.UserID),
+				zap.String("plan_code", req.PlanCode),
+				zap.Error(err))
+			return nil, fmt.Errorf("ошибка планирования смены плана: %w", err)
+		}
+
+		s.log.Info("Запланирован переход на другой план",
+			zap.Int64("user_id", req.UserID),
+			zap.String("from_plan", preview.CurrentPlan.Code),
+			zap.String("to_plan", preview.NewPlan.Code),
+			zap.Time("effective_date", current.EndDate))
+
+		return preview, nil
+	}
+
+	details["mode"] = string(preview.Mode)
+	details["credit"] = preview.Credit
+	details["amount_due"] = preview.AmountDue
+	details["amount_paid"] = req.AmountPaid
+	details["extra_days"] = preview.ExtraDays
+	details["previous_end_date"] = current.EndDate
+	details["payment_id"] = req.PaymentID
+
+	sub := &Subscription{
+		UserID:        req.UserID,
+		PlanID:        preview.NewPlan.ID,
+		Status:        StatusActive,
+		StartDate:     preview.StartDate,
+		EndDate:       preview.EndDate,
+		AutoRenew:     true,
+		PaymentID:     req.PaymentID,
+		PaymentMethod: req.PaymentMethod,
+		Period:        preview.Period,
+		Plan:          preview.NewPlan,
+	}
+
+	if err := s.repo.ChangePlan(ctx, current, sub, details); err != nil {
+		s.log.Error("Ошибка смены плана",
+			zap.Int64("user_id", req.UserID),
+			zap.String("plan_code", req.PlanCode),
+			zap.Error(err))
+		return nil, fmt.Errorf("ошибка смены плана: %w", err)
+	}
+
+	s.log.Info("План подписки изменен",
+		zap.Int64("user_id", req.UserID),
+		zap.String("from_plan", preview.CurrentPlan.Code),
+		zap.String("to_plan", preview.NewPlan.Code),
+		zap.Int("credit", preview.Credit),
+		zap.Int("amount_due", preview.AmountDue),
+		zap.Int("extra_days", preview.ExtraDays))
+
+	s.emitCreated(ctx, sub, "plan_change")
+
+	return preview, nil
+}
+
+// isUpgrade определяет, является ли смена плана повышением
+func isUpgrade(current *Plan, currentPeriod string, next *Plan, nextPeriod string) bool {
+	if current.ID == next.ID {
+		// Для того же плана повышением считается только переход на годовую оплату
+		return nextPeriod == "yearly" && currentPeriod != "yearly"
+	}
+	return next.PriceMonthly >= current.PriceMonthly
+}
+
+// proratedCredit возвращает стоимость неиспользованной части текущего периода в копейках.
+// За пробную и выданную администратором подписку ничего не оплачено, поэтому остатка нет
+func proratedCredit(sub *Subscription, now time.Time) int {
+	if sub.PaymentMethod == PaymentMethodTrial || sub.PaymentMethod == PaymentMethodAdmin {
+		return 0
+	}
+
+	total := sub.EndDate.Sub(sub.StartDate)
+	remaining := sub.EndDate.Sub(now)
+	if total <= 0 || remaining <= 0 {
+		return 0
+	}
+	if remaining > total {
+		remaining = total
+	}
+
+	price := int64(sub.Plan.GetPrice(sub.Period))
+	return int(price * int64(remaining/time.Second) / int64(total/time.Second))
+}
+
+// addPeriod добавляет к дате один период подписки
+func addPeriod(t time.Time, period string) time.Time {
+	if period == "yearly" {
+		return t.AddDate(1, 0, 0)
+	}
+	return t.AddDate(0, 1, 0)
+}
@@ -0,0 +1,257 @@
+// Тесты расчета смены плана подписки
+
+package subscription
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"go.uber.org/zap"
+
+	"neurobot-prod/internal/storage/postgres/pgtest"
+)
+
+func TestCalculatePlanChange(t *testing.T) {
+	free := &Plan{ID: 1, Code: "free"}
+	premium := &Plan{ID: 2, Code: "premium", PriceMonthly: 39900, PriceYearly: 399000}
+	pro := &Plan{ID: 3, Code: "pro", PriceMonthly: 79900, PriceYearly: 799000}
+
+	date := func(month time.Month, day, hour int) time.Time {
+		return time.Date(2026, month, day, hour, 0, 0, 0, time.UTC)
+	}
+	// Месячная подписка на 30 дней: с 1 по 31 октября
+	october := func(plan *Plan) *Subscription {
+		return &Subscription{ID: 10, PlanID: plan.ID, Plan: plan, Period: "monthly",
+			StartDate: date(time.October, 1, 0), EndDate: date(time.October, 31, 0)}
+	}
+
+	tests := []struct {
+		name       string
+		current    *Subscription
+		newPlan    *Plan
+		period     string
+		mode       ChangeMode
+		now        time.Time
+		wantErr    error
+		wantUp     bool
+		wantCredit int
+		wantDue    int
+		wantExtra  int
+		wantStart  time.Time
+		wantEnd    time.Time
+	}{
+		{
+			name:    "повышение в середине периода со скидкой",
+			current: october(premium), newPlan: pro, period: "monthly", mode: ChangeModeDiscount,
+			now:    date(time.October, 16, 0),
+			wantUp: true, wantCredit: 19950, wantDue: 59950,
+			wantStart: date(time.October, 16, 0), wantEnd: date(time.November, 16, 0),
+		},
+		{
+			name:    "повышение в середине периода с продлением",
+			current: october(premium), newPlan: pro, period: "monthly", mode: ChangeModeExtend,
+			now: date(time.October, 16, 0),
+			// 19950 копеек остатка при цене 79900 за 31 день - 7 полных дней
+			wantUp: true, wantCredit: 19950, wantDue: 79900, wantExtra: 7,
+			wantStart: date(time.October, 16, 0), wantEnd: date(time.November, 23, 0),
+		},
+		{
+			name:    "остаток округляется до копейки вниз",
+			current: october(premium), newPlan: pro, period: "monthly", mode: ChangeModeDiscount,
+			// Осталось 14,5 дня из 30: 39900 * 14,5 / 30 = 19285
+			now:    date(time.October, 16, 12),
+			wantUp: true, wantCredit: 19285, wantDue: 60615,
+			wantStart: date(time.October, 16, 12), wantEnd: date(time.November, 16, 12),
+		},
+		{
+			name:    "повышение в день оформления",
+			current: october(premium), newPlan: pro, period: "monthly", mode: ChangeModeDiscount,
+			now:    date(time.October, 1, 0),
+			wantUp: true, wantCredit: 39900, wantDue: 40000,
+			wantStart: date(time.October, 1, 0), wantEnd: date(time.November, 1, 0),
+		},
+		{
+			name:    "переход на годовую оплату того же плана",
+			current: october(premium), newPlan: premium, period: "yearly", mode: ChangeModeDiscount,
+			now:    date(time.October, 16, 0),
+			wantUp: true, wantCredit: 19950, wantDue: 379050,
+			wantStart: date(time.October, 16, 0), wantEnd: time.Date(2027, time.October, 16, 0, 0, 0, 0, time.UTC),
+		},
+		{
+			name: "остаток больше цены нового плана",
+			current: &Subscription{ID: 10, PlanID: premium.ID, Plan: premium, Period: "yearly",
+				StartDate: date(time.January, 1, 0), EndDate: time.Date(2027, time.January, 1, 0, 0, 0, 0, time.UTC)},
+			newPlan: pro, period: "monthly", mode: ChangeModeDiscount,
+			now: date(time.January, 1, 0),
+			// Оставшиеся 399000 - 79900 = 319100 копеек переходят в дни: 319100 * 31 / 79900 = 123
+			wantUp: true, wantCredit: 399000, wantDue: 0, wantExtra: 123,
+			wantStart: date(time.January, 1, 0), wantEnd: date(time.June, 4, 0),
+		},
+		{
+			name: "повышение пробной подписки без остатка",
+			current: &Subscription{ID: 10, PlanID: premium.ID, Plan: premium, Period: "monthly", PaymentMethod: PaymentMethodTrial,
+				StartDate: date(time.October, 1, 0), EndDate: date(time.October, 31, 0)},
+			newPlan: pro, period: "monthly", mode: ChangeModeExtend,
+			now:    date(time.October, 2, 0),
+			wantUp: true, wantCredit: 0, wantDue: 79900,
+			wantStart: date(time.October, 2, 0), wantEnd: date(time.November, 2, 0),
+		},
+		{
+			name: "повышение подписки, выданной администратором",
+			current: &Subscription{ID: 10, PlanID: premium.ID, Plan: premium, Period: "monthly", PaymentMethod: PaymentMethodAdmin,
+				StartDate: date(time.October, 1, 0), EndDate: date(time.October, 31, 0)},
+			newPlan: pro, period: "monthly", mode: ChangeModeDiscount,
+			now:    date(time.October, 16, 0),
+			wantUp: true, wantCredit: 0, wantDue: 79900,
+			wantStart: date(time.October, 16, 0), wantEnd: date(time.November, 16, 0),
+		},
+		{
+			name:    "повышение после окончания периода",
+			current: october(premium), newPlan: pro, period: "monthly", mode: ChangeModeDiscount,
+			now:    date(time.November, 2, 0),
+			wantUp: true, wantCredit: 0, wantDue: 79900,
+			wantStart: date(time.November, 2, 0), wantEnd: date(time.December, 2, 0),
+		},
+		{
+			name: "понижение планируется на конец периода",
+			current: &Subscription{ID: 10, PlanID: pro.ID, Plan: pro, Period: "monthly",
+				StartDate: date(time.September, 15, 0), EndDate: date(time.October, 15, 0)},
+			newPlan: premium, period: "monthly", mode: ChangeModeDiscount,
+			now:    date(time.October, 1, 0),
+			wantUp: false, wantCredit: 0, wantDue: 39900,
+			wantStart: date(time.October, 15, 0), wantEnd: date(time.November, 15, 0),
+		},
+		{
+			name: "понижение в день оформления",
+			current: &Subscription{ID: 10, PlanID: pro.ID, Plan: pro, Period: "monthly",
+				StartDate: date(time.October, 15, 0), EndDate: date(time.November, 15, 0)},
+			newPlan: premium, period: "monthly", mode: ChangeModeExtend,
+			now:    date(time.October, 15, 0),
+			wantUp: false, wantCredit: 0, wantDue: 39900,
+			wantStart: date(time.November, 15, 0), wantEnd: date(time.December, 15, 0),
+		},
+		{
+			name: "переход с годовой на месячную оплату",
+			current: &Subscription{ID: 10, PlanID: premium.ID, Plan: premium, Period: "yearly",
+				StartDate: date(time.January, 10, 0), EndDate: time.Date(2027, time.January, 10, 0, 0, 0, 0, time.UTC)},
+			newPlan: premium, period: "monthly", mode: ChangeModeDiscount,
+			now:    date(time.October, 1, 0),
+			wantUp: false, wantCredit: 0, wantDue: 39900,
+			wantStart: time.Date(2027, time.January, 10, 0, 0, 0, 0, time.UTC),
+			wantEnd:   time.Date(2027, time.February, 10, 0, 0, 0, 0, time.UTC),
+		},
+		{
+			name: "переход на бесплатный план",
+			current: &Subscription{ID: 10, PlanID: premium.ID, Plan: premium, Period: "monthly",
+				StartDate: date(time.September, 15, 0), EndDate: date(time.October, 15, 0)},
+			newPlan: free, period: "monthly", mode: ChangeModeDiscount,
+			now:    date(time.October, 1, 0),
+			wantUp: false, wantCredit: 0, wantDue: 0,
+			wantStart: date(time.October, 15, 0), wantEnd: date(time.November, 15, 0),
+		},
+		{
+			name:    "тот же план и период",
+			current: october(premium), newPlan: premium, period: "monthly", mode: ChangeModeDiscount,
+			now:     date(time.October, 16, 0),
+			wantErr: ErrSamePlan,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			preview, err := calculatePlanChange(tt.current, tt.newPlan, tt.period, tt.mode, tt.now)
+			if tt.wantErr != nil {
+				if !errors.Is(err, tt.wantErr) {
+					t.Fatalf("ошибка %v, ожидалась %v", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if preview.IsUpgrade != tt.wantUp {
+				t.Errorf("повышение: %v, ожидалось %v", preview.IsUpgrade, tt.wantUp)
+			}
+			if preview.Credit != tt.wantCredit {
+				t.Errorf("остаток %d коп., ожидалось %d", preview.Credit, tt.wantCredit)
+			}
+			if preview.AmountDue != tt.wantDue {
+				t.Errorf("к оплате %d коп., ожидалось %d", preview.AmountDue, tt.wantDue)
+			}
+			if preview.ExtraDays != tt.wantExtra {
+				t.Errorf("дополнительных дней %d, ожидалось %d", preview.ExtraDays, tt.wantExtra)
+			}
+			if !preview.StartDate.Equal(tt.wantStart) {
+				t.Errorf("начало %s, ожидалось %s", preview.StartDate, tt.wantStart)
+			}
+			if !preview.EndDate.Equal(tt.wantEnd) {
+				t.Errorf("окончание %s, ожидалось %s", preview.EndDate, tt.wantEnd)
+			}
+		})
+	}
+}
+
+func TestChangePlanSchedulesDowngrade(t *testing.T) {
+	db := pgtest.Open(t)
+	pgtest.CreateUser(t, db, 2001)
+	ctx := context.Background()
+
+	repo := NewRepository(db)
+	service := NewService(repo, zap.NewNop())
+
+	pro, err := repo.GetPlanByCode(ctx, "pro")
+	if err != nil {
+		t.Fatal(err)
+	}
+	premium, err := repo.GetPlanByCode(ctx, "premium")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	start := time.Now().Truncate(time.Second)
+	end := start.AddDate(0, 1, 0)
+	if err := repo.CreateSubscription(ctx, &Subscription{
+		UserID: 2001, PlanID: pro.ID, Status: StatusActive, StartDate: start, EndDate: end,
+		AutoRenew: true, PaymentID: "pay-1", PaymentMethod: "yookassa", Period: "monthly",
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	preview, err := service.ChangePlan(ctx, ChangePlanRequest{UserID: 2001, PlanCode: "premium", Period: "monthly"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if preview.IsUpgrade || !preview.StartDate.Equal(end) {
+		t.Fatalf("понижение должно вступить в силу с окончания периода: %+v", preview)
+	}
+
+	// До конца периода действует прежний план, новый только запланирован
+	sub, err := service.GetActiveSubscription(ctx, 2001)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if sub.PlanID != pro.ID || !sub.EndDate.Equal(end) {
+		t.Errorf("текущая подписка изменилась: план %d, окончание %s", sub.PlanID, sub.EndDate)
+	}
+	if sub.ScheduledPlanID == nil || *sub.ScheduledPlanID != premium.ID || sub.ScheduledPeriod != "monthly" {
+		t.Errorf("понижение не запланировано: %v %q", sub.ScheduledPlanID, sub.ScheduledPeriod)
+	}
+	if !sub.AutoRenew {
+		t.Error("автопродление должно сохраниться для платного плана")
+	}
+
+	// Продление применяет запланированный план с нового периода
+	renewed, err := repo.RenewSubscription(ctx, sub.ID, "pay-2", "yookassa")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if renewed.PlanID != premium.ID || renewed.ScheduledPlanID != nil {
+		t.Errorf("после продления план %d, запланирован %v", renewed.PlanID, renewed.ScheduledPlanID)
+	}
+	if want := end.AddDate(0, 1, 0); !renewed.EndDate.Equal(want) {
+		t.Errorf("окончание %s, ожидалось %s", renewed.EndDate, want)
+	}
+}
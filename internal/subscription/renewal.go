@@ -0,0 +1,163 @@
+// Автопродление подписок
+
+package subscription
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"go.uber.org/zap"
+
+	"neurobot-prod/internal/config"
+)
+
+var (
+	// ErrNoPaymentMethod возвращается, если у пользователя нет сохраненного способа оплаты
+	ErrNoPaymentMethod = errors.New("нет сохраненного способа оплаты")
+	// ErrRenewalPending возвращается, если платеж за продление еще обрабатывается
+	ErrRenewalPending = errors.New("платеж за продление обрабатывается")
+)
+
+// Charger списывает оплату за продление подписки сохраненным способом оплаты.
+// При успешном списании реализация сама вызывает RenewSubscription
+type Charger interface {
+	ChargeRenewal(ctx context.Context, sub *Subscription, amount int) error
+}
+
+// Notifier отправляет пользователю сообщение о продлении подписки
+type Notifier func(userID int64, text string)
+
+// SetRenewals включает автопродление подписок через указанный способ списания
+func (s *Service) SetRenewals(charger Charger, cfg config.SubscriptionConfig, notify Notifier) {
+	s.charger = charger
+	s.renewalConfig = cfg
+	s.notify = notify
+}
+
+// ProcessRenewals списывает оплату за подписки, срок которых подходит к концу,
+// и повторяет неудачные списания по расписанию
+func (s *Service) ProcessRenewals(ctx context.Context) (int, error) {
+	if s.charger == nil {
+		return 0, nil
+	}
+
+	subs, err := s.repo.GetDueRenewals(ctx, s.renewalConfig.GetRenewBefore())
+	if err != nil {
+		s.log.Error("Ошибка получения подписок для продления", zap.Error(err))
+		return 0, fmt.Errorf("ошибка получения подписок для продления: %w", err)
+	}
+
+	renewed := 0
+	for _, sub := range subs {
+		plan := sub.GetRenewalPlan()
+		if plan == nil {
+			continue
+		}
+
+		amount := plan.GetPrice(sub.GetRenewalPeriod())
+		if amount <= 0 {
+			continue
+		}
+
+		err := s.charger.ChargeRenewal(ctx, sub, amount)
+		switch {
+		case err == nil:
+			renewed++
+
+		case errors.Is(err, ErrRenewalPending):
+			s.log.Info("Платеж за продление еще обрабатывается",
+				zap.Int64("subscription_id", sub.ID))
+
+		case errors.Is(err, ErrNoPaymentMethod):
+			// Без сохраненного способа оплаты подписка просто истечет в срок
+			if err := s.repo.DisableAutoRenew(ctx, sub.ID); err != nil {
+				s.log.Error("Ошибка отключения автопродления",
+					zap.Int64("subscription_id", sub.ID),
+					zap.Error(err))
+				continue
+			}
+			s.sendNotification(sub.UserID, fmt.Sprintf(
+				"Подписка «%s» заканчивается %s. Автопродление недоступно для выбранного способа оплаты — продлите подписку вручную командой /subscribe.",
+				sub.Plan.Name, sub.EndDate.Format("02.01.2006")))
+
+		default:
+			s.handleRenewalFailure(ctx, sub, err)
+		}
+	}
+
+	s.log.Info("Обработано продление подписок",
+		zap.Int("due", len(subs)),
+		zap.Int("renewed", renewed))
+
+	return renewed, nil
+}
+
+// handleRenewalFailure назначает повторную попытку списания или завершает подписку
+func (s *Service) handleRenewalFailure(ctx context.Context, sub *Subscription, chargeErr error) {
+	attempts := sub.RenewalAttempts + 1
+	schedule := s.renewalConfig.DunningScheduleDays
+
+	s.log.Warn("Не удалось списать оплату за продление",
+		zap.Int64("subscription_id", sub.ID),
+		zap.Int64("user_id", sub.UserID),
+		zap.Int("attempt", attempts),
+		zap.Error(chargeErr))
+
+	if attempts >= len(schedule) {
+		if err := s.repo.ExpireAfterFailedRenewal(ctx, sub, attempts, chargeErr.Error()); err != nil {
+			s.log.Error("Ошибка завершения подписки после неудачного продления",
+				zap.Int64("subscription_id", sub.ID),
+				zap.Error(err))
+			return
+		}
+		s.sendNotification(sub.UserID, fmt.Sprintf(
+			"❌ Не удалось продлить подписку «%s»: оплата не прошла. Подписка завершена, оформить ее снова можно командой /subscribe.",
+			sub.Plan.Name))
+		return
+	}
+
+	// Попытки отсчитываются от времени первого списания
+	firstAttemptAt := sub.EndDate.Add(-s.renewalConfig.GetRenewBefore())
+	nextAttemptAt := firstAttemptAt.AddDate(0, 0, schedule[attempts])
+	if nextAttemptAt.Before(time.Now()) {
+		nextAttemptAt = time.Now()
+	}
+
+	if err := s.repo.ScheduleRenewalRetry(ctx, sub, attempts, nextAttemptAt, chargeErr.Error()); err != nil {
+		s.log.Error("Ошибка планирования повторного списания",
+			zap.Int64("subscription_id", sub.ID),
+			zap.Error(err))
+		return
+	}
+
+	s.sendNotification(sub.UserID, fmt.Sprintf(
+		"⚠️ Не удалось списать оплату за продление подписки «%s». Доступ сохранен, следующая попытка — %s. Проверьте карту или продлите подписку вручную командой /subscribe.",
+		sub.Plan.Name, nextAttemptAt.Format("02.01.2006")))
+}
+
+// RenewSubscription продлевает подписку после успешной оплаты
+func (s *Service) RenewSubscription(ctx context.Context, subscriptionID int64, paymentID, paymentMethod string) (*Subscription, error) {
+	sub, err := s.repo.RenewSubscription(ctx, subscriptionID, paymentID, paymentMethod)
+	if err != nil {
+		s.log.Error("Ошибка продления подписки",
+			zap.Int64("subscription_id", subscriptionID),
+			zap.Error(err))
+		return nil, fmt.Errorf("ошибка продления подписки: %w", err)
+	}
+
+	s.log.Info("Подписка продлена",
+		zap.Int64("user_id", sub.UserID),
+		zap.Int64("subscription_id", sub.ID),
+		zap.Time("end_date", sub.EndDate))
+
+	return sub, nil
+}
+
+// sendNotification отправляет уведомление пользователю, если задан способ уведомления
+func (s *Service) sendNotification(userID int64, text string) {
+	if s.notify != nil {
+		s.notify(userID, text)
+	}
+}
@@ -0,0 +1,100 @@
+// Тесты автопродления подписок
+
+package subscription
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"go.uber.org/zap"
+
+	"neurobot-prod/internal/config"
+	"neurobot-prod/internal/storage/postgres/pgtest"
+)
+
+// fakeCharger списывает оплату без платежной системы и продлевает подписку, как настоящая реализация
+type fakeCharger struct {
+	repo    *Repository
+	charged []*Subscription
+	amounts []int
+}
+
+func (c *fakeCharger) ChargeRenewal(ctx context.Context, sub *Subscription, amount int) error {
+	c.charged = append(c.charged, sub)
+	c.amounts = append(c.amounts, amount)
+	_, err := c.repo.RenewSubscription(ctx, sub.ID, "renewal-1", "yookassa")
+	return err
+}
+
+func TestProcessRenewalsAppliesScheduledDowngrade(t *testing.T) {
+	db := pgtest.Open(t)
+	pgtest.CreateUser(t, db, 2101)
+	ctx := context.Background()
+
+	repo := NewRepository(db)
+	service := NewService(repo, zap.NewNop())
+	charger := &fakeCharger{repo: repo}
+	service.SetRenewals(charger, config.SubscriptionConfig{RenewBeforeHours: 24, DunningScheduleDays: []int{0, 1, 3}},
+		func(int64, string) {})
+
+	pro, err := repo.GetPlanByCode(ctx, "pro")
+	if err != nil {
+		t.Fatal(err)
+	}
+	premium, err := repo.GetPlanByCode(ctx, "premium")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Подписка истекает через 12 часов, то есть уже попадает в окно продления
+	end := time.Now().Add(12 * time.Hour).Truncate(time.Second)
+	if err := repo.CreateSubscription(ctx, &Subscription{
+		UserID: 2101, PlanID: pro.ID, Status: StatusActive, StartDate: end.AddDate(0, -1, 0), EndDate: end,
+		AutoRenew: true, PaymentID: "pay-1", PaymentMethod: "yookassa", Period: "monthly",
+	}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := service.ChangePlan(ctx, ChangePlanRequest{UserID: 2101, PlanCode: "premium", Period: "monthly"}); err != nil {
+		t.Fatal(err)
+	}
+
+	due, err := repo.GetDueRenewals(ctx, 24*time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(due) != 1 {
+		t.Fatalf("подписок к продлению %d, ожидалась 1", len(due))
+	}
+	if due[0].ScheduledPlan == nil || due[0].ScheduledPlan.ID != premium.ID || due[0].ScheduledPeriod != "monthly" {
+		t.Fatalf("запланированный план не загружен: %v %q", due[0].ScheduledPlanID, due[0].ScheduledPeriod)
+	}
+
+	renewed, err := service.ProcessRenewals(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if renewed != 1 {
+		t.Fatalf("продлено %d подписок, ожидалась 1", renewed)
+	}
+
+	// Списывается цена нового плана, и продление применяет его
+	if len(charger.amounts) != 1 || charger.amounts[0] != premium.PriceMonthly {
+		t.Errorf("списано %v, ожидалось %d", charger.amounts, premium.PriceMonthly)
+	}
+	sub, err := service.GetActiveSubscription(ctx, 2101)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if sub.PlanID != premium.ID || sub.ScheduledPlanID != nil {
+		t.Errorf("после продления план %d, запланирован %v", sub.PlanID, sub.ScheduledPlanID)
+	}
+	if want := end.AddDate(0, 1, 0); !sub.EndDate.Equal(want) {
+		t.Errorf("окончание %s, ожидалось %s", sub.EndDate, want)
+	}
+
+	// Продленная подписка больше не попадает в окно продления
+	if due, err := repo.GetDueRenewals(ctx, 24*time.Hour); err != nil || len(due) != 0 {
+		t.Errorf("после продления к продлению %d подписок (%v)", len(due), err)
+	}
+}
@@ -6,6 +6,7 @@ import (
 	"context"
 	"database/sql"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"time"
 )
@@ -148,15 +149,17 @@ func (r *Repository) GetPlanByCode(ctx context.Context, code string) (*Plan, err
 func (r *Repository) GetActiveSubscription(ctx context.Context, userID int64) (*Subscription, error) {
 	query := `
 		SELECT s.id, s.user_id, s.plan_id, s.status, s.start_date, s.end_date, 
-			   s.auto_renew, s.payment_id, s.payment_method, s.created_at, s.updated_at
+			   s.auto_renew, s.payment_id, s.payment_method, s.period, s.renewal_attempts, s.next_renewal_at,
+		       s.scheduled_plan_id, COALESCE(s.scheduled_period, ''),
+		       s.created_at, s.updated_at
 		FROM user_subscriptions s
-		WHERE s.user_id = $1 AND s.status = $2 AND s.end_date > NOW()
+		WHERE s.user_id = $1 AND ((s.status = $2 AND s.end_date > NOW()) OR s.status = $3)
 		ORDER BY s.end_date DESC
 		LIMIT 1
 	`
 
 	sub := &Subscription{}
-	err := r.db.QueryRowContext(ctx, query, userID, StatusActive).Scan(
+	err := r.db.QueryRowContext(ctx, query, userID, StatusActive, StatusGracePeriod).Scan(
 		&sub.ID,
 		&sub.UserID,
 		&sub.PlanID,
@@ -166,6 +169,11 @@ func (r *Repository) GetActiveSubscription(ctx context.Context, userID int64) (*
 		&sub.AutoRenew,
 		&sub.PaymentID,
 		&sub.PaymentMethod,
+		&sub.Period,
+		&sub.RenewalAttempts,
+		&sub.NextRenewalAt,
+		&sub.ScheduledPlanID,
+		&sub.ScheduledPeriod,
 		&sub.CreatedAt,
 		&sub.UpdatedAt,
 	)
@@ -205,6 +213,58 @@ func (r *Repository) GetActiveSubscription(ctx context.Context, userID int64) (*
 	}
 	sub.Plan = plan
 
+	if err := r.loadScheduledPlan(ctx, sub); err != nil {
+		return nil, err
+	}
+
+	return sub, nil
+}
+
+// GetSubscriptionByPaymentID находит подписку пользователя по ID последнего оплатившего ее платежа
+func (r *Repository) GetSubscriptionByPaymentID(ctx context.Context, userID int64, paymentID string) (*Subscription, error) {
+	query := `
+		SELECT s.id, s.user_id, s.plan_id, s.status, s.start_date, s.end_date,
+			   s.auto_renew, s.payment_id, s.payment_method, s.period, s.renewal_attempts, s.next_renewal_at,
+		       s.scheduled_plan_id, COALESCE(s.scheduled_period, ''),
+		       s.created_at, s.updated_at
+		FROM user_subscriptions s
+		WHERE s.user_id = $1 AND s.payment_id = $2
+		ORDER BY s.end_date DESC
+		LIMIT 1
+	`
+
+	sub := &Subscription{}
+	err := r.db.QueryRowContext(ctx, query, userID, paymentID).Scan(
+		&sub.ID,
+		&sub.UserID,
+		&sub.PlanID,
+		&sub.Status,
+		&sub.StartDate,
+		&sub.EndDate,
+		&sub.AutoRenew,
+		&sub.PaymentID,
+		&sub.PaymentMethod,
+		&sub.Period,
+		&sub.RenewalAttempts,
+		&sub.NextRenewalAt,
+		&sub.ScheduledPlanID,
+		&sub.ScheduledPeriod,
+		&sub.CreatedAt,
+		&sub.UpdatedAt,
+	)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("ошибка получения подписки по платежу: %w", err)
+	}
+
+	plan, err := r.GetPlanByID(ctx, sub.PlanID)
+	if err != nil {
+		return nil, err
+	}
+	sub.Plan = plan
+
 	return sub, nil
 }
 
@@ -220,8 +280,8 @@ func (r *Repository) CreateSubscription(ctx context.Context, sub *Subscription)
 	_, err = tx.ExecContext(ctx, `
 		UPDATE user_subscriptions
 		SET status = $1, updated_at = NOW()
-		WHERE user_id = $2 AND status = $3 AND end_date > NOW()
-	`, StatusCancelled, sub.UserID, StatusActive)
+		WHERE user_id = $2 AND ((status = $3 AND end_date > NOW()) OR status = $4)
+	`, StatusCancelled, sub.UserID, StatusActive, StatusGracePeriod)
 	if err != nil {
 		return fmt.Errorf("ошибка отмены текущих подписок: %w", err)
 	}
@@ -230,9 +290,9 @@ func (r *Repository) CreateSubscription(ctx context.Context, sub *Subscription)
 	query := `
 		INSERT INTO user_subscriptions (
 			user_id, plan_id, status, start_date, end_date, 
-			auto_renew, payment_id, payment_method
+			auto_renew, payment_id, payment_method, period
 		)
-		VALUES ($1, $2, $3, $4, $5, $6, $7, $8)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9)
 		RETURNING id, created_at, updated_at
 	`
 
@@ -247,6 +307,7 @@ func (r *Repository) CreateSubscription(ctx context.Context, sub *Subscription)
 		sub.AutoRenew,
 		sub.PaymentID,
 		sub.PaymentMethod,
+		sub.Period,
 	).Scan(&sub.ID, &sub.CreatedAt, &sub.UpdatedAt)
 
 	if err != nil {
@@ -293,8 +354,8 @@ func (r *Repository) CancelSubscription(ctx context.Context, subscriptionID int6
 	result, err := tx.ExecContext(ctx, `
 		UPDATE user_subscriptions
 		SET status = $1, auto_renew = false, updated_at = NOW()
-		WHERE id = $2 AND user_id = $3 AND status = $4
-	`, StatusCancelled, subscriptionID, userID, StatusActive)
+		WHERE id = $2 AND user_id = $3 AND status IN ($4, $5)
+	`, StatusCancelled, subscriptionID, userID, StatusActive, StatusGracePeriod)
 	if err != nil {
 		return fmt.Errorf("ошибка отмены подписки: %w", err)
 	}
@@ -338,7 +399,9 @@ func (r *Repository) CancelSubscription(ctx context.Context, subscriptionID int6
 func (r *Repository) GetSubscriptionHistory(ctx context.Context, userID int64, limit, offset int) ([]*Subscription, error) {
 	query := `
 		SELECT s.id, s.user_id, s.plan_id, s.status, s.start_date, s.end_date, 
-		       s.auto_renew, s.payment_id, s.payment_method, s.created_at, s.updated_at
+		       s.auto_renew, s.payment_id, s.payment_method, s.period, s.renewal_attempts, s.next_renewal_at,
+		       s.scheduled_plan_id, COALESCE(s.scheduled_period, ''),
+		       s.created_at, s.updated_at
 		FROM user_subscriptions s
 		WHERE s.user_id = $1
 		ORDER BY s.created_at DESC
@@ -366,6 +429,11 @@ func (r *Repository) GetSubscriptionHistory(ctx context.Context, userID int64, l
 			&sub.AutoRenew,
 			&sub.PaymentID,
 			&sub.PaymentMethod,
+			&sub.Period,
+			&sub.RenewalAttempts,
+			&sub.NextRenewalAt,
+			&sub.ScheduledPlanID,
+			&sub.ScheduledPeriod,
 			&sub.CreatedAt,
 			&sub.UpdatedAt,
 		)
@@ -407,7 +475,9 @@ func (r *Repository) GetSubscriptionHistory(ctx context.Context, userID int64, l
 func (r *Repository) GetExpiringSubscriptions(ctx context.Context, daysThreshold int) ([]*Subscription, error) {
 	query := `
 		SELECT s.id, s.user_id, s.plan_id, s.status, s.start_date, s.end_date, 
-		       s.auto_renew, s.payment_id, s.payment_method, s.created_at, s.updated_at
+		       s.auto_renew, s.payment_id, s.payment_method, s.period, s.renewal_attempts, s.next_renewal_at,
+		       s.scheduled_plan_id, COALESCE(s.scheduled_period, ''),
+		       s.created_at, s.updated_at
 		FROM user_subscriptions s
 		WHERE s.status = $1 
 		  AND s.end_date > NOW() 
@@ -437,6 +507,11 @@ func (r *Repository) GetExpiringSubscriptions(ctx context.Context, daysThreshold
 			&sub.AutoRenew,
 			&sub.PaymentID,
 			&sub.PaymentMethod,
+			&sub.Period,
+			&sub.RenewalAttempts,
+			&sub.NextRenewalAt,
+			&sub.ScheduledPlanID,
+			&sub.ScheduledPeriod,
 			&sub.CreatedAt,
 			&sub.UpdatedAt,
 		)
@@ -552,3 +627,485 @@ func (r *Repository) ExpireSubscriptions(ctx context.Context) (int, error) {
 
 	return len(expiredSubs), nil
 }
+
+// GetDueRenewals получает подписки с автопродлением, по которым пора списывать оплату:
+// активные, истекающие в ближайшие renewBefore, и подписки в льготном периоде с наступившей повторной попыткой
+func (r *Repository) GetDueRenewals(ctx context.Context, renewBefore time.Duration) ([]*Subscription, error) {
+	query := `
+		SELECT s.id, s.user_id, s.plan_id, s.status, s.start_date, s.end_date,
+		       s.auto_renew, COALESCE(s.payment_id, ''), COALESCE(s.payment_method, ''), s.period,
+		       s.renewal_attempts, s.next_renewal_at, s.scheduled_plan_id, COALESCE(s.scheduled_period, ''),
+		       s.created_at, s.updated_at
+		FROM user_subscriptions s
+		JOIN subscription_plans p ON p.id = s.plan_id
+		WHERE s.auto_renew = true
+		  AND p.code != 'free'
+		  AND (
+		      (s.status = $1 AND s.next_renewal_at IS NULL AND s.end_date < NOW() + INTERVAL '1 second' * $3)
+		      OR (s.status = $2 AND s.next_renewal_at <= NOW())
+		  )
+		ORDER BY s.end_date ASC
+	`
+
+	rows, err := r.db.QueryContext(ctx, query, StatusActive, StatusGracePeriod, int64(renewBefore.Seconds()))
+	if err != nil {
+		return nil, fmt.Errorf("ошибка получения подписок для продления: %w", err)
+	}
+	defer rows.Close()
+
+	var subs []*Subscription
+	for rows.Next() {
+		sub := &Subscription{}
+		err := rows.Scan(
+			&sub.ID,
+			&sub.UserID,
+			&sub.PlanID,
+			&sub.Status,
+			&sub.StartDate,
+			&sub.EndDate,
+			&sub.AutoRenew,
+			&sub.PaymentID,
+			&sub.PaymentMethod,
+			&sub.Period,
+			&sub.RenewalAttempts,
+			&sub.NextRenewalAt,
+			&sub.ScheduledPlanID,
+			&sub.ScheduledPeriod,
+			&sub.CreatedAt,
+			&sub.UpdatedAt,
+		)
+		if err != nil {
+			return nil, fmt.Errorf("ошибка сканирования подписки: %w", err)
+		}
+		subs = append(subs, sub)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("ошибка при итерации подписок: %w", err)
+	}
+
+	// Загружаем планы подписок
+	plans := make(map[int]*Plan)
+	for _, sub := range subs {
+		plan, ok := plans[sub.PlanID]
+		if !ok {
+			plan, err = r.GetPlanByID(ctx, sub.PlanID)
+			if err != nil {
+				return nil, err
+			}
+			plans[sub.PlanID] = plan
+		}
+		sub.Plan = plan
+
+		if err := r.loadScheduledPlan(ctx, sub); err != nil {
+			return nil, err
+		}
+	}
+
+	return subs, nil
+}
+
+// RenewSubscription продлевает подписку на один период и записывает событие в историю
+func (r *Repository) RenewSubscription(ctx context.Context, subscriptionID int64, paymentID, paymentMethod string) (*Subscription, error) {
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, fmt.Errorf("ошибка начала транзакции: %w", err)
+	}
+	defer tx.Rollback()
+
+	sub := &Subscription{ID: subscriptionID}
+	err = tx.QueryRowContext(ctx, `
+		SELECT user_id, plan_id, status, start_date, end_date, period, renewal_attempts,
+		       scheduled_plan_id, COALESCE(scheduled_period, '')
+		FROM user_subscriptions
+		WHERE id = $1
+		FOR UPDATE
+	`, subscriptionID).Scan(
+		&sub.UserID,
+		&sub.PlanID,
+		&sub.Status,
+		&sub.StartDate,
+		&sub.EndDate,
+		&sub.Period,
+		&sub.RenewalAttempts,
+		&sub.ScheduledPlanID,
+		&sub.ScheduledPeriod,
+	)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, errors.New("подписка не найдена")
+		}
+		return nil, fmt.Errorf("ошибка получения подписки: %w", err)
+	}
+
+	previousEndDate := sub.EndDate
+	previousPlanID := sub.PlanID
+	previousPeriod := sub.Period
+
+	// Запланированный переход на другой план вступает в силу с нового периода
+	if sub.ScheduledPlanID != nil {
+		sub.PlanID = *sub.ScheduledPlanID
+		if sub.ScheduledPeriod != "" {
+			sub.Period = sub.ScheduledPeriod
+		}
+	}
+
+	// Новый период начинается с окончания предыдущего, чтобы льготные дни не дарились повторно.
+	// Если подписка давно истекла, период отсчитывается от текущего момента
+	base := sub.EndDate
+	if base.Before(time.Now()) && sub.Status == StatusExpired {
+		base = time.Now()
+	}
+	if sub.Period == "yearly" {
+		sub.EndDate = base.AddDate(1, 0, 0)
+	} else {
+		sub.EndDate = base.AddDate(0, 1, 0)
+	}
+	sub.Status = StatusActive
+	sub.AutoRenew = true
+	sub.PaymentID = paymentID
+	sub.PaymentMethod = paymentMethod
+
+	err = tx.QueryRowContext(ctx, `
+		UPDATE user_subscriptions
+		SET status = $1, end_date = $2, payment_id = $3, payment_method = $4, plan_id = $5, period = $6,
+		    renewal_attempts = 0, next_renewal_at = NULL, auto_renew = true,
+		    scheduled_plan_id = NULL, scheduled_period = NULL, updated_at = NOW()
+		WHERE id = $7
+		RETURNING created_at, updated_at
+	`, sub.Status, sub.EndDate, paymentID, paymentMethod, sub.PlanID, sub.Period, subscriptionID).Scan(&sub.CreatedAt, &sub.UpdatedAt)
+	if err != nil {
+		return nil, fmt.Errorf("ошибка продления подписки: %w", err)
+	}
+
+	details := map[string]interface{}{
+		"plan_id":           sub.PlanID,
+		"period":            sub.Period,
+		"previous_end_date": previousEndDate,
+		"end_date":          sub.EndDate,
+		"payment_id":        paymentID,
+		"failed_attempts":   sub.RenewalAttempts,
+	}
+	if err := r.addHistory(ctx, tx, sub.UserID, sub.ID, EventRenewed, details); err != nil {
+		return nil, err
+	}
+
+	if sub.PlanID != previousPlanID || sub.Period != previousPeriod {
+		changeDetails := map[string]interface{}{
+			"from_plan_id":   previousPlanID,
+			"to_plan_id":     sub.PlanID,
+			"from_period":    previousPeriod,
+			"to_period":      sub.Period,
+			"scheduled":      true,
+			"effective_date": previousEndDate,
+		}
+		if err := r.addHistory(ctx, tx, sub.UserID, sub.ID, EventChanged, changeDetails); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, fmt.Errorf("ошибка подтверждения транзакции: %w", err)
+	}
+	sub.RenewalAttempts = 0
+	sub.ScheduledPlanID = nil
+	sub.ScheduledPeriod = ""
+
+	plan, err := r.GetPlanByID(ctx, sub.PlanID)
+	if err != nil {
+		return nil, err
+	}
+	sub.Plan = plan
+
+	return sub, nil
+}
+
+// ScheduleRenewalRetry переводит подписку в льготный период и назначает следующую попытку списания
+func (r *Repository) ScheduleRenewalRetry(ctx context.Context, sub *Subscription, attempts int, nextAttemptAt time.Time, reason string) error {
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("ошибка начала транзакции: %w", err)
+	}
+	defer tx.Rollback()
+
+	_, err = tx.ExecContext(ctx, `
+		UPDATE user_subscriptions
+		SET status = $1, renewal_attempts = $2, next_renewal_at = $3, updated_at = NOW()
+		WHERE id = $4
+	`, StatusGracePeriod, attempts, nextAttemptAt, sub.ID)
+	if err != nil {
+		return fmt.Errorf("ошибка планирования повторного списания: %w", err)
+	}
+
+	details := map[string]interface{}{
+		"attempt":         attempts,
+		"reason":          reason,
+		"next_attempt_at": nextAttemptAt,
+	}
+	if err := r.addHistory(ctx, tx, sub.UserID, sub.ID, EventRenewalFailed, details); err != nil {
+		return err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("ошибка подтверждения транзакции: %w", err)
+	}
+
+	return nil
+}
+
+// ExpireAfterFailedRenewal завершает подписку, если все попытки списания за продление не удались
+func (r *Repository) ExpireAfterFailedRenewal(ctx context.Context, sub *Subscription, attempts int, reason string) error {
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("ошибка начала транзакции: %w", err)
+	}
+	defer tx.Rollback()
+
+	_, err = tx.ExecContext(ctx, `
+		UPDATE user_subscriptions
+		SET status = $1, renewal_attempts = $2, next_renewal_at = NULL,
+		    end_date = LEAST(end_date, NOW()), updated_at = NOW()
+		WHERE id = $3
+	`, StatusExpired, attempts, sub.ID)
+	if err != nil {
+		return fmt.Errorf("ошибка завершения подписки: %w", err)
+	}
+
+	details := map[string]interface{}{
+		"expired_at": time.Now(),
+		"reason":     "renewal_failed",
+		"attempts":   attempts,
+		"last_error": reason,
+	}
+	if err := r.addHistory(ctx, tx, sub.UserID, sub.ID, EventExpired, details); err != nil {
+		return err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("ошибка подтверждения транзакции: %w", err)
+	}
+
+	return nil
+}
+
+// DisableAutoRenew отключает автопродление подписки
+func (r *Repository) DisableAutoRenew(ctx context.Context, subscriptionID int64) error {
+	_, err := r.db.ExecContext(ctx, `
+		UPDATE user_subscriptions
+		SET auto_renew = false, updated_at = NOW()
+		WHERE id = $1
+	`, subscriptionID)
+	if err != nil {
+		return fmt.Errorf("ошибка отключения автопродления: %w", err)
+	}
+
+	return nil
+}
+
+// addHistory записывает событие в историю подписок в рамках транзакции
+func (r *Repository) addHistory(ctx context.Context, tx *sql.Tx, userID, subscriptionID int64, eventType string, details map[string]interface{}) error {
+	detailsJSON, err := json.Marshal(details)
+	if err != nil {
+		return fmt.Errorf("ошибка при сериализации деталей истории: %w", err)
+	}
+
+	_, err = tx.ExecContext(ctx, `
+		INSERT INTO subscription_history (user_id, subscription_id, event_type, details)
+		VALUES ($1, $2, $3, $4)
+	`, userID, subscriptionID, eventType, detailsJSON)
+	if err != nil {
+		return fmt.Errorf("ошибка записи в историю подписок: %w", err)
+	}
+
+	return nil
+}
+
+// ChangePlan завершает текущую подписку и создает подписку на новом плане
+func (r *Repository) ChangePlan(ctx context.Context, current *Subscription, sub *Subscription, details map[string]interface{}) error {
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("ошибка начала транзакции: %w", err)
+	}
+	defer tx.Rollback()
+
+	// Завершаем текущую подписку, если она не изменилась параллельно
+	result, err := tx.ExecContext(ctx, `
+		UPDATE user_subscriptions
+		SET status = $1, auto_renew = false, next_renewal_at = NULL,
+		    scheduled_plan_id = NULL, scheduled_period = NULL, updated_at = NOW()
+		WHERE id = $2 AND status IN ($3, $4)
+	`, StatusCancelled, current.ID, StatusActive, StatusGracePeriod)
+	if err != nil {
+		return fmt.Errorf("ошибка завершения текущей подписки: %w", err)
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("ошибка получения количества затронутых строк: %w", err)
+	}
+	if rowsAffected == 0 {
+		return errors.New("текущая подписка уже изменена")
+	}
+
+	err = tx.QueryRowContext(ctx, `
+		INSERT INTO user_subscriptions (
+			user_id, plan_id, status, start_date, end_date,
+			auto_renew, payment_id, payment_method, period
+		)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9)
+		RETURNING id, created_at, updated_at
+	`,
+		sub.UserID,
+		sub.PlanID,
+		sub.Status,
+		sub.StartDate,
+		sub.EndDate,
+		sub.AutoRenew,
+		sub.PaymentID,
+		sub.PaymentMethod,
+		sub.Period,
+	).Scan(&sub.ID, &sub.CreatedAt, &sub.UpdatedAt)
+	if err != nil {
+		return fmt.Errorf("ошибка создания подписки: %w", err)
+	}
+
+	cancelDetails := map[string]interface{}{
+		"cancelled_at":        time.Now(),
+		"reason":              "plan_change",
+		"new_subscription_id": sub.ID,
+	}
+	if err := r.addHistory(ctx, tx, current.UserID, current.ID, EventCancelled, cancelDetails); err != nil {
+		return err
+	}
+
+	details["previous_subscription_id"] = current.ID
+	if err := r.addHistory(ctx, tx, sub.UserID, sub.ID, EventChanged, details); err != nil {
+		return err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("ошибка подтверждения транзакции: %w", err)
+	}
+
+	return nil
+}
+
+// SchedulePlanChange планирует переход на другой план с окончания текущего периода
+func (r *Repository) SchedulePlanChange(ctx context.Context, sub *Subscription, planID int, period string, autoRenew bool, details map[string]interface{}) error {
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("ошибка начала транзакции: %w", err)
+	}
+	defer tx.Rollback()
+
+	_, err = tx.ExecContext(ctx, `
+		UPDATE user_subscriptions
+		SET scheduled_plan_id = $1, scheduled_period = $2, auto_renew = $3, updated_at = NOW()
+		WHERE id = $4
+	`, planID, period, autoRenew, sub.ID)
+	if err != nil {
+		return fmt.Errorf("ошибка планирования смены плана: %w", err)
+	}
+
+	if err := r.addHistory(ctx, tx, sub.UserID, sub.ID, EventChanged, details); err != nil {
+		return err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("ошибка подтверждения транзакции: %w", err)
+	}
+
+	return nil
+}
+
+// loadScheduledPlan загружает запланированный план подписки
+func (r *Repository) loadScheduledPlan(ctx context.Context, sub *Subscription) error {
+	if sub.ScheduledPlanID == nil {
+		return nil
+	}
+
+	plan, err := r.GetPlanByID(ctx, *sub.ScheduledPlanID)
+	if err != nil {
+		return err
+	}
+	sub.ScheduledPlan = plan
+
+	return nil
+}
+
+// HasUsedTrial проверяет, оформлял ли пользователь пробную подписку
+func (r *Repository) HasUsedTrial(ctx context.Context, userID int64) (bool, error) {
+	var exists bool
+	err := r.db.QueryRowContext(ctx, `
+		SELECT EXISTS(SELECT 1 FROM user_subscriptions WHERE user_id = $1 AND payment_method = $2)
+	`, userID, PaymentMethodTrial).Scan(&exists)
+	if err != nil {
+		return false, fmt.Errorf("ошибка проверки пробной подписки: %w", err)
+	}
+
+	return exists, nil
+}
+
+// ListPlans возвращает все планы подписок, включая отключенные
+func (r *Repository) ListPlans(ctx context.Context) ([]*Plan, error) {
+	query := `
+		SELECT id, code, name, description, price_monthly, price_yearly,
+			   daily_neurons, max_request_length, context_messages, features,
+			   is_active, created_at, updated_at
+		FROM subscription_plans
+		ORDER BY price_monthly ASC, id ASC
+	`
+
+	rows, err := r.db.QueryContext(ctx, query)
+	if err != nil {
+		return nil, fmt.Errorf("ошибка получения планов подписок: %w", err)
+	}
+	defer rows.Close()
+
+	var plans []*Plan
+	for rows.Next() {
+		plan := &Plan{}
+		err := rows.Scan(
+			&plan.ID,
+			&plan.Code,
+			&plan.Name,
+			&plan.Description,
+			&plan.PriceMonthly,
+			&plan.PriceYearly,
+			&plan.DailyNeurons,
+			&plan.MaxRequestLength,
+			&plan.ContextMessages,
+			&plan.Features,
+			&plan.IsActive,
+			&plan.CreatedAt,
+			&plan.UpdatedAt,
+		)
+		if err != nil {
+			return nil, fmt.Errorf("ошибка сканирования плана подписки: %w", err)
+		}
+		plans = append(plans, plan)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("ошибка при итерации планов подписок: %w", err)
+	}
+
+	return plans, nil
+}
+
+// SetPlanActive включает или отключает план подписки. Возвращает false, если план не найден
+func (r *Repository) SetPlanActive(ctx context.Context, code string, active bool) (bool, error) {
+	result, err := r.db.ExecContext(ctx, `
+		UPDATE subscription_plans SET is_active = $1, updated_at = NOW() WHERE code = $2
+	`, active, code)
+	if err != nil {
+		return false, fmt.Errorf("ошибка изменения доступности плана: %w", err)
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return false, fmt.Errorf("ошибка получения количества затронутых строк: %w", err)
+	}
+
+	return rowsAffected > 0, nil
+}
@@ -9,12 +9,19 @@ import (
 	"time"
 
 	"go.uber.org/zap"
+
+	"neurobot-prod/internal/config"
+	"neurobot-prod/internal/events"
 )
 
 // Service предоставляет методы для работы с подписками
 type Service struct {
-	repo *Repository
-	log  *zap.Logger
+	repo          *Repository
+	charger       Charger
+	renewalConfig config.SubscriptionConfig
+	notify        Notifier
+	events        events.Emitter
+	log           *zap.Logger
 }
 
 // NewService создает новый сервис подписок
@@ -25,6 +32,18 @@ func NewService(repo *Repository, log *zap.Logger) *Service {
 	}
 }
 
+// SetEvents включает публикацию доменных событий
+func (s *Service) SetEvents(emitter events.Emitter) {
+	s.events = emitter
+}
+
+// emit публикует доменное событие, если задана шина событий
+func (s *Service) emit(ctx context.Context, eventType events.Type, userID int64, data map[string]interface{}) {
+	if s.events != nil {
+		s.events.Emit(ctx, events.New(eventType, userID, data))
+	}
+}
+
 // GetAllPlans возвращает все доступные планы подписок
 func (s *Service) GetAllPlans(ctx context.Context) ([]*Plan, error) {
 	plans, err := s.repo.GetAllPlans(ctx)
@@ -64,6 +83,20 @@ func (s *Service) GetActiveSubscription(ctx context.Context, userID int64) (*Sub
 	return sub, nil
 }
 
+// FindByPayment возвращает подписку пользователя, оформленную, продленную или
+// измененную платежом с указанным ID, или nil, если такой подписки нет
+func (s *Service) FindByPayment(ctx context.Context, userID int64, paymentID string) (*Subscription, error) {
+	sub, err := s.repo.GetSubscriptionByPaymentID(ctx, userID, paymentID)
+	if err != nil {
+		s.log.Error("Ошибка поиска подписки по платежу",
+			zap.Int64("user_id", userID),
+			zap.String("payment_id", paymentID),
+			zap.Error(err))
+		return nil, fmt.Errorf("ошибка поиска подписки по платежу: %w", err)
+	}
+	return sub, nil
+}
+
 // SubscriptionRequest содержит данные для создания подписки
 type SubscriptionRequest struct {
 	UserID        int64
@@ -93,10 +126,15 @@ func (s *Service) Subscribe(ctx context.Context, req SubscriptionRequest) (*Subs
 	}
 
 	// Определение периода подписки
+	period := req.Period
+	if period != "yearly" {
+		period = "monthly"
+	}
+
 	startDate := time.Now()
 	var endDate time.Time
 
-	if req.Period == "yearly" {
+	if period == "yearly" {
 		endDate = startDate.AddDate(1, 0, 0) // +1 год
 	} else {
 		endDate = startDate.AddDate(0, 1, 0) // +1 месяц
@@ -112,6 +150,7 @@ func (s *Service) Subscribe(ctx context.Context, req SubscriptionRequest) (*Subs
 		AutoRenew:     true, // По умолчанию включаем автопродление
 		PaymentID:     req.PaymentID,
 		PaymentMethod: req.PaymentMethod,
+		Period:        period,
 		Plan:          plan,
 	}
 
@@ -127,9 +166,11 @@ func (s *Service) Subscribe(ctx context.Context, req SubscriptionRequest) (*Subs
 	s.log.Info("Создана новая подписка",
 		zap.Int64("user_id", req.UserID),
 		zap.String("plan", plan.Name),
-		zap.String("period", req.Period),
+		zap.String("period", period),
 		zap.Time("end_date", endDate))
 
+	s.emitCreated(ctx, sub, "purchase")
+
 	return sub, nil
 }
 
@@ -204,16 +245,17 @@ func (s *Service) GetSubscriptionPlan(ctx context.Context, userID int64) (*Plan,
 
 // ProcessExpiringSubscriptions обрабатывает подписки, которые истекают в ближайшем будущем
 func (s *Service) ProcessExpiringSubscriptions(ctx context.Context, daysThreshold int) error {
-	// Сначала помечаем просроченные подписки как истекшие
-	expiredCount, err := s.repo.ExpireSubscriptions(ctx)
-	if err != nil {
-		s.log.Error("Ошибка обработки просроченных подписок", zap.Error(err))
-		return fmt.Errorf("ошибка обработки просроченных подписок: %w", err)
+	// Сначала продлеваем подписки с автопродлением, чтобы они не истекли из-за задержки обработки
+	if _, err := s.ProcessRenewals(ctx); err != nil {
+		return err
 	}
 
-	s.log.Info("Обработаны просроченные подписки", zap.Int("expired_count", expiredCount))
+	// Затем помечаем просроченные подписки как истекшие
+	if _, err := s.ExpireSubscriptions(ctx); err != nil {
+		return err
+	}
 
-	// Затем получаем подписки, которые скоро истекут
+	// Получаем подписки, которые скоро истекут
 	expiringSubscriptions, err := s.repo.GetExpiringSubscriptions(ctx, daysThreshold)
 	if err != nil {
 		s.log.Error("Ошибка получения истекающих подписок", zap.Error(err))
@@ -224,12 +266,21 @@ func (s *Service) ProcessExpiringSubscriptions(ctx context.Context, daysThreshol
 		zap.Int("days_threshold", daysThreshold),
 		zap.Int("count", len(expiringSubscriptions)))
 
-	// Здесь можно добавить логику для отправки уведомлений пользователям
-	// или автоматического продления подписок
-
 	return nil
 }
 
+// ExpireSubscriptions помечает просроченные подписки как истекшие
+func (s *Service) ExpireSubscriptions(ctx context.Context) (int, error) {
+	expiredCount, err := s.repo.ExpireSubscriptions(ctx)
+	if err != nil {
+		s.log.Error("Ошибка обработки просроченных подписок", zap.Error(err))
+		return 0, fmt.Errorf("ошибка обработки просроченных подписок: %w", err)
+	}
+
+	s.log.Info("Обработаны просроченные подписки", zap.Int("expired_count", expiredCount))
+	return expiredCount, nil
+}
+
 // GetDailyNeurons возвращает количество ежедневных нейронов для пользователя
 func (s *Service) GetDailyNeurons(ctx context.Context, userID int64, loyaltyBonusPercent int) (int, error) {
 	sub, err := s.repo.GetActiveSubscription(ctx, userID)
@@ -266,3 +317,17 @@ func (s *Service) GetDailyNeurons(ctx context.Context, userID int64, loyaltyBonu
 
 	return dailyNeurons, nil
 }
+
+// emitCreated публикует событие об оформлении подписки
+func (s *Service) emitCreated(ctx context.Context, sub *Subscription, source string) {
+	data := map[string]interface{}{
+		"subscription_id": sub.ID,
+		"plan_id":         sub.PlanID,
+		"period":          sub.Period,
+		"source":          source,
+	}
+	if sub.Plan != nil {
+		data["plan_code"] = sub.Plan.Code
+	}
+	s.emit(ctx, events.SubscriptionCreated, sub.UserID, data)
+}
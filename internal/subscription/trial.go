@@ -0,0 +1,85 @@
+// Пробные подписки
+
+package subscription
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// PaymentMethodTrial - способ оплаты пробной подписки, по нему определяется, что пробный период уже использован
+const PaymentMethodTrial = "trial"
+
+var (
+	// ErrTrialUsed возвращается, если пользователь уже оформлял пробную подписку
+	ErrTrialUsed = errors.New("пробный период уже использован")
+	// ErrHasPaidSubscription возвращается, если у пользователя уже есть платная подписка
+	ErrHasPaidSubscription = errors.New("уже есть платная подписка")
+)
+
+// StartTrial оформляет пробную подписку на указанный план. Пробный период доступен
+// один раз и только пользователям без платной подписки, автопродление не включается
+func (s *Service) StartTrial(ctx context.Context, userID int64, planID, days int, reference string) (*Subscription, error) {
+	if days <= 0 {
+		return nil, errors.New("некорректная длительность пробного периода")
+	}
+
+	plan, err := s.repo.GetPlanByID(ctx, planID)
+	if err != nil {
+		return nil, fmt.Errorf("ошибка получения плана подписки: %w", err)
+	}
+	if plan == nil || !plan.IsActive || plan.Code == "free" {
+		return nil, errors.New("план недоступен для пробного периода")
+	}
+
+	current, err := s.repo.GetActiveSubscription(ctx, userID)
+	if err != nil {
+		return nil, fmt.Errorf("ошибка получения активной подписки: %w", err)
+	}
+	if current != nil && current.ID != 0 && current.Plan != nil && !current.IsFree() {
+		return nil, ErrHasPaidSubscription
+	}
+
+	used, err := s.repo.HasUsedTrial(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	if used {
+		return nil, ErrTrialUsed
+	}
+
+	startDate := time.Now()
+	sub := &Subscription{
+		UserID:        userID,
+		PlanID:        plan.ID,
+		Status:        StatusActive,
+		StartDate:     startDate,
+		EndDate:       startDate.AddDate(0, 0, days),
+		AutoRenew:     false, // Сохраненного способа оплаты нет, подписка просто истечет
+		PaymentID:     reference,
+		PaymentMethod: PaymentMethodTrial,
+		Period:        "monthly",
+		Plan:          plan,
+	}
+
+	if err := s.repo.CreateSubscription(ctx, sub); err != nil {
+		s.log.Error("Ошибка создания пробной подписки",
+			zap.Int64("user_id", userID),
+			zap.Int("plan_id", planID),
+			zap.Error(err))
+		return nil, fmt.Errorf("ошибка создания пробной подписки: %w", err)
+	}
+
+	s.log.Info("Оформлена пробная подписка",
+		zap.Int64("user_id", userID),
+		zap.String("plan", plan.Code),
+		zap.Int("days", days))
+
+	s.emitCreated(ctx, sub, "trial")
+
+	return sub, nil
+}
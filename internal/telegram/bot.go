@@ -133,6 +133,59 @@ func (b *Bot) SendMessage(chatID int64, text string, options ...MessageOption) (
 	return sentMsg, nil
 }
 
+// SendPhoto отправляет изображение пользователю
+func (b *Bot) SendPhoto(chatID int64, photo tgbotapi.RequestFileData, caption string) (tgbotapi.Message, error) {
+	msg := tgbotapi.NewPhoto(chatID, photo)
+	msg.Caption = caption
+
+	sentMsg, err := b.api.Send(msg)
+	if err != nil {
+		return tgbotapi.Message{}, fmt.Errorf("ошибка отправки изображения: %w", err)
+	}
+
+	return sentMsg, nil
+}
+
+// SendDocument отправляет файл пользователю
+func (b *Bot) SendDocument(chatID int64, document tgbotapi.RequestFileData, caption string) (tgbotapi.Message, error) {
+	msg := tgbotapi.NewDocument(chatID, document)
+	msg.Caption = caption
+
+	sentMsg, err := b.api.Send(msg)
+	if err != nil {
+		return tgbotapi.Message{}, fmt.Errorf("ошибка отправки файла: %w", err)
+	}
+
+	return sentMsg, nil
+}
+
+// SendInvoice отправляет пользователю счет Telegram Payments
+func (b *Bot) SendInvoice(chatID int64, title, description, payload, providerToken, currency string, amount int) (tgbotapi.Message, error) {
+	invoice := tgbotapi.NewInvoice(chatID, title, description, payload, providerToken, "", currency,
+		[]tgbotapi.LabeledPrice{{Label: title, Amount: amount}})
+	invoice.SuggestedTipAmounts = []int{}
+
+	sentMsg, err := b.api.Send(invoice)
+	if err != nil {
+		return tgbotapi.Message{}, fmt.Errorf("ошибка отправки счета: %w", err)
+	}
+
+	return sentMsg, nil
+}
+
+// RefundStarPayment возвращает пользователю оплату в Telegram Stars
+func (b *Bot) RefundStarPayment(userID int64, chargeID string) error {
+	params := tgbotapi.Params{}
+	params.AddNonZero64("user_id", userID)
+	params["telegram_payment_charge_id"] = chargeID
+
+	if _, err := b.api.MakeRequest("refundStarPayment", params); err != nil {
+		return fmt.Errorf("ошибка возврата оплаты Telegram Stars: %w", err)
+	}
+
+	return nil
+}
+
 // MessageOption определяет опцию для настройки отправляемого сообщения
 type MessageOption func(*tgbotapi.MessageConfig)
 
@@ -156,17 +209,3 @@ func WithReplyToMessageID(messageID int) MessageOption {
 		msg.ReplyToMessageID = messageID
 	}
 }
-
-// WithWebAppInfo добавляет ссылку на Mini App
-func WithWebAppInfo() MessageOption {
-	return func(msg *tgbotapi.MessageConfig) {
-		// Создаем клавиатуру с кнопкой "Открыть Профиль"
-		keyboard := tgbotapi.NewReplyKeyboard(
-			tgbotapi.NewKeyboardButtonRow(
-				tgbotapi.NewKeyboardButton("Открыть Профиль"),
-			),
-		)
-		keyboard.ResizeKeyboard = true
-		msg.ReplyMarkup = keyboard
-	}
-}
@@ -0,0 +1,31 @@
+// Разбор ошибок Telegram Bot API
+
+package telegram
+
+import (
+	"errors"
+	"net/http"
+	"time"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+// IsBlocked проверяет, что отправка не удалась, потому что пользователь заблокировал бота
+// или удалил аккаунт (ответ 403)
+func IsBlocked(err error) bool {
+	var apiErr *tgbotapi.Error
+	return errors.As(err, &apiErr) && apiErr.Code == http.StatusForbidden
+}
+
+// RetryAfter возвращает время ожидания, если Telegram ограничил частоту запросов (ответ 429)
+func RetryAfter(err error) (time.Duration, bool) {
+	var apiErr *tgbotapi.Error
+	if !errors.As(err, &apiErr) || apiErr.Code != http.StatusTooManyRequests {
+		return 0, false
+	}
+	wait := time.Duration(apiErr.RetryAfter) * time.Second
+	if wait <= 0 {
+		wait = time.Second
+	}
+	return wait, true
+}
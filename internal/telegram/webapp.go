@@ -0,0 +1,120 @@
+// Кнопки запуска Mini App
+
+package telegram
+
+import (
+	"fmt"
+	"net/url"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+	"go.uber.org/zap"
+)
+
+// Экраны Mini App, которые открываются по кнопкам бота
+const (
+	ScreenProfile   = "profile"   // Профиль, баланс и история
+	ScreenSubscribe = "subscribe" // Планы подписки
+	ScreenBuy       = "buy"       // Пакеты нейронов
+)
+
+// webAppInfo описывает Mini App, которое открывает кнопка
+type webAppInfo struct {
+	URL string `json:"url"`
+}
+
+// inlineKeyboardButton дополняет кнопку tgbotapi полем web_app,
+// которого нет в используемой версии библиотеки
+type inlineKeyboardButton struct {
+	tgbotapi.InlineKeyboardButton
+	WebApp *webAppInfo `json:"web_app,omitempty"`
+}
+
+// inlineKeyboardMarkup представляет инлайн-клавиатуру с кнопками Mini App
+type inlineKeyboardMarkup struct {
+	InlineKeyboard [][]inlineKeyboardButton `json:"inline_keyboard"`
+}
+
+// menuButton представляет кнопку меню чата, открывающую Mini App
+type menuButton struct {
+	Type   string      `json:"type"`
+	Text   string      `json:"text"`
+	WebApp *webAppInfo `json:"web_app"`
+}
+
+// WebAppURL возвращает ссылку на экран Mini App или пустую строку, если Mini App не настроено
+func (b *Bot) WebAppURL(screen string) string {
+	if b.config.WebAppURL == "" {
+		return ""
+	}
+
+	u, err := url.Parse(b.config.WebAppURL)
+	if err != nil {
+		b.log.Warn("Некорректный адрес Mini App",
+			zap.String("webapp_url", b.config.WebAppURL),
+			zap.Error(err))
+		return ""
+	}
+	if screen != "" {
+		query := u.Query()
+		query.Set("screen", screen)
+		u.RawQuery = query.Encode()
+	}
+	return u.String()
+}
+
+// WithWebAppButton добавляет к инлайн-клавиатуре из rows кнопку, открывающую экран Mini App.
+// Если Mini App не настроено, отправляются только переданные кнопки
+func (b *Bot) WithWebAppButton(text, screen string, rows ...[]tgbotapi.InlineKeyboardButton) MessageOption {
+	return func(msg *tgbotapi.MessageConfig) {
+		markup := inlineKeyboardMarkup{}
+		for _, row := range rows {
+			buttons := make([]inlineKeyboardButton, 0, len(row))
+			for _, button := range row {
+				buttons = append(buttons, inlineKeyboardButton{InlineKeyboardButton: button})
+			}
+			markup.InlineKeyboard = append(markup.InlineKeyboard, buttons)
+		}
+
+		if webAppURL := b.WebAppURL(screen); webAppURL != "" {
+			markup.InlineKeyboard = append(markup.InlineKeyboard, []inlineKeyboardButton{{
+				InlineKeyboardButton: tgbotapi.InlineKeyboardButton{Text: text},
+				WebApp:               &webAppInfo{URL: webAppURL},
+			}})
+		}
+
+		if len(markup.InlineKeyboard) > 0 {
+			msg.ReplyMarkup = markup
+		}
+	}
+}
+
+// WithRemoveKeyboard убирает обычную клавиатуру, отправленную ранее
+func WithRemoveKeyboard() MessageOption {
+	return func(msg *tgbotapi.MessageConfig) {
+		msg.ReplyMarkup = tgbotapi.NewRemoveKeyboard(false)
+	}
+}
+
+// SetMenuButton устанавливает кнопку меню, открывающую профиль в Mini App, для всех чатов бота
+func (b *Bot) SetMenuButton(text string) error {
+	webAppURL := b.WebAppURL(ScreenProfile)
+	if webAppURL == "" {
+		return nil
+	}
+
+	params := tgbotapi.Params{}
+	if err := params.AddInterface("menu_button", menuButton{
+		Type:   "web_app",
+		Text:   text,
+		WebApp: &webAppInfo{URL: webAppURL},
+	}); err != nil {
+		return fmt.Errorf("ошибка формирования кнопки меню: %w", err)
+	}
+
+	if _, err := b.api.MakeRequest("setChatMenuButton", params); err != nil {
+		return fmt.Errorf("ошибка установки кнопки меню: %w", err)
+	}
+
+	b.log.Info("Установлена кнопка меню Mini App", zap.String("url", webAppURL))
+	return nil
+}
@@ -116,6 +116,39 @@ func (r *Repository) GetByTelegramID(ctx context.Context, telegramID int64) (*Us
 	return &user, nil
 }
 
+// GetByUsername получает пользователя по юзернейму без учета регистра
+func (r *Repository) GetByUsername(ctx context.Context, username string) (*User, error) {
+	query := `
+		SELECT id, telegram_id, username, first_name, last_name, language_code, is_bot, created_at, updated_at
+		FROM users
+		WHERE LOWER(username) = LOWER($1)
+		ORDER BY updated_at DESC
+		LIMIT 1
+	`
+
+	var user User
+	err := r.db.QueryRowContext(ctx, query, username).Scan(
+		&user.ID,
+		&user.TelegramID,
+		&user.Username,
+		&user.FirstName,
+		&user.LastName,
+		&user.LanguageCode,
+		&user.IsBot,
+		&user.CreatedAt,
+		&user.UpdatedAt,
+	)
+
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, nil // Пользователь не найден
+		}
+		return nil, fmt.Errorf("ошибка получения пользователя: %w", err)
+	}
+
+	return &user, nil
+}
+
 // Дополнительные методы для работы с пользователями...
 
 // GetUsers получает список пользователей с постраничной пагинацией
@@ -169,3 +202,25 @@ func (r *Repository) CountUsers(ctx context.Context) (int, error) {
 	}
 	return count, nil
 }
+
+// TouchActivity обновляет время последней активности пользователя и снимает отметку о блокировке бота
+func (r *Repository) TouchActivity(ctx context.Context, telegramID int64) error {
+	_, err := r.db.ExecContext(ctx, `
+		UPDATE users SET last_active_at = NOW(), blocked_at = NULL WHERE telegram_id = $1
+	`, telegramID)
+	if err != nil {
+		return fmt.Errorf("ошибка обновления активности пользователя: %w", err)
+	}
+	return nil
+}
+
+// MarkBlocked отмечает, что пользователь заблокировал бота
+func (r *Repository) MarkBlocked(ctx context.Context, telegramID int64) error {
+	_, err := r.db.ExecContext(ctx, `
+		UPDATE users SET blocked_at = NOW() WHERE telegram_id = $1 AND blocked_at IS NULL
+	`, telegramID)
+	if err != nil {
+		return fmt.Errorf("ошибка отметки блокировки бота: %w", err)
+	}
+	return nil
+}
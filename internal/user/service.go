@@ -3,14 +3,28 @@ package user
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"strconv"
+	"strings"
 	"time"
 
 	"github.com/redis/go-redis/v9"
 	"go.uber.org/zap"
 )
 
+// ErrNotFound возвращается, если пользователь с указанным Telegram ID не найден
+var ErrNotFound = errors.New("пользователь не найден")
+
+const (
+	// activityInterval - как часто время последней активности пользователя записывается в базу данных
+	activityInterval = 1 * time.Hour
+	// countCacheKey - ключ кэша количества зарегистрированных пользователей
+	countCacheKey = "user:count"
+	// countCacheTTL - время хранения количества пользователей в кэше
+	countCacheTTL = 10 * time.Minute
+)
+
 // Service предоставляет методы для работы с пользователями
 type Service struct {
 	repo  *Repository
@@ -166,7 +180,7 @@ func (s *Service) GetUserByTelegramID(ctx context.Context, telegramID int64) (*U
 	}
 
 	if user == nil {
-		return nil, fmt.Errorf("пользователь не найден")
+		return nil, ErrNotFound
 	}
 
 	// Преобразуем к DTO
@@ -187,6 +201,22 @@ func (s *Service) GetUserByTelegramID(ctx context.Context, telegramID int64) (*U
 	return &userDTO, nil
 }
 
+// GetUserByUsername получает пользователя по юзернейму (с @ или без). Возвращает nil, если пользователь не найден
+func (s *Service) GetUserByUsername(ctx context.Context, username string) (*UserDTO, error) {
+	username = strings.TrimPrefix(strings.TrimSpace(username), "@")
+	if username == "" {
+		return nil, nil
+	}
+
+	user, err := s.repo.GetByUsername(ctx, username)
+	if err != nil || user == nil {
+		return nil, err
+	}
+
+	userDTO := user.ToUserDTO()
+	return &userDTO, nil
+}
+
 // InvalidateUserCache удаляет пользователя из кэша
 func (s *Service) InvalidateUserCache(ctx context.Context, telegramID int64) {
 	cacheKey := fmt.Sprintf(s.cacheKeys.userByTelegramID, telegramID)
@@ -199,9 +229,6 @@ func (s *Service) InvalidateUserCache(ctx context.Context, telegramID int64) {
 
 // GetRegisteredUserCount возвращает количество зарегистрированных пользователей
 func (s *Service) GetRegisteredUserCount(ctx context.Context) (int, error) {
-	// Проверяем кэш сначала
-	const countCacheKey = "user:count"
-
 	// Пытаемся получить счетчик из кэша
 	cachedCount, err := s.redis.Get(ctx, countCacheKey).Int()
 	if err == nil {
@@ -209,13 +236,53 @@ func (s *Service) GetRegisteredUserCount(ctx context.Context) (int, error) {
 	}
 
 	// Если в кэше нет или ошибка, считаем из БД
+	return s.RefreshUserCount(ctx)
+}
+
+// RefreshUserCount пересчитывает количество пользователей и обновляет кэш,
+// чтобы запросы не попадали на пересчет после истечения кэша
+func (s *Service) RefreshUserCount(ctx context.Context) (int, error) {
 	count, err := s.repo.CountUsers(ctx)
 	if err != nil {
 		return 0, err
 	}
 
-	// Кэшируем результат на 10 минут
-	s.redis.Set(ctx, countCacheKey, strconv.Itoa(count), 10*time.Minute)
+	if err := s.redis.Set(ctx, countCacheKey, strconv.Itoa(count), countCacheTTL).Err(); err != nil {
+		s.log.Warn("Ошибка кэширования количества пользователей", zap.Error(err))
+	}
 
 	return count, nil
 }
+
+// TouchActivity отмечает активность пользователя. Чтобы не писать в базу данных на каждое
+// сообщение, время обновляется не чаще раза в activityInterval
+func (s *Service) TouchActivity(ctx context.Context, telegramID int64) {
+	key := fmt.Sprintf("user:active:%d", telegramID)
+	fresh, err := s.redis.SetNX(ctx, key, 1, activityInterval).Result()
+	if err != nil {
+		s.log.Warn("Ошибка проверки активности пользователя в Redis",
+			zap.Int64("telegram_id", telegramID),
+			zap.Error(err))
+		return
+	}
+	if !fresh {
+		return
+	}
+
+	if err := s.repo.TouchActivity(ctx, telegramID); err != nil {
+		s.log.Error("Ошибка обновления активности пользователя",
+			zap.Int64("telegram_id", telegramID),
+			zap.Error(err))
+		s.redis.Del(ctx, key)
+	}
+}
+
+// MarkBlocked отмечает, что пользователь заблокировал бота. Следующее сообщение
+// от пользователя снимет отметку через TouchActivity
+func (s *Service) MarkBlocked(ctx context.Context, telegramID int64) error {
+	if err := s.repo.MarkBlocked(ctx, telegramID); err != nil {
+		return err
+	}
+	s.redis.Del(ctx, fmt.Sprintf("user:active:%d", telegramID))
+	return nil
+}
@@ -0,0 +1,70 @@
+// Модель общих кошельков нейронов
+
+package wallet
+
+import (
+	"time"
+
+	"neurobot-prod/internal/user"
+)
+
+// Role представляет роль участника кошелька
+type Role string
+
+const (
+	RoleOwner  Role = "owner"  // Владелец: управляет участниками и лимитами
+	RoleMember Role = "member" // Участник: тратит нейроны кошелька на запросы
+)
+
+// Wallet представляет общий кошелек нейронов
+type Wallet struct {
+	ID             int64     `db:"id"`
+	Name           string    `db:"name"`
+	OwnerID        int64     `db:"owner_id"`
+	Balance        int       `db:"balance"`
+	LifetimeEarned int       `db:"lifetime_earned"` // Всего пополнено
+	LifetimeSpent  int       `db:"lifetime_spent"`  // Всего потрачено участниками
+	CreatedAt      time.Time `db:"created_at"`
+	UpdatedAt      time.Time `db:"updated_at"`
+}
+
+// Member представляет участника кошелька
+type Member struct {
+	WalletID   int64     `db:"wallet_id"`
+	UserID     int64     `db:"user_id"`
+	Role       Role      `db:"role"`
+	DailyLimit *int      `db:"daily_limit"` // Лимит трат за сутки, nil - без ограничений
+	IsSelected bool      `db:"is_selected"` // Кошелек оплачивает запросы участника
+	CreatedAt  time.Time `db:"created_at"`
+	UpdatedAt  time.Time `db:"updated_at"`
+}
+
+// IsOwner проверяет, является ли участник владельцем кошелька
+func (m *Member) IsOwner() bool {
+	return m.Role == RoleOwner
+}
+
+// Membership представляет кошелек вместе с участием в нем пользователя
+type Membership struct {
+	Wallet *Wallet
+	Member *Member
+}
+
+// MemberInfo представляет участника кошелька для отображения
+type MemberInfo struct {
+	Member     *Member
+	User       *user.UserDTO // nil, если пользователь не найден
+	SpentToday int           // Потрачено из кошелька за последние сутки
+}
+
+// DisplayName возвращает имя участника для отображения
+func (m *MemberInfo) DisplayName() string {
+	switch {
+	case m.User == nil:
+		return "пользователь"
+	case m.User.Username != "":
+		return "@" + m.User.Username
+	default:
+		return m.User.FirstName
+	}
+}
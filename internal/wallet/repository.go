@@ -0,0 +1,309 @@
+// Репозиторий общих кошельков нейронов
+
+package wallet
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+)
+
+// Repository представляет репозиторий для работы с общими кошельками
+type Repository struct {
+	db *sql.DB
+}
+
+// NewRepository создает новый репозиторий кошельков
+func NewRepository(db *sql.DB) *Repository {
+	return &Repository{
+		db: db,
+	}
+}
+
+const walletColumns = `w.id, w.name, w.owner_id, w.balance, w.lifetime_earned, w.lifetime_spent, w.created_at, w.updated_at`
+
+const memberColumns = `m.wallet_id, m.user_id, m.role, m.daily_limit, m.is_selected, m.created_at, m.updated_at`
+
+// rowScanner объединяет sql.Row и sql.Rows
+type rowScanner interface {
+	Scan(dest ...interface{}) error
+}
+
+// walletFields возвращает поля кошелька для сканирования
+func walletFields(w *Wallet) []interface{} {
+	return []interface{}{
+		&w.ID,
+		&w.Name,
+		&w.OwnerID,
+		&w.Balance,
+		&w.LifetimeEarned,
+		&w.LifetimeSpent,
+		&w.CreatedAt,
+		&w.UpdatedAt,
+	}
+}
+
+// memberFields возвращает поля участника для сканирования
+func memberFields(m *Member) []interface{} {
+	return []interface{}{
+		&m.WalletID,
+		&m.UserID,
+		&m.Role,
+		&m.DailyLimit,
+		&m.IsSelected,
+		&m.CreatedAt,
+		&m.UpdatedAt,
+	}
+}
+
+// scanMember сканирует строку участника
+func scanMember(row rowScanner) (*Member, error) {
+	m := &Member{}
+	if err := row.Scan(memberFields(m)...); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+// Create создает кошелек и добавляет в него владельца
+func (r *Repository) Create(ctx context.Context, w *Wallet) error {
+	dbTx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("ошибка начала транзакции: %w", err)
+	}
+	defer dbTx.Rollback()
+
+	err = dbTx.QueryRowContext(ctx, `
+		INSERT INTO neuron_wallets (name, owner_id)
+		VALUES ($1, $2)
+		RETURNING id, created_at, updated_at
+	`, w.Name, w.OwnerID).Scan(&w.ID, &w.CreatedAt, &w.UpdatedAt)
+	if err != nil {
+		return fmt.Errorf("ошибка создания кошелька: %w", err)
+	}
+
+	_, err = dbTx.ExecContext(ctx, `
+		INSERT INTO neuron_wallet_members (wallet_id, user_id, role)
+		VALUES ($1, $2, $3)
+	`, w.ID, w.OwnerID, RoleOwner)
+	if err != nil {
+		return fmt.Errorf("ошибка добавления владельца кошелька: %w", err)
+	}
+
+	if err := dbTx.Commit(); err != nil {
+		return fmt.Errorf("ошибка подтверждения транзакции: %w", err)
+	}
+	return nil
+}
+
+// Get возвращает кошелек по ID
+func (r *Repository) Get(ctx context.Context, walletID int64) (*Wallet, error) {
+	query := `SELECT ` + walletColumns + ` FROM neuron_wallets w WHERE w.id = $1`
+
+	w := &Wallet{}
+	if err := r.db.QueryRowContext(ctx, query, walletID).Scan(walletFields(w)...); err != nil {
+		if err == sql.ErrNoRows {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("ошибка получения кошелька: %w", err)
+	}
+	return w, nil
+}
+
+// CountOwned возвращает количество кошельков, которыми владеет пользователь
+func (r *Repository) CountOwned(ctx context.Context, userID int64) (int, error) {
+	var count int
+	err := r.db.QueryRowContext(ctx, `SELECT COUNT(*) FROM neuron_wallets WHERE owner_id = $1`, userID).Scan(&count)
+	if err != nil {
+		return 0, fmt.Errorf("ошибка подсчета кошельков: %w", err)
+	}
+	return count, nil
+}
+
+// CountJoined возвращает количество кошельков, в которых состоит пользователь
+func (r *Repository) CountJoined(ctx context.Context, userID int64) (int, error) {
+	var count int
+	err := r.db.QueryRowContext(ctx, `SELECT COUNT(*) FROM neuron_wallet_members WHERE user_id = $1`, userID).Scan(&count)
+	if err != nil {
+		return 0, fmt.Errorf("ошибка подсчета кошельков: %w", err)
+	}
+	return count, nil
+}
+
+// GetMember возвращает участника кошелька или nil, если пользователь в нем не состоит
+func (r *Repository) GetMember(ctx context.Context, walletID, userID int64) (*Member, error) {
+	query := `SELECT ` + memberColumns + ` FROM neuron_wallet_members m WHERE m.wallet_id = $1 AND m.user_id = $2`
+
+	m, err := scanMember(r.db.QueryRowContext(ctx, query, walletID, userID))
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("ошибка получения участника кошелька: %w", err)
+	}
+	return m, nil
+}
+
+// ListMembers возвращает участников кошелька: сначала владелец, затем по дате вступления
+func (r *Repository) ListMembers(ctx context.Context, walletID int64) ([]*Member, error) {
+	query := `
+		SELECT ` + memberColumns + `
+		FROM neuron_wallet_members m
+		WHERE m.wallet_id = $1
+		ORDER BY m.role = 'owner' DESC, m.created_at
+	`
+
+	rows, err := r.db.QueryContext(ctx, query, walletID)
+	if err != nil {
+		return nil, fmt.Errorf("ошибка получения участников кошелька: %w", err)
+	}
+	defer rows.Close()
+
+	var members []*Member
+	for rows.Next() {
+		m, err := scanMember(rows)
+		if err != nil {
+			return nil, fmt.Errorf("ошибка сканирования участника кошелька: %w", err)
+		}
+		members = append(members, m)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("ошибка при итерации участников кошелька: %w", err)
+	}
+
+	return members, nil
+}
+
+// ListByUser возвращает кошельки, в которых состоит пользователь
+func (r *Repository) ListByUser(ctx context.Context, userID int64) ([]*Membership, error) {
+	query := `
+		SELECT ` + walletColumns + `, ` + memberColumns + `
+		FROM neuron_wallet_members m
+		JOIN neuron_wallets w ON w.id = m.wallet_id
+		WHERE m.user_id = $1
+		ORDER BY w.id
+	`
+
+	rows, err := r.db.QueryContext(ctx, query, userID)
+	if err != nil {
+		return nil, fmt.Errorf("ошибка получения кошельков пользователя: %w", err)
+	}
+	defer rows.Close()
+
+	var memberships []*Membership
+	for rows.Next() {
+		ms := &Membership{Wallet: &Wallet{}, Member: &Member{}}
+		if err := rows.Scan(append(walletFields(ms.Wallet), memberFields(ms.Member)...)...); err != nil {
+			return nil, fmt.Errorf("ошибка сканирования кошелька: %w", err)
+		}
+		memberships = append(memberships, ms)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("ошибка при итерации кошельков: %w", err)
+	}
+
+	return memberships, nil
+}
+
+// AddMember добавляет участника в кошелек. Количество участников проверяется
+// под блокировкой кошелька, чтобы параллельные приглашения не превысили лимит
+func (r *Repository) AddMember(ctx context.Context, m *Member, maxMembers int) error {
+	dbTx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("ошибка начала транзакции: %w", err)
+	}
+	defer dbTx.Rollback()
+
+	if _, err := dbTx.ExecContext(ctx, `SELECT id FROM neuron_wallets WHERE id = $1 FOR UPDATE`, m.WalletID); err != nil {
+		return fmt.Errorf("ошибка блокировки кошелька: %w", err)
+	}
+
+	if maxMembers > 0 {
+		var count int
+		err := dbTx.QueryRowContext(ctx, `SELECT COUNT(*) FROM neuron_wallet_members WHERE wallet_id = $1`, m.WalletID).Scan(&count)
+		if err != nil {
+			return fmt.Errorf("ошибка подсчета участников кошелька: %w", err)
+		}
+		if count >= maxMembers {
+			return ErrMemberLimit
+		}
+	}
+
+	err = dbTx.QueryRowContext(ctx, `
+		INSERT INTO neuron_wallet_members (wallet_id, user_id, role, daily_limit)
+		VALUES ($1, $2, $3, $4)
+		ON CONFLICT (wallet_id, user_id) DO NOTHING
+		RETURNING created_at, updated_at
+	`, m.WalletID, m.UserID, m.Role, m.DailyLimit).Scan(&m.CreatedAt, &m.UpdatedAt)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return ErrAlreadyMember
+		}
+		return fmt.Errorf("ошибка добавления участника кошелька: %w", err)
+	}
+
+	if err := dbTx.Commit(); err != nil {
+		return fmt.Errorf("ошибка подтверждения транзакции: %w", err)
+	}
+	return nil
+}
+
+// RemoveMember удаляет участника из кошелька
+func (r *Repository) RemoveMember(ctx context.Context, walletID, userID int64) error {
+	_, err := r.db.ExecContext(ctx, `
+		DELETE FROM neuron_wallet_members WHERE wallet_id = $1 AND user_id = $2 AND role <> 'owner'
+	`, walletID, userID)
+	if err != nil {
+		return fmt.Errorf("ошибка удаления участника кошелька: %w", err)
+	}
+	return nil
+}
+
+// SetDailyLimit устанавливает суточный лимит участника (nil - без ограничений)
+func (r *Repository) SetDailyLimit(ctx context.Context, walletID, userID int64, limit *int) error {
+	_, err := r.db.ExecContext(ctx, `
+		UPDATE neuron_wallet_members
+		SET daily_limit = $3, updated_at = NOW()
+		WHERE wallet_id = $1 AND user_id = $2
+	`, walletID, userID, limit)
+	if err != nil {
+		return fmt.Errorf("ошибка изменения лимита участника: %w", err)
+	}
+	return nil
+}
+
+// Select выбирает кошелек, который оплачивает запросы пользователя (nil - личный баланс)
+func (r *Repository) Select(ctx context.Context, userID int64, walletID *int64) error {
+	dbTx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("ошибка начала транзакции: %w", err)
+	}
+	defer dbTx.Rollback()
+
+	_, err = dbTx.ExecContext(ctx, `
+		UPDATE neuron_wallet_members
+		SET is_selected = FALSE, updated_at = NOW()
+		WHERE user_id = $1 AND is_selected
+	`, userID)
+	if err != nil {
+		return fmt.Errorf("ошибка сброса выбранного кошелька: %w", err)
+	}
+
+	if walletID != nil {
+		_, err = dbTx.ExecContext(ctx, `
+			UPDATE neuron_wallet_members
+			SET is_selected = TRUE, updated_at = NOW()
+			WHERE wallet_id = $1 AND user_id = $2
+		`, *walletID, userID)
+		if err != nil {
+			return fmt.Errorf("ошибка выбора кошелька: %w", err)
+		}
+	}
+
+	if err := dbTx.Commit(); err != nil {
+		return fmt.Errorf("ошибка подтверждения транзакции: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,385 @@
+// Сервис общих кошельков нейронов
+
+package wallet
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"unicode/utf8"
+
+	"go.uber.org/zap"
+
+	"neurobot-prod/internal/config"
+	"neurobot-prod/internal/currency"
+	"neurobot-prod/internal/user"
+)
+
+// maxNameLength - максимальная длина названия кошелька в символах
+const maxNameLength = 64
+
+var (
+	// ErrDisabled возвращается, если общие кошельки отключены
+	ErrDisabled = errors.New("общие кошельки отключены")
+	// ErrNotFound возвращается, если кошелек не существует или пользователь в нем не состоит
+	ErrNotFound = errors.New("кошелек не найден")
+	// ErrNotOwner возвращается при попытке участника выполнить действие владельца
+	ErrNotOwner = errors.New("действие доступно только владельцу кошелька")
+	// ErrUserNotFound возвращается, если приглашаемый пользователь не пользуется ботом
+	ErrUserNotFound = errors.New("пользователь не найден")
+	// ErrNotMember возвращается, если пользователь не состоит в кошельке
+	ErrNotMember = errors.New("пользователь не состоит в кошельке")
+	// ErrAlreadyMember возвращается при повторном добавлении участника
+	ErrAlreadyMember = errors.New("пользователь уже состоит в кошельке")
+	// ErrMemberLimit возвращается, если в кошельке максимальное количество участников
+	ErrMemberLimit = errors.New("достигнут лимит участников кошелька")
+	// ErrOwnedLimit возвращается, если пользователь владеет максимальным количеством кошельков
+	ErrOwnedLimit = errors.New("достигнут лимит собственных кошельков")
+	// ErrJoinedLimit возвращается, если пользователь состоит в максимальном количестве кошельков
+	ErrJoinedLimit = errors.New("пользователь состоит в максимальном количестве кошельков")
+	// ErrOwnerCannotLeave возвращается при попытке владельца выйти из своего кошелька
+	ErrOwnerCannotLeave = errors.New("владелец не может выйти из своего кошелька")
+	// ErrInvalidName возвращается при пустом или слишком длинном названии
+	ErrInvalidName = errors.New("некорректное название кошелька")
+	// ErrInvalidLimit возвращается при отрицательном суточном лимите
+	ErrInvalidLimit = errors.New("некорректный суточный лимит")
+)
+
+// Notifier отправляет участнику уведомление о событиях кошелька
+type Notifier func(userID int64, text string)
+
+// Details содержит кошелек, участие в нем пользователя и список участников
+type Details struct {
+	Wallet  *Wallet
+	Member  *Member
+	Members []*MemberInfo
+}
+
+// Service управляет общими кошельками нейронов
+type Service struct {
+	repo            *Repository
+	currencyService *currency.Service
+	userService     *user.Service
+	config          config.WalletConfig
+	notify          Notifier
+	log             *zap.Logger
+}
+
+// NewService создает новый сервис общих кошельков
+func NewService(repo *Repository, currencyService *currency.Service, userService *user.Service, cfg config.WalletConfig, log *zap.Logger) *Service {
+	return &Service{
+		repo:            repo,
+		currencyService: currencyService,
+		userService:     userService,
+		config:          cfg,
+		log:             log.Named("wallet_service"),
+	}
+}
+
+// SetNotifier устанавливает функцию уведомления участников
+func (s *Service) SetNotifier(notify Notifier) {
+	s.notify = notify
+}
+
+// GetConfig возвращает настройки общих кошельков
+func (s *Service) GetConfig() config.WalletConfig {
+	return s.config
+}
+
+// Create создает кошелек, владельцем которого становится пользователь
+func (s *Service) Create(ctx context.Context, ownerID int64, name string) (*Wallet, error) {
+	if !s.config.Enabled {
+		return nil, ErrDisabled
+	}
+
+	name = strings.TrimSpace(name)
+	if name == "" || utf8.RuneCountInString(name) > maxNameLength {
+		return nil, ErrInvalidName
+	}
+
+	if s.config.MaxOwned > 0 {
+		owned, err := s.repo.CountOwned(ctx, ownerID)
+		if err != nil {
+			return nil, err
+		}
+		if owned >= s.config.MaxOwned {
+			return nil, ErrOwnedLimit
+		}
+	}
+	if err := s.checkJoinedLimit(ctx, ownerID); err != nil {
+		return nil, err
+	}
+
+	w := &Wallet{Name: name, OwnerID: ownerID}
+	if err := s.repo.Create(ctx, w); err != nil {
+		s.log.Error("Ошибка создания кошелька",
+			zap.Int64("owner_id", ownerID),
+			zap.Error(err))
+		return nil, err
+	}
+
+	s.log.Info("Создан общий кошелек",
+		zap.Int64("wallet_id", w.ID),
+		zap.Int64("owner_id", ownerID))
+
+	return w, nil
+}
+
+// List возвращает кошельки, в которых состоит пользователь
+func (s *Service) List(ctx context.Context, userID int64) ([]*Membership, error) {
+	return s.repo.ListByUser(ctx, userID)
+}
+
+// Get возвращает кошелек с участниками и их тратами за сутки.
+// Кошелек доступен только его участникам
+func (s *Service) Get(ctx context.Context, userID, walletID int64) (*Details, error) {
+	w, member, err := s.getForMember(ctx, userID, walletID)
+	if err != nil {
+		return nil, err
+	}
+
+	members, err := s.repo.ListMembers(ctx, walletID)
+	if err != nil {
+		return nil, err
+	}
+
+	spent, err := s.currencyService.GetWalletSpentToday(ctx, walletID)
+	if err != nil {
+		return nil, err
+	}
+
+	details := &Details{Wallet: w, Member: member}
+	for _, m := range members {
+		info := &MemberInfo{Member: m, SpentToday: spent[m.UserID]}
+		if u, err := s.userService.GetUserByTelegramID(ctx, m.UserID); err == nil {
+			info.User = u
+		}
+		details.Members = append(details.Members, info)
+	}
+
+	return details, nil
+}
+
+// AddMember добавляет пользователя в кошелек с необязательным суточным лимитом
+func (s *Service) AddMember(ctx context.Context, ownerID, walletID int64, username string, dailyLimit *int) (*user.UserDTO, error) {
+	w, err := s.getForOwner(ctx, ownerID, walletID)
+	if err != nil {
+		return nil, err
+	}
+	if dailyLimit != nil && *dailyLimit <= 0 {
+		return nil, ErrInvalidLimit
+	}
+
+	invited, err := s.userService.GetUserByUsername(ctx, username)
+	if err != nil {
+		return nil, err
+	}
+	if invited == nil || invited.IsBot {
+		return nil, ErrUserNotFound
+	}
+	if err := s.checkJoinedLimit(ctx, invited.TelegramID); err != nil {
+		return nil, err
+	}
+
+	member := &Member{
+		WalletID:   walletID,
+		UserID:     invited.TelegramID,
+		Role:       RoleMember,
+		DailyLimit: dailyLimit,
+	}
+	if err := s.repo.AddMember(ctx, member, s.config.MaxMembers); err != nil {
+		return nil, err
+	}
+
+	s.log.Info("Участник добавлен в кошелек",
+		zap.Int64("wallet_id", walletID),
+		zap.Int64("user_id", invited.TelegramID))
+
+	text := fmt.Sprintf("👛 Вас добавили в общий кошелек «%s».", w.Name)
+	if dailyLimit != nil {
+		text += fmt.Sprintf("\nСуточный лимит трат: %d нейронов.", *dailyLimit)
+	}
+	text += fmt.Sprintf("\nЧтобы оплачивать запросы из кошелька, выберите его: /wallet %d", walletID)
+	s.sendNotification(invited.TelegramID, text)
+
+	return invited, nil
+}
+
+// RemoveMember исключает участника из кошелька
+func (s *Service) RemoveMember(ctx context.Context, ownerID, walletID int64, username string) (*user.UserDTO, error) {
+	w, err := s.getForOwner(ctx, ownerID, walletID)
+	if err != nil {
+		return nil, err
+	}
+
+	member, removed, err := s.findMember(ctx, walletID, username)
+	if err != nil {
+		return nil, err
+	}
+	if member.IsOwner() {
+		return nil, ErrOwnerCannotLeave
+	}
+
+	if err := s.repo.RemoveMember(ctx, walletID, member.UserID); err != nil {
+		return nil, err
+	}
+
+	s.log.Info("Участник исключен из кошелька",
+		zap.Int64("wallet_id", walletID),
+		zap.Int64("user_id", member.UserID))
+
+	s.sendNotification(member.UserID, fmt.Sprintf("👛 Вас исключили из общего кошелька «%s».", w.Name))
+
+	return removed, nil
+}
+
+// Leave выводит пользователя из кошелька. Владелец выйти не может
+func (s *Service) Leave(ctx context.Context, userID, walletID int64) error {
+	_, member, err := s.getForMember(ctx, userID, walletID)
+	if err != nil {
+		return err
+	}
+	if member.IsOwner() {
+		return ErrOwnerCannotLeave
+	}
+
+	if err := s.repo.RemoveMember(ctx, walletID, userID); err != nil {
+		return err
+	}
+
+	s.log.Info("Участник вышел из кошелька",
+		zap.Int64("wallet_id", walletID),
+		zap.Int64("user_id", userID))
+
+	return nil
+}
+
+// SetLimit устанавливает суточный лимит трат участника (nil - без ограничений)
+func (s *Service) SetLimit(ctx context.Context, ownerID, walletID int64, username string, dailyLimit *int) (*user.UserDTO, error) {
+	if _, err := s.getForOwner(ctx, ownerID, walletID); err != nil {
+		return nil, err
+	}
+	if dailyLimit != nil && *dailyLimit <= 0 {
+		return nil, ErrInvalidLimit
+	}
+
+	member, u, err := s.findMember(ctx, walletID, username)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := s.repo.SetDailyLimit(ctx, walletID, member.UserID, dailyLimit); err != nil {
+		return nil, err
+	}
+
+	return u, nil
+}
+
+// Select выбирает кошелек, который оплачивает запросы пользователя.
+// walletID 0 возвращает оплату с личного баланса
+func (s *Service) Select(ctx context.Context, userID, walletID int64) (*Wallet, error) {
+	if walletID == 0 {
+		return nil, s.repo.Select(ctx, userID, nil)
+	}
+
+	w, _, err := s.getForMember(ctx, userID, walletID)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := s.repo.Select(ctx, userID, &walletID); err != nil {
+		return nil, err
+	}
+
+	return w, nil
+}
+
+// Deposit пополняет кошелек купленными нейронами участника
+func (s *Service) Deposit(ctx context.Context, userID, walletID int64, amount int, idempotencyKey string) (*currency.Transfer, error) {
+	if _, _, err := s.getForMember(ctx, userID, walletID); err != nil {
+		return nil, err
+	}
+
+	return s.currencyService.Deposit(ctx, userID, walletID, amount, idempotencyKey)
+}
+
+// getForMember возвращает кошелек и участие в нем пользователя
+func (s *Service) getForMember(ctx context.Context, userID, walletID int64) (*Wallet, *Member, error) {
+	if !s.config.Enabled {
+		return nil, nil, ErrDisabled
+	}
+
+	member, err := s.repo.GetMember(ctx, walletID, userID)
+	if err != nil {
+		return nil, nil, err
+	}
+	if member == nil {
+		return nil, nil, ErrNotFound
+	}
+
+	w, err := s.repo.Get(ctx, walletID)
+	if err != nil {
+		return nil, nil, err
+	}
+	if w == nil {
+		return nil, nil, ErrNotFound
+	}
+
+	return w, member, nil
+}
+
+// getForOwner возвращает кошелек, если пользователь является его владельцем
+func (s *Service) getForOwner(ctx context.Context, userID, walletID int64) (*Wallet, error) {
+	w, member, err := s.getForMember(ctx, userID, walletID)
+	if err != nil {
+		return nil, err
+	}
+	if !member.IsOwner() {
+		return nil, ErrNotOwner
+	}
+	return w, nil
+}
+
+// findMember находит участника кошелька по юзернейму
+func (s *Service) findMember(ctx context.Context, walletID int64, username string) (*Member, *user.UserDTO, error) {
+	u, err := s.userService.GetUserByUsername(ctx, username)
+	if err != nil {
+		return nil, nil, err
+	}
+	if u == nil {
+		return nil, nil, ErrUserNotFound
+	}
+
+	member, err := s.repo.GetMember(ctx, walletID, u.TelegramID)
+	if err != nil {
+		return nil, nil, err
+	}
+	if member == nil {
+		return nil, nil, ErrNotMember
+	}
+
+	return member, u, nil
+}
+
+// checkJoinedLimit проверяет, может ли пользователь состоять еще в одном кошельке
+func (s *Service) checkJoinedLimit(ctx context.Context, userID int64) error {
+	if s.config.MaxJoined <= 0 {
+		return nil
+	}
+	joined, err := s.repo.CountJoined(ctx, userID)
+	if err != nil {
+		return err
+	}
+	if joined >= s.config.MaxJoined {
+		return ErrJoinedLimit
+	}
+	return nil
+}
+
+// sendNotification отправляет уведомление пользователю, если задан способ уведомления
+func (s *Service) sendNotification(userID int64, text string) {
+	if s.notify != nil {
+		s.notify(userID, text)
+	}
+}
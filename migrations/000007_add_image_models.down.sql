@@ -0,0 +1,5 @@
+-- migrations/000007_add_image_models.down.sql
+UPDATE subscription_plans
+SET features = jsonb_set(features, '{available_models}', (features->'available_models') - 'dall-e-3'),
+    updated_at = NOW()
+WHERE code IN ('premium', 'pro');
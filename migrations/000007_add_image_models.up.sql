@@ -0,0 +1,8 @@
+-- migrations/000007_add_image_models.up.sql
+-- Доступ к генерации изображений для платных планов
+
+UPDATE subscription_plans
+SET features = jsonb_set(features, '{available_models}', (features->'available_models') || '["dall-e-3"]'::jsonb),
+    updated_at = NOW()
+WHERE code IN ('premium', 'pro')
+  AND NOT (features->'available_models') ? 'dall-e-3';
@@ -0,0 +1,4 @@
+-- migrations/000008_create_persona_tables.down.sql
+UPDATE subscription_plans SET features = features - 'custom_prompt_max_length', updated_at = NOW();
+DROP TABLE IF EXISTS conversations;
+DROP TABLE IF EXISTS personas;
@@ -0,0 +1,49 @@
+-- migrations/000008_create_persona_tables.up.sql
+-- Таблицы для персон (шаблонов системных промптов) и диалогов
+
+-- Персоны, настраиваемые администраторами
+CREATE TABLE IF NOT EXISTS personas (
+    id SERIAL PRIMARY KEY,
+    code VARCHAR(50) NOT NULL UNIQUE,            -- Уникальный код персоны
+    name VARCHAR(100) NOT NULL,                  -- Название для пользователя
+    description TEXT,                            -- Краткое описание
+    system_prompt TEXT NOT NULL,                 -- Системный промпт
+    sort_order INTEGER NOT NULL DEFAULT 0,       -- Порядок сортировки
+    is_active BOOLEAN NOT NULL DEFAULT TRUE,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    updated_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+-- Диалоги пользователей
+CREATE TABLE IF NOT EXISTS conversations (
+    id BIGSERIAL PRIMARY KEY,
+    user_id BIGINT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    persona_id INTEGER REFERENCES personas(id),  -- Выбранная персона (NULL - без персоны)
+    custom_system_prompt TEXT,                   -- Собственный системный промпт пользователя
+    is_active BOOLEAN NOT NULL DEFAULT TRUE,     -- Текущий диалог пользователя
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    updated_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+-- Индексы
+CREATE INDEX IF NOT EXISTS idx_conversations_user_id ON conversations(user_id);
+CREATE UNIQUE INDEX IF NOT EXISTS idx_conversations_user_active ON conversations(user_id) WHERE is_active;
+
+-- Ограничение длины собственного промпта в зависимости от плана
+UPDATE subscription_plans SET features = features || '{"custom_prompt_max_length": 200}'::jsonb, updated_at = NOW() WHERE code = 'free';
+UPDATE subscription_plans SET features = features || '{"custom_prompt_max_length": 1000}'::jsonb, updated_at = NOW() WHERE code = 'premium';
+UPDATE subscription_plans SET features = features || '{"custom_prompt_max_length": 4000}'::jsonb, updated_at = NOW() WHERE code = 'pro';
+
+-- Начальные данные для персон
+INSERT INTO personas (code, name, description, system_prompt, sort_order)
+VALUES
+('translator', 'Переводчик', 'Точный перевод с сохранением стиля',
+ 'Ты профессиональный переводчик. Определи язык текста пользователя и переведи его на русский язык, а русский текст - на английский. Сохраняй стиль, тон и форматирование оригинала. Не добавляй пояснений, если пользователь о них не просит.', 1),
+('coder', 'Программист', 'Помощь с кодом, ревью и отладкой',
+ 'Ты опытный программист. Отвечай точно и по делу, приводи рабочие примеры кода с пояснениями. Указывай на возможные ошибки, проблемы безопасности и производительности. Оформляй код в блоках с указанием языка.', 2),
+('editor', 'Редактор', 'Исправление ошибок и улучшение текста',
+ 'Ты литературный редактор. Исправь орфографические, пунктуационные и стилистические ошибки в тексте пользователя, сохраняя его смысл и авторский стиль. После исправленного текста кратко перечисли основные правки.', 3),
+('teacher', 'Учитель', 'Объяснение сложных тем простыми словами',
+ 'Ты терпеливый учитель. Объясняй сложные темы простыми словами, используй примеры и аналогии. Проверяй понимание и предлагай вопросы для самопроверки.', 4),
+('marketer', 'Маркетолог', 'Тексты для рекламы и соцсетей',
+ 'Ты опытный маркетолог и копирайтер. Помогай писать продающие тексты, посты для соцсетей, слоганы и описания товаров. Учитывай целевую аудиторию и предлагай несколько вариантов.', 5);
@@ -0,0 +1,6 @@
+-- migrations/000009_create_conversation_messages.down.sql
+ALTER TABLE conversations
+    DROP COLUMN IF EXISTS summary,
+    DROP COLUMN IF EXISTS summarized_until_id,
+    DROP COLUMN IF EXISTS summary_updated_at;
+DROP TABLE IF EXISTS conversation_messages;
@@ -0,0 +1,19 @@
+-- migrations/000009_create_conversation_messages.up.sql
+-- История сообщений диалогов и краткое содержание для длинных диалогов
+
+CREATE TABLE IF NOT EXISTS conversation_messages (
+    id BIGSERIAL PRIMARY KEY,
+    conversation_id BIGINT NOT NULL REFERENCES conversations(id) ON DELETE CASCADE,
+    role VARCHAR(20) NOT NULL,          -- user, assistant
+    content TEXT NOT NULL,
+    model_name VARCHAR(50),             -- Модель, сформировавшая ответ
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX IF NOT EXISTS idx_conversation_messages_conversation_id ON conversation_messages(conversation_id, id);
+
+-- Краткое содержание старой части диалога
+ALTER TABLE conversations
+    ADD COLUMN IF NOT EXISTS summary TEXT,
+    ADD COLUMN IF NOT EXISTS summarized_until_id BIGINT NOT NULL DEFAULT 0, -- ID последнего сообщения, вошедшего в краткое содержание
+    ADD COLUMN IF NOT EXISTS summary_updated_at TIMESTAMPTZ;
@@ -0,0 +1,2 @@
+-- migrations/000010_add_compare_feature.down.sql
+UPDATE subscription_plans SET features = features - 'compare_max_models', updated_at = NOW();
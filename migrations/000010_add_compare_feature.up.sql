@@ -0,0 +1,3 @@
+-- migrations/000010_add_compare_feature.up.sql
+-- Режим сравнения моделей: максимальное количество моделей в одном сравнении
+UPDATE subscription_plans SET features = features || '{"compare_max_models": 3}'::jsonb, updated_at = NOW() WHERE code = 'pro';
@@ -0,0 +1,5 @@
+-- migrations/000011_add_payment_fulfillment.down.sql
+DROP INDEX IF EXISTS idx_payment_notifications_external_id;
+DROP INDEX IF EXISTS idx_payments_unfulfilled;
+ALTER TABLE payments DROP COLUMN IF EXISTS fulfillment_started_at;
+ALTER TABLE payments DROP COLUMN IF EXISTS fulfilled_at;
@@ -0,0 +1,13 @@
+-- migrations/000011_add_payment_fulfillment.up.sql
+-- Отметка о выдаче оплаченного товара (подписки или пакета нейронов)
+ALTER TABLE payments ADD COLUMN IF NOT EXISTS fulfilled_at TIMESTAMPTZ;
+
+-- Начало выдачи оплаченного товара. Выдача, не завершенная за отведенное время
+-- (например, из-за падения процесса), повторяется задачей retry_fulfillments
+ALTER TABLE payments ADD COLUMN IF NOT EXISTS fulfillment_started_at TIMESTAMPTZ;
+
+CREATE INDEX IF NOT EXISTS idx_payments_unfulfilled ON payments(updated_at)
+    WHERE status = 'succeeded' AND fulfilled_at IS NULL;
+
+-- Быстрый поиск уведомлений по внешнему ID
+CREATE INDEX IF NOT EXISTS idx_payment_notifications_external_id ON payment_notifications(external_id);
@@ -0,0 +1,8 @@
+-- migrations/000012_add_subscription_renewals.down.sql
+DROP INDEX IF EXISTS idx_user_subscriptions_next_renewal_at;
+UPDATE user_subscriptions SET status = 'expired' WHERE status = 'grace_period';
+ALTER TABLE user_subscriptions
+    DROP COLUMN IF EXISTS period,
+    DROP COLUMN IF EXISTS renewal_attempts,
+    DROP COLUMN IF EXISTS next_renewal_at;
+DROP TABLE IF EXISTS saved_payment_methods;
@@ -0,0 +1,24 @@
+-- migrations/000012_add_subscription_renewals.up.sql
+-- Сохраненные способы оплаты для автопродления подписок
+CREATE TABLE IF NOT EXISTS saved_payment_methods (
+    id BIGSERIAL PRIMARY KEY,
+    user_id BIGINT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    provider VARCHAR(50) NOT NULL,              -- Провайдер платежа (yookassa)
+    external_id VARCHAR(100) NOT NULL,          -- ID способа оплаты у провайдера
+    method_type VARCHAR(50),                    -- bank_card, yoo_money, ...
+    title VARCHAR(100),                         -- Описание для пользователя, например "Bank card *4444"
+    is_active BOOLEAN NOT NULL DEFAULT TRUE,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    updated_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    UNIQUE (provider, external_id)
+);
+
+CREATE INDEX IF NOT EXISTS idx_saved_payment_methods_user_id ON saved_payment_methods(user_id) WHERE is_active;
+
+-- Состояние продления подписки
+ALTER TABLE user_subscriptions
+    ADD COLUMN IF NOT EXISTS period VARCHAR(10) NOT NULL DEFAULT 'monthly', -- monthly, yearly
+    ADD COLUMN IF NOT EXISTS renewal_attempts INTEGER NOT NULL DEFAULT 0,   -- Неудачные попытки списания в текущем цикле
+    ADD COLUMN IF NOT EXISTS next_renewal_at TIMESTAMPTZ;                   -- Время следующей попытки списания
+
+CREATE INDEX IF NOT EXISTS idx_user_subscriptions_next_renewal_at ON user_subscriptions(next_renewal_at) WHERE next_renewal_at IS NOT NULL;
@@ -0,0 +1,4 @@
+-- migrations/000013_add_scheduled_plan_change.down.sql
+ALTER TABLE user_subscriptions
+    DROP COLUMN IF EXISTS scheduled_plan_id,
+    DROP COLUMN IF EXISTS scheduled_period;
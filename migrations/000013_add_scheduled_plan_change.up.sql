@@ -0,0 +1,5 @@
+-- migrations/000013_add_scheduled_plan_change.up.sql
+-- Переход на более дешевый план, запланированный на конец оплаченного периода
+ALTER TABLE user_subscriptions
+    ADD COLUMN IF NOT EXISTS scheduled_plan_id INTEGER REFERENCES subscription_plans(id),
+    ADD COLUMN IF NOT EXISTS scheduled_period VARCHAR(10);
@@ -0,0 +1,4 @@
+-- migrations/000014_add_promocode_redemption.down.sql
+DROP INDEX IF EXISTS idx_promocode_usages_pending;
+ALTER TABLE promocode_usages DROP COLUMN IF EXISTS applied_at;
+DROP INDEX IF EXISTS idx_promocode_usages_promocode_user;
@@ -0,0 +1,8 @@
+-- migrations/000014_add_promocode_redemption.up.sql
+-- Один промокод может быть использован пользователем только один раз
+CREATE UNIQUE INDEX IF NOT EXISTS idx_promocode_usages_promocode_user ON promocode_usages(promocode_id, user_id);
+
+-- Когда скидка по промокоду была применена к оплате
+ALTER TABLE promocode_usages ADD COLUMN IF NOT EXISTS applied_at TIMESTAMPTZ;
+
+CREATE INDEX IF NOT EXISTS idx_promocode_usages_pending ON promocode_usages(user_id) WHERE applied_at IS NULL;
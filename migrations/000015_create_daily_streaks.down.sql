@@ -0,0 +1,2 @@
+-- migrations/000015_create_daily_streaks.down.sql
+DROP TABLE IF EXISTS daily_streaks;
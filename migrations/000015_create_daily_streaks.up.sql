@@ -0,0 +1,20 @@
+-- migrations/000015_create_daily_streaks.up.sql
+-- Серии ежедневных начислений нейронов
+
+CREATE TABLE IF NOT EXISTS daily_streaks (
+    user_id BIGINT PRIMARY KEY REFERENCES users(id) ON DELETE CASCADE,
+    current_streak INTEGER NOT NULL DEFAULT 0,                -- Текущая серия дней подряд
+    longest_streak INTEGER NOT NULL DEFAULT 0,                -- Самая длинная серия
+    timezone VARCHAR(64) NOT NULL DEFAULT 'Europe/Moscow',    -- Часовой пояс пользователя (IANA)
+    last_claim_date DATE,                                     -- Дата последнего начисления по времени пользователя
+    freezes INTEGER NOT NULL DEFAULT 0,                       -- Купленные заморозки серии
+    freezes_purchased INTEGER NOT NULL DEFAULT 0,             -- Всего куплено заморозок, номер покупки входит в ключ идемпотентности оплаты
+    reminders_enabled BOOLEAN NOT NULL DEFAULT FALSE,         -- Напоминать о неполученном начислении
+    last_reminded_date DATE,                                  -- Дата последнего напоминания
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    updated_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    CONSTRAINT daily_streaks_freezes_check CHECK (freezes >= 0)
+);
+
+-- Поиск пользователей для напоминаний
+CREATE INDEX IF NOT EXISTS idx_daily_streaks_reminders ON daily_streaks(user_id) WHERE reminders_enabled;
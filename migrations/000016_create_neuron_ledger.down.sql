@@ -0,0 +1,8 @@
+-- migrations/000016_create_neuron_ledger.down.sql
+DROP TABLE IF EXISTS ledger_discrepancies;
+DROP TABLE IF EXISTS ledger_reconciliations;
+DROP TABLE IF EXISTS ledger_entries;
+DROP TABLE IF EXISTS ledger_accounts;
+UPDATE neuron_transactions SET transaction_type = 'admin' WHERE transaction_type = 'expiry';
+DROP INDEX IF EXISTS idx_neuron_transactions_expiring;
+ALTER TABLE neuron_transactions DROP COLUMN IF EXISTS expired_at;
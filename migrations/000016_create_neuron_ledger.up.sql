@@ -0,0 +1,100 @@
+-- migrations/000016_create_neuron_ledger.up.sql
+-- Двойная запись для нейронов: каждая транзакция отражается проводкой по счету
+-- пользователя и встречной проводкой по системному счету
+
+-- Системные счета
+CREATE TABLE IF NOT EXISTS ledger_accounts (
+    id SERIAL PRIMARY KEY,
+    code VARCHAR(50) NOT NULL UNIQUE,            -- issuance, revenue, expiry, promo
+    name VARCHAR(100) NOT NULL,
+    balance BIGINT NOT NULL DEFAULT 0,           -- Сумма проводок по счету
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    updated_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+INSERT INTO ledger_accounts (code, name)
+VALUES
+('issuance', 'Выпуск нейронов'),
+('revenue', 'Потраченные нейроны'),
+('expiry', 'Сгоревшие нейроны'),
+('promo', 'Нейроны по промокодам')
+ON CONFLICT (code) DO NOTHING;
+
+-- Проводки. Проводка относится либо к счету пользователя, либо к системному счету
+CREATE TABLE IF NOT EXISTS ledger_entries (
+    id BIGSERIAL PRIMARY KEY,
+    transaction_id BIGINT NOT NULL REFERENCES neuron_transactions(id),
+    user_id BIGINT REFERENCES users(id) ON DELETE CASCADE,   -- Счет пользователя
+    account_id INTEGER REFERENCES ledger_accounts(id),        -- Системный счет
+    amount INTEGER NOT NULL,                                  -- Положительная - приход на счет, отрицательная - расход
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    CONSTRAINT ledger_entries_account_check CHECK ((user_id IS NULL) <> (account_id IS NULL))
+);
+
+CREATE INDEX IF NOT EXISTS idx_ledger_entries_transaction_id ON ledger_entries(transaction_id);
+CREATE INDEX IF NOT EXISTS idx_ledger_entries_user_id ON ledger_entries(user_id) WHERE user_id IS NOT NULL;
+CREATE INDEX IF NOT EXISTS idx_ledger_entries_account_id ON ledger_entries(account_id) WHERE account_id IS NOT NULL;
+
+-- Отметка о списании истекших начислений, чтобы не списывать их повторно
+ALTER TABLE neuron_transactions ADD COLUMN IF NOT EXISTS expired_at TIMESTAMPTZ;
+CREATE INDEX IF NOT EXISTS idx_neuron_transactions_expiring ON neuron_transactions(expires_at) WHERE amount > 0 AND expired_at IS NULL;
+
+-- Списания по истечению срока выделяются в отдельный тип
+UPDATE neuron_transactions SET transaction_type = 'expiry'
+WHERE transaction_type = 'admin' AND reference_id = 'expire_system';
+
+-- Начисления, уже обработанные предыдущими запусками списания
+UPDATE neuron_transactions g SET expired_at = NOW()
+WHERE g.amount > 0 AND g.expires_at < NOW()
+    AND EXISTS (
+        SELECT 1 FROM neuron_transactions e
+        WHERE e.user_id = g.user_id AND e.transaction_type = 'expiry' AND e.created_at >= g.expires_at
+    );
+
+-- Проводки для существующих транзакций
+INSERT INTO ledger_entries (transaction_id, user_id, amount, created_at)
+SELECT id, user_id, amount, created_at
+FROM neuron_transactions
+WHERE amount <> 0;
+
+INSERT INTO ledger_entries (transaction_id, account_id, amount, created_at)
+SELECT t.id, a.id, -t.amount, t.created_at
+FROM neuron_transactions t
+JOIN ledger_accounts a ON a.code = CASE
+    WHEN t.amount > 0 AND t.transaction_type = 'promocode' THEN 'promo'
+    WHEN t.amount > 0 THEN 'issuance'
+    WHEN t.transaction_type = 'expiry' THEN 'expiry'
+    WHEN t.transaction_type = 'admin' THEN 'issuance'
+    ELSE 'revenue'
+END
+WHERE t.amount <> 0;
+
+UPDATE ledger_accounts a SET balance = COALESCE((
+    SELECT SUM(e.amount) FROM ledger_entries e WHERE e.account_id = a.id
+), 0), updated_at = NOW();
+
+-- Запуски сверки балансов с главной книгой
+CREATE TABLE IF NOT EXISTS ledger_reconciliations (
+    id BIGSERIAL PRIMARY KEY,
+    repair BOOLEAN NOT NULL DEFAULT FALSE,       -- Исправлялись ли расхождения
+    users_checked INTEGER NOT NULL DEFAULT 0,
+    discrepancies INTEGER NOT NULL DEFAULT 0,
+    repaired INTEGER NOT NULL DEFAULT 0,
+    started_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    finished_at TIMESTAMPTZ
+);
+
+-- Найденные расхождения
+CREATE TABLE IF NOT EXISTS ledger_discrepancies (
+    id BIGSERIAL PRIMARY KEY,
+    reconciliation_id BIGINT NOT NULL REFERENCES ledger_reconciliations(id) ON DELETE CASCADE,
+    subject VARCHAR(20) NOT NULL,                -- user, account, transaction
+    subject_id BIGINT NOT NULL,                  -- ID пользователя, счета или транзакции
+    field VARCHAR(50) NOT NULL,                  -- Поле с расхождением
+    expected BIGINT NOT NULL,                    -- Значение по главной книге
+    actual BIGINT NOT NULL,                      -- Сохраненное значение
+    repaired BOOLEAN NOT NULL DEFAULT FALSE,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX IF NOT EXISTS idx_ledger_discrepancies_reconciliation_id ON ledger_discrepancies(reconciliation_id);
@@ -0,0 +1,5 @@
+-- migrations/000017_add_refunds.down.sql
+ALTER TABLE payments DROP COLUMN IF EXISTS refund_external_id;
+ALTER TABLE payments DROP COLUMN IF EXISTS refunded_at;
+DROP INDEX IF EXISTS idx_neuron_transactions_reference_id;
+DROP INDEX IF EXISTS idx_neuron_transactions_refund_reference;
@@ -0,0 +1,17 @@
+-- migrations/000017_add_refunds.up.sql
+-- Возвраты нейронов и платежей
+
+-- Возврат отменяет исходную транзакцию и не считается новым начислением или списанием:
+-- возврат списания уменьшает lifetime_spent, а возврат начисления - lifetime_earned.
+-- Возвраты появляются только с этой миграции, поэтому пересчитывать lifetime метрики не нужно
+
+-- Транзакция может быть возвращена только один раз (reference_id возврата - refund:<ID транзакции>)
+CREATE UNIQUE INDEX IF NOT EXISTS idx_neuron_transactions_refund_reference
+    ON neuron_transactions(reference_id) WHERE transaction_type = 'refund';
+
+-- Поиск транзакций по связанной сущности (ID платежа и т.д.)
+CREATE INDEX IF NOT EXISTS idx_neuron_transactions_reference_id ON neuron_transactions(reference_id);
+
+-- Возврат платежа
+ALTER TABLE payments ADD COLUMN IF NOT EXISTS refunded_at TIMESTAMPTZ;
+ALTER TABLE payments ADD COLUMN IF NOT EXISTS refund_external_id VARCHAR(100); -- ID возврата у провайдера
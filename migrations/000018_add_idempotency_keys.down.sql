@@ -0,0 +1,5 @@
+-- migrations/000018_add_idempotency_keys.down.sql
+CREATE UNIQUE INDEX IF NOT EXISTS idx_neuron_transactions_refund_reference
+    ON neuron_transactions(reference_id) WHERE transaction_type = 'refund';
+DROP INDEX IF EXISTS idx_neuron_transactions_idempotency_key;
+ALTER TABLE neuron_transactions DROP COLUMN IF EXISTS idempotency_key;
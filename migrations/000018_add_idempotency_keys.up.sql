@@ -0,0 +1,41 @@
+-- migrations/000018_add_idempotency_keys.up.sql
+-- Ключи идемпотентности операций с нейронами
+
+ALTER TABLE neuron_transactions ADD COLUMN IF NOT EXISTS idempotency_key VARCHAR(255);
+
+-- Ключи для уже проведенных операций с естественным идентификатором.
+-- Дубликаты, проведенные до появления ключей, остаются без ключа
+WITH candidates AS (
+    SELECT t.id, t.transaction_type,
+           CASE t.transaction_type
+               WHEN 'purchase' THEN (
+                   SELECT 'payment:' || p.id
+                   FROM payments p
+                   WHERE p.external_id = t.reference_id AND p.user_id = t.user_id
+                   ORDER BY p.id
+                   LIMIT 1
+               )
+               WHEN 'achievement' THEN 'achievement:' || t.user_id || ':' || substring(t.reference_id FROM 13)
+               ELSE t.reference_id
+           END AS idempotency_key
+    FROM neuron_transactions t
+    WHERE t.transaction_type IN ('purchase', 'refund', 'referral', 'achievement')
+      AND COALESCE(t.reference_id, '') <> ''
+),
+ranked AS (
+    SELECT id, idempotency_key,
+           ROW_NUMBER() OVER (PARTITION BY transaction_type, idempotency_key ORDER BY id) AS position
+    FROM candidates
+    WHERE idempotency_key IS NOT NULL
+)
+UPDATE neuron_transactions t
+SET idempotency_key = ranked.idempotency_key
+FROM ranked
+WHERE t.id = ranked.id AND ranked.position = 1;
+
+-- Ключ уникален в пределах типа транзакции
+CREATE UNIQUE INDEX IF NOT EXISTS idx_neuron_transactions_idempotency_key
+    ON neuron_transactions(transaction_type, idempotency_key) WHERE idempotency_key IS NOT NULL;
+
+-- Однократность возвратов теперь обеспечивается ключом идемпотентности
+DROP INDEX IF EXISTS idx_neuron_transactions_refund_reference;
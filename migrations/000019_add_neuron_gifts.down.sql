@@ -0,0 +1,6 @@
+-- migrations/000019_add_neuron_gifts.down.sql
+UPDATE subscription_plans SET features = features - 'gift_daily_limit', updated_at = NOW();
+DROP INDEX IF EXISTS idx_neuron_transactions_transfers;
+DROP INDEX IF EXISTS idx_users_username_lower;
+DELETE FROM ledger_accounts WHERE code = 'transfer' AND balance = 0
+    AND NOT EXISTS (SELECT 1 FROM ledger_entries e WHERE e.account_id = ledger_accounts.id);
@@ -0,0 +1,20 @@
+-- migrations/000019_add_neuron_gifts.up.sql
+-- Подарки и переводы нейронов между пользователями
+
+-- Транзитный счет переводов: списание у отправителя и начисление получателю
+-- проводятся через него, поэтому его баланс после каждого перевода равен нулю
+INSERT INTO ledger_accounts (code, name)
+VALUES ('transfer', 'Переводы между пользователями')
+ON CONFLICT (code) DO NOTHING;
+
+-- Поиск получателя по юзернейму без учета регистра
+CREATE INDEX IF NOT EXISTS idx_users_username_lower ON users(LOWER(username)) WHERE username IS NOT NULL;
+
+-- Дневные лимиты переводов
+CREATE INDEX IF NOT EXISTS idx_neuron_transactions_transfers
+    ON neuron_transactions(user_id, created_at) WHERE transaction_type = 'transfer';
+
+-- Суточный лимит подарков в нейронах по планам подписки
+UPDATE subscription_plans SET features = features || '{"gift_daily_limit": 100}'::jsonb, updated_at = NOW() WHERE code = 'free';
+UPDATE subscription_plans SET features = features || '{"gift_daily_limit": 1000}'::jsonb, updated_at = NOW() WHERE code = 'premium';
+UPDATE subscription_plans SET features = features || '{"gift_daily_limit": 5000}'::jsonb, updated_at = NOW() WHERE code = 'pro';
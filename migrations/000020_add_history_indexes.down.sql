@@ -0,0 +1,3 @@
+-- migrations/000020_add_history_indexes.down.sql
+DROP INDEX IF EXISTS idx_llm_usage_user_created;
+DROP INDEX IF EXISTS idx_neuron_transactions_user_created;
@@ -0,0 +1,8 @@
+-- migrations/000020_add_history_indexes.up.sql
+-- Индексы для постраничной истории транзакций и месячной статистики пользователя
+
+CREATE INDEX IF NOT EXISTS idx_neuron_transactions_user_created
+    ON neuron_transactions(user_id, created_at DESC, id DESC);
+
+CREATE INDEX IF NOT EXISTS idx_llm_usage_user_created
+    ON llm_usage(user_id, created_at);
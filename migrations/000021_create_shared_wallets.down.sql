@@ -0,0 +1,12 @@
+-- migrations/000021_create_shared_wallets.down.sql
+DELETE FROM ledger_entries WHERE wallet_id IS NOT NULL;
+ALTER TABLE ledger_entries DROP CONSTRAINT IF EXISTS ledger_entries_account_check;
+ALTER TABLE ledger_entries ADD CONSTRAINT ledger_entries_account_check CHECK ((user_id IS NULL) <> (account_id IS NULL));
+DROP INDEX IF EXISTS idx_ledger_entries_wallet_id;
+ALTER TABLE ledger_entries DROP COLUMN IF EXISTS wallet_id;
+DROP INDEX IF EXISTS idx_llm_usage_wallet_id;
+ALTER TABLE llm_usage DROP COLUMN IF EXISTS wallet_id;
+DROP INDEX IF EXISTS idx_neuron_transactions_wallet;
+ALTER TABLE neuron_transactions DROP COLUMN IF EXISTS wallet_id;
+DROP TABLE IF EXISTS neuron_wallet_members;
+DROP TABLE IF EXISTS neuron_wallets;
@@ -0,0 +1,49 @@
+-- migrations/000021_create_shared_wallets.up.sql
+-- Общие кошельки нейронов для команд и семей: владелец пополняет кошелек,
+-- участники тратят нейроны из него на запросы в пределах суточного лимита
+
+CREATE TABLE IF NOT EXISTS neuron_wallets (
+    id BIGSERIAL PRIMARY KEY,
+    name VARCHAR(64) NOT NULL,
+    owner_id BIGINT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    balance INTEGER NOT NULL DEFAULT 0,          -- Текущий баланс кошелька
+    lifetime_earned INTEGER NOT NULL DEFAULT 0,  -- Всего пополнено
+    lifetime_spent INTEGER NOT NULL DEFAULT 0,   -- Всего потрачено участниками
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    updated_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    CONSTRAINT neuron_wallets_balance_check CHECK (balance >= 0)
+);
+
+CREATE INDEX IF NOT EXISTS idx_neuron_wallets_owner_id ON neuron_wallets(owner_id);
+
+CREATE TABLE IF NOT EXISTS neuron_wallet_members (
+    wallet_id BIGINT NOT NULL REFERENCES neuron_wallets(id) ON DELETE CASCADE,
+    user_id BIGINT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    role VARCHAR(20) NOT NULL DEFAULT 'member',  -- owner, member
+    daily_limit INTEGER,                         -- Лимит трат за сутки, NULL - без ограничений
+    is_selected BOOLEAN NOT NULL DEFAULT FALSE,  -- Кошелек оплачивает запросы участника
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    updated_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    PRIMARY KEY (wallet_id, user_id),
+    CONSTRAINT neuron_wallet_members_limit_check CHECK (daily_limit IS NULL OR daily_limit > 0)
+);
+
+CREATE INDEX IF NOT EXISTS idx_neuron_wallet_members_user_id ON neuron_wallet_members(user_id);
+-- Запросы оплачивает не больше одного кошелька
+CREATE UNIQUE INDEX IF NOT EXISTS idx_neuron_wallet_members_selected ON neuron_wallet_members(user_id) WHERE is_selected;
+
+-- Транзакции кошелька: user_id - участник, совершивший операцию, wallet_id - кошелек
+ALTER TABLE neuron_transactions ADD COLUMN IF NOT EXISTS wallet_id BIGINT REFERENCES neuron_wallets(id);
+CREATE INDEX IF NOT EXISTS idx_neuron_transactions_wallet
+    ON neuron_transactions(wallet_id, user_id, created_at) WHERE wallet_id IS NOT NULL;
+
+-- Использование нейросети, оплаченное из кошелька
+ALTER TABLE llm_usage ADD COLUMN IF NOT EXISTS wallet_id BIGINT REFERENCES neuron_wallets(id);
+CREATE INDEX IF NOT EXISTS idx_llm_usage_wallet_id ON llm_usage(wallet_id) WHERE wallet_id IS NOT NULL;
+
+-- Проводка относится к счету пользователя, к кошельку или к системному счету
+ALTER TABLE ledger_entries ADD COLUMN IF NOT EXISTS wallet_id BIGINT REFERENCES neuron_wallets(id);
+ALTER TABLE ledger_entries DROP CONSTRAINT IF EXISTS ledger_entries_account_check;
+ALTER TABLE ledger_entries ADD CONSTRAINT ledger_entries_account_check
+    CHECK (num_nonnulls(user_id, account_id, wallet_id) = 1);
+CREATE INDEX IF NOT EXISTS idx_ledger_entries_wallet_id ON ledger_entries(wallet_id) WHERE wallet_id IS NOT NULL;
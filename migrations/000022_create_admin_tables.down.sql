@@ -0,0 +1,5 @@
+-- migrations/000022_create_admin_tables.down.sql
+DROP TABLE IF EXISTS error_log;
+DROP TABLE IF EXISTS disabled_models;
+DROP TABLE IF EXISTS admin_audit_log;
+DROP TABLE IF EXISTS admins;
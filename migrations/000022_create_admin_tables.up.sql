@@ -0,0 +1,43 @@
+-- migrations/000022_create_admin_tables.up.sql
+-- Консоль администратора: администраторы из базы данных (в дополнение к app.admin_ids),
+-- журнал действий, отключенные модели и ошибки из логов сервисов
+
+CREATE TABLE IF NOT EXISTS admins (
+    telegram_id BIGINT PRIMARY KEY,
+    added_by BIGINT NOT NULL,                    -- Администратор из конфигурации, выдавший права
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+CREATE TABLE IF NOT EXISTS admin_audit_log (
+    id BIGSERIAL PRIMARY KEY,
+    admin_id BIGINT NOT NULL,                    -- Telegram ID администратора
+    source VARCHAR(20) NOT NULL,                 -- telegram, api
+    action VARCHAR(50) NOT NULL,
+    target_user_id BIGINT,                       -- Пользователь, к которому относится действие
+    target VARCHAR(100),                         -- План, пакет или модель
+    reason TEXT,
+    details JSONB,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX IF NOT EXISTS idx_admin_audit_log_created_at ON admin_audit_log(created_at);
+CREATE INDEX IF NOT EXISTS idx_admin_audit_log_target_user_id
+    ON admin_audit_log(target_user_id, created_at) WHERE target_user_id IS NOT NULL;
+
+CREATE TABLE IF NOT EXISTS disabled_models (
+    model_name VARCHAR(100) PRIMARY KEY,
+    disabled_by BIGINT NOT NULL,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+CREATE TABLE IF NOT EXISTS error_log (
+    id BIGSERIAL PRIMARY KEY,
+    logger VARCHAR(100) NOT NULL,                -- Имя логгера сервиса
+    message TEXT NOT NULL,
+    error TEXT,
+    caller VARCHAR(255),
+    fields JSONB,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX IF NOT EXISTS idx_error_log_created_at ON error_log(created_at);
@@ -0,0 +1,7 @@
+-- migrations/000023_create_broadcast_tables.down.sql
+DROP TABLE IF EXISTS broadcast_deliveries;
+DROP TABLE IF EXISTS broadcast_campaigns;
+
+DROP INDEX IF EXISTS idx_users_last_active_at;
+ALTER TABLE users DROP COLUMN IF EXISTS blocked_at;
+ALTER TABLE users DROP COLUMN IF EXISTS last_active_at;
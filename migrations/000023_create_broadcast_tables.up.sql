@@ -0,0 +1,43 @@
+-- migrations/000023_create_broadcast_tables.up.sql
+-- Рассылки по сегментам пользователей: кампании, доставки и отметка о блокировке бота
+
+-- Время последней активности пользователя для сегментации. Заполняется обработчиком сообщений
+-- не чаще раза в час, до первой активности берется время последнего обновления профиля
+ALTER TABLE users ADD COLUMN IF NOT EXISTS last_active_at TIMESTAMPTZ;
+UPDATE users SET last_active_at = updated_at WHERE last_active_at IS NULL;
+
+-- Время, когда отправка пользователю завершилась ошибкой 403 (бот заблокирован).
+-- Сбрасывается при следующем сообщении от пользователя
+ALTER TABLE users ADD COLUMN IF NOT EXISTS blocked_at TIMESTAMPTZ;
+
+CREATE INDEX IF NOT EXISTS idx_users_last_active_at ON users(last_active_at);
+
+CREATE TABLE IF NOT EXISTS broadcast_campaigns (
+    id BIGSERIAL PRIMARY KEY,
+    title VARCHAR(100) NOT NULL,
+    text TEXT NOT NULL,                          -- Текст сообщения
+    segment JSONB NOT NULL DEFAULT '{}',         -- Условия отбора получателей
+    status VARCHAR(20) NOT NULL DEFAULT 'draft', -- draft, running, completed, cancelled
+    created_by BIGINT NOT NULL,                  -- Telegram ID администратора
+    total_recipients INTEGER NOT NULL DEFAULT 0, -- Получателей на момент запуска
+    started_at TIMESTAMPTZ,
+    finished_at TIMESTAMPTZ,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    updated_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX IF NOT EXISTS idx_broadcast_campaigns_created_at ON broadcast_campaigns(created_at);
+
+CREATE TABLE IF NOT EXISTS broadcast_deliveries (
+    campaign_id BIGINT NOT NULL REFERENCES broadcast_campaigns(id) ON DELETE CASCADE,
+    user_id BIGINT NOT NULL,                     -- Telegram ID получателя
+    status VARCHAR(20) NOT NULL DEFAULT 'pending', -- pending, sent, failed, blocked, skipped
+    error TEXT,
+    attempts INTEGER NOT NULL DEFAULT 0,
+    sent_at TIMESTAMPTZ,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    updated_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    PRIMARY KEY (campaign_id, user_id)
+);
+
+CREATE INDEX IF NOT EXISTS idx_broadcast_deliveries_status ON broadcast_deliveries(campaign_id, status);
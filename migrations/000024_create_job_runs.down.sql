@@ -0,0 +1,2 @@
+-- migrations/000024_create_job_runs.down.sql
+DROP TABLE IF EXISTS job_runs;
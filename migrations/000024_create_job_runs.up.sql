@@ -0,0 +1,18 @@
+-- migrations/000024_create_job_runs.up.sql
+-- История запусков периодических задач режима scheduler
+
+CREATE TABLE IF NOT EXISTS job_runs (
+    id BIGSERIAL PRIMARY KEY,
+    job_name VARCHAR(50) NOT NULL,
+    instance VARCHAR(100) NOT NULL,              -- Экземпляр scheduler, выполнивший задачу (хост и PID)
+    scheduled_at TIMESTAMPTZ NOT NULL,           -- Время запуска по расписанию
+    started_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    finished_at TIMESTAMPTZ,
+    duration_ms BIGINT,
+    status VARCHAR(20) NOT NULL,                 -- running, succeeded, failed
+    result TEXT,                                 -- Краткий итог задачи
+    error TEXT
+);
+
+CREATE INDEX IF NOT EXISTS idx_job_runs_job_name ON job_runs(job_name, started_at);
+CREATE INDEX IF NOT EXISTS idx_job_runs_started_at ON job_runs(started_at);